@@ -20,31 +20,42 @@
 package app
 
 import (
+	"crypto/subtle"
 	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
+	"github.com/go-chi/chi"
 	"github.com/go-chi/render"
 	"github.com/infomark-org/infomark/api/helper"
 	"github.com/infomark-org/infomark/auth"
 	"github.com/infomark-org/infomark/auth/authenticate"
+	"github.com/infomark-org/infomark/auth/authorize"
 	"github.com/infomark-org/infomark/configuration"
 	"github.com/infomark-org/infomark/email"
+	"github.com/infomark-org/infomark/event"
 	"github.com/infomark-org/infomark/model"
 	"github.com/infomark-org/infomark/symbol"
+	"github.com/sirupsen/logrus"
 	null "gopkg.in/guregu/null.v3"
 )
 
 // AccountResource specifies user management handler.
 type AccountResource struct {
 	Stores *Stores
+	Events *event.Bus
+	// RateLimiter limits the open routes, it is set by the router.
+	RateLimiter *authenticate.LoginLimiter
 }
 
 // NewAccountResource create and returns a AccountResource.
-func NewAccountResource(stores *Stores) *AccountResource {
+func NewAccountResource(stores *Stores, events *event.Bus) *AccountResource {
 	return &AccountResource{
 		Stores: stores,
+		Events: events,
 	}
 }
 
@@ -57,11 +68,21 @@ func NewAccountResource(stores *Stores) *AccountResource {
 // RESPONSE: 400,BadRequest
 // RESPONSE: 401,Unauthenticated
 // RESPONSE: 403,Unauthorized
+// RESPONSE: 409,Conflict
 // SUMMARY:  Create a new user account to register on the site.
 // DESCRIPTION:
-// The account will be created and a confirmation email will be sent.
-// There is no way to set an avatar here and root will be false by default.
+// The account will be created and a confirmation email will be sent. If email
+// verification is disabled in the configuration, the account is confirmed
+// right away. There is no way to set an avatar here and root will be false by default.
+// Without a language, it is negotiated from the "Accept-Language" header.
+// Student numbers have to be unique. Registration can be closed in the
+// configuration.
 func (rs *AccountResource) CreateHandler(w http.ResponseWriter, r *http.Request) {
+	if !configuration.Configuration.Server.Registration.Open {
+		render.Render(w, r, ErrUnauthorizedWithDetails(errors.New("registration is closed")))
+		return
+	}
+
 	// Start from empty Request
 	data := &CreateUserAccountRequest{}
 
@@ -71,8 +92,20 @@ func (rs *AccountResource) CreateHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	// without any preference, we use the language of the browser
+	if data.User.Language == "" {
+		data.User.Language = NegotiateLanguage(r)
+	}
+
+	if !ensureUniqueStudentNumber(rs.Stores, w, r, data.User.StudentNumber, 0) {
+		return
+	}
+
 	// We will ask the user to confirm their email address
-	token := null.StringFrom(auth.GenerateToken(32))
+	token := null.String{}
+	if configuration.Configuration.Server.Authentication.Email.Verify {
+		token = null.StringFrom(auth.GenerateToken(32))
+	}
 
 	user := &model.User{
 		FirstName:         data.User.FirstName,
@@ -102,9 +135,14 @@ func (rs *AccountResource) CreateHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	if !configuration.Configuration.Server.Debugging.Enabled {
-		err = sendConfirmEmailForUser(configuration.Configuration.Server.Email.From, newUser)
-		if err != nil {
+	if err := rs.Events.Publish(event.UserRegistered{User: newUser}); err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
+	// without email verification the account is confirmed right away
+	if !newUser.ConfirmEmailToken.Valid {
+		if err := rs.Events.Publish(event.UserConfirmed{User: newUser}); err != nil {
 			render.Render(w, r, ErrInternalServerErrorWithDetails(err))
 			return
 		}
@@ -113,13 +151,28 @@ func (rs *AccountResource) CreateHandler(w http.ResponseWriter, r *http.Request)
 }
 
 // sendConfirmEmailForUser will send the confirmation email to activate the account.
-func sendConfirmEmailForUser(from string, user *model.User) error {
-	// send email
-	// Send Email to User
-	msg, err := email.NewEmailFromTemplate(from,
+func sendConfirmEmailForUser(stores *Stores, from string, user *model.User) error {
+	// there is nothing to confirm
+	if !user.ConfirmEmailToken.Valid {
+		return nil
+	}
+
+	msg, err := newConfirmEmailForUser(from, user)
+	if err != nil {
+		return err
+	}
+	return sendUserEmail(stores, user.ID, model.EmailKindConfirmEmail, msg)
+}
+
+// newConfirmEmailForUser creates the email containing the confirmation token
+// of the user.
+func newConfirmEmailForUser(from string, user *model.User) (*email.Email, error) {
+	tpl := email.Localize(email.ConfirmEmailTemplates, LanguageOfUser(user, nil))
+
+	return email.NewEmailFromTemplate(from,
 		user.Email,
-		"Confirm Account Instructions",
-		email.ConfirmEmailTemplateEN,
+		tpl.Subject,
+		tpl.Body,
 		map[string]string{
 			"first_name":            user.FirstName,
 			"last_name":             user.LastName,
@@ -127,16 +180,6 @@ func sendConfirmEmailForUser(from string, user *model.User) error {
 			"confirm_email_address": user.Email,
 			"confirm_email_token":   user.ConfirmEmailToken.String,
 		})
-
-	if err != nil {
-		return err
-	}
-	err = email.DefaultMail.Send(msg)
-	if err != nil {
-		return err
-	}
-
-	return nil
 }
 
 // EditHandler is public endpoint for
@@ -152,7 +195,9 @@ func sendConfirmEmailForUser(from string, user *model.User) error {
 // This is the only endpoint having PATCH as the backend will automatically only
 // update fields which are non-empty. If both are given, it will update both fields.
 // If the email should be changed a new confirmation email will be sent and clicking
-// on the confirmation link is required to login again.
+// on the confirmation link is required to login again. Changes which are not
+// confirmed within the configured "change_window" are discarded and the
+// previous email address is restored.
 func (rs *AccountResource) EditHandler(w http.ResponseWriter, r *http.Request) {
 
 	accessClaims := r.Context().Value(symbol.CtxKeyAccessClaims).(*authenticate.AccessClaims)
@@ -196,23 +241,48 @@ func (rs *AccountResource) EditHandler(w http.ResponseWriter, r *http.Request) {
 	// make sure email is valid
 	if emailHasChanged {
 		// we will ask the user to confirm their email address
-		user.ConfirmEmailToken = null.StringFrom(auth.GenerateToken(32))
+		if configuration.Configuration.Server.Authentication.Email.Verify {
+			user.ConfirmEmailToken = null.StringFrom(auth.GenerateToken(32))
+
+			// the last confirmed address is restored if the change is not
+			// confirmed in time
+			if !user.PreviousEmail.Valid {
+				user.PreviousEmail = null.StringFrom(user.Email)
+			}
+			user.EmailChangedAt = null.TimeFrom(NowUTC())
+			user.EmailChangeRemindedAt = null.Time{}
+		}
 		user.Email = data.Account.Email
 	}
 
+	previousPassword := user.EncryptedPassword
 	if passwordHasChanged {
+		err := checkPasswordHistory(rs.Stores, user, data.Account.PlainPassword)
+		if err == errPasswordReused {
+			render.Render(w, r, ErrBadRequestWithDetails(err))
+			return
+		}
+		if err != nil {
+			render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+			return
+		}
+
 		user.EncryptedPassword = data.Account.EncryptedPassword
 	}
 
-	if err := rs.Stores.User.Update(user); err != nil {
+	if passwordHasChanged {
+		err = updatePasswordOfUser(rs.Stores, user, previousPassword)
+	} else {
+		err = rs.Stores.User.Update(user)
+	}
+	if err != nil {
 		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
 		return
 	}
 
 	// make sure email is valid
 	if emailHasChanged {
-		err = sendConfirmEmailForUser(configuration.Configuration.Server.Email.From, user)
-		if err != nil {
+		if err := rs.Events.Publish(event.EmailChanged{User: user}); err != nil {
 			render.Render(w, r, ErrInternalServerErrorWithDetails(err))
 			return
 		}
@@ -252,31 +322,137 @@ func (rs *AccountResource) GetHandler(w http.ResponseWriter, r *http.Request) {
 
 }
 
-// GetAvatarHandler is public endpoint for
-// URL: /account/avatar
+// GetRateLimitStatusHandler is public endpoint for
+// URL: /account/rate_limit_status
 // METHOD: get
 // TAG: account
-// RESPONSE: 200,ImageFile
-// RESPONSE: 400,BadRequest
+// RESPONSE: 200,RateLimitStatusResponse
 // RESPONSE: 401,Unauthenticated
-// SUMMARY:  Retrieve the specific account avatar from the request identity
+// SUMMARY:  the state of the rate limit of the open routes for the request identity
 // DESCRIPTION:
-// If there is an avatar for this specific user, this will return the image
-// otherwise it will use a default image. We currently support only jpg images.
-func (rs *AccountResource) GetAvatarHandler(w http.ResponseWriter, r *http.Request) {
+// The limit applies to the address of the client, asking for it does not count
+// as a request. Limited responses carry the same information in the headers
+// "X-RateLimit-Limit", "X-RateLimit-Remaining" and "X-RateLimit-Reset".
+func (rs *AccountResource) GetRateLimitStatusHandler(w http.ResponseWriter, r *http.Request) {
+	context, err := rs.RateLimiter.Peek(r, authenticate.NewLoginLimiterKeyFromIP(r))
+	if err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
+	rs.RateLimiter.WriteHeaders(w, context)
+	if err := render.Render(w, r, newRateLimitStatusResponse(context)); err != nil {
+		render.Render(w, r, ErrRender(err))
+		return
+	}
+}
 
+// GetEmailLogHandler is public endpoint for
+// URL: /account/email_log
+// METHOD: get
+// TAG: account
+// TAG: email
+// RESPONSE: 200,EmailLogEntryResponseList
+// RESPONSE: 401,Unauthenticated
+// SUMMARY:  the latest emails sent to the request identity
+// DESCRIPTION:
+// This covers confirmation and password reset emails as well as messages of
+// the staff, newest first. Only the kind, the address and whether the email
+// has been handed over to the mail server are kept, never the content. The
+// state is one of "queued", "sent" or "failed".
+func (rs *AccountResource) GetEmailLogHandler(w http.ResponseWriter, r *http.Request) {
 	accessClaims := r.Context().Value(symbol.CtxKeyAccessClaims).(*authenticate.AccessClaims)
-	file := helper.NewAvatarFileHandle(accessClaims.LoginID)
 
-	if !file.Exists() {
-		render.Render(w, r, ErrNotFound)
+	entries, err := rs.Stores.Email.GetLogOfUser(accessClaims.LoginID, emailLogLimit)
+	if err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
 		return
 	}
 
-	if err := file.WriteToBody(w); err != nil {
+	if err := render.RenderList(w, r, newEmailLogListResponse(entries)); err != nil {
+		render.Render(w, r, ErrRender(err))
+		return
+	}
+}
+
+// emailLogLimit is the number of entries of the email log returned to users.
+const emailLogLimit = 100
+
+// GetActivityHandler is public endpoint for
+// URL: /account/activity
+// QUERYPARAM: from,string
+// QUERYPARAM: to,string
+// METHOD: get
+// TAG: account
+// RESPONSE: 200,ActivityResponseList
+// RESPONSE: 400,BadRequest
+// RESPONSE: 401,Unauthenticated
+// SUMMARY:  the timeline of submissions, enrollments and logins of the request identity
+// DESCRIPTION:
+// The timeline lists the latest upload of each submission, the enrollments and
+// (if the login history is enabled) the logins, newest first. It contains at
+// most 100 entries before "to" (default: now) and after "from" (default:
+// unbounded) in RFC 3339 format. Older entries are requested by passing the
+// time of the last entry as "to".
+func (rs *AccountResource) GetActivityHandler(w http.ResponseWriter, r *http.Request) {
+	accessClaims := r.Context().Value(symbol.CtxKeyAccessClaims).(*authenticate.AccessClaims)
+
+	from := null.Time{}
+	if value := r.FormValue("from"); value != "" {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			render.Render(w, r, ErrBadRequestWithDetails(err))
+			return
+		}
+		from = null.TimeFrom(parsed)
+	}
+
+	to := NowUTC()
+	if value := r.FormValue("to"); value != "" {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			render.Render(w, r, ErrBadRequestWithDetails(err))
+			return
+		}
+		to = parsed
+	}
+
+	activities, err := rs.Stores.User.Activity(accessClaims.LoginID, from, to, activityLimit)
+	if err != nil {
 		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
+	if err := render.RenderList(w, r, newActivityListResponse(activities)); err != nil {
+		render.Render(w, r, ErrRender(err))
+		return
 	}
+}
+
+// activityLimit is the number of entries of the activity timeline per request.
+const activityLimit = 100
+
+// GetAvatarHandler is public endpoint for
+// URL: /account/avatar
+// QUERYPARAM: size,integer
+// METHOD: get
+// TAG: account
+// RESPONSE: 200,ImageFile
+// RESPONSE: 304,NotModified
+// RESPONSE: 400,BadRequest
+// RESPONSE: 401,Unauthenticated
+// RESPONSE: 404,NotFound
+// SUMMARY:  Retrieve the specific account avatar from the request identity
+// DESCRIPTION:
+// If there is an avatar for this specific user, this will return the image
+// otherwise clients should use a default image. The response carries a weak
+// ETag just like "/users/{user_id}/avatar".
+// The optional "size" (32, 64, 128 or 256) returns a copy scaled down to fit
+// into size x size pixels.
+func (rs *AccountResource) GetAvatarHandler(w http.ResponseWriter, r *http.Request) {
 
+	accessClaims := r.Context().Value(symbol.CtxKeyAccessClaims).(*authenticate.AccessClaims)
+	writeAvatar(w, r, accessClaims.LoginID)
 }
 
 // ChangeAvatarHandler is public endpoint for
@@ -289,7 +465,8 @@ func (rs *AccountResource) GetAvatarHandler(w http.ResponseWriter, r *http.Reque
 // RESPONSE: 401,Unauthenticated
 // SUMMARY:  Change the specific account avatar of the request identity
 // DESCRIPTION:
-// We currently support only jpg, jpeg,png images.
+// We currently support only jpg, jpeg,png images. The size of the file has to
+// be between the configured "min_avatar" and "max_avatar".
 func (rs *AccountResource) ChangeAvatarHandler(w http.ResponseWriter, r *http.Request) {
 
 	accessClaims := r.Context().Value(symbol.CtxKeyAccessClaims).(*authenticate.AccessClaims)
@@ -303,11 +480,13 @@ func (rs *AccountResource) ChangeAvatarHandler(w http.ResponseWriter, r *http.Re
 
 	if _, err := helper.NewAvatarFileHandle(user.ID).WriteToDisk(r, "file_data"); err != nil {
 		render.Render(w, r, ErrBadRequestWithDetails(err))
+		return
 	}
 
 	user.AvatarURL = null.StringFrom(fmt.Sprintf("/api/v1/users/%s/avatar", strconv.FormatInt(user.ID, 10)))
 	if err := rs.Stores.User.Update(user); err != nil {
 		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
 	}
 
 	render.Status(r, http.StatusOK)
@@ -340,20 +519,71 @@ func (rs *AccountResource) DeleteAvatarHandler(w http.ResponseWriter, r *http.Re
 	render.Status(r, http.StatusNoContent)
 }
 
+// semesterFilterFromURL reads the optional filters "semester" ("summer" or
+// "winter") and "year" of lists of enrollments.
+func semesterFilterFromURL(r *http.Request) (string, int, error) {
+	semester := helper.StringFromURL(r, "semester", "")
+	if semester != "" && semester != "summer" && semester != "winter" {
+		return "", 0, fmt.Errorf("semester '%s' must be one of 'summer', 'winter'", semester)
+	}
+
+	year := 0
+	if value := r.FormValue("year"); value != "" {
+		var err error
+		if year, err = strconv.Atoi(value); err != nil || year < 1 {
+			return "", 0, fmt.Errorf("year '%s' must be a positive integer", value)
+		}
+	}
+
+	return semester, year, nil
+}
+
 // GetEnrollmentsHandler is public endpoint for
 // URL: /account/enrollments
+// QUERYPARAM: semester,string
+// QUERYPARAM: year,integer
+// QUERYPARAM: page,integer
+// QUERYPARAM: per_page,integer
 // METHOD: get
 // TAG: account
 // RESPONSE: 200,UserEnrollmentResponseList
 // RESPONSE: 400,BadRequest
 // RESPONSE: 401,Unauthenticated
 // SUMMARY:  Retrieve the specific account avatar from the request identity
+// DESCRIPTION:
 // This lists all course enrollments of the request identity including role.
+// The courses can be restricted to those beginning in a "semester" ("summer"
+// or "winter") and "year". Winter semesters belong to the year they begin in.
+// If "per_page" is given, only this page is returned and the "Link" header
+// points to the other pages.
 func (rs *AccountResource) GetEnrollmentsHandler(w http.ResponseWriter, r *http.Request) {
 	accessClaims := r.Context().Value(symbol.CtxKeyAccessClaims).(*authenticate.AccessClaims)
 
+	pagination, err := PaginationFromURL(r)
+	if err != nil {
+		render.Render(w, r, ErrBadRequestWithDetails(err))
+		return
+	}
+
+	semester, year, err := semesterFilterFromURL(r)
+	if err != nil {
+		render.Render(w, r, ErrBadRequestWithDetails(err))
+		return
+	}
+
+	limit, offset := 0, 0
+	if pagination != nil {
+		total, err := rs.Stores.User.CountEnrollments(accessClaims.LoginID, semester, year)
+		if err != nil {
+			render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+			return
+		}
+		pagination.WriteLinkHeader(w, r, total)
+		limit, offset = pagination.PerPage, pagination.Offset()
+	}
+
 	// get enrollments
-	enrollments, err := rs.Stores.User.GetEnrollments(accessClaims.LoginID)
+	enrollments, err := rs.Stores.User.GetEnrollmentsPage(accessClaims.LoginID, semester, year, limit, offset)
 	if err != nil {
 		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
 		return
@@ -366,20 +596,196 @@ func (rs *AccountResource) GetEnrollmentsHandler(w http.ResponseWriter, r *http.
 	}
 }
 
+// GetDeadlinesHandler is public endpoint for
+// URL: /account/deadlines
+// QUERYPARAM: from,string
+// QUERYPARAM: to,string
+// METHOD: get
+// TAG: account
+// RESPONSE: 200,DeadlineResponseList
+// RESPONSE: 400,BadRequest
+// RESPONSE: 401,Unauthenticated
+// SUMMARY:  the upcoming deadlines of the request identity across all courses
+// DESCRIPTION:
+// This lists the due dates of all published sheets in the courses of the request
+// identity, the earliest first. The range is given by "from" (default: now) and
+// "to" (default: unbounded) in RFC 3339 format, e.g. "2020-04-01T00:00:00Z".
+func (rs *AccountResource) GetDeadlinesHandler(w http.ResponseWriter, r *http.Request) {
+	accessClaims := r.Context().Value(symbol.CtxKeyAccessClaims).(*authenticate.AccessClaims)
+
+	from := NowUTC()
+	if value := r.FormValue("from"); value != "" {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			render.Render(w, r, ErrBadRequestWithDetails(err))
+			return
+		}
+		from = parsed
+	}
+
+	to := null.Time{}
+	if value := r.FormValue("to"); value != "" {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			render.Render(w, r, ErrBadRequestWithDetails(err))
+			return
+		}
+		to = null.TimeFrom(parsed)
+	}
+
+	deadlines, err := rs.Stores.Sheet.DeadlinesOfUser(accessClaims.LoginID, from, to)
+	if err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
+	// render JSON response
+	if err = render.RenderList(w, r, newDeadlineListResponse(deadlines)); err != nil {
+		render.Render(w, r, ErrRender(err))
+		return
+	}
+}
+
+// CreateCalendarTokenHandler is public endpoint for
+// URL: /account/calendar_token
+// METHOD: post
+// TAG: account
+// RESPONSE: 201,CalendarTokenResponse
+// RESPONSE: 400,BadRequest
+// RESPONSE: 401,Unauthenticated
+// SUMMARY:  Create the secret url of the calendar feed of the deadlines
+// DESCRIPTION:
+// Calendar apps cannot send bearer tokens, hence the feed is authenticated by a
+// secret token in its url. The token is only part of this response. Creating a
+// new token invalidates the previous one.
+func (rs *AccountResource) CreateCalendarTokenHandler(w http.ResponseWriter, r *http.Request) {
+	accessClaims := r.Context().Value(symbol.CtxKeyAccessClaims).(*authenticate.AccessClaims)
+
+	user, err := rs.Stores.User.Get(accessClaims.LoginID)
+	if err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
+	token := auth.GenerateToken(32)
+	user.CalendarTokenHash = null.StringFrom(auth.HashToken(token))
+	if err := rs.Stores.User.Update(user); err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
+	render.Status(r, http.StatusCreated)
+	if err := render.Render(w, r, newCalendarTokenResponse(token)); err != nil {
+		render.Render(w, r, ErrRender(err))
+		return
+	}
+}
+
+// DeleteCalendarTokenHandler is public endpoint for
+// URL: /account/calendar_token
+// METHOD: delete
+// TAG: account
+// RESPONSE: 204,NoContent
+// RESPONSE: 400,BadRequest
+// RESPONSE: 401,Unauthenticated
+// SUMMARY:  Disable the calendar feed of the deadlines
+func (rs *AccountResource) DeleteCalendarTokenHandler(w http.ResponseWriter, r *http.Request) {
+	accessClaims := r.Context().Value(symbol.CtxKeyAccessClaims).(*authenticate.AccessClaims)
+
+	user, err := rs.Stores.User.Get(accessClaims.LoginID)
+	if err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
+	user.CalendarTokenHash = null.String{}
+	if err := rs.Stores.User.Update(user); err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
+	render.Status(r, http.StatusNoContent)
+}
+
+// GetDeadlinesCalendarHandler is public endpoint for
+// URL: /account/deadlines.ics
+// QUERYPARAM: token,string
+// METHOD: get
+// TAG: account
+// RESPONSE: 200,CalendarFile
+// RESPONSE: 401,Unauthenticated
+// SUMMARY:  the deadlines of a user as iCalendar feed
+// DESCRIPTION:
+// The feed is authenticated by the token from POST /account/calendar_token and
+// contains the due dates of all published sheets in the courses of its owner.
+func (rs *AccountResource) GetDeadlinesCalendarHandler(w http.ResponseWriter, r *http.Request) {
+	token := r.FormValue("token")
+	if token == "" {
+		render.Render(w, r, ErrUnauthenticated)
+		return
+	}
+
+	user, err := rs.Stores.User.FindByCalendarTokenHash(auth.HashToken(token))
+	if err != nil {
+		render.Render(w, r, ErrUnauthenticated)
+		return
+	}
+
+	deadlines, err := rs.Stores.Sheet.DeadlinesOfUser(user.ID, time.Time{}, null.Time{})
+	if err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Content-Disposition", "inline; filename=\"deadlines.ics\"")
+	writeDeadlineCalendar(w, user, deadlines, configuration.Configuration.Server.HTTP.Domain, NowUTC())
+}
+
 // GetExamEnrollmentsHandler is public endpoint for
 // URL: /account/exams/enrollments
+// QUERYPARAM: semester,string
+// QUERYPARAM: year,integer
+// QUERYPARAM: page,integer
+// QUERYPARAM: per_page,integer
 // METHOD: get
 // TAG: account
 // RESPONSE: 200,ExamEnrollmentResponseList
 // RESPONSE: 400,BadRequest
 // RESPONSE: 401,Unauthenticated
 // SUMMARY:  Retrieve the specific account avatar from the request identity
-// This lists all course enrollments of the request identity including role.
+// DESCRIPTION:
+// This lists all exam enrollments of the request identity. The filters and
+// the pagination are the same as for /account/enrollments and refer to the
+// courses of the exams.
 func (rs *AccountResource) GetExamEnrollmentsHandler(w http.ResponseWriter, r *http.Request) {
 	accessClaims := r.Context().Value(symbol.CtxKeyAccessClaims).(*authenticate.AccessClaims)
 
+	pagination, err := PaginationFromURL(r)
+	if err != nil {
+		render.Render(w, r, ErrBadRequestWithDetails(err))
+		return
+	}
+
+	semester, year, err := semesterFilterFromURL(r)
+	if err != nil {
+		render.Render(w, r, ErrBadRequestWithDetails(err))
+		return
+	}
+
+	limit, offset := 0, 0
+	if pagination != nil {
+		total, err := rs.Stores.Exam.CountEnrollmentsOfUser(accessClaims.LoginID, semester, year)
+		if err != nil {
+			render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+			return
+		}
+		pagination.WriteLinkHeader(w, r, total)
+		limit, offset = pagination.PerPage, pagination.Offset()
+	}
+
 	// get enrollments
-	enrollments, err := rs.Stores.Exam.GetEnrollmentsOfUser(accessClaims.LoginID)
+	enrollments, err := rs.Stores.Exam.GetEnrollmentsOfUserPage(accessClaims.LoginID, semester, year, limit, offset)
 	if err != nil {
 		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
 		return
@@ -391,3 +797,401 @@ func (rs *AccountResource) GetExamEnrollmentsHandler(w http.ResponseWriter, r *h
 		return
 	}
 }
+
+// EnrollTwoFactorHandler is public endpoint for
+// URL: /account/2fa/enroll
+// METHOD: post
+// TAG: account
+// REQUEST: Empty
+// RESPONSE: 200,TwoFactorEnrollResponse
+// RESPONSE: 400,BadRequest
+// RESPONSE: 401,Unauthenticated
+// RESPONSE: 403,Unauthorized
+// SUMMARY:  Start the two-factor authentication setup
+// DESCRIPTION:
+// Two-factor authentication is only available for staff (tutors, admins and root).
+// This will generate a new TOTP secret which needs to be confirmed by
+// /account/2fa/verify before it becomes active.
+func (rs *AccountResource) EnrollTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	accessClaims := r.Context().Value(symbol.CtxKeyAccessClaims).(*authenticate.AccessClaims)
+
+	user, err := rs.Stores.User.Get(accessClaims.LoginID)
+	if err != nil {
+		render.Render(w, r, ErrNotFound)
+		return
+	}
+
+	isStaff, err := rs.isStaff(user)
+	if err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+	if !isStaff {
+		render.Render(w, r, ErrUnauthorizedWithDetails(errors.New("two-factor authentication is only available for staff")))
+		return
+	}
+
+	if user.TOTPEnabled {
+		render.Render(w, r, ErrBadRequestWithDetails(errors.New("two-factor authentication is already enabled")))
+		return
+	}
+
+	secret := auth.GenerateTOTPSecret()
+	encryptedSecret, err := auth.EncryptString(configuration.Configuration.Server.Authentication.TwoFactor.Secret, secret)
+	if err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
+	user.TOTPSecret = null.StringFrom(encryptedSecret)
+	user.TOTPRecoveryCodes = ""
+	if err := rs.Stores.User.Update(user); err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
+	resp := &TwoFactorEnrollResponse{
+		Secret: secret,
+		URL:    auth.TOTPURL(configuration.Configuration.Server.Authentication.TwoFactor.Issuer, user.Email, secret),
+	}
+
+	if err := render.Render(w, r, resp); err != nil {
+		render.Render(w, r, ErrRender(err))
+		return
+	}
+}
+
+// VerifyTwoFactorHandler is public endpoint for
+// URL: /account/2fa/verify
+// METHOD: post
+// TAG: account
+// REQUEST: TwoFactorCodeRequest
+// RESPONSE: 200,TwoFactorRecoveryCodesResponse
+// RESPONSE: 400,BadRequest
+// RESPONSE: 401,Unauthenticated
+// SUMMARY:  Activate the two-factor authentication
+// DESCRIPTION:
+// The code from the authenticator app is required to activate the two-factor
+// authentication. The response contains recovery codes which are only shown once.
+// Each of them can be used instead of a TOTP code exactly one time.
+func (rs *AccountResource) VerifyTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	accessClaims := r.Context().Value(symbol.CtxKeyAccessClaims).(*authenticate.AccessClaims)
+
+	data := &TwoFactorCodeRequest{}
+	if err := render.Bind(r, data); err != nil {
+		render.Render(w, r, ErrBadRequestWithDetails(err))
+		return
+	}
+
+	user, err := rs.Stores.User.Get(accessClaims.LoginID)
+	if err != nil {
+		render.Render(w, r, ErrNotFound)
+		return
+	}
+
+	if !user.TOTPSecret.Valid {
+		render.Render(w, r, ErrBadRequestWithDetails(errors.New("two-factor authentication has not been enrolled")))
+		return
+	}
+
+	if user.TOTPEnabled {
+		render.Render(w, r, ErrBadRequestWithDetails(errors.New("two-factor authentication is already enabled")))
+		return
+	}
+
+	secret, err := auth.DecryptString(configuration.Configuration.Server.Authentication.TwoFactor.Secret, user.TOTPSecret.String)
+	if err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
+	if !auth.ValidateTOTPCode(secret, data.Code) {
+		render.Render(w, r, ErrBadRequestWithDetails(errors.New("two-factor code is wrong")))
+		return
+	}
+
+	recoveryCodes := make([]string, 10)
+	hashedRecoveryCodes := make([]string, 10)
+	for k := range recoveryCodes {
+		recoveryCodes[k] = auth.GenerateToken(5)
+		hashedRecoveryCodes[k] = auth.HashToken(recoveryCodes[k])
+	}
+
+	user.TOTPEnabled = true
+	user.TOTPRecoveryCodes = strings.Join(hashedRecoveryCodes, ",")
+	if err := rs.Stores.User.Update(user); err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
+	if err := render.Render(w, r, &TwoFactorRecoveryCodesResponse{RecoveryCodes: recoveryCodes}); err != nil {
+		render.Render(w, r, ErrRender(err))
+		return
+	}
+}
+
+// DisableTwoFactorHandler is public endpoint for
+// URL: /account/2fa/disable
+// METHOD: post
+// TAG: account
+// REQUEST: TwoFactorCodeRequest
+// RESPONSE: 204,NoContent
+// RESPONSE: 400,BadRequest
+// RESPONSE: 401,Unauthenticated
+// SUMMARY:  Deactivate the two-factor authentication
+// DESCRIPTION:
+// Either a current TOTP code or a recovery code is required.
+func (rs *AccountResource) DisableTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	accessClaims := r.Context().Value(symbol.CtxKeyAccessClaims).(*authenticate.AccessClaims)
+
+	data := &TwoFactorCodeRequest{}
+	if err := render.Bind(r, data); err != nil {
+		render.Render(w, r, ErrBadRequestWithDetails(err))
+		return
+	}
+
+	user, err := rs.Stores.User.Get(accessClaims.LoginID)
+	if err != nil {
+		render.Render(w, r, ErrNotFound)
+		return
+	}
+
+	if !user.TOTPEnabled {
+		render.Render(w, r, ErrBadRequestWithDetails(errors.New("two-factor authentication is not enabled")))
+		return
+	}
+
+	if err := checkSecondFactor(rs.Stores, user, data.Code); err != nil {
+		render.Render(w, r, ErrBadRequestWithDetails(err))
+		return
+	}
+
+	user.TOTPEnabled = false
+	user.TOTPSecret = null.String{}
+	user.TOTPRecoveryCodes = ""
+	if err := rs.Stores.User.Update(user); err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
+	render.Status(r, http.StatusNoContent)
+}
+
+// IndexAPIKeysHandler is public endpoint for
+// URL: /account/api_keys
+// METHOD: get
+// TAG: account
+// RESPONSE: 200,APIKeyResponseList
+// RESPONSE: 400,BadRequest
+// RESPONSE: 401,Unauthenticated
+// SUMMARY:  List all personal api keys of the request identity
+func (rs *AccountResource) IndexAPIKeysHandler(w http.ResponseWriter, r *http.Request) {
+	accessClaims := r.Context().Value(symbol.CtxKeyAccessClaims).(*authenticate.AccessClaims)
+
+	apiKeys, err := rs.Stores.APIKey.APIKeysOfUser(accessClaims.LoginID)
+	if err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
+	if err := render.RenderList(w, r, rs.newAPIKeyListResponse(apiKeys)); err != nil {
+		render.Render(w, r, ErrRender(err))
+		return
+	}
+}
+
+// CreateAPIKeyHandler is public endpoint for
+// URL: /account/api_keys
+// METHOD: post
+// TAG: account
+// REQUEST: APIKeyRequest
+// RESPONSE: 201,APIKeyResponse
+// RESPONSE: 400,BadRequest
+// RESPONSE: 401,Unauthenticated
+// RESPONSE: 403,Unauthorized
+// SUMMARY:  Create a personal api key
+// DESCRIPTION:
+// The key is only part of this response and cannot be retrieved later. Scripts
+// authenticate by the header "Authorization: ApiKey <key>". Keys with the scope
+// "read" can only be used for GET requests. Impersonation tokens cannot create
+// keys.
+func (rs *AccountResource) CreateAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	accessClaims := r.Context().Value(symbol.CtxKeyAccessClaims).(*authenticate.AccessClaims)
+
+	data := &APIKeyRequest{}
+	if err := render.Bind(r, data); err != nil {
+		render.Render(w, r, ErrBadRequestWithDetails(err))
+		return
+	}
+
+	key := auth.GenerateToken(32)
+	apiKey, err := rs.Stores.APIKey.Create(&model.APIKey{
+		UserID:  accessClaims.LoginID,
+		Name:    data.Name,
+		KeyHash: auth.HashToken(key),
+		Scope:   data.Scope,
+	})
+	if err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
+	resp := rs.newAPIKeyResponse(apiKey)
+	resp.Key = key
+
+	render.Status(r, http.StatusCreated)
+	if err := render.Render(w, r, resp); err != nil {
+		render.Render(w, r, ErrRender(err))
+		return
+	}
+}
+
+// DeleteAPIKeyHandler is public endpoint for
+// URL: /account/api_keys/{api_key_id}
+// URLPARAM: api_key_id,integer
+// METHOD: delete
+// TAG: account
+// RESPONSE: 204,NoContent
+// RESPONSE: 400,BadRequest
+// RESPONSE: 401,Unauthenticated
+// RESPONSE: 404,NotFound
+// SUMMARY:  Revoke a personal api key
+// DESCRIPTION:
+// The key is rejected immediately. It is still listed together with the time
+// it has been revoked.
+func (rs *AccountResource) DeleteAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	accessClaims := r.Context().Value(symbol.CtxKeyAccessClaims).(*authenticate.AccessClaims)
+
+	apiKeyID, err := strconv.ParseInt(chi.URLParam(r, "api_key_id"), 10, 64)
+	if err != nil {
+		render.Render(w, r, ErrBadRequest)
+		return
+	}
+
+	apiKey, err := rs.Stores.APIKey.Get(apiKeyID)
+	// keys of other users do not exist for the request identity
+	if err != nil || apiKey.UserID != accessClaims.LoginID {
+		render.Render(w, r, ErrNotFound)
+		return
+	}
+
+	if err := rs.Stores.APIKey.Revoke(apiKey.ID); err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"module":     "audit",
+		"action":     "api_key.revoke",
+		"actor_id":   accessClaims.LoginID,
+		"api_key_id": apiKey.ID,
+	}).Info("revoked api key")
+
+	render.Status(r, http.StatusNoContent)
+}
+
+// ResolveAPIKey implements authenticate.APIKeyResolver.
+func (rs *AccountResource) ResolveAPIKey(key string) (int64, bool, string, error) {
+	apiKey, err := rs.Stores.APIKey.FindByHash(auth.HashToken(key))
+	if err != nil {
+		return 0, false, "", err
+	}
+
+	user, err := rs.Stores.User.Get(apiKey.UserID)
+	if err != nil {
+		return 0, false, "", err
+	}
+
+	return user.ID, user.Root, apiKey.Scope, nil
+}
+
+// isStaff tests whether a user is root or at least a tutor in any course.
+func (rs *AccountResource) isStaff(user *model.User) (bool, error) {
+	if user.Root {
+		return true, nil
+	}
+
+	enrollments, err := rs.Stores.User.GetEnrollments(user.ID)
+	if err != nil {
+		return false, err
+	}
+
+	for _, enrollment := range enrollments {
+		if enrollment.Role >= int64(authorize.TUTOR) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// errPasswordReused is returned if a new password is one of the latest
+// passwords of the user.
+var errPasswordReused = errors.New("this password has been used recently, please choose a different one")
+
+// checkPasswordHistory rejects a new password matching the current or one of
+// the previous passwords of a user, as many as configured by "history".
+func checkPasswordHistory(stores *Stores, user *model.User, plainPassword string) error {
+	history := configuration.Configuration.Server.Authentication.Password.History
+	if history <= 0 {
+		return nil
+	}
+
+	if auth.CheckPasswordHash(plainPassword, user.EncryptedPassword) {
+		return errPasswordReused
+	}
+	if history == 1 {
+		return nil
+	}
+
+	previous, err := stores.User.PreviousPasswords(user.ID, history-1)
+	if err != nil {
+		return err
+	}
+	for _, hash := range previous {
+		if auth.CheckPasswordHash(plainPassword, hash) {
+			return errPasswordReused
+		}
+	}
+	return nil
+}
+
+// updatePasswordOfUser stores a user whose password has been replaced. The
+// replaced password is added to the history within the same transaction, such
+// that the history cannot miss a password which has been in use.
+func updatePasswordOfUser(stores *Stores, user *model.User, previousPassword string) error {
+	history := configuration.Configuration.Server.Authentication.Password.History
+	if history <= 1 {
+		return stores.User.Update(user)
+	}
+	return stores.User.UpdateWithPreviousPassword(user, previousPassword, history-1)
+}
+
+// checkSecondFactor verifies a TOTP code or a recovery code of a user with
+// enabled two-factor authentication. A used recovery code gets invalidated.
+func checkSecondFactor(stores *Stores, user *model.User, code string) error {
+	code = strings.TrimSpace(code)
+	if code == "" {
+		return errors.New("two-factor code is required")
+	}
+
+	secret, err := auth.DecryptString(configuration.Configuration.Server.Authentication.TwoFactor.Secret, user.TOTPSecret.String)
+	if err != nil {
+		return err
+	}
+
+	if auth.ValidateTOTPCode(secret, code) {
+		return nil
+	}
+
+	// maybe it is a recovery code
+	hashedCode := auth.HashToken(code)
+	hashedRecoveryCodes := strings.Split(user.TOTPRecoveryCodes, ",")
+	for k, candidate := range hashedRecoveryCodes {
+		if candidate != "" && subtle.ConstantTimeCompare([]byte(candidate), []byte(hashedCode)) == 1 {
+			user.TOTPRecoveryCodes = strings.Join(append(hashedRecoveryCodes[:k], hashedRecoveryCodes[k+1:]...), ",")
+			return stores.User.Update(user)
+		}
+	}
+
+	return errors.New("two-factor code is wrong")
+}
@@ -27,6 +27,7 @@ import (
 	validation "github.com/go-ozzo/ozzo-validation"
 	"github.com/go-ozzo/ozzo-validation/is"
 	"github.com/infomark-org/infomark/auth"
+	"github.com/infomark-org/infomark/auth/authenticate"
 	"github.com/infomark-org/infomark/configuration"
 )
 
@@ -42,7 +43,7 @@ type CreateUserAccountRequest struct {
 		StudentNumber string `json:"student_number" example:"0815"`
 		Semester      int    `json:"semester" example:"15" minval:"1"`
 		Subject       string `json:"subject" example:"computer science"`
-		Language      string `json:"language" example:"en" len:"2"`
+		Language      string `json:"language" example:"en" len:"2" required:"false"`
 	} `json:"user" required:"true"`
 	Account *struct {
 		Email             string `json:"email" example:"test@uni-tuebingen.de"`
@@ -55,6 +56,7 @@ type CreateUserAccountRequest struct {
 func (body *CreateUserAccountRequest) Validate() error {
 
 	body.User.FirstName = strings.TrimSpace(body.User.FirstName)
+	body.User.Subject = strings.TrimSpace(body.User.Subject)
 	body.User.LastName = strings.TrimSpace(body.User.LastName)
 
 	body.User.Email = strings.TrimSpace(body.User.Email)
@@ -80,17 +82,15 @@ func (body *CreateUserAccountRequest) Validate() error {
 		),
 		validation.Field(
 			&body.User.Semester,
-			validation.Required,
-			validation.Min(1),
+			semesterRules()...,
 		),
 		validation.Field(
 			&body.User.Subject,
-			validation.Required,
+			subjectRules()...,
 		),
 
 		validation.Field(
 			&body.User.Language,
-			validation.Required,
 			validation.Length(2, 2),
 		),
 	)
@@ -165,3 +165,36 @@ func (body *AccountRequest) Bind(r *http.Request) error {
 		validation.Field(&body.Account.Email, is.Email),
 	)
 }
+
+// TwoFactorCodeRequest is the request to confirm an action by a two-factor code.
+type TwoFactorCodeRequest struct {
+	Code string `json:"code" example:"123456"`
+}
+
+// Bind preprocesses a TwoFactorCodeRequest.
+func (body *TwoFactorCodeRequest) Bind(r *http.Request) error {
+	body.Code = strings.TrimSpace(body.Code)
+
+	return validation.ValidateStruct(body,
+		validation.Field(&body.Code, validation.Required),
+	)
+}
+
+// APIKeyRequest is the request to create a personal api key.
+type APIKeyRequest struct {
+	Name  string `json:"name" example:"download-script"`
+	Scope string `json:"scope" example:"read" required:"false"`
+}
+
+// Bind preprocesses a APIKeyRequest.
+func (body *APIKeyRequest) Bind(r *http.Request) error {
+	body.Name = strings.TrimSpace(body.Name)
+	if body.Scope == "" {
+		body.Scope = authenticate.APIKeyScopeRead
+	}
+
+	return validation.ValidateStruct(body,
+		validation.Field(&body.Name, validation.Required),
+		validation.Field(&body.Scope, validation.In(authenticate.APIKeyScopeRead, authenticate.APIKeyScopeWrite)),
+	)
+}
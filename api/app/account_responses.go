@@ -20,10 +20,16 @@
 package app
 
 import (
+	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/go-chi/render"
+	"github.com/infomark-org/infomark/configuration"
 	"github.com/infomark-org/infomark/model"
+	"github.com/infomark-org/infomark/symbol"
+	"github.com/ulule/limiter/v3"
+	null "gopkg.in/guregu/null.v3"
 )
 
 // UserEnrollmentResponse is the response payload for account management.
@@ -56,3 +62,200 @@ func (rs *AccountResource) newUserEnrollmentsResponse(enrollments []model.Enroll
 
 	return list
 }
+
+// DeadlineResponse is the response payload for an upcoming due date of a sheet.
+type DeadlineResponse struct {
+	CourseID   int64     `json:"course_id" example:"1"`
+	CourseName string    `json:"course_name" example:"Info 1"`
+	SheetID    int64     `json:"sheet_id" example:"12"`
+	SheetName  string    `json:"sheet_name" example:"Blatt 4"`
+	DueAt      time.Time `json:"due_at" example:"auto"`
+}
+
+// Render post-processes a DeadlineResponse.
+func (body *DeadlineResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+func newDeadlineListResponse(deadlines []model.Deadline) []render.Renderer {
+	list := []render.Renderer{}
+	for k := range deadlines {
+		list = append(list, &DeadlineResponse{
+			CourseID:   deadlines[k].CourseID,
+			CourseName: deadlines[k].CourseName,
+			SheetID:    deadlines[k].SheetID,
+			SheetName:  deadlines[k].SheetName,
+			DueAt:      deadlines[k].DueAt,
+		})
+	}
+	return list
+}
+
+// CalendarTokenResponse is the response payload containing the secret url of
+// the calendar feed.
+type CalendarTokenResponse struct {
+	Token string `json:"token" example:"3f9a1c..."`
+	URL   string `json:"url" example:"https://infomark.org/api/v1/account/deadlines.ics?token=3f9a1c..."`
+}
+
+// Render post-processes a CalendarTokenResponse.
+func (body *CalendarTokenResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+func newCalendarTokenResponse(token string) *CalendarTokenResponse {
+	return &CalendarTokenResponse{
+		Token: token,
+		URL: fmt.Sprintf("%s/api/v1/account/deadlines.ics?token=%s",
+			configuration.Configuration.Server.ExternalURL(), token),
+	}
+}
+
+// RateLimitStatusResponse is the response payload containing the state of the
+// rate limit of the open routes.
+type RateLimitStatusResponse struct {
+	Limit     int64     `json:"limit" example:"600"`
+	Remaining int64     `json:"remaining" example:"598"`
+	Reset     time.Time `json:"reset" example:"auto"`
+	Reached   bool      `json:"reached" example:"false"`
+}
+
+// Render post-processes a RateLimitStatusResponse.
+func (body *RateLimitStatusResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+func newRateLimitStatusResponse(context limiter.Context) *RateLimitStatusResponse {
+	return &RateLimitStatusResponse{
+		Limit:     context.Limit,
+		Remaining: context.Remaining,
+		Reset:     time.Unix(context.Reset, 0).UTC(),
+		Reached:   context.Reached,
+	}
+}
+
+// EmailLogEntryResponse is the response payload for an email sent to the
+// request identity.
+type EmailLogEntryResponse struct {
+	Kind      string    `json:"kind" example:"confirm_email"`
+	Email     string    `json:"email" example:"test@uni-tuebingen.de"`
+	State     string    `json:"state" example:"sent"`
+	CreatedAt time.Time `json:"created_at" example:"auto"`
+	UpdatedAt time.Time `json:"updated_at" example:"auto"`
+}
+
+// Render post-processes a EmailLogEntryResponse.
+func (body *EmailLogEntryResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+// emailDeliveryStateNames are the names of the states of an email as used in
+// the responses.
+var emailDeliveryStateNames = map[symbol.EmailDeliveryState]string{
+	symbol.EmailDeliveryQueued: "queued",
+	symbol.EmailDeliverySent:   "sent",
+	symbol.EmailDeliveryFailed: "failed",
+}
+
+func newEmailLogListResponse(entries []model.EmailLogEntry) []render.Renderer {
+	list := []render.Renderer{}
+	for k := range entries {
+		list = append(list, &EmailLogEntryResponse{
+			Kind:      entries[k].Kind,
+			Email:     entries[k].Email,
+			State:     emailDeliveryStateNames[symbol.EmailDeliveryState(entries[k].State)],
+			CreatedAt: entries[k].CreatedAt,
+			UpdatedAt: entries[k].UpdatedAt,
+		})
+	}
+	return list
+}
+
+// ActivityResponse is a single entry of the activity timeline of the request
+// identity. Logins have neither a course nor a task, enrollments no task.
+type ActivityResponse struct {
+	Kind       string      `json:"kind" example:"submission"`
+	OccurredAt time.Time   `json:"occurred_at" example:"auto"`
+	CourseID   null.Int    `json:"course_id" example:"1"`
+	CourseName null.String `json:"course_name" example:"Info2"`
+	TaskID     null.Int    `json:"task_id" example:"13"`
+	TaskName   null.String `json:"task_name" example:"Task 1"`
+}
+
+// Render post-processes a ActivityResponse.
+func (body *ActivityResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+func newActivityListResponse(activities []model.Activity) []render.Renderer {
+	list := []render.Renderer{}
+	for k := range activities {
+		list = append(list, &ActivityResponse{
+			Kind:       activities[k].Kind,
+			OccurredAt: activities[k].OccurredAt,
+			CourseID:   activities[k].CourseID,
+			CourseName: activities[k].CourseName,
+			TaskID:     activities[k].TaskID,
+			TaskName:   activities[k].TaskName,
+		})
+	}
+	return list
+}
+
+// TwoFactorEnrollResponse is the response payload when starting the two-factor
+// enrollment.
+type TwoFactorEnrollResponse struct {
+	Secret string `json:"secret" example:"JBSWY3DPEHPK3PXP"`
+	URL    string `json:"otpauth_url" example:"otpauth://totp/InfoMark:test@uni-tuebingen.de?secret=JBSWY3DPEHPK3PXP"`
+}
+
+// Render post-processes a TwoFactorEnrollResponse.
+func (body *TwoFactorEnrollResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+// TwoFactorRecoveryCodesResponse contains the recovery codes which are only
+// shown once.
+type TwoFactorRecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes" example:"a1b2c3d4e5"`
+}
+
+// Render post-processes a TwoFactorRecoveryCodesResponse.
+func (body *TwoFactorRecoveryCodesResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+// APIKeyResponse is the response payload for personal api keys. The key itself
+// is only part of the response when it has been created.
+type APIKeyResponse struct {
+	ID        int64     `json:"id" example:"1"`
+	Name      string    `json:"name" example:"download-script"`
+	Scope     string    `json:"scope" example:"read"`
+	CreatedAt time.Time `json:"created_at" example:"auto"`
+	RevokedAt null.Time `json:"revoked_at" example:"auto"`
+	Key       string    `json:"key,omitempty" example:"3f5b1e2a9c7d4e6f8a0b2c4d6e8f0a1b" required:"false"`
+}
+
+// Render post-processes a APIKeyResponse.
+func (body *APIKeyResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+// newAPIKeyResponse creates a response from an api key model.
+func (rs *AccountResource) newAPIKeyResponse(p *model.APIKey) *APIKeyResponse {
+	return &APIKeyResponse{
+		ID:        p.ID,
+		Name:      p.Name,
+		Scope:     p.Scope,
+		CreatedAt: p.CreatedAt,
+		RevokedAt: p.RevokedAt,
+	}
+}
+
+func (rs *AccountResource) newAPIKeyListResponse(apiKeys []model.APIKey) []render.Renderer {
+	list := []render.Renderer{}
+	for k := range apiKeys {
+		list = append(list, rs.newAPIKeyResponse(&apiKeys[k]))
+	}
+	return list
+}
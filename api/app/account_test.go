@@ -22,16 +22,23 @@ package app
 import (
 	"encoding/json"
 	"fmt"
+	"image/png"
+	"io/ioutil"
 	"net/http"
+	"net/url"
 	"os"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/franela/goblin"
+	redis "github.com/go-redis/redis"
 	"github.com/infomark-org/infomark/api/helper"
 	"github.com/infomark-org/infomark/auth"
 	"github.com/infomark-org/infomark/configuration"
 	"github.com/infomark-org/infomark/email"
+	"github.com/infomark-org/infomark/model"
+	null "gopkg.in/guregu/null.v3"
 )
 
 func TestAccount(t *testing.T) {
@@ -80,6 +87,100 @@ func TestAccount(t *testing.T) {
 			}
 		})
 
+		g.It("Should paginate and filter the enrollments of a user with many courses", func() {
+			userID := studentJWT.Claims.LoginID
+			_, err := tape.DB.Exec("DELETE FROM user_course WHERE user_id = $1;", userID)
+			g.Assert(err).Equal(nil)
+			_, err = tape.DB.Exec("DELETE FROM user_exam WHERE user_id = $1;", userID)
+			g.Assert(err).Equal(nil)
+
+			// 6 courses in summer 2020, 7 in winter 2020/21 and 1 in winter 2019/20
+			beginnings := []time.Time{}
+			for k := 0; k < 6; k++ {
+				beginnings = append(beginnings, time.Date(2020, time.Month(4+k), 15, 0, 0, 0, 0, time.UTC))
+			}
+			for k := 0; k < 6; k++ {
+				beginnings = append(beginnings, time.Date(2020, time.Month(10+k%3), 15, 0, 0, 0, 0, time.UTC))
+			}
+			beginnings = append(beginnings, time.Date(2021, 1, 10, 0, 0, 0, 0, time.UTC))
+			beginnings = append(beginnings, time.Date(2019, 10, 15, 0, 0, 0, 0, time.UTC))
+
+			for k, beginsAt := range beginnings {
+				course, err := stores.Course.Create(&model.Course{
+					Name:     fmt.Sprintf("Course %d", k),
+					BeginsAt: beginsAt,
+					EndsAt:   beginsAt.AddDate(0, 4, 0),
+				})
+				g.Assert(err).Equal(nil)
+				g.Assert(stores.Course.Enroll(course.ID, userID, 0)).Equal(nil)
+
+				exam, err := stores.Exam.Create(&model.Exam{
+					Name:     fmt.Sprintf("Exam %d", k),
+					ExamTime: beginsAt.AddDate(0, 4, 0),
+					CourseID: course.ID,
+				})
+				g.Assert(err).Equal(nil)
+				g.Assert(stores.Exam.Enroll(exam.ID, userID)).Equal(nil)
+			}
+
+			enrollments := func(url string) ([]UserEnrollmentResponse, *PaginationMeta) {
+				w := tape.Get(url, studentJWT, withEnvelope(true))
+				g.Assert(w.Code).Equal(http.StatusOK)
+				envelope := struct {
+					Data []UserEnrollmentResponse `json:"data"`
+					Meta EnvelopeMeta             `json:"meta"`
+				}{}
+				g.Assert(json.NewDecoder(w.Body).Decode(&envelope)).Equal(nil)
+				return envelope.Data, envelope.Meta.Pagination
+			}
+
+			list, meta := enrollments("/api/v1/account/enrollments?per_page=5")
+			g.Assert(len(list)).Equal(5)
+			g.Assert(meta.Total).Equal(14)
+			g.Assert(meta.LastPage).Equal(3)
+
+			seen := map[int64]bool{}
+			for page := 1; page <= 3; page++ {
+				list, _ = enrollments(fmt.Sprintf("/api/v1/account/enrollments?page=%d&per_page=5", page))
+				for _, enrollment := range list {
+					seen[enrollment.CourseID] = true
+				}
+			}
+			g.Assert(len(list)).Equal(4)
+			g.Assert(len(seen)).Equal(14)
+
+			list, meta = enrollments("/api/v1/account/enrollments?semester=winter&year=2020&per_page=5&page=2")
+			g.Assert(len(list)).Equal(2)
+			g.Assert(meta.Total).Equal(7)
+
+			list, _ = enrollments("/api/v1/account/enrollments?semester=summer")
+			g.Assert(len(list)).Equal(6)
+
+			list, _ = enrollments("/api/v1/account/enrollments?year=2019")
+			g.Assert(len(list)).Equal(1)
+
+			w := tape.Get("/api/v1/account/enrollments?semester=spring", studentJWT)
+			g.Assert(w.Code).Equal(http.StatusBadRequest)
+
+			// exam enrollments
+			w = tape.Get("/api/v1/account/exams/enrollments?page=4&per_page=4", studentJWT, withEnvelope(true))
+			g.Assert(w.Code).Equal(http.StatusOK)
+			exams := struct {
+				Data []ExamEnrollmentResponse `json:"data"`
+				Meta EnvelopeMeta             `json:"meta"`
+			}{}
+			g.Assert(json.NewDecoder(w.Body).Decode(&exams)).Equal(nil)
+			g.Assert(len(exams.Data)).Equal(2)
+			g.Assert(exams.Meta.Pagination.Total).Equal(14)
+			g.Assert(strings.Contains(w.Header().Get("Link"), `rel="prev"`)).IsTrue()
+
+			w = tape.Get("/api/v1/account/exams/enrollments?semester=winter&year=2020", studentJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+			examList := []ExamEnrollmentResponse{}
+			g.Assert(json.NewDecoder(w.Body).Decode(&examList)).Equal(nil)
+			g.Assert(len(examList)).Equal(7)
+		})
+
 		g.It("Should get all own exam enrollments", func() {
 			userID := studentJWT.Claims.LoginID
 			enrollmentsExpected, err := stores.Exam.GetEnrollmentsOfUser(userID)
@@ -100,6 +201,133 @@ func TestAccount(t *testing.T) {
 			}
 		})
 
+		g.It("Should list upcoming deadlines across all courses sorted by date", func() {
+			if _, err := stores.Course.GetUserEnrollment(2, 112); err != nil {
+				g.Assert(stores.Course.Enroll(2, 112, 0)).Equal(nil)
+			}
+
+			now := NowUTC()
+			later, err := stores.Sheet.Create(&model.Sheet{
+				Name:            "Sheet of course 1",
+				PublishAt:       now.Add(-time.Hour),
+				DueAt:           now.Add(10*24*time.Hour + 2*time.Hour),
+				ScoringPolicy:   "latest",
+				GradesPublished: true,
+			}, 1)
+			g.Assert(err).Equal(nil)
+			earlier, err := stores.Sheet.Create(&model.Sheet{
+				Name:            "Sheet of course 2",
+				PublishAt:       now.Add(-time.Hour),
+				DueAt:           now.Add(10*24*time.Hour + time.Hour),
+				ScoringPolicy:   "latest",
+				GradesPublished: true,
+			}, 2)
+			g.Assert(err).Equal(nil)
+			outside, err := stores.Sheet.Create(&model.Sheet{
+				Name:            "Sheet beyond the range",
+				PublishAt:       now.Add(-time.Hour),
+				DueAt:           now.Add(12 * 24 * time.Hour),
+				ScoringPolicy:   "latest",
+				GradesPublished: true,
+			}, 2)
+			g.Assert(err).Equal(nil)
+
+			url := fmt.Sprintf("/api/v1/account/deadlines?from=%s&to=%s",
+				now.Add(10*24*time.Hour).Format(time.RFC3339),
+				now.Add(11*24*time.Hour).Format(time.RFC3339))
+			w := tape.Get(url, studentJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			deadlines := []DeadlineResponse{}
+			err = json.NewDecoder(w.Body).Decode(&deadlines)
+			g.Assert(err).Equal(nil)
+
+			positions := map[int64]int{}
+			for k, deadline := range deadlines {
+				positions[deadline.SheetID] = k
+				if k > 0 {
+					g.Assert(deadlines[k-1].DueAt.After(deadline.DueAt)).IsFalse()
+				}
+			}
+
+			_, ok := positions[earlier.ID]
+			g.Assert(ok).IsTrue()
+			_, ok = positions[later.ID]
+			g.Assert(ok).IsTrue()
+			g.Assert(positions[earlier.ID] < positions[later.ID]).IsTrue()
+			g.Assert(deadlines[positions[earlier.ID]].CourseID).Equal(int64(2))
+			g.Assert(deadlines[positions[earlier.ID]].SheetName).Equal("Sheet of course 2")
+			g.Assert(deadlines[positions[later.ID]].CourseID).Equal(int64(1))
+			_, ok = positions[outside.ID]
+			g.Assert(ok).IsFalse()
+
+			w = tape.Get("/api/v1/account/deadlines?from=tomorrow", studentJWT)
+			g.Assert(w.Code).Equal(http.StatusBadRequest)
+		})
+
+		g.It("Should provide the deadlines as iCalendar feed authenticated by a token", func() {
+			w := tape.Get("/api/v1/account/deadlines.ics?token=invalid")
+			g.Assert(w.Code).Equal(http.StatusUnauthorized)
+
+			w = tape.Post("/api/v1/account/calendar_token", H{}, studentJWT)
+			g.Assert(w.Code).Equal(http.StatusCreated)
+			feed := &CalendarTokenResponse{}
+			err := json.NewDecoder(w.Body).Decode(feed)
+			g.Assert(err).Equal(nil)
+			g.Assert(strings.HasSuffix(feed.URL, "/api/v1/account/deadlines.ics?token="+feed.Token)).IsTrue()
+
+			deadlinesExpected, err := stores.Sheet.DeadlinesOfUser(112, time.Time{}, null.Time{})
+			g.Assert(err).Equal(nil)
+			g.Assert(len(deadlinesExpected) > 0).IsTrue()
+
+			w = tape.Get("/api/v1/account/deadlines.ics?token=" + feed.Token)
+			g.Assert(w.Code).Equal(http.StatusOK)
+			g.Assert(strings.HasPrefix(w.Header().Get("Content-Type"), "text/calendar")).IsTrue()
+
+			body := w.Body.String()
+			g.Assert(strings.HasPrefix(body, "BEGIN:VCALENDAR\r\nVERSION:2.0\r\n")).IsTrue()
+			g.Assert(strings.HasSuffix(body, "END:VCALENDAR\r\n")).IsTrue()
+
+			lines := strings.Split(strings.TrimSuffix(body, "\r\n"), "\r\n")
+			events := 0
+			inEvent := false
+			for _, line := range lines {
+				g.Assert(strings.Contains(line, "\n")).IsFalse()
+				g.Assert(len(line) <= 75).IsTrue()
+				switch line {
+				case "BEGIN:VEVENT":
+					g.Assert(inEvent).IsFalse()
+					inEvent = true
+					events++
+				case "END:VEVENT":
+					g.Assert(inEvent).IsTrue()
+					inEvent = false
+				}
+				if strings.HasPrefix(line, "UID:") {
+					g.Assert(strings.Contains(line, "-user-112@")).IsTrue()
+				}
+			}
+			g.Assert(inEvent).IsFalse()
+			g.Assert(events).Equal(len(deadlinesExpected))
+
+			// the feed of another user only contains their deadlines
+			w = tape.Post("/api/v1/account/calendar_token", H{}, tape.NewJWTRequest(2, false))
+			g.Assert(w.Code).Equal(http.StatusCreated)
+			otherFeed := &CalendarTokenResponse{}
+			err = json.NewDecoder(w.Body).Decode(otherFeed)
+			g.Assert(err).Equal(nil)
+
+			w = tape.Get("/api/v1/account/deadlines.ics?token=" + otherFeed.Token)
+			g.Assert(w.Code).Equal(http.StatusOK)
+			g.Assert(strings.Contains(w.Body.String(), "-user-112@")).IsFalse()
+
+			// revoked tokens are rejected
+			w = tape.Delete("/api/v1/account/calendar_token", studentJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+			w = tape.Get("/api/v1/account/deadlines.ics?token=" + feed.Token)
+			g.Assert(w.Code).Equal(http.StatusUnauthorized)
+		})
+
 		g.It("Should not create invalid accounts (missing user data)", func() {
 			w := tape.Post("/api/v1/account",
 				H{
@@ -132,6 +360,104 @@ func TestAccount(t *testing.T) {
 			g.Assert(w.Code).Equal(http.StatusBadRequest)
 		})
 
+		g.It("Should validate semester and subject of new accounts", func() {
+			// account creation shares the rate limit of the login
+			option, err := redis.ParseURL(configuration.Configuration.Server.RedisURL())
+			g.Assert(err).Equal(nil)
+			redisClient := redis.NewClient(option)
+			defer redisClient.Close()
+			err = redisClient.Set("infomark-logins:1.2.3.4-infomark-logins", "0", 0).Err()
+			g.Assert(err).Equal(nil)
+
+			subjects := configuration.Configuration.Server.Registration.Subjects
+			defer func() { configuration.Configuration.Server.Registration.Subjects = subjects }()
+			configuration.Configuration.Server.Registration.Subjects = []string{"computer science", "bio informatics"}
+
+			validPassword := auth.GenerateToken(configuration.Configuration.Server.Authentication.Password.MinLength)
+			newRequest := func(semester int, subject string) H {
+				return H{
+					"user": H{
+						"first_name":     "Max",
+						"last_name":      "Mustermensch",
+						"email":          "max@mensch.com",
+						"student_number": "0815",
+						"semester":       semester,
+						"subject":        subject,
+						"language":       "de",
+					},
+					"account": H{
+						"email":          "max@mensch.com",
+						"plain_password": validPassword,
+					},
+				}
+			}
+
+			w := tape.Post("/api/v1/account", newRequest(99, "computer science"))
+			g.Assert(w.Code).Equal(http.StatusBadRequest)
+			g.Assert(strings.Contains(w.Body.String(), "semester")).IsTrue()
+
+			w = tape.Post("/api/v1/account", newRequest(2, "computer sceince"))
+			g.Assert(w.Code).Equal(http.StatusBadRequest)
+			g.Assert(strings.Contains(w.Body.String(), "subject: must be one of")).IsTrue()
+
+			w = tape.Post("/api/v1/account", newRequest(2, "computer science"))
+			g.Assert(w.Code).Equal(http.StatusCreated)
+		})
+
+		g.It("Should reject duplicate student numbers", func() {
+			// account creation shares the rate limit of the login
+			option, err := redis.ParseURL(configuration.Configuration.Server.RedisURL())
+			g.Assert(err).Equal(nil)
+			redisClient := redis.NewClient(option)
+			defer redisClient.Close()
+			err = redisClient.Set("infomark-logins:1.2.3.4-infomark-logins", "0", 0).Err()
+			g.Assert(err).Equal(nil)
+
+			_, err = tape.DB.Exec("UPDATE users SET student_number = '4711' WHERE id = 112")
+			g.Assert(err).Equal(nil)
+
+			validPassword := auth.GenerateToken(configuration.Configuration.Server.Authentication.Password.MinLength)
+			newRequest := func(studentNumber string) H {
+				return H{
+					"user": H{
+						"first_name":     "Max",
+						"last_name":      "Mustermensch",
+						"email":          "max@mensch.com",
+						"student_number": studentNumber,
+						"semester":       2,
+						"subject":        "bio informatics",
+						"language":       "de",
+					},
+					"account": H{
+						"email":          "max@mensch.com",
+						"plain_password": validPassword,
+					},
+				}
+			}
+
+			w := tape.Post("/api/v1/account", newRequest("4711"))
+			g.Assert(w.Code).Equal(http.StatusConflict)
+
+			w = tape.Post("/api/v1/account", newRequest("4712"))
+			g.Assert(w.Code).Equal(http.StatusCreated)
+
+			// the same holds for edits
+			meRequest := H{
+				"first_name":     "Max",
+				"last_name":      "Mustermensch",
+				"student_number": "4711",
+				"semester":       2,
+				"subject":        "bio informatics",
+				"language":       "de",
+			}
+			w = tape.Put("/api/v1/me", meRequest, tape.NewJWTRequest(113, false))
+			g.Assert(w.Code).Equal(http.StatusConflict)
+
+			// keeping the own student number is fine
+			w = tape.Put("/api/v1/me", meRequest, tape.NewJWTRequest(112, false))
+			g.Assert(w.Code).Equal(http.StatusOK)
+		})
+
 		g.It("Should create valid accounts", func() {
 
 			minLen := configuration.Configuration.Server.Authentication.Password.MinLength
@@ -175,6 +501,104 @@ func TestAccount(t *testing.T) {
 			g.Assert(auth.CheckPasswordHash(validPassword, userAfter.EncryptedPassword)).Equal(true)
 		})
 
+		g.It("Should create confirmed accounts when email verification is disabled", func() {
+			defer func(verify bool) {
+				configuration.Configuration.Server.Authentication.Email.Verify = verify
+			}(configuration.Configuration.Server.Authentication.Email.Verify)
+			configuration.Configuration.Server.Authentication.Email.Verify = false
+
+			minLen := configuration.Configuration.Server.Authentication.Password.MinLength
+			validPassword := auth.GenerateToken(minLen)
+
+			request := H{
+				"user": H{
+					"first_name":     "Max",
+					"last_name":      "Mustermensch",
+					"email":          "max@mensch.com",
+					"student_number": "0815",
+					"semester":       2,
+					"subject":        "bio2",
+					"language":       "de",
+				},
+				"account": H{
+					"email":          "max@mensch.com",
+					"plain_password": validPassword,
+				},
+			}
+
+			w := tape.Post("/api/v1/account", request)
+			g.Assert(w.Code).Equal(http.StatusCreated)
+
+			userAfter, err := stores.User.FindByEmail("max@mensch.com")
+			g.Assert(err).Equal(nil)
+			g.Assert(userAfter.ConfirmEmailToken.Valid).Equal(false)
+
+			// the new account can log in immediately
+			w = tape.Post("/api/v1/auth/sessions", H{
+				"email":          "max@mensch.com",
+				"plain_password": validPassword,
+			})
+			g.Assert(w.Code).Equal(http.StatusOK)
+		})
+
+		g.It("Should enroll new users into the configured courses once confirmed", func() {
+			defer func(courses []int64) {
+				configuration.Configuration.Server.Registration.AutoEnrollCourses = courses
+			}(configuration.Configuration.Server.Registration.AutoEnrollCourses)
+			configuration.Configuration.Server.Registration.AutoEnrollCourses = []int64{1}
+
+			// account creation shares the rate limit of the login
+			option, err := redis.ParseURL(configuration.Configuration.Server.RedisURL())
+			g.Assert(err).Equal(nil)
+			redisClient := redis.NewClient(option)
+			defer redisClient.Close()
+			err = redisClient.Set("infomark-logins:1.2.3.4-infomark-logins", "0", 0).Err()
+			g.Assert(err).Equal(nil)
+
+			minLen := configuration.Configuration.Server.Authentication.Password.MinLength
+			validPassword := auth.GenerateToken(minLen)
+
+			w := tape.Post("/api/v1/account", H{
+				"user": H{
+					"first_name":     "Max",
+					"last_name":      "Autoenroll",
+					"email":          "max@autoenroll.com",
+					"student_number": "0815",
+					"semester":       2,
+					"subject":        "bio2",
+					"language":       "de",
+				},
+				"account": H{
+					"email":          "max@autoenroll.com",
+					"plain_password": validPassword,
+				},
+			})
+			g.Assert(w.Code).Equal(http.StatusCreated)
+
+			user, err := stores.User.FindByEmail("max@autoenroll.com")
+			g.Assert(err).Equal(nil)
+			g.Assert(user.ConfirmEmailToken.Valid).Equal(true)
+
+			// not before the email address is confirmed
+			_, err = stores.Course.GetUserEnrollment(1, user.ID)
+			g.Assert(err != nil).IsTrue()
+
+			w = tape.Post("/api/v1/auth/confirm_email", H{
+				"email":              "max@autoenroll.com",
+				"confirmation_token": user.ConfirmEmailToken.String,
+			})
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			w = tape.Get("/api/v1/courses/1/enrollments?q=autoenroll", adminJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+			enrollments := []EnrollmentResponse{}
+			err = json.NewDecoder(w.Body).Decode(&enrollments)
+			g.Assert(err).Equal(nil)
+			g.Assert(len(enrollments)).Equal(1)
+			g.Assert(enrollments[0].User.ID).Equal(user.ID)
+			g.Assert(enrollments[0].Role).Equal(int64(0))
+		})
+
 		g.It("Changes should require valid access-claims", func() {
 
 			data := H{
@@ -228,6 +652,241 @@ func TestAccount(t *testing.T) {
 			g.Assert(userAfter.ConfirmEmailToken.Valid).Equal(true)
 		})
 
+		g.It("Should log the emails sent to the user", func() {
+			w := tape.Get("/api/v1/account/email_log")
+			g.Assert(w.Code).Equal(http.StatusUnauthorized)
+
+			w = tape.Get("/api/v1/account/email_log", adminJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+			entriesBefore := []EmailLogEntryResponse{}
+			err := json.NewDecoder(w.Body).Decode(&entriesBefore)
+			g.Assert(err).Equal(nil)
+
+			// changing the email address sends a confirmation
+			w = tape.Patch("/api/v1/account", H{
+				"account": H{
+					"email": "foo@uni-tuebingen.de",
+				},
+				"old_plain_password": "test",
+			}, adminJWT)
+			g.Assert(w.Code).Equal(http.StatusNoContent)
+
+			w = tape.Get("/api/v1/account/email_log", adminJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+			entries := []EmailLogEntryResponse{}
+			err = json.NewDecoder(w.Body).Decode(&entries)
+			g.Assert(err).Equal(nil)
+			g.Assert(len(entries)).Equal(len(entriesBefore) + 1)
+			g.Assert(entries[0].Kind).Equal("confirm_email")
+			g.Assert(entries[0].Email).Equal("foo@uni-tuebingen.de")
+			g.Assert(entries[0].State).Equal("sent")
+
+			// nobody else sees this entry
+			w = tape.Get("/api/v1/account/email_log", tape.NewJWTRequest(2, false))
+			g.Assert(w.Code).Equal(http.StatusOK)
+			g.Assert(strings.Contains(w.Body.String(), "foo@uni-tuebingen.de")).IsFalse()
+		})
+
+		g.It("Should list the activity of the user newest first", func() {
+			defer func(days int) {
+				configuration.Configuration.Server.LoginHistory.Days = days
+			}(configuration.Configuration.Server.LoginHistory.Days)
+			configuration.Configuration.Server.LoginHistory.Days = 30
+
+			now := NowUTC()
+
+			_, err := tape.DB.Exec("DELETE FROM submissions WHERE user_id = 1;")
+			g.Assert(err).Equal(nil)
+			_, err = tape.DB.Exec("UPDATE user_course SET created_at = $1 WHERE user_id = 1;", now.Add(-5*time.Hour))
+			g.Assert(err).Equal(nil)
+			_, err = tape.DB.Exec("UPDATE user_course SET created_at = $1 WHERE user_id = 1 AND course_id = 1;", now.Add(-3*time.Hour))
+			g.Assert(err).Equal(nil)
+
+			for taskID, uploadedAt := range map[int64]time.Time{1: now.Add(-2 * time.Hour), 2: now.Add(-4 * time.Hour)} {
+				submission, err := stores.Submission.Create(&model.Submission{UserID: 1, TaskID: taskID})
+				g.Assert(err).Equal(nil)
+				_, err = tape.DB.Exec("UPDATE submissions SET updated_at = $2 WHERE id = $1;", submission.ID, uploadedAt)
+				g.Assert(err).Equal(nil)
+			}
+
+			w := tape.Post("/api/v1/auth/sessions", H{
+				"email":          "test@uni-tuebingen.de",
+				"plain_password": "test",
+			})
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			w = tape.Get("/api/v1/account/activity")
+			g.Assert(w.Code).Equal(http.StatusUnauthorized)
+
+			w = tape.Get("/api/v1/account/activity", noAdminJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+			activities := []ActivityResponse{}
+			g.Assert(json.NewDecoder(w.Body).Decode(&activities)).Equal(nil)
+			g.Assert(len(activities) >= 5).IsTrue()
+
+			g.Assert(activities[0].Kind).Equal("login")
+			g.Assert(activities[1].Kind).Equal("submission")
+			g.Assert(activities[1].TaskID.Int64).Equal(int64(1))
+			g.Assert(activities[2].Kind).Equal("enrollment")
+			g.Assert(activities[2].CourseID.Int64).Equal(int64(1))
+			g.Assert(activities[3].Kind).Equal("submission")
+			g.Assert(activities[3].TaskID.Int64).Equal(int64(2))
+			for k := 4; k < len(activities); k++ {
+				g.Assert(activities[k].Kind).Equal("enrollment")
+			}
+
+			// older entries are requested by the time of the last seen entry
+			w = tape.Get(fmt.Sprintf("/api/v1/account/activity?to=%s",
+				url.QueryEscape(activities[1].OccurredAt.Format(time.RFC3339Nano))), noAdminJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+			older := []ActivityResponse{}
+			g.Assert(json.NewDecoder(w.Body).Decode(&older)).Equal(nil)
+			g.Assert(len(older)).Equal(len(activities) - 2)
+			g.Assert(older[0].Kind).Equal("enrollment")
+
+			w = tape.Get("/api/v1/account/activity?to=yesterday", noAdminJWT)
+			g.Assert(w.Code).Equal(http.StatusBadRequest)
+
+			// other users do not see these entries
+			w = tape.Get("/api/v1/account/activity", studentJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+			g.Assert(strings.Contains(w.Body.String(), "\"login\"")).IsFalse()
+		})
+
+		g.It("Should reject reusing recent passwords", func() {
+			history := configuration.Configuration.Server.Authentication.Password.History
+			defer func() {
+				configuration.Configuration.Server.Authentication.Password.History = history
+			}()
+			configuration.Configuration.Server.Authentication.Password.History = 2
+
+			changePassword := func(oldPassword string, newPassword string) int {
+				return tape.Patch("/api/v1/account", H{
+					"account":            H{"plain_password": newPassword},
+					"old_plain_password": oldPassword,
+				}, adminJWT).Code
+			}
+
+			g.Assert(changePassword("test", "new_pass")).Equal(http.StatusNoContent)
+
+			// the immediately previous password
+			g.Assert(changePassword("new_pass", "test")).Equal(http.StatusBadRequest)
+			// the current password
+			g.Assert(changePassword("new_pass", "new_pass")).Equal(http.StatusBadRequest)
+
+			userAfter, err := stores.User.Get(1)
+			g.Assert(err).Equal(nil)
+			g.Assert(auth.CheckPasswordHash("new_pass", userAfter.EncryptedPassword)).IsTrue()
+
+			g.Assert(changePassword("new_pass", "newer_pass")).Equal(http.StatusNoContent)
+			// "test" is not among the latest two passwords anymore
+			g.Assert(changePassword("newer_pass", "test")).Equal(http.StatusNoContent)
+
+			// the history is disabled by 0
+			configuration.Configuration.Server.Authentication.Password.History = 0
+			g.Assert(changePassword("test", "test")).Equal(http.StatusNoContent)
+		})
+
+		g.It("Should revert unconfirmed email changes after the window", func() {
+			window := configuration.Configuration.Server.Authentication.Email.ChangeWindow
+			reminder := configuration.Configuration.Server.Authentication.Email.ChangeReminder
+			defer func() {
+				configuration.Configuration.Server.Authentication.Email.ChangeWindow = window
+				configuration.Configuration.Server.Authentication.Email.ChangeReminder = reminder
+				email.DefaultMail = email.VoidMail
+			}()
+			configuration.Configuration.Server.Authentication.Email.ChangeWindow = 72 * time.Hour
+			configuration.Configuration.Server.Authentication.Email.ChangeReminder = 24 * time.Hour
+
+			userBefore, err := stores.User.Get(1)
+			g.Assert(err).Equal(nil)
+
+			w := tape.Patch("/api/v1/account", H{
+				"account": H{
+					"email": "foo@uni-tuebingen.de",
+				},
+				"old_plain_password": "test",
+			}, adminJWT)
+			g.Assert(w.Code).Equal(http.StatusNoContent)
+
+			userAfter, err := stores.User.Get(1)
+			g.Assert(err).Equal(nil)
+			g.Assert(userAfter.Email).Equal("foo@uni-tuebingen.de")
+			g.Assert(userAfter.PreviousEmail.String).Equal(userBefore.Email)
+
+			mailer := &recordingMailer{}
+			email.DefaultMail = mailer
+
+			// nothing to do yet
+			reverted, reminded, err := ExpireEmailChanges(stores)
+			g.Assert(err).Equal(nil)
+			g.Assert(reverted).Equal(0)
+			g.Assert(reminded).Equal(0)
+
+			// the window ends soon
+			_, err = tape.DB.Exec("UPDATE users SET email_changed_at = email_changed_at - interval '50 hours' WHERE id = 1")
+			g.Assert(err).Equal(nil)
+
+			reverted, reminded, err = ExpireEmailChanges(stores)
+			g.Assert(err).Equal(nil)
+			g.Assert(reverted).Equal(0)
+			g.Assert(reminded).Equal(1)
+			g.Assert(mailer.Count()).Equal(1)
+			g.Assert(mailer.Sent[0].To).Equal("foo@uni-tuebingen.de")
+
+			// users are reminded once
+			reverted, reminded, err = ExpireEmailChanges(stores)
+			g.Assert(err).Equal(nil)
+			g.Assert(reminded).Equal(0)
+
+			// the window is over
+			_, err = tape.DB.Exec("UPDATE users SET email_changed_at = email_changed_at - interval '50 hours' WHERE id = 1")
+			g.Assert(err).Equal(nil)
+
+			reverted, reminded, err = ExpireEmailChanges(stores)
+			g.Assert(err).Equal(nil)
+			g.Assert(reverted).Equal(1)
+
+			userAfter, err = stores.User.Get(1)
+			g.Assert(err).Equal(nil)
+			g.Assert(userAfter.Email).Equal(userBefore.Email)
+			g.Assert(userAfter.ConfirmEmailToken.Valid).Equal(false)
+			g.Assert(userAfter.PreviousEmail.Valid).Equal(false)
+			g.Assert(userAfter.EmailChangedAt.Valid).Equal(false)
+		})
+
+		g.It("Should keep confirmed email changes", func() {
+			w := tape.Patch("/api/v1/account", H{
+				"account": H{
+					"email": "foo@uni-tuebingen.de",
+				},
+				"old_plain_password": "test",
+			}, adminJWT)
+			g.Assert(w.Code).Equal(http.StatusNoContent)
+
+			user, err := stores.User.Get(1)
+			g.Assert(err).Equal(nil)
+
+			// confirming shares the rate limit of the login
+			option, err := redis.ParseURL(configuration.Configuration.Server.RedisURL())
+			g.Assert(err).Equal(nil)
+			redisClient := redis.NewClient(option)
+			defer redisClient.Close()
+			err = redisClient.Set("infomark-logins:1.2.3.4-infomark-logins", "0", 0).Err()
+			g.Assert(err).Equal(nil)
+
+			w = tape.Post("/api/v1/auth/confirm_email", H{
+				"email":              "foo@uni-tuebingen.de",
+				"confirmation_token": user.ConfirmEmailToken.String,
+			})
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			user, err = stores.User.Get(1)
+			g.Assert(err).Equal(nil)
+			g.Assert(user.PreviousEmail.Valid).Equal(false)
+			g.Assert(user.EmailChangedAt.Valid).Equal(false)
+		})
+
 		g.It("Should only change email when correct old password ", func() {
 
 			data := H{
@@ -366,6 +1025,35 @@ func TestAccount(t *testing.T) {
 
 		})
 
+		g.It("should serve scaled down avatars of allowed sizes only", func() {
+			defer helper.NewAvatarFileHandle(1).Delete()
+
+			avatarFilename := fmt.Sprintf("%s/default-avatar.jpg", configuration.Configuration.Server.Debugging.Fixtures)
+			w, err := tape.Upload("/api/v1/account/avatar", avatarFilename, "image/jpg", adminJWT)
+			g.Assert(err).Equal(nil)
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			w = tape.Get("/api/v1/account/avatar?size=64", adminJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+			g.Assert(w.Header().Get("Content-Type")).Equal("image/png")
+
+			avatar, err := png.Decode(w.Body)
+			g.Assert(err).Equal(nil)
+			g.Assert(avatar.Bounds().Dx() <= 64).IsTrue()
+			g.Assert(avatar.Bounds().Dy() <= 64).IsTrue()
+			g.Assert(avatar.Bounds().Dx() == 64 || avatar.Bounds().Dy() == 64).IsTrue()
+
+			// the copy is cached and served with its own ETag
+			etag := w.Header().Get("ETag")
+			w = tape.Get("/api/v1/users/1/avatar?size=64", adminJWT, ifNoneMatch(etag))
+			g.Assert(w.Code).Equal(http.StatusNotModified)
+
+			for _, size := range []string{"65", "10000", "abc", "-64"} {
+				w = tape.Get("/api/v1/account/avatar?size="+size, adminJWT)
+				g.Assert(w.Code).Equal(http.StatusBadRequest)
+			}
+		})
+
 		g.It("reject to large avatars (jpg)", func() {
 			defer helper.NewAvatarFileHandle(1).Delete()
 
@@ -401,6 +1089,37 @@ func TestAccount(t *testing.T) {
 			g.Assert(w.Code).Equal(http.StatusBadRequest)
 			g.Assert(helper.NewAvatarFileHandle(1).Exists()).Equal(false)
 
+			errResp := ErrResponse{}
+			err = json.NewDecoder(w.Body).Decode(&errResp)
+			g.Assert(err).Equal(nil)
+			g.Assert(strings.Contains(errResp.ErrorText, "maximum")).IsTrue()
+
+			user, err := stores.User.Get(1)
+			g.Assert(err).Equal(nil)
+			g.Assert(user.AvatarURL.Valid).Equal(false)
+		})
+
+		g.It("reject to small avatars (png)", func() {
+			defer helper.NewAvatarFileHandle(1).Delete()
+
+			// a png header without any content (like a tracking pixel)
+			err := ioutil.WriteFile("/tmp/pixel.png", []byte{0x89, 0x50, 0x4E, 0x47, 0x0D, 0x0A, 0x1A, 0x0A}, 0644)
+			g.Assert(err).Equal(nil)
+			defer os.Remove("/tmp/pixel.png")
+
+			w, err := tape.Upload("/api/v1/account/avatar", "/tmp/pixel.png", "image/png", adminJWT)
+			g.Assert(err).Equal(nil)
+			g.Assert(w.Code).Equal(http.StatusBadRequest)
+			g.Assert(helper.NewAvatarFileHandle(1).Exists()).Equal(false)
+
+			errResp := ErrResponse{}
+			err = json.NewDecoder(w.Body).Decode(&errResp)
+			g.Assert(err).Equal(nil)
+			g.Assert(strings.Contains(errResp.ErrorText, "minimum")).IsTrue()
+
+			user, err := stores.User.Get(1)
+			g.Assert(err).Equal(nil)
+			g.Assert(user.AvatarURL.Valid).Equal(false)
 		})
 
 		g.It("Should have a way to delete own avatar", func() {
@@ -433,9 +1152,119 @@ func TestAccount(t *testing.T) {
 
 		})
 
+		g.It("Should create, list and delete api keys", func() {
+			w := tape.Post("/api/v1/account/api_keys", H{"name": "download-script"}, noAdminJWT)
+			g.Assert(w.Code).Equal(http.StatusCreated)
+
+			created := &APIKeyResponse{}
+			err := json.NewDecoder(w.Body).Decode(created)
+			g.Assert(err).Equal(nil)
+			g.Assert(created.Scope).Equal("read")
+			g.Assert(len(created.Key)).Equal(64)
+
+			// only the hash is stored
+			stored, err := stores.APIKey.Get(created.ID)
+			g.Assert(err).Equal(nil)
+			g.Assert(stored.KeyHash).Equal(auth.HashToken(created.Key))
+
+			w = tape.Get("/api/v1/account/api_keys", noAdminJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+			list := []APIKeyResponse{}
+			err = json.NewDecoder(w.Body).Decode(&list)
+			g.Assert(err).Equal(nil)
+			g.Assert(len(list)).Equal(1)
+			g.Assert(list[0].Name).Equal("download-script")
+			g.Assert(list[0].Key).Equal("")
+
+			// others cannot delete the key
+			w = tape.Delete(fmt.Sprintf("/api/v1/account/api_keys/%d", created.ID), studentJWT)
+			g.Assert(w.Code).Equal(http.StatusNotFound)
+
+			w = tape.Delete(fmt.Sprintf("/api/v1/account/api_keys/%d", created.ID), noAdminJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			w = tape.Get("/api/v1/account", apiKeyRequest{created.Key})
+			g.Assert(w.Code).Equal(http.StatusUnauthorized)
+		})
+
+		g.It("Should reject a revoked api key on the next request", func() {
+			w := tape.Post("/api/v1/account/api_keys", H{"name": "leaked"}, noAdminJWT)
+			g.Assert(w.Code).Equal(http.StatusCreated)
+			created := &APIKeyResponse{}
+			g.Assert(json.NewDecoder(w.Body).Decode(created)).Equal(nil)
+			g.Assert(created.RevokedAt.Valid).Equal(false)
+
+			w = tape.Get("/api/v1/account", apiKeyRequest{created.Key})
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			w = tape.Delete(fmt.Sprintf("/api/v1/account/api_keys/%d", created.ID), noAdminJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			w = tape.Get("/api/v1/account", apiKeyRequest{created.Key})
+			g.Assert(w.Code).Equal(http.StatusUnauthorized)
+
+			// the revocation is recorded
+			stored, err := stores.APIKey.Get(created.ID)
+			g.Assert(err).Equal(nil)
+			g.Assert(stored.RevokedAt.Valid).Equal(true)
+
+			w = tape.Get("/api/v1/account/api_keys", noAdminJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+			list := []APIKeyResponse{}
+			g.Assert(json.NewDecoder(w.Body).Decode(&list)).Equal(nil)
+			g.Assert(len(list)).Equal(1)
+			g.Assert(list[0].RevokedAt.Valid).Equal(true)
+
+			// revoking twice does not change the record
+			w = tape.Delete(fmt.Sprintf("/api/v1/account/api_keys/%d", created.ID), noAdminJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+			again, err := stores.APIKey.Get(created.ID)
+			g.Assert(err).Equal(nil)
+			g.Assert(again.RevokedAt.Time.Equal(stored.RevokedAt.Time)).IsTrue()
+		})
+
+		g.It("Should authenticate by api keys and respect the scope", func() {
+			w := tape.Post("/api/v1/account/api_keys", H{"name": "read", "scope": "read"}, noAdminJWT)
+			g.Assert(w.Code).Equal(http.StatusCreated)
+			readKey := &APIKeyResponse{}
+			g.Assert(json.NewDecoder(w.Body).Decode(readKey)).Equal(nil)
+
+			w = tape.Post("/api/v1/account/api_keys", H{"name": "write", "scope": "write"}, noAdminJWT)
+			g.Assert(w.Code).Equal(http.StatusCreated)
+			writeKey := &APIKeyResponse{}
+			g.Assert(json.NewDecoder(w.Body).Decode(writeKey)).Equal(nil)
+
+			w = tape.Post("/api/v1/account/api_keys", H{"name": "invalid", "scope": "admin"}, noAdminJWT)
+			g.Assert(w.Code).Equal(http.StatusBadRequest)
+
+			w = tape.Get("/api/v1/account", apiKeyRequest{readKey.Key})
+			g.Assert(w.Code).Equal(http.StatusOK)
+			user := &UserResponse{}
+			g.Assert(json.NewDecoder(w.Body).Decode(user)).Equal(nil)
+			g.Assert(user.ID).Equal(int64(1))
+
+			// a read-only key cannot POST
+			w = tape.Post("/api/v1/account/api_keys", H{"name": "other"}, apiKeyRequest{readKey.Key})
+			g.Assert(w.Code).Equal(http.StatusForbidden)
+
+			w = tape.Post("/api/v1/account/api_keys", H{"name": "other"}, apiKeyRequest{writeKey.Key})
+			g.Assert(w.Code).Equal(http.StatusCreated)
+
+			w = tape.Get("/api/v1/account", apiKeyRequest{"invalid"})
+			g.Assert(w.Code).Equal(http.StatusUnauthorized)
+		})
+
 		g.AfterEach(func() {
 			tape.AfterEach()
 		})
 	})
 
 }
+
+type apiKeyRequest struct {
+	Key string
+}
+
+func (t apiKeyRequest) Modify(r *http.Request) {
+	r.Header.Add("Authorization", "ApiKey "+t.Key)
+}
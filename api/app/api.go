@@ -20,13 +20,18 @@
 package app
 
 import (
+	"time"
+
 	"github.com/alexedwards/scs"
+	"github.com/infomark-org/infomark/api/helper"
 	"github.com/infomark-org/infomark/auth/authenticate"
 	"github.com/infomark-org/infomark/auth/authorize"
 	"github.com/infomark-org/infomark/database"
+	"github.com/infomark-org/infomark/event"
 	"github.com/infomark-org/infomark/model"
 	"github.com/infomark-org/infomark/symbol"
 	"github.com/jmoiron/sqlx"
+	null "gopkg.in/guregu/null.v3"
 )
 
 // UserStore defines user related database queries
@@ -34,11 +39,26 @@ type UserStore interface {
 	Get(userID int64) (*model.User, error)
 	Update(p *model.User) error
 	GetAll() ([]model.User, error)
+	Fingerprint() (string, error)
 	Create(p *model.User) (*model.User, error)
 	Delete(userID int64) error
 	FindByEmail(email string) (*model.User, error)
+	FindByStudentNumber(studentNumber string) (*model.User, error)
+	FindByCalendarTokenHash(tokenHash string) (*model.User, error)
+	StudentNumberTaken(studentNumber string, exceptUserID int64) (bool, error)
+	GetPendingEmailChanges() ([]model.User, error)
 	Find(query string) ([]model.User, error)
 	GetEnrollments(userID int64) ([]model.Enrollment, error)
+	GetEnrollmentsPage(userID int64, semester string, year int, limit int, offset int) ([]model.Enrollment, error)
+	CountEnrollments(userID int64, semester string, year int) (int, error)
+	Merge(primaryID int64, duplicateID int64) error
+	SubmissionsSupersededByMerge(primaryID int64, duplicateID int64) ([]int64, error)
+	SoftDelete(userIDs []int64) error
+	PreviousPasswords(userID int64, limit int) ([]string, error)
+	UpdateWithPreviousPassword(p *model.User, previousPassword string, keep int) error
+
+	AddLogin(userID int64, keepDays int) error
+	Activity(userID int64, from null.Time, to time.Time, limit int) ([]model.Activity, error)
 }
 
 // ExamStore defines exam related database queries
@@ -52,6 +72,8 @@ type ExamStore interface {
 	Enroll(examID int64, userID int64) error
 	Disenroll(examID int64, userID int64) error
 	GetEnrollmentsOfUser(userID int64) ([]model.UserExam, error)
+	GetEnrollmentsOfUserPage(userID int64, semester string, year int, limit int, offset int) ([]model.UserExam, error)
+	CountEnrollmentsOfUser(userID int64, semester string, year int) (int, error)
 	GetEnrollmentsInCourseOfExam(courseID int64, examID int64) ([]model.UserExam, error)
 	GetEnrollmentOfUser(examID int64, userID int64) (*model.UserExam, error)
 	UpdateUserExam(p *model.UserExam) error
@@ -62,9 +84,12 @@ type CourseStore interface {
 	Get(courseID int64) (*model.Course, error)
 	Update(p *model.Course) error
 	GetAll() ([]model.Course, error)
+	CoursesOfUserWithRole(userID int64, role int) ([]model.Course, error)
+	AvailableForUser(userID int64, now time.Time) ([]model.Course, error)
 	Create(p *model.Course) (*model.Course, error)
 	Delete(courseID int64) error
 	Enroll(courseID int64, userID int64, role int64) error
+	EnrollStudent(courseID int64, userID int64, maxStudents int) (bool, error)
 	Disenroll(courseID int64, userID int64) error
 	EnrolledUsers(
 		courseID int64,
@@ -80,9 +105,12 @@ type CourseStore interface {
 		filterQuery string,
 	) ([]model.UserCourse, error)
 	GetUserEnrollment(courseID int64, userID int64) (*model.UserCourse, error)
+	AcknowledgeHonorCode(courseID int64, userID int64) error
 	PointsForUser(userID int64, courseID int64) ([]model.SheetPoints, error)
 	RoleInCourse(userID int64, courseID int64) (authorize.CourseRole, error)
 	UpdateRole(courseID, userID int64, role int) error
+	GetDashboard(courseID int64) (*model.CourseDashboard, error)
+	GetSubmissionVolume(courseID int64) ([]model.SubmissionVolume, error)
 }
 
 // SheetStore specifies required database queries for Sheet management.
@@ -95,6 +123,12 @@ type SheetStore interface {
 	SheetsOfCourse(courseID int64) ([]model.Sheet, error)
 	IdentifyCourseOfSheet(sheetID int64) (*model.Course, error)
 	PointsForUser(userID int64, sheetID int64) ([]model.TaskPoints, error)
+	DeadlinesOfUser(userID int64, from time.Time, to null.Time) ([]model.Deadline, error)
+
+	GetExtension(sheetID int64, userID int64) (*model.SheetExtension, error)
+	ExtensionsOfSheet(sheetID int64) ([]model.SheetExtension, error)
+	SetExtension(sheetID int64, userID int64, dueAt time.Time) error
+	DeleteExtension(sheetID int64, userID int64) error
 }
 
 // TaskStore specifies required database queries for Task management.
@@ -105,10 +139,14 @@ type TaskStore interface {
 	Create(p *model.Task, sheetID int64) (*model.Task, error)
 	Delete(TaskID int64) error
 	TasksOfSheet(sheetID int64) ([]model.Task, error)
+	TaskStatusesOfSheet(sheetID int64, userID int64) ([]model.TaskStatus, error)
+	TaskSummariesOfSheet(sheetID int64) ([]model.TaskSummary, error)
 	IdentifyCourseOfTask(taskID int64) (*model.Course, error)
 	IdentifySheetOfTask(taskID int64) (*model.Sheet, error)
 
 	GetAverageRating(taskID int64) (float32, error)
+	GetStatistics(taskID int64) (*model.TaskStatistics, error)
+	GetPointsHistogram(taskID int64) ([]model.TaskPointsBin, error)
 	GetRatingOfTaskByUser(taskID int64, userID int64) (*model.TaskRating, error)
 	GetRating(taskRatingID int64) (*model.TaskRating, error)
 	CreateRating(p *model.TaskRating) (*model.TaskRating, error)
@@ -144,6 +182,7 @@ type GroupStore interface {
 	EnrolledUsers(courseID int64, groupID int64, roleFilter []string,
 		filterFirstName string, filterLastName string, filterEmail string, filterSubject string,
 		filterLanguage string) ([]model.UserCourse, error)
+	EnrolledUsersOfGroups(courseID int64, groupIDs []int64, roleFilter []string) ([]model.UserCourse, error)
 }
 
 // MaterialStore defines material related database queries
@@ -161,8 +200,15 @@ type MaterialStore interface {
 type SubmissionStore interface {
 	Get(submissionID int64) (*model.Submission, error)
 	GetByUserAndTask(userID int64, taskID int64) (*model.Submission, error)
+	GetAllOfTask(courseID int64, taskID int64) ([]model.UserSubmission, error)
+	GetOfTaskWithStatus(taskID int64, groupID int64, status string) ([]model.SubmissionWithStatus, error)
 	Create(p *model.Submission) (*model.Submission, error)
+	UpdateFilename(submissionID int64, filename string) error
+	GetIDsOfTask(taskID int64) ([]int64, error)
+	DeleteAllOfTask(taskID int64) ([]int64, error)
 	GetFiltered(filterCourseID, filterGroupID, filterUserID, filterSheetID, filterTaskID int64) ([]model.Submission, error)
+	GetExpired(courseID int64, defaultDays int, keepGraded bool) ([]model.Submission, error)
+	IdentifyCourseOfSubmission(submissionID int64) (*model.Course, error)
 }
 
 // GradeStore defines grades related database queries
@@ -183,15 +229,73 @@ type GradeStore interface {
 	) ([]model.Grade, error)
 	Get(id int64) (*model.Grade, error)
 	GetForSubmission(id int64) (*model.Grade, error)
+	GradedOfSheet(sheetID int64) ([]model.Grade, error)
+	GetQueuePosition(gradeID int64, enqueuedSince time.Time) (int, error)
+	CountTestedSince(since time.Time) (int, error)
 	Update(p *model.Grade) error
 	IdentifyCourseOfGrade(gradeID int64) (*model.Course, error)
 	GetAllMissingGrades(courseID int64, tutorID int64, groupID int64) ([]model.MissingGrade, error)
 	Create(p *model.Grade) (*model.Grade, error)
 
-	UpdatePrivateTestInfo(gradeID int64, log string, status symbol.TestingResult) error
-	UpdatePublicTestInfo(gradeID int64, log string, status symbol.TestingResult) error
+	UpdatePrivateTestInfo(gradeID int64, log string, status symbol.TestingResult, testedAt time.Time) error
+	UpdateAutograderPoints(gradeID int64, points int) error
+	DiscardAutograderPoints(gradeID int64) error
+	ReplaceTestCases(gradeID int64, kind string, testCases []model.GradeTestCase) error
+	CountTestedOfTaskSince(taskID int64, since time.Time) (int, error)
+	TestCasesOfGrade(gradeID int64, kind string) ([]model.GradeTestCase, error)
+	UpdatePublicTestInfo(gradeID int64, log string, diff string, status symbol.TestingResult, testedAt time.Time) error
 	IdentifyTaskOfGrade(gradeID int64) (*model.Task, error)
-	GetOverviewGrades(courseID int64, groupID int64) ([]model.OverviewGrade, error)
+	GetOverviewGrades(courseID int64, groupIDs []int64) ([]model.OverviewGrade, error)
+	GetGradeBook(courseID int64) ([]model.GradeBookEntry, error)
+}
+
+// APIKeyStore defines api key related database queries
+type APIKeyStore interface {
+	Get(apiKeyID int64) (*model.APIKey, error)
+	FindByHash(keyHash string) (*model.APIKey, error)
+	APIKeysOfUser(userID int64) ([]model.APIKey, error)
+	Create(p *model.APIKey) (*model.APIKey, error)
+	Revoke(apiKeyID int64) error
+	Delete(apiKeyID int64) error
+}
+
+// WebhookStore defines webhook related database queries
+type WebhookStore interface {
+	Get(webhookID int64) (*model.Webhook, error)
+	WebhooksOfCourse(courseID int64) ([]model.Webhook, error)
+	Create(p *model.Webhook) (*model.Webhook, error)
+	Delete(webhookID int64) error
+}
+
+// CourseNoteStore defines queries for pinned notes of courses
+type CourseNoteStore interface {
+	Get(noteID int64) (*model.CourseNote, error)
+	NotesOfCourse(courseID int64) ([]model.CourseNote, error)
+	Create(p *model.CourseNote) (*model.CourseNote, error)
+	Update(p *model.CourseNote) error
+	Delete(noteID int64) error
+}
+
+// EmailBroadcastStore defines queries to track emails sent to courses
+type EmailBroadcastStore interface {
+	Get(broadcastID int64) (*model.EmailBroadcast, error)
+	Create(p *model.EmailBroadcast) (*model.EmailBroadcast, error)
+	CreateDelivery(p *model.EmailDelivery) (*model.EmailDelivery, error)
+	UpdateDeliveryState(deliveryID int64, state symbol.EmailDeliveryState, message string) error
+	GetStatus(broadcastID int64) (*model.EmailBroadcastStatus, error)
+	FailedDeliveries(broadcastID int64) ([]model.EmailDelivery, error)
+	CreateLogEntry(p *model.EmailLogEntry) (*model.EmailLogEntry, error)
+	UpdateLogEntryState(entryID int64, state symbol.EmailDeliveryState) error
+	GetLogOfUser(userID int64, limit int) ([]model.EmailLogEntry, error)
+}
+
+// NotificationStore defines queries for notifications waiting for a digest
+type NotificationStore interface {
+	Get(notificationID int64) (*model.PendingNotification, error)
+	Create(p *model.PendingNotification) (*model.PendingNotification, error)
+	UsersWithPending() ([]int64, error)
+	PendingOfUser(userID int64) ([]model.PendingNotification, error)
+	Delete(notificationID int64) error
 }
 
 // API provides application resources and handlers.
@@ -209,55 +313,75 @@ type API struct {
 	Grade      *GradeResource
 	Common     *CommonResource
 	Exam       *ExamResource
+	Webhook    *WebhookResource
+	CourseNote *CourseNoteResource
+	Events     *event.Bus
 }
 
 // Stores is the collection of stores. We use this struct to express a kind of
 // hierarchy of database queries, e.g. stores.User.Get(1)
 type Stores struct {
-	Course     CourseStore
-	User       UserStore
-	Sheet      SheetStore
-	Task       TaskStore
-	Group      GroupStore
-	Submission SubmissionStore
-	Material   MaterialStore
-	Grade      GradeStore
-	Exam       ExamStore
+	Course       CourseStore
+	User         UserStore
+	Sheet        SheetStore
+	Task         TaskStore
+	Group        GroupStore
+	Submission   SubmissionStore
+	Material     MaterialStore
+	Grade        GradeStore
+	Exam         ExamStore
+	APIKey       APIKeyStore
+	Webhook      WebhookStore
+	Email        EmailBroadcastStore
+	Notification NotificationStore
+	CourseNote   CourseNoteStore
 }
 
 // NewStores build all stores and connect them to a database.
 func NewStores(db *sqlx.DB) *Stores {
 	return &Stores{
-		Course:     database.NewCourseStore(db),
-		User:       database.NewUserStore(db),
-		Sheet:      database.NewSheetStore(db),
-		Task:       database.NewTaskStore(db),
-		Group:      database.NewGroupStore(db),
-		Submission: database.NewSubmissionStore(db),
-		Material:   database.NewMaterialStore(db),
-		Grade:      database.NewGradeStore(db),
-		Exam:       database.NewExamStore(db),
+		Course:       database.NewCourseStore(db),
+		User:         database.NewUserStore(db),
+		Sheet:        database.NewSheetStore(db),
+		Task:         database.NewTaskStore(db),
+		Group:        database.NewGroupStore(db),
+		Submission:   database.NewSubmissionStore(db),
+		Material:     database.NewMaterialStore(db),
+		Grade:        database.NewGradeStore(db),
+		Exam:         database.NewExamStore(db),
+		APIKey:       database.NewAPIKeyStore(db),
+		Webhook:      database.NewWebhookStore(db),
+		Email:        database.NewEmailBroadcastStore(db),
+		Notification: database.NewNotificationStore(db),
+		CourseNote:   database.NewCourseNoteStore(db),
 	}
 }
 
 // NewAPI configures and returns application API.
 func NewAPI(db *sqlx.DB, tokenAuth *authenticate.TokenAuth, sessionAuth *scs.Manager) (*API, error) {
 	stores := NewStores(db)
+	helper.CourseOfFile = CourseOfFile(stores)
+
+	events := event.NewBus()
+	RegisterSubscribers(events, stores)
 
 	api := &API{
-		Account:    NewAccountResource(stores),
-		Auth:       NewAuthResource(stores, tokenAuth, sessionAuth),
-		User:       NewUserResource(stores),
-		Course:     NewCourseResource(stores),
-		Sheet:      NewSheetResource(stores),
+		Account:    NewAccountResource(stores, events),
+		Auth:       NewAuthResource(stores, tokenAuth, sessionAuth, events),
+		User:       NewUserResource(stores, tokenAuth, events),
+		Course:     NewCourseResource(stores, events),
+		Sheet:      NewSheetResource(stores, events),
 		Task:       NewTaskResource(stores),
 		Group:      NewGroupResource(stores),
 		TaskRating: NewTaskRatingResource(stores),
-		Submission: NewSubmissionResource(stores, tokenAuth),
+		Submission: NewSubmissionResource(stores, tokenAuth, events),
 		Material:   NewMaterialResource(stores),
-		Grade:      NewGradeResource(stores),
+		Grade:      NewGradeResource(stores, events),
 		Common:     NewCommonResource(stores),
 		Exam:       NewExamResource(stores),
+		Webhook:    NewWebhookResource(stores),
+		CourseNote: NewCourseNoteResource(stores),
+		Events:     events,
 	}
 	return api, nil
 }
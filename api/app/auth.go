@@ -23,6 +23,8 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/alexedwards/scs"
 	"github.com/go-chi/jwtauth"
@@ -31,7 +33,10 @@ import (
 	"github.com/infomark-org/infomark/auth/authenticate"
 	"github.com/infomark-org/infomark/configuration"
 	"github.com/infomark-org/infomark/email"
+	"github.com/infomark-org/infomark/event"
+	"github.com/infomark-org/infomark/model"
 	"github.com/infomark-org/infomark/symbol"
+	"github.com/sirupsen/logrus"
 	null "gopkg.in/guregu/null.v3"
 )
 
@@ -40,14 +45,20 @@ type AuthResource struct {
 	Stores      *Stores
 	TokenAuth   *authenticate.TokenAuth
 	SessionAuth *scs.Manager
+	Events      *event.Bus
+	// LoginFailures decides when a captcha is required, it is set by the router.
+	LoginFailures *authenticate.LoginFailureCounter
+	// IdleSessions ends inactive sessions, it is set by the router.
+	IdleSessions *authenticate.IdleSessionTracker
 }
 
 // NewAuthResource create and returns a AuthResource.
-func NewAuthResource(stores *Stores, tokenAuth *authenticate.TokenAuth, sessionAuth *scs.Manager) *AuthResource {
+func NewAuthResource(stores *Stores, tokenAuth *authenticate.TokenAuth, sessionAuth *scs.Manager, events *event.Bus) *AuthResource {
 	return &AuthResource{
 		Stores:      stores,
 		TokenAuth:   tokenAuth,
 		SessionAuth: sessionAuth,
+		Events:      events,
 	}
 }
 
@@ -63,7 +74,9 @@ func NewAuthResource(stores *Stores, tokenAuth *authenticate.TokenAuth, sessionA
 // SUMMARY:  Refresh or Generate Access token
 // DESCRIPTION:
 // This endpoint will generate the access token without login credentials
-// if the refresh token is given.
+// if the refresh token is given. If an inactivity timeout is configured, the
+// tokens of a login are rejected once no request used them within this window.
+// Logins with credentials share the captcha of "/auth/sessions".
 func (rs *AuthResource) RefreshAccessTokenHandler(w http.ResponseWriter, r *http.Request) {
 	// Login with your username and password to get the generated JWT refresh and
 	// access tokens. Alternatively, if the refresh token is already present in
@@ -103,8 +116,22 @@ func (rs *AuthResource) RefreshAccessTokenHandler(w http.ResponseWriter, r *http
 			return
 		}
 
+		// the user might have logged out from all devices
+		if targetUser.SessionRevoked(refreshClaims.IssuedAt) {
+			render.Render(w, r, ErrUnauthorized)
+			return
+		}
+
+		// refreshing does not revive sessions which are idle for too long
+		if refreshClaims.SessionID != "" && rs.SessionIdle(refreshClaims.SessionID) {
+			render.Render(w, r, ErrUnauthorized)
+			return
+		}
+
 		// we just need to return an access-token
-		accessToken, err := tokenManager.CreateAccessJWT(authenticate.NewAccessClaims(targetUser.ID, targetUser.Root))
+		accessClaims := authenticate.NewAccessClaims(targetUser.ID, targetUser.Root)
+		accessClaims.SessionID = refreshClaims.SessionID
+		accessToken, err := tokenManager.CreateAccessJWT(accessClaims)
 		if err != nil {
 			render.Render(w, r, ErrInternalServerErrorWithDetails(err))
 			return
@@ -130,20 +157,49 @@ func (rs *AuthResource) RefreshAccessTokenHandler(w http.ResponseWriter, r *http
 			return
 		}
 
+		// guessing passwords here is as limited as for sessions
+		if !rs.passCaptchaGate(w, r, data.CaptchaToken) {
+			return
+		}
+
 		// does such a user exists with request email address?
-		potentialUser, err := rs.Stores.User.FindByEmail(data.Email)
+		potentialUser, err := rs.findLoginUser(data)
 		if err != nil {
+			rs.countLoginFailure(r)
 			render.Render(w, r, ErrNotFound)
 			return
 		}
 
 		// does the password match?
 		if !auth.CheckPasswordHash(data.PlainPassword, potentialUser.EncryptedPassword) {
+			rs.loginFailed(r)
 			render.Render(w, r, ErrNotFound)
 			return
 		}
+		rs.upgradePasswordHash(potentialUser, data.PlainPassword)
+
+		// is a second factor required?
+		if potentialUser.TOTPEnabled {
+			if err := checkSecondFactor(rs.Stores, potentialUser, data.TOTPCode); err != nil {
+				rs.loginFailed(r)
+				render.Render(w, r, ErrBadRequestWithDetails(err))
+				return
+			}
+		}
+
+		if !rs.resetLoginFailures(w, r) {
+			return
+		}
+
+		sessionID, err := rs.startSession()
+		if err != nil {
+			render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+			return
+		}
+		rs.Events.Publish(event.LoginSucceeded{UserID: potentialUser.ID})
 
 		refreshClaims := authenticate.NewRefreshClaims(potentialUser.ID)
+		refreshClaims.SessionID = sessionID
 		refreshToken, err := tokenManager.CreateRefreshJWT(refreshClaims)
 
 		if err != nil {
@@ -152,6 +208,7 @@ func (rs *AuthResource) RefreshAccessTokenHandler(w http.ResponseWriter, r *http
 		}
 
 		accessClaims := authenticate.NewAccessClaims(potentialUser.ID, potentialUser.Root)
+		accessClaims.SessionID = sessionID
 		accessToken, err := tokenManager.CreateAccessJWT(accessClaims)
 
 		if err != nil {
@@ -183,7 +240,17 @@ func (rs *AuthResource) RefreshAccessTokenHandler(w http.ResponseWriter, r *http
 // SUMMARY:  Start a session
 // DESCRIPTION:
 // This endpoint will generate the access token without login credentials
-// if the refresh token is given.
+// if the refresh token is given. If enabled in the configuration, the field
+// "email" can also contain the (numeric) student number. Accounts with enabled
+// two-factor authentication require the "totp_code" (or a recovery code).
+// Correct credentials of an account with an unconfirmed email address are
+// answered with the error code 1001.
+// If LDAP is enabled, the credentials are checked against the directory first
+// and "email" can contain any login name of the directory. Unknown users are
+// created on their first login, existing accounts with the same email address
+// are only linked if enabled in the configuration.
+// If captchas are enabled, too many failed logins from an address are answered
+// with the error code 1002 until the request contains a valid "captcha_token".
 func (rs *AuthResource) LoginHandler(w http.ResponseWriter, r *http.Request) {
 	// we are given email-password credentials
 
@@ -195,38 +262,86 @@ func (rs *AuthResource) LoginHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// does such a user exists with request email address?
-	potentialUser, err := rs.Stores.User.FindByEmail(data.Email)
-	if err != nil {
-		render.Render(w, r, ErrBadRequest)
+	if !rs.passCaptchaGate(w, r, data.CaptchaToken) {
 		return
 	}
 
-	// does the password match?
-	if !auth.CheckPasswordHash(data.PlainPassword, potentialUser.EncryptedPassword) {
-		totalFailedLoginsVec.WithLabelValues().Inc()
-		render.Render(w, r, ErrBadRequestWithDetails(errors.New("credentials are wrong")))
-		return
+	var potentialUser *model.User
+	var err error
+
+	// departments running LDAP authenticate against their directory first
+	ldapConfig := configuration.Configuration.Server.Authentication.LDAP
+	if ldapConfig.Enabled {
+		potentialUser, err = rs.findOrCreateLDAPUser(data, r)
+		if err == errAccountNotLinked {
+			rs.loginFailed(r)
+			render.Render(w, r, ErrBadRequestWithDetails(err))
+			return
+		}
+		if err != nil && !ldapConfig.FallbackToLocal {
+			rs.loginFailed(r)
+			render.Render(w, r, ErrBadRequestWithDetails(errors.New("credentials are wrong")))
+			return
+		}
+	}
+
+	if potentialUser == nil {
+		// does such a user exists with request email address or student number?
+		potentialUser, err = rs.findLoginUser(data)
+		if err != nil {
+			rs.countLoginFailure(r)
+			render.Render(w, r, ErrBadRequest)
+			return
+		}
+
+		// does the password match?
+		if !auth.CheckPasswordHash(data.PlainPassword, potentialUser.EncryptedPassword) {
+			rs.loginFailed(r)
+			render.Render(w, r, ErrBadRequestWithDetails(errors.New("credentials are wrong")))
+			return
+		}
+		rs.upgradePasswordHash(potentialUser, data.PlainPassword)
+
+		// Some edge-cases exists, where we do not need to verify the email.
+		// In the public demo, user can register as students and get directly a
+		// confirmed account.
+		if configuration.Configuration.Server.Authentication.Email.Verify {
+			// fmt.Println(potentialUser.ConfirmEmailToken)
+			// is the email address confirmed?
+			if potentialUser.ConfirmEmailToken.Valid {
+				// Valid is true if String is not NULL
+				// confirm token `potentialUser.ConfirmEmailToken.String` exists
+				render.Render(w, r, ErrEmailNotConfirmed)
+				return
+			}
+		}
 	}
 
-	// Some edge-cases exists, where we do not need to verify the email.
-	// In the public demo, user can register as students and get directly a
-	// confirmed account.
-	if configuration.Configuration.Server.Authentication.Email.Verify {
-		// fmt.Println(potentialUser.ConfirmEmailToken)
-		// is the email address confirmed?
-		if potentialUser.ConfirmEmailToken.Valid {
-			// Valid is true if String is not NULL
-			// confirm token `potentialUser.ConfirmEmailToken.String` exists
-			render.Render(w, r, ErrBadRequestWithDetails(errors.New("email not confirmed")))
+	// staff can protect their accounts by a second factor
+	if potentialUser.TOTPEnabled {
+		if err := checkSecondFactor(rs.Stores, potentialUser, data.TOTPCode); err != nil {
+			rs.loginFailed(r)
+			render.Render(w, r, ErrBadRequestWithDetails(err))
 			return
 		}
 	}
 
 	// user passed all tests
+	if !rs.resetLoginFailures(w, r) {
+		return
+	}
+
+	sessionID, err := rs.startSession()
+	if err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+	rs.Events.Publish(event.LoginSucceeded{UserID: potentialUser.ID})
+
 	accessClaims := &authenticate.AccessClaims{
-		LoginID: potentialUser.ID,
-		Root:    potentialUser.Root,
+		LoginID:   potentialUser.ID,
+		Root:      potentialUser.Root,
+		SessionID: sessionID,
 	}
 
 	// fmt.Println("WRITE accessClaims.LoginID", accessClaims.LoginID)
@@ -243,6 +358,410 @@ func (rs *AuthResource) LoginHandler(w http.ResponseWriter, r *http.Request) {
 
 }
 
+// captchaEnabled reports whether failed logins are counted to require a
+// captcha.
+func (rs *AuthResource) captchaEnabled() bool {
+	return configuration.Configuration.Server.Authentication.Captcha.Enabled && rs.LoginFailures != nil
+}
+
+// checkLoginCaptcha verifies the captcha token once the address of the client
+// crossed the threshold of failed logins.
+func (rs *AuthResource) checkLoginCaptcha(r *http.Request, token string) error {
+	if !rs.captchaEnabled() {
+		return nil
+	}
+
+	captchaConfig := configuration.Configuration.Server.Authentication.Captcha
+	failures, err := rs.LoginFailures.Count(r)
+	if err != nil {
+		return err
+	}
+	if failures < captchaConfig.FailureThreshold {
+		return nil
+	}
+
+	verifier, err := authenticate.NewCaptchaVerifier(&configuration.Configuration.Server.Authentication)
+	if err != nil {
+		return err
+	}
+	return verifier.Verify(token, authenticate.NewLoginLimiterKeyFromIP(r).Key())
+}
+
+// passCaptchaGate is shared by all endpoints checking passwords. It renders
+// the error and returns false if the request has to solve a captcha first.
+func (rs *AuthResource) passCaptchaGate(w http.ResponseWriter, r *http.Request, token string) bool {
+	if err := rs.checkLoginCaptcha(r, token); err != nil {
+		if err == authenticate.ErrCaptchaInvalid {
+			render.Render(w, r, ErrCaptchaRequired)
+		} else {
+			render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		}
+		return false
+	}
+	return true
+}
+
+// resetLoginFailures forgets the failed logins from the address of the client
+// after a successful login. It renders the error and returns false on failure.
+func (rs *AuthResource) resetLoginFailures(w http.ResponseWriter, r *http.Request) bool {
+	if !rs.captchaEnabled() {
+		return true
+	}
+	if err := rs.LoginFailures.Reset(r); err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return false
+	}
+	return true
+}
+
+// countLoginFailure remembers a failed login from the address of the client.
+func (rs *AuthResource) countLoginFailure(r *http.Request) {
+	if !rs.captchaEnabled() {
+		return
+	}
+
+	window := configuration.Configuration.Server.Authentication.Captcha.FailureWindow
+	if err := rs.LoginFailures.Add(r, window); err != nil {
+		logrus.WithField("module", "auth").Warn(err)
+	}
+}
+
+// loginFailed publishes a failed login and counts it for the captcha.
+func (rs *AuthResource) loginFailed(r *http.Request) {
+	rs.Events.Publish(event.LoginFailed{})
+	rs.countLoginFailure(r)
+}
+
+// findLoginUser resolves the identifier of a login request, which is either
+// an email address or (if enabled) a student number.
+func (rs *AuthResource) findLoginUser(data *LoginRequest) (*model.User, error) {
+	if data.UsesStudentNumber() {
+		return rs.Stores.User.FindByStudentNumber(data.Email)
+	}
+	return rs.Stores.User.FindByEmail(data.Email)
+}
+
+// OIDCStartHandler is public endpoint for
+// URL: /auth/oidc/start
+// METHOD: get
+// TAG: auth
+// RESPONSE: 302,Redirect
+// SUMMARY:  Start a login via the identity provider
+// DESCRIPTION:
+// Redirects to the identity provider of the university (OpenID Connect).
+// This endpoint is only available if enabled in the configuration.
+func (rs *AuthResource) OIDCStartHandler(w http.ResponseWriter, r *http.Request) {
+	if !configuration.Configuration.Server.Authentication.OIDC.Enabled {
+		render.Render(w, r, ErrNotFound)
+		return
+	}
+
+	// the state protects against CSRF and is verified in the callback
+	state := auth.GenerateToken(16)
+	session := rs.SessionAuth.Load(r)
+	if err := session.PutString(w, "oidc_state", state); err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
+	provider := authenticate.NewOIDCProvider(&configuration.Configuration.Server)
+	url, err := provider.AuthCodeURL(state)
+	if err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
+	http.Redirect(w, r, url, http.StatusFound)
+}
+
+// OIDCCallbackHandler is public endpoint for
+// URL: /auth/oidc/callback
+// METHOD: get
+// TAG: auth
+// RESPONSE: 200,AuthResponse
+// RESPONSE: 400,BadRequest
+// SUMMARY:  Finish a login via the identity provider
+// DESCRIPTION:
+// The identity provider redirects to this endpoint. Users are matched by their
+// email address and created if they do not exist yet. Existing password
+// accounts are only linked if enabled in the configuration. Besides starting a
+// session, the access and refresh tokens are returned. Accounts with enabled
+// two-factor authentication are answered with the error code 1003 and have to
+// finish the login at "/auth/oidc/second_factor".
+func (rs *AuthResource) OIDCCallbackHandler(w http.ResponseWriter, r *http.Request) {
+	if !configuration.Configuration.Server.Authentication.OIDC.Enabled {
+		render.Render(w, r, ErrNotFound)
+		return
+	}
+
+	session := rs.SessionAuth.Load(r)
+	state, err := session.GetString("oidc_state")
+	if err != nil || state == "" || state != r.FormValue("state") {
+		render.Render(w, r, ErrBadRequestWithDetails(errors.New("invalid state")))
+		return
+	}
+	// the state can only be used once
+	if err := session.Remove(w, "oidc_state"); err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
+	if errorText := r.FormValue("error"); errorText != "" {
+		render.Render(w, r, ErrBadRequestWithDetails(errors.New(errorText)))
+		return
+	}
+
+	provider := authenticate.NewOIDCProvider(&configuration.Configuration.Server)
+	info, err := provider.Exchange(r.FormValue("code"))
+	if err != nil {
+		rs.Events.Publish(event.LoginFailed{})
+		render.Render(w, r, ErrBadRequestWithDetails(err))
+		return
+	}
+
+	user, err := rs.findOrCreateOIDCUser(info, r)
+	if err != nil {
+		rs.Events.Publish(event.LoginFailed{})
+		render.Render(w, r, ErrBadRequestWithDetails(err))
+		return
+	}
+
+	// the identity provider does not replace the second factor of an account
+	if user.TOTPEnabled {
+		if err := session.PutInt64(w, "oidc_pending_user", user.ID); err != nil {
+			render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+			return
+		}
+		if err := session.PutInt64(w, "oidc_pending_at", NowUTC().Unix()); err != nil {
+			render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+			return
+		}
+		render.Render(w, r, ErrSecondFactorRequired)
+		return
+	}
+
+	rs.finishOIDCLogin(w, r, user)
+}
+
+// oidcSecondFactorTimeout is the time to enter the second factor after the
+// identity provider confirmed the identity.
+const oidcSecondFactorTimeout = 5 * time.Minute
+
+// OIDCSecondFactorHandler is public endpoint for
+// URL: /auth/oidc/second_factor
+// METHOD: post
+// TAG: auth
+// REQUEST: TwoFactorCodeRequest
+// RESPONSE: 200,AuthResponse
+// RESPONSE: 400,BadRequest
+// SUMMARY:  Finish a login via the identity provider with the second factor
+// DESCRIPTION:
+// Accounts with enabled two-factor authentication are answered with the error
+// code 1003 by the callback of the identity provider. The login is finished by
+// sending the code (or a recovery code) within 5 minutes.
+func (rs *AuthResource) OIDCSecondFactorHandler(w http.ResponseWriter, r *http.Request) {
+	if !configuration.Configuration.Server.Authentication.OIDC.Enabled {
+		render.Render(w, r, ErrNotFound)
+		return
+	}
+
+	data := &TwoFactorCodeRequest{}
+	if err := render.Bind(r, data); err != nil {
+		render.Render(w, r, ErrBadRequestWithDetails(err))
+		return
+	}
+
+	session := rs.SessionAuth.Load(r)
+	userID, err := session.GetInt64("oidc_pending_user")
+	if err != nil || userID == 0 {
+		render.Render(w, r, ErrBadRequestWithDetails(errors.New("no pending login")))
+		return
+	}
+	pendingAt, err := session.GetInt64("oidc_pending_at")
+	if err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
+	// a pending login can only be used once
+	if err := session.Remove(w, "oidc_pending_user"); err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+	if err := session.Remove(w, "oidc_pending_at"); err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
+	if NowUTC().Sub(time.Unix(pendingAt, 0)) > oidcSecondFactorTimeout {
+		render.Render(w, r, ErrBadRequestWithDetails(errors.New("the login expired, please start again")))
+		return
+	}
+
+	user, err := rs.Stores.User.Get(userID)
+	if err != nil {
+		render.Render(w, r, ErrBadRequestWithDetails(errors.New("no pending login")))
+		return
+	}
+
+	if user.TOTPEnabled {
+		if err := checkSecondFactor(rs.Stores, user, data.Code); err != nil {
+			rs.loginFailed(r)
+			render.Render(w, r, ErrBadRequestWithDetails(err))
+			return
+		}
+	}
+
+	rs.finishOIDCLogin(w, r, user)
+}
+
+// finishOIDCLogin starts a session for a user confirmed by the identity
+// provider and returns the tokens.
+func (rs *AuthResource) finishOIDCLogin(w http.ResponseWriter, r *http.Request, user *model.User) {
+	sessionID, err := rs.startSession()
+	if err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+	rs.Events.Publish(event.LoginSucceeded{UserID: user.ID})
+
+	accessClaims := authenticate.NewAccessClaims(user.ID, user.Root)
+	accessClaims.SessionID = sessionID
+	w = accessClaims.WriteToSession(rs.SessionAuth, w, r)
+
+	accessToken, err := rs.TokenAuth.CreateAccessJWT(accessClaims)
+	if err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
+	refreshClaims := authenticate.NewRefreshClaims(user.ID)
+	refreshClaims.SessionID = sessionID
+	refreshToken, err := rs.TokenAuth.CreateRefreshJWT(refreshClaims)
+	if err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
+	resp := &AuthResponse{}
+	resp.Access.Token = accessToken
+	resp.Refresh.Token = refreshToken
+
+	if err := render.Render(w, r, resp); err != nil {
+		render.Render(w, r, ErrRender(err))
+		return
+	}
+}
+
+// errAccountNotLinked rejects logins via an external provider for password
+// accounts, which have not been linked to the provider.
+var errAccountNotLinked = errors.New("an account with this email already exists, please login with your password")
+
+// findOrCreateOIDCUser matches the identity by email. Unknown users are
+// provisioned, existing password accounts are linked if enabled.
+func (rs *AuthResource) findOrCreateOIDCUser(info *authenticate.OIDCUserInfo, r *http.Request) (*model.User, error) {
+	user, err := rs.Stores.User.FindByEmail(info.Email)
+	if err != nil {
+		// there is no such user, so we create one
+		user = &model.User{
+			FirstName:     info.GivenName,
+			LastName:      info.FamilyName,
+			Email:         info.Email,
+			StudentNumber: "",
+			Semester:      1,
+			Subject:       "",
+			Language:      NegotiateLanguage(r),
+			Root:          false,
+			OIDCSubject:   null.StringFrom(info.Subject),
+		}
+		return rs.createConfirmedUser(user)
+	}
+
+	if user.OIDCSubject.Valid {
+		if user.OIDCSubject.String != info.Subject {
+			return nil, errors.New("account is linked to another identity")
+		}
+		return user, nil
+	}
+
+	if !configuration.Configuration.Server.Authentication.OIDC.LinkExistingAccounts {
+		return nil, errAccountNotLinked
+	}
+
+	user.OIDCSubject = null.StringFrom(info.Subject)
+	// the identity provider has verified the email address
+	user.ConfirmEmailToken = null.String{}
+	user.ClearPendingEmailChange()
+	if err := rs.Stores.User.Update(user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// findOrCreateLDAPUser binds against the directory and returns the matching
+// user. Unknown users are provisioned from the directory attributes, existing
+// password accounts are linked if enabled.
+func (rs *AuthResource) findOrCreateLDAPUser(data *LoginRequest, r *http.Request) (*model.User, error) {
+	info, err := authenticate.LDAPAuthenticate(&configuration.Configuration.Server, data.Email, data.PlainPassword)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := rs.Stores.User.FindByEmail(info.Email)
+	if err == nil {
+		if user.LDAPDN.Valid {
+			if !strings.EqualFold(user.LDAPDN.String, info.DN) {
+				return nil, errors.New("account is linked to another directory entry")
+			}
+			return user, nil
+		}
+
+		if !configuration.Configuration.Server.Authentication.LDAP.LinkExistingAccounts {
+			return nil, errAccountNotLinked
+		}
+
+		user.LDAPDN = null.StringFrom(info.DN)
+		// the directory has verified the email address
+		user.ConfirmEmailToken = null.String{}
+		user.ClearPendingEmailChange()
+		if err := rs.Stores.User.Update(user); err != nil {
+			return nil, err
+		}
+		return user, nil
+	}
+
+	user = &model.User{
+		FirstName:     info.FirstName,
+		LastName:      info.LastName,
+		Email:         info.Email,
+		StudentNumber: info.StudentNumber,
+		Semester:      1,
+		Subject:       "",
+		Language:      NegotiateLanguage(r),
+		Root:          false,
+		LDAPDN:        null.StringFrom(info.DN),
+	}
+	return rs.createConfirmedUser(user)
+}
+
+// createConfirmedUser stores a user whose identity has been verified by an
+// external provider. The account cannot be used with a password until the
+// user resets it, as nobody knows the random password.
+func (rs *AuthResource) createConfirmedUser(user *model.User) (*model.User, error) {
+	var err error
+	user.EncryptedPassword, err = auth.HashPassword(auth.GenerateToken(32))
+	if err != nil {
+		return nil, err
+	}
+
+	newUser, err := rs.Stores.User.Create(user)
+	if err != nil {
+		return nil, err
+	}
+	rs.Events.Publish(event.UserConfirmed{User: newUser})
+	return newUser, nil
+}
+
 // LogoutHandler is public endpoint for
 // URL: /auth/sessions
 // METHOD: delete
@@ -253,9 +772,123 @@ func (rs *AuthResource) LoginHandler(w http.ResponseWriter, r *http.Request) {
 // SUMMARY:  Destroy a session
 func (rs *AuthResource) LogoutHandler(w http.ResponseWriter, r *http.Request) {
 	accessClaims := r.Context().Value(symbol.CtxKeyAccessClaims).(*authenticate.AccessClaims)
+	if accessClaims.SessionID != "" && rs.IdleSessions != nil {
+		rs.IdleSessions.Stop(accessClaims.SessionID)
+	}
 	accessClaims.DestroyInSession(rs.SessionAuth, w, r)
 }
 
+// LogoutAllHandler is public endpoint for
+// URL: /auth/sessions/all
+// METHOD: delete
+// TAG: auth
+// RESPONSE: 200,OK
+// RESPONSE: 401,Unauthenticated
+// SUMMARY:  Destroy all sessions
+// DESCRIPTION:
+// This endpoint revokes all refresh tokens and sessions of the request identity
+// on all devices including the current one. Already issued access tokens stay
+// valid until they expire.
+func (rs *AuthResource) LogoutAllHandler(w http.ResponseWriter, r *http.Request) {
+	accessClaims := r.Context().Value(symbol.CtxKeyAccessClaims).(*authenticate.AccessClaims)
+
+	user, err := rs.Stores.User.Get(accessClaims.LoginID)
+	if err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
+	user.SessionsRevokedAt = null.TimeFrom(time.Now().UTC())
+	if err := rs.Stores.User.Update(user); err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
+	accessClaims.DestroyInSession(rs.SessionAuth, w, r)
+}
+
+// upgradePasswordHash replaces the stored hash of a verified password if it
+// is weaker than the configured one. The login does not depend on it, hence
+// errors are only logged.
+func (rs *AuthResource) upgradePasswordHash(user *model.User, plainPassword string) {
+	if !auth.PasswordNeedsRehash(user.EncryptedPassword) {
+		return
+	}
+
+	hash, err := auth.HashPassword(plainPassword)
+	if err == nil {
+		user.EncryptedPassword = hash
+		err = rs.Stores.User.Update(user)
+	}
+	if err != nil {
+		logrus.WithField("module", "auth").WithField("user_id", user.ID).Error(err)
+	}
+}
+
+// SessionRevoked implements authenticate.SessionRevocationResolver.
+func (rs *AuthResource) SessionRevoked(loginID int64, issuedAt int64) bool {
+	user, err := rs.Stores.User.Get(loginID)
+	if err != nil {
+		return true
+	}
+	return user.SessionRevoked(issuedAt)
+}
+
+// SessionIdle implements authenticate.SessionRevocationResolver.
+func (rs *AuthResource) SessionIdle(sessionID string) bool {
+	timeout := configuration.Configuration.Server.Authentication.Session.InactivityTimeout
+	if timeout <= 0 || rs.IdleSessions == nil {
+		return false
+	}
+	active, err := rs.IdleSessions.Touch(sessionID, timeout)
+	if err != nil {
+		return true
+	}
+	return !active
+}
+
+// startSession begins a session which ends after the inactivity timeout. The
+// id is empty if the inactivity of sessions is not tracked.
+func (rs *AuthResource) startSession() (string, error) {
+	timeout := configuration.Configuration.Server.Authentication.Session.InactivityTimeout
+	if timeout <= 0 || rs.IdleSessions == nil {
+		return "", nil
+	}
+	return rs.IdleSessions.Start(timeout)
+}
+
+// ValidateHandler is public endpoint for
+// URL: /auth/validate
+// METHOD: get
+// TAG: auth
+// RESPONSE: 200,TokenValidationResponse
+// RESPONSE: 401,Unauthenticated
+// SUMMARY:  Check whether an access token is valid
+// DESCRIPTION:
+// This endpoint checks the access token from the authorization header without
+// any side effects. It returns the claims and the expiry of the token.
+func (rs *AuthResource) ValidateHandler(w http.ResponseWriter, r *http.Request) {
+	if !authenticate.HasHeaderToken(r) {
+		render.Render(w, r, auth.ErrUnauthenticated)
+		return
+	}
+
+	accessClaims := &authenticate.AccessClaims{}
+	err := accessClaims.ParseAccessClaimsFromToken(
+		configuration.Configuration.Server.Authentication.JWT.Secret,
+		jwtauth.TokenFromHeader(r),
+	)
+	if err != nil {
+		render.Render(w, r, auth.ErrUnauthenticated)
+		return
+	}
+
+	if err := render.Render(w, r, newTokenValidationResponse(accessClaims)); err != nil {
+		render.Render(w, r, ErrRender(err))
+		return
+	}
+}
+
 // RequestPasswordResetHandler is public endpoint for
 // URL: /auth/request_password_reset
 // METHOD: post
@@ -281,13 +914,15 @@ func (rs *AuthResource) RequestPasswordResetHandler(w http.ResponseWriter, r *ht
 	user.ResetPasswordToken = null.StringFrom(auth.GenerateToken(32))
 	rs.Stores.User.Update(user)
 
+	tpl := email.Localize(email.RequestPasswordTokenTemplates, LanguageOfUser(user, r))
+
 	// Send Email to User
 	// https://infomark-staging.informatik.uni-tuebingen.de/#/password_reset/example@uni-tuebingen.de/af1ecf6f
 	msg, err := email.NewEmailFromTemplate(
 		configuration.Configuration.Server.Email.From,
 		user.Email,
-		"Password Reset Instructions",
-		email.RequestPasswordTokenTemailTemplateEN,
+		tpl.Subject,
+		tpl.Body,
 		map[string]string{
 			"first_name":           user.FirstName,
 			"last_name":            user.LastName,
@@ -299,8 +934,7 @@ func (rs *AuthResource) RequestPasswordResetHandler(w http.ResponseWriter, r *ht
 		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
 		return
 	}
-	err = email.DefaultMail.Send(msg)
-	// err = email.Send()
+	err = sendUserEmail(rs.Stores, user.ID, model.EmailKindPasswordReset, msg)
 	if err != nil {
 		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
 		return
@@ -337,7 +971,17 @@ func (rs *AuthResource) UpdatePasswordHandler(w http.ResponseWriter, r *http.Req
 		return
 	}
 
+	err = checkPasswordHistory(rs.Stores, user, data.PlainPassword)
+	if err == errPasswordReused {
+		render.Render(w, r, ErrBadRequestWithDetails(err))
+		return
+	}
+	if err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
 	// token is ok, remove token and set new password
+	previousPassword := user.EncryptedPassword
 	user.ResetPasswordToken = null.String{}
 	user.EncryptedPassword, err = auth.HashPassword(data.PlainPassword)
 	if err != nil {
@@ -346,7 +990,7 @@ func (rs *AuthResource) UpdatePasswordHandler(w http.ResponseWriter, r *http.Req
 	}
 
 	// fmt.Println(user)
-	if err := rs.Stores.User.Update(user); err != nil {
+	if err := updatePasswordOfUser(rs.Stores, user, previousPassword); err != nil {
 		// fmt.Println(err)
 		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
 		return
@@ -363,6 +1007,9 @@ func (rs *AuthResource) UpdatePasswordHandler(w http.ResponseWriter, r *http.Req
 // RESPONSE: 200,OK
 // RESPONSE: 400,BadRequest
 // SUMMARY:  handles the confirmation link and activate an account
+// DESCRIPTION:
+// New accounts are enrolled as students into the courses listed in the
+// configuration ("auto_enroll_courses").
 func (rs *AuthResource) ConfirmEmailHandler(w http.ResponseWriter, r *http.Request) {
 	data := &ConfirmEmailRequest{}
 	if err := render.Bind(r, data); err != nil {
@@ -384,12 +1031,19 @@ func (rs *AuthResource) ConfirmEmailHandler(w http.ResponseWriter, r *http.Reque
 	}
 
 	// token is ok
+	isEmailChange := user.PreviousEmail.Valid
 	user.ConfirmEmailToken = null.String{}
+	user.ClearPendingEmailChange()
 	if err := rs.Stores.User.Update(user); err != nil {
 		fmt.Println(err)
 		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
 		return
 	}
 
+	// only new accounts are welcomed
+	if !isEmailChange {
+		rs.Events.Publish(event.UserConfirmed{User: user})
+	}
+
 	render.Status(r, http.StatusOK)
 }
@@ -25,6 +25,7 @@ import (
 
 	validation "github.com/go-ozzo/ozzo-validation"
 	"github.com/go-ozzo/ozzo-validation/is"
+	"github.com/infomark-org/infomark/configuration"
 )
 
 // LoginRequest is the request for the login process containing the password
@@ -32,6 +33,8 @@ import (
 type LoginRequest struct {
 	Email         string `json:"email" example:"test@uni-tuebingen.de"`
 	PlainPassword string `json:"plain_password" example:"test"`
+	TOTPCode      string `json:"totp_code" example:"123456" required:"false"`
+	CaptchaToken  string `json:"captcha_token" example:"10000000-aaaa-bbbb-cccc-000000000001" required:"false"`
 }
 
 // Bind preprocesses a loginRequest.
@@ -39,12 +42,37 @@ func (body *LoginRequest) Bind(r *http.Request) error {
 	body.Email = strings.TrimSpace(body.Email)
 	body.Email = strings.ToLower(body.Email)
 
+	if body.UsesStudentNumber() {
+		return validation.ValidateStruct(body,
+			validation.Field(&body.Email, validation.Required, is.Digit),
+			validation.Field(&body.PlainPassword, validation.Required),
+		)
+	}
+
+	// the login name of the directory is not necessarily an email address
+	if configuration.Configuration.Server.Authentication.LDAP.Enabled {
+		return validation.ValidateStruct(body,
+			validation.Field(&body.Email, validation.Required),
+			validation.Field(&body.PlainPassword, validation.Required),
+		)
+	}
+
 	return validation.ValidateStruct(body,
 		validation.Field(&body.Email, validation.Required, is.Email),
 		validation.Field(&body.PlainPassword, validation.Required),
 	)
 }
 
+// UsesStudentNumber tests whether the login identifier is a student number
+// instead of an email address. Student numbers are numeric and email addresses
+// are not. Hence, there is no ambiguity.
+func (body *LoginRequest) UsesStudentNumber() bool {
+	if !configuration.Configuration.Server.Authentication.Login.AllowStudentNumber {
+		return false
+	}
+	return body.Email != "" && is.Digit.Validate(body.Email) == nil
+}
+
 // -----------------------------------------------------------------------------
 // ResetPasswordRequest is the request whenever a user forgot his password and wants
 // to receive an email with a new one.
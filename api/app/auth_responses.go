@@ -21,6 +21,9 @@ package app
 
 import (
 	"net/http"
+	"time"
+
+	"github.com/infomark-org/infomark/auth/authenticate"
 )
 
 type AuthResponse struct {
@@ -45,3 +48,28 @@ func (body *loginResponse) Render(w http.ResponseWriter, r *http.Request) error
 	// nothing to hide
 	return nil
 }
+
+// .............................................................................
+
+// TokenValidationResponse is the response payload for validating an access token.
+type TokenValidationResponse struct {
+	LoginID   int64     `json:"login_id" example:"1"`
+	Root      bool      `json:"root" example:"false"`
+	IssuedAt  time.Time `json:"issued_at" example:"auto"`
+	ExpiresAt time.Time `json:"expires_at" example:"auto"`
+}
+
+// newTokenValidationResponse creates a response from the claims of a token.
+func newTokenValidationResponse(claims *authenticate.AccessClaims) *TokenValidationResponse {
+	return &TokenValidationResponse{
+		LoginID:   claims.LoginID,
+		Root:      claims.Root,
+		IssuedAt:  time.Unix(claims.IssuedAt, 0).UTC(),
+		ExpiresAt: time.Unix(claims.ExpiresAt, 0).UTC(),
+	}
+}
+
+// Render post-processes a TokenValidationResponse.
+func (body *TokenValidationResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
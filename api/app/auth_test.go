@@ -20,16 +20,24 @@
 package app
 
 import (
+	"encoding/json"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/franela/goblin"
+	ber "github.com/go-asn1-ber/asn1-ber"
 	redis "github.com/go-redis/redis"
 	"github.com/infomark-org/infomark/auth"
+	"github.com/infomark-org/infomark/auth/authenticate"
 	"github.com/infomark-org/infomark/configuration"
 	"github.com/infomark-org/infomark/email"
-
+	"golang.org/x/crypto/bcrypt"
 	null "gopkg.in/guregu/null.v3"
 )
 
@@ -100,6 +108,38 @@ func TestAuth(t *testing.T) {
 			g.Assert(w.Code).Equal(http.StatusBadRequest)
 		})
 
+		g.It("Should distinguish wrong passwords from unconfirmed emails", func() {
+			user, err := stores.User.Get(1)
+			g.Assert(err).Equal(nil)
+			user.ConfirmEmailToken = null.StringFrom("testtoken")
+			g.Assert(stores.User.Update(user)).Equal(nil)
+
+			// wrong password does not reveal anything about the account
+			w = tape.Post("/api/v1/auth/sessions", H{
+				"email":          "test@uni-tuebingen.de",
+				"plain_password": "wrong",
+			})
+			g.Assert(w.Code).Equal(http.StatusBadRequest)
+
+			errResp := ErrResponse{}
+			err = json.NewDecoder(w.Body).Decode(&errResp)
+			g.Assert(err).Equal(nil)
+			g.Assert(errResp.AppCode).Equal(int64(0))
+			g.Assert(errResp.ErrorText).Equal("credentials are wrong")
+
+			// correct password
+			w = tape.Post("/api/v1/auth/sessions", H{
+				"email":          "test@uni-tuebingen.de",
+				"plain_password": "test",
+			})
+			g.Assert(w.Code).Equal(http.StatusBadRequest)
+
+			errResp = ErrResponse{}
+			err = json.NewDecoder(w.Body).Decode(&errResp)
+			g.Assert(err).Equal(nil)
+			g.Assert(errResp.AppCode).Equal(AppCodeEmailNotConfirmed)
+		})
+
 		g.It("Correct credentials should log in", func() {
 
 			w = tape.Post("/api/v1/auth/sessions",
@@ -111,6 +151,471 @@ func TestAuth(t *testing.T) {
 			g.Assert(w.Code).Equal(http.StatusOK)
 		})
 
+		g.It("Should rehash passwords with an outdated cost on login", func() {
+			cost := configuration.Configuration.Server.Authentication.Password.BcryptCost
+			defer func() {
+				configuration.Configuration.Server.Authentication.Password.BcryptCost = cost
+				auth.PasswordCost = cost
+			}()
+			configuration.Configuration.Server.Authentication.Password.BcryptCost = bcrypt.MinCost + 1
+			tape.Router, _ = New(tape.DB, EmptyHandler(), false)
+
+			outdated, err := bcrypt.GenerateFromPassword([]byte("test"), bcrypt.MinCost)
+			g.Assert(err).Equal(nil)
+			user, err := stores.User.Get(1)
+			g.Assert(err).Equal(nil)
+			user.EncryptedPassword = string(outdated)
+			err = stores.User.Update(user)
+			g.Assert(err).Equal(nil)
+
+			// a wrong password does not change anything
+			w = tape.Post("/api/v1/auth/sessions", H{"email": "test@uni-tuebingen.de", "plain_password": "testOops"})
+			g.Assert(w.Code).Equal(http.StatusBadRequest)
+			user, err = stores.User.Get(1)
+			g.Assert(err).Equal(nil)
+			g.Assert(user.EncryptedPassword).Equal(string(outdated))
+
+			w = tape.Post("/api/v1/auth/sessions", H{"email": "test@uni-tuebingen.de", "plain_password": "test"})
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			user, err = stores.User.Get(1)
+			g.Assert(err).Equal(nil)
+			g.Assert(user.EncryptedPassword != string(outdated)).IsTrue()
+			rehashedCost, err := bcrypt.Cost([]byte(user.EncryptedPassword))
+			g.Assert(err).Equal(nil)
+			g.Assert(rehashedCost).Equal(bcrypt.MinCost + 1)
+			g.Assert(auth.CheckPasswordHash("test", user.EncryptedPassword)).IsTrue()
+
+			// up-to-date hashes are kept
+			rehashed := user.EncryptedPassword
+			w = tape.Post("/api/v1/auth/sessions", H{"email": "test@uni-tuebingen.de", "plain_password": "test"})
+			g.Assert(w.Code).Equal(http.StatusOK)
+			user, err = stores.User.Get(1)
+			g.Assert(err).Equal(nil)
+			g.Assert(user.EncryptedPassword).Equal(rehashed)
+		})
+
+		g.It("Should log in with email when student numbers are allowed", func() {
+			configuration.Configuration.Server.Authentication.Login.AllowStudentNumber = true
+			defer func() {
+				configuration.Configuration.Server.Authentication.Login.AllowStudentNumber = false
+			}()
+
+			w = tape.Post("/api/v1/auth/sessions",
+				H{
+					"email":          "test@uni-tuebingen.de",
+					"plain_password": "test",
+				},
+			)
+			g.Assert(w.Code).Equal(http.StatusOK)
+		})
+
+		g.It("Should log in with student number only when enabled", func() {
+			user, err := stores.User.Get(1)
+			g.Assert(err).Equal(nil)
+			user.StudentNumber = "98765432"
+			g.Assert(stores.User.Update(user)).Equal(nil)
+
+			payload := H{
+				"email":          "98765432",
+				"plain_password": "test",
+			}
+
+			configuration.Configuration.Server.Authentication.Login.AllowStudentNumber = false
+			w = tape.Post("/api/v1/auth/sessions", payload)
+			g.Assert(w.Code).Equal(http.StatusBadRequest)
+
+			configuration.Configuration.Server.Authentication.Login.AllowStudentNumber = true
+			defer func() {
+				configuration.Configuration.Server.Authentication.Login.AllowStudentNumber = false
+			}()
+
+			w = tape.Post("/api/v1/auth/sessions", payload)
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			w = tape.Post("/api/v1/auth/sessions",
+				H{
+					"email":          "98765432",
+					"plain_password": "wrong",
+				},
+			)
+			g.Assert(w.Code).Equal(http.StatusBadRequest)
+		})
+
+		g.It("Should enroll, verify and require two-factor codes", func() {
+			loginPayload := H{
+				"email":          "test@uni-tuebingen.de",
+				"plain_password": "test",
+			}
+
+			w = tape.Post("/api/v1/account/2fa/enroll", H{}, tape.NewJWTRequest(1, true))
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			enrollment := &TwoFactorEnrollResponse{}
+			err := json.NewDecoder(w.Body).Decode(enrollment)
+			g.Assert(err).Equal(nil)
+			g.Assert(enrollment.Secret != "").IsTrue()
+			g.Assert(strings.HasPrefix(enrollment.URL, "otpauth://totp/")).IsTrue()
+
+			// secret is not stored in plain text
+			userAfter, err := stores.User.Get(1)
+			g.Assert(err).Equal(nil)
+			g.Assert(userAfter.TOTPEnabled).Equal(false)
+			g.Assert(userAfter.TOTPSecret.Valid).Equal(true)
+			g.Assert(userAfter.TOTPSecret.String != enrollment.Secret).IsTrue()
+
+			// not verified yet, so no code is required
+			w = tape.Post("/api/v1/auth/sessions", loginPayload)
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			w = tape.Post("/api/v1/account/2fa/verify", H{"code": "000000"}, tape.NewJWTRequest(1, true))
+			g.Assert(w.Code).Equal(http.StatusBadRequest)
+
+			code, err := auth.TOTPCode(enrollment.Secret, time.Now())
+			g.Assert(err).Equal(nil)
+			w = tape.Post("/api/v1/account/2fa/verify", H{"code": code}, tape.NewJWTRequest(1, true))
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			recovery := &TwoFactorRecoveryCodesResponse{}
+			err = json.NewDecoder(w.Body).Decode(recovery)
+			g.Assert(err).Equal(nil)
+			g.Assert(len(recovery.RecoveryCodes)).Equal(10)
+
+			// missing code
+			w = tape.Post("/api/v1/auth/sessions", loginPayload)
+			g.Assert(w.Code).Equal(http.StatusBadRequest)
+
+			// wrong code
+			w = tape.Post("/api/v1/auth/sessions", H{
+				"email":          "test@uni-tuebingen.de",
+				"plain_password": "test",
+				"totp_code":      "abcdef",
+			})
+			g.Assert(w.Code).Equal(http.StatusBadRequest)
+
+			// correct code
+			w = tape.Post("/api/v1/auth/sessions", H{
+				"email":          "test@uni-tuebingen.de",
+				"plain_password": "test",
+				"totp_code":      code,
+			})
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			// recovery codes can be used exactly once
+			recoveryPayload := H{
+				"email":          "test@uni-tuebingen.de",
+				"plain_password": "test",
+				"totp_code":      recovery.RecoveryCodes[0],
+			}
+			w = tape.Post("/api/v1/auth/sessions", recoveryPayload)
+			g.Assert(w.Code).Equal(http.StatusOK)
+			w = tape.Post("/api/v1/auth/sessions", recoveryPayload)
+			g.Assert(w.Code).Equal(http.StatusBadRequest)
+		})
+
+		g.It("Students cannot enroll two-factor authentication", func() {
+			w = tape.Post("/api/v1/account/2fa/enroll", H{}, tape.NewJWTRequest(112, false))
+			g.Assert(w.Code).Equal(http.StatusForbidden)
+		})
+
+		g.It("Should login and provision users via OIDC", func() {
+			provider := newMockOIDCProvider("oidc-subject-1", "new.student@uni-tuebingen.de")
+			defer provider.Close()
+			defer enableOIDC(provider.URL, false)()
+
+			w = tape.Get("/api/v1/auth/oidc/start")
+			g.Assert(w.Code).Equal(http.StatusFound)
+
+			location, err := url.Parse(w.Header().Get("Location"))
+			g.Assert(err).Equal(nil)
+			g.Assert(strings.HasPrefix(location.String(), provider.URL+"/authorize")).IsTrue()
+			g.Assert(location.Query().Get("client_id")).Equal("infomark")
+			state := location.Query().Get("state")
+			g.Assert(state != "").IsTrue()
+			cookies := cookieRequest{w.Result().Cookies()}
+
+			// wrong state is rejected
+			w = tape.Get("/api/v1/auth/oidc/callback?code=valid&state=wrong", cookies)
+			g.Assert(w.Code).Equal(http.StatusBadRequest)
+
+			w = tape.Get("/api/v1/auth/oidc/start")
+			g.Assert(w.Code).Equal(http.StatusFound)
+			location, err = url.Parse(w.Header().Get("Location"))
+			g.Assert(err).Equal(nil)
+			cookies = cookieRequest{w.Result().Cookies()}
+
+			w = tape.Get("/api/v1/auth/oidc/callback?code=valid&state="+location.Query().Get("state"), cookies)
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			resp := &AuthResponse{}
+			err = json.NewDecoder(w.Body).Decode(resp)
+			g.Assert(err).Equal(nil)
+			g.Assert(resp.Access.Token != "").IsTrue()
+			g.Assert(resp.Refresh.Token != "").IsTrue()
+
+			user, err := stores.User.FindByEmail("new.student@uni-tuebingen.de")
+			g.Assert(err).Equal(nil)
+			g.Assert(user.OIDCSubject.String).Equal("oidc-subject-1")
+			g.Assert(user.FirstName).Equal("Max")
+			g.Assert(user.ConfirmEmailToken.Valid).Equal(false)
+
+			// the unknown password is stored as a hash nonetheless
+			_, err = bcrypt.Cost([]byte(user.EncryptedPassword))
+			g.Assert(err).Equal(nil)
+		})
+
+		g.It("Should link or reject existing password accounts via OIDC", func() {
+			provider := newMockOIDCProvider("oidc-subject-2", "test@uni-tuebingen.de")
+			defer provider.Close()
+
+			login := func() int {
+				w := tape.Get("/api/v1/auth/oidc/start")
+				location, _ := url.Parse(w.Header().Get("Location"))
+				w = tape.Get("/api/v1/auth/oidc/callback?code=valid&state="+location.Query().Get("state"),
+					cookieRequest{w.Result().Cookies()})
+				return w.Code
+			}
+
+			restore := enableOIDC(provider.URL, false)
+			g.Assert(login()).Equal(http.StatusBadRequest)
+			restore()
+
+			defer enableOIDC(provider.URL, true)()
+			g.Assert(login()).Equal(http.StatusOK)
+
+			user, err := stores.User.Get(1)
+			g.Assert(err).Equal(nil)
+			g.Assert(user.OIDCSubject.String).Equal("oidc-subject-2")
+		})
+
+		g.It("Should require the second factor for logins via OIDC", func() {
+			provider := newMockOIDCProvider("oidc-subject-3", "test@uni-tuebingen.de")
+			defer provider.Close()
+			defer enableOIDC(provider.URL, true)()
+
+			w = tape.Post("/api/v1/account/2fa/enroll", H{}, tape.NewJWTRequest(1, true))
+			g.Assert(w.Code).Equal(http.StatusOK)
+			enrollment := &TwoFactorEnrollResponse{}
+			g.Assert(json.NewDecoder(w.Body).Decode(enrollment)).Equal(nil)
+			code, err := auth.TOTPCode(enrollment.Secret, time.Now())
+			g.Assert(err).Equal(nil)
+			w = tape.Post("/api/v1/account/2fa/verify", H{"code": code}, tape.NewJWTRequest(1, true))
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			callback := func() *httptest.ResponseRecorder {
+				w := tape.Get("/api/v1/auth/oidc/start")
+				location, _ := url.Parse(w.Header().Get("Location"))
+				return tape.Get("/api/v1/auth/oidc/callback?code=valid&state="+location.Query().Get("state"),
+					cookieRequest{w.Result().Cookies()})
+			}
+
+			// the identity provider alone is not enough
+			w = callback()
+			g.Assert(w.Code).Equal(http.StatusBadRequest)
+			g.Assert(strings.Contains(w.Body.String(), `"code":1003`)).IsTrue()
+			g.Assert(strings.Contains(w.Body.String(), "access")).IsFalse()
+
+			// a wrong code ends the pending login
+			cookies := cookieRequest{w.Result().Cookies()}
+			w = tape.Post("/api/v1/auth/oidc/second_factor", H{"code": "000000"}, cookies)
+			g.Assert(w.Code).Equal(http.StatusBadRequest)
+			w = tape.Post("/api/v1/auth/oidc/second_factor", H{"code": code}, cookies)
+			g.Assert(w.Code).Equal(http.StatusBadRequest)
+
+			w = callback()
+			g.Assert(w.Code).Equal(http.StatusBadRequest)
+			w = tape.Post("/api/v1/auth/oidc/second_factor", H{"code": code}, cookieRequest{w.Result().Cookies()})
+			g.Assert(w.Code).Equal(http.StatusOK)
+			resp := &AuthResponse{}
+			g.Assert(json.NewDecoder(w.Body).Decode(resp)).Equal(nil)
+			g.Assert(resp.Access.Token != "").IsTrue()
+		})
+
+		g.It("Should not offer OIDC when disabled", func() {
+			w = tape.Get("/api/v1/auth/oidc/start")
+			g.Assert(w.Code).Equal(http.StatusNotFound)
+		})
+
+		g.It("Should login and provision users via LDAP", func() {
+			server := newMockLDAPServer(map[string]string{
+				"uid=ldap.student,ou=people,dc=uni-tuebingen,dc=de": "secret",
+			})
+			defer server.Close()
+			defer enableLDAP(server.Addr().String(), false)()
+
+			// the login name is not an email address
+			w = tape.Post("/api/v1/auth/sessions",
+				H{
+					"email":          "ldap.student",
+					"plain_password": "secret",
+				},
+			)
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			user, err := stores.User.FindByEmail("ldap.student@uni-tuebingen.de")
+			g.Assert(err).Equal(nil)
+			g.Assert(user.FirstName).Equal("Erika")
+			g.Assert(user.LastName).Equal("Musterfrau")
+			g.Assert(user.StudentNumber).Equal("4711")
+			g.Assert(user.LDAPDN.String).Equal("uid=ldap.student,ou=people,dc=uni-tuebingen,dc=de")
+			_, err = bcrypt.Cost([]byte(user.EncryptedPassword))
+			g.Assert(err).Equal(nil)
+
+			// second login uses the same account
+			w = tape.Post("/api/v1/auth/sessions",
+				H{
+					"email":          "ldap.student",
+					"plain_password": "secret",
+				},
+			)
+			g.Assert(w.Code).Equal(http.StatusOK)
+		})
+
+		g.It("Should only link existing accounts to LDAP if enabled", func() {
+			server := newMockLDAPServer(map[string]string{
+				"uid=ldap.student,ou=people,dc=uni-tuebingen,dc=de": "secret",
+			})
+			defer server.Close()
+			defer enableLDAP(server.Addr().String(), true)()
+
+			// a password account with the email address of the directory entry
+			local, err := stores.User.Get(112)
+			g.Assert(err).Equal(nil)
+			local.Email = "ldap.student@uni-tuebingen.de"
+			g.Assert(stores.User.Update(local)).Equal(nil)
+
+			payload := H{
+				"email":          "ldap.student",
+				"plain_password": "secret",
+			}
+
+			w = tape.Post("/api/v1/auth/sessions", payload)
+			g.Assert(w.Code).Equal(http.StatusBadRequest)
+
+			user, err := stores.User.Get(local.ID)
+			g.Assert(err).Equal(nil)
+			g.Assert(user.LDAPDN.Valid).IsFalse()
+
+			configuration.Configuration.Server.Authentication.LDAP.LinkExistingAccounts = true
+			w = tape.Post("/api/v1/auth/sessions", payload)
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			user, err = stores.User.Get(local.ID)
+			g.Assert(err).Equal(nil)
+			g.Assert(user.LDAPDN.Valid).IsTrue()
+		})
+
+		g.It("Should reject failed LDAP binds and fall back to local accounts per config", func() {
+			server := newMockLDAPServer(map[string]string{})
+			defer server.Close()
+
+			payload := H{
+				"email":          "test@uni-tuebingen.de",
+				"plain_password": "test",
+			}
+
+			restore := enableLDAP(server.Addr().String(), false)
+			w = tape.Post("/api/v1/auth/sessions", payload)
+			g.Assert(w.Code).Equal(http.StatusBadRequest)
+			restore()
+
+			defer enableLDAP(server.Addr().String(), true)()
+			w = tape.Post("/api/v1/auth/sessions", payload)
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			w = tape.Post("/api/v1/auth/sessions",
+				H{
+					"email":          "test@uni-tuebingen.de",
+					"plain_password": "wrong",
+				},
+			)
+			g.Assert(w.Code).Equal(http.StatusBadRequest)
+		})
+
+		g.It("Should require a captcha after too many failed logins", func() {
+			server := newMockCaptchaProvider("valid-captcha")
+			defer server.Close()
+			defer enableCaptcha(server.URL, 3)()
+
+			wrong := H{
+				"email":          "test@uni-tuebingen.de",
+				"plain_password": "testOops",
+			}
+			correct := H{
+				"email":          "test@uni-tuebingen.de",
+				"plain_password": "test",
+			}
+
+			for i := 0; i < 3; i++ {
+				w = tape.Post("/api/v1/auth/sessions", wrong)
+				g.Assert(w.Code).Equal(http.StatusBadRequest)
+				g.Assert(strings.Contains(w.Body.String(), "captcha")).IsFalse()
+			}
+
+			// even correct credentials require the captcha now
+			w = tape.Post("/api/v1/auth/sessions", correct)
+			g.Assert(w.Code).Equal(http.StatusBadRequest)
+			body := ErrResponse{}
+			err := json.NewDecoder(w.Body).Decode(&body)
+			g.Assert(err).Equal(nil)
+			g.Assert(body.AppCode).Equal(AppCodeCaptchaRequired)
+
+			correct["captcha_token"] = "invalid-captcha"
+			w = tape.Post("/api/v1/auth/sessions", correct)
+			g.Assert(w.Code).Equal(http.StatusBadRequest)
+			body = ErrResponse{}
+			err = json.NewDecoder(w.Body).Decode(&body)
+			g.Assert(err).Equal(nil)
+			g.Assert(body.AppCode).Equal(AppCodeCaptchaRequired)
+
+			correct["captcha_token"] = "valid-captcha"
+			w = tape.Post("/api/v1/auth/sessions", correct)
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			// a successful login resets the counter
+			w = tape.Post("/api/v1/auth/sessions", wrong)
+			g.Assert(w.Code).Equal(http.StatusBadRequest)
+			body = ErrResponse{}
+			err = json.NewDecoder(w.Body).Decode(&body)
+			g.Assert(err).Equal(nil)
+			g.Assert(body.AppCode).Equal(int64(0))
+		})
+
+		g.It("Should share the captcha gate between sessions and tokens", func() {
+			server := newMockCaptchaProvider("valid-captcha")
+			defer server.Close()
+			defer enableCaptcha(server.URL, 3)()
+
+			wrong := H{
+				"email":          "test@uni-tuebingen.de",
+				"plain_password": "testOops",
+			}
+
+			// rotating the forwarded address does not reset the counter
+			for i := 0; i < 3; i++ {
+				w = tape.Post("/api/v1/auth/token", wrong, forwardedFor("203.0.113."+strconv.Itoa(i)))
+				g.Assert(w.Code).Equal(http.StatusNotFound)
+			}
+
+			for _, endpoint := range []string{"/api/v1/auth/token", "/api/v1/auth/sessions"} {
+				w = tape.Post(endpoint, H{
+					"email":          "test@uni-tuebingen.de",
+					"plain_password": "test",
+				}, forwardedFor("198.51.100.7"))
+				g.Assert(w.Code).Equal(http.StatusBadRequest)
+				body := ErrResponse{}
+				g.Assert(json.NewDecoder(w.Body).Decode(&body)).Equal(nil)
+				g.Assert(body.AppCode).Equal(AppCodeCaptchaRequired)
+			}
+
+			w = tape.Post("/api/v1/auth/token", H{
+				"email":          "test@uni-tuebingen.de",
+				"plain_password": "test",
+				"captcha_token":  "valid-captcha",
+			})
+			g.Assert(w.Code).Equal(http.StatusOK)
+		})
+
 		g.It("Password-Reset will fail if email invalid", func() {
 
 			w = tape.Post("/api/v1/auth/request_password_reset",
@@ -121,6 +626,37 @@ func TestAuth(t *testing.T) {
 			g.Assert(w.Code).Equal(http.StatusBadRequest)
 		})
 
+		g.It("Should send password resets in the configured default language", func() {
+			defaultLanguage := configuration.Configuration.Server.DefaultLanguage
+			defer func() { configuration.Configuration.Server.DefaultLanguage = defaultLanguage }()
+			configuration.Configuration.Server.DefaultLanguage = "de"
+
+			mailer := &recordingMailer{}
+			email.DefaultMail = mailer
+			defer func() { email.DefaultMail = email.VoidMail }()
+
+			user, err := stores.User.Get(1)
+			g.Assert(err).Equal(nil)
+			user.Language = ""
+			g.Assert(stores.User.Update(user)).Equal(nil)
+
+			w = tape.Post("/api/v1/auth/request_password_reset",
+				H{"email": user.Email},
+			)
+			g.Assert(w.Code).Equal(http.StatusOK)
+			g.Assert(mailer.Count()).Equal(1)
+			g.Assert(mailer.Sent[0].Subject).Equal("Zurücksetzen Ihres Passworts")
+
+			// the browser language is preferred over the default
+			w = tape.Post("/api/v1/auth/request_password_reset",
+				H{"email": user.Email},
+				acceptLanguage("fr-FR, en-US;q=0.8, de;q=0.5"),
+			)
+			g.Assert(w.Code).Equal(http.StatusOK)
+			g.Assert(mailer.Count()).Equal(2)
+			g.Assert(mailer.Sent[1].Subject).Equal("Password Reset Instructions")
+		})
+
 		g.It("Correct Password-Reset-Token will change password", func() {
 
 			// state before
@@ -164,6 +700,39 @@ func TestAuth(t *testing.T) {
 			g.Assert(isPasswordValid).Equal(false)
 		})
 
+		g.It("Should reject resetting to a recent password", func() {
+			history := configuration.Configuration.Server.Authentication.Password.History
+			defer func() {
+				configuration.Configuration.Server.Authentication.Password.History = history
+			}()
+			configuration.Configuration.Server.Authentication.Password.History = 3
+
+			resetPassword := func(plainPassword string) int {
+				w := tape.Post("/api/v1/auth/request_password_reset", H{"email": "test@uni-tuebingen.de"})
+				g.Assert(w.Code).Equal(http.StatusOK)
+
+				user, err := stores.User.Get(1)
+				g.Assert(err).Equal(nil)
+
+				return tape.Post("/api/v1/auth/update_password", H{
+					"reset_password_token": user.ResetPasswordToken.String,
+					"plain_password":       plainPassword,
+					"email":                "test@uni-tuebingen.de",
+				}).Code
+			}
+
+			g.Assert(resetPassword("test")).Equal(http.StatusBadRequest)
+			g.Assert(resetPassword("new_password")).Equal(http.StatusOK)
+			// the immediately previous password
+			g.Assert(resetPassword("test")).Equal(http.StatusBadRequest)
+
+			user, err := stores.User.Get(1)
+			g.Assert(err).Equal(nil)
+			g.Assert(auth.CheckPasswordHash("new_password", user.EncryptedPassword)).IsTrue()
+
+			g.Assert(resetPassword("another_password")).Equal(http.StatusOK)
+		})
+
 		g.It("Invalid Password-Reset-Token is denied", func() {
 
 			w = tape.Post("/api/v1/auth/update_password",
@@ -225,6 +794,138 @@ func TestAuth(t *testing.T) {
 			g.Assert(userAfter.ConfirmEmailToken.Valid).Equal(false)
 		})
 
+		g.It("Should log out from all devices", func() {
+			credentials := H{
+				"email":          "test@uni-tuebingen.de",
+				"plain_password": "test",
+			}
+
+			// first device uses tokens
+			w = tape.Post("/api/v1/auth/token", credentials)
+			g.Assert(w.Code).Equal(http.StatusOK)
+			tokens := &AuthResponse{}
+			err := json.NewDecoder(w.Body).Decode(tokens)
+			g.Assert(err).Equal(nil)
+
+			w = tape.Post("/api/v1/auth/token", H{}, bearerRequest{Token: tokens.Refresh.Token})
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			// second device uses a session
+			w = tape.Post("/api/v1/auth/sessions", credentials)
+			g.Assert(w.Code).Equal(http.StatusOK)
+			session := cookieRequest{w.Result().Cookies()}
+
+			w = tape.Get("/api/v1/me", session)
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			w = tape.Delete("/api/v1/auth/sessions/all")
+			g.Assert(w.Code).Equal(http.StatusUnauthorized)
+
+			w = tape.Delete("/api/v1/auth/sessions/all", session)
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			w = tape.Post("/api/v1/auth/token", H{}, bearerRequest{Token: tokens.Refresh.Token})
+			g.Assert(w.Code).Equal(http.StatusForbidden)
+
+			w = tape.Get("/api/v1/me", session)
+			g.Assert(w.Code).Equal(http.StatusUnauthorized)
+
+			// a new login still works
+			time.Sleep(time.Second)
+			w = tape.Post("/api/v1/auth/token", credentials)
+			g.Assert(w.Code).Equal(http.StatusOK)
+			err = json.NewDecoder(w.Body).Decode(tokens)
+			g.Assert(err).Equal(nil)
+
+			w = tape.Post("/api/v1/auth/token", H{}, bearerRequest{Token: tokens.Refresh.Token})
+			g.Assert(w.Code).Equal(http.StatusOK)
+		})
+
+		g.It("Should end sessions which are inactive for too long", func() {
+			before := configuration.Configuration.Server.Authentication.Session.InactivityTimeout
+			configuration.Configuration.Server.Authentication.Session.InactivityTimeout = 500 * time.Millisecond
+			defer func() {
+				configuration.Configuration.Server.Authentication.Session.InactivityTimeout = before
+			}()
+
+			credentials := H{"email": "test@uni-tuebingen.de", "plain_password": "test"}
+
+			w = tape.Post("/api/v1/auth/token", credentials)
+			g.Assert(w.Code).Equal(http.StatusOK)
+			active := &AuthResponse{}
+			err := json.NewDecoder(w.Body).Decode(active)
+			g.Assert(err).Equal(nil)
+
+			w = tape.Post("/api/v1/auth/token", credentials)
+			g.Assert(w.Code).Equal(http.StatusOK)
+			idle := &AuthResponse{}
+			err = json.NewDecoder(w.Body).Decode(idle)
+			g.Assert(err).Equal(nil)
+
+			w = tape.Post("/api/v1/auth/sessions", credentials)
+			g.Assert(w.Code).Equal(http.StatusOK)
+			session := cookieRequest{w.Result().Cookies()}
+
+			// only the first login keeps being used
+			for i := 0; i < 4; i++ {
+				time.Sleep(200 * time.Millisecond)
+				w = tape.Get("/api/v1/me", bearerRequest{Token: active.Access.Token})
+				g.Assert(w.Code).Equal(http.StatusOK)
+			}
+
+			w = tape.Get("/api/v1/me", bearerRequest{Token: idle.Access.Token})
+			g.Assert(w.Code).Equal(http.StatusUnauthorized)
+
+			w = tape.Post("/api/v1/auth/token", H{}, bearerRequest{Token: idle.Refresh.Token})
+			g.Assert(w.Code).Equal(http.StatusForbidden)
+
+			w = tape.Get("/api/v1/me", session)
+			g.Assert(w.Code).Equal(http.StatusUnauthorized)
+
+			// refreshing keeps the session of the active login
+			w = tape.Post("/api/v1/auth/token", H{}, bearerRequest{Token: active.Refresh.Token})
+			g.Assert(w.Code).Equal(http.StatusOK)
+		})
+
+		g.It("Should validate access tokens without side effects", func() {
+			// valid
+			w = tape.Get("/api/v1/auth/validate", tape.NewJWTRequest(1, true))
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			validation := TokenValidationResponse{}
+			err := json.NewDecoder(w.Body).Decode(&validation)
+			g.Assert(err).Equal(nil)
+			g.Assert(validation.LoginID).Equal(int64(1))
+			g.Assert(validation.Root).Equal(true)
+			g.Assert(validation.ExpiresAt.After(time.Now())).IsTrue()
+			g.Assert(validation.ExpiresAt.Before(time.Now().Add(
+				configuration.Configuration.Server.Authentication.JWT.AccessExpiry + time.Minute))).IsTrue()
+
+			// expired
+			claims := authenticate.NewAccessClaims(1, true)
+			claims.IssuedAt = time.Now().Add(-2 * time.Hour).Unix()
+			claims.ExpiresAt = time.Now().Add(-time.Hour).Unix()
+			_, expiredToken, err := tape.TokenAuth.JwtAuth.Encode(claims)
+			g.Assert(err).Equal(nil)
+
+			w = tape.Get("/api/v1/auth/validate", bearerRequest{Token: expiredToken})
+			g.Assert(w.Code).Equal(http.StatusUnauthorized)
+
+			// malformed
+			w = tape.Get("/api/v1/auth/validate", bearerRequest{Token: "not-a-jwt"})
+			g.Assert(w.Code).Equal(http.StatusUnauthorized)
+
+			// refresh tokens are no access tokens
+			refreshToken, err := tape.TokenAuth.CreateRefreshJWT(authenticate.NewRefreshClaims(1))
+			g.Assert(err).Equal(nil)
+			w = tape.Get("/api/v1/auth/validate", bearerRequest{Token: refreshToken})
+			g.Assert(w.Code).Equal(http.StatusUnauthorized)
+
+			// missing
+			w = tape.Get("/api/v1/auth/validate")
+			g.Assert(w.Code).Equal(http.StatusUnauthorized)
+		})
+
 		g.It("Should limit requests per minute to do an login", func() {
 			payload := H{
 				"email":          "test@uni-tuebingen.de",
@@ -239,12 +940,261 @@ func TestAuth(t *testing.T) {
 			g.Assert(w.Code).Equal(http.StatusTooManyRequests)
 		})
 
+		g.It("Should report the state of the rate limit", func() {
+			w := tape.Get("/api/v1/ping")
+			g.Assert(w.Code).Equal(http.StatusOK)
+			limit, err := strconv.ParseInt(w.Header().Get("X-RateLimit-Limit"), 10, 64)
+			g.Assert(err).Equal(nil)
+			remaining, err := strconv.ParseInt(w.Header().Get("X-RateLimit-Remaining"), 10, 64)
+			g.Assert(err).Equal(nil)
+			g.Assert(remaining).Equal(limit - 1)
+			g.Assert(w.Header().Get("X-RateLimit-Reset") != "").IsTrue()
+
+			// every request counts
+			w = tape.Get("/api/v1/ping")
+			g.Assert(w.Code).Equal(http.StatusOK)
+			g.Assert(w.Header().Get("X-RateLimit-Remaining")).Equal(strconv.FormatInt(limit-2, 10))
+
+			// asking for the state does not count
+			for i := 0; i < 2; i++ {
+				w = tape.Get("/api/v1/account/rate_limit_status", tape.NewJWTRequest(112, false))
+				g.Assert(w.Code).Equal(http.StatusOK)
+				g.Assert(w.Header().Get("X-RateLimit-Remaining")).Equal(strconv.FormatInt(limit-2, 10))
+
+				status := RateLimitStatusResponse{}
+				err = json.NewDecoder(w.Body).Decode(&status)
+				g.Assert(err).Equal(nil)
+				g.Assert(status.Limit).Equal(limit)
+				g.Assert(status.Remaining).Equal(limit - 2)
+				g.Assert(status.Reached).IsFalse()
+			}
+
+			w = tape.Get("/api/v1/account/rate_limit_status")
+			g.Assert(w.Code).Equal(http.StatusUnauthorized)
+		})
+
 		g.AfterEach(func() {
 			tape.AfterEach()
 			err := redisClient.Set("infomark-logins:1.2.3.4-infomark-logins", "0", 0).Err()
 			g.Assert(err).Equal(nil)
+			err = redisClient.Del("infomark-login-failures:1.2.3.4").Err()
+			g.Assert(err).Equal(nil)
 		})
 
 	})
 
 }
+
+type cookieRequest struct {
+	Cookies []*http.Cookie
+}
+
+func (t cookieRequest) Modify(r *http.Request) {
+	for _, cookie := range t.Cookies {
+		r.AddCookie(cookie)
+	}
+}
+
+type forwardedFor string
+
+func (t forwardedFor) Modify(r *http.Request) {
+	r.Header.Set("X-Forwarded-For", string(t))
+}
+
+type acceptLanguage string
+
+func (t acceptLanguage) Modify(r *http.Request) {
+	r.Header.Set("Accept-Language", string(t))
+}
+
+type bearerRequest struct {
+	Token string
+}
+
+func (t bearerRequest) Modify(r *http.Request) {
+	r.Header.Add("Authorization", "Bearer "+t.Token)
+}
+
+// enableOIDC points the configuration to a (mock) identity provider and
+// returns a function to restore the previous state.
+func enableOIDC(issuer string, linkExistingAccounts bool) func() {
+	before := configuration.Configuration.Server.Authentication.OIDC
+	configuration.Configuration.Server.Authentication.OIDC.Enabled = true
+	configuration.Configuration.Server.Authentication.OIDC.Issuer = issuer
+	configuration.Configuration.Server.Authentication.OIDC.ClientID = "infomark"
+	configuration.Configuration.Server.Authentication.OIDC.ClientSecret = "secret"
+	configuration.Configuration.Server.Authentication.OIDC.LinkExistingAccounts = linkExistingAccounts
+	return func() {
+		configuration.Configuration.Server.Authentication.OIDC = before
+	}
+}
+
+// newMockOIDCProvider serves a minimal identity provider, which accepts the
+// code "valid" only.
+func newMockOIDCProvider(subject string, emailAddress string) *httptest.Server {
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 server.URL,
+			"authorization_endpoint": server.URL + "/authorize",
+			"token_endpoint":         server.URL + "/token",
+			"userinfo_endpoint":      server.URL + "/userinfo",
+		})
+	})
+
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("code") != "valid" || r.FormValue("client_secret") != "secret" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{
+			"access_token": "mock-access-token",
+			"token_type":   "Bearer",
+		})
+	})
+
+	mux.HandleFunc("/userinfo", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer mock-access-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"sub":            subject,
+			"email":          emailAddress,
+			"email_verified": true,
+			"given_name":     "Max",
+			"family_name":    "Mustermann",
+		})
+	})
+
+	return server
+}
+
+// enableCaptcha requires a captcha from the given (mock) provider after
+// threshold failed logins and returns a function to restore the previous state.
+func enableCaptcha(verifyURL string, threshold int64) func() {
+	before := configuration.Configuration.Server.Authentication.Captcha
+	captchaConfig := &configuration.Configuration.Server.Authentication.Captcha
+	captchaConfig.Enabled = true
+	captchaConfig.Provider = "hcaptcha"
+	captchaConfig.Secret = "secret"
+	captchaConfig.VerifyURL = verifyURL
+	captchaConfig.FailureThreshold = threshold
+	captchaConfig.FailureWindow = time.Minute
+	return func() {
+		configuration.Configuration.Server.Authentication.Captcha = before
+	}
+}
+
+// newMockCaptchaProvider serves a siteverify endpoint, which accepts the
+// given token only.
+func newMockCaptchaProvider(validToken string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		success := r.FormValue("secret") == "secret" && r.FormValue("response") == validToken
+		json.NewEncoder(w).Encode(map[string]bool{"success": success})
+	}))
+}
+
+// enableLDAP points the configuration to a (mock) directory and returns a
+// function to restore the previous state.
+func enableLDAP(addr string, fallbackToLocal bool) func() {
+	before := configuration.Configuration.Server.Authentication.LDAP
+	ldapConfig := &configuration.Configuration.Server.Authentication.LDAP
+	ldapConfig.Enabled = true
+	ldapConfig.URL = "ldap://" + addr
+	ldapConfig.BindDN = "uid=%s,ou=people,dc=uni-tuebingen,dc=de"
+	ldapConfig.Attributes.Email = "mail"
+	ldapConfig.Attributes.FirstName = "givenName"
+	ldapConfig.Attributes.LastName = "sn"
+	ldapConfig.Attributes.StudentNumber = "employeeNumber"
+	ldapConfig.FallbackToLocal = fallbackToLocal
+	return func() {
+		configuration.Configuration.Server.Authentication.LDAP = before
+	}
+}
+
+// newMockLDAPServer accepts simple binds for the given DN-password pairs and
+// answers base searches of the bound DN with a fixed entry.
+func newMockLDAPServer(accounts map[string]string) net.Listener {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(err)
+	}
+
+	ldapResult := func(messageID interface{}, tag ber.Tag, code int64) *ber.Packet {
+		packet := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Response")
+		packet.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, messageID, "MessageID"))
+		result := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "Result")
+		result.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, code, "ResultCode"))
+		result.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "MatchedDN"))
+		result.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "Diagnostic"))
+		packet.AppendChild(result)
+		return packet
+	}
+
+	searchEntry := func(messageID interface{}, dn string) *ber.Packet {
+		packet := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Response")
+		packet.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, messageID, "MessageID"))
+		entry := ber.Encode(ber.ClassApplication, ber.TypeConstructed, 4, nil, "SearchResultEntry")
+		entry.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, dn, "DN"))
+		attributes := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attributes")
+		for _, pair := range [][]string{
+			{"mail", "ldap.student@uni-tuebingen.de"},
+			{"givenName", "Erika"},
+			{"sn", "Musterfrau"},
+			{"employeeNumber", "4711"},
+		} {
+			attribute := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attribute")
+			attribute.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, pair[0], "Type"))
+			values := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "Values")
+			values.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, pair[1], "Value"))
+			attribute.AppendChild(values)
+			attributes.AppendChild(attribute)
+		}
+		entry.AppendChild(attributes)
+		packet.AppendChild(entry)
+		return packet
+	}
+
+	serve := func(conn net.Conn) {
+		defer conn.Close()
+		for {
+			packet, err := ber.ReadPacket(conn)
+			if err != nil || len(packet.Children) < 2 {
+				return
+			}
+			messageID := packet.Children[0].Value
+			request := packet.Children[1]
+
+			switch request.Tag {
+			case 0: // BindRequest
+				dn := request.Children[1].Data.String()
+				password := request.Children[2].Data.String()
+				code := int64(49) // invalid credentials
+				if expected, ok := accounts[dn]; ok && expected == password {
+					code = 0
+				}
+				conn.Write(ldapResult(messageID, 1, code).Bytes())
+			case 3: // SearchRequest
+				conn.Write(searchEntry(messageID, request.Children[0].Data.String()).Bytes())
+				conn.Write(ldapResult(messageID, 5, 0).Bytes())
+			default: // UnbindRequest and everything else
+				return
+			}
+		}
+	}
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serve(conn)
+		}
+	}()
+
+	return listener
+}
@@ -0,0 +1,56 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package app
+
+import (
+	"github.com/infomark-org/infomark/auth/authorize"
+	"github.com/infomark-org/infomark/configuration"
+	"github.com/infomark-org/infomark/event"
+	"github.com/infomark-org/infomark/model"
+	"github.com/sirupsen/logrus"
+)
+
+// autoEnrollUser enrolls a newly confirmed user as a student into all courses
+// listed in the configuration. Courses the user is already part of are
+// skipped, unknown courses are logged and skipped as well.
+func autoEnrollUser(bus *event.Bus, stores *Stores, user *model.User) error {
+	for _, courseID := range configuration.Configuration.Server.Registration.AutoEnrollCourses {
+		if _, err := stores.Course.Get(courseID); err != nil {
+			logrus.WithFields(logrus.Fields{
+				"module":    "app",
+				"course_id": courseID,
+			}).Warn("cannot auto-enroll into unknown course")
+			continue
+		}
+
+		if _, err := stores.Course.GetUserEnrollment(courseID, user.ID); err == nil {
+			continue
+		}
+
+		if err := stores.Course.Enroll(courseID, user.ID, int64(authorize.STUDENT)); err != nil {
+			return err
+		}
+
+		enrollment, err := stores.Course.GetUserEnrollment(courseID, user.ID)
+		if err != nil {
+			return err
+		}
+		bus.Publish(event.EnrollmentCreated{CourseID: courseID, Enrollment: enrollment})
+	}
+	return nil
+}
@@ -0,0 +1,170 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/middleware"
+	"github.com/infomark-org/infomark/configuration/bytefmt"
+	"github.com/sirupsen/logrus"
+)
+
+// redactedFields are always hidden from the body log, even if not configured.
+// As field names are matched by substring, "key" also covers API keys and
+// "code" covers TOTP, recovery and enrollment codes.
+var redactedFields = []string{"password", "token", "secret", "key", "code"}
+
+// redactedValues hide string values containing credentials regardless of the
+// field name, e.g. the "otpauth_url" of a TOTP enrollment or a calendar "url"
+// carrying its token.
+var redactedValues = []string{"otpauth:", "secret=", "token="}
+
+// NewBodyLogger creates a middleware which logs the JSON bodies of requests and
+// responses for debugging purposes. The values of all fields whose name
+// contains one of the given names (case-insensitive) are redacted. Bodies
+// larger than maxSize bytes (default 16kb) are not logged at all, as they cannot be redacted
+// reliably.
+func NewBodyLogger(out io.Writer, redact []string, maxSize int64) func(next http.Handler) http.Handler {
+	logger := logrus.New()
+	logger.Out = out
+	logger.SetFormatter(&logrus.TextFormatter{
+		DisableColors: false,
+		FullTimestamp: true,
+	})
+
+	if maxSize <= 0 {
+		maxSize = int64(16 * bytefmt.Kilobyte)
+	}
+
+	redact = append(append([]string{}, redactedFields...), redact...)
+	for k := range redact {
+		redact[k] = strings.ToLower(redact[k])
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			entry := logger.WithFields(logrus.Fields{
+				"request_id": middleware.GetReqID(r.Context()),
+				"method":     r.Method,
+				"path":       r.URL.Path,
+			})
+
+			if r.Body != nil && isJSON(r.Header.Get("Content-Type")) {
+				// read at most maxSize+1 bytes and hand everything to the handler
+				head, err := ioutil.ReadAll(io.LimitReader(r.Body, maxSize+1))
+				if err != nil {
+					entry.Error(err)
+				}
+				r.Body = ioutil.NopCloser(io.MultiReader(bytes.NewReader(head), r.Body))
+
+				entry.WithField("body", redactBody(head, redact, maxSize)).Info("request")
+			}
+
+			response := &cappedBuffer{limit: maxSize + 1}
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			ww.Tee(response)
+
+			next.ServeHTTP(ww, r)
+
+			if isJSON(ww.Header().Get("Content-Type")) {
+				entry.WithFields(logrus.Fields{
+					"status": ww.Status(),
+					"body":   redactBody(response.Bytes(), redact, maxSize),
+				}).Info("response")
+			}
+		})
+	}
+}
+
+func isJSON(contentType string) bool {
+	return strings.HasPrefix(contentType, "application/json")
+}
+
+// redactBody returns a loggable representation of a JSON body.
+func redactBody(body []byte, redact []string, maxSize int64) string {
+	if int64(len(body)) > maxSize {
+		return fmt.Sprintf("<omitted, more than %d bytes>", maxSize)
+	}
+
+	var data interface{}
+	if err := json.Unmarshal(body, &data); err != nil {
+		return "<omitted, invalid json>"
+	}
+
+	redacted, err := json.Marshal(redactValue(data, redact))
+	if err != nil {
+		return "<omitted, invalid json>"
+	}
+	return string(redacted)
+}
+
+func redactValue(value interface{}, redact []string) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			if isRedacted(key, redact) {
+				v[key] = "[REDACTED]"
+			} else {
+				v[key] = redactValue(child, redact)
+			}
+		}
+	case []interface{}:
+		for k, child := range v {
+			v[k] = redactValue(child, redact)
+		}
+	case string:
+		if isRedacted(v, redactedValues) {
+			return "[REDACTED]"
+		}
+	}
+	return value
+}
+
+func isRedacted(key string, redact []string) bool {
+	key = strings.ToLower(key)
+	for _, name := range redact {
+		if strings.Contains(key, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// cappedBuffer keeps only the first bytes written to it.
+type cappedBuffer struct {
+	bytes.Buffer
+	limit int64
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	if remaining := b.limit - int64(b.Len()); remaining > 0 {
+		if int64(len(p)) > remaining {
+			b.Buffer.Write(p[:remaining])
+		} else {
+			b.Buffer.Write(p)
+		}
+	}
+	return len(p), nil
+}
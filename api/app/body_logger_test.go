@@ -0,0 +1,120 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package app
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/franela/goblin"
+)
+
+func TestBodyLogger(t *testing.T) {
+
+	g := goblin.Goblin(t)
+
+	g.Describe("BodyLogger", func() {
+
+		g.It("Should redact passwords from request bodies", func() {
+			out := &bytes.Buffer{}
+			received := ""
+			handler := NewBodyLogger(out, []string{"student_number"}, 1024)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := ioutil.ReadAll(r.Body)
+				received = string(body)
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(`{"access_token":"secret-jwt","root":false}`))
+			}))
+
+			payload := `{"email":"test@uni-tuebingen.de","plain_password":"my-secret","user":{"student_number":"0815"}}`
+			r := httptest.NewRequest("POST", "/api/v1/auth/sessions", strings.NewReader(payload))
+			r.Header.Set("Content-Type", "application/json")
+			handler.ServeHTTP(httptest.NewRecorder(), r)
+
+			// the handler still sees the original body
+			g.Assert(received).Equal(payload)
+
+			log := out.String()
+			g.Assert(strings.Contains(log, "test@uni-tuebingen.de")).IsTrue()
+			g.Assert(strings.Contains(log, "[REDACTED]")).IsTrue()
+			g.Assert(strings.Contains(log, "my-secret")).IsFalse()
+			g.Assert(strings.Contains(log, "0815")).IsFalse()
+			g.Assert(strings.Contains(log, "secret-jwt")).IsFalse()
+		})
+
+		g.It("Should redact keys and codes without configuration", func() {
+			out := &bytes.Buffer{}
+			handler := NewBodyLogger(out, nil, 1024)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(`{"key":"api-key-value","recovery_codes":["recovery-1","recovery-2"]}`))
+			}))
+
+			payload := `{"totp_code":"123456","enrollment_code":"join-me","name":"my key"}`
+			r := httptest.NewRequest("POST", "/api/v1/account/totp", strings.NewReader(payload))
+			r.Header.Set("Content-Type", "application/json")
+			handler.ServeHTTP(httptest.NewRecorder(), r)
+
+			log := out.String()
+			g.Assert(strings.Contains(log, "my key")).IsTrue()
+			g.Assert(strings.Contains(log, "123456")).IsFalse()
+			g.Assert(strings.Contains(log, "join-me")).IsFalse()
+			g.Assert(strings.Contains(log, "api-key-value")).IsFalse()
+			g.Assert(strings.Contains(log, "recovery-1")).IsFalse()
+		})
+
+		g.It("Should redact urls carrying credentials", func() {
+			out := &bytes.Buffer{}
+			handler := NewBodyLogger(out, nil, 1024)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(`{"otpauth_url":"otpauth://totp/InfoMark?secret=TOTPSECRET","url":"https://infomark.org/calendar.ics?token=CALTOKEN","homepage":"https://infomark.org"}`))
+			}))
+
+			r := httptest.NewRequest("POST", "/api/v1/account/totp", strings.NewReader(`{}`))
+			r.Header.Set("Content-Type", "application/json")
+			handler.ServeHTTP(httptest.NewRecorder(), r)
+
+			log := out.String()
+			g.Assert(strings.Contains(log, "TOTPSECRET")).IsFalse()
+			g.Assert(strings.Contains(log, "CALTOKEN")).IsFalse()
+			g.Assert(strings.Contains(log, "https://infomark.org")).IsTrue()
+		})
+
+		g.It("Should not log bodies exceeding the size cap", func() {
+			out := &bytes.Buffer{}
+			received := ""
+			handler := NewBodyLogger(out, nil, 16)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := ioutil.ReadAll(r.Body)
+				received = string(body)
+			}))
+
+			payload := `{"name":"a very long course name"}`
+			r := httptest.NewRequest("POST", "/api/v1/courses", strings.NewReader(payload))
+			r.Header.Set("Content-Type", "application/json")
+			handler.ServeHTTP(httptest.NewRecorder(), r)
+
+			g.Assert(received).Equal(payload)
+			g.Assert(strings.Contains(out.String(), "a very long course name")).IsFalse()
+			g.Assert(strings.Contains(out.String(), "omitted")).IsTrue()
+		})
+
+	})
+
+}
@@ -0,0 +1,90 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2019 ComputerGraphics Tuebingen
+//               2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package app
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/infomark-org/infomark/model"
+)
+
+// The deadlines of a user are published as an iCalendar feed (RFC 5545), such
+// that calendar apps can subscribe to them.
+
+// icalTime formats a time as UTC date-time of iCalendar.
+func icalTime(t time.Time) string {
+	return t.UTC().Format("20060102T150405Z")
+}
+
+// icalEscape escapes the special characters of a text value.
+var icalEscape = strings.NewReplacer(
+	`\`, `\\`,
+	";", `\;`,
+	",", `\,`,
+	"\r\n", `\n`,
+	"\n", `\n`,
+)
+
+// writeICalLine writes a content line terminated by CRLF. Lines longer than 75
+// octets are folded without splitting UTF-8 sequences.
+func writeICalLine(w io.Writer, line string) {
+	buf := &bytes.Buffer{}
+	width := 0
+	for _, r := range line {
+		size := len(string(r))
+		if width+size > 75 {
+			buf.WriteString("\r\n ")
+			width = 1
+		}
+		buf.WriteRune(r)
+		width += size
+	}
+	buf.WriteString("\r\n")
+	w.Write(buf.Bytes())
+}
+
+// writeDeadlineCalendar writes the deadlines of a user as iCalendar. Every
+// deadline is an event without duration at the due date of the sheet.
+func writeDeadlineCalendar(w io.Writer, user *model.User, deadlines []model.Deadline, domain string, now time.Time) {
+	writeICalLine(w, "BEGIN:VCALENDAR")
+	writeICalLine(w, "VERSION:2.0")
+	writeICalLine(w, "PRODID:-//InfoMark//Deadlines//EN")
+	writeICalLine(w, "CALSCALE:GREGORIAN")
+	writeICalLine(w, "METHOD:PUBLISH")
+	writeICalLine(w, "X-WR-CALNAME:"+icalEscape.Replace("InfoMark deadlines"))
+
+	for _, deadline := range deadlines {
+		writeICalLine(w, "BEGIN:VEVENT")
+		// stable such that calendar apps update moved deadlines
+		writeICalLine(w, fmt.Sprintf("UID:sheet-%d-user-%d@%s", deadline.SheetID, user.ID, domain))
+		writeICalLine(w, "DTSTAMP:"+icalTime(now))
+		writeICalLine(w, "DTSTART:"+icalTime(deadline.DueAt))
+		writeICalLine(w, "DTEND:"+icalTime(deadline.DueAt))
+		writeICalLine(w, "SUMMARY:"+icalEscape.Replace(
+			fmt.Sprintf("%s: %s due", deadline.CourseName, deadline.SheetName)))
+		writeICalLine(w, "END:VEVENT")
+	}
+
+	writeICalLine(w, "END:VCALENDAR")
+}
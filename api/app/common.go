@@ -20,14 +20,20 @@
 package app
 
 import (
+	"crypto/sha1"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-chi/render"
+	"github.com/infomark-org/infomark/api/helper"
 	"github.com/infomark-org/infomark/auth/authorize"
 	"github.com/infomark-org/infomark/configuration"
+	"github.com/infomark-org/infomark/configuration/bytefmt"
 	"github.com/infomark-org/infomark/model"
 )
 
@@ -69,6 +75,25 @@ func (rs *CommonResource) VersionHandler(w http.ResponseWriter, r *http.Request)
 	render.Status(r, http.StatusOK)
 }
 
+// ConfigHandler is public endpoint for
+// URL: /config
+// METHOD: get
+// TAG: common
+// RESPONSE: 200,ServerConfigResponse
+// SUMMARY:  the optional features enabled on this server
+// DESCRIPTION:
+// This lets the front-end hide features which are not available. Only settings
+// which are safe to share are included, never any secrets.
+func (rs *CommonResource) ConfigHandler(w http.ResponseWriter, r *http.Request) {
+	// render JSON response
+	if err := render.Render(w, r, newServerConfigResponse(&configuration.Configuration.Server)); err != nil {
+		render.Render(w, r, ErrRender(err))
+		return
+	}
+
+	render.Status(r, http.StatusOK)
+}
+
 // PrivacyStatementHandler is public endpoint for
 // URL: /privacy_statement
 // METHOD: get
@@ -126,8 +151,175 @@ func OverTime(t time.Time) bool {
 	return NowUTC().Sub(t) > 0
 }
 
+// Warnings collects non-fatal hints about a request, e.g. values which are
+// valid but probably a mistake. They are returned alongside a successful
+// response and never block the request.
+type Warnings []string
+
+// Add appends a formatted warning.
+func (w *Warnings) Add(format string, a ...interface{}) {
+	*w = append(*w, fmt.Sprintf(format, a...))
+}
+
 // NowUTC returns the current server time
 func NowUTC() time.Time {
 	loc, _ := time.LoadLocation("UTC")
 	return time.Now().In(loc)
 }
+
+// AppendChunk stages a chunk of a chunked upload. It returns true if the file
+// is complete. Otherwise the response has already been written and the handler
+// should return.
+func AppendChunk(w http.ResponseWriter, r *http.Request, chunks *helper.ChunkedUpload, maxBytes bytefmt.ByteSize) bool {
+	complete, err := chunks.Append(r, "file_data", maxBytes)
+	if !complete {
+		// tell the client where to resume
+		if received := chunks.RangeHeader(); received != "" {
+			w.Header().Set("Range", received)
+		}
+	}
+
+	if err != nil {
+		render.Render(w, r, ErrBadRequestWithDetails(err))
+		return false
+	}
+
+	if !complete {
+		w.WriteHeader(http.StatusAccepted)
+	}
+	return complete
+}
+
+// WeakETag derives a weak entity tag from a value identifying the state of a
+// resource.
+func WeakETag(fingerprint string) string {
+	return fmt.Sprintf("W/\"%x\"", sha1.Sum([]byte(fingerprint)))
+}
+
+// StrongETag derives a strong entity tag from the checksum of a file.
+func StrongETag(checksum string) string {
+	return fmt.Sprintf("\"%s\"", checksum)
+}
+
+// fileNotModified sets the content-hash ETag of a file and reports whether the
+// client already has this version. In this case the request has been answered
+// with 304 Not Modified.
+func fileNotModified(w http.ResponseWriter, r *http.Request, hnd *helper.FileHandle) bool {
+	if !configuration.Configuration.Server.HTTP.FileETags {
+		return false
+	}
+
+	checksum, err := hnd.Checksum()
+	if err != nil {
+		// the file can still be served without an ETag
+		return false
+	}
+
+	etag := StrongETag(checksum)
+	w.Header().Set("ETag", etag)
+	if ETagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return true
+	}
+	return false
+}
+
+// ETagMatches reports whether the "If-None-Match" header contains the given
+// tag using the weak comparison function (RFC 7232).
+func ETagMatches(ifNoneMatch string, etag string) bool {
+	if strings.TrimSpace(ifNoneMatch) == "*" {
+		return true
+	}
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(candidate), "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+// Pagination is the part of a list requested by the query parameters "page"
+// (starting at 1) and "per_page".
+type Pagination struct {
+	Page    int
+	PerPage int
+}
+
+// PaginationFromURL reads the requested page. Lists are only paginated when
+// "per_page" is given, otherwise it returns nil.
+func PaginationFromURL(r *http.Request) (*Pagination, error) {
+	if r.FormValue("per_page") == "" {
+		return nil, nil
+	}
+
+	p := &Pagination{
+		Page:    helper.IntFromURL(r, "page", 0),
+		PerPage: helper.IntFromURL(r, "per_page", 0),
+	}
+	if r.FormValue("page") == "" {
+		p.Page = 1
+	}
+	if p.Page < 1 || p.PerPage < 1 {
+		return nil, errors.New("page and per_page must be positive integers")
+	}
+	return p, nil
+}
+
+// Bounds returns the range of the page within a list of the given length.
+func (p *Pagination) Bounds(total int) (int, int) {
+	from := (p.Page - 1) * p.PerPage
+	if from > total {
+		from = total
+	}
+	to := from + p.PerPage
+	if to > total {
+		to = total
+	}
+	return from, to
+}
+
+// Offset returns the number of list items before the page.
+func (p *Pagination) Offset() int {
+	return (p.Page - 1) * p.PerPage
+}
+
+// LastPage returns the number of the last page of a list of the given length.
+func (p *Pagination) LastPage(total int) int {
+	if total == 0 {
+		return 1
+	}
+	return (total + p.PerPage - 1) / p.PerPage
+}
+
+// WriteLinkHeader adds the links to the neighbouring pages (RFC 5988). All
+// other query parameters of the request are kept. The page is also reported
+// in the meta data of enveloped responses.
+func (p *Pagination) WriteLinkHeader(w http.ResponseWriter, r *http.Request, total int) {
+	setPaginationMeta(r, &PaginationMeta{
+		Page:     p.Page,
+		PerPage:  p.PerPage,
+		Total:    total,
+		LastPage: p.LastPage(total),
+	})
+
+	link := func(page int, rel string) string {
+		u := *r.URL
+		query := u.Query()
+		query.Set("page", strconv.Itoa(page))
+		query.Set("per_page", strconv.Itoa(p.PerPage))
+		u.RawQuery = query.Encode()
+		return fmt.Sprintf("<%s>; rel=\"%s\"", u.RequestURI(), rel)
+	}
+
+	last := p.LastPage(total)
+	links := []string{link(1, "first")}
+	if p.Page > 1 {
+		links = append(links, link(p.Page-1, "prev"))
+	}
+	if p.Page < last {
+		links = append(links, link(p.Page+1, "next"))
+	}
+	links = append(links, link(last, "last"))
+
+	w.Header().Set("Link", strings.Join(links, ", "))
+}
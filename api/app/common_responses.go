@@ -22,6 +22,7 @@ package app
 import (
 	"net/http"
 
+	"github.com/infomark-org/infomark/configuration"
 	"github.com/infomark-org/infomark/symbol"
 )
 
@@ -60,3 +61,64 @@ func newVersionResponse() *VersionResponse {
 func (body *VersionResponse) Render(w http.ResponseWriter, r *http.Request) error {
 	return nil
 }
+
+// ServerConfigResponse is the response payload describing the features of the
+// server. It is curated by hand such that no secret ends up here.
+type ServerConfigResponse struct {
+	Registration struct {
+		Open        bool     `json:"open" example:"true"`
+		MaxSemester int      `json:"max_semester" example:"30"`
+		Subjects    []string `json:"subjects" example:"Informatik"`
+	} `json:"registration"`
+	Authentication struct {
+		EmailVerification  bool   `json:"email_verification" example:"true"`
+		OIDC               bool   `json:"oidc" example:"false"`
+		LDAP               bool   `json:"ldap" example:"false"`
+		TwoFactor          bool   `json:"two_factor" example:"true"`
+		Captcha            bool   `json:"captcha" example:"false"`
+		CaptchaProvider    string `json:"captcha_provider,omitempty" example:"hcaptcha"`
+		PasswordMinLength  int    `json:"password_min_length" example:"7"`
+		AllowStudentNumber bool   `json:"allow_student_number" example:"false"`
+	} `json:"authentication"`
+	Limits struct {
+		MaxSubmission int64 `json:"max_submission" example:"4194304"`
+		MaxAvatar     int64 `json:"max_avatar" example:"1048576"`
+	} `json:"limits"`
+	DefaultLanguage string `json:"default_language" example:"en"`
+}
+
+// newServerConfigResponse picks the shareable settings from the configuration.
+func newServerConfigResponse(config *configuration.ServerConfigurationSchema) *ServerConfigResponse {
+	resp := &ServerConfigResponse{}
+
+	resp.Registration.Open = config.Registration.Open
+	resp.Registration.MaxSemester = config.Registration.MaxSemester
+	resp.Registration.Subjects = config.Registration.Subjects
+	if resp.Registration.Subjects == nil {
+		resp.Registration.Subjects = []string{}
+	}
+
+	authentication := &config.Authentication
+	resp.Authentication.EmailVerification = authentication.Email.Verify
+	resp.Authentication.OIDC = authentication.OIDC.Enabled
+	resp.Authentication.LDAP = authentication.LDAP.Enabled
+	// secrets of second factors are encrypted, without a key there is no 2FA
+	resp.Authentication.TwoFactor = authentication.TwoFactor.Secret != ""
+	resp.Authentication.Captcha = authentication.Captcha.Enabled
+	if authentication.Captcha.Enabled {
+		resp.Authentication.CaptchaProvider = authentication.Captcha.Provider
+	}
+	resp.Authentication.PasswordMinLength = authentication.Password.MinLength
+	resp.Authentication.AllowStudentNumber = authentication.Login.AllowStudentNumber
+
+	resp.Limits.MaxSubmission = int64(config.HTTP.Limits.MaxSubmission)
+	resp.Limits.MaxAvatar = int64(config.HTTP.Limits.MaxAvatar)
+
+	resp.DefaultLanguage = config.DefaultLanguage
+	return resp
+}
+
+// Render post-processes a ServerConfigResponse.
+func (body *ServerConfigResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
@@ -20,11 +20,16 @@
 package app
 
 import (
+	"encoding/json"
 	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/franela/goblin"
+	"github.com/infomark-org/infomark/configuration"
+	"github.com/infomark-org/infomark/configuration/bytefmt"
 )
 
 func TestCommon(t *testing.T) {
@@ -46,6 +51,51 @@ func TestCommon(t *testing.T) {
 
 		})
 
+		g.It("Should expose the enabled features but no secrets", func() {
+			config := &configuration.Configuration.Server
+			before := *config
+			defer func() { *config = before }()
+
+			config.Registration.Open = false
+			config.Authentication.OIDC.Enabled = true
+			config.Authentication.OIDC.ClientSecret = "oidc-client-secret"
+			config.Authentication.Captcha.Enabled = true
+			config.Authentication.Captcha.Provider = "recaptcha"
+			config.Authentication.Captcha.Secret = "captcha-secret"
+			config.HTTP.Limits.MaxSubmission = 2 * bytefmt.Megabyte
+
+			w := tape.Get("/api/v1/config")
+			g.Assert(w.Code).Equal(http.StatusOK)
+			g.Assert(strings.Contains(w.Body.String(), "secret\"")).IsFalse()
+			g.Assert(strings.Contains(w.Body.String(), config.Authentication.JWT.Secret)).IsFalse()
+
+			resp := &ServerConfigResponse{}
+			err := json.NewDecoder(w.Body).Decode(resp)
+			g.Assert(err).Equal(nil)
+			g.Assert(resp.Registration.Open).IsFalse()
+			g.Assert(resp.Authentication.OIDC).IsTrue()
+			g.Assert(resp.Authentication.LDAP).Equal(config.Authentication.LDAP.Enabled)
+			g.Assert(resp.Authentication.TwoFactor).IsTrue()
+			g.Assert(resp.Authentication.Captcha).IsTrue()
+			g.Assert(resp.Authentication.CaptchaProvider).Equal("recaptcha")
+			g.Assert(resp.Limits.MaxSubmission).Equal(int64(2 * bytefmt.Megabyte))
+
+			// closed registration rejects new accounts
+			w = tape.Post("/api/v1/account", H{})
+			g.Assert(w.Code).Equal(http.StatusForbidden)
+		})
+
+		g.It("Should negotiate the language", func() {
+			r := httptest.NewRequest("GET", "/", nil)
+			g.Assert(NegotiateLanguage(r)).Equal(DefaultLanguage())
+
+			r.Header.Set("Accept-Language", "fr-CH, fr;q=0.9, de-DE;q=0.7, en;q=0.8")
+			g.Assert(NegotiateLanguage(r)).Equal("en")
+
+			r.Header.Set("Accept-Language", "fr, *;q=0.5")
+			g.Assert(NegotiateLanguage(r)).Equal(DefaultLanguage())
+		})
+
 		g.It("Too late is too late", func() {
 
 			now := NowUTC()
@@ -61,6 +111,25 @@ func TestCommon(t *testing.T) {
 
 		})
 
+		g.It("Should compute the bounds of pages", func() {
+			p := &Pagination{Page: 2, PerPage: 10}
+
+			from, to := p.Bounds(25)
+			g.Assert(from).Equal(10)
+			g.Assert(to).Equal(20)
+			g.Assert(p.LastPage(25)).Equal(3)
+
+			from, to = p.Bounds(15)
+			g.Assert(from).Equal(10)
+			g.Assert(to).Equal(15)
+
+			// beyond the list
+			from, to = p.Bounds(5)
+			g.Assert(from).Equal(5)
+			g.Assert(to).Equal(5)
+			g.Assert(p.LastPage(0)).Equal(1)
+		})
+
 		g.AfterEach(func() {
 			tape.AfterEach()
 		})
@@ -21,36 +21,66 @@ package app
 
 import (
 	"context"
+	"crypto/subtle"
+	"encoding/csv"
 	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/go-chi/chi"
 	"github.com/go-chi/render"
 	"github.com/infomark-org/infomark/api/helper"
+	"github.com/infomark-org/infomark/auth"
 	"github.com/infomark-org/infomark/auth/authenticate"
 	"github.com/infomark-org/infomark/auth/authorize"
 	"github.com/infomark-org/infomark/configuration"
 	"github.com/infomark-org/infomark/email"
+	"github.com/infomark-org/infomark/event"
 	"github.com/infomark-org/infomark/model"
 	"github.com/infomark-org/infomark/symbol"
+	null "gopkg.in/guregu/null.v3"
 )
 
 // CourseResource specifies course management handler.
 type CourseResource struct {
 	Stores *Stores
+	Events *event.Bus
 }
 
 // NewCourseResource create and returns a CourseResource.
-func NewCourseResource(stores *Stores) *CourseResource {
+func NewCourseResource(stores *Stores, events *event.Bus) *CourseResource {
 	return &CourseResource{
 		Stores: stores,
+		Events: events,
 	}
 }
 
+// courseRolesByName maps the names used in query parameters to course roles.
+var courseRolesByName = map[string]authorize.CourseRole{
+	"student": authorize.STUDENT,
+	"tutor":   authorize.TUTOR,
+	"admin":   authorize.ADMIN,
+}
+
+// courseRoleName is the inverse of courseRolesByName.
+func courseRoleName(role authorize.CourseRole) string {
+	for name, r := range courseRolesByName {
+		if r == role {
+			return name
+		}
+	}
+	return "unknown"
+}
+
 // IndexHandler is public endpoint for
 // URL: /courses
+// QUERYPARAM: role,string
+// QUERYPARAM: page,integer
+// QUERYPARAM: per_page,integer
+// QUERYPARAM: fields,string
 // METHOD: get
 // TAG: courses
 // RESPONSE: 200,CourseResponseList
@@ -58,9 +88,69 @@ func NewCourseResource(stores *Stores) *CourseResource {
 // RESPONSE: 401,Unauthenticated
 // RESPONSE: 403,Unauthorized
 // SUMMARY:  list all courses
+// DESCRIPTION:
+// The role ("student", "tutor" or "admin") restricts the list to courses in
+// which the request identity is enrolled with this role. If "per_page" is
+// given, only this page is returned and the "Link" header points to the other
+// pages. A comma-separated list "fields" (e.g. "id,name") restricts the
+// courses to these fields.
 func (rs *CourseResource) IndexHandler(w http.ResponseWriter, r *http.Request) {
-	// fetch collection of courses from database
-	courses, err := rs.Stores.Course.GetAll()
+	var courses []model.Course
+
+	pagination, err := PaginationFromURL(r)
+	if err != nil {
+		render.Render(w, r, ErrBadRequestWithDetails(err))
+		return
+	}
+
+	filterRole := helper.StringFromURL(r, "role", "")
+	if filterRole == "" {
+		// fetch collection of courses from database
+		courses, err = rs.Stores.Course.GetAll()
+	} else {
+		role, ok := courseRolesByName[filterRole]
+		if !ok {
+			render.Render(w, r, ErrBadRequestWithDetails(
+				fmt.Errorf("role '%s' must be one of 'student', 'tutor', 'admin'", filterRole)))
+			return
+		}
+
+		accessClaims := r.Context().Value(symbol.CtxKeyAccessClaims).(*authenticate.AccessClaims)
+		courses, err = rs.Stores.Course.CoursesOfUserWithRole(accessClaims.LoginID, role.ToInt())
+	}
+	if err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
+	if pagination != nil {
+		pagination.WriteLinkHeader(w, r, len(courses))
+		from, to := pagination.Bounds(len(courses))
+		courses = courses[from:to]
+	}
+
+	// render JSON response
+	if err = render.RenderList(w, r, rs.newCourseListResponse(courses)); err != nil {
+		render.Render(w, r, ErrRender(err))
+		return
+	}
+}
+
+// IndexAvailableHandler is public endpoint for
+// URL: /courses/available
+// METHOD: get
+// TAG: courses
+// RESPONSE: 200,CourseResponseList
+// RESPONSE: 400,BadRequest
+// RESPONSE: 401,Unauthenticated
+// SUMMARY:  list all courses the request identity can enroll in
+// DESCRIPTION:
+// These are the courses the request identity is not enrolled in, whose
+// enrollment period is open and which have not reached "max_students" yet.
+func (rs *CourseResource) IndexAvailableHandler(w http.ResponseWriter, r *http.Request) {
+	accessClaims := r.Context().Value(symbol.CtxKeyAccessClaims).(*authenticate.AccessClaims)
+
+	courses, err := rs.Stores.Course.AvailableForUser(accessClaims.LoginID, NowUTC())
 	if err != nil {
 		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
 		return
@@ -99,6 +189,16 @@ func (rs *CourseResource) CreateHandler(w http.ResponseWriter, r *http.Request)
 	course.BeginsAt = data.BeginsAt
 	course.EndsAt = data.EndsAt
 	course.RequiredPercentage = data.RequiredPercentage
+	course.SubmissionRetentionDays = data.SubmissionRetentionDays
+	course.EmailFrom = data.EmailFrom
+	course.ReplyTo = data.ReplyTo
+	course.EmailSubjectPrefix = data.EmailSubjectPrefix
+	course.DisenrollUntil = data.DisenrollUntil
+	course.HonorCode = data.HonorCode
+	course.AnonymousGrading = data.AnonymousGrading
+	course.EnrollmentBeginsAt = data.EnrollmentBeginsAt
+	course.EnrollmentEndsAt = data.EnrollmentEndsAt
+	course.MaxStudents = data.MaxStudents
 
 	// create course entry in database
 	newCourse, err := rs.Stores.Course.Create(course)
@@ -155,6 +255,10 @@ func (rs *CourseResource) GetHandler(w http.ResponseWriter, r *http.Request) {
 // RESPONSE: 401,Unauthenticated
 // RESPONSE: 403,Unauthorized
 // SUMMARY:  update a specific course
+// DESCRIPTION:
+// If "anonymous_grading" is set, tutors see a pseudonym instead of the
+// students in submissions and grades until the grades of the sheet are
+// published.
 func (rs *CourseResource) EditHandler(w http.ResponseWriter, r *http.Request) {
 	// start from empty Request
 	data := &CourseRequest{}
@@ -171,6 +275,16 @@ func (rs *CourseResource) EditHandler(w http.ResponseWriter, r *http.Request) {
 	course.BeginsAt = data.BeginsAt
 	course.EndsAt = data.EndsAt
 	course.RequiredPercentage = data.RequiredPercentage
+	course.SubmissionRetentionDays = data.SubmissionRetentionDays
+	course.EmailFrom = data.EmailFrom
+	course.ReplyTo = data.ReplyTo
+	course.EmailSubjectPrefix = data.EmailSubjectPrefix
+	course.DisenrollUntil = data.DisenrollUntil
+	course.HonorCode = data.HonorCode
+	course.AnonymousGrading = data.AnonymousGrading
+	course.EnrollmentBeginsAt = data.EnrollmentBeginsAt
+	course.EnrollmentEndsAt = data.EnrollmentEndsAt
+	course.MaxStudents = data.MaxStudents
 
 	// update database entry
 	if err := rs.Stores.Course.Update(course); err != nil {
@@ -218,6 +332,8 @@ func (rs *CourseResource) DeleteHandler(w http.ResponseWriter, r *http.Request)
 // QUERYPARAM: subject,string
 // QUERYPARAM: language,string
 // QUERYPARAM: q,string
+// QUERYPARAM: page,integer
+// QUERYPARAM: per_page,integer
 // METHOD: get
 // TAG: enrollments
 // RESPONSE: 200,EnrollmentResponseList
@@ -229,10 +345,18 @@ func (rs *CourseResource) DeleteHandler(w http.ResponseWriter, r *http.Request)
 // If the query 'q' parameter is given this endpoints returns all users which matches the query
 // by first_name, last_name or email. The 'q' does not need be wrapped by '%'. But all other query strings
 // do need to be wrapped by '%' to indicated end and start of a string.
+// Enrollments are sorted by last and first name. If "per_page" is given, only
+// this page is returned and the "Link" header points to the other pages.
 func (rs *CourseResource) IndexEnrollmentsHandler(w http.ResponseWriter, r *http.Request) {
 	// /courses/1/enrollments?roles=0,1
 	course := r.Context().Value(symbol.CtxKeyCourse).(*model.Course)
 
+	pagination, err := PaginationFromURL(r)
+	if err != nil {
+		render.Render(w, r, ErrBadRequestWithDetails(err))
+		return
+	}
+
 	filterQuery := helper.StringFromURL(r, "q", "")
 
 	// extract filters
@@ -250,10 +374,7 @@ func (rs *CourseResource) IndexEnrollmentsHandler(w http.ResponseWriter, r *http
 		filterRoles = []string{"1", "2"}
 	}
 
-	var (
-		enrolledUsers []model.UserCourse
-		err           error
-	)
+	var enrolledUsers []model.UserCourse
 
 	if filterQuery != "" {
 		filterQuery = fmt.Sprintf("%%%s%%", filterQuery)
@@ -273,6 +394,12 @@ func (rs *CourseResource) IndexEnrollmentsHandler(w http.ResponseWriter, r *http
 		return
 	}
 
+	if pagination != nil {
+		pagination.WriteLinkHeader(w, r, len(enrolledUsers))
+		from, to := pagination.Bounds(len(enrolledUsers))
+		enrolledUsers = enrolledUsers[from:to]
+	}
+
 	enrolledUsers = EnsurePrivacyInEnrollments(enrolledUsers, givenRole)
 
 	// render JSON response
@@ -284,6 +411,218 @@ func (rs *CourseResource) IndexEnrollmentsHandler(w http.ResponseWriter, r *http
 	render.Status(r, http.StatusOK)
 }
 
+// RosterHandler is public endpoint for
+// URL: /courses/{course_id}/roster.csv
+// URLPARAM: course_id,integer
+// QUERYPARAM: group_id,integer
+// METHOD: get
+// TAG: enrollments
+// RESPONSE: 200,CSVFile
+// RESPONSE: 400,BadRequest
+// RESPONSE: 401,Unauthenticated
+// RESPONSE: 403,Unauthorized
+// SUMMARY:  export all enrollments of a course as CSV
+// DESCRIPTION:
+// The columns are name, email, student number, role and enrollment date. Student
+// numbers are only visible to course admins. Tutors only get the members of
+// their own groups. Under anonymous grading, they get pseudonyms instead of the
+// students as long as the grades of any sheet are not published.
+func (rs *CourseResource) RosterHandler(w http.ResponseWriter, r *http.Request) {
+	course := r.Context().Value(symbol.CtxKeyCourse).(*model.Course)
+	givenRole := r.Context().Value(symbol.CtxKeyCourseRole).(authorize.CourseRole)
+
+	groupIDs, err := visibleGroupIDs(rs.Stores, r, helper.Int64FromURL(r, "group_id", 0))
+	if err == errGroupNotVisible {
+		render.Render(w, r, ErrUnauthorizedWithDetails(err))
+		return
+	}
+	if err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
+	roles := []string{"0", "1", "2"}
+	var enrolledUsers []model.UserCourse
+	if groupIDs == nil {
+		enrolledUsers, err = rs.Stores.Course.EnrolledUsers(course.ID,
+			roles, "%%", "%%", "%%", "%%", "%%",
+		)
+	} else {
+		enrolledUsers, err = rs.Stores.Group.EnrolledUsersOfGroups(course.ID, groupIDs, roles)
+	}
+	if err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
+	enrolledUsers = EnsurePrivacyInEnrollments(enrolledUsers, givenRole)
+
+	hidden, err := anonymousTasks(rs.Stores, r, course)
+	if err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition",
+		fmt.Sprintf("attachment; filename=\"course%d-roster.csv\"", course.ID))
+
+	// the file is streamed, hence errors cannot be reported anymore
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"name", "email", "student_number", "role", "enrolled_at"})
+	for _, enrollment := range enrolledUsers {
+		enrolledAt := ""
+		if enrollment.EnrolledAt.Valid {
+			enrolledAt = enrollment.EnrolledAt.Time.UTC().Format(time.RFC3339)
+		}
+
+		row := []string{
+			fmt.Sprintf("%s %s", enrollment.FirstName, enrollment.LastName),
+			enrollment.Email,
+			enrollment.StudentNumber,
+			courseRoleName(authorize.CourseRole(enrollment.Role)),
+			enrolledAt,
+		}
+		if len(hidden) > 0 && enrollment.Role == int64(authorize.STUDENT) {
+			row = []string{anonymousID(course.ID, 0, enrollment.ID), "", "", row[3], row[4]}
+		}
+		writer.Write(row)
+	}
+	writer.Flush()
+}
+
+// GradeBookHandler is public endpoint for
+// URL: /courses/{course_id}/gradebook.xlsx
+// URLPARAM: course_id,integer
+// QUERYPARAM: group_id,integer
+// METHOD: get
+// TAG: grades
+// RESPONSE: 200,XLSXFile
+// RESPONSE: 400,BadRequest
+// RESPONSE: 401,Unauthenticated
+// RESPONSE: 403,Unauthorized
+// SUMMARY:  export the grade book of a course as Excel workbook
+// DESCRIPTION:
+// The first worksheet "Summary" contains the points of all students per
+// exercise sheet, followed by one worksheet per exercise sheet with the points
+// per task. Student numbers are only visible to course admins. Tutors only get
+// the members of their own groups. Under anonymous grading, they get
+// pseudonyms as long as the grades of any sheet are not published.
+func (rs *CourseResource) GradeBookHandler(w http.ResponseWriter, r *http.Request) {
+	course := r.Context().Value(symbol.CtxKeyCourse).(*model.Course)
+	givenRole := r.Context().Value(symbol.CtxKeyCourseRole).(authorize.CourseRole)
+
+	groupIDs, err := visibleGroupIDs(rs.Stores, r, helper.Int64FromURL(r, "group_id", 0))
+	if err == errGroupNotVisible {
+		render.Render(w, r, ErrUnauthorizedWithDetails(err))
+		return
+	}
+	if err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
+	roles := []string{"0"}
+	var students []model.UserCourse
+	if groupIDs == nil {
+		students, err = rs.Stores.Course.EnrolledUsers(course.ID,
+			roles, "%%", "%%", "%%", "%%", "%%",
+		)
+	} else {
+		students, err = rs.Stores.Group.EnrolledUsersOfGroups(course.ID, groupIDs, roles)
+	}
+	if err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+	students = EnsurePrivacyInEnrollments(students, givenRole)
+
+	sheets, err := rs.Stores.Sheet.SheetsOfCourse(course.ID)
+	if err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+	tasksOfSheet := make(map[int64][]model.Task)
+	for _, sheet := range sheets {
+		tasks, err := rs.Stores.Task.TasksOfSheet(sheet.ID)
+		if err != nil {
+			render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+			return
+		}
+		tasksOfSheet[sheet.ID] = tasks
+	}
+
+	entries, err := rs.Stores.Grade.GetGradeBook(course.ID)
+	if err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+	points := make(map[int64]map[int64]int)
+	sheetPoints := make(map[int64]map[int64]int)
+	for _, entry := range entries {
+		if points[entry.UserID] == nil {
+			points[entry.UserID] = make(map[int64]int)
+			sheetPoints[entry.UserID] = make(map[int64]int)
+		}
+		points[entry.UserID][entry.TaskID] = entry.Points
+		sheetPoints[entry.UserID][entry.SheetID] += entry.Points
+	}
+
+	hidden, err := anonymousTasks(rs.Stores, r, course)
+	if err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+	identity := func(student model.UserCourse) []interface{} {
+		if len(hidden) > 0 {
+			return []interface{}{anonymousID(course.ID, 0, student.ID), "", "", ""}
+		}
+		return []interface{}{student.FirstName, student.LastName, student.Email, student.StudentNumber}
+	}
+	header := []interface{}{"first_name", "last_name", "email", "student_number"}
+
+	w.Header().Set("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+	w.Header().Set("Content-Disposition",
+		fmt.Sprintf("attachment; filename=\"course%d-gradebook.xlsx\"", course.ID))
+
+	// the file is streamed, hence errors cannot be reported anymore
+	workbook := helper.NewXLSXWriter(w)
+
+	workbook.AddSheet("Summary")
+	row := append([]interface{}{}, header...)
+	for _, sheet := range sheets {
+		row = append(row, sheet.Name)
+	}
+	workbook.WriteRow(append(row, "total")...)
+	for _, student := range students {
+		row := identity(student)
+		total := 0
+		for _, sheet := range sheets {
+			row = append(row, sheetPoints[student.ID][sheet.ID])
+			total += sheetPoints[student.ID][sheet.ID]
+		}
+		workbook.WriteRow(append(row, total)...)
+	}
+
+	for _, sheet := range sheets {
+		workbook.AddSheet(sheet.Name)
+		row := append([]interface{}{}, header...)
+		for _, task := range tasksOfSheet[sheet.ID] {
+			row = append(row, task.Name)
+		}
+		workbook.WriteRow(append(row, "total")...)
+		for _, student := range students {
+			row := identity(student)
+			for _, task := range tasksOfSheet[sheet.ID] {
+				row = append(row, points[student.ID][task.ID])
+			}
+			workbook.WriteRow(append(row, sheetPoints[student.ID][sheet.ID])...)
+		}
+	}
+
+	workbook.Close()
+}
+
 // GetUserEnrollmentHandler is public endpoint for
 // URL: /courses/{course_id}/enrollments/{user_id}
 // URLPARAM: course_id,integer
@@ -367,7 +706,11 @@ func (rs *CourseResource) DeleteUserEnrollmentHandler(w http.ResponseWriter, r *
 // RESPONSE: 400,BadRequest
 // RESPONSE: 401,Unauthenticated
 // RESPONSE: 403,Unauthorized
+// RESPONSE: 404,NotFound
 // SUMMARY:  change role of specific user
+// DESCRIPTION:
+// The role is one of 0 (student), 1 (tutor) or 2 (admin). The last admin of a
+// course cannot be demoted. The user is notified about the new role by email.
 func (rs *CourseResource) ChangeRole(w http.ResponseWriter, r *http.Request) {
 	// /courses/1/enrollments?roles=0,1
 
@@ -381,12 +724,43 @@ func (rs *CourseResource) ChangeRole(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	userEnrollment, err := rs.Stores.Course.GetUserEnrollment(course.ID, user.ID)
+	if err != nil {
+		render.Render(w, r, ErrNotFound)
+		return
+	}
+
+	if userEnrollment.Role == int64(data.Role) {
+		render.Status(r, http.StatusOK)
+		return
+	}
+
+	// a course without admins cannot be managed anymore
+	if userEnrollment.Role == int64(authorize.ADMIN) {
+		admins, err := rs.Stores.Course.EnrolledUsers(course.ID,
+			[]string{"2"}, "%%", "%%", "%%", "%%", "%%",
+		)
+		if err != nil {
+			render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+			return
+		}
+		if len(admins) <= 1 {
+			render.Render(w, r, ErrBadRequestWithDetails(errors.New("Cannot demote the last admin of a course")))
+			return
+		}
+	}
+
 	// update database entry
 	if err := rs.Stores.Course.UpdateRole(course.ID, user.ID, data.Role); err != nil {
 		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
 		return
 	}
 
+	if err := rs.Events.Publish(event.EnrollmentRoleChanged{Course: course, User: user, Role: data.Role}); err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
 	render.Status(r, http.StatusOK)
 }
 
@@ -401,7 +775,43 @@ func (rs *CourseResource) ChangeRole(w http.ResponseWriter, r *http.Request) {
 // RESPONSE: 401,Unauthenticated
 // RESPONSE: 403,Unauthorized
 // SUMMARY:  enroll a user into a course
+// DESCRIPTION:
+// Students can only enroll themselves during the enrollment period of the
+// course and as long as it has not reached "max_students". Courses with an
+// enrollment code require "/courses/{course_id}/enroll" instead.
 func (rs *CourseResource) EnrollHandler(w http.ResponseWriter, r *http.Request) {
+	rs.enroll(w, r, "")
+}
+
+// EnrollWithCodeHandler is public endpoint for
+// URL: /courses/{course_id}/enroll
+// URLPARAM: course_id,integer
+// METHOD: post
+// TAG: enrollments
+// REQUEST: EnrollWithCodeRequest
+// RESPONSE: 201,EnrollmentResponse
+// RESPONSE: 400,BadRequest
+// RESPONSE: 401,Unauthenticated
+// RESPONSE: 403,Unauthorized
+// SUMMARY:  enroll a user into a course using the enrollment code
+// DESCRIPTION:
+// The code is only required if the course has an enrollment code, a wrong
+// code is answered with 403. Otherwise this is the same as
+// "/courses/{course_id}/enrollments".
+func (rs *CourseResource) EnrollWithCodeHandler(w http.ResponseWriter, r *http.Request) {
+	data := &EnrollWithCodeRequest{}
+	if err := render.Bind(r, data); err != nil {
+		render.Render(w, r, ErrBadRequestWithDetails(err))
+		return
+	}
+
+	rs.enroll(w, r, data.Code)
+}
+
+// enroll enrolls the request identity into the course after checking the
+// enrollment period, the capacity and the enrollment code of the course.
+// Root users are enrolled as admins without any checks.
+func (rs *CourseResource) enroll(w http.ResponseWriter, r *http.Request, code string) {
 	course := r.Context().Value(symbol.CtxKeyCourse).(*model.Course)
 	accessClaims := r.Context().Value(symbol.CtxKeyAccessClaims).(*authenticate.AccessClaims)
 
@@ -410,10 +820,35 @@ func (rs *CourseResource) EnrollHandler(w http.ResponseWriter, r *http.Request)
 		role = int64(2)
 	}
 
-	// update database entry
-	if err := rs.Stores.Course.Enroll(course.ID, accessClaims.LoginID, role); err != nil {
-		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
-		return
+	if role == 0 {
+		if course.EnrollmentCode.Valid &&
+			subtle.ConstantTimeCompare([]byte(code), []byte(course.EnrollmentCode.String)) != 1 {
+			render.Render(w, r, ErrUnauthorizedWithDetails(errors.New("the enrollment code is wrong")))
+			return
+		}
+
+		if !course.EnrollmentIsOpen(NowUTC()) {
+			render.Render(w, r, ErrBadRequestWithDetails(errors.New("the enrollment period of this course is not open")))
+			return
+		}
+
+		// the capacity is checked while enrolling, otherwise concurrent
+		// enrollments could exceed it
+		enrolled, err := rs.Stores.Course.EnrollStudent(course.ID, accessClaims.LoginID, course.MaxStudents)
+		if err != nil {
+			render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+			return
+		}
+		if !enrolled {
+			render.Render(w, r, ErrBadRequestWithDetails(errors.New("this course has reached its maximum number of students")))
+			return
+		}
+	} else {
+		// update database entry
+		if err := rs.Stores.Course.Enroll(course.ID, accessClaims.LoginID, role); err != nil {
+			render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+			return
+		}
 	}
 
 	userEnrollment, err := rs.Stores.Course.GetUserEnrollment(course.ID, accessClaims.LoginID)
@@ -422,6 +857,8 @@ func (rs *CourseResource) EnrollHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	rs.Events.Publish(event.EnrollmentCreated{CourseID: course.ID, Enrollment: userEnrollment})
+
 	render.Status(r, http.StatusCreated)
 
 	if err := render.Render(w, r, newEnrollmentResponse(userEnrollment)); err != nil {
@@ -431,6 +868,197 @@ func (rs *CourseResource) EnrollHandler(w http.ResponseWriter, r *http.Request)
 
 }
 
+// GetEnrollmentCodeHandler is public endpoint for
+// URL: /courses/{course_id}/enrollment_code
+// URLPARAM: course_id,integer
+// METHOD: get
+// TAG: enrollments
+// RESPONSE: 200,EnrollmentCodeResponse
+// RESPONSE: 400,BadRequest
+// RESPONSE: 401,Unauthenticated
+// RESPONSE: 403,Unauthorized
+// SUMMARY:  the code students need to enroll into the course
+// DESCRIPTION:
+// The code is null if everyone can enroll.
+func (rs *CourseResource) GetEnrollmentCodeHandler(w http.ResponseWriter, r *http.Request) {
+	course := r.Context().Value(symbol.CtxKeyCourse).(*model.Course)
+
+	if err := render.Render(w, r, &EnrollmentCodeResponse{Code: course.EnrollmentCode}); err != nil {
+		render.Render(w, r, ErrRender(err))
+		return
+	}
+}
+
+// ChangeEnrollmentCodeHandler is public endpoint for
+// URL: /courses/{course_id}/enrollment_code
+// URLPARAM: course_id,integer
+// METHOD: post
+// TAG: enrollments
+// REQUEST: Empty
+// RESPONSE: 200,EnrollmentCodeResponse
+// RESPONSE: 400,BadRequest
+// RESPONSE: 401,Unauthenticated
+// RESPONSE: 403,Unauthorized
+// SUMMARY:  generate a new enrollment code for the course
+// DESCRIPTION:
+// From now on students have to give this code to enroll, previous codes are
+// no longer accepted.
+func (rs *CourseResource) ChangeEnrollmentCodeHandler(w http.ResponseWriter, r *http.Request) {
+	course := r.Context().Value(symbol.CtxKeyCourse).(*model.Course)
+
+	// the code is long enough to be infeasible to guess
+	course.EnrollmentCode = null.StringFrom(auth.GenerateToken(16))
+	if err := rs.Stores.Course.Update(course); err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
+	if err := render.Render(w, r, &EnrollmentCodeResponse{Code: course.EnrollmentCode}); err != nil {
+		render.Render(w, r, ErrRender(err))
+		return
+	}
+}
+
+// DeleteEnrollmentCodeHandler is public endpoint for
+// URL: /courses/{course_id}/enrollment_code
+// URLPARAM: course_id,integer
+// METHOD: delete
+// TAG: enrollments
+// RESPONSE: 204,NoContent
+// RESPONSE: 400,BadRequest
+// RESPONSE: 401,Unauthenticated
+// RESPONSE: 403,Unauthorized
+// SUMMARY:  allow enrolling into the course without a code
+func (rs *CourseResource) DeleteEnrollmentCodeHandler(w http.ResponseWriter, r *http.Request) {
+	course := r.Context().Value(symbol.CtxKeyCourse).(*model.Course)
+
+	course.EnrollmentCode = null.String{}
+	if err := rs.Stores.Course.Update(course); err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
+	render.Status(r, http.StatusNoContent)
+}
+
+// Results of a row in a bulk enrollment.
+const (
+	BulkEnrollmentWouldEnroll = "would_enroll"
+	BulkEnrollmentEnrolled    = "enrolled"
+	BulkEnrollmentAlready     = "already"
+	BulkEnrollmentUnknown     = "unknown"
+)
+
+// BulkEnrollHandler is public endpoint for
+// URL: /courses/{course_id}/enrollments/bulk
+// URLPARAM: course_id,integer
+// QUERYPARAM: dry_run,boolean
+// METHOD: post
+// TAG: enrollments
+// REQUEST: csvfile
+// RESPONSE: 200,BulkEnrollmentResponse
+// RESPONSE: 400,BadRequest
+// RESPONSE: 401,Unauthenticated
+// RESPONSE: 403,Unauthorized
+// SUMMARY:  enroll all users listed in an uploaded CSV file as students
+// DESCRIPTION:
+// The first column of each row in "file_data" is either an email address or a
+// student number, a header row "email" is skipped. Each row is classified as
+// "enrolled", "already" (enrolled before or listed twice) or "unknown". With
+// "dry_run=true" nothing is changed and rows which would be enrolled are
+// reported as "would_enroll".
+func (rs *CourseResource) BulkEnrollHandler(w http.ResponseWriter, r *http.Request) {
+	course := r.Context().Value(symbol.CtxKeyCourse).(*model.Course)
+
+	dryRun, err := strconv.ParseBool(helper.StringFromURL(r, "dry_run", "false"))
+	if err != nil {
+		render.Render(w, r, ErrBadRequestWithDetails(errors.New("dry_run must be a boolean")))
+		return
+	}
+
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		render.Render(w, r, ErrBadRequestWithDetails(err))
+		return
+	}
+
+	file, _, err := r.FormFile("file_data")
+	if err != nil {
+		render.Render(w, r, ErrBadRequestWithDetails(err))
+		return
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	// the roster export or spreadsheets might add further columns
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil {
+		render.Render(w, r, ErrBadRequestWithDetails(err))
+		return
+	}
+
+	resp := &BulkEnrollmentResponse{
+		DryRun: dryRun,
+		Rows:   []BulkEnrollmentRowResponse{},
+	}
+	seen := make(map[int64]bool)
+
+	for k, record := range records {
+		identifier := strings.TrimSpace(record[0])
+		if identifier == "" || (k == 0 && strings.EqualFold(identifier, "email")) {
+			continue
+		}
+
+		row := BulkEnrollmentRowResponse{Row: k + 1, Identifier: identifier}
+
+		var user *model.User
+		if strings.Contains(identifier, "@") {
+			user, err = rs.Stores.User.FindByEmail(strings.ToLower(identifier))
+		} else {
+			user, err = rs.Stores.User.FindByStudentNumber(identifier)
+		}
+		if err != nil {
+			row.Result = BulkEnrollmentUnknown
+			resp.Rows = append(resp.Rows, row)
+			continue
+		}
+		row.UserID = null.IntFrom(user.ID)
+
+		if _, err := rs.Stores.Course.GetUserEnrollment(course.ID, user.ID); err == nil || seen[user.ID] {
+			row.Result = BulkEnrollmentAlready
+			resp.Rows = append(resp.Rows, row)
+			continue
+		}
+		seen[user.ID] = true
+
+		if dryRun {
+			row.Result = BulkEnrollmentWouldEnroll
+			resp.Rows = append(resp.Rows, row)
+			continue
+		}
+
+		if err := rs.Stores.Course.Enroll(course.ID, user.ID, int64(authorize.STUDENT)); err != nil {
+			render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+			return
+		}
+
+		userEnrollment, err := rs.Stores.Course.GetUserEnrollment(course.ID, user.ID)
+		if err != nil {
+			render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+			return
+		}
+		rs.Events.Publish(event.EnrollmentCreated{CourseID: course.ID, Enrollment: userEnrollment})
+
+		row.Result = BulkEnrollmentEnrolled
+		resp.Rows = append(resp.Rows, row)
+	}
+
+	if err := render.Render(w, r, resp); err != nil {
+		render.Render(w, r, ErrRender(err))
+		return
+	}
+}
+
 // DisenrollHandler is public endpoint for
 // URL: /courses/{course_id}/enrollments
 // URLPARAM: course_id,integer
@@ -441,6 +1069,9 @@ func (rs *CourseResource) EnrollHandler(w http.ResponseWriter, r *http.Request)
 // RESPONSE: 401,Unauthenticated
 // RESPONSE: 403,Unauthorized
 // SUMMARY:  disenroll a user from a course
+// DESCRIPTION:
+// Students cannot disenroll on their own after "disenroll_until" of the course.
+// Afterwards, only course admins can remove them.
 func (rs *CourseResource) DisenrollHandler(w http.ResponseWriter, r *http.Request) {
 	course := r.Context().Value(symbol.CtxKeyCourse).(*model.Course)
 	accessClaims := r.Context().Value(symbol.CtxKeyAccessClaims).(*authenticate.AccessClaims)
@@ -452,6 +1083,11 @@ func (rs *CourseResource) DisenrollHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	if givenRole == authorize.STUDENT && course.DisenrollUntil.Valid && OverTime(course.DisenrollUntil.Time) {
+		render.Render(w, r, ErrUnauthorizedWithDetails(errors.New("the period to disenroll from this course is over")))
+		return
+	}
+
 	// update database entry
 	if err := rs.Stores.Course.Disenroll(course.ID, accessClaims.LoginID); err != nil {
 		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
@@ -461,6 +1097,36 @@ func (rs *CourseResource) DisenrollHandler(w http.ResponseWriter, r *http.Reques
 	render.Status(r, http.StatusNoContent)
 }
 
+// AcknowledgeHonorCodeHandler is public endpoint for
+// URL: /courses/{course_id}/acknowledge_honor_code
+// URLPARAM: course_id,integer
+// METHOD: post
+// TAG: enrollments
+// RESPONSE: 204,NoContent
+// RESPONSE: 400,BadRequest
+// RESPONSE: 401,Unauthenticated
+// RESPONSE: 403,Unauthorized
+// SUMMARY:  acknowledge the honor code of a course
+// DESCRIPTION:
+// Students cannot upload submissions before they acknowledged the honor code
+// of the course.
+func (rs *CourseResource) AcknowledgeHonorCodeHandler(w http.ResponseWriter, r *http.Request) {
+	course := r.Context().Value(symbol.CtxKeyCourse).(*model.Course)
+	accessClaims := r.Context().Value(symbol.CtxKeyAccessClaims).(*authenticate.AccessClaims)
+
+	if course.HonorCode == "" {
+		render.Render(w, r, ErrBadRequestWithDetails(errors.New("this course has no honor code")))
+		return
+	}
+
+	if err := rs.Stores.Course.AcknowledgeHonorCode(course.ID, accessClaims.LoginID); err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
+	render.Status(r, http.StatusNoContent)
+}
+
 // SendEmailHandler is public endpoint for
 // URL: /courses/{course_id}/emails
 // URLPARAM: course_id,integer
@@ -474,11 +1140,16 @@ func (rs *CourseResource) DisenrollHandler(w http.ResponseWriter, r *http.Reques
 // TAG: courses
 // TAG: email
 // REQUEST: EmailRequest
-// RESPONSE: 204,NoContent
+// RESPONSE: 200,EmailBroadcastResponse
 // RESPONSE: 400,BadRequest
 // RESPONSE: 401,Unauthenticated
 // RESPONSE: 403,Unauthorized
 // SUMMARY:  send email to entire course filtered
+// DESCRIPTION:
+// The emails are sent in the background. Their progress can be queried
+// using the returned id. Subject and body can reference the variables
+// {{.first_name}}, {{.last_name}}, {{.email}}, {{.student_number}} and
+// {{.course_name}}.
 func (rs *CourseResource) SendEmailHandler(w http.ResponseWriter, r *http.Request) {
 
 	course := r.Context().Value(symbol.CtxKeyCourse).(*model.Course)
@@ -494,6 +1165,17 @@ func (rs *CourseResource) SendEmailHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	missing, err := email.MissingTemplateVariables(courseEmailVariables, data.Subject, data.Body)
+	if err != nil {
+		render.Render(w, r, ErrBadRequestWithDetails(err))
+		return
+	}
+	if len(missing) > 0 {
+		render.Render(w, r, ErrBadRequestWithDetails(
+			fmt.Errorf("unknown template variables: %s", strings.Join(missing, ", "))))
+		return
+	}
+
 	// extract filters
 	filterRoles := helper.StringArrayFromURL(r, "roles", []string{"0", "1", "2"})
 	filterFirstName := "%%"
@@ -512,19 +1194,136 @@ func (rs *CourseResource) SendEmailHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	// courses can send emails from their own address, answers go to the
+	// course or the sender by default
+	from := configuration.Configuration.Server.Email.From
+	if course.EmailFrom != "" {
+		from = course.EmailFrom
+	}
+	replyTo := course.ReplyTo
+	if replyTo == "" {
+		replyTo = accessUser.Email
+	}
+
+	broadcast, err := rs.Stores.Email.Create(&model.EmailBroadcast{
+		CourseID: course.ID,
+		SenderID: accessClaims.LoginID,
+		Subject:  data.Subject,
+	})
+	if err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
 	for _, recipient := range recipients {
+		delivery, err := rs.Stores.Email.CreateDelivery(&model.EmailDelivery{
+			BroadcastID: broadcast.ID,
+			Email:       recipient.Email,
+		})
+		if err != nil {
+			render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+			return
+		}
+
+		variables := map[string]string{
+			"first_name":     recipient.FirstName,
+			"last_name":      recipient.LastName,
+			"email":          recipient.Email,
+			"student_number": recipient.StudentNumber,
+			"course_name":    course.Name,
+		}
+		subject, err := email.FillTextTemplate(data.Subject, variables)
+		if err != nil {
+			render.Render(w, r, ErrBadRequestWithDetails(err))
+			return
+		}
+		body, err := email.FillTextTemplate(data.Body, variables)
+		if err != nil {
+			render.Render(w, r, ErrBadRequestWithDetails(err))
+			return
+		}
+
 		// add sender identity
-		msg := email.NewEmailFromUser(
-			configuration.Configuration.Server.Email.From,
+		msg := email.NewCourseEmailFromUser(
+			from,
 			recipient.Email,
-			data.Subject,
-			data.Body,
+			subject,
+			body,
 			accessUser,
+			course.EmailSubjectPrefix,
 		)
+		msg.ReplyTo = replyTo
+		msg.Done = rs.trackDelivery(delivery.ID)
 
 		email.OutgoingEmailsChannel <- msg
 	}
 
+	resp := &EmailBroadcastResponse{ID: broadcast.ID, Recipients: len(recipients)}
+	if err := render.Render(w, r, resp); err != nil {
+		render.Render(w, r, ErrRender(err))
+		return
+	}
+}
+
+// courseEmailVariables are the template variables available in emails sent to
+// a course.
+var courseEmailVariables = []string{"first_name", "last_name", "email", "student_number", "course_name"}
+
+// trackDelivery returns a callback storing the outcome of sending an email.
+func (rs *CourseResource) trackDelivery(deliveryID int64) func(err error) {
+	return func(err error) {
+		if err != nil {
+			rs.Stores.Email.UpdateDeliveryState(deliveryID, symbol.EmailDeliveryFailed, err.Error())
+			return
+		}
+		rs.Stores.Email.UpdateDeliveryState(deliveryID, symbol.EmailDeliverySent, "")
+	}
+}
+
+// GetEmailBroadcastHandler is public endpoint for
+// URL: /courses/{course_id}/emails/{broadcast_id}
+// URLPARAM: course_id,integer
+// URLPARAM: broadcast_id,integer
+// METHOD: get
+// TAG: courses
+// TAG: email
+// RESPONSE: 200,EmailBroadcastStatusResponse
+// RESPONSE: 400,BadRequest
+// RESPONSE: 401,Unauthenticated
+// RESPONSE: 403,Unauthorized
+// RESPONSE: 404,NotFound
+// SUMMARY:  get the progress of an email sent to the course
+func (rs *CourseResource) GetEmailBroadcastHandler(w http.ResponseWriter, r *http.Request) {
+	course := r.Context().Value(symbol.CtxKeyCourse).(*model.Course)
+
+	broadcastID, err := strconv.ParseInt(chi.URLParam(r, "broadcast_id"), 10, 64)
+	if err != nil {
+		render.Render(w, r, ErrNotFound)
+		return
+	}
+
+	broadcast, err := rs.Stores.Email.Get(broadcastID)
+	if err != nil || broadcast.CourseID != course.ID {
+		render.Render(w, r, ErrNotFound)
+		return
+	}
+
+	status, err := rs.Stores.Email.GetStatus(broadcast.ID)
+	if err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
+	failed, err := rs.Stores.Email.FailedDeliveries(broadcast.ID)
+	if err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
+	if err := render.Render(w, r, newEmailBroadcastStatusResponse(broadcast, status, failed)); err != nil {
+		render.Render(w, r, ErrRender(err))
+		return
+	}
 }
 
 // PointsHandler is public endpoint for
@@ -536,9 +1335,13 @@ func (rs *CourseResource) SendEmailHandler(w http.ResponseWriter, r *http.Reques
 // RESPONSE: 401,Unauthenticated
 // RESPONSE: 403,Unauthorized
 // SUMMARY:  get all points for the request identity
+// DESCRIPTION:
+// Students get "grading_in_progress" instead of their points for sheets whose
+// grades are not published yet.
 func (rs *CourseResource) PointsHandler(w http.ResponseWriter, r *http.Request) {
 	course := r.Context().Value(symbol.CtxKeyCourse).(*model.Course)
 	accessClaims := r.Context().Value(symbol.CtxKeyAccessClaims).(*authenticate.AccessClaims)
+	givenRole := r.Context().Value(symbol.CtxKeyCourseRole).(authorize.CourseRole)
 
 	sheetPoints, err := rs.Stores.Course.PointsForUser(accessClaims.LoginID, course.ID)
 	if err != nil {
@@ -548,7 +1351,7 @@ func (rs *CourseResource) PointsHandler(w http.ResponseWriter, r *http.Request)
 
 	// resp := &SheetPointsResponse{SheetPoints: sheetPoints}
 
-	if err := render.RenderList(w, r, newSheetPointsListResponse(sheetPoints)); err != nil {
+	if err := render.RenderList(w, r, newSheetPointsListResponse(sheetPoints, givenRole == authorize.STUDENT)); err != nil {
 		render.Render(w, r, ErrRender(err))
 		return
 	}
@@ -556,6 +1359,100 @@ func (rs *CourseResource) PointsHandler(w http.ResponseWriter, r *http.Request)
 	render.Status(r, http.StatusOK)
 }
 
+// StructureHandler is public endpoint for
+// URL: /courses/{course_id}/structure
+// URLPARAM: course_id,integer
+// METHOD: get
+// TAG: courses
+// RESPONSE: 200,CourseStructureResponse
+// RESPONSE: 400,BadRequest
+// RESPONSE: 401,Unauthenticated
+// RESPONSE: 403,Unauthorized
+// SUMMARY:  get all sheets with their tasks and all materials of a course
+// DESCRIPTION:
+// Students only see published sheets and materials they are allowed to access.
+func (rs *CourseResource) StructureHandler(w http.ResponseWriter, r *http.Request) {
+	course := r.Context().Value(symbol.CtxKeyCourse).(*model.Course)
+	givenRole := r.Context().Value(symbol.CtxKeyCourseRole).(authorize.CourseRole)
+
+	sheets, err := rs.Stores.Sheet.SheetsOfCourse(course.ID)
+	if err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
+	resp := &CourseStructureResponse{
+		Sheets:    []SheetStructureResponse{},
+		Materials: []*MaterialResponse{},
+	}
+
+	for k := range sheets {
+		if givenRole == authorize.STUDENT && !PublicYet(sheets[k].PublishAt) {
+			continue
+		}
+
+		tasks, err := rs.Stores.Task.TasksOfSheet(sheets[k].ID)
+		if err != nil {
+			render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+			return
+		}
+		resp.Sheets = append(resp.Sheets, newSheetStructureResponse(&sheets[k], tasks))
+	}
+
+	materials, err := rs.Stores.Material.MaterialsOfCourse(course.ID, givenRole.ToInt())
+	if err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
+	materialResource := NewMaterialResource(rs.Stores)
+	for k := range materials {
+		if givenRole == authorize.STUDENT && !PublicYet(materials[k].PublishAt) {
+			continue
+		}
+		resp.Materials = append(resp.Materials, materialResource.newMaterialResponse(&materials[k], course.ID))
+	}
+
+	if err := render.Render(w, r, resp); err != nil {
+		render.Render(w, r, ErrRender(err))
+		return
+	}
+}
+
+// DashboardHandler is public endpoint for
+// URL: /courses/{course_id}/dashboard
+// URLPARAM: course_id,integer
+// METHOD: get
+// TAG: courses
+// RESPONSE: 200,CourseDashboardResponse
+// RESPONSE: 400,BadRequest
+// RESPONSE: 401,Unauthenticated
+// RESPONSE: 403,Unauthorized
+// SUMMARY:  get statistics about the enrollments and submissions of a course
+// DESCRIPTION:
+// Submissions without feedback and points count as ungraded. The average
+// points are taken over all graded submissions. The days are given in UTC.
+func (rs *CourseResource) DashboardHandler(w http.ResponseWriter, r *http.Request) {
+	course := r.Context().Value(symbol.CtxKeyCourse).(*model.Course)
+
+	dashboard, err := rs.Stores.Course.GetDashboard(course.ID)
+	if err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
+	volume, err := rs.Stores.Course.GetSubmissionVolume(course.ID)
+	if err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
+	if err := render.Render(w, r, newCourseDashboardResponse(dashboard, volume)); err != nil {
+		render.Render(w, r, ErrRender(err))
+		return
+	}
+}
+
 // BidsHandler is public endpoint for
 // URL: /courses/{course_id}/bids
 // URLPARAM: course_id,integer
@@ -0,0 +1,188 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package app
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+	"github.com/infomark-org/infomark/model"
+	"github.com/infomark-org/infomark/symbol"
+)
+
+// CourseNoteResource specifies handlers for pinned course notes.
+type CourseNoteResource struct {
+	Stores *Stores
+}
+
+// NewCourseNoteResource create and returns a CourseNoteResource.
+func NewCourseNoteResource(stores *Stores) *CourseNoteResource {
+	return &CourseNoteResource{
+		Stores: stores,
+	}
+}
+
+// IndexHandler is public endpoint for
+// URL: /courses/{course_id}/notes
+// URLPARAM: course_id,integer
+// METHOD: get
+// TAG: notes
+// RESPONSE: 200,CourseNoteResponseList
+// RESPONSE: 400,BadRequest
+// RESPONSE: 401,Unauthenticated
+// RESPONSE: 403,Unauthorized
+// SUMMARY:  get all pinned notes of a course
+func (rs *CourseNoteResource) IndexHandler(w http.ResponseWriter, r *http.Request) {
+	course := r.Context().Value(symbol.CtxKeyCourse).(*model.Course)
+
+	notes, err := rs.Stores.CourseNote.NotesOfCourse(course.ID)
+	if err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
+	if err := render.RenderList(w, r, rs.newCourseNoteListResponse(notes)); err != nil {
+		render.Render(w, r, ErrRender(err))
+		return
+	}
+}
+
+// CreateHandler is public endpoint for
+// URL: /courses/{course_id}/notes
+// URLPARAM: course_id,integer
+// METHOD: post
+// TAG: notes
+// REQUEST: CourseNoteRequest
+// RESPONSE: 201,CourseNoteResponse
+// RESPONSE: 400,BadRequest
+// RESPONSE: 401,Unauthenticated
+// RESPONSE: 403,Unauthorized
+// SUMMARY:  pin a new note to a course
+// DESCRIPTION:
+// Notes are listed by ascending "ordering".
+func (rs *CourseNoteResource) CreateHandler(w http.ResponseWriter, r *http.Request) {
+	course := r.Context().Value(symbol.CtxKeyCourse).(*model.Course)
+
+	data := &CourseNoteRequest{}
+	if err := render.Bind(r, data); err != nil {
+		render.Render(w, r, ErrBadRequestWithDetails(err))
+		return
+	}
+
+	note, err := rs.Stores.CourseNote.Create(&model.CourseNote{
+		CourseID: course.ID,
+		Title:    data.Title,
+		Body:     data.Body,
+		Ordering: data.Ordering,
+	})
+	if err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
+	render.Status(r, http.StatusCreated)
+	if err := render.Render(w, r, rs.newCourseNoteResponse(note)); err != nil {
+		render.Render(w, r, ErrRender(err))
+		return
+	}
+}
+
+// EditHandler is public endpoint for
+// URL: /courses/{course_id}/notes/{note_id}
+// URLPARAM: course_id,integer
+// URLPARAM: note_id,integer
+// METHOD: put
+// TAG: notes
+// REQUEST: CourseNoteRequest
+// RESPONSE: 204,NoContent
+// RESPONSE: 400,BadRequest
+// RESPONSE: 401,Unauthenticated
+// RESPONSE: 403,Unauthorized
+// RESPONSE: 404,NotFound
+// SUMMARY:  update a pinned note
+func (rs *CourseNoteResource) EditHandler(w http.ResponseWriter, r *http.Request) {
+	note, ok := rs.noteOfCourse(w, r)
+	if !ok {
+		return
+	}
+
+	data := &CourseNoteRequest{}
+	if err := render.Bind(r, data); err != nil {
+		render.Render(w, r, ErrBadRequestWithDetails(err))
+		return
+	}
+
+	note.Title = data.Title
+	note.Body = data.Body
+	note.Ordering = data.Ordering
+
+	if err := rs.Stores.CourseNote.Update(note); err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
+	render.Status(r, http.StatusNoContent)
+}
+
+// DeleteHandler is public endpoint for
+// URL: /courses/{course_id}/notes/{note_id}
+// URLPARAM: course_id,integer
+// URLPARAM: note_id,integer
+// METHOD: delete
+// TAG: notes
+// RESPONSE: 204,NoContent
+// RESPONSE: 400,BadRequest
+// RESPONSE: 401,Unauthenticated
+// RESPONSE: 403,Unauthorized
+// RESPONSE: 404,NotFound
+// SUMMARY:  delete a pinned note
+func (rs *CourseNoteResource) DeleteHandler(w http.ResponseWriter, r *http.Request) {
+	note, ok := rs.noteOfCourse(w, r)
+	if !ok {
+		return
+	}
+
+	if err := rs.Stores.CourseNote.Delete(note.ID); err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
+	render.Status(r, http.StatusNoContent)
+}
+
+// noteOfCourse loads the note from the url and renders an error if it does
+// not belong to the course from the context.
+func (rs *CourseNoteResource) noteOfCourse(w http.ResponseWriter, r *http.Request) (*model.CourseNote, bool) {
+	course := r.Context().Value(symbol.CtxKeyCourse).(*model.Course)
+
+	noteID, err := strconv.ParseInt(chi.URLParam(r, "note_id"), 10, 64)
+	if err != nil {
+		render.Render(w, r, ErrBadRequest)
+		return nil, false
+	}
+
+	note, err := rs.Stores.CourseNote.Get(noteID)
+	if err != nil || note.CourseID != course.ID {
+		render.Render(w, r, ErrNotFound)
+		return nil, false
+	}
+
+	return note, true
+}
@@ -0,0 +1,46 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package app
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	validation "github.com/go-ozzo/ozzo-validation"
+)
+
+// CourseNoteRequest is the request payload for pinned course notes.
+type CourseNoteRequest struct {
+	Title    string `json:"title" example:"Where do I find the exam room?"`
+	Body     string `json:"body" example:"The exam takes place in lecture hall N6."`
+	Ordering int    `json:"ordering" example:"1"`
+}
+
+// Bind preprocesses a CourseNoteRequest.
+func (body *CourseNoteRequest) Bind(r *http.Request) error {
+	if body == nil {
+		return errors.New("missing \"note\" data")
+	}
+
+	body.Title = strings.TrimSpace(body.Title)
+
+	return validation.ValidateStruct(body,
+		validation.Field(&body.Title, validation.Required),
+	)
+}
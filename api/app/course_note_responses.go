@@ -0,0 +1,56 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package app
+
+import (
+	"net/http"
+
+	"github.com/go-chi/render"
+	"github.com/infomark-org/infomark/model"
+)
+
+// CourseNoteResponse is the response payload for pinned course notes.
+type CourseNoteResponse struct {
+	ID       int64  `json:"id" example:"1"`
+	Title    string `json:"title" example:"Where do I find the exam room?"`
+	Body     string `json:"body" example:"The exam takes place in lecture hall N6."`
+	Ordering int    `json:"ordering" example:"1"`
+}
+
+// Render post-processes a CourseNoteResponse.
+func (body *CourseNoteResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+// newCourseNoteResponse creates a response from a course note model.
+func (rs *CourseNoteResource) newCourseNoteResponse(p *model.CourseNote) *CourseNoteResponse {
+	return &CourseNoteResponse{
+		ID:       p.ID,
+		Title:    p.Title,
+		Body:     p.Body,
+		Ordering: p.Ordering,
+	}
+}
+
+func (rs *CourseNoteResource) newCourseNoteListResponse(notes []model.CourseNote) []render.Renderer {
+	list := []render.Renderer{}
+	for k := range notes {
+		list = append(list, rs.newCourseNoteResponse(&notes[k]))
+	}
+	return list
+}
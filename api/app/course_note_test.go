@@ -0,0 +1,136 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/franela/goblin"
+	"github.com/infomark-org/infomark/email"
+)
+
+func TestCourseNote(t *testing.T) {
+
+	g := goblin.Goblin(t)
+	email.DefaultMail = email.VoidMail
+
+	tape := NewTape()
+
+	var stores *Stores
+
+	studentJWT := tape.NewJWTRequest(112, false)
+	tutorJWT := tape.NewJWTRequest(2, false)
+	noAdminJWT := tape.NewJWTRequest(1, false)
+	adminJWT := tape.NewJWTRequest(1, true)
+
+	g.Describe("CourseNote", func() {
+
+		g.BeforeEach(func() {
+			tape.BeforeEach()
+			stores = NewStores(tape.DB)
+		})
+
+		g.It("Should list notes by their ordering", func() {
+			w := tape.Post("/api/v1/courses/1/notes", H{"title": "second", "ordering": 2}, noAdminJWT)
+			g.Assert(w.Code).Equal(http.StatusCreated)
+			w = tape.Post("/api/v1/courses/1/notes", H{"title": "first", "body": "text", "ordering": 1}, noAdminJWT)
+			g.Assert(w.Code).Equal(http.StatusCreated)
+
+			w = tape.Get("/api/v1/courses/1/notes", studentJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			list := []CourseNoteResponse{}
+			g.Assert(json.NewDecoder(w.Body).Decode(&list)).Equal(nil)
+			g.Assert(len(list)).Equal(2)
+			g.Assert(list[0].Title).Equal("first")
+			g.Assert(list[0].Body).Equal("text")
+			g.Assert(list[1].Title).Equal("second")
+
+			// notes of other courses are not listed
+			w = tape.Get("/api/v1/courses/2/notes", adminJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+			list = []CourseNoteResponse{}
+			g.Assert(json.NewDecoder(w.Body).Decode(&list)).Equal(nil)
+			g.Assert(len(list)).Equal(0)
+		})
+
+		g.It("Should require a title", func() {
+			w := tape.Post("/api/v1/courses/1/notes", H{"body": "text"}, noAdminJWT)
+			g.Assert(w.Code).Equal(http.StatusBadRequest)
+		})
+
+		g.It("Should update and delete notes", func() {
+			w := tape.Post("/api/v1/courses/1/notes", H{"title": "FAQ", "ordering": 1}, noAdminJWT)
+			g.Assert(w.Code).Equal(http.StatusCreated)
+			created := &CourseNoteResponse{}
+			g.Assert(json.NewDecoder(w.Body).Decode(created)).Equal(nil)
+
+			url := fmt.Sprintf("/api/v1/courses/1/notes/%d", created.ID)
+
+			w = tape.Put(url, H{"title": "FAQ (updated)", "body": "text", "ordering": 3}, noAdminJWT)
+			g.Assert(w.Code).Equal(http.StatusNoContent)
+
+			note, err := stores.CourseNote.Get(created.ID)
+			g.Assert(err).Equal(nil)
+			g.Assert(note.Title).Equal("FAQ (updated)")
+			g.Assert(note.Body).Equal("text")
+			g.Assert(note.Ordering).Equal(3)
+
+			// the note does not belong to course 2
+			w = tape.Delete(fmt.Sprintf("/api/v1/courses/2/notes/%d", created.ID), adminJWT)
+			g.Assert(w.Code).Equal(http.StatusNotFound)
+
+			w = tape.Delete(url, noAdminJWT)
+			g.Assert(w.Code).Equal(http.StatusNoContent)
+
+			notes, err := stores.CourseNote.NotesOfCourse(1)
+			g.Assert(err).Equal(nil)
+			g.Assert(len(notes)).Equal(0)
+		})
+
+		g.It("Students and tutors can only read notes", func() {
+			w := tape.Post("/api/v1/courses/1/notes", H{"title": "FAQ"}, noAdminJWT)
+			g.Assert(w.Code).Equal(http.StatusCreated)
+			created := &CourseNoteResponse{}
+			g.Assert(json.NewDecoder(w.Body).Decode(created)).Equal(nil)
+
+			url := fmt.Sprintf("/api/v1/courses/1/notes/%d", created.ID)
+
+			for _, jwt := range []JWTRequest{studentJWT, tutorJWT} {
+				w = tape.Get("/api/v1/courses/1/notes", jwt)
+				g.Assert(w.Code).Equal(http.StatusOK)
+
+				w = tape.Post("/api/v1/courses/1/notes", H{"title": "other"}, jwt)
+				g.Assert(w.Code).Equal(http.StatusForbidden)
+
+				w = tape.Put(url, H{"title": "changed"}, jwt)
+				g.Assert(w.Code).Equal(http.StatusForbidden)
+
+				w = tape.Delete(url, jwt)
+				g.Assert(w.Code).Equal(http.StatusForbidden)
+			}
+
+			note, err := stores.CourseNote.Get(created.ID)
+			g.Assert(err).Equal(nil)
+			g.Assert(note.Title).Equal("FAQ")
+		})
+	})
+}
@@ -22,18 +22,32 @@ package app
 import (
 	"errors"
 	"net/http"
+	"strings"
 	"time"
 
 	validation "github.com/go-ozzo/ozzo-validation"
+	"github.com/go-ozzo/ozzo-validation/is"
+	"github.com/infomark-org/infomark/auth/authorize"
+	null "gopkg.in/guregu/null.v3"
 )
 
 // CourseRequest is the request payload for course management.
 type CourseRequest struct {
-	Name               string    `json:"name" example:"Info 2"`
-	Description        string    `json:"description" example:"An example course."`
-	BeginsAt           time.Time `json:"begins_at" example:"auto"`
-	EndsAt             time.Time `json:"ends_at" example:"auto"`
-	RequiredPercentage int       `json:"required_percentage" example:"80"`
+	Name                    string    `json:"name" example:"Info 2"`
+	Description             string    `json:"description" example:"An example course."`
+	BeginsAt                time.Time `json:"begins_at" example:"auto"`
+	EndsAt                  time.Time `json:"ends_at" example:"auto"`
+	RequiredPercentage      int       `json:"required_percentage" example:"80"`
+	SubmissionRetentionDays int       `json:"submission_retention_days" example:"180" required:"false"`
+	EmailFrom               string    `json:"email_from" example:"info2@uni-tuebingen.de" required:"false"`
+	ReplyTo                 string    `json:"reply_to" example:"info2-tutors@uni-tuebingen.de" required:"false"`
+	EmailSubjectPrefix      string    `json:"email_subject_prefix" example:"[InfoMark CS101]" required:"false"`
+	DisenrollUntil          null.Time `json:"disenroll_until" example:"auto" required:"false"`
+	HonorCode               string    `json:"honor_code" example:"I will not share my solutions." required:"false"`
+	AnonymousGrading        bool      `json:"anonymous_grading" example:"false" required:"false"`
+	EnrollmentBeginsAt      null.Time `json:"enrollment_begins_at" example:"auto" required:"false"`
+	EnrollmentEndsAt        null.Time `json:"enrollment_ends_at" example:"auto" required:"false"`
+	MaxStudents             int       `json:"max_students" example:"120" required:"false"`
 }
 
 // Bind preprocesses a CourseRequest.
@@ -52,6 +66,11 @@ func (body *CourseRequest) Validate() error {
 		return errors.New("ends_at should be later than begins_at")
 	}
 
+	if body.EnrollmentBeginsAt.Valid && body.EnrollmentEndsAt.Valid &&
+		body.EnrollmentEndsAt.Time.Before(body.EnrollmentBeginsAt.Time) {
+		return errors.New("enrollment_ends_at should be later than enrollment_begins_at")
+	}
+
 	return validation.ValidateStruct(body,
 		validation.Field(
 			&body.Name,
@@ -73,13 +92,49 @@ func (body *CourseRequest) Validate() error {
 			&body.RequiredPercentage,
 			validation.Min(0),
 		),
+		validation.Field(
+			&body.SubmissionRetentionDays,
+			validation.Min(0),
+		),
+		validation.Field(
+			&body.MaxStudents,
+			validation.Min(0),
+		),
+		validation.Field(
+			&body.EmailFrom,
+			is.Email,
+		),
+		validation.Field(
+			&body.ReplyTo,
+			is.Email,
+		),
 	)
 }
 
+// EnrollWithCodeRequest is the request payload to enroll into a course. The
+// code is required if the course has an enrollment code.
+type EnrollWithCodeRequest struct {
+	Code string `json:"code" example:"5f3a9c1e" required:"false"`
+}
+
+// Bind preprocesses a EnrollWithCodeRequest.
+func (body *EnrollWithCodeRequest) Bind(r *http.Request) error {
+	body.Code = strings.TrimSpace(body.Code)
+	return nil
+}
+
+// ChangeRoleInCourseRequest is the request payload to change the role of an
+// enrolled user.
 type ChangeRoleInCourseRequest struct {
-	Role int `json:"role" example:"0"`
+	Role int `json:"role" example:"1"`
 }
 
+// Bind preprocesses a ChangeRoleInCourseRequest.
 func (body *ChangeRoleInCourseRequest) Bind(r *http.Request) error {
-	return nil
+	return validation.ValidateStruct(body,
+		validation.Field(
+			&body.Role,
+			validation.In(authorize.STUDENT.ToInt(), authorize.TUTOR.ToInt(), authorize.ADMIN.ToInt()),
+		),
+	)
 }
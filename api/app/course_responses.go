@@ -20,6 +20,7 @@
 package app
 
 import (
+	"fmt"
 	"net/http"
 	"time"
 
@@ -30,12 +31,23 @@ import (
 
 // CourseResponse is the response payload for course management.
 type CourseResponse struct {
-	ID                 int64     `json:"id" example:"1"`
-	Name               string    `json:"name" example:"Info2"`
-	Description        string    `json:"description" example:"Some course description here"`
-	BeginsAt           time.Time `json:"begins_at" example:"auto"`
-	EndsAt             time.Time `json:"ends_at" example:"auto"`
-	RequiredPercentage int       `json:"required_percentage" example:"80"`
+	ID                      int64     `json:"id" example:"1"`
+	Name                    string    `json:"name" example:"Info2"`
+	Description             string    `json:"description" example:"Some course description here"`
+	BeginsAt                time.Time `json:"begins_at" example:"auto"`
+	EndsAt                  time.Time `json:"ends_at" example:"auto"`
+	RequiredPercentage      int       `json:"required_percentage" example:"80"`
+	SubmissionRetentionDays int       `json:"submission_retention_days" example:"180"`
+	EmailFrom               string    `json:"email_from" example:"info2@uni-tuebingen.de"`
+	ReplyTo                 string    `json:"reply_to" example:"info2-tutors@uni-tuebingen.de"`
+	EmailSubjectPrefix      string    `json:"email_subject_prefix" example:"[InfoMark CS101]"`
+	DisenrollUntil          null.Time `json:"disenroll_until" example:"auto"`
+	HonorCode               string    `json:"honor_code" example:"I will not share my solutions."`
+	AnonymousGrading        bool      `json:"anonymous_grading" example:"false"`
+	EnrollmentBeginsAt      null.Time `json:"enrollment_begins_at" example:"auto"`
+	EnrollmentEndsAt        null.Time `json:"enrollment_ends_at" example:"auto"`
+	MaxStudents             int       `json:"max_students" example:"120"`
+	RequiresEnrollmentCode  bool      `json:"requires_enrollment_code" example:"false"`
 }
 
 // Render post-processes a CourseResponse.
@@ -46,12 +58,23 @@ func (body *CourseResponse) Render(w http.ResponseWriter, r *http.Request) error
 // newCourseResponse creates a response from a course model.
 func (rs *CourseResource) newCourseResponse(p *model.Course) *CourseResponse {
 	return &CourseResponse{
-		ID:                 p.ID,
-		Name:               p.Name,
-		Description:        p.Description,
-		BeginsAt:           p.BeginsAt,
-		EndsAt:             p.EndsAt,
-		RequiredPercentage: p.RequiredPercentage,
+		ID:                      p.ID,
+		Name:                    p.Name,
+		Description:             p.Description,
+		BeginsAt:                p.BeginsAt,
+		EndsAt:                  p.EndsAt,
+		RequiredPercentage:      p.RequiredPercentage,
+		SubmissionRetentionDays: p.SubmissionRetentionDays,
+		EmailFrom:               p.EmailFrom,
+		ReplyTo:                 p.ReplyTo,
+		EmailSubjectPrefix:      p.EmailSubjectPrefix,
+		DisenrollUntil:          p.DisenrollUntil,
+		HonorCode:               p.HonorCode,
+		AnonymousGrading:        p.AnonymousGrading,
+		EnrollmentBeginsAt:      p.EnrollmentBeginsAt,
+		EnrollmentEndsAt:        p.EnrollmentEndsAt,
+		MaxStudents:             p.MaxStudents,
+		RequiresEnrollmentCode:  p.EnrollmentCode.Valid,
 	}
 }
 
@@ -64,11 +87,13 @@ func (rs *CourseResource) newCourseListResponse(courses []model.Course) []render
 	return list
 }
 
-// SheetPointsResponse is response for performance on a specific exercise sheet
+// SheetPointsResponse is response for performance on a specific exercise sheet.
+// The acquired points are zero while grading is in progress.
 type SheetPointsResponse struct {
-	AquiredPoints int `json:"acquired_points" example:"58"`
-	MaxPoints     int `json:"max_points" example:"90"`
-	SheetID       int `json:"sheet_id" example:"2"`
+	AquiredPoints     int  `json:"acquired_points" example:"58"`
+	MaxPoints         int  `json:"max_points" example:"90"`
+	SheetID           int  `json:"sheet_id" example:"2"`
+	GradingInProgress bool `json:"grading_in_progress" example:"false"`
 }
 
 // Render postprocesses a SheetPointsResponse before marshalling to JSON.
@@ -76,7 +101,15 @@ func (body *SheetPointsResponse) Render(w http.ResponseWriter, r *http.Request)
 	return nil
 }
 
-func newSheetPointsResponse(p *model.SheetPoints) *SheetPointsResponse {
+func newSheetPointsResponse(p *model.SheetPoints, hideUnpublished bool) *SheetPointsResponse {
+	if hideUnpublished && !p.GradesPublished {
+		return &SheetPointsResponse{
+			MaxPoints:         p.MaxPoints,
+			SheetID:           p.SheetID,
+			GradingInProgress: true,
+		}
+	}
+
 	return &SheetPointsResponse{
 		AquiredPoints: p.AquiredPoints,
 		MaxPoints:     p.MaxPoints,
@@ -85,10 +118,11 @@ func newSheetPointsResponse(p *model.SheetPoints) *SheetPointsResponse {
 }
 
 // newCourseListResponse creates a response from a list of course models.
-func newSheetPointsListResponse(collection []model.SheetPoints) []render.Renderer {
+// Points of sheets whose grades are not published are hidden if requested.
+func newSheetPointsListResponse(collection []model.SheetPoints, hideUnpublished bool) []render.Renderer {
 	list := []render.Renderer{}
 	for k := range collection {
-		list = append(list, newSheetPointsResponse(&collection[k]))
+		list = append(list, newSheetPointsResponse(&collection[k], hideUnpublished))
 	}
 
 	return list
@@ -128,6 +162,25 @@ func newGroupBidsListResponse(collection []model.GroupBid) []render.Renderer {
 
 // .............................................................................
 
+// BulkEnrollmentRowResponse is the result of a single row of a bulk enrollment.
+type BulkEnrollmentRowResponse struct {
+	Row        int      `json:"row" example:"2"`
+	Identifier string   `json:"identifier" example:"test@uni-tuebingen.de"`
+	UserID     null.Int `json:"user_id" example:"42"`
+	Result     string   `json:"result" example:"would_enroll"`
+}
+
+// BulkEnrollmentResponse is the response payload of a bulk enrollment.
+type BulkEnrollmentResponse struct {
+	DryRun bool                        `json:"dry_run" example:"true"`
+	Rows   []BulkEnrollmentRowResponse `json:"rows"`
+}
+
+// Render post-processes a BulkEnrollmentResponse.
+func (body *BulkEnrollmentResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
 // CourseResponse is the response payload for course management.
 type EnrollmentResponse struct {
 	Role int64 `json:"role" example:"1"`
@@ -188,3 +241,158 @@ func newEnrollmentListResponse(enrollments []model.UserCourse) []render.Renderer
 
 	return list
 }
+
+// EnrollmentCodeResponse is the response payload containing the code students
+// need to enroll into a course.
+type EnrollmentCodeResponse struct {
+	Code null.String `json:"code" example:"5f3a9c1e0b7d4e2a9c6f1d8b3e5a7c90"`
+}
+
+// Render post-processes a EnrollmentCodeResponse.
+func (body *EnrollmentCodeResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+// EmailBroadcastResponse is the response payload after sending an email to a
+// course.
+type EmailBroadcastResponse struct {
+	ID         int64 `json:"id" example:"4"`
+	Recipients int   `json:"recipients" example:"120"`
+}
+
+// Render post-processes an EmailBroadcastResponse.
+func (body *EmailBroadcastResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+// EmailBroadcastStatusResponse is the response payload for the progress of an
+// email sent to a course.
+type EmailBroadcastStatusResponse struct {
+	ID               int64    `json:"id" example:"4"`
+	Subject          string   `json:"subject" example:"Exam dates"`
+	Queued           int      `json:"queued" example:"10"`
+	Sent             int      `json:"sent" example:"108"`
+	Failed           int      `json:"failed" example:"2"`
+	FailedRecipients []string `json:"failed_recipients" example:"max.mustermann@uni-tuebingen.de"`
+}
+
+// Render post-processes an EmailBroadcastStatusResponse.
+func (body *EmailBroadcastStatusResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+// newEmailBroadcastStatusResponse creates a response from a broadcast and its
+// deliveries.
+func newEmailBroadcastStatusResponse(broadcast *model.EmailBroadcast, status *model.EmailBroadcastStatus,
+	failed []model.EmailDelivery) *EmailBroadcastStatusResponse {
+	failedRecipients := []string{}
+	for _, delivery := range failed {
+		failedRecipients = append(failedRecipients, delivery.Email)
+	}
+
+	return &EmailBroadcastStatusResponse{
+		ID:               broadcast.ID,
+		Subject:          broadcast.Subject,
+		Queued:           status.Queued,
+		Sent:             status.Sent,
+		Failed:           status.Failed,
+		FailedRecipients: failedRecipients,
+	}
+}
+
+// TaskStructureResponse is a task within the structure of a course.
+type TaskStructureResponse struct {
+	ID        int64  `json:"id" example:"684"`
+	Name      string `json:"name" example:"Task 1"`
+	MaxPoints int    `json:"max_points" example:"23"`
+}
+
+// SheetStructureResponse is a sheet and its tasks within the structure of a
+// course.
+type SheetStructureResponse struct {
+	ID        int64                   `json:"id" example:"13"`
+	Name      string                  `json:"name" example:"Blatt 0"`
+	FileURL   string                  `json:"file_url" example:"/api/v1/sheets/13/file"`
+	PublishAt time.Time               `json:"publish_at" example:"auto"`
+	DueAt     time.Time               `json:"due_at" example:"auto"`
+	Tasks     []TaskStructureResponse `json:"tasks"`
+}
+
+// CourseStructureResponse is the response payload containing all sheets with
+// their tasks and all materials of a course in a single tree.
+type CourseStructureResponse struct {
+	Sheets    []SheetStructureResponse `json:"sheets"`
+	Materials []*MaterialResponse      `json:"materials"`
+}
+
+// Render post-processes a CourseStructureResponse.
+func (body *CourseStructureResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+// newSheetStructureResponse creates a response from a Sheet model and its tasks.
+func newSheetStructureResponse(sheet *model.Sheet, tasks []model.Task) SheetStructureResponse {
+	resp := SheetStructureResponse{
+		ID:        sheet.ID,
+		Name:      sheet.Name,
+		FileURL:   fmt.Sprintf("/api/v1/sheets/%d/file", sheet.ID),
+		PublishAt: sheet.PublishAt,
+		DueAt:     sheet.DueAt,
+		Tasks:     []TaskStructureResponse{},
+	}
+	for _, task := range tasks {
+		resp.Tasks = append(resp.Tasks, TaskStructureResponse{
+			ID:        task.ID,
+			Name:      task.Name,
+			MaxPoints: task.MaxPoints,
+		})
+	}
+	return resp
+}
+
+// CourseDashboardResponse is the response payload summarizing the enrollments
+// and submissions of a course.
+type CourseDashboardResponse struct {
+	Enrollments struct {
+		Students int `json:"students" example:"120"`
+		Tutors   int `json:"tutors" example:"6"`
+		Admins   int `json:"admins" example:"2"`
+	} `json:"enrollments"`
+	Submissions       int     `json:"submissions" example:"840"`
+	Ungraded          int     `json:"ungraded" example:"37"`
+	AveragePoints     float32 `json:"average_points" example:"6.4"`
+	SubmissionsPerDay []struct {
+		Day   string `json:"day" example:"2020-04-21"`
+		Count int    `json:"count" example:"53"`
+	} `json:"submissions_per_day"`
+}
+
+// Render post-processes a CourseDashboardResponse.
+func (body *CourseDashboardResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+// newCourseDashboardResponse creates a response from the statistics of a course.
+func newCourseDashboardResponse(p *model.CourseDashboard, volume []model.SubmissionVolume) *CourseDashboardResponse {
+	response := &CourseDashboardResponse{
+		Submissions:   p.Submissions,
+		Ungraded:      p.Ungraded,
+		AveragePoints: p.AveragePoints,
+		SubmissionsPerDay: []struct {
+			Day   string `json:"day" example:"2020-04-21"`
+			Count int    `json:"count" example:"53"`
+		}{},
+	}
+	response.Enrollments.Students = p.Students
+	response.Enrollments.Tutors = p.Tutors
+	response.Enrollments.Admins = p.Admins
+
+	for _, day := range volume {
+		response.SubmissionsPerDay = append(response.SubmissionsPerDay, struct {
+			Day   string `json:"day" example:"2020-04-21"`
+			Count int    `json:"count" example:"53"`
+		}{day.Day.Format("2006-01-02"), day.Count})
+	}
+
+	return response
+}
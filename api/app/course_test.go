@@ -20,8 +20,19 @@
 package app
 
 import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
 	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -29,6 +40,7 @@ import (
 	"github.com/infomark-org/infomark/api/helper"
 	"github.com/infomark-org/infomark/email"
 	"github.com/infomark-org/infomark/model"
+	null "gopkg.in/guregu/null.v3"
 )
 
 func DBGetInt(tape *Tape, stmt string, param1 int64) (int, error) {
@@ -43,6 +55,37 @@ func DBGetInt2(tape *Tape, stmt string, param1 int64, param2 int64) (int, error)
 	return rsl, err
 }
 
+// rejectingMailer fails to send emails to some addresses.
+type rejectingMailer struct {
+	Rejected map[string]bool
+}
+
+func (m *rejectingMailer) Send(e *email.Email) error {
+	if m.Rejected[e.To] {
+		return errors.New("mailbox unavailable")
+	}
+	return nil
+}
+
+// recordingMailer keeps all emails it has sent.
+type recordingMailer struct {
+	mu   sync.Mutex
+	Sent []email.Email
+}
+
+func (m *recordingMailer) Send(e *email.Email) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.Sent = append(m.Sent, *e)
+	return nil
+}
+
+func (m *recordingMailer) Count() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.Sent)
+}
+
 func TestCourse(t *testing.T) {
 
 	g := goblin.Goblin(t)
@@ -87,6 +130,128 @@ func TestCourse(t *testing.T) {
 			g.Assert(len(coursesActual)).Equal(2)
 		})
 
+		g.It("Should list only the selected fields of courses", func() {
+			w := tape.Get("/api/v1/courses?fields=id,name", adminJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			courses := []map[string]interface{}{}
+			err := json.NewDecoder(w.Body).Decode(&courses)
+			g.Assert(err).Equal(nil)
+			g.Assert(len(courses) > 0).IsTrue()
+			for _, course := range courses {
+				g.Assert(len(course)).Equal(2)
+				_, hasName := course["name"]
+				g.Assert(hasName).IsTrue()
+			}
+
+			w = tape.Get("/api/v1/courses?fields=id,unknown", adminJWT)
+			g.Assert(w.Code).Equal(http.StatusBadRequest)
+		})
+
+		g.It("Should list only courses of the request identity when filtering by role", func() {
+			for _, tc := range []struct {
+				name   string
+				userID int64
+				role   int64
+				jwt    JWTRequest
+			}{
+				{"student", 112, 0, studentJWT},
+				{"tutor", 2, 1, tutorJWT},
+				{"admin", 1, 2, noAdminJWT},
+			} {
+				numberCoursesExpected, err := DBGetInt2(
+					tape,
+					"SELECT count(*) FROM user_course WHERE user_id = $1 and role = $2",
+					tc.userID, tc.role,
+				)
+				g.Assert(err).Equal(nil)
+
+				w := tape.Get("/api/v1/courses?role="+tc.name, tc.jwt)
+				g.Assert(w.Code).Equal(http.StatusOK)
+
+				coursesActual := []CourseResponse{}
+				err = json.NewDecoder(w.Body).Decode(&coursesActual)
+				g.Assert(err).Equal(nil)
+				g.Assert(len(coursesActual)).Equal(numberCoursesExpected)
+
+				for _, course := range coursesActual {
+					role, err := DBGetInt2(
+						tape,
+						"SELECT role FROM user_course WHERE user_id = $1 and course_id = $2",
+						tc.userID, course.ID,
+					)
+					g.Assert(err).Equal(nil)
+					g.Assert(int64(role)).Equal(tc.role)
+				}
+			}
+		})
+
+		g.It("Should reject unknown role filters", func() {
+			w := tape.Get("/api/v1/courses?role=owner", adminJWT)
+			g.Assert(w.Code).Equal(http.StatusBadRequest)
+		})
+
+		g.It("Should return the structure of a course", func() {
+			unpublished, err := stores.Sheet.Create(&model.Sheet{
+				Name:          "Sheet_unpublished",
+				PublishAt:     NowUTC().Add(24 * time.Hour),
+				DueAt:         NowUTC().Add(48 * time.Hour),
+				ScoringPolicy: "latest",
+			}, 1)
+			g.Assert(err).Equal(nil)
+
+			containsUnpublished := func(jwt JWTRequest) bool {
+				w := tape.Get("/api/v1/courses/1/structure", jwt)
+				g.Assert(w.Code).Equal(http.StatusOK)
+
+				structure := &CourseStructureResponse{}
+				err := json.NewDecoder(w.Body).Decode(structure)
+				g.Assert(err).Equal(nil)
+				g.Assert(len(structure.Sheets) > 0).IsTrue()
+
+				for _, sheet := range structure.Sheets {
+					if sheet.ID == unpublished.ID {
+						return true
+					}
+				}
+				return false
+			}
+
+			g.Assert(containsUnpublished(studentJWT)).IsFalse()
+			g.Assert(containsUnpublished(tutorJWT)).IsTrue()
+			g.Assert(containsUnpublished(noAdminJWT)).IsTrue()
+
+			// tasks are nested into their sheets
+			sheets, err := stores.Sheet.SheetsOfCourse(1)
+			g.Assert(err).Equal(nil)
+			tasks, err := stores.Task.TasksOfSheet(sheets[0].ID)
+			g.Assert(err).Equal(nil)
+
+			w := tape.Get("/api/v1/courses/1/structure", tutorJWT)
+			structure := &CourseStructureResponse{}
+			err = json.NewDecoder(w.Body).Decode(structure)
+			g.Assert(err).Equal(nil)
+			for _, sheet := range structure.Sheets {
+				if sheet.ID == sheets[0].ID {
+					g.Assert(len(sheet.Tasks)).Equal(len(tasks))
+				}
+			}
+		})
+
+		g.It("Should paginate courses and keep other query parameters", func() {
+			w := tape.Get("/api/v1/courses?role=admin&per_page=1", noAdminJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			coursesActual := []CourseResponse{}
+			err := json.NewDecoder(w.Body).Decode(&coursesActual)
+			g.Assert(err).Equal(nil)
+			g.Assert(len(coursesActual)).Equal(1)
+
+			link := w.Header().Get("Link")
+			g.Assert(strings.Contains(link, `</api/v1/courses?page=1&per_page=1&role=admin>; rel="first"`)).IsTrue()
+			g.Assert(strings.Contains(link, `rel="prev"`)).IsFalse()
+		})
+
 		g.It("Should get a specific course", func() {
 
 			w := tape.Get("/api/v1/courses/1", adminJWT)
@@ -180,6 +345,267 @@ func TestCourse(t *testing.T) {
 			g.Assert(len(enrollmentsActual)).Equal(numberEnrollmentsExpected)
 		})
 
+		g.It("Should paginate enrollments sorted by name", func() {
+			w := tape.Get("/api/v1/courses/1/enrollments?roles=1", noAdminJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+			tutorsExpected := []EnrollmentResponse{}
+			err := json.NewDecoder(w.Body).Decode(&tutorsExpected)
+			g.Assert(err).Equal(nil)
+			g.Assert(len(tutorsExpected) > 4).IsTrue()
+
+			w = tape.Get("/api/v1/courses/1/enrollments?roles=1&per_page=3&page=2", noAdminJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+			tutorsActual := []EnrollmentResponse{}
+			err = json.NewDecoder(w.Body).Decode(&tutorsActual)
+			g.Assert(err).Equal(nil)
+			g.Assert(len(tutorsActual)).Equal(3)
+
+			for k, tutor := range tutorsActual {
+				g.Assert(tutor.Role).Equal(int64(1))
+				g.Assert(tutor.User.ID).Equal(tutorsExpected[3+k].User.ID)
+			}
+
+			link := w.Header().Get("Link")
+			g.Assert(strings.Contains(link, `</api/v1/courses/1/enrollments?page=1&per_page=3&roles=1>; rel="prev"`)).IsTrue()
+			g.Assert(strings.Contains(link, `rel="next"`)).IsTrue()
+		})
+
+		g.It("Should export the roster as CSV", func() {
+			w := tape.Get("/api/v1/courses/1/roster.csv", studentJWT)
+			g.Assert(w.Code).Equal(http.StatusForbidden)
+
+			numberEnrollmentsExpected, err := DBGetInt(
+				tape,
+				"SELECT count(*) FROM user_course WHERE course_id = $1",
+				1,
+			)
+			g.Assert(err).Equal(nil)
+
+			numberStudentsExpected, err := DBGetInt(
+				tape,
+				"SELECT count(*) FROM user_course WHERE course_id = $1 and role = 0",
+				1,
+			)
+			g.Assert(err).Equal(nil)
+
+			w = tape.Get("/api/v1/courses/1/roster.csv", noAdminJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+			g.Assert(strings.HasPrefix(w.Header().Get("Content-Type"), "text/csv")).IsTrue()
+
+			records, err := csv.NewReader(w.Body).ReadAll()
+			g.Assert(err).Equal(nil)
+			g.Assert(records[0]).Equal([]string{"name", "email", "student_number", "role", "enrolled_at"})
+			g.Assert(len(records)).Equal(numberEnrollmentsExpected + 1)
+
+			numberStudentsActual := 0
+			for _, record := range records[1:] {
+				if record[3] == "student" {
+					numberStudentsActual++
+				}
+			}
+			g.Assert(numberStudentsActual).Equal(numberStudentsExpected)
+		})
+
+		g.It("Should restrict the roster of tutors to their own groups", func() {
+			group, err := stores.Group.Create(&model.Group{TutorID: 2, CourseID: 1, Description: "Tutorial B"})
+			g.Assert(err).Equal(nil)
+
+			_, err = stores.Group.CreateGroupEnrollmentOfUserInCourse(&model.GroupEnrollment{UserID: 112, GroupID: group.ID})
+			g.Assert(err).Equal(nil)
+
+			// a student in several groups of the tutor is listed once
+			secondGroup, err := stores.Group.Create(&model.Group{TutorID: 2, CourseID: 1, Description: "Tutorial C"})
+			g.Assert(err).Equal(nil)
+			_, err = stores.Group.CreateGroupEnrollmentOfUserInCourse(&model.GroupEnrollment{UserID: 112, GroupID: secondGroup.ID})
+			g.Assert(err).Equal(nil)
+
+			student, err := stores.User.Get(112)
+			g.Assert(err).Equal(nil)
+
+			numberMembersExpected, err := DBGetInt(
+				tape,
+				`SELECT count(DISTINCT ug.user_id) FROM user_group ug
+INNER JOIN groups g ON g.id = ug.group_id
+INNER JOIN user_course uc ON uc.user_id = ug.user_id AND uc.course_id = g.course_id
+WHERE g.tutor_id = 2 AND g.course_id = $1`,
+				1,
+			)
+			g.Assert(err).Equal(nil)
+
+			numberEnrollments, err := DBGetInt(
+				tape,
+				"SELECT count(*) FROM user_course WHERE course_id = $1",
+				1,
+			)
+			g.Assert(err).Equal(nil)
+			g.Assert(numberMembersExpected < numberEnrollments).IsTrue()
+
+			w := tape.Get("/api/v1/courses/1/roster.csv", tutorJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+			records, err := csv.NewReader(w.Body).ReadAll()
+			g.Assert(err).Equal(nil)
+			g.Assert(len(records)).Equal(numberMembersExpected + 1)
+
+			occurrences := 0
+			for _, record := range records {
+				if record[1] == student.Email {
+					occurrences++
+				}
+			}
+			g.Assert(occurrences).Equal(1)
+
+			// admins can filter by a single group
+			w = tape.Get(fmt.Sprintf("/api/v1/courses/1/roster.csv?group_id=%d", group.ID), adminJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+			records, err = csv.NewReader(w.Body).ReadAll()
+			g.Assert(err).Equal(nil)
+			g.Assert(len(records)).Equal(2)
+			g.Assert(records[1][3]).Equal("student")
+
+			// groups of other tutors are off limits
+			otherGroupID, err := DBGetInt(
+				tape,
+				"SELECT id FROM groups WHERE course_id = $1 AND tutor_id <> 2 ORDER BY id LIMIT 1",
+				1,
+			)
+			g.Assert(err).Equal(nil)
+			w = tape.Get(fmt.Sprintf("/api/v1/courses/1/roster.csv?group_id=%d", otherGroupID), tutorJWT)
+			g.Assert(w.Code).Equal(http.StatusForbidden)
+		})
+
+		g.It("Should export the grade book as XLSX", func() {
+			w := tape.Get("/api/v1/courses/1/gradebook.xlsx", studentJWT)
+			g.Assert(w.Code).Equal(http.StatusForbidden)
+
+			w = tape.Get("/api/v1/courses/1/gradebook.xlsx", adminJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+			g.Assert(w.Header().Get("Content-Type")).Equal("application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+
+			body := w.Body.Bytes()
+			archive, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+			g.Assert(err).Equal(nil)
+
+			files := make(map[string]string)
+			for _, file := range archive.File {
+				reader, err := file.Open()
+				g.Assert(err).Equal(nil)
+				content, err := ioutil.ReadAll(reader)
+				g.Assert(err).Equal(nil)
+				reader.Close()
+				files[file.Name] = string(content)
+			}
+
+			workbook := struct {
+				Sheets []struct {
+					Name string `xml:"name,attr"`
+				} `xml:"sheets>sheet"`
+			}{}
+			g.Assert(xml.Unmarshal([]byte(files["xl/workbook.xml"]), &workbook)).Equal(nil)
+
+			sheets, err := stores.Sheet.SheetsOfCourse(1)
+			g.Assert(err).Equal(nil)
+			g.Assert(len(sheets) > 0).IsTrue()
+
+			expectedTabs := []string{"Summary"}
+			for _, sheet := range sheets {
+				expectedTabs = append(expectedTabs, sheet.Name)
+			}
+			actualTabs := []string{}
+			for _, sheet := range workbook.Sheets {
+				actualTabs = append(actualTabs, sheet.Name)
+			}
+			g.Assert(actualTabs).Equal(expectedTabs)
+
+			for k := range expectedTabs {
+				_, ok := files[fmt.Sprintf("xl/worksheets/sheet%d.xml", k+1)]
+				g.Assert(ok).IsTrue()
+			}
+
+			numberStudentsExpected, err := DBGetInt(
+				tape,
+				"SELECT count(*) FROM user_course WHERE course_id = $1 and role = 0",
+				1,
+			)
+			g.Assert(err).Equal(nil)
+			g.Assert(strings.Count(files["xl/worksheets/sheet1.xml"], "<row ")).Equal(numberStudentsExpected + 1)
+		})
+
+		g.It("Should preview bulk enrollments without enrolling anyone", func() {
+			var outsiderID int64
+			err := tape.DB.Get(&outsiderID, `
+SELECT id FROM users
+WHERE id NOT IN (SELECT user_id FROM user_course WHERE course_id = 1)
+ORDER BY id LIMIT 1`)
+			g.Assert(err).Equal(nil)
+
+			outsider, err := stores.User.Get(outsiderID)
+			g.Assert(err).Equal(nil)
+			student, err := stores.User.Get(112)
+			g.Assert(err).Equal(nil)
+
+			file, err := ioutil.TempFile("", "enrollments-*.csv")
+			g.Assert(err).Equal(nil)
+			defer os.Remove(file.Name())
+			writer := csv.NewWriter(file)
+			writer.WriteAll([][]string{
+				{"email"},
+				{strings.ToUpper(outsider.Email)},
+				{student.Email},
+				{"nobody@uni-tuebingen.de"},
+				{outsider.Email},
+			})
+			file.Close()
+
+			numberEnrollmentsBefore, err := DBGetInt(tape, "SELECT count(*) FROM user_course WHERE course_id = $1", 1)
+			g.Assert(err).Equal(nil)
+
+			w, err := tape.Upload("/api/v1/courses/1/enrollments/bulk?dry_run=true", file.Name(), "text/csv", tutorJWT)
+			g.Assert(err).Equal(nil)
+			g.Assert(w.Code).Equal(http.StatusForbidden)
+
+			resultsOf := func(w *httptest.ResponseRecorder) []string {
+				g.Assert(w.Code).Equal(http.StatusOK)
+				resp := BulkEnrollmentResponse{}
+				err := json.NewDecoder(w.Body).Decode(&resp)
+				g.Assert(err).Equal(nil)
+
+				results := []string{}
+				for _, row := range resp.Rows {
+					results = append(results, row.Result)
+				}
+				return results
+			}
+
+			w, err = tape.Upload("/api/v1/courses/1/enrollments/bulk?dry_run=true", file.Name(), "text/csv", adminJWT)
+			g.Assert(err).Equal(nil)
+			g.Assert(resultsOf(w)).Equal([]string{
+				BulkEnrollmentWouldEnroll,
+				BulkEnrollmentAlready,
+				BulkEnrollmentUnknown,
+				BulkEnrollmentAlready,
+			})
+
+			numberEnrollmentsAfter, err := DBGetInt(tape, "SELECT count(*) FROM user_course WHERE course_id = $1", 1)
+			g.Assert(err).Equal(nil)
+			g.Assert(numberEnrollmentsAfter).Equal(numberEnrollmentsBefore)
+
+			_, err = stores.Course.GetUserEnrollment(1, outsider.ID)
+			g.Assert(err != nil).IsTrue()
+
+			w, err = tape.Upload("/api/v1/courses/1/enrollments/bulk", file.Name(), "text/csv", adminJWT)
+			g.Assert(err).Equal(nil)
+			g.Assert(resultsOf(w)).Equal([]string{
+				BulkEnrollmentEnrolled,
+				BulkEnrollmentAlready,
+				BulkEnrollmentUnknown,
+				BulkEnrollmentAlready,
+			})
+
+			enrollment, err := stores.Course.GetUserEnrollment(1, outsider.ID)
+			g.Assert(err).Equal(nil)
+			g.Assert(enrollment.Role).Equal(int64(0))
+		})
+
 		g.It("Should be able to filter enrollments (students+tutors only)", func() {
 			courseActive, err := stores.Course.Get(1)
 			g.Assert(err).Equal(nil)
@@ -304,6 +730,125 @@ func TestCourse(t *testing.T) {
 			g.Assert(w.Code).Equal(http.StatusOK)
 		})
 
+		g.It("Should reject emails with unknown template variables", func() {
+			w := tape.Post("/api/v1/courses/1/emails", H{
+				"subject": "Hello {{.first_name}}",
+				"body":    "Your nickname is {{.nickname}}",
+			}, adminJWT)
+			g.Assert(w.Code).Equal(http.StatusBadRequest)
+			g.Assert(strings.Contains(w.Body.String(), "nickname")).IsTrue()
+
+			w = tape.Post("/api/v1/courses/1/emails", H{
+				"subject": "Hello {{.first_name}}",
+				"body":    "Welcome to {{.course_name}}",
+			}, adminJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+		})
+
+		g.It("Should track the progress of an email sent to the course", func() {
+			recipients, err := stores.Course.EnrolledUsers(1,
+				[]string{"0", "1", "2"}, "%%", "%%", "%%", "%%", "%%")
+			g.Assert(err).Equal(nil)
+			g.Assert(len(recipients) > 2).IsTrue()
+
+			// the mailer rejects the first two recipients
+			mailer := &rejectingMailer{Rejected: map[string]bool{
+				recipients[0].Email: true,
+				recipients[1].Email: true,
+			}}
+			defer func() { email.DefaultMail = email.VoidMail }()
+			email.DefaultMail = mailer
+
+			w := tape.Post("/api/v1/courses/1/emails", H{
+				"subject": "subj",
+				"body":    "text",
+			}, adminJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			broadcast := EmailBroadcastResponse{}
+			err = json.NewDecoder(w.Body).Decode(&broadcast)
+			g.Assert(err).Equal(nil)
+			g.Assert(broadcast.Recipients).Equal(len(recipients))
+
+			url := fmt.Sprintf("/api/v1/courses/1/emails/%d", broadcast.ID)
+
+			w = tape.Get(url, tutorJWT)
+			g.Assert(w.Code).Equal(http.StatusForbidden)
+
+			// emails are sent in the background
+			status := EmailBroadcastStatusResponse{}
+			for k := 0; k < 50; k++ {
+				w = tape.Get(url, adminJWT)
+				g.Assert(w.Code).Equal(http.StatusOK)
+				status = EmailBroadcastStatusResponse{}
+				err = json.NewDecoder(w.Body).Decode(&status)
+				g.Assert(err).Equal(nil)
+				if status.Queued == 0 {
+					break
+				}
+				time.Sleep(100 * time.Millisecond)
+			}
+
+			g.Assert(status.Subject).Equal("subj")
+			g.Assert(status.Queued).Equal(0)
+			g.Assert(status.Sent).Equal(len(recipients) - 2)
+			g.Assert(status.Failed).Equal(2)
+			g.Assert(len(status.FailedRecipients)).Equal(2)
+			g.Assert(mailer.Rejected[status.FailedRecipients[0]]).IsTrue()
+			g.Assert(mailer.Rejected[status.FailedRecipients[1]]).IsTrue()
+
+			w = tape.Get("/api/v1/courses/1/emails/999999", adminJWT)
+			g.Assert(w.Code).Equal(http.StatusNotFound)
+		})
+
+		g.It("Should send course emails from the address of the course", func() {
+			course, err := stores.Course.Get(1)
+			g.Assert(err).Equal(nil)
+
+			entrySent := H{
+				"name":                course.Name,
+				"description":         course.Description,
+				"begins_at":           course.BeginsAt,
+				"ends_at":             course.EndsAt,
+				"required_percentage": course.RequiredPercentage,
+				"email_from":          "not-an-address",
+			}
+
+			w := tape.Put("/api/v1/courses/1", entrySent, adminJWT)
+			g.Assert(w.Code).Equal(http.StatusBadRequest)
+
+			entrySent["email_from"] = "info2@uni-tuebingen.de"
+			entrySent["reply_to"] = "info2-tutors@uni-tuebingen.de"
+			w = tape.Put("/api/v1/courses/1", entrySent, adminJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			mailer := &recordingMailer{}
+			defer func() { email.DefaultMail = email.VoidMail }()
+			email.DefaultMail = mailer
+
+			w = tape.Post("/api/v1/courses/1/emails?roles=2", H{
+				"subject": "subj",
+				"body":    "text",
+			}, adminJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			broadcast := EmailBroadcastResponse{}
+			err = json.NewDecoder(w.Body).Decode(&broadcast)
+			g.Assert(err).Equal(nil)
+			g.Assert(broadcast.Recipients > 0).IsTrue()
+
+			// emails are sent in the background
+			for k := 0; k < 50 && mailer.Count() < broadcast.Recipients; k++ {
+				time.Sleep(100 * time.Millisecond)
+			}
+			g.Assert(mailer.Count()).Equal(broadcast.Recipients)
+
+			for _, sent := range mailer.Sent {
+				g.Assert(sent.From).Equal("info2@uni-tuebingen.de")
+				g.Assert(sent.ReplyTo).Equal("info2-tutors@uni-tuebingen.de")
+			}
+		})
+
 		g.It("Changes should require access claims", func() {
 			w := tape.Put("/api/v1/courses/1", H{})
 			g.Assert(w.Code).Equal(http.StatusUnauthorized)
@@ -431,6 +976,44 @@ func TestCourse(t *testing.T) {
 
 		})
 
+		g.It("Should only disenroll students within the disenrollment period", func() {
+			course, err := stores.Course.Get(1)
+			g.Assert(err).Equal(nil)
+
+			// the period is over
+			course.DisenrollUntil = null.TimeFrom(NowUTC().Add(-time.Hour))
+			g.Assert(stores.Course.Update(course)).Equal(nil)
+
+			w := tape.Delete("/api/v1/courses/1/enrollments", studentJWT)
+			g.Assert(w.Code).Equal(http.StatusForbidden)
+
+			_, err = stores.Course.GetUserEnrollment(1, 112)
+			g.Assert(err).Equal(nil)
+
+			// the period is still running
+			course.DisenrollUntil = null.TimeFrom(NowUTC().Add(time.Hour))
+			g.Assert(stores.Course.Update(course)).Equal(nil)
+
+			w = tape.Delete("/api/v1/courses/1/enrollments", studentJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			_, err = stores.Course.GetUserEnrollment(1, 112)
+			g.Assert(err != nil).IsTrue()
+		})
+
+		g.It("Should let admins disenroll students after the disenrollment period", func() {
+			course, err := stores.Course.Get(1)
+			g.Assert(err).Equal(nil)
+			course.DisenrollUntil = null.TimeFrom(NowUTC().Add(-time.Hour))
+			g.Assert(stores.Course.Update(course)).Equal(nil)
+
+			w := tape.Delete("/api/v1/courses/1/enrollments/112", noAdminJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			_, err = stores.Course.GetUserEnrollment(1, 112)
+			g.Assert(err != nil).IsTrue()
+		})
+
 		g.It("Can disenroll a specific user from course", func() {
 
 			courseID := int64(1)
@@ -567,6 +1150,48 @@ func TestCourse(t *testing.T) {
 
 		})
 
+		g.It("Should notify promoted users and reject invalid roles", func() {
+			mailer := &recordingMailer{}
+			defer func() { email.DefaultMail = email.VoidMail }()
+			email.DefaultMail = mailer
+
+			w := tape.Put("/api/v1/courses/1/enrollments/112", H{"role": 3}, noAdminJWT)
+			g.Assert(w.Code).Equal(http.StatusBadRequest)
+
+			w = tape.Put("/api/v1/courses/1/enrollments/112", H{"role": 1}, noAdminJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			// emails are sent in the background
+			for k := 0; k < 50 && mailer.Count() < 1; k++ {
+				time.Sleep(100 * time.Millisecond)
+			}
+			g.Assert(mailer.Count()).Equal(1)
+			student, err := stores.User.Get(112)
+			g.Assert(err).Equal(nil)
+			g.Assert(mailer.Sent[0].To).Equal(student.Email)
+			g.Assert(strings.Contains(mailer.Sent[0].Body, "You are now tutor")).IsTrue()
+		})
+
+		g.It("Should not demote the last admin of a course", func() {
+			w := tape.Put("/api/v1/courses/1/enrollments/1", H{"role": 0}, noAdminJWT)
+			g.Assert(w.Code).Equal(http.StatusBadRequest)
+
+			// with a second admin the first one can step down
+			w = tape.Put("/api/v1/courses/1/enrollments/2", H{"role": 2}, noAdminJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			w = tape.Put("/api/v1/courses/1/enrollments/1", H{"role": 1}, noAdminJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			var role int64
+			err := tape.DB.Get(&role,
+				"SELECT role FROM user_course WHERE course_id = $1 and user_id = $2",
+				1, 1,
+			)
+			g.Assert(err).Equal(nil)
+			g.Assert(role).Equal(int64(1))
+		})
+
 		g.It("Permission test", func() {
 			url := "/api/v1/courses/1"
 
@@ -591,6 +1216,213 @@ func TestCourse(t *testing.T) {
 			g.Assert(w.Code).Equal(http.StatusForbidden)
 		})
 
+		g.It("Should list the courses a student can enroll in", func() {
+			createCourse := func(name string, course *model.Course) *model.Course {
+				course.Name = name
+				course.Description = name
+				course.BeginsAt = NowUTC()
+				course.EndsAt = NowUTC().Add(time.Hour * 24 * 90)
+				created, err := stores.Course.Create(course)
+				g.Assert(err).Equal(nil)
+				return created
+			}
+
+			open := createCourse("Open", &model.Course{MaxStudents: 2})
+			full := createCourse("Full", &model.Course{MaxStudents: 1})
+			closed := createCourse("Closed", &model.Course{EnrollmentEndsAt: null.TimeFrom(NowUTC().Add(-time.Hour))})
+			upcoming := createCourse("Upcoming", &model.Course{EnrollmentBeginsAt: null.TimeFrom(NowUTC().Add(time.Hour))})
+			g.Assert(stores.Course.Enroll(full.ID, 113, 0)).Equal(nil)
+
+			availableIDs := func() map[int64]bool {
+				w := tape.Get("/api/v1/courses/available", studentJWT)
+				g.Assert(w.Code).Equal(http.StatusOK)
+				courses := []CourseResponse{}
+				err := json.NewDecoder(w.Body).Decode(&courses)
+				g.Assert(err).Equal(nil)
+
+				ids := make(map[int64]bool)
+				for _, course := range courses {
+					ids[course.ID] = true
+				}
+				return ids
+			}
+
+			ids := availableIDs()
+			g.Assert(ids[open.ID]).IsTrue()
+			g.Assert(ids[full.ID]).IsFalse()
+			g.Assert(ids[closed.ID]).IsFalse()
+			g.Assert(ids[upcoming.ID]).IsFalse()
+
+			// courses the student is enrolled in already
+			enrolled, err := stores.Course.CoursesOfUserWithRole(112, 0)
+			g.Assert(err).Equal(nil)
+			g.Assert(len(enrolled) > 0).IsTrue()
+			for _, course := range enrolled {
+				g.Assert(ids[course.ID]).IsFalse()
+			}
+
+			// enrolling respects the same limits
+			w := tape.Post(fmt.Sprintf("/api/v1/courses/%d/enrollments", full.ID), H{}, studentJWT)
+			g.Assert(w.Code).Equal(http.StatusBadRequest)
+			w = tape.Post(fmt.Sprintf("/api/v1/courses/%d/enrollments", closed.ID), H{}, studentJWT)
+			g.Assert(w.Code).Equal(http.StatusBadRequest)
+			w = tape.Post(fmt.Sprintf("/api/v1/courses/%d/enrollments", open.ID), H{}, studentJWT)
+			g.Assert(w.Code).Equal(http.StatusCreated)
+
+			ids = availableIDs()
+			g.Assert(ids[open.ID]).IsFalse()
+
+			// the open course is full after a second student
+			g.Assert(stores.Course.Enroll(open.ID, 114, 0)).Equal(nil)
+			w = tape.Get("/api/v1/courses/available", tape.NewJWTRequest(113, false))
+			g.Assert(w.Code).Equal(http.StatusOK)
+			courses := []CourseResponse{}
+			err = json.NewDecoder(w.Body).Decode(&courses)
+			g.Assert(err).Equal(nil)
+			for _, course := range courses {
+				g.Assert(course.ID != open.ID).IsTrue()
+			}
+		})
+
+		g.It("Should require the enrollment code if the course has one", func() {
+			course, err := stores.Course.Create(&model.Course{
+				Name:        "Secret",
+				Description: "Secret",
+				BeginsAt:    NowUTC(),
+				EndsAt:      NowUTC().Add(time.Hour * 24 * 90),
+			})
+			g.Assert(err).Equal(nil)
+			url := fmt.Sprintf("/api/v1/courses/%d/enrollment_code", course.ID)
+
+			// only admins of the course manage the code
+			w := tape.Post(url, H{}, studentJWT)
+			g.Assert(w.Code).Equal(http.StatusForbidden)
+
+			w = tape.Post(url, H{}, adminJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+			code := EnrollmentCodeResponse{}
+			err = json.NewDecoder(w.Body).Decode(&code)
+			g.Assert(err).Equal(nil)
+			g.Assert(code.Code.Valid).IsTrue()
+			g.Assert(len(code.Code.String)).Equal(32)
+
+			// regenerating replaces the code
+			w = tape.Post(url, H{}, adminJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+			newCode := EnrollmentCodeResponse{}
+			err = json.NewDecoder(w.Body).Decode(&newCode)
+			g.Assert(err).Equal(nil)
+			g.Assert(newCode.Code.String != code.Code.String).IsTrue()
+
+			enrollURL := fmt.Sprintf("/api/v1/courses/%d/enroll", course.ID)
+
+			w = tape.Post(enrollURL, H{}, studentJWT)
+			g.Assert(w.Code).Equal(http.StatusForbidden)
+			w = tape.Post(enrollURL, H{"code": "wrong"}, studentJWT)
+			g.Assert(w.Code).Equal(http.StatusForbidden)
+			w = tape.Post(enrollURL, H{"code": code.Code.String}, studentJWT)
+			g.Assert(w.Code).Equal(http.StatusForbidden)
+			w = tape.Post(fmt.Sprintf("/api/v1/courses/%d/enrollments", course.ID), H{}, studentJWT)
+			g.Assert(w.Code).Equal(http.StatusForbidden)
+
+			_, err = stores.Course.GetUserEnrollment(course.ID, 112)
+			g.Assert(err != nil).IsTrue()
+
+			w = tape.Post(enrollURL, H{"code": newCode.Code.String}, studentJWT)
+			g.Assert(w.Code).Equal(http.StatusCreated)
+
+			enrollment, err := stores.Course.GetUserEnrollment(course.ID, 112)
+			g.Assert(err).Equal(nil)
+			g.Assert(enrollment.Role).Equal(int64(0))
+
+			// without a code everyone can enroll again
+			w = tape.Delete(url, adminJWT)
+			g.Assert(w.Code).Equal(http.StatusNoContent)
+			w = tape.Post(enrollURL, H{}, tape.NewJWTRequest(113, false))
+			g.Assert(w.Code).Equal(http.StatusCreated)
+		})
+
+		g.It("Should summarize enrollments and submissions on the dashboard", func() {
+			course, err := stores.Course.Create(&model.Course{
+				Name:     "Dashboard",
+				BeginsAt: NowUTC(),
+				EndsAt:   NowUTC().Add(time.Hour * 24 * 90),
+			})
+			g.Assert(err).Equal(nil)
+
+			for _, userID := range []int64{112, 113, 114} {
+				g.Assert(stores.Course.Enroll(course.ID, userID, 0)).Equal(nil)
+			}
+			g.Assert(stores.Course.Enroll(course.ID, 2, 1)).Equal(nil)
+			g.Assert(stores.Course.Enroll(course.ID, 1, 2)).Equal(nil)
+
+			sheet, err := stores.Sheet.Create(&model.Sheet{
+				Name:          "Sheet",
+				PublishAt:     NowUTC(),
+				DueAt:         NowUTC(),
+				ScoringPolicy: "latest",
+			}, course.ID)
+			g.Assert(err).Equal(nil)
+
+			seeds := []struct {
+				userID         int64
+				taskIdx        int
+				createdAt      time.Time
+				acquiredPoints int
+				feedback       string
+			}{
+				{112, 0, time.Date(2020, 5, 1, 10, 0, 0, 0, time.UTC), 8, ""},
+				{113, 0, time.Date(2020, 5, 1, 12, 0, 0, 0, time.UTC), 2, "almost"},
+				{114, 0, time.Date(2020, 5, 3, 9, 0, 0, 0, time.UTC), 0, ""},
+				{112, 1, time.Date(2020, 5, 3, 23, 0, 0, 0, time.UTC), 5, "ok"},
+			}
+
+			tasks := []*model.Task{}
+			for k := 0; k < 2; k++ {
+				task, err := stores.Task.Create(&model.Task{Name: fmt.Sprintf("Task %d", k), MaxPoints: 10}, sheet.ID)
+				g.Assert(err).Equal(nil)
+				tasks = append(tasks, task)
+			}
+
+			for _, seed := range seeds {
+				submission, err := stores.Submission.Create(&model.Submission{UserID: seed.userID, TaskID: tasks[seed.taskIdx].ID})
+				g.Assert(err).Equal(nil)
+				_, err = tape.DB.Exec("UPDATE submissions SET created_at = $2 WHERE id = $1", submission.ID, seed.createdAt)
+				g.Assert(err).Equal(nil)
+				_, err = stores.Grade.Create(&model.Grade{
+					TutorID:        2,
+					SubmissionID:   submission.ID,
+					AcquiredPoints: seed.acquiredPoints,
+					Feedback:       seed.feedback,
+				})
+				g.Assert(err).Equal(nil)
+			}
+
+			url := fmt.Sprintf("/api/v1/courses/%d/dashboard", course.ID)
+
+			w := tape.Get(url, studentJWT)
+			g.Assert(w.Code).Equal(http.StatusForbidden)
+
+			w = tape.Get(url, tutorJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			dashboard := CourseDashboardResponse{}
+			err = json.NewDecoder(w.Body).Decode(&dashboard)
+			g.Assert(err).Equal(nil)
+			g.Assert(dashboard.Enrollments.Students).Equal(3)
+			g.Assert(dashboard.Enrollments.Tutors).Equal(1)
+			g.Assert(dashboard.Enrollments.Admins).Equal(1)
+			g.Assert(dashboard.Submissions).Equal(4)
+			g.Assert(dashboard.Ungraded).Equal(1)
+			g.Assert(dashboard.AveragePoints).Equal(float32(5))
+
+			g.Assert(len(dashboard.SubmissionsPerDay)).Equal(2)
+			g.Assert(dashboard.SubmissionsPerDay[0].Day).Equal("2020-05-01")
+			g.Assert(dashboard.SubmissionsPerDay[0].Count).Equal(2)
+			g.Assert(dashboard.SubmissionsPerDay[1].Day).Equal("2020-05-03")
+			g.Assert(dashboard.SubmissionsPerDay[1].Count).Equal(2)
+		})
+
 		g.AfterEach(func() {
 			tape.AfterEach()
 		})
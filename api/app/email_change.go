@@ -0,0 +1,101 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package app
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/infomark-org/infomark/configuration"
+	"github.com/infomark-org/infomark/email"
+	"github.com/infomark-org/infomark/model"
+	null "gopkg.in/guregu/null.v3"
+)
+
+// ExpireEmailChanges restores the previous email address of all users who did
+// not confirm a changed address within the configured window. Users whose
+// window is about to end are reminded once. It returns the number of reverted
+// changes and sent reminders.
+func ExpireEmailChanges(stores *Stores) (int, int, error) {
+	window := configuration.Configuration.Server.Authentication.Email.ChangeWindow
+	reminder := configuration.Configuration.Server.Authentication.Email.ChangeReminder
+
+	if window <= 0 {
+		return 0, 0, nil
+	}
+
+	users, err := stores.User.GetPendingEmailChanges()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	reverted, reminded := 0, 0
+	for k := range users {
+		user := &users[k]
+		expiresAt := user.EmailChangedAt.Time.Add(window)
+
+		switch {
+		case !NowUTC().Before(expiresAt):
+			if user.PreviousEmail.Valid {
+				user.Email = user.PreviousEmail.String
+				user.ConfirmEmailToken = null.String{}
+			}
+			user.ClearPendingEmailChange()
+			if err := stores.User.Update(user); err != nil {
+				return reverted, reminded, err
+			}
+			reverted++
+
+		case reminder > 0 && !user.EmailChangeRemindedAt.Valid && !NowUTC().Before(expiresAt.Add(-reminder)):
+			if err := sendEmailChangeReminder(stores, user, expiresAt); err != nil {
+				return reverted, reminded, err
+			}
+			user.EmailChangeRemindedAt = null.TimeFrom(NowUTC())
+			if err := stores.User.Update(user); err != nil {
+				return reverted, reminded, err
+			}
+			reminded++
+		}
+	}
+
+	return reverted, reminded, nil
+}
+
+// sendEmailChangeReminder asks the user to confirm the new email address
+// before the change expires.
+func sendEmailChangeReminder(stores *Stores, user *model.User, expiresAt time.Time) error {
+	tpl := email.Localize(email.EmailChangeReminderTemplates, LanguageOfUser(user, nil))
+
+	msg, err := email.NewEmailFromTemplate(configuration.Configuration.Server.Email.From,
+		user.Email,
+		tpl.Subject,
+		tpl.Body,
+		map[string]string{
+			"first_name":            user.FirstName,
+			"last_name":             user.LastName,
+			"confirm_email_url":     fmt.Sprintf("%s/#/confirmation", configuration.Configuration.Server.ExternalURL()),
+			"confirm_email_address": user.Email,
+			"confirm_email_token":   user.ConfirmEmailToken.String,
+			"expires_at":            expiresAt.UTC().Format("2006-01-02 15:04 MST"),
+		})
+	if err != nil {
+		return err
+	}
+
+	return sendUserEmail(stores, user.ID, model.EmailKindEmailChangeReminder, msg)
+}
@@ -0,0 +1,65 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package app
+
+import (
+	"github.com/infomark-org/infomark/email"
+	"github.com/infomark-org/infomark/model"
+	"github.com/infomark-org/infomark/symbol"
+)
+
+// logUserEmail adds the email to the email log of the user. The state of the
+// entry is updated once the mailer reports the outcome.
+func logUserEmail(stores *Stores, userID int64, kind string, msg *email.Email) error {
+	entry, err := stores.Email.CreateLogEntry(&model.EmailLogEntry{
+		UserID: userID,
+		Kind:   kind,
+		Email:  msg.To,
+		State:  int(symbol.EmailDeliveryQueued),
+	})
+	if err != nil {
+		return err
+	}
+
+	msg.Done = func(err error) {
+		if err != nil {
+			stores.Email.UpdateLogEntryState(entry.ID, symbol.EmailDeliveryFailed)
+			return
+		}
+		stores.Email.UpdateLogEntryState(entry.ID, symbol.EmailDeliverySent)
+	}
+	return nil
+}
+
+// sendUserEmail sends an email to a user right away and logs it.
+func sendUserEmail(stores *Stores, userID int64, kind string, msg *email.Email) error {
+	if err := logUserEmail(stores, userID, kind, msg); err != nil {
+		return err
+	}
+	return email.Deliver(msg)
+}
+
+// queueUserEmail hands an email to a user over to the background sender and
+// logs it.
+func queueUserEmail(stores *Stores, userID int64, kind string, msg *email.Email) error {
+	if err := logUserEmail(stores, userID, kind, msg); err != nil {
+		return err
+	}
+	email.OutgoingEmailsChannel <- msg
+	return nil
+}
@@ -0,0 +1,95 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2019 ComputerGraphics Tuebingen
+//               2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package app
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/middleware"
+	"github.com/infomark-org/infomark/configuration"
+	"github.com/infomark-org/infomark/symbol"
+)
+
+// EnvelopeHeader lets a client choose per request whether successful
+// responses are wrapped in an Envelope. Without it, the server-wide setting
+// applies.
+const EnvelopeHeader = "X-Envelope"
+
+// Envelope wraps a response body for clients expecting "data" and "meta".
+type Envelope struct {
+	Data interface{}  `json:"data"`
+	Meta EnvelopeMeta `json:"meta"`
+}
+
+// EnvelopeMeta holds everything of a response which is not part of the
+// resource itself.
+type EnvelopeMeta struct {
+	RequestID  string          `json:"request_id,omitempty"`
+	Pagination *PaginationMeta `json:"pagination,omitempty"`
+}
+
+// PaginationMeta describes the page of a paginated list.
+type PaginationMeta struct {
+	Page     int `json:"page"`
+	PerPage  int `json:"per_page"`
+	Total    int `json:"total"`
+	LastPage int `json:"last_page"`
+}
+
+// wantsEnvelope reports whether the response to the request should be
+// wrapped in an Envelope.
+func wantsEnvelope(r *http.Request) bool {
+	if enabled, err := strconv.ParseBool(r.Header.Get(EnvelopeHeader)); err == nil {
+		return enabled
+	}
+	return configuration.Configuration.Server.HTTP.Envelope
+}
+
+// EnvelopeMiddleware provides the meta data of the envelope, which handlers
+// fill while handling the request. As the response depends on the
+// EnvelopeHeader, caches are told to tell them apart.
+func EnvelopeMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", EnvelopeHeader)
+		ctx := context.WithValue(r.Context(), symbol.CtxKeyEnvelopeMeta, &EnvelopeMeta{})
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// setPaginationMeta remembers the page of a list for the envelope of the
+// response.
+func setPaginationMeta(r *http.Request, page *PaginationMeta) {
+	if meta, ok := r.Context().Value(symbol.CtxKeyEnvelopeMeta).(*EnvelopeMeta); ok {
+		meta.Pagination = page
+	}
+}
+
+// newEnvelope wraps a response body together with the meta data collected
+// while handling the request.
+func newEnvelope(r *http.Request, v interface{}) *Envelope {
+	envelope := &Envelope{Data: v}
+	if meta, ok := r.Context().Value(symbol.CtxKeyEnvelopeMeta).(*EnvelopeMeta); ok {
+		envelope.Meta = *meta
+	}
+	envelope.Meta.RequestID = middleware.GetReqID(r.Context())
+	return envelope
+}
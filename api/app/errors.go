@@ -22,8 +22,11 @@ package app
 import (
 	"net/http"
 
+	"github.com/go-chi/chi/middleware"
 	"github.com/go-chi/render"
 	validation "github.com/go-ozzo/ozzo-validation"
+	"github.com/infomark-org/infomark/auth"
+	"github.com/infomark-org/infomark/symbol"
 )
 
 // ErrResponse renderer type for handling all sorts of errors.
@@ -31,10 +34,11 @@ type ErrResponse struct {
 	Err            error `json:"-"` // low-level runtime error
 	HTTPStatusCode int   `json:"-"` // http response status code
 
-	StatusText       string            `json:"status"`           // user-level status message
-	AppCode          int64             `json:"code,omitempty"`   // application-specific error code
-	ErrorText        string            `json:"error,omitempty"`  // application-level error message, for debugging
-	ValidationErrors validation.Errors `json:"errors,omitempty"` // user level model validation errors
+	StatusText       string            `json:"status"`               // user-level status message
+	AppCode          int64             `json:"code,omitempty"`       // application-specific error code
+	ErrorText        string            `json:"error,omitempty"`      // application-level error message, for debugging
+	ValidationErrors validation.Errors `json:"errors,omitempty"`     // user level model validation errors
+	RequestID        string            `json:"request_id,omitempty"` // id to find the request in the logs
 }
 
 // Render sets the application-specific error code in AppCode.
@@ -43,6 +47,37 @@ func (e *ErrResponse) Render(w http.ResponseWriter, r *http.Request) error {
 	return nil
 }
 
+// RequestIDResponder attaches the id of the request to every error response.
+// When users report an error, we can find the corresponding log entry.
+// All other responses are reduced to the selected fields and wrapped in an
+// Envelope if requested.
+func RequestIDResponder(w http.ResponseWriter, r *http.Request, v interface{}) {
+	requestID := middleware.GetReqID(r.Context())
+
+	// the predefined errors are shared, hence we work on a copy
+	switch e := v.(type) {
+	case *ErrResponse:
+		copied := *e
+		copied.RequestID = requestID
+		v = &copied
+	case *auth.ErrResponse:
+		copied := *e
+		copied.RequestID = requestID
+		v = &copied
+	default:
+		if fields, ok := r.Context().Value(symbol.CtxKeyFields).([]string); ok {
+			if projected, err := projectFields(v, fields); err == nil {
+				v = projected
+			}
+		}
+		if wantsEnvelope(r) {
+			v = newEnvelope(r, v)
+		}
+	}
+
+	render.DefaultResponder(w, r, v)
+}
+
 // ErrRender returns status 422 Unprocessable Entity rendering response error.
 func ErrRender(err error) render.Renderer {
 	return &ErrResponse{
@@ -94,6 +129,31 @@ func ErrUnauthorizedWithDetails(err error) *ErrResponse {
 	}
 }
 
+// ErrConflictWithDetails returns status 409 with a text
+// e.g. "the student number is already used by another account"
+func ErrConflictWithDetails(err error) *ErrResponse {
+	return &ErrResponse{
+		Err:            err,
+		HTTPStatusCode: http.StatusConflict,
+		StatusText:     http.StatusText(http.StatusConflict),
+		ErrorText:      err.Error(),
+	}
+}
+
+// Application-specific error codes, which let clients react to an error
+// without parsing the error message.
+const (
+	// AppCodeEmailNotConfirmed means the credentials are correct, but the email
+	// address of the account has not been confirmed yet.
+	AppCodeEmailNotConfirmed int64 = 1001
+	// AppCodeCaptchaRequired means there were too many failed logins from the
+	// address of the client, which has to solve a captcha to try again.
+	AppCodeCaptchaRequired int64 = 1002
+	// AppCodeSecondFactorRequired means the identity provider confirmed the
+	// identity, but the account requires the second factor as well.
+	AppCodeSecondFactorRequired int64 = 1003
+)
+
 // see https://stackoverflow.com/a/50143519/7443104
 var (
 	// ErrBadRequest returns status 400 Bad Request for malformed request body.
@@ -110,8 +170,28 @@ var (
 	// ErrNotFound returns status 404 Not Found for invalid resource request.
 	ErrNotFound = &ErrResponse{HTTPStatusCode: http.StatusNotFound, StatusText: http.StatusText(http.StatusNotFound)}
 
+	// ErrEmailNotConfirmed returns status 400 Bad Request for a login to an
+	// account whose email address is not confirmed yet.
+	ErrEmailNotConfirmed = &ErrResponse{HTTPStatusCode: http.StatusBadRequest, StatusText: http.StatusText(http.StatusBadRequest),
+		AppCode: AppCodeEmailNotConfirmed, ErrorText: "email not confirmed, please follow the link in the confirmation email"}
+
+	// ErrCaptchaRequired returns status 400 Bad Request for a login without a
+	// valid captcha token after too many failed attempts.
+	ErrCaptchaRequired = &ErrResponse{HTTPStatusCode: http.StatusBadRequest, StatusText: http.StatusText(http.StatusBadRequest),
+		AppCode: AppCodeCaptchaRequired, ErrorText: "too many failed logins, please solve the captcha"}
+
+	// ErrSecondFactorRequired returns status 400 Bad Request for a login via the
+	// identity provider to an account with two-factor authentication.
+	ErrSecondFactorRequired = &ErrResponse{HTTPStatusCode: http.StatusBadRequest, StatusText: http.StatusText(http.StatusBadRequest),
+		AppCode: AppCodeSecondFactorRequired, ErrorText: "two-factor code is required to finish the login"}
+
 	// ErrInternalServerError returns status 500 Internal Server Error.
 	ErrInternalServerError = &ErrResponse{HTTPStatusCode: http.StatusInternalServerError, StatusText: http.StatusText(http.StatusInternalServerError)}
+
+	// ErrServiceUnavailable returns status 503 Service Unavailable when the
+	// server is too busy to handle the request.
+	ErrServiceUnavailable = &ErrResponse{HTTPStatusCode: http.StatusServiceUnavailable, StatusText: http.StatusText(http.StatusServiceUnavailable),
+		ErrorText: "the server is busy, please try again later"}
 )
 
 // StatusContinue                      = 100 // RFC 7231, 6.2.1
@@ -0,0 +1,132 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2019 ComputerGraphics Tuebingen
+//               2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/go-chi/render"
+	"github.com/infomark-org/infomark/symbol"
+)
+
+// SelectFields lets clients ask for a part of the resources only, e.g.
+// "?fields=id,first_name". The names are validated against the JSON fields of
+// the given response type. Lists are projected element-wise.
+func SelectFields(response interface{}) func(next http.Handler) http.Handler {
+	allowed := jsonFieldNames(reflect.TypeOf(response))
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			param := r.URL.Query().Get("fields")
+			if param == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			fields := []string{}
+			for _, name := range strings.Split(param, ",") {
+				name = strings.TrimSpace(name)
+				if name == "" {
+					continue
+				}
+				if !allowed[name] {
+					render.Render(w, r, ErrBadRequestWithDetails(fmt.Errorf("unknown field \"%s\"", name)))
+					return
+				}
+				fields = append(fields, name)
+			}
+
+			ctx := context.WithValue(r.Context(), symbol.CtxKeyFields, fields)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// jsonFieldNames collects the names of all fields of a struct in its JSON
+// representation.
+func jsonFieldNames(t reflect.Type) map[string]bool {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	names := map[string]bool{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if field.Anonymous && name == "" {
+			for embedded := range jsonFieldNames(field.Type) {
+				names[embedded] = true
+			}
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		names[name] = true
+	}
+	return names
+}
+
+// projectFields keeps only the given fields of a resource or of each resource
+// in a list.
+func projectFields(v interface{}, fields []string) (interface{}, error) {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	// numbers are kept as they are, e.g. large ids
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	var decoded interface{}
+	if err := decoder.Decode(&decoded); err != nil {
+		return nil, err
+	}
+
+	switch value := decoded.(type) {
+	case map[string]interface{}:
+		return pickFields(value, fields), nil
+	case []interface{}:
+		for k, item := range value {
+			if resource, ok := item.(map[string]interface{}); ok {
+				value[k] = pickFields(resource, fields)
+			}
+		}
+		return value, nil
+	}
+	return decoded, nil
+}
+
+func pickFields(resource map[string]interface{}, fields []string) map[string]interface{} {
+	picked := map[string]interface{}{}
+	for _, name := range fields {
+		if value, ok := resource[name]; ok {
+			picked[name] = value
+		}
+	}
+	return picked
+}
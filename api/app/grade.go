@@ -21,8 +21,12 @@ package app
 
 import (
 	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"math"
 	"net/http"
 	"strconv"
 
@@ -31,19 +35,25 @@ import (
 	"github.com/infomark-org/infomark/api/helper"
 	"github.com/infomark-org/infomark/auth/authenticate"
 	"github.com/infomark-org/infomark/auth/authorize"
+	"github.com/infomark-org/infomark/configuration"
+	"github.com/infomark-org/infomark/event"
 	"github.com/infomark-org/infomark/model"
 	"github.com/infomark-org/infomark/symbol"
+	"github.com/sirupsen/logrus"
+	null "gopkg.in/guregu/null.v3"
 )
 
 // GradeResource specifies Grade management handler.
 type GradeResource struct {
 	Stores *Stores
+	Events *event.Bus
 }
 
 // NewGradeResource create and returns a GradeResource.
-func NewGradeResource(stores *Stores) *GradeResource {
+func NewGradeResource(stores *Stores, events *event.Bus) *GradeResource {
 	return &GradeResource{
 		Stores: stores,
+		Events: events,
 	}
 }
 
@@ -83,8 +93,14 @@ func (rs *GradeResource) EditHandler(w http.ResponseWriter, r *http.Request) {
 
 	currentGrade.Feedback = data.Feedback
 	currentGrade.AcquiredPoints = data.AcquiredPoints
+	// the points of the tutor are final, even if they are lower
+	currentGrade.BestPoints = currentGrade.AcquiredPoints
 
 	currentGrade.TutorID = accessClaims.LoginID
+	first := !currentGrade.GradedAt.Valid
+	if first {
+		currentGrade.GradedAt = null.TimeFrom(NowUTC())
+	}
 
 	// update database entry
 	if err := rs.Stores.Grade.Update(currentGrade); err != nil {
@@ -92,6 +108,9 @@ func (rs *GradeResource) EditHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	course := r.Context().Value(symbol.CtxKeyCourse).(*model.Course)
+	rs.Events.Publish(event.SubmissionGraded{CourseID: course.ID, Grade: currentGrade, First: first})
+
 	render.Status(r, http.StatusNoContent)
 }
 
@@ -109,9 +128,36 @@ func (rs *GradeResource) EditHandler(w http.ResponseWriter, r *http.Request) {
 func (rs *GradeResource) GetByIDHandler(w http.ResponseWriter, r *http.Request) {
 	course := r.Context().Value(symbol.CtxKeyCourse).(*model.Course)
 	currentGrade := r.Context().Value(symbol.CtxKeyGrade).(*model.Grade)
+	givenRole := r.Context().Value(symbol.CtxKeyCourseRole).(authorize.CourseRole)
+
+	sheet, err := rs.Stores.Task.IdentifySheetOfTask(currentGrade.TaskID)
+	if err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
+	resp := newGradeResponse(currentGrade, course.ID)
+	if hidesIdentities(r, course, sheet) {
+		resp.User = newAnonymousGradeUserResponse(course.ID, sheet.ID, currentGrade.UserID)
+	}
+
+	publicTestCases, err := rs.Stores.Grade.TestCasesOfGrade(currentGrade.ID, "public")
+	if err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+	resp.PublicTestCases = newTestCaseListResponse(publicTestCases, givenRole)
+	resp.HiddenTestCases = newHiddenTestCaseResponse(publicTestCases)
+
+	privateTestCases, err := rs.Stores.Grade.TestCasesOfGrade(currentGrade.ID, "private")
+	if err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+	resp.PrivateTestCases = newTestCaseListResponse(privateTestCases, givenRole)
 
 	// return Material information of created entry
-	if err := render.Render(w, r, newGradeResponse(currentGrade, course.ID)); err != nil {
+	if err := render.Render(w, r, resp); err != nil {
 		render.Render(w, r, ErrRender(err))
 		return
 	}
@@ -119,6 +165,52 @@ func (rs *GradeResource) GetByIDHandler(w http.ResponseWriter, r *http.Request)
 	render.Status(r, http.StatusNoContent)
 }
 
+// partialCredit scales the max points of a task by the share of passed test
+// cases.
+func partialCredit(passed int, total int, maxPoints int) int {
+	if total == 0 {
+		return 0
+	}
+	return int(math.Round(float64(passed) * float64(maxPoints) / float64(total)))
+}
+
+// checkWorkerResult verifies a result pushed by a background worker against
+// the task it belongs to, such that a malformed result never ends up in the
+// points table. Results reporting test cases but no points get partial credit
+// for the passed test cases. Results exceeding the max points of the task are
+// kept as failed tests without points, such that the log stays available. It
+// returns false if the result could not be checked. In this case the response
+// has already been written.
+func (rs *GradeResource) checkWorkerResult(w http.ResponseWriter, r *http.Request,
+	data *GradeFromWorkerRequest, grade *model.Grade, submission *model.Submission) bool {
+	if !data.Points.Valid && len(data.TestCases) == 0 {
+		return true
+	}
+
+	task, err := rs.Stores.Task.Get(submission.TaskID)
+	if err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return false
+	}
+
+	if !data.Points.Valid {
+		data.Points = null.IntFrom(int64(partialCredit(data.PassedTestCases(), len(data.TestCases), task.MaxPoints)))
+	}
+
+	if data.Points.Int64 > int64(task.MaxPoints) {
+		err := fmt.Errorf("points %d exceed the max points %d of the task", data.Points.Int64, task.MaxPoints)
+		logrus.WithFields(logrus.Fields{
+			"module":   "grade",
+			"grade_id": grade.ID,
+			"task_id":  task.ID,
+		}).Warn(err)
+		data.Status = symbol.TestingResultFailed
+		data.Points = null.Int{}
+	}
+
+	return true
+}
+
 // PublicResultEditHandler is public endpoint for
 // URL: /courses/{course_id}/grades/{grade_id}/public_result
 // URLPARAM: course_id,integer
@@ -148,37 +240,26 @@ func (rs *GradeResource) PublicResultEditHandler(w http.ResponseWriter, r *http.
 		return
 	}
 
-	if data.Status != symbol.TestingResultSuccess {
-		totalDockerFailExitCounterVec.WithLabelValues(
-			fmt.Sprintf("%d", submission.TaskID),
-			"public",
-		).Inc()
-
-	} else {
-		totalDockerSuccessExitCounterVec.WithLabelValues(
-			fmt.Sprintf("%d", submission.TaskID),
-			"public",
-		).Inc()
+	if isSupersededResult(data, currentGrade) {
+		rs.Events.Publish(event.TestResultDiscarded{TaskID: submission.TaskID, Kind: "public"})
+		render.Render(w, r, ErrConflictWithDetails(errors.New("the submission has been changed since this result was requested")))
+		return
 	}
 
-	totalTime := data.FinishedAt.Sub(data.EnqueuedAt)
-	runTime := data.FinishedAt.Sub(data.StartedAt)
-	waitTime := data.StartedAt.Sub(data.EnqueuedAt)
-
-	totalDockerTimeHist.WithLabelValues(
-		fmt.Sprintf("%d", submission.TaskID),
-		"public",
-	).Observe(totalTime.Seconds())
-
-	totalDockerRunTimeHist.WithLabelValues(
-		fmt.Sprintf("%d", submission.TaskID),
-		"public",
-	).Observe(runTime.Seconds())
+	if !rs.checkWorkerResult(w, r, data, currentGrade, submission) {
+		rs.Events.Publish(event.TestResultDiscarded{TaskID: submission.TaskID, Kind: "public"})
+		return
+	}
 
-	totalDockerWaitTimeHist.WithLabelValues(
-		fmt.Sprintf("%d", submission.TaskID),
-		"public",
-	).Observe(waitTime.Seconds())
+	rs.Events.Publish(event.TestResultReceived{
+		TaskID:     submission.TaskID,
+		Kind:       "public",
+		Success:    data.Status == symbol.TestingResultSuccess,
+		TimedOut:   data.Status == symbol.TestingResultTimeout,
+		EnqueuedAt: data.EnqueuedAt,
+		StartedAt:  data.StartedAt,
+		FinishedAt: data.FinishedAt,
+	})
 	// currentGrade.PublicTestLog = data.Log
 	// currentGrade.PublicTestStatus = data.Status
 	// currentGrade.PublicExecutionState = 2
@@ -186,11 +267,19 @@ func (rs *GradeResource) PublicResultEditHandler(w http.ResponseWriter, r *http.
 	render.Status(r, http.StatusNoContent)
 
 	// update database entry
-	if err := rs.Stores.Grade.UpdatePublicTestInfo(currentGrade.ID, data.Log, data.Status); err != nil {
+	if err := rs.Stores.Grade.UpdatePublicTestInfo(currentGrade.ID, data.Log, data.Diff, data.Status, NowUTC()); err != nil {
 		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
 		return
 	}
 
+	if err := rs.Stores.Grade.ReplaceTestCases(currentGrade.ID, "public", data.testCaseModels()); err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
+	// only the private tests award points, the public ones are a preview
+	// for the students
+
 }
 
 // PrivateResultEditHandler is public endpoint for
@@ -222,37 +311,26 @@ func (rs *GradeResource) PrivateResultEditHandler(w http.ResponseWriter, r *http
 		return
 	}
 
-	if data.Status != symbol.TestingResultSuccess {
-		totalDockerFailExitCounterVec.WithLabelValues(
-			fmt.Sprintf("%d", submission.TaskID),
-			"private",
-		).Inc()
-
-	} else {
-		totalDockerSuccessExitCounterVec.WithLabelValues(
-			fmt.Sprintf("%d", submission.TaskID),
-			"private",
-		).Inc()
+	if isSupersededResult(data, currentGrade) {
+		rs.Events.Publish(event.TestResultDiscarded{TaskID: submission.TaskID, Kind: "private"})
+		render.Render(w, r, ErrConflictWithDetails(errors.New("the submission has been changed since this result was requested")))
+		return
 	}
 
-	totalTime := data.FinishedAt.Sub(data.EnqueuedAt)
-	runTime := data.FinishedAt.Sub(data.StartedAt)
-	waitTime := data.StartedAt.Sub(data.EnqueuedAt)
-
-	totalDockerTimeHist.WithLabelValues(
-		fmt.Sprintf("%d", submission.TaskID),
-		"private",
-	).Observe(totalTime.Seconds())
-
-	totalDockerRunTimeHist.WithLabelValues(
-		fmt.Sprintf("%d", submission.TaskID),
-		"private",
-	).Observe(runTime.Seconds())
+	if !rs.checkWorkerResult(w, r, data, currentGrade, submission) {
+		rs.Events.Publish(event.TestResultDiscarded{TaskID: submission.TaskID, Kind: "private"})
+		return
+	}
 
-	totalDockerWaitTimeHist.WithLabelValues(
-		fmt.Sprintf("%d", submission.TaskID),
-		"private",
-	).Observe(waitTime.Seconds())
+	rs.Events.Publish(event.TestResultReceived{
+		TaskID:     submission.TaskID,
+		Kind:       "private",
+		Success:    data.Status == symbol.TestingResultSuccess,
+		TimedOut:   data.Status == symbol.TestingResultTimeout,
+		EnqueuedAt: data.EnqueuedAt,
+		StartedAt:  data.StartedAt,
+		FinishedAt: data.FinishedAt,
+	})
 
 	// currentGrade.PrivateTestLog = data.Log
 	// currentGrade.PrivateTestStatus = data.Status
@@ -265,11 +343,23 @@ func (rs *GradeResource) PrivateResultEditHandler(w http.ResponseWriter, r *http
 	render.Status(r, http.StatusNoContent)
 
 	// update database entry
-	if err := rs.Stores.Grade.UpdatePrivateTestInfo(currentGrade.ID, data.Log, data.Status); err != nil {
+	if err := rs.Stores.Grade.UpdatePrivateTestInfo(currentGrade.ID, data.Log, data.Status, NowUTC()); err != nil {
 		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
 		return
 	}
 
+	if err := rs.Stores.Grade.ReplaceTestCases(currentGrade.ID, "private", data.testCaseModels()); err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
+	if data.Points.Valid {
+		if err := rs.Stores.Grade.UpdateAutograderPoints(currentGrade.ID, int(data.Points.Int64)); err != nil {
+			render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+			return
+		}
+	}
+
 }
 
 // IndexHandler is public endpoint for
@@ -293,6 +383,9 @@ func (rs *GradeResource) PrivateResultEditHandler(w http.ResponseWriter, r *http
 // RESPONSE: 401,Unauthenticated
 // RESPONSE: 403,Unauthorized
 // SUMMARY:  Query grades in a course
+// DESCRIPTION:
+// Under anonymous grading, tutors get pseudonyms instead of the students of
+// sheets whose grades are not published and cannot filter by "user_id".
 func (rs *GradeResource) IndexHandler(w http.ResponseWriter, r *http.Request) {
 	course := r.Context().Value(symbol.CtxKeyCourse).(*model.Course)
 
@@ -314,6 +407,16 @@ func (rs *GradeResource) IndexHandler(w http.ResponseWriter, r *http.Request) {
 	filterPublicExecutationState := helper.IntFromURL(r, "public_execution_state", -1)
 	filterPrivateExecutationState := helper.IntFromURL(r, "private_execution_state", -1)
 
+	hidden, err := anonymousTasks(rs.Stores, r, course)
+	if err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+	if filterUserID != 0 && len(hidden) > 0 {
+		render.Render(w, r, ErrBadRequestWithDetails(errAnonymousUserFilter))
+		return
+	}
+
 	submissions, err := rs.Stores.Grade.GetFiltered(
 		course.ID,
 		filterSheetID,
@@ -334,7 +437,7 @@ func (rs *GradeResource) IndexHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// render JSON response
-	if err = render.RenderList(w, r, newGradeListResponse(submissions, course.ID)); err != nil {
+	if err = render.RenderList(w, r, newGradeListResponse(submissions, course.ID, hidden)); err != nil {
 		render.Render(w, r, ErrRender(err))
 		return
 	}
@@ -355,6 +458,9 @@ func (rs *GradeResource) IndexHandler(w http.ResponseWriter, r *http.Request) {
 // RESPONSE: 403,Unauthorized
 // SUMMARY:  Query grades in a course
 // DESCRIPTION:
+// Tutors only get the grades of the members of their own groups. Under
+// anonymous grading, they get pseudonyms instead of the students as long as
+// the grades of any sheet are not published.
 // {"sheets":[{"id":179,"name":"1"},{"id":180,"name":"2"}],"achievements":[{"user_info":{"id":42,"first_name":"Sören","last_name":"Haase","student_number":"1161"},"points":[5,0]},{"user_info":{"id":43,"first_name":"Resi","last_name":"Naser","student_number":"1000"},"points":[8,7]}]}
 func (rs *GradeResource) IndexSummaryHandler(w http.ResponseWriter, r *http.Request) {
 	course := r.Context().Value(symbol.CtxKeyCourse).(*model.Course)
@@ -362,7 +468,17 @@ func (rs *GradeResource) IndexSummaryHandler(w http.ResponseWriter, r *http.Requ
 
 	givenRole := r.Context().Value(symbol.CtxKeyCourseRole).(authorize.CourseRole)
 
-	grades, err := rs.Stores.Grade.GetOverviewGrades(course.ID, filterGroupID)
+	groupIDs, err := visibleGroupIDs(rs.Stores, r, filterGroupID)
+	if err == errGroupNotVisible {
+		render.Render(w, r, ErrUnauthorizedWithDetails(err))
+		return
+	}
+	if err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
+	grades, err := rs.Stores.Grade.GetOverviewGrades(course.ID, groupIDs)
 	if err != nil {
 		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
 		return
@@ -374,8 +490,23 @@ func (rs *GradeResource) IndexSummaryHandler(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
+	hidden, err := anonymousTasks(rs.Stores, r, course)
+	if err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
+	resp := newGradeOverviewResponse(grades, sheets, givenRole)
+	if len(hidden) > 0 {
+		for k := range resp.Achievements {
+			resp.Achievements[k].User = UserInfo{
+				AnonymousID: anonymousID(course.ID, 0, resp.Achievements[k].User.ID),
+			}
+		}
+	}
+
 	// render JSON response
-	if err = render.Render(w, r, newGradeOverviewResponse(grades, sheets, givenRole)); err != nil {
+	if err = render.Render(w, r, resp); err != nil {
 		render.Render(w, r, ErrRender(err))
 		return
 	}
@@ -407,8 +538,14 @@ func (rs *GradeResource) IndexMissingHandler(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
+	hidden, err := anonymousTasks(rs.Stores, r, course)
+	if err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
 	// render JSON response
-	if err = render.RenderList(w, r, newMissingGradeListResponse(grades)); err != nil {
+	if err = render.RenderList(w, r, newMissingGradeListResponse(grades, hidden)); err != nil {
 		render.Render(w, r, ErrRender(err))
 		return
 	}
@@ -417,6 +554,60 @@ func (rs *GradeResource) IndexMissingHandler(w http.ResponseWriter, r *http.Requ
 
 }
 
+// errAnonymousUserFilter is returned when tutors try to look up the solutions
+// of a specific student during anonymous grading.
+var errAnonymousUserFilter = errors.New("user_id cannot be used during anonymous grading")
+
+// hidesIdentities tests whether the students who submitted solutions to the
+// sheet have to be replaced by pseudonyms for the request identity. Under
+// anonymous grading this applies to tutors until the grades of the sheet are
+// published.
+func hidesIdentities(r *http.Request, course *model.Course, sheet *model.Sheet) bool {
+	givenRole := r.Context().Value(symbol.CtxKeyCourseRole).(authorize.CourseRole)
+	return givenRole == authorize.TUTOR && course.AnonymousGrading && !sheet.GradesPublished
+}
+
+// anonymousTasks maps the tasks of the course, whose students are hidden from
+// the request identity, to their sheets. Views spanning the whole course hide
+// the students as long as it is not empty.
+func anonymousTasks(stores *Stores, r *http.Request, course *model.Course) (map[int64]int64, error) {
+	hidden := make(map[int64]int64)
+
+	givenRole := r.Context().Value(symbol.CtxKeyCourseRole).(authorize.CourseRole)
+	if givenRole != authorize.TUTOR || !course.AnonymousGrading {
+		return hidden, nil
+	}
+
+	sheets, err := stores.Sheet.SheetsOfCourse(course.ID)
+	if err != nil {
+		return nil, err
+	}
+	for k := range sheets {
+		if !hidesIdentities(r, course, &sheets[k]) {
+			continue
+		}
+		tasks, err := stores.Task.TasksOfSheet(sheets[k].ID)
+		if err != nil {
+			return nil, err
+		}
+		for _, task := range tasks {
+			hidden[task.ID] = sheets[k].ID
+		}
+	}
+	return hidden, nil
+}
+
+// anonymousID is the pseudonym of a student within a sheet, or within the
+// whole course if sheetID is 0. It is stable, such that tutors can tell apart
+// the solutions of different students, but does not reveal the user. As the
+// pseudonyms differ between sheets, revealing the students of a published
+// sheet does not reveal them in the other sheets.
+func anonymousID(courseID int64, sheetID int64, userID int64) string {
+	mac := hmac.New(sha256.New, []byte(configuration.Configuration.Server.Authentication.JWT.Secret))
+	fmt.Fprintf(mac, "anonymous-grading\n%d\n%d\n%d", courseID, sheetID, userID)
+	return "student-" + hex.EncodeToString(mac.Sum(nil))[:12]
+}
+
 // .............................................................................
 
 // Context middleware is used to load an Grade object from
@@ -20,11 +20,14 @@
 package app
 
 import (
+	"errors"
 	"net/http"
 	"time"
 
 	validation "github.com/go-ozzo/ozzo-validation"
+	"github.com/infomark-org/infomark/model"
 	"github.com/infomark-org/infomark/symbol"
+	null "gopkg.in/guregu/null.v3"
 )
 
 // GradeRequest is the request payload for submission management.
@@ -63,10 +66,44 @@ func (body *GradeRequest) Validate() error {
 // after completion.
 type GradeFromWorkerRequest struct {
 	Log        string               `json:"log" example:"failed in line ..."`
+	Diff       string               `json:"diff" example:"-expected\n+actual" required:"false"`
 	Status     symbol.TestingResult `json:"status" example:"1"`
 	EnqueuedAt time.Time            `json:"enqueued_at"`
 	StartedAt  time.Time            `json:"started_at"`
 	FinishedAt time.Time            `json:"finished_at"`
+	Points     null.Int             `json:"points" example:"4" required:"false"`
+	TestCases  []TestCaseRequest    `json:"test_cases" required:"false"`
+}
+
+// TestCaseRequest is the outcome of a single test case reported by a worker.
+type TestCaseRequest struct {
+	Name   string `json:"name" example:"test_empty_input"`
+	Passed bool   `json:"passed" example:"true"`
+	Hidden bool   `json:"hidden" example:"false" required:"false"`
+}
+
+// PassedTestCases counts the passed test cases of a result.
+func (body *GradeFromWorkerRequest) PassedTestCases() int {
+	passed := 0
+	for _, testCase := range body.TestCases {
+		if testCase.Passed {
+			passed++
+		}
+	}
+	return passed
+}
+
+// testCaseModels converts the reported test cases into database models.
+func (body *GradeFromWorkerRequest) testCaseModels() []model.GradeTestCase {
+	testCases := []model.GradeTestCase{}
+	for _, testCase := range body.TestCases {
+		testCases = append(testCases, model.GradeTestCase{
+			Name:   testCase.Name,
+			Passed: testCase.Passed,
+			Hidden: testCase.Hidden,
+		})
+	}
+	return testCases
 }
 
 // Bind preprocesses a GradeRequest.
@@ -76,10 +113,31 @@ func (body *GradeFromWorkerRequest) Bind(r *http.Request) error {
 
 // Validate validates an incoming GradeFromWorkerRequest.
 func (body *GradeFromWorkerRequest) Validate() error {
-	return validation.ValidateStruct(body,
+	err := validation.ValidateStruct(body,
 		validation.Field(
 			&body.Log,
 			validation.Required,
 		),
+		validation.Field(
+			&body.Status,
+			validation.In(
+				symbol.TestingResultSuccess,
+				symbol.TestingResultFailed,
+				symbol.TestingResultTimeout,
+			),
+		),
 	)
+
+	if err == nil {
+		if body.Points.Valid && body.Points.Int64 < 0 {
+			return errors.New("points must not be negative")
+		}
+		for _, testCase := range body.TestCases {
+			if testCase.Name == "" {
+				return errors.New("test cases require a name")
+			}
+		}
+	}
+
+	return err
 }
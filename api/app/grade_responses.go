@@ -35,24 +35,86 @@ import (
 
 // GradeResponse is the response payload for Grade management.
 type GradeResponse struct {
-	ID                    int64  `json:"id" example:"1"`
-	PublicExecutionState  int    `json:"public_execution_state" example:"1"`
-	PrivateExecutionState int    `json:"private_execution_state" example:"1"`
-	PublicTestLog         string `json:"public_test_log" example:"Lorem Ipsum"`
-	PrivateTestLog        string `json:"private_test_log" example:"Lorem Ipsum"`
-	PublicTestStatus      int    `json:"public_test_status" example:"1"`
-	PrivateTestStatus     int    `json:"private_test_status" example:"0"`
-	AcquiredPoints        int    `json:"acquired_points" example:"19"`
-	Feedback              string `json:"feedback" example:"Some feedback"`
-	TutorID               int64  `json:"tutor_id" example:"2"`
-	SubmissionID          int64  `json:"submission_id" example:"31"`
-	FileURL               string `json:"file_url" example:"/api/v1/submissions/61/file"`
-	User                  *struct {
-		ID        int64  `json:"id" example:"1"`
-		FirstName string `json:"first_name" example:"Max"`
-		LastName  string `json:"last_name" example:"Mustermensch"`
-		Email     string `json:"email" example:"test@unit-tuebingen.de"`
-	} `json:"user"`
+	ID                    int64                  `json:"id" example:"1"`
+	PublicExecutionState  int                    `json:"public_execution_state" example:"1"`
+	PrivateExecutionState int                    `json:"private_execution_state" example:"1"`
+	PublicTestLog         string                 `json:"public_test_log" example:"Lorem Ipsum"`
+	PrivateTestLog        string                 `json:"private_test_log" example:"Lorem Ipsum"`
+	PublicTestStatus      int                    `json:"public_test_status" example:"1"`
+	PrivateTestStatus     int                    `json:"private_test_status" example:"0"`
+	AcquiredPoints        int                    `json:"acquired_points" example:"19"`
+	Feedback              string                 `json:"feedback" example:"Some feedback"`
+	TutorID               int64                  `json:"tutor_id" example:"2"`
+	SubmissionID          int64                  `json:"submission_id" example:"31"`
+	FileURL               string                 `json:"file_url" example:"/api/v1/submissions/61/file"`
+	User                  *GradeUserResponse     `json:"user"`
+	PublicTestCases       []TestCaseResponse     `json:"public_test_cases"`
+	PrivateTestCases      []TestCaseResponse     `json:"private_test_cases"`
+	HiddenTestCases       HiddenTestCaseResponse `json:"hidden_test_cases"`
+	// GradingInProgress is true while the points and feedback are withheld.
+	GradingInProgress bool `json:"grading_in_progress" example:"false"`
+}
+
+// GradeUserResponse is the student who submitted the graded solution. Under
+// anonymous grading, only the pseudonym of the student is given.
+type GradeUserResponse struct {
+	ID          int64  `json:"id" example:"1"`
+	FirstName   string `json:"first_name" example:"Max"`
+	LastName    string `json:"last_name" example:"Mustermensch"`
+	Email       string `json:"email" example:"test@unit-tuebingen.de"`
+	AnonymousID string `json:"anonymous_id,omitempty" example:"student-3fa9c2d1e04b"`
+}
+
+// newAnonymousGradeUserResponse creates a response hiding the identity of the
+// student.
+func newAnonymousGradeUserResponse(courseID int64, sheetID int64, userID int64) *GradeUserResponse {
+	return &GradeUserResponse{AnonymousID: anonymousID(courseID, sheetID, userID)}
+}
+
+// TestCaseResponse is the outcome of a single test case of an automated test.
+type TestCaseResponse struct {
+	Name   string `json:"name" example:"test_empty_input"`
+	Passed bool   `json:"passed" example:"true"`
+	Hidden bool   `json:"hidden" example:"false"`
+}
+
+// HiddenTestCaseResponse aggregates the public test cases which are hidden
+// from students.
+type HiddenTestCaseResponse struct {
+	Total  int `json:"total" example:"4"`
+	Passed int `json:"passed" example:"3"`
+}
+
+// newTestCaseListResponse creates a response from a list of test case models.
+// Unless staff requests the list, hidden test cases are left out.
+func newTestCaseListResponse(testCases []model.GradeTestCase, givenRole authorize.CourseRole) []TestCaseResponse {
+	list := []TestCaseResponse{}
+	for _, testCase := range testCases {
+		if testCase.Hidden && givenRole == authorize.STUDENT {
+			continue
+		}
+		list = append(list, TestCaseResponse{
+			Name:   testCase.Name,
+			Passed: testCase.Passed,
+			Hidden: testCase.Hidden,
+		})
+	}
+	return list
+}
+
+// newHiddenTestCaseResponse aggregates the hidden test cases of a list.
+func newHiddenTestCaseResponse(testCases []model.GradeTestCase) HiddenTestCaseResponse {
+	resp := HiddenTestCaseResponse{}
+	for _, testCase := range testCases {
+		if !testCase.Hidden {
+			continue
+		}
+		resp.Total++
+		if testCase.Passed {
+			resp.Passed++
+		}
+	}
+	return resp
 }
 
 // Render post-processes a GradeResponse.
@@ -72,12 +134,7 @@ func newGradeResponse(p *model.Grade, courseID int64) *GradeResponse {
 		)
 	}
 
-	user := &struct {
-		ID        int64  `json:"id" example:"1"`
-		FirstName string `json:"first_name" example:"Max"`
-		LastName  string `json:"last_name" example:"Mustermensch"`
-		Email     string `json:"email" example:"test@unit-tuebingen.de"`
-	}{
+	user := &GradeUserResponse{
 		ID:        p.UserID,
 		FirstName: p.UserFirstName,
 		LastName:  p.UserLastName,
@@ -98,14 +155,21 @@ func newGradeResponse(p *model.Grade, courseID int64) *GradeResponse {
 		User:                  user,
 		SubmissionID:          p.SubmissionID,
 		FileURL:               fileURL,
+		PublicTestCases:       []TestCaseResponse{},
+		PrivateTestCases:      []TestCaseResponse{},
 	}
 }
 
-// newGradeListResponse creates a response from a list of Grade models.
-func newGradeListResponse(Grades []model.Grade, courseID int64) []render.Renderer {
+// newGradeListResponse creates a response from a list of Grade models. The
+// students of the tasks in hidden are replaced by pseudonyms.
+func newGradeListResponse(Grades []model.Grade, courseID int64, hidden map[int64]int64) []render.Renderer {
 	list := []render.Renderer{}
 	for k := range Grades {
-		list = append(list, newGradeResponse(&Grades[k], courseID))
+		resp := newGradeResponse(&Grades[k], courseID)
+		if sheetID, ok := hidden[Grades[k].TaskID]; ok {
+			resp.User = newAnonymousGradeUserResponse(courseID, sheetID, Grades[k].UserID)
+		}
+		list = append(list, resp)
 	}
 	return list
 }
@@ -115,24 +179,19 @@ func newGradeListResponse(Grades []model.Grade, courseID int64) []render.Rendere
 // for all submissions.
 type MissingGradeResponse struct {
 	Grade *struct {
-		ID                    int64  `json:"id" example:"1"`
-		PublicExecutionState  int    `json:"public_execution_state" example:"1"`
-		PrivateExecutionState int    `json:"private_execution_state" example:"1"`
-		PublicTestLog         string `json:"public_test_log" example:"Lorem Ipsum"`
-		PrivateTestLog        string `json:"private_test_log" example:"Lorem Ipsum"`
-		PublicTestStatus      int    `json:"public_test_status" example:"1"`
-		PrivateTestStatus     int    `json:"private_test_status" example:"0"`
-		AcquiredPoints        int    `json:"acquired_points" example:"19"`
-		Feedback              string `json:"feedback" example:"Some feedback"`
-		TutorID               int64  `json:"tutor_id" example:"2"`
-		SubmissionID          int64  `json:"submission_id" example:"31"`
-		FileURL               string `json:"file_url" example:"/api/v1/submissions/61/file"`
-		User                  *struct {
-			ID        int64  `json:"id" example:"1"`
-			FirstName string `json:"first_name" example:"Max"`
-			LastName  string `json:"last_name" example:"Mustermensch"`
-			Email     string `json:"email" example:"test@unit-tuebingen.de"`
-		} `json:"user"`
+		ID                    int64              `json:"id" example:"1"`
+		PublicExecutionState  int                `json:"public_execution_state" example:"1"`
+		PrivateExecutionState int                `json:"private_execution_state" example:"1"`
+		PublicTestLog         string             `json:"public_test_log" example:"Lorem Ipsum"`
+		PrivateTestLog        string             `json:"private_test_log" example:"Lorem Ipsum"`
+		PublicTestStatus      int                `json:"public_test_status" example:"1"`
+		PrivateTestStatus     int                `json:"private_test_status" example:"0"`
+		AcquiredPoints        int                `json:"acquired_points" example:"19"`
+		Feedback              string             `json:"feedback" example:"Some feedback"`
+		TutorID               int64              `json:"tutor_id" example:"2"`
+		SubmissionID          int64              `json:"submission_id" example:"31"`
+		FileURL               string             `json:"file_url" example:"/api/v1/submissions/61/file"`
+		User                  *GradeUserResponse `json:"user"`
 	} `json:"grade"`
 	CourseID int64 `json:"course_id" example:"1"`
 	SheetID  int64 `json:"sheet_id" example:"10"`
@@ -151,12 +210,7 @@ func newMissingGradeResponse(p *model.MissingGrade) *MissingGradeResponse {
 		fileURL = fmt.Sprintf("/api/v1/submissions/%s/file", strconv.FormatInt(p.SubmissionID, 10))
 	}
 
-	user := &struct {
-		ID        int64  `json:"id" example:"1"`
-		FirstName string `json:"first_name" example:"Max"`
-		LastName  string `json:"last_name" example:"Mustermensch"`
-		Email     string `json:"email" example:"test@unit-tuebingen.de"`
-	}{
+	user := &GradeUserResponse{
 		ID:        p.UserID,
 		FirstName: p.UserFirstName,
 		LastName:  p.UserLastName,
@@ -164,24 +218,19 @@ func newMissingGradeResponse(p *model.MissingGrade) *MissingGradeResponse {
 	}
 
 	grade := &struct {
-		ID                    int64  `json:"id" example:"1"`
-		PublicExecutionState  int    `json:"public_execution_state" example:"1"`
-		PrivateExecutionState int    `json:"private_execution_state" example:"1"`
-		PublicTestLog         string `json:"public_test_log" example:"Lorem Ipsum"`
-		PrivateTestLog        string `json:"private_test_log" example:"Lorem Ipsum"`
-		PublicTestStatus      int    `json:"public_test_status" example:"1"`
-		PrivateTestStatus     int    `json:"private_test_status" example:"0"`
-		AcquiredPoints        int    `json:"acquired_points" example:"19"`
-		Feedback              string `json:"feedback" example:"Some feedback"`
-		TutorID               int64  `json:"tutor_id" example:"2"`
-		SubmissionID          int64  `json:"submission_id" example:"31"`
-		FileURL               string `json:"file_url" example:"/api/v1/submissions/61/file"`
-		User                  *struct {
-			ID        int64  `json:"id" example:"1"`
-			FirstName string `json:"first_name" example:"Max"`
-			LastName  string `json:"last_name" example:"Mustermensch"`
-			Email     string `json:"email" example:"test@unit-tuebingen.de"`
-		} `json:"user"`
+		ID                    int64              `json:"id" example:"1"`
+		PublicExecutionState  int                `json:"public_execution_state" example:"1"`
+		PrivateExecutionState int                `json:"private_execution_state" example:"1"`
+		PublicTestLog         string             `json:"public_test_log" example:"Lorem Ipsum"`
+		PrivateTestLog        string             `json:"private_test_log" example:"Lorem Ipsum"`
+		PublicTestStatus      int                `json:"public_test_status" example:"1"`
+		PrivateTestStatus     int                `json:"private_test_status" example:"0"`
+		AcquiredPoints        int                `json:"acquired_points" example:"19"`
+		Feedback              string             `json:"feedback" example:"Some feedback"`
+		TutorID               int64              `json:"tutor_id" example:"2"`
+		SubmissionID          int64              `json:"submission_id" example:"31"`
+		FileURL               string             `json:"file_url" example:"/api/v1/submissions/61/file"`
+		User                  *GradeUserResponse `json:"user"`
 	}{
 		ID:                    p.ID,
 		PublicExecutionState:  p.PublicExecutionState,
@@ -210,10 +259,15 @@ func newMissingGradeResponse(p *model.MissingGrade) *MissingGradeResponse {
 }
 
 // newMissingGradeListResponse creates a response from a list of Grade models.
-func newMissingGradeListResponse(Grades []model.MissingGrade) []render.Renderer {
+// The students of the tasks in hidden are replaced by pseudonyms.
+func newMissingGradeListResponse(Grades []model.MissingGrade, hidden map[int64]int64) []render.Renderer {
 	list := []render.Renderer{}
 	for k := range Grades {
-		list = append(list, newMissingGradeResponse(&Grades[k]))
+		resp := newMissingGradeResponse(&Grades[k])
+		if _, ok := hidden[Grades[k].TaskID]; ok {
+			resp.Grade.User = newAnonymousGradeUserResponse(Grades[k].CourseID, Grades[k].SheetID, Grades[k].UserID)
+		}
+		list = append(list, resp)
 	}
 	return list
 }
@@ -230,6 +284,7 @@ type UserInfo struct {
 	LastName      string `json:"last_name" example:"mustermensch"`
 	StudentNumber string `json:"student_number" example:"0815"`
 	Email         string `json:"email" example:"user@example.com"`
+	AnonymousID   string `json:"anonymous_id,omitempty" example:"student-3fa9c2d1e04b"`
 }
 
 type AchievementInfo struct {
@@ -23,16 +23,21 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"math"
 	"net/http"
 	"os"
 	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/franela/goblin"
 	"github.com/infomark-org/infomark/api/helper"
 	"github.com/infomark-org/infomark/configuration"
 	"github.com/infomark-org/infomark/email"
 	"github.com/infomark-org/infomark/model"
+	"github.com/infomark-org/infomark/symbol"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 
 	null "gopkg.in/guregu/null.v3"
 )
@@ -66,6 +71,7 @@ func TestGrade(t *testing.T) {
 
 	g := goblin.Goblin(t)
 	email.DefaultMail = email.VoidMail
+	go email.BackgroundSend(email.OutgoingEmailsChannel)
 
 	tape := NewTape()
 
@@ -175,6 +181,107 @@ func TestGrade(t *testing.T) {
 			g.Assert(len(gradesActual)).Equal(len(gradesExpected))
 		})
 
+		g.It("Should hide students from tutors under anonymous grading", func() {
+			course, err := stores.Course.Get(1)
+			g.Assert(err).Equal(nil)
+			course.AnonymousGrading = true
+			err = stores.Course.Update(course)
+			g.Assert(err).Equal(nil)
+
+			sheetsOfCourse, err := stores.Sheet.SheetsOfCourse(1)
+			g.Assert(err).Equal(nil)
+			publishGrades := func(published bool) {
+				for _, entry := range sheetsOfCourse {
+					sheet, err := stores.Sheet.Get(entry.ID)
+					g.Assert(err).Equal(nil)
+					sheet.GradesPublished = published
+					g.Assert(stores.Sheet.Update(sheet)).Equal(nil)
+				}
+			}
+			publishGrades(false)
+
+			url := "/api/v1/courses/1/grades?group_id=2"
+
+			w := tape.Get(url, tutorJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+			gradesAnonymous := []GradeResponse{}
+			err = json.NewDecoder(w.Body).Decode(&gradesAnonymous)
+			g.Assert(err).Equal(nil)
+			g.Assert(len(gradesAnonymous) > 0).IsTrue()
+
+			for _, grade := range gradesAnonymous {
+				g.Assert(grade.User.ID).Equal(int64(0))
+				g.Assert(grade.User.FirstName).Equal("")
+				g.Assert(grade.User.LastName).Equal("")
+				g.Assert(grade.User.Email).Equal("")
+				g.Assert(strings.HasPrefix(grade.User.AnonymousID, "student-")).IsTrue()
+			}
+
+			// the pseudonym is the same in all views
+			w = tape.Get(fmt.Sprintf("/api/v1/courses/1/grades/%d", gradesAnonymous[0].ID), tutorJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+			gradeAnonymous := &GradeResponse{}
+			err = json.NewDecoder(w.Body).Decode(gradeAnonymous)
+			g.Assert(err).Equal(nil)
+			g.Assert(gradeAnonymous.User.Email).Equal("")
+			g.Assert(gradeAnonymous.User.AnonymousID).Equal(gradesAnonymous[0].User.AnonymousID)
+
+			w = tape.Get("/api/v1/courses/1/submissions?group_id=2", tutorJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+			submissionsAnonymous := []SubmissionResponse{}
+			err = json.NewDecoder(w.Body).Decode(&submissionsAnonymous)
+			g.Assert(err).Equal(nil)
+			g.Assert(len(submissionsAnonymous) > 0).IsTrue()
+			for _, submission := range submissionsAnonymous {
+				g.Assert(submission.UserID).Equal(int64(0))
+				g.Assert(submission.AnonymousID != "").IsTrue()
+			}
+
+			// students cannot be looked up by their id
+			w = tape.Get(url+"&user_id=112", tutorJWT)
+			g.Assert(w.Code).Equal(http.StatusBadRequest)
+			w = tape.Get("/api/v1/courses/1/submissions?group_id=2&user_id=112", tutorJWT)
+			g.Assert(w.Code).Equal(http.StatusBadRequest)
+
+			w = tape.Get("/api/v1/courses/1/grades/summary?group_id=2", tutorJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+			summaryAnonymous := &GradeOverviewResponse{}
+			err = json.NewDecoder(w.Body).Decode(summaryAnonymous)
+			g.Assert(err).Equal(nil)
+			for _, achievement := range summaryAnonymous.Achievements {
+				g.Assert(achievement.User.ID).Equal(int64(0))
+				g.Assert(achievement.User.LastName).Equal("")
+				g.Assert(achievement.User.AnonymousID != "").IsTrue()
+			}
+
+			// admins of the course still see the students
+			w = tape.Get(url, adminJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+			gradesAdmin := []GradeResponse{}
+			err = json.NewDecoder(w.Body).Decode(&gradesAdmin)
+			g.Assert(err).Equal(nil)
+			for _, grade := range gradesAdmin {
+				g.Assert(grade.User.ID != 0).IsTrue()
+				g.Assert(grade.User.Email != "").IsTrue()
+				g.Assert(grade.User.AnonymousID).Equal("")
+			}
+
+			// identities are revealed once the grades of the sheets are published
+			publishGrades(true)
+
+			w = tape.Get(url, tutorJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+			gradesPublished := []GradeResponse{}
+			err = json.NewDecoder(w.Body).Decode(&gradesPublished)
+			g.Assert(err).Equal(nil)
+			g.Assert(len(gradesPublished)).Equal(len(gradesAnonymous))
+			for _, grade := range gradesPublished {
+				g.Assert(grade.User.ID != 0).IsTrue()
+				g.Assert(grade.User.Email != "").IsTrue()
+				g.Assert(grade.User.AnonymousID).Equal("")
+			}
+		})
+
 		g.It("Should list all grades of a group with some filters", func() {
 
 			w := tape.Get("/api/v1/courses/1/grades?group_id=1&public_test_status=0", adminJWT)
@@ -263,6 +370,111 @@ func TestGrade(t *testing.T) {
 			g.Assert(entryAfter.TutorID).Equal(tutorJWT.Claims.LoginID)
 		})
 
+		g.It("Should notify students about grades immediately or by digest", func() {
+			mailer := &recordingMailer{}
+			defer func() { email.DefaultMail = email.VoidMail }()
+			email.DefaultMail = mailer
+
+			grade, err := stores.Grade.Get(1)
+			g.Assert(err).Equal(nil)
+
+			data := H{
+				"acquired_points": 2,
+				"feedback":        "Lorem Ipsum_update",
+			}
+
+			// without digest the email is sent right away
+			w := tape.Put("/api/v1/courses/1/grades/1", data, tutorJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			for k := 0; k < 50 && mailer.Count() < 1; k++ {
+				time.Sleep(100 * time.Millisecond)
+			}
+			g.Assert(mailer.Count()).Equal(1)
+			g.Assert(mailer.Sent[0].To).Equal(grade.UserEmail)
+
+			// corrections do not notify again
+			w = tape.Put("/api/v1/courses/1/grades/1", data, noAdminJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			time.Sleep(200 * time.Millisecond)
+			g.Assert(mailer.Count()).Equal(1)
+
+			// with digest the email is deferred
+			user, err := stores.User.Get(grade.UserID)
+			g.Assert(err).Equal(nil)
+			user.EmailDigest = true
+			g.Assert(stores.User.Update(user)).Equal(nil)
+
+			for k := 0; k < 2; k++ {
+				submission, err := stores.Submission.Create(&model.Submission{UserID: grade.UserID, TaskID: grade.TaskID})
+				g.Assert(err).Equal(nil)
+				newGrade, err := stores.Grade.Create(&model.Grade{SubmissionID: submission.ID, TutorID: 1})
+				g.Assert(err).Equal(nil)
+
+				w = tape.Put(fmt.Sprintf("/api/v1/courses/1/grades/%d", newGrade.ID), data, noAdminJWT)
+				g.Assert(w.Code).Equal(http.StatusOK)
+			}
+
+			time.Sleep(200 * time.Millisecond)
+			g.Assert(mailer.Count()).Equal(1)
+
+			pending, err := stores.Notification.PendingOfUser(grade.UserID)
+			g.Assert(err).Equal(nil)
+			g.Assert(len(pending)).Equal(2)
+
+			// both notifications end up in a single digest
+			sent, err := SendNotificationDigests(stores)
+			g.Assert(err).Equal(nil)
+			g.Assert(sent).Equal(1)
+			g.Assert(mailer.Count()).Equal(2)
+			g.Assert(mailer.Sent[1].To).Equal(grade.UserEmail)
+			g.Assert(strings.Count(mailer.Sent[1].Body, "Lorem Ipsum_update")).Equal(2)
+
+			pending, err = stores.Notification.PendingOfUser(grade.UserID)
+			g.Assert(err).Equal(nil)
+			g.Assert(len(pending)).Equal(0)
+		})
+
+		g.It("Should notify students about withheld grades once they are published", func() {
+			mailer := &recordingMailer{}
+			defer func() { email.DefaultMail = email.VoidMail }()
+			email.DefaultMail = mailer
+
+			grade, err := stores.Grade.Get(1)
+			g.Assert(err).Equal(nil)
+
+			sheet, err := stores.Task.IdentifySheetOfTask(grade.TaskID)
+			g.Assert(err).Equal(nil)
+			sheet.GradesPublished = false
+			g.Assert(stores.Sheet.Update(sheet)).Equal(nil)
+
+			w := tape.Put("/api/v1/courses/1/grades/1", H{
+				"acquired_points": 2,
+				"feedback":        "Lorem Ipsum_update",
+			}, tutorJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			time.Sleep(200 * time.Millisecond)
+			g.Assert(mailer.Count()).Equal(0)
+
+			gradesPublished := true
+			w = tape.Put(fmt.Sprintf("/api/v1/courses/1/sheets/%d", sheet.ID), tape.ToH(SheetRequest{
+				Name:            sheet.Name,
+				PublishAt:       sheet.PublishAt,
+				DueAt:           sheet.DueAt,
+				GradesPublished: &gradesPublished,
+			}), noAdminJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			for k := 0; k < 50 && mailer.Count() < 1; k++ {
+				time.Sleep(100 * time.Millisecond)
+			}
+			g.Assert(mailer.Count()).Equal(1)
+			g.Assert(mailer.Sent[0].To).Equal(grade.UserEmail)
+			g.Assert(strings.Contains(mailer.Sent[0].Body, "Lorem Ipsum_update")).IsTrue()
+		})
+
 		g.Xit("Should not perform updates when missing points", func() {
 			// todo difference between "0" and None
 			data := H{
@@ -452,6 +664,316 @@ func TestGrade(t *testing.T) {
 
 		})
 
+		g.It("Should drop autograder points exceeding the max points of the task", func() {
+			task, err := stores.Grade.IdentifyTaskOfGrade(1)
+			g.Assert(err).Equal(nil)
+
+			entryBefore, err := stores.Grade.Get(1)
+			g.Assert(err).Equal(nil)
+
+			url := "/api/v1/courses/1/grades/1/private_result"
+
+			w := tape.Post(url, H{
+				"log":    "some broken logs",
+				"status": -1,
+			}, noAdminJWT)
+			g.Assert(w.Code).Equal(http.StatusBadRequest)
+
+			w = tape.Post(url, H{
+				"log":    "some new logs",
+				"status": 0,
+				"points": -1,
+			}, noAdminJWT)
+			g.Assert(w.Code).Equal(http.StatusBadRequest)
+
+			entryAfter, err := stores.Grade.Get(1)
+			g.Assert(err).Equal(nil)
+			g.Assert(entryAfter.PrivateTestLog).Equal(entryBefore.PrivateTestLog)
+
+			// the log of a result with too many points is kept as a failed test
+			w = tape.Post(url, H{
+				"log":    "some new logs",
+				"status": 0,
+				"points": task.MaxPoints + 1,
+			}, noAdminJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			entryAfter, err = stores.Grade.Get(1)
+			g.Assert(err).Equal(nil)
+			g.Assert(entryAfter.AcquiredPoints).Equal(entryBefore.AcquiredPoints)
+			g.Assert(entryAfter.PrivateTestLog).Equal("some new logs")
+			g.Assert(entryAfter.PrivateTestStatus).Equal(int(symbol.TestingResultFailed))
+		})
+
+		g.It("Should store valid autograder points", func() {
+			task, err := stores.Grade.IdentifyTaskOfGrade(1)
+			g.Assert(err).Equal(nil)
+
+			w := tape.Post("/api/v1/courses/1/grades/1/private_result", H{
+				"log":    "some new logs",
+				"status": 0,
+				"points": task.MaxPoints,
+			}, noAdminJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			entryAfter, err := stores.Grade.Get(1)
+			g.Assert(err).Equal(nil)
+			g.Assert(entryAfter.AcquiredPoints).Equal(task.MaxPoints)
+			g.Assert(entryAfter.PrivateTestLog).Equal("some new logs")
+		})
+
+		g.It("Should only award points of private tests and keep the points of tutors", func() {
+			task, err := stores.Grade.IdentifyTaskOfGrade(1)
+			g.Assert(err).Equal(nil)
+			g.Assert(task.MaxPoints > 1).IsTrue()
+
+			publicURL := "/api/v1/courses/1/grades/1/public_result"
+			privateURL := "/api/v1/courses/1/grades/1/private_result"
+
+			pointsOfGrade := func() int {
+				entry, err := stores.Grade.Get(1)
+				g.Assert(err).Equal(nil)
+				return entry.AcquiredPoints
+			}
+
+			// the private result wins, no matter which one arrives last
+			w := tape.Post(privateURL, H{"log": "private", "status": 0, "points": 1}, noAdminJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+			w = tape.Post(publicURL, H{"log": "public", "status": 0, "points": task.MaxPoints}, noAdminJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+			g.Assert(pointsOfGrade()).Equal(1)
+
+			w = tape.Post(publicURL, H{"log": "public", "status": 0, "points": task.MaxPoints}, noAdminJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+			w = tape.Post(privateURL, H{"log": "private", "status": 0, "points": 1}, noAdminJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+			g.Assert(pointsOfGrade()).Equal(1)
+
+			// results arriving after a tutor graded the submission keep the points
+			w = tape.Put("/api/v1/courses/1/grades/1", H{
+				"acquired_points": task.MaxPoints - 1,
+				"feedback":        "well done",
+			}, tutorJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			w = tape.Post(privateURL, H{"log": "private", "status": 0, "points": 0}, noAdminJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+			g.Assert(pointsOfGrade()).Equal(task.MaxPoints - 1)
+
+			entry, err := stores.Grade.Get(1)
+			g.Assert(err).Equal(nil)
+			g.Assert(entry.GradedAt.Valid).IsTrue()
+			g.Assert(entry.PrivateTestLog).Equal("private")
+		})
+
+		g.It("Should give partial credit for passed test cases", func() {
+			task, err := stores.Grade.IdentifyTaskOfGrade(1)
+			g.Assert(err).Equal(nil)
+
+			sheet, err := stores.Task.IdentifySheetOfTask(task.ID)
+			g.Assert(err).Equal(nil)
+
+			testCases := []H{}
+			for k := 0; k < 10; k++ {
+				testCases = append(testCases, H{
+					"name":   fmt.Sprintf("test_case_%d", k),
+					"passed": k < 7,
+				})
+			}
+
+			w := tape.Post("/api/v1/courses/1/grades/1/private_result", H{
+				"log":        "7 of 10 tests passed",
+				"status":     0,
+				"test_cases": testCases,
+			}, noAdminJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			expectedPoints := int(math.Round(0.7 * float64(task.MaxPoints)))
+
+			entryAfter, err := stores.Grade.Get(1)
+			g.Assert(err).Equal(nil)
+			g.Assert(entryAfter.AcquiredPoints).Equal(expectedPoints)
+
+			// the points of the student reflect the partial credit
+			w = tape.Get(fmt.Sprintf("/api/v1/courses/1/sheets/%d/points", sheet.ID),
+				tape.NewJWTRequest(entryAfter.UserID, false))
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			pointsActual := []TaskPointsResponse{}
+			err = json.NewDecoder(w.Body).Decode(&pointsActual)
+			g.Assert(err).Equal(nil)
+
+			found := false
+			for _, points := range pointsActual {
+				if int64(points.TaskID) == task.ID {
+					found = true
+					g.Assert(points.AquiredPoints).Equal(expectedPoints)
+				}
+			}
+			g.Assert(found).IsTrue()
+
+			// staff can see the breakdown
+			w = tape.Get("/api/v1/courses/1/grades/1", noAdminJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			gradeActual := &GradeResponse{}
+			err = json.NewDecoder(w.Body).Decode(gradeActual)
+			g.Assert(err).Equal(nil)
+			g.Assert(len(gradeActual.PrivateTestCases)).Equal(10)
+			g.Assert(gradeActual.PrivateTestCases[0].Name).Equal("test_case_0")
+			g.Assert(gradeActual.PrivateTestCases[0].Passed).IsTrue()
+			g.Assert(gradeActual.PrivateTestCases[9].Passed).IsFalse()
+		})
+
+		g.It("Should count the points of the latest or best submission depending on the policy", func() {
+			task, err := stores.Grade.IdentifyTaskOfGrade(1)
+			g.Assert(err).Equal(nil)
+			g.Assert(task.MaxPoints > 0).IsTrue()
+
+			sheet, err := stores.Task.IdentifySheetOfTask(task.ID)
+			g.Assert(err).Equal(nil)
+
+			entry, err := stores.Grade.Get(1)
+			g.Assert(err).Equal(nil)
+			studentJWT := tape.NewJWTRequest(entry.UserID, false)
+
+			// the first submission gets all points, the re-uploaded one none
+			url := "/api/v1/courses/1/grades/1/private_result"
+			w := tape.Post(url, H{"log": "all passed", "status": 0, "points": task.MaxPoints}, noAdminJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+			w = tape.Post(url, H{"log": "all failed", "status": 0, "points": 0}, noAdminJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			countedPoints := func() int {
+				w := tape.Get(fmt.Sprintf("/api/v1/courses/1/sheets/%d/points", sheet.ID), studentJWT)
+				g.Assert(w.Code).Equal(http.StatusOK)
+
+				pointsActual := []TaskPointsResponse{}
+				err := json.NewDecoder(w.Body).Decode(&pointsActual)
+				g.Assert(err).Equal(nil)
+				for _, points := range pointsActual {
+					if int64(points.TaskID) == task.ID {
+						return points.AquiredPoints
+					}
+				}
+				g.Fail("task is missing in points")
+				return -1
+			}
+
+			// latest is the default
+			g.Assert(countedPoints()).Equal(0)
+
+			w = tape.Put(fmt.Sprintf("/api/v1/courses/1/tasks/%d", task.ID), H{
+				"name":                 task.Name,
+				"max_points":           task.MaxPoints,
+				"public_docker_image":  task.PublicDockerImage.String,
+				"private_docker_image": task.PrivateDockerImage.String,
+				"scoring_policy":       "best",
+			}, noAdminJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+			g.Assert(countedPoints()).Equal(task.MaxPoints)
+
+			// the policy of the task takes precedence over the one of the sheet
+			sheet.ScoringPolicy = "latest"
+			err = stores.Sheet.Update(sheet)
+			g.Assert(err).Equal(nil)
+			g.Assert(countedPoints()).Equal(task.MaxPoints)
+
+			// without a policy of the task the sheet decides
+			task, err = stores.Task.Get(task.ID)
+			g.Assert(err).Equal(nil)
+			task.ScoringPolicy = null.String{}
+			err = stores.Task.Update(task)
+			g.Assert(err).Equal(nil)
+			g.Assert(countedPoints()).Equal(0)
+
+			sheet.ScoringPolicy = "best"
+			err = stores.Sheet.Update(sheet)
+			g.Assert(err).Equal(nil)
+			g.Assert(countedPoints()).Equal(task.MaxPoints)
+
+			// a tutor can correct the points downwards
+			w = tape.Put("/api/v1/courses/1/grades/1", H{
+				"acquired_points": task.MaxPoints - 1,
+				"feedback":        "partially wrong",
+			}, tutorJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+			g.Assert(countedPoints()).Equal(task.MaxPoints - 1)
+
+			w = tape.Put(fmt.Sprintf("/api/v1/courses/1/tasks/%d", task.ID), H{
+				"name":           task.Name,
+				"max_points":     task.MaxPoints,
+				"scoring_policy": "oldest",
+			}, noAdminJWT)
+			g.Assert(w.Code).Equal(http.StatusBadRequest)
+		})
+
+		g.It("Should hide details of hidden test cases from students", func() {
+			task, err := stores.Grade.IdentifyTaskOfGrade(1)
+			g.Assert(err).Equal(nil)
+
+			w := tape.Post("/api/v1/courses/1/grades/1/public_result", H{
+				"log":    "some new logs",
+				"status": 0,
+				"test_cases": []H{
+					{"name": "test_visible", "passed": true},
+					{"name": "test_secret_a", "passed": true, "hidden": true},
+					{"name": "test_secret_b", "passed": false, "hidden": true},
+				},
+			}, noAdminJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			entry, err := stores.Grade.Get(1)
+			g.Assert(err).Equal(nil)
+
+			// students
+			w = tape.Get(fmt.Sprintf("/api/v1/courses/1/tasks/%d/result", task.ID),
+				tape.NewJWTRequest(entry.UserID, false))
+			g.Assert(w.Code).Equal(http.StatusOK)
+			g.Assert(strings.Contains(w.Body.String(), "test_secret")).IsFalse()
+
+			gradeActual := &GradeResponse{}
+			err = json.NewDecoder(w.Body).Decode(gradeActual)
+			g.Assert(err).Equal(nil)
+			g.Assert(len(gradeActual.PublicTestCases)).Equal(1)
+			g.Assert(gradeActual.PublicTestCases[0].Name).Equal("test_visible")
+			g.Assert(gradeActual.HiddenTestCases.Total).Equal(2)
+			g.Assert(gradeActual.HiddenTestCases.Passed).Equal(1)
+
+			// staff
+			w = tape.Get("/api/v1/courses/1/grades/1", noAdminJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			gradeActual = &GradeResponse{}
+			err = json.NewDecoder(w.Body).Decode(gradeActual)
+			g.Assert(err).Equal(nil)
+			g.Assert(len(gradeActual.PublicTestCases)).Equal(3)
+			g.Assert(gradeActual.PublicTestCases[1].Name).Equal("test_secret_a")
+			g.Assert(gradeActual.PublicTestCases[1].Hidden).IsTrue()
+			g.Assert(gradeActual.HiddenTestCases.Total).Equal(2)
+		})
+
+		g.It("Should record timed out tests", func() {
+			task, err := stores.Grade.IdentifyTaskOfGrade(1)
+			g.Assert(err).Equal(nil)
+
+			timeouts := totalDockerFailExitCounterVec.WithLabelValues(fmt.Sprintf("%d", task.ID), "timeout")
+			before := testutil.ToFloat64(timeouts)
+
+			w := tape.Post("/api/v1/courses/1/grades/1/private_result", H{
+				"log":    "execution took too long",
+				"status": symbol.TestingResultTimeout,
+			}, noAdminJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			entryAfter, err := stores.Grade.Get(1)
+			g.Assert(err).Equal(nil)
+			g.Assert(entryAfter.PrivateTestLog).Equal("execution took too long")
+			g.Assert(entryAfter.PrivateTestStatus).Equal(int(symbol.TestingResultTimeout))
+
+			g.Assert(testutil.ToFloat64(timeouts)).Equal(before + 1)
+		})
+
 		g.It("Should show correct overview", func() {
 
 			course, err := stores.Course.Get(1)
@@ -471,6 +471,7 @@ func (rs *GroupResource) ChangeBidHandler(w http.ResponseWriter, r *http.Request
 // SUMMARY:  send email to entire group
 func (rs *GroupResource) SendEmailHandler(w http.ResponseWriter, r *http.Request) {
 
+	course := r.Context().Value(symbol.CtxKeyCourse).(*model.Course)
 	group := r.Context().Value(symbol.CtxKeyGroup).(*model.Group)
 	accessClaims := r.Context().Value(symbol.CtxKeyAccessClaims).(*authenticate.AccessClaims)
 	accessUser, _ := rs.Stores.User.Get(accessClaims.LoginID)
@@ -490,22 +491,24 @@ func (rs *GroupResource) SendEmailHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	msgOwn := email.NewEmailFromUser(
+	msgOwn := email.NewCourseEmailFromUser(
 		configuration.Configuration.Server.Email.From,
 		accessUser.Email,
 		data.Subject,
 		data.Body,
 		accessUser,
+		course.EmailSubjectPrefix,
 	)
 	email.OutgoingEmailsChannel <- msgOwn
 
 	for _, recipient := range recipients {
-		msg := email.NewEmailFromUser(
+		msg := email.NewCourseEmailFromUser(
 			configuration.Configuration.Server.Email.From,
 			recipient.Email,
 			data.Subject,
 			data.Body,
 			accessUser,
+			course.EmailSubjectPrefix,
 		)
 
 		email.OutgoingEmailsChannel <- msg
@@ -561,3 +564,41 @@ func (rs *GroupResource) Context(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
+
+// .............................................................................
+
+// errGroupNotVisible is returned if a tutor asks for a group of another tutor.
+var errGroupNotVisible = errors.New("tutors can only access their own groups")
+
+// visibleGroupIDs returns the groups whose members the request identity is
+// allowed to see, restricted to the requested group if any. Tutors only see
+// their own groups, while nil means there is no restriction at all.
+func visibleGroupIDs(stores *Stores, r *http.Request, requestedGroupID int64) ([]int64, error) {
+	course := r.Context().Value(symbol.CtxKeyCourse).(*model.Course)
+	accessClaims := r.Context().Value(symbol.CtxKeyAccessClaims).(*authenticate.AccessClaims)
+	givenRole := r.Context().Value(symbol.CtxKeyCourseRole).(authorize.CourseRole)
+
+	if givenRole == authorize.ADMIN {
+		if requestedGroupID == 0 {
+			return nil, nil
+		}
+		return []int64{requestedGroupID}, nil
+	}
+
+	groups, err := stores.Group.GetOfTutor(accessClaims.LoginID, course.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	groupIDs := []int64{}
+	for _, group := range groups {
+		if requestedGroupID == 0 || group.ID == requestedGroupID {
+			groupIDs = append(groupIDs, group.ID)
+		}
+	}
+
+	if requestedGroupID != 0 && len(groupIDs) == 0 {
+		return nil, errGroupNotVisible
+	}
+	return groupIDs, nil
+}
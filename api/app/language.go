@@ -0,0 +1,91 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package app
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/infomark-org/infomark/configuration"
+	"github.com/infomark-org/infomark/email"
+	"github.com/infomark-org/infomark/model"
+)
+
+// DefaultLanguage returns the configured language for users without any
+// preference.
+func DefaultLanguage() string {
+	if language := configuration.Configuration.Server.DefaultLanguage; language != "" {
+		return language
+	}
+	return email.FallbackLanguage
+}
+
+// NegotiateLanguage picks the supported language with the highest quality from
+// the "Accept-Language" header of a request (RFC 7231). Without any match the
+// configured default language is used.
+func NegotiateLanguage(r *http.Request) string {
+	best, bestQuality := DefaultLanguage(), 0.0
+
+	for _, part := range strings.Split(r.Header.Get("Accept-Language"), ",") {
+		fields := strings.Split(part, ";")
+		tag := strings.ToLower(strings.TrimSpace(fields[0]))
+		// "de-DE" is served by "de"
+		if i := strings.Index(tag, "-"); i != -1 {
+			tag = tag[:i]
+		}
+
+		quality := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if q, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					quality = q
+				}
+			}
+		}
+
+		if quality > bestQuality && isSupportedLanguage(tag) {
+			best, bestQuality = tag, quality
+		}
+	}
+
+	return best
+}
+
+// LanguageOfUser returns the language a user should be addressed in. Users
+// without a preference get the language negotiated from the request (if any).
+func LanguageOfUser(user *model.User, r *http.Request) string {
+	if user.Language != "" {
+		return user.Language
+	}
+	if r != nil {
+		return NegotiateLanguage(r)
+	}
+	return DefaultLanguage()
+}
+
+func isSupportedLanguage(language string) bool {
+	for _, supported := range email.SupportedLanguages {
+		if supported == language {
+			return true
+		}
+	}
+	return false
+}
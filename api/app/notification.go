@@ -0,0 +1,163 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package app
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/infomark-org/infomark/auth/authorize"
+	"github.com/infomark-org/infomark/configuration"
+	"github.com/infomark-org/infomark/email"
+	"github.com/infomark-org/infomark/model"
+)
+
+// notifyUser sends a notification email to a user. Users who opted in to the
+// email digest get the notification with their next digest instead.
+func notifyUser(stores *Stores, user *model.User, subject string, body string) error {
+	if user.EmailDigest {
+		_, err := stores.Notification.Create(&model.PendingNotification{
+			UserID:  user.ID,
+			Subject: subject,
+			Body:    body,
+		})
+		return err
+	}
+
+	email.OutgoingEmailsChannel <- email.NewEmail(
+		configuration.Configuration.Server.Email.From,
+		user.Email,
+		subject,
+		body,
+	)
+	return nil
+}
+
+// notifySubmissionGraded tells the owner of a submission about a new grade.
+func notifySubmissionGraded(stores *Stores, grade *model.Grade) error {
+	submission, err := stores.Submission.Get(grade.SubmissionID)
+	if err != nil {
+		return err
+	}
+
+	task, err := stores.Task.Get(submission.TaskID)
+	if err != nil {
+		return err
+	}
+
+	user, err := stores.User.Get(submission.UserID)
+	if err != nil {
+		return err
+	}
+
+	sheet, err := stores.Task.IdentifySheetOfTask(task.ID)
+	if err != nil {
+		return err
+	}
+
+	// the points are announced once the grades of the sheet are published
+	if !sheet.GradesPublished {
+		return nil
+	}
+
+	subject := fmt.Sprintf("Your solution for \"%s\" has been graded", task.Name)
+	body := fmt.Sprintf("You got %d of %d points for \"%s\".\n\n%s",
+		grade.AcquiredPoints, task.MaxPoints, task.Name, grade.Feedback)
+
+	return notifyUser(stores, user, subject, strings.TrimSpace(body))
+}
+
+// notifyGradesPublished sends the notifications which have been withheld while
+// the grades of a sheet were not published.
+func notifyGradesPublished(stores *Stores, sheet *model.Sheet) error {
+	grades, err := stores.Grade.GradedOfSheet(sheet.ID)
+	if err != nil {
+		return err
+	}
+
+	for k := range grades {
+		if err := notifySubmissionGraded(stores, &grades[k]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// notifyEnrollmentRoleChanged tells a user about the new role in a course.
+func notifyEnrollmentRoleChanged(stores *Stores, course *model.Course, user *model.User, role int) error {
+	subject := fmt.Sprintf("Your role in \"%s\" has changed", course.Name)
+	body := fmt.Sprintf("You are now %s in the course \"%s\".",
+		courseRoleName(authorize.CourseRole(role)), course.Name)
+
+	return notifyUser(stores, user, subject, body)
+}
+
+// newDigestEmail combines all pending notifications of a user into a single
+// email.
+func newDigestEmail(user *model.User, notifications []model.PendingNotification) *email.Email {
+	var body strings.Builder
+
+	fmt.Fprintf(&body, "Hi %s!\n\nHere is what happened since your last summary:\n", user.FullName())
+	for _, notification := range notifications {
+		fmt.Fprintf(&body, "\n## %s\n\n%s\n", notification.Subject, notification.Body)
+	}
+
+	return email.NewEmail(
+		configuration.Configuration.Server.Email.From,
+		user.Email,
+		fmt.Sprintf("Your InfoMark summary (%d notifications)", len(notifications)),
+		body.String(),
+	)
+}
+
+// SendNotificationDigests sends one email to each user with pending
+// notifications which summarizes all of them. Notifications are removed
+// once the digest has been sent. It returns the number of sent digests.
+func SendNotificationDigests(stores *Stores) (int, error) {
+	userIDs, err := stores.Notification.UsersWithPending()
+	if err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	for _, userID := range userIDs {
+		user, err := stores.User.Get(userID)
+		if err != nil {
+			return sent, err
+		}
+
+		notifications, err := stores.Notification.PendingOfUser(userID)
+		if err != nil {
+			return sent, err
+		}
+
+		if err := email.DefaultMail.Send(newDigestEmail(user, notifications)); err != nil {
+			return sent, err
+		}
+		sent++
+
+		for _, notification := range notifications {
+			if err := stores.Notification.Delete(notification.ID); err != nil {
+				return sent, err
+			}
+		}
+	}
+
+	return sent, nil
+}
@@ -35,6 +35,15 @@ var (
 		[]string{},
 	)
 
+	totalPanicsVec = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "panics_total",
+			Help: "Total number of panics recovered in handlers",
+		},
+		//
+		[]string{},
+	)
+
 	totalSubmissionCounterVec = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
 			Namespace: "worker",
@@ -68,6 +77,28 @@ var (
 		[]string{"task_id", "kind"},
 	)
 
+	inFlightRequestsGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "http",
+			Subsystem: "requests",
+			Name:      "in_flight",
+			Help:      "Number of requests currently being served",
+		},
+		//
+		[]string{},
+	)
+
+	totalQueuedJobsGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "worker",
+			Subsystem: "submissions",
+			Name:      "queued",
+			Help:      "Number of grading jobs waiting for a free slot",
+		},
+		//
+		[]string{},
+	)
+
 	totalDockerTimeHist = prometheus.NewHistogramVec(
 		prometheus.HistogramOpts{
 			Namespace: "worker",
@@ -111,6 +142,9 @@ func InitPrometheus() {
 		prometheus.MustRegister(totalDockerFailExitCounterVec)
 		prometheus.MustRegister(totalDockerSuccessExitCounterVec)
 		prometheus.MustRegister(totalFailedLoginsVec)
+		prometheus.MustRegister(totalPanicsVec)
+		prometheus.MustRegister(totalQueuedJobsGauge)
+		prometheus.MustRegister(inFlightRequestsGauge)
 		prometheus.MustRegister(totalDockerTimeHist)
 		prometheus.MustRegister(totalDockerRunTimeHist)
 		prometheus.MustRegister(totalDockerWaitTimeHist)
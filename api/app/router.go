@@ -20,13 +20,19 @@
 package app
 
 import (
+	"context"
 	"crypto/subtle"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"net/http"
 	"os"
+	"runtime/debug"
+	"sort"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-chi/chi"
@@ -41,19 +47,26 @@ import (
 	"github.com/jmoiron/sqlx"
 	"github.com/markbates/pkger"
 	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/bcrypt"
 )
 
 // LimitedDecoder limits the amount of data a client can send in a JSON data request.
 // The golang fork-join multi-threading allows no easy way to cancel started requests.
 // Therefore we limit the amount of data which is read by the server whenever
 // we need to parse a JSON request.
+// In strict mode, fields which are unknown to the request type are rejected
+// instead of being silently dropped.
 func LimitedDecoder(r *http.Request, v interface{}) error {
 	var err error
 
 	switch render.GetRequestContentType(r) {
 	case render.ContentTypeJSON:
 		body := io.LimitReader(r.Body, int64(configuration.Configuration.Server.HTTP.Limits.MaxRequestJSON))
-		err = render.DecodeJSON(body, v)
+		if configuration.Configuration.Server.HTTP.StrictJSON {
+			err = decodeStrictJSON(body, v)
+		} else {
+			err = render.DecodeJSON(body, v)
+		}
 	default:
 		err = errors.New("render: unable to automatically decode the request content type")
 	}
@@ -61,6 +74,15 @@ func LimitedDecoder(r *http.Request, v interface{}) error {
 	return err
 }
 
+// decodeStrictJSON is like render.DecodeJSON but fails on unknown fields,
+// e.g. `json: unknown field "emial"`.
+func decodeStrictJSON(r io.Reader, v interface{}) error {
+	defer io.Copy(ioutil.Discard, r)
+	decoder := json.NewDecoder(r)
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(v)
+}
+
 var log *logrus.Logger
 
 func RunInit() {
@@ -74,22 +96,82 @@ func RunInit() {
 	log.Out = os.Stdout
 }
 
-func LoggingMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		start := time.Now()
-		next.ServeHTTP(w, r)
-		end := time.Now()
-		if r.RequestURI != "/metrics" {
-			log.WithFields(logrus.Fields{
-				"method": r.Method,
-				// "proto":   r.Proto,
-				"agent":   r.UserAgent(),
-				"remote":  r.RemoteAddr,
-				"latency": end.Sub(start),
-				"time":    end.Format(time.RFC3339),
-			}).Info(r.RequestURI)
-		}
-	})
+// AccessLogFields are all fields an entry of the access log can contain.
+var AccessLogFields = []string{"method", "path", "status", "duration", "request_id", "user_id", "impersonator_id", "client_ip"}
+
+// NewAccessLogger creates a middleware writing one entry per request to out.
+// The format is either "json" (e.g. for ingestion into ELK) or human-readable
+// text. Only the given fields are logged, all of them if none are given. The
+// duration is measured in milliseconds.
+func NewAccessLogger(out io.Writer, format string, fields []string) func(next http.Handler) http.Handler {
+	logger := logrus.New()
+	logger.Out = out
+
+	if format == "json" {
+		logger.SetFormatter(&logrus.JSONFormatter{})
+	} else {
+		logger.SetFormatter(&logrus.TextFormatter{
+			DisableColors: false,
+			FullTimestamp: true,
+		})
+	}
+
+	if len(fields) == 0 {
+		fields = AccessLogFields
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/metrics" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// the authentication middleware fills in the identity
+			identity := &authenticate.AccessLogIdentity{}
+			ctx := context.WithValue(r.Context(), symbol.CtxKeyAccessLog, identity)
+
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			start := time.Now()
+			next.ServeHTTP(ww, r.WithContext(ctx))
+			duration := time.Since(start)
+
+			status := ww.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+
+			clientIP := r.RemoteAddr
+			if ip := authenticate.ClientIP(r); ip != nil {
+				clientIP = ip.String()
+			}
+
+			values := logrus.Fields{
+				"method":     r.Method,
+				"path":       r.URL.Path,
+				"status":     status,
+				"duration":   float64(duration) / float64(time.Millisecond),
+				"request_id": middleware.GetReqID(r.Context()),
+				"client_ip":  clientIP,
+			}
+			if identity.LoginID != 0 {
+				values["user_id"] = identity.LoginID
+			}
+			if identity.ImpersonatorID != 0 {
+				values["impersonator_id"] = identity.ImpersonatorID
+			}
+
+			entry := logrus.Fields{}
+			for _, field := range fields {
+				if value, ok := values[field]; ok {
+					entry[field] = value
+				}
+			}
+
+			// the query might carry credentials, e.g. the token of a calendar feed
+			logger.WithFields(entry).Info(r.URL.Path)
+		})
+	}
 }
 
 func BasicAuthMiddleware(realm string, credentials map[string]string) func(next http.Handler) http.Handler {
@@ -129,6 +211,44 @@ func VersionMiddleware(next http.Handler) http.Handler {
 	})
 }
 
+// RecovererMiddleware turns a panic of a handler into a clean JSON error response
+// containing the request id. The panic is logged together with its stack trace.
+func RecovererMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			rvr := recover()
+			if rvr == nil {
+				return
+			}
+			// aborting a request is done on purpose
+			if rvr == http.ErrAbortHandler {
+				panic(rvr)
+			}
+
+			totalPanicsVec.WithLabelValues().Inc()
+			logrus.WithFields(logrus.Fields{
+				"module":     "app",
+				"request_id": middleware.GetReqID(r.Context()),
+				"method":     r.Method,
+				"path":       r.URL.Path,
+				"stack":      string(debug.Stack()),
+			}).Errorf("panic: %v", rvr)
+
+			render.Render(w, r, ErrInternalServerError)
+		}()
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequestIDHeader exposes the id of the request (see middleware.RequestID) to clients.
+func RequestIDHeader(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Request-Id", middleware.GetReqID(r.Context()))
+		next.ServeHTTP(w, r)
+	})
+}
+
 // SecureMiddleware writes required access headers to all requests.
 func SecureMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -158,6 +278,69 @@ func NoCache(next http.Handler) http.Handler {
 	})
 }
 
+// NoImpersonation rejects requests made with an impersonation token. Routes
+// managing credentials and sessions of an account must only be used by its
+// owner.
+func NoImpersonation(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		accessClaims := r.Context().Value(symbol.CtxKeyAccessClaims).(*authenticate.AccessClaims)
+		if accessClaims.ImpersonatorID != 0 {
+			render.Render(w, r, ErrUnauthorizedWithDetails(errors.New("not allowed while impersonating a user")))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// concurrencyLimitRetryAfter is the number of seconds clients should wait when
+// the server is busy.
+const concurrencyLimitRetryAfter = "1"
+
+// isHealthCheck tests whether a request is issued by monitoring, which must
+// never be shed.
+func isHealthCheck(r *http.Request) bool {
+	return r.URL.Path == "/api/v1/ping" || r.URL.Path == "/metrics"
+}
+
+// isWorkerResult tests whether a request reports a result of a background
+// worker. Workers do not retry, so shedding it would lose the result.
+func isWorkerResult(r *http.Request) bool {
+	return r.Method == http.MethodPost &&
+		(strings.HasSuffix(r.URL.Path, "/public_result") || strings.HasSuffix(r.URL.Path, "/private_result"))
+}
+
+// NewConcurrencyLimiter creates a middleware serving at most max requests at
+// once. Further requests are answered with 503 and a "Retry-After" header
+// instead of piling up, e.g. when a whole class submits at the deadline.
+// Health checks and results of background workers are always served. A max of
+// 0 disables the limit.
+func NewConcurrencyLimiter(max int) func(next http.Handler) http.Handler {
+	var inFlight int64
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if isHealthCheck(r) || isWorkerResult(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if current := atomic.AddInt64(&inFlight, 1); max > 0 && current > int64(max) {
+				atomic.AddInt64(&inFlight, -1)
+				w.Header().Set("Retry-After", concurrencyLimitRetryAfter)
+				render.Render(w, r, ErrServiceUnavailable)
+				return
+			}
+			inFlightRequestsGauge.WithLabelValues().Inc()
+			defer func() {
+				atomic.AddInt64(&inFlight, -1)
+				inFlightRequestsGauge.WithLabelValues().Dec()
+			}()
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
 // New configures application resources and routes.
 func New(db *sqlx.DB, promhttp http.Handler, log bool) (*chi.Mux, error) {
 	logger := logrus.StandardLogger()
@@ -187,18 +370,36 @@ func New(db *sqlx.DB, promhttp http.Handler, log bool) (*chi.Mux, error) {
 		logger.WithField("module", "app").Error(err)
 		return nil, err
 	}
+	appAPI.Auth.LoginFailures = authenticate.NewLoginFailureCounter(loginLimiter.Redis, "infomark-login-failures")
+	appAPI.Auth.IdleSessions = authenticate.NewIdleSessionTracker(loginLimiter.Redis, "infomark-sessions")
+	appAPI.Account.RateLimiter = loginLimiter
+
+	render.Respond = RequestIDResponder
+	auth.PasswordCost = config.Authentication.Password.BcryptCost
+	if auth.PasswordCost > bcrypt.MaxCost {
+		logger.WithField("module", "auth").Warnf("bcrypt cost %d exceeds the maximum %d", auth.PasswordCost, bcrypt.MaxCost)
+	}
 
 	r := chi.NewRouter()
+	r.Use(middleware.RequestID)
+	r.Use(RequestIDHeader)
 	r.Use(VersionMiddleware)
 	r.Use(SecureMiddleware)
 	r.Use(NoCache)
-	r.Use(middleware.Recoverer)
-	r.Use(middleware.RequestID)
+	// the access log wraps the recoverer to also log requests which panicked
 	if log {
-		r.Use(LoggingMiddleware)
+		r.Use(NewAccessLogger(os.Stdout, config.Logging.Format, config.Logging.Fields))
+	}
+	r.Use(RecovererMiddleware)
+	r.Use(NewConcurrencyLimiter(config.HTTP.Limits.MaxInFlight))
+	if config.Debugging.Enabled && config.Debugging.BodyLog.Enabled {
+		r.Use(NewBodyLogger(os.Stdout,
+			config.Debugging.BodyLog.RedactFields,
+			int64(config.Debugging.BodyLog.MaxBodySize)))
 	}
 	r.Use(render.SetContentType(render.ContentTypeJSON))
-	r.Use(corsConfig().Handler)
+	r.Use(EnvelopeMiddleware)
+	r.Use(NewCORSMiddleware(config.HTTP.CORS))
 
 	basicAuth := BasicAuthMiddleware("Restricted", map[string]string{
 		configuration.Configuration.Server.Services.Prometheus.User: configuration.Configuration.Server.Services.Prometheus.Password,
@@ -211,6 +412,9 @@ func New(db *sqlx.DB, promhttp http.Handler, log bool) (*chi.Mux, error) {
 
 	// r.Use(authenticate.AuthenticateAccessJWT)
 	r.Route("/api", func(r chi.Router) {
+		// "/api/v1/users/" and "/api/v1/users" are the same resource. This
+		// is limited to the API as the file server relies on trailing slashes.
+		r.Use(middleware.StripSlashes)
 
 		r.Route("/v1", func(r chi.Router) {
 
@@ -226,36 +430,54 @@ func New(db *sqlx.DB, promhttp http.Handler, log bool) (*chi.Mux, error) {
 				r.Post("/auth/request_password_reset", appAPI.Auth.RequestPasswordResetHandler)
 				r.Post("/auth/update_password", appAPI.Auth.UpdatePasswordHandler)
 				r.Post("/auth/confirm_email", appAPI.Auth.ConfirmEmailHandler)
+				r.Get("/auth/validate", appAPI.Auth.ValidateHandler)
+				r.Get("/auth/oidc/start", appAPI.Auth.OIDCStartHandler)
+				r.Get("/auth/oidc/callback", appAPI.Auth.OIDCCallbackHandler)
+				r.Post("/auth/oidc/second_factor", appAPI.Auth.OIDCSecondFactorHandler)
 				r.Post("/account", appAPI.Account.CreateHandler)
+				r.Get("/account/deadlines.ics", appAPI.Account.GetDeadlinesCalendarHandler)
 				r.Get("/ping", appAPI.Common.PingHandler)
 				r.Get("/version", appAPI.Common.VersionHandler)
+				r.Get("/config", appAPI.Common.ConfigHandler)
 				r.Get("/privacy_statement", appAPI.Common.PrivacyStatementHandler)
 			})
 
 			// protected routes
 			r.Group(func(r chi.Router) {
-				r.Use(authenticate.RequiredValidAccessClaims(sessionAuth, config))
+				r.Use(authenticate.RequiredValidAccessClaims(sessionAuth, config, appAPI.Account, appAPI.Auth))
 
 				r.Get("/me", appAPI.User.GetMeHandler)
 				r.Put("/me", appAPI.User.EditMeHandler)
 
 				r.Route("/users", func(r chi.Router) {
-					r.Get("/", appAPI.User.IndexHandler)
+					r.With(SelectFields(UserResponse{})).Get("/", appAPI.User.IndexHandler)
 
 					r.Route("/{user_id}", func(r chi.Router) {
 						r.Use(appAPI.User.Context)
 
-						r.Get("/", appAPI.User.GetHandler)
+						r.With(SelectFields(UserResponse{})).Get("/", appAPI.User.GetHandler)
 						r.Get("/avatar", appAPI.User.GetAvatarHandler)
 						r.Put("/", appAPI.User.EditHandler)
 						r.Delete("/", appAPI.User.DeleteHandler)
 						r.Post("/emails", appAPI.User.SendEmailHandler)
+						r.Post("/confirm", appAPI.User.ConfirmHandler)
+						r.Post("/reconfirm_email", appAPI.User.ReconfirmEmailHandler)
+						r.Post("/impersonate", appAPI.User.ImpersonateHandler)
+						r.Post("/merge/{duplicate_id}", appAPI.User.MergeHandler)
 					})
 					r.With(authorize.RequiresAtLeastCourseRole(authorize.ADMIN)).Get("/find", appAPI.User.Find)
+					r.Post("/bulk_delete", appAPI.User.BulkDeleteHandler)
+				})
+
+				r.Route("/submissions/{submission_id}", func(r chi.Router) {
+					r.Use(appAPI.Submission.Context)
+					r.Use(appAPI.Course.RoleContext)
+					r.Get("/file", appAPI.Submission.GetOwnFileHandler)
 				})
 
 				r.Route("/courses", func(r chi.Router) {
-					r.Get("/", appAPI.Course.IndexHandler)
+					r.With(SelectFields(CourseResponse{})).Get("/", appAPI.Course.IndexHandler)
+					r.Get("/available", appAPI.Course.IndexAvailableHandler)
 					r.With(authorize.RequiresAtLeastCourseRole(authorize.ADMIN)).Post("/", appAPI.Course.CreateHandler)
 
 					r.Route("/{course_id}", func(r chi.Router) {
@@ -263,6 +485,7 @@ func New(db *sqlx.DB, promhttp http.Handler, log bool) (*chi.Mux, error) {
 						r.Use(appAPI.Course.RoleContext)
 
 						r.Post("/enrollments", appAPI.Course.EnrollHandler)
+						r.Post("/enroll", appAPI.Course.EnrollWithCodeHandler)
 
 						r.Route("/", func(r chi.Router) {
 							r.Use(authorize.RequiresAtLeastCourseRole(authorize.STUDENT))
@@ -273,13 +496,23 @@ func New(db *sqlx.DB, promhttp http.Handler, log bool) (*chi.Mux, error) {
 								r.Use(authorize.RequiresAtLeastCourseRole(authorize.ADMIN))
 
 								r.Post("/emails", appAPI.Course.SendEmailHandler)
+								r.Post("/enrollments/bulk", appAPI.Course.BulkEnrollHandler)
+								r.Get("/emails/{broadcast_id}", appAPI.Course.GetEmailBroadcastHandler)
+								r.Get("/enrollment_code", appAPI.Course.GetEnrollmentCodeHandler)
+								r.Post("/enrollment_code", appAPI.Course.ChangeEnrollmentCodeHandler)
+								r.Delete("/enrollment_code", appAPI.Course.DeleteEnrollmentCodeHandler)
 								r.Put("/", appAPI.Course.EditHandler)
 								r.Delete("/", appAPI.Course.DeleteHandler)
 							})
 
 							r.Get("/enrollments", appAPI.Course.IndexEnrollmentsHandler)
+							r.With(authorize.RequiresAtLeastCourseRole(authorize.TUTOR)).Get("/roster.csv", appAPI.Course.RosterHandler)
+							r.With(authorize.RequiresAtLeastCourseRole(authorize.TUTOR)).Get("/gradebook.xlsx", appAPI.Course.GradeBookHandler)
+							r.With(authorize.RequiresAtLeastCourseRole(authorize.TUTOR)).Get("/dashboard", appAPI.Course.DashboardHandler)
 							r.Delete("/enrollments", appAPI.Course.DisenrollHandler)
+							r.Post("/acknowledge_honor_code", appAPI.Course.AcknowledgeHonorCodeHandler)
 							r.Get("/points", appAPI.Course.PointsHandler)
+							r.Get("/structure", appAPI.Course.StructureHandler)
 							r.Get("/bids", appAPI.Course.BidsHandler)
 
 							r.Route("/enrollments/{user_id}", func(r chi.Router) {
@@ -301,6 +534,7 @@ func New(db *sqlx.DB, promhttp http.Handler, log bool) (*chi.Mux, error) {
 									r.Get("/", appAPI.Sheet.GetHandler)
 									r.Route("/tasks", func(r chi.Router) {
 										r.Get("/", appAPI.Task.IndexHandler)
+										r.Get("/status", appAPI.Task.StatusIndexHandler)
 										r.With(authorize.RequiresAtLeastCourseRole(authorize.ADMIN)).Post("/", appAPI.Task.CreateHandler)
 									})
 
@@ -313,6 +547,9 @@ func New(db *sqlx.DB, promhttp http.Handler, log bool) (*chi.Mux, error) {
 										r.Put("/", appAPI.Sheet.EditHandler)
 										r.Delete("/", appAPI.Sheet.DeleteHandler)
 										r.Post("/file", appAPI.Sheet.ChangeFileHandler)
+										r.Get("/extensions", appAPI.Sheet.IndexExtensionsHandler)
+										r.Put("/extensions", appAPI.Sheet.EditExtensionHandler)
+										r.Delete("/extensions/{user_id}", appAPI.Sheet.DeleteExtensionHandler)
 									})
 								})
 							})
@@ -381,6 +618,21 @@ func New(db *sqlx.DB, promhttp http.Handler, log bool) (*chi.Mux, error) {
 								})
 							})
 
+							r.Route("/webhooks", func(r chi.Router) {
+								r.Use(authorize.RequiresAtLeastCourseRole(authorize.ADMIN))
+
+								r.Get("/", appAPI.Webhook.IndexHandler)
+								r.Post("/", appAPI.Webhook.CreateHandler)
+								r.Delete("/{webhook_id}", appAPI.Webhook.DeleteHandler)
+							})
+
+							r.Route("/notes", func(r chi.Router) {
+								r.Get("/", appAPI.CourseNote.IndexHandler)
+								r.With(authorize.RequiresAtLeastCourseRole(authorize.ADMIN)).Post("/", appAPI.CourseNote.CreateHandler)
+								r.With(authorize.RequiresAtLeastCourseRole(authorize.ADMIN)).Put("/{note_id}", appAPI.CourseNote.EditHandler)
+								r.With(authorize.RequiresAtLeastCourseRole(authorize.ADMIN)).Delete("/{note_id}", appAPI.CourseNote.DeleteHandler)
+							})
+
 							r.Route("/materials", func(r chi.Router) {
 								r.Get("/", appAPI.Material.IndexHandler)
 								r.With(authorize.RequiresAtLeastCourseRole(authorize.ADMIN)).Post("/", appAPI.Material.CreateHandler)
@@ -403,11 +655,16 @@ func New(db *sqlx.DB, promhttp http.Handler, log bool) (*chi.Mux, error) {
 
 							r.Route("/submissions", func(r chi.Router) {
 								r.With(authorize.RequiresAtLeastCourseRole(authorize.TUTOR)).Get("/", appAPI.Submission.IndexHandler)
+								r.With(authorize.RequiresAtLeastCourseRole(authorize.TUTOR)).Get("/compare", appAPI.Submission.CompareHandler)
+								r.With(authorize.RequiresAtLeastCourseRole(authorize.ADMIN)).Post("/purge", appAPI.Submission.PurgeHandler)
 
 								r.Route("/{submission_id}", func(r chi.Router) {
 									r.Use(appAPI.Submission.Context)
 
 									r.Get("/file", appAPI.Submission.GetFileByIDHandler)
+									r.Post("/share", appAPI.Submission.ShareFileHandler)
+									r.Get("/queue_position", appAPI.Submission.QueuePositionHandler)
+									r.Get("/diff", appAPI.Submission.DiffHandler)
 								})
 							})
 
@@ -423,6 +680,11 @@ func New(db *sqlx.DB, promhttp http.Handler, log bool) (*chi.Mux, error) {
 									r.Get("/submission", appAPI.Submission.GetFileHandler)
 									r.Post("/submission", appAPI.Submission.UploadFileHandler)
 									r.Get("/result", appAPI.Task.GetSubmissionResultHandler)
+									r.Get("/starter_file", appAPI.Task.GetStarterFileHandler)
+									r.With(authorize.RequiresAtLeastCourseRole(authorize.TUTOR)).Get("/stats", appAPI.Task.StatisticsHandler)
+									r.With(authorize.RequiresAtLeastCourseRole(authorize.TUTOR)).Get("/submissions.zip", appAPI.Submission.GetTaskArchiveHandler)
+									r.With(authorize.RequiresAtLeastCourseRole(authorize.TUTOR)).Get("/submissions", appAPI.Submission.IndexOfTaskHandler)
+									r.With(authorize.RequiresAtLeastCourseRole(authorize.ADMIN)).Delete("/submissions", appAPI.Submission.ResetTaskHandler)
 
 									r.Route("/", func(r chi.Router) {
 										r.Use(authorize.RequiresAtLeastCourseRole(authorize.ADMIN))
@@ -433,6 +695,21 @@ func New(db *sqlx.DB, promhttp http.Handler, log bool) (*chi.Mux, error) {
 										r.Get("/private_file", appAPI.Task.GetPrivateTestFileHandler)
 										r.Post("/public_file", appAPI.Task.ChangePublicTestFileHandler)
 										r.Post("/private_file", appAPI.Task.ChangePrivateTestFileHandler)
+										r.Post("/starter_file", appAPI.Task.ChangeStarterFileHandler)
+									})
+
+									r.Route("/regrade", func(r chi.Router) {
+										r.Use(authorize.RequiresAtLeastCourseRole(authorize.TUTOR))
+
+										r.Get("/", appAPI.Submission.RegradeProgressHandler)
+										r.Post("/", appAPI.Submission.RegradeHandler)
+									})
+
+									r.Route("/users/{user_id}", func(r chi.Router) {
+										r.Use(authorize.RequiresAtLeastCourseRole(authorize.TUTOR))
+										r.Use(appAPI.User.Context)
+
+										r.Get("/submissions.zip", appAPI.Submission.GetHistoryFileHandler)
 									})
 
 									r.Route("/groups/{group_id}", func(r chi.Router) {
@@ -451,12 +728,30 @@ func New(db *sqlx.DB, promhttp http.Handler, log bool) (*chi.Mux, error) {
 				r.Get("/account", appAPI.Account.GetHandler)
 				r.Get("/account/enrollments", appAPI.Account.GetEnrollmentsHandler)
 				r.Get("/account/exams/enrollments", appAPI.Account.GetExamEnrollmentsHandler)
+				r.Get("/account/deadlines", appAPI.Account.GetDeadlinesHandler)
+				r.Get("/account/rate_limit_status", appAPI.Account.GetRateLimitStatusHandler)
+				r.Get("/account/email_log", appAPI.Account.GetEmailLogHandler)
+				r.Get("/account/activity", appAPI.Account.GetActivityHandler)
 				r.Get("/account/avatar", appAPI.Account.GetAvatarHandler)
 				r.Post("/account/avatar", appAPI.Account.ChangeAvatarHandler)
 				r.Delete("/account/avatar", appAPI.Account.DeleteAvatarHandler)
-				r.Patch("/account", appAPI.Account.EditHandler)
+				r.Get("/account/api_keys", appAPI.Account.IndexAPIKeysHandler)
 				r.Delete("/auth/sessions", appAPI.Auth.LogoutHandler)
 
+				// credentials can only be changed by the owner of the account
+				r.Group(func(r chi.Router) {
+					r.Use(NoImpersonation)
+					r.Post("/account/calendar_token", appAPI.Account.CreateCalendarTokenHandler)
+					r.Delete("/account/calendar_token", appAPI.Account.DeleteCalendarTokenHandler)
+					r.Post("/account/2fa/enroll", appAPI.Account.EnrollTwoFactorHandler)
+					r.Post("/account/2fa/verify", appAPI.Account.VerifyTwoFactorHandler)
+					r.Post("/account/2fa/disable", appAPI.Account.DisableTwoFactorHandler)
+					r.Post("/account/api_keys", appAPI.Account.CreateAPIKeyHandler)
+					r.Delete("/account/api_keys/{api_key_id}", appAPI.Account.DeleteAPIKeyHandler)
+					r.Patch("/account", appAPI.Account.EditHandler)
+					r.Delete("/auth/sessions/all", appAPI.Auth.LogoutAllHandler)
+				})
+
 			})
 
 		})
@@ -487,13 +782,46 @@ func FileServer(r chi.Router, path string, root http.FileSystem) {
 	}))
 }
 
-func corsConfig() *cors.Cors {
+// NewCORSMiddleware applies the CORS policy of the route with the longest
+// matching path prefix or the global one if no route matches.
+func NewCORSMiddleware(config configuration.CORSConfiguration) func(http.Handler) http.Handler {
+	routes := make([]configuration.CORSRouteConfiguration, len(config.Routes))
+	copy(routes, config.Routes)
+	sort.SliceStable(routes, func(i, j int) bool {
+		return len(routes[i].Prefix) > len(routes[j].Prefix)
+	})
+
+	return func(next http.Handler) http.Handler {
+		defaultHandler := corsConfig(config.AllowedOrigins).Handler(next)
+
+		routeHandlers := make([]http.Handler, len(routes))
+		for k, route := range routes {
+			routeHandlers[k] = corsConfig(route.AllowedOrigins).Handler(next)
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			for k, route := range routes {
+				if strings.HasPrefix(r.URL.Path, route.Prefix) {
+					routeHandlers[k].ServeHTTP(w, r)
+					return
+				}
+			}
+			defaultHandler.ServeHTTP(w, r)
+		})
+	}
+}
+
+func corsConfig(allowedOrigins []string) *cors.Cors {
+	if len(allowedOrigins) == 0 {
+		allowedOrigins = []string{"*"}
+	}
+
 	// Basic CORS
 	// for more ideas, see: https://developer.github.com/v3/#cross-origin-resource-sharing
 	return cors.New(cors.Options{
-		AllowedOrigins:   []string{"*"},
+		AllowedOrigins:   allowedOrigins,
 		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", EnvelopeHeader},
 		ExposedHeaders:   []string{"Link"},
 		AllowCredentials: true,
 		MaxAge:           86400, // Maximum value not ignored by any of major browsers
@@ -20,14 +20,23 @@
 package app
 
 import (
+	"bytes"
 	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/franela/goblin"
+	"github.com/go-chi/chi"
+	"github.com/go-chi/chi/middleware"
+	"github.com/go-chi/render"
 	"github.com/infomark-org/infomark/configuration"
 	otape "github.com/infomark-org/infomark/tape"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 )
 
 func TestMetrics(t *testing.T) {
@@ -68,3 +77,363 @@ func TestMetrics(t *testing.T) {
 	})
 
 }
+
+func TestAccessLog(t *testing.T) {
+
+	g := goblin.Goblin(t)
+
+	g.Describe("AccessLog", func() {
+
+		g.It("Should write status and duration as JSON", func() {
+			out := &bytes.Buffer{}
+			handler := NewAccessLogger(out, "json", nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusCreated)
+			}))
+
+			r := httptest.NewRequest("POST", "/api/v1/courses", nil)
+			handler.ServeHTTP(httptest.NewRecorder(), r)
+
+			entry := make(map[string]interface{})
+			err := json.Unmarshal(out.Bytes(), &entry)
+			g.Assert(err).Equal(nil)
+			g.Assert(entry["status"]).Equal(float64(http.StatusCreated))
+			g.Assert(entry["method"]).Equal("POST")
+			g.Assert(entry["path"]).Equal("/api/v1/courses")
+
+			_, ok := entry["duration"].(float64)
+			g.Assert(ok).IsTrue()
+
+			// not authenticated
+			_, ok = entry["user_id"]
+			g.Assert(ok).IsFalse()
+		})
+
+		g.It("Should only write configured fields", func() {
+			out := &bytes.Buffer{}
+			handler := NewAccessLogger(out, "json", []string{"status"})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte("ok"))
+			}))
+
+			handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/ping", nil))
+
+			entry := make(map[string]interface{})
+			err := json.Unmarshal(out.Bytes(), &entry)
+			g.Assert(err).Equal(nil)
+			g.Assert(entry["status"]).Equal(float64(http.StatusOK))
+
+			_, ok := entry["method"]
+			g.Assert(ok).IsFalse()
+			_, ok = entry["duration"]
+			g.Assert(ok).IsFalse()
+		})
+
+		g.It("Should only trust forwarded addresses from trusted proxies", func() {
+			config := configuration.Configuration
+			if config == nil {
+				configuration.Configuration = &configuration.ConfigurationSchema{}
+			}
+			defer func() {
+				configuration.Configuration.Server.HTTP.TrustedProxies = nil
+				configuration.Configuration = config
+			}()
+
+			clientIP := func() string {
+				out := &bytes.Buffer{}
+				handler := NewAccessLogger(out, "json", []string{"client_ip"})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					w.Write([]byte("ok"))
+				}))
+
+				r := httptest.NewRequest("GET", "/api/v1/ping", nil)
+				r.RemoteAddr = "10.0.0.2:4711"
+				r.Header.Set("X-Forwarded-For", "203.0.113.9, 198.51.100.7, 10.0.0.3")
+				handler.ServeHTTP(httptest.NewRecorder(), r)
+
+				entry := make(map[string]interface{})
+				err := json.Unmarshal(out.Bytes(), &entry)
+				g.Assert(err).Equal(nil)
+				return entry["client_ip"].(string)
+			}
+
+			g.Assert(clientIP()).Equal("10.0.0.2")
+
+			// the left-most entry can be chosen by the client
+			configuration.Configuration.Server.HTTP.TrustedProxies = []string{"10.0.0.0/8"}
+			g.Assert(clientIP()).Equal("198.51.100.7")
+		})
+
+		g.It("Should not write the query", func() {
+			out := &bytes.Buffer{}
+			handler := NewAccessLogger(out, "json", nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte("ok"))
+			}))
+
+			handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/v1/calendar.ics?token=secret-token", nil))
+
+			g.Assert(strings.Contains(out.String(), "secret-token")).IsFalse()
+			g.Assert(strings.Contains(out.String(), "/api/v1/calendar.ics")).IsTrue()
+		})
+
+	})
+
+}
+
+func TestRequestID(t *testing.T) {
+
+	g := goblin.Goblin(t)
+
+	g.Describe("RequestID", func() {
+
+		g.It("Should report the id of failed requests to clients and logs", func() {
+			render.Respond = RequestIDResponder
+
+			out := &bytes.Buffer{}
+			r := chi.NewRouter()
+			r.Use(middleware.RequestID)
+			r.Use(RequestIDHeader)
+			r.Use(NewAccessLogger(out, "json", nil))
+			r.Get("/fail", func(w http.ResponseWriter, r *http.Request) {
+				render.Render(w, r, ErrInternalServerErrorWithDetails(errors.New("something went wrong")))
+			})
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest("GET", "/fail", nil))
+			g.Assert(w.Code).Equal(http.StatusInternalServerError)
+
+			requestID := w.Header().Get("X-Request-Id")
+			g.Assert(requestID != "").IsTrue()
+
+			body := ErrResponse{}
+			err := json.NewDecoder(w.Body).Decode(&body)
+			g.Assert(err).Equal(nil)
+			g.Assert(body.RequestID).Equal(requestID)
+			g.Assert(body.ErrorText).Equal("something went wrong")
+
+			entry := make(map[string]interface{})
+			err = json.Unmarshal(out.Bytes(), &entry)
+			g.Assert(err).Equal(nil)
+			g.Assert(entry["request_id"]).Equal(requestID)
+		})
+
+	})
+
+}
+
+func TestRecoverer(t *testing.T) {
+
+	g := goblin.Goblin(t)
+
+	g.Describe("Recoverer", func() {
+
+		g.It("Should turn panics into a clean JSON error", func() {
+			render.Respond = RequestIDResponder
+			before := testutil.ToFloat64(totalPanicsVec.WithLabelValues())
+
+			r := chi.NewRouter()
+			r.Use(middleware.RequestID)
+			r.Use(RecovererMiddleware)
+			r.Get("/panic", func(w http.ResponseWriter, r *http.Request) {
+				panic("something went terribly wrong")
+			})
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest("GET", "/panic", nil)
+			req.Header.Set("X-Request-Id", "test-request")
+			r.ServeHTTP(w, req)
+			g.Assert(w.Code).Equal(http.StatusInternalServerError)
+			g.Assert(strings.HasPrefix(w.Header().Get("Content-Type"), "application/json")).IsTrue()
+
+			body := ErrResponse{}
+			err := json.NewDecoder(w.Body).Decode(&body)
+			g.Assert(err).Equal(nil)
+			g.Assert(body.StatusText).Equal(http.StatusText(http.StatusInternalServerError))
+			g.Assert(body.RequestID).Equal("test-request")
+
+			g.Assert(testutil.ToFloat64(totalPanicsVec.WithLabelValues())).Equal(before + 1)
+		})
+
+		g.It("Should write an access log entry for panics", func() {
+			render.Respond = RequestIDResponder
+
+			out := &bytes.Buffer{}
+			r := chi.NewRouter()
+			r.Use(middleware.RequestID)
+			r.Use(NewAccessLogger(out, "json", nil))
+			r.Use(RecovererMiddleware)
+			r.Get("/panic", func(w http.ResponseWriter, r *http.Request) {
+				panic("something went terribly wrong")
+			})
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest("GET", "/panic", nil))
+			g.Assert(w.Code).Equal(http.StatusInternalServerError)
+
+			entry := make(map[string]interface{})
+			err := json.Unmarshal(out.Bytes(), &entry)
+			g.Assert(err).Equal(nil)
+			g.Assert(entry["status"]).Equal(float64(http.StatusInternalServerError))
+			g.Assert(entry["path"]).Equal("/panic")
+		})
+
+	})
+
+}
+
+func TestConcurrencyLimiter(t *testing.T) {
+
+	g := goblin.Goblin(t)
+
+	g.Describe("ConcurrencyLimiter", func() {
+
+		g.It("Should shed requests beyond the limit but serve health checks and worker results", func() {
+			render.Respond = RequestIDResponder
+			InitPrometheus()
+
+			started := make(chan bool)
+			release := make(chan bool)
+
+			r := chi.NewRouter()
+			r.Use(NewConcurrencyLimiter(2))
+			r.Get("/slow", func(w http.ResponseWriter, r *http.Request) {
+				started <- true
+				<-release
+			})
+			r.Get("/api/v1/ping", func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})
+			r.Post("/api/v1/courses/1/grades/1/private_result", func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusNoContent)
+			})
+
+			done := make(chan int)
+			for i := 0; i < 2; i++ {
+				go func() {
+					w := httptest.NewRecorder()
+					r.ServeHTTP(w, httptest.NewRequest("GET", "/slow", nil))
+					done <- w.Code
+				}()
+				<-started
+			}
+			g.Assert(testutil.ToFloat64(inFlightRequestsGauge.WithLabelValues())).Equal(float64(2))
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest("GET", "/slow", nil))
+			g.Assert(w.Code).Equal(http.StatusServiceUnavailable)
+			g.Assert(w.Header().Get("Retry-After")).Equal("1")
+
+			w = httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/ping", nil))
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			w = httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest("POST", "/api/v1/courses/1/grades/1/private_result", nil))
+			g.Assert(w.Code).Equal(http.StatusNoContent)
+
+			close(release)
+			g.Assert(<-done).Equal(http.StatusOK)
+			g.Assert(<-done).Equal(http.StatusOK)
+			g.Assert(testutil.ToFloat64(inFlightRequestsGauge.WithLabelValues())).Equal(float64(0))
+		})
+
+	})
+
+}
+
+func TestStrictJSON(t *testing.T) {
+
+	g := goblin.Goblin(t)
+
+	g.Describe("StrictJSON", func() {
+
+		r := chi.NewRouter()
+		r.Post("/", func(w http.ResponseWriter, r *http.Request) {
+			data := &ResetPasswordRequest{}
+			if err := render.Bind(r, data); err != nil {
+				render.Render(w, r, ErrBadRequestWithDetails(err))
+				return
+			}
+			render.Status(r, http.StatusOK)
+		})
+
+		post := func(body string) *httptest.ResponseRecorder {
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest("POST", "/", strings.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			r.ServeHTTP(w, req)
+			return w
+		}
+
+		g.AfterEach(func() {
+			configuration.Configuration.Server.HTTP.StrictJSON = false
+		})
+
+		g.It("Should ignore unknown fields by default", func() {
+			render.Decode = LimitedDecoder
+			w := post(`{"email": "test@uni-tuebingen.de", "emial": "typo"}`)
+			g.Assert(w.Code).Equal(http.StatusOK)
+		})
+
+		g.It("Should reject unknown fields in strict mode", func() {
+			render.Decode = LimitedDecoder
+			configuration.Configuration.Server.HTTP.StrictJSON = true
+
+			w := post(`{"email": "test@uni-tuebingen.de", "emial": "typo"}`)
+			g.Assert(w.Code).Equal(http.StatusBadRequest)
+			g.Assert(strings.Contains(w.Body.String(), `unknown field \"emial\"`)).IsTrue()
+
+			w = post(`{"email": "test@uni-tuebingen.de"}`)
+			g.Assert(w.Code).Equal(http.StatusOK)
+		})
+
+	})
+
+}
+
+func TestCORS(t *testing.T) {
+
+	g := goblin.Goblin(t)
+
+	g.Describe("CORS", func() {
+
+		handler := NewCORSMiddleware(configuration.CORSConfiguration{
+			AllowedOrigins: []string{"*"},
+			Routes: []configuration.CORSRouteConfiguration{
+				{Prefix: "/api/v1/", AllowedOrigins: []string{"https://other.example.com"}},
+				{Prefix: "/api/v1/auth/", AllowedOrigins: []string{"https://app.example.com"}},
+			},
+		})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}))
+
+		preflight := func(path string, origin string) *httptest.ResponseRecorder {
+			r := httptest.NewRequest("OPTIONS", path, nil)
+			r.Header.Set("Origin", origin)
+			r.Header.Set("Access-Control-Request-Method", "POST")
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			return w
+		}
+
+		g.It("Should allow any origin on public routes", func() {
+			w := preflight("/ping", "https://evil.example.com")
+			g.Assert(w.Header().Get("Access-Control-Allow-Origin")).Equal("https://evil.example.com")
+		})
+
+		g.It("Should only allow the app origin on auth routes", func() {
+			w := preflight("/api/v1/auth/sessions", "https://evil.example.com")
+			g.Assert(w.Header().Get("Access-Control-Allow-Origin")).Equal("")
+
+			w = preflight("/api/v1/auth/sessions", "https://app.example.com")
+			g.Assert(w.Header().Get("Access-Control-Allow-Origin")).Equal("https://app.example.com")
+		})
+
+		g.It("Should use the longest matching prefix", func() {
+			w := preflight("/api/v1/courses", "https://other.example.com")
+			g.Assert(w.Header().Get("Access-Control-Allow-Origin")).Equal("https://other.example.com")
+
+			w = preflight("/api/v1/auth/sessions", "https://other.example.com")
+			g.Assert(w.Header().Get("Access-Control-Allow-Origin")).Equal("")
+		})
+
+	})
+
+}
@@ -0,0 +1,149 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package app
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/infomark-org/infomark/auth"
+	"github.com/infomark-org/infomark/model"
+	"github.com/infomark-org/infomark/symbol"
+)
+
+// DemoCourseName is the name of the course created by SeedDemoData.
+const DemoCourseName = "InfoMark Demo Course"
+
+// DemoPassword is the password of all demo users.
+const DemoPassword = "demo-password"
+
+// DemoUser describes a user created by SeedDemoData.
+type DemoUser struct {
+	FirstName string
+	LastName  string
+	Email     string
+	Root      bool
+	Role      int64
+}
+
+// DemoUsers are the users created by SeedDemoData and their role in the demo
+// course.
+var DemoUsers = []DemoUser{
+	{FirstName: "Ada", LastName: "Admin", Email: "demo.admin@infomark.org", Root: true, Role: 2},
+	{FirstName: "Tom", LastName: "Tutor", Email: "demo.tutor@infomark.org", Role: 1},
+	{FirstName: "Sam", LastName: "Student", Email: "demo.student1@infomark.org", Role: 0},
+	{FirstName: "Sue", LastName: "Student", Email: "demo.student2@infomark.org", Role: 0},
+}
+
+// SeedDemoData creates a demo course with sheets, tasks and users for local
+// development. Existing demo entries are reused, such that seeding can be run
+// several times.
+func SeedDemoData(stores *Stores) (*model.Course, error) {
+	course, err := seedDemoCourse(stores)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, demoUser := range DemoUsers {
+		user, err := seedDemoUser(stores, demoUser)
+		if err != nil {
+			return nil, err
+		}
+
+		if _, err := stores.Course.GetUserEnrollment(course.ID, user.ID); err == nil {
+			continue
+		}
+		if err := stores.Course.Enroll(course.ID, user.ID, demoUser.Role); err != nil {
+			return nil, err
+		}
+	}
+
+	return course, nil
+}
+
+func seedDemoCourse(stores *Stores) (*model.Course, error) {
+	courses, err := stores.Course.GetAll()
+	if err != nil {
+		return nil, err
+	}
+	for k := range courses {
+		if courses[k].Name == DemoCourseName {
+			return &courses[k], nil
+		}
+	}
+
+	now := NowUTC()
+	course, err := stores.Course.Create(&model.Course{
+		Name:               DemoCourseName,
+		Description:        "A course to play around with during development.",
+		BeginsAt:           now.Add(-30 * 24 * time.Hour),
+		EndsAt:             now.Add(90 * 24 * time.Hour),
+		RequiredPercentage: 50,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// one finished, one running and one upcoming sheet
+	for k, offset := range []time.Duration{-14, 0, 14} {
+		sheet, err := stores.Sheet.Create(&model.Sheet{
+			Name:          fmt.Sprintf("Sheet %d", k+1),
+			PublishAt:     now.Add((offset - 7) * 24 * time.Hour),
+			DueAt:         now.Add((offset + 7) * 24 * time.Hour),
+			ScoringPolicy: symbol.ScoringPolicyLatest,
+
+			GradesPublished: true,
+		}, course.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		for t := 1; t <= 3; t++ {
+			if _, err := stores.Task.Create(&model.Task{
+				Name:      fmt.Sprintf("Task %d.%d", k+1, t),
+				MaxPoints: 10,
+			}, sheet.ID); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return course, nil
+}
+
+func seedDemoUser(stores *Stores, demoUser DemoUser) (*model.User, error) {
+	if user, err := stores.User.FindByEmail(demoUser.Email); err == nil {
+		return user, nil
+	}
+
+	encryptedPassword, err := auth.HashPassword(DemoPassword)
+	if err != nil {
+		return nil, err
+	}
+
+	return stores.User.Create(&model.User{
+		FirstName:         demoUser.FirstName,
+		LastName:          demoUser.LastName,
+		Email:             demoUser.Email,
+		Semester:          1,
+		Subject:           "computer science",
+		Language:          "en",
+		EncryptedPassword: encryptedPassword,
+		Root:              demoUser.Root,
+	})
+}
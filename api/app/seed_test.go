@@ -0,0 +1,95 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package app
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/franela/goblin"
+	"github.com/infomark-org/infomark/email"
+)
+
+func TestSeed(t *testing.T) {
+	g := goblin.Goblin(t)
+	email.DefaultMail = email.VoidMail
+
+	tape := NewTape()
+
+	var stores *Stores
+
+	g.Describe("Seed", func() {
+
+		g.BeforeEach(func() {
+			tape.BeforeEach()
+			stores = NewStores(tape.DB)
+		})
+
+		g.It("Should not duplicate demo data when seeding twice", func() {
+			countDemoCourses := func() int {
+				courses, err := stores.Course.GetAll()
+				g.Assert(err).Equal(nil)
+				count := 0
+				for _, course := range courses {
+					if course.Name == DemoCourseName {
+						count++
+					}
+				}
+				return count
+			}
+
+			g.Assert(countDemoCourses()).Equal(0)
+
+			course, err := SeedDemoData(stores)
+			g.Assert(err).Equal(nil)
+			g.Assert(countDemoCourses()).Equal(1)
+
+			sheets, err := stores.Sheet.SheetsOfCourse(course.ID)
+			g.Assert(err).Equal(nil)
+			g.Assert(len(sheets)).Equal(3)
+
+			usersBefore, err := stores.User.GetAll()
+			g.Assert(err).Equal(nil)
+
+			again, err := SeedDemoData(stores)
+			g.Assert(err).Equal(nil)
+			g.Assert(again.ID).Equal(course.ID)
+			g.Assert(countDemoCourses()).Equal(1)
+
+			sheets, err = stores.Sheet.SheetsOfCourse(course.ID)
+			g.Assert(err).Equal(nil)
+			g.Assert(len(sheets)).Equal(3)
+
+			usersAfter, err := stores.User.GetAll()
+			g.Assert(err).Equal(nil)
+			g.Assert(len(usersAfter)).Equal(len(usersBefore))
+
+			// demo users can log in
+			w := tape.Post("/api/v1/auth/sessions", H{
+				"email":          DemoUsers[2].Email,
+				"plain_password": DemoPassword,
+			})
+			g.Assert(w.Code).Equal(http.StatusOK)
+		})
+
+		g.AfterEach(func() {
+			tape.AfterEach()
+		})
+
+	})
+}
@@ -30,6 +30,7 @@ import (
 	"github.com/infomark-org/infomark/api/helper"
 	"github.com/infomark-org/infomark/auth/authenticate"
 	"github.com/infomark-org/infomark/auth/authorize"
+	"github.com/infomark-org/infomark/event"
 	"github.com/infomark-org/infomark/model"
 	"github.com/infomark-org/infomark/symbol"
 )
@@ -37,12 +38,14 @@ import (
 // SheetResource specifies Sheet management handler.
 type SheetResource struct {
 	Stores *Stores
+	Events *event.Bus
 }
 
 // NewSheetResource create and returns a SheetResource.
-func NewSheetResource(stores *Stores) *SheetResource {
+func NewSheetResource(stores *Stores, events *event.Bus) *SheetResource {
 	return &SheetResource{
 		Stores: stores,
+		Events: events,
 	}
 }
 
@@ -105,9 +108,19 @@ func (rs *SheetResource) CreateHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	sheet := &model.Sheet{
-		Name:      data.Name,
-		PublishAt: data.PublishAt,
-		DueAt:     data.DueAt,
+		Name:          data.Name,
+		PublishAt:     data.PublishAt,
+		DueAt:         data.DueAt,
+		ScoringPolicy: symbol.ScoringPolicyLatest,
+
+		GradesPublished: true,
+	}
+
+	if data.ScoringPolicy != "" {
+		sheet.ScoringPolicy = data.ScoringPolicy
+	}
+	if data.GradesPublished != nil {
+		sheet.GradesPublished = *data.GradesPublished
 	}
 
 	// create Sheet entry in database
@@ -119,8 +132,12 @@ func (rs *SheetResource) CreateHandler(w http.ResponseWriter, r *http.Request) {
 
 	render.Status(r, http.StatusCreated)
 
-	// return Sheet information of created entry
-	if err := render.Render(w, r, rs.newSheetResponse(newSheet)); err != nil {
+	// return Sheet information of created entry together with hints about
+	// suspicious values
+	resp := rs.newSheetResponse(newSheet)
+	resp.Warnings = data.Warnings()
+
+	if err := render.Render(w, r, resp); err != nil {
 		render.Render(w, r, ErrRender(err))
 		return
 	}
@@ -163,6 +180,10 @@ func (rs *SheetResource) GetHandler(w http.ResponseWriter, r *http.Request) {
 // RESPONSE: 401,Unauthenticated
 // RESPONSE: 403,Unauthorized
 // SUMMARY:  update a specific sheet
+// DESCRIPTION:
+// Setting "grades_published" to false hides the points of this sheet from
+// students until they are published again. Publishing them notifies the
+// students about their grades.
 func (rs *SheetResource) EditHandler(w http.ResponseWriter, r *http.Request) {
 	sheet := r.Context().Value(symbol.CtxKeySheet).(*model.Sheet)
 
@@ -179,12 +200,28 @@ func (rs *SheetResource) EditHandler(w http.ResponseWriter, r *http.Request) {
 	sheet.PublishAt = data.PublishAt
 	sheet.DueAt = data.DueAt
 
+	// keep the scoring policy and publication of grades unless they are
+	// changed explicitly
+	if data.ScoringPolicy != "" {
+		sheet.ScoringPolicy = data.ScoringPolicy
+	}
+	published := false
+	if data.GradesPublished != nil {
+		published = *data.GradesPublished && !sheet.GradesPublished
+		sheet.GradesPublished = *data.GradesPublished
+	}
+
 	// update database entry
 	if err := rs.Stores.Sheet.Update(sheet); err != nil {
 		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
 		return
 	}
 
+	if published {
+		course := r.Context().Value(symbol.CtxKeyCourse).(*model.Course)
+		rs.Events.Publish(event.GradesPublished{CourseID: course.ID, Sheet: sheet})
+	}
+
 	render.Status(r, http.StatusNoContent)
 }
 
@@ -211,6 +248,100 @@ func (rs *SheetResource) DeleteHandler(w http.ResponseWriter, r *http.Request) {
 	render.Status(r, http.StatusNoContent)
 }
 
+// IndexExtensionsHandler is public endpoint for
+// URL: /courses/{course_id}/sheets/{sheet_id}/extensions
+// URLPARAM: course_id,integer
+// URLPARAM: sheet_id,integer
+// METHOD: get
+// TAG: sheets
+// RESPONSE: 200,SheetExtensionResponseList
+// RESPONSE: 400,BadRequest
+// RESPONSE: 401,Unauthenticated
+// RESPONSE: 403,Unauthorized
+// SUMMARY:  all extensions of the due date of a sheet
+func (rs *SheetResource) IndexExtensionsHandler(w http.ResponseWriter, r *http.Request) {
+	sheet := r.Context().Value(symbol.CtxKeySheet).(*model.Sheet)
+
+	extensions, err := rs.Stores.Sheet.ExtensionsOfSheet(sheet.ID)
+	if err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
+	if err := render.RenderList(w, r, newSheetExtensionListResponse(extensions)); err != nil {
+		render.Render(w, r, ErrRender(err))
+		return
+	}
+}
+
+// EditExtensionHandler is public endpoint for
+// URL: /courses/{course_id}/sheets/{sheet_id}/extensions
+// URLPARAM: course_id,integer
+// URLPARAM: sheet_id,integer
+// METHOD: put
+// TAG: sheets
+// REQUEST: SheetExtensionRequest
+// RESPONSE: 204,NoContent
+// RESPONSE: 400,BadRequest
+// RESPONSE: 401,Unauthenticated
+// RESPONSE: 403,Unauthorized
+// SUMMARY:  grant a student more time to submit solutions
+// DESCRIPTION:
+// Submissions are only accepted between the publication and the due date of
+// a sheet. An extension replaces the due date for a single enrolled user. An
+// existing extension of the user is overwritten.
+func (rs *SheetResource) EditExtensionHandler(w http.ResponseWriter, r *http.Request) {
+	sheet := r.Context().Value(symbol.CtxKeySheet).(*model.Sheet)
+	course := r.Context().Value(symbol.CtxKeyCourse).(*model.Course)
+
+	data := &SheetExtensionRequest{}
+	if err := render.Bind(r, data); err != nil {
+		render.Render(w, r, ErrBadRequestWithDetails(err))
+		return
+	}
+
+	if _, err := rs.Stores.Course.GetUserEnrollment(course.ID, data.UserID); err != nil {
+		render.Render(w, r, ErrBadRequestWithDetails(fmt.Errorf("user %d is not enrolled in this course", data.UserID)))
+		return
+	}
+
+	if err := rs.Stores.Sheet.SetExtension(sheet.ID, data.UserID, data.DueAt); err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
+	render.Status(r, http.StatusNoContent)
+}
+
+// DeleteExtensionHandler is public endpoint for
+// URL: /courses/{course_id}/sheets/{sheet_id}/extensions/{user_id}
+// URLPARAM: course_id,integer
+// URLPARAM: sheet_id,integer
+// URLPARAM: user_id,integer
+// METHOD: delete
+// TAG: sheets
+// RESPONSE: 204,NoContent
+// RESPONSE: 400,BadRequest
+// RESPONSE: 401,Unauthenticated
+// RESPONSE: 403,Unauthorized
+// SUMMARY:  revoke the extension of a student
+func (rs *SheetResource) DeleteExtensionHandler(w http.ResponseWriter, r *http.Request) {
+	sheet := r.Context().Value(symbol.CtxKeySheet).(*model.Sheet)
+
+	userID, err := strconv.ParseInt(chi.URLParam(r, "user_id"), 10, 64)
+	if err != nil {
+		render.Render(w, r, ErrBadRequest)
+		return
+	}
+
+	if err := rs.Stores.Sheet.DeleteExtension(sheet.ID, userID); err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
+	render.Status(r, http.StatusNoContent)
+}
+
 // GetFileHandler is public endpoint for
 // URL: /courses/{course_id}/sheets/{sheet_id}/file
 // URLPARAM: course_id,integer
@@ -218,10 +349,14 @@ func (rs *SheetResource) DeleteHandler(w http.ResponseWriter, r *http.Request) {
 // METHOD: get
 // TAG: sheets
 // RESPONSE: 200,ZipFile
+// RESPONSE: 304,NotModified
 // RESPONSE: 400,BadRequest
 // RESPONSE: 401,Unauthenticated
 // RESPONSE: 403,Unauthorized
 // SUMMARY:  get the zip file of a sheet
+// DESCRIPTION:
+// The response carries an ETag derived from the content of the file. Requests
+// with a matching "If-None-Match" header are answered with 304.
 func (rs *SheetResource) GetFileHandler(w http.ResponseWriter, r *http.Request) {
 
 	sheet := r.Context().Value(symbol.CtxKeySheet).(*model.Sheet)
@@ -233,6 +368,10 @@ func (rs *SheetResource) GetFileHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	if fileNotModified(w, r, hnd) {
+		return
+	}
+
 	if err := hnd.WriteToBodyWithName(fmt.Sprintf("%s-%s.zip", course.Name, sheet.Name), w); err != nil {
 		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
 	}
@@ -251,9 +390,29 @@ func (rs *SheetResource) GetFileHandler(w http.ResponseWriter, r *http.Request)
 // RESPONSE: 401,Unauthenticated
 // RESPONSE: 403,Unauthorized
 // SUMMARY:  change the zip file of a sheet
+// DESCRIPTION:
+// The file can be sent in several chunks using the "Content-Range" header.
+// Incomplete uploads are answered with 202 and a "Range" header.
 func (rs *SheetResource) ChangeFileHandler(w http.ResponseWriter, r *http.Request) {
 	// will always be a POST
 	sheet := r.Context().Value(symbol.CtxKeySheet).(*model.Sheet)
+	accessClaims := r.Context().Value(symbol.CtxKeyAccessClaims).(*authenticate.AccessClaims)
+
+	chunks := helper.NewChunkedUpload(fmt.Sprintf("sheet%d-user%d", sheet.ID, accessClaims.LoginID))
+	if helper.IsChunkedUpload(r) {
+		if !AppendChunk(w, r, chunks, helper.NewSheetFileHandle(sheet.ID).MaxBytes) {
+			return
+		}
+		if err := helper.NewSheetFileHandle(sheet.ID).WriteFromChunks(chunks); err != nil {
+			render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+			return
+		}
+		render.Status(r, http.StatusOK)
+		return
+	}
+
+	// a complete upload supersedes an unfinished chunked one
+	chunks.Delete()
 
 	// the file will be located
 	if _, err := helper.NewSheetFileHandle(sheet.ID).WriteToDisk(r, "file_data"); err != nil {
@@ -273,9 +432,13 @@ func (rs *SheetResource) ChangeFileHandler(w http.ResponseWriter, r *http.Reques
 // RESPONSE: 401,Unauthenticated
 // RESPONSE: 403,Unauthorized
 // SUMMARY:  return all points from a sheet for the request identity
+// DESCRIPTION:
+// Students get "grading_in_progress" instead of their points as long as the
+// grades of the sheet are not published.
 func (rs *SheetResource) PointsHandler(w http.ResponseWriter, r *http.Request) {
 	sheet := r.Context().Value(symbol.CtxKeySheet).(*model.Sheet)
 	accessClaims := r.Context().Value(symbol.CtxKeyAccessClaims).(*authenticate.AccessClaims)
+	givenRole := r.Context().Value(symbol.CtxKeyCourseRole).(authorize.CourseRole)
 
 	taskPoints, err := rs.Stores.Sheet.PointsForUser(accessClaims.LoginID, sheet.ID)
 	if err != nil {
@@ -284,7 +447,7 @@ func (rs *SheetResource) PointsHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// resp := &SheetPointsResponse{SheetPoints: taskPoints}
-	if err := render.RenderList(w, r, newTaskPointsListResponse(taskPoints)); err != nil {
+	if err := render.RenderList(w, r, newTaskPointsListResponse(taskPoints, sheet.GradesPublished || givenRole != authorize.STUDENT)); err != nil {
 		render.Render(w, r, ErrRender(err))
 		return
 	}
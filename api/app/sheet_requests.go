@@ -25,13 +25,17 @@ import (
 	"time"
 
 	validation "github.com/go-ozzo/ozzo-validation"
+	"github.com/infomark-org/infomark/symbol"
 )
 
 // SheetRequest is the request payload for Sheet management.
 type SheetRequest struct {
-	Name      string    `json:"name" example:"Blatt 42"`
-	PublishAt time.Time `json:"publish_at" example:"auto"`
-	DueAt     time.Time `json:"due_at" example:"auto"`
+	Name          string    `json:"name" example:"Blatt 42"`
+	PublishAt     time.Time `json:"publish_at" example:"auto"`
+	DueAt         time.Time `json:"due_at" example:"auto"`
+	ScoringPolicy string    `json:"scoring_policy" example:"latest" required:"false"`
+	// GradesPublished withholds the points from students if false.
+	GradesPublished *bool `json:"grades_published" example:"true" required:"false"`
 }
 
 // Bind preprocesses a SheetRequest.
@@ -44,6 +48,15 @@ func (body *SheetRequest) Bind(r *http.Request) error {
 	return body.Validate()
 }
 
+// Warnings reports values of a SheetRequest which are valid but suspicious.
+func (body *SheetRequest) Warnings() Warnings {
+	warnings := Warnings{}
+	if OverTime(body.DueAt) {
+		warnings.Add("due date is in the past")
+	}
+	return warnings
+}
+
 // Validate validates a SheetRequest
 func (body *SheetRequest) Validate() error {
 
@@ -60,6 +73,10 @@ func (body *SheetRequest) Validate() error {
 			&body.Name,
 			validation.Required,
 		),
+		validation.Field(
+			&body.ScoringPolicy,
+			validation.In(symbol.ScoringPolicyLatest, symbol.ScoringPolicyBest),
+		),
 	)
 
 	if err == nil {
@@ -70,3 +87,21 @@ func (body *SheetRequest) Validate() error {
 
 	return err
 }
+
+// SheetExtensionRequest grants a user more time to submit solutions to a sheet.
+type SheetExtensionRequest struct {
+	UserID int64     `json:"user_id" example:"112"`
+	DueAt  time.Time `json:"due_at" example:"auto"`
+}
+
+// Bind preprocesses a SheetExtensionRequest.
+func (body *SheetExtensionRequest) Bind(r *http.Request) error {
+	if body == nil {
+		return errors.New("missing \"extension\" data")
+	}
+
+	return validation.ValidateStruct(body,
+		validation.Field(&body.UserID, validation.Required),
+		validation.Field(&body.DueAt, validation.Required),
+	)
+}
@@ -32,11 +32,14 @@ import (
 
 // SheetResponse is the response payload for Sheet management.
 type SheetResponse struct {
-	ID        int64     `json:"id" example:"13"`
-	Name      string    `json:"name" example:"Blatt 0"`
-	FileURL   string    `json:"file_url" example:"/api/v1/sheets/13/file"`
-	PublishAt time.Time `json:"publish_at" example:"auto"`
-	DueAt     time.Time `json:"due_at" example:"auto"`
+	ID              int64     `json:"id" example:"13"`
+	Name            string    `json:"name" example:"Blatt 0"`
+	FileURL         string    `json:"file_url" example:"/api/v1/sheets/13/file"`
+	PublishAt       time.Time `json:"publish_at" example:"auto"`
+	DueAt           time.Time `json:"due_at" example:"auto"`
+	ScoringPolicy   string    `json:"scoring_policy" example:"latest"`
+	GradesPublished bool      `json:"grades_published" example:"true"`
+	Warnings        []string  `json:"warnings,omitempty" example:"due date is in the past"`
 }
 
 // Render post-processes a SheetResponse.
@@ -47,11 +50,13 @@ func (body *SheetResponse) Render(w http.ResponseWriter, r *http.Request) error
 // newSheetResponse creates a response from a Sheet model.
 func (rs *SheetResource) newSheetResponse(p *model.Sheet) *SheetResponse {
 	return &SheetResponse{
-		ID:        p.ID,
-		Name:      p.Name,
-		PublishAt: p.PublishAt,
-		DueAt:     p.DueAt,
-		FileURL:   fmt.Sprintf("/api/v1/sheets/%s/file", strconv.FormatInt(p.ID, 10)),
+		ID:              p.ID,
+		Name:            p.Name,
+		PublishAt:       p.PublishAt,
+		DueAt:           p.DueAt,
+		ScoringPolicy:   p.ScoringPolicy,
+		GradesPublished: p.GradesPublished,
+		FileURL:         fmt.Sprintf("/api/v1/sheets/%s/file", strconv.FormatInt(p.ID, 10)),
 	}
 }
 
@@ -68,11 +73,13 @@ func (rs *SheetResource) newSheetListResponse(givenRole authorize.CourseRole, Sh
 	return list
 }
 
-// TaskPointsResponse returns a performance summary for a task and student
+// TaskPointsResponse returns a performance summary for a task and student.
+// The acquired points are zero while grading is in progress.
 type TaskPointsResponse struct {
-	AquiredPoints int `json:"acquired_points" example:"58"`
-	MaxPoints     int `json:"max_points" example:"90"`
-	TaskID        int `json:"task_id" example:"2"`
+	AquiredPoints     int  `json:"acquired_points" example:"58"`
+	MaxPoints         int  `json:"max_points" example:"90"`
+	TaskID            int  `json:"task_id" example:"2"`
+	GradingInProgress bool `json:"grading_in_progress" example:"false"`
 }
 
 // Render post-processes a TaskPointsResponse.
@@ -80,7 +87,15 @@ func (body *TaskPointsResponse) Render(w http.ResponseWriter, r *http.Request) e
 	return nil
 }
 
-func newTaskPointsResponse(p *model.TaskPoints) *TaskPointsResponse {
+func newTaskPointsResponse(p *model.TaskPoints, gradesPublished bool) *TaskPointsResponse {
+	if !gradesPublished {
+		return &TaskPointsResponse{
+			MaxPoints:         p.MaxPoints,
+			TaskID:            p.TaskID,
+			GradingInProgress: true,
+		}
+	}
+
 	return &TaskPointsResponse{
 		AquiredPoints: p.AquiredPoints,
 		MaxPoints:     p.MaxPoints,
@@ -89,11 +104,34 @@ func newTaskPointsResponse(p *model.TaskPoints) *TaskPointsResponse {
 }
 
 // newCourseListResponse creates a response from a list of course models.
-func newTaskPointsListResponse(collection []model.TaskPoints) []render.Renderer {
+func newTaskPointsListResponse(collection []model.TaskPoints, gradesPublished bool) []render.Renderer {
 	list := []render.Renderer{}
 	for k := range collection {
-		list = append(list, newTaskPointsResponse(&collection[k]))
+		list = append(list, newTaskPointsResponse(&collection[k], gradesPublished))
 	}
 
 	return list
 }
+
+// SheetExtensionResponse is the response payload for extensions of the due
+// date of a sheet.
+type SheetExtensionResponse struct {
+	UserID int64     `json:"user_id" example:"112"`
+	DueAt  time.Time `json:"due_at" example:"auto"`
+}
+
+// Render post-processes a SheetExtensionResponse.
+func (body *SheetExtensionResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+func newSheetExtensionListResponse(extensions []model.SheetExtension) []render.Renderer {
+	list := []render.Renderer{}
+	for k := range extensions {
+		list = append(list, &SheetExtensionResponse{
+			UserID: extensions[k].UserID,
+			DueAt:  extensions[k].DueAt,
+		})
+	}
+	return list
+}
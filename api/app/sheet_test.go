@@ -22,7 +22,9 @@ package app
 import (
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"net/http"
+	"os"
 	"testing"
 	"time"
 
@@ -158,6 +160,39 @@ func TestSheet(t *testing.T) {
 			g.Assert(len(sheetsAfter)).Equal(len(sheetsBefore) + 1)
 		})
 
+		g.It("Should warn about a due date in the past", func() {
+			sheetsBefore, err := stores.Sheet.SheetsOfCourse(1)
+			g.Assert(err).Equal(nil)
+
+			sheetSent := SheetRequest{
+				Name:      "Sheet_past",
+				PublishAt: helper.Time(time.Now().Add(-48 * time.Hour)),
+				DueAt:     helper.Time(time.Now().Add(-24 * time.Hour)),
+			}
+
+			w := tape.Post("/api/v1/courses/1/sheets", tape.ToH(sheetSent), noAdminJWT)
+			g.Assert(w.Code).Equal(http.StatusCreated)
+
+			sheetReturn := &SheetResponse{}
+			err = json.NewDecoder(w.Body).Decode(&sheetReturn)
+			g.Assert(err).Equal(nil)
+			g.Assert(sheetReturn.Warnings).Equal([]string{"due date is in the past"})
+
+			sheetsAfter, err := stores.Sheet.SheetsOfCourse(1)
+			g.Assert(err).Equal(nil)
+			g.Assert(len(sheetsAfter)).Equal(len(sheetsBefore) + 1)
+
+			// no warnings for a future due date
+			sheetSent.DueAt = helper.Time(time.Now().Add(24 * time.Hour))
+			w = tape.Post("/api/v1/courses/1/sheets", tape.ToH(sheetSent), noAdminJWT)
+			g.Assert(w.Code).Equal(http.StatusCreated)
+
+			sheetReturn = &SheetResponse{}
+			err = json.NewDecoder(w.Body).Decode(&sheetReturn)
+			g.Assert(err).Equal(nil)
+			g.Assert(len(sheetReturn.Warnings)).Equal(0)
+		})
+
 		g.It("Should skip non-existent sheet file", func() {
 			w := tape.Get("/api/v1/courses/1/sheets/1/file", adminJWT)
 			g.Assert(w.Code).Equal(http.StatusNotFound)
@@ -193,6 +228,81 @@ func TestSheet(t *testing.T) {
 			g.Assert(w.Code).Equal(http.StatusOK)
 		})
 
+		g.It("Should store the files of a course in its own directory", func() {
+			courseUploads, err := ioutil.TempDir("", "course-uploads")
+			g.Assert(err).Equal(nil)
+			defer os.RemoveAll(courseUploads)
+
+			defer func() {
+				configuration.Configuration.Server.Paths.CourseUploads = nil
+			}()
+			configuration.Configuration.Server.Paths.CourseUploads = map[int64]string{1: courseUploads}
+
+			otherSheetID, err := DBGetInt(tape, "SELECT sheet_id FROM sheet_course WHERE course_id = $1 LIMIT 1", 2)
+			g.Assert(err).Equal(nil)
+
+			defer helper.NewSheetFileHandle(1).Delete()
+			defer helper.NewSheetFileHandle(int64(otherSheetID)).Delete()
+
+			filename := fmt.Sprintf("%s/empty.zip", configuration.Configuration.Server.Debugging.Fixtures)
+			w, err := tape.Upload("/api/v1/courses/1/sheets/1/file", filename, "application/zip", adminJWT)
+			g.Assert(err).Equal(nil)
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			w, err = tape.Upload(fmt.Sprintf("/api/v1/courses/2/sheets/%d/file", otherSheetID), filename, "application/zip", adminJWT)
+			g.Assert(err).Equal(nil)
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			// course 1 writes into its own directory
+			g.Assert(helper.NewSheetFileHandle(1).Path()).Equal(fmt.Sprintf("%s/sheets/1.zip", courseUploads))
+			g.Assert(helper.FileExists(fmt.Sprintf("%s/sheets/1.zip", courseUploads))).Equal(true)
+			g.Assert(helper.FileExists(fmt.Sprintf("%s/sheets/1.zip", configuration.Configuration.Server.Paths.Uploads))).Equal(false)
+
+			// all other courses use the global directory
+			g.Assert(helper.FileExists(fmt.Sprintf("%s/sheets/%d.zip", configuration.Configuration.Server.Paths.Uploads, otherSheetID))).Equal(true)
+			g.Assert(helper.FileExists(fmt.Sprintf("%s/sheets/%d.zip", courseUploads, otherSheetID))).Equal(false)
+
+			w = tape.Get("/api/v1/courses/1/sheets/1/file", adminJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			// files of an unknown course are not placed in the global directory
+			unknown := helper.NewSheetFileHandle(424242)
+			g.Assert(unknown.Resolve() != nil).IsTrue()
+			g.Assert(unknown.Path()).Equal("")
+			g.Assert(unknown.Delete() != nil).IsTrue()
+		})
+
+		g.It("Should answer conditional sheet file requests", func() {
+			defer helper.NewSheetFileHandle(1).Delete()
+
+			filename := fmt.Sprintf("%s/empty.zip", configuration.Configuration.Server.Debugging.Fixtures)
+			w, err := tape.Upload("/api/v1/courses/1/sheets/1/file", filename, "application/zip", noAdminJWT)
+			g.Assert(err).Equal(nil)
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			checksum, err := helper.NewSheetFileHandle(1).Sha256()
+			g.Assert(err).Equal(nil)
+
+			w = tape.Get("/api/v1/courses/1/sheets/1/file", adminJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+			etag := w.Header().Get("ETag")
+			g.Assert(etag).Equal(fmt.Sprintf("\"%s\"", checksum))
+
+			w = tape.Get("/api/v1/courses/1/sheets/1/file", adminJWT, ifNoneMatch(etag))
+			g.Assert(w.Code).Equal(http.StatusNotModified)
+			g.Assert(w.Body.Len()).Equal(0)
+
+			// a new file has a new tag
+			filename = fmt.Sprintf("%s/unittest.zip", configuration.Configuration.Server.Debugging.Fixtures)
+			w, err = tape.Upload("/api/v1/courses/1/sheets/1/file", filename, "application/zip", noAdminJWT)
+			g.Assert(err).Equal(nil)
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			w = tape.Get("/api/v1/courses/1/sheets/1/file", adminJWT, ifNoneMatch(etag))
+			g.Assert(w.Code).Equal(http.StatusOK)
+			g.Assert(w.Header().Get("ETag") != etag).IsTrue()
+		})
+
 		g.It("Changes should require claims", func() {
 			w := tape.Put("/api/v1/courses/1/sheets", H{})
 			g.Assert(w.Code).Equal(http.StatusUnauthorized)
@@ -264,6 +374,105 @@ func TestSheet(t *testing.T) {
 
 		})
 
+		g.It("Should withhold points from students until grades are published", func() {
+			sheet, err := stores.Sheet.Get(1)
+			g.Assert(err).Equal(nil)
+			g.Assert(sheet.GradesPublished).IsTrue()
+
+			gradesPublished := false
+			sheetSent := SheetRequest{
+				Name:            sheet.Name,
+				PublishAt:       sheet.PublishAt,
+				DueAt:           sheet.DueAt,
+				GradesPublished: &gradesPublished,
+			}
+
+			w := tape.Put("/api/v1/courses/1/sheets/1", tape.ToH(sheetSent), adminJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			sheetAfter, err := stores.Sheet.Get(1)
+			g.Assert(err).Equal(nil)
+			g.Assert(sheetAfter.GradesPublished).IsFalse()
+
+			// edits without the flag keep it
+			sheetSent.GradesPublished = nil
+			w = tape.Put("/api/v1/courses/1/sheets/1", tape.ToH(sheetSent), adminJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			sheetAfter, err = stores.Sheet.Get(1)
+			g.Assert(err).Equal(nil)
+			g.Assert(sheetAfter.GradesPublished).IsFalse()
+
+			taskPointsOf := func(jwt JWTRequest) []TaskPointsResponse {
+				w := tape.Get("/api/v1/courses/1/sheets/1/points", jwt)
+				g.Assert(w.Code).Equal(http.StatusOK)
+
+				points := []TaskPointsResponse{}
+				err := json.NewDecoder(w.Body).Decode(&points)
+				g.Assert(err).Equal(nil)
+				return points
+			}
+
+			sheetPointsOf := func(jwt JWTRequest) SheetPointsResponse {
+				w := tape.Get("/api/v1/courses/1/points", jwt)
+				g.Assert(w.Code).Equal(http.StatusOK)
+
+				points := []SheetPointsResponse{}
+				err := json.NewDecoder(w.Body).Decode(&points)
+				g.Assert(err).Equal(nil)
+				for _, el := range points {
+					if el.SheetID == 1 {
+						return el
+					}
+				}
+				g.Fail("sheet is missing in points")
+				return SheetPointsResponse{}
+			}
+
+			taskPoints := taskPointsOf(studentJWT)
+			g.Assert(len(taskPoints) > 0).IsTrue()
+			for _, el := range taskPoints {
+				g.Assert(el.GradingInProgress).IsTrue()
+				g.Assert(el.AquiredPoints).Equal(0)
+			}
+
+			sheetPoints := sheetPointsOf(studentJWT)
+			g.Assert(sheetPoints.GradingInProgress).IsTrue()
+			g.Assert(sheetPoints.AquiredPoints).Equal(0)
+
+			w = tape.Get("/api/v1/courses/1/sheets/1/tasks/status", studentJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+			statuses := []TaskStatusResponse{}
+			err = json.NewDecoder(w.Body).Decode(&statuses)
+			g.Assert(err).Equal(nil)
+			g.Assert(len(statuses) > 0).IsTrue()
+			for _, el := range statuses {
+				g.Assert(el.Status.GradingInProgress).IsTrue()
+				g.Assert(el.Status.AcquiredPoints.Valid).IsFalse()
+			}
+
+			// staff still see the points
+			for _, el := range taskPointsOf(noAdminJWT) {
+				g.Assert(el.GradingInProgress).IsFalse()
+			}
+
+			gradesPublished = true
+			sheetSent.GradesPublished = &gradesPublished
+			w = tape.Put("/api/v1/courses/1/sheets/1", tape.ToH(sheetSent), adminJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			expected, err := stores.Sheet.PointsForUser(112, 1)
+			g.Assert(err).Equal(nil)
+
+			taskPoints = taskPointsOf(studentJWT)
+			g.Assert(len(taskPoints)).Equal(len(expected))
+			for k, el := range taskPoints {
+				g.Assert(el.GradingInProgress).IsFalse()
+				g.Assert(el.AquiredPoints).Equal(expected[k].AquiredPoints)
+			}
+			g.Assert(sheetPointsOf(studentJWT).GradingInProgress).IsFalse()
+		})
+
 		g.It("Permission test", func() {
 			url := "/api/v1/courses/1/sheets"
 
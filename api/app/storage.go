@@ -0,0 +1,58 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2019 ComputerGraphics Tuebingen
+//               2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package app
+
+import (
+	"fmt"
+
+	"github.com/infomark-org/infomark/api/helper"
+	"github.com/infomark-org/infomark/model"
+)
+
+// CourseOfFile returns a function identifying the course of a file, which
+// decides whether the file is stored in a directory of the course.
+func CourseOfFile(stores *Stores) func(category helper.FileCategory, ID int64) (int64, error) {
+	return func(category helper.FileCategory, ID int64) (int64, error) {
+		var course *model.Course
+		var err error
+
+		switch category {
+		case helper.SheetCategory:
+			course, err = stores.Sheet.IdentifyCourseOfSheet(ID)
+		case helper.PublicTestCategory,
+			helper.PrivateTestCategory,
+			helper.StarterCategory,
+			helper.TaskResetArchiveCategory:
+			course, err = stores.Task.IdentifyCourseOfTask(ID)
+		case helper.MaterialCategory:
+			course, err = stores.Material.IdentifyCourseOfMaterial(ID)
+		case helper.SubmissionCategory,
+			helper.SubmissionHistoryCategory:
+			course, err = stores.Submission.IdentifyCourseOfSubmission(ID)
+		default:
+			err = fmt.Errorf("files of category %d do not belong to a course", category)
+		}
+
+		if err != nil {
+			return 0, err
+		}
+		return course.ID, nil
+	}
+}
@@ -20,11 +20,21 @@
 package app
 
 import (
+	"archive/zip"
 	"context"
+	"encoding/csv"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"os"
+	"path"
+	"sort"
 	"strconv"
+	"strings"
+	"time"
+	"unicode"
 
 	"github.com/go-chi/chi"
 	"github.com/go-chi/render"
@@ -33,21 +43,26 @@ import (
 	"github.com/infomark-org/infomark/auth/authenticate"
 	"github.com/infomark-org/infomark/auth/authorize"
 	"github.com/infomark-org/infomark/configuration"
+	"github.com/infomark-org/infomark/event"
 	"github.com/infomark-org/infomark/model"
 	"github.com/infomark-org/infomark/symbol"
+	"github.com/sirupsen/logrus"
+	null "gopkg.in/guregu/null.v3"
 )
 
 // SubmissionResource specifies Submission management handler.
 type SubmissionResource struct {
 	Stores    *Stores
 	TokenAuth *authenticate.TokenAuth
+	Events    *event.Bus
 }
 
 // NewSubmissionResource create and returns a SubmissionResource.
-func NewSubmissionResource(stores *Stores, tokenAuth *authenticate.TokenAuth) *SubmissionResource {
+func NewSubmissionResource(stores *Stores, tokenAuth *authenticate.TokenAuth, events *event.Bus) *SubmissionResource {
 	return &SubmissionResource{
 		Stores:    stores,
 		TokenAuth: tokenAuth,
+		Events:    events,
 	}
 }
 
@@ -261,6 +276,762 @@ func (rs *SubmissionResource) GetFileByIDHandler(w http.ResponseWriter, r *http.
 
 }
 
+// GetOwnFileHandler is public endpoint for
+// URL: /submissions/{submission_id}/file
+// URLPARAM: submission_id,integer
+// METHOD: get
+// TAG: submissions
+// RESPONSE: 200,ZipFile
+// RESPONSE: 400,BadRequest
+// RESPONSE: 401,Unauthenticated
+// RESPONSE: 403,Unauthorized
+// RESPONSE: 404,NotFound
+// SUMMARY:  download the uploaded file of a submission
+// DESCRIPTION:
+// Only the owner of the submission and tutors and admins of the course can
+// download the file. It carries the name it has been uploaded with.
+func (rs *SubmissionResource) GetOwnFileHandler(w http.ResponseWriter, r *http.Request) {
+	submission := r.Context().Value(symbol.CtxKeySubmission).(*model.Submission)
+	accessClaims := r.Context().Value(symbol.CtxKeyAccessClaims).(*authenticate.AccessClaims)
+	givenRole := r.Context().Value(symbol.CtxKeyCourseRole).(authorize.CourseRole)
+
+	if submission.UserID != accessClaims.LoginID && givenRole < authorize.TUTOR {
+		render.Render(w, r, ErrUnauthorized)
+		return
+	}
+
+	hnd := helper.NewSubmissionFileHandle(submission.ID)
+	if !hnd.Exists() {
+		render.Render(w, r, ErrNotFound)
+		return
+	}
+
+	var err error
+	if submission.Filename != "" {
+		err = hnd.WriteToBodyWithName(submission.Filename, w)
+	} else {
+		err = hnd.WriteToBody(w)
+	}
+	if err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+}
+
+// ShareFileHandler is public endpoint for
+// URL: /courses/{course_id}/submissions/{submission_id}/share
+// URLPARAM: course_id,integer
+// URLPARAM: submission_id,integer
+// METHOD: post
+// TAG: submissions
+// RESPONSE: 201,SignedURLResponse
+// RESPONSE: 400,BadRequest
+// RESPONSE: 401,Unauthenticated
+// RESPONSE: 403,Unauthorized
+// SUMMARY:  create an expiring link to the zip file of a specific submission
+// DESCRIPTION:
+// Everyone knowing the link can download the file without being logged in
+// until it expires, e.g. a tutor helping with the solution. The link stops
+// working when the user logs out from all devices.
+func (rs *SubmissionResource) ShareFileHandler(w http.ResponseWriter, r *http.Request) {
+	course := r.Context().Value(symbol.CtxKeyCourse).(*model.Course)
+	submission := r.Context().Value(symbol.CtxKeySubmission).(*model.Submission)
+	accessClaims := r.Context().Value(symbol.CtxKeyAccessClaims).(*authenticate.AccessClaims)
+	givenRole := r.Context().Value(symbol.CtxKeyCourseRole).(authorize.CourseRole)
+
+	// students can only share their own files
+	if submission.UserID != accessClaims.LoginID && givenRole == authorize.STUDENT {
+		render.Render(w, r, ErrUnauthorized)
+		return
+	}
+
+	if !helper.NewSubmissionFileHandle(submission.ID).Exists() {
+		render.Render(w, r, ErrNotFound)
+		return
+	}
+
+	config := configuration.Configuration.Server
+	issuedAt := NowUTC()
+	expiresAt := issuedAt.Add(config.Authentication.SignedURL.Lifetime)
+	path := fmt.Sprintf("/api/v1/courses/%d/submissions/%d/file", course.ID, submission.ID)
+
+	resp := &SignedURLResponse{
+		URL:       config.ExternalURL() + authenticate.SignURL(config.Authentication.JWT.Secret, path, accessClaims.LoginID, issuedAt, expiresAt),
+		ExpiresAt: expiresAt,
+	}
+
+	render.Status(r, http.StatusCreated)
+	if err := render.Render(w, r, resp); err != nil {
+		render.Render(w, r, ErrRender(err))
+		return
+	}
+}
+
+// PurgeHandler is public endpoint for
+// URL: /courses/{course_id}/submissions/purge
+// URLPARAM: course_id,integer
+// METHOD: post
+// TAG: submissions
+// RESPONSE: 200,SubmissionPurgeResponse
+// RESPONSE: 400,BadRequest
+// RESPONSE: 401,Unauthenticated
+// RESPONSE: 403,Unauthorized
+// SUMMARY:  delete all submission files of the course exceeding the retention period
+// DESCRIPTION:
+// Grades and feedback are kept. The retention period of the course is used if
+// set, otherwise the server default.
+func (rs *SubmissionResource) PurgeHandler(w http.ResponseWriter, r *http.Request) {
+	course := r.Context().Value(symbol.CtxKeyCourse).(*model.Course)
+
+	deleted, err := PurgeExpiredSubmissionFiles(rs.Stores, course.ID)
+	if err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
+	if err := render.Render(w, r, &SubmissionPurgeResponse{Deleted: deleted}); err != nil {
+		render.Render(w, r, ErrRender(err))
+		return
+	}
+}
+
+// ResetTaskHandler is public endpoint for
+// URL: /courses/{course_id}/tasks/{task_id}/submissions
+// URLPARAM: course_id,integer
+// URLPARAM: task_id,integer
+// QUERYPARAM: confirm,boolean
+// QUERYPARAM: archive,boolean
+// METHOD: delete
+// TAG: submissions
+// RESPONSE: 200,TaskResetResponse
+// RESPONSE: 400,BadRequest
+// RESPONSE: 401,Unauthenticated
+// RESPONSE: 403,Unauthorized
+// SUMMARY:  delete all submissions of a task including their results
+// DESCRIPTION:
+// This gives a clean slate after a misconfigured task. The request has to be
+// confirmed by "confirm=true". With "archive=true" the latest files of all
+// submissions are kept in an archive on the server before, which is placed in
+// the directory of the course if it has one. Every reset is written to the
+// audit log.
+func (rs *SubmissionResource) ResetTaskHandler(w http.ResponseWriter, r *http.Request) {
+	course := r.Context().Value(symbol.CtxKeyCourse).(*model.Course)
+	task := r.Context().Value(symbol.CtxKeyTask).(*model.Task)
+	accessClaims := r.Context().Value(symbol.CtxKeyAccessClaims).(*authenticate.AccessClaims)
+
+	confirm, err := strconv.ParseBool(helper.StringFromURL(r, "confirm", "false"))
+	if err != nil || !confirm {
+		render.Render(w, r, ErrBadRequestWithDetails(errors.New("deleting all submissions has to be confirmed")))
+		return
+	}
+
+	archive, err := strconv.ParseBool(helper.StringFromURL(r, "archive", "false"))
+	if err != nil {
+		render.Render(w, r, ErrBadRequestWithDetails(errors.New("archive must be a boolean")))
+		return
+	}
+
+	resp := &TaskResetResponse{}
+
+	if archive {
+		submissions, err := rs.Stores.Submission.GetAllOfTask(course.ID, task.ID)
+		if err != nil {
+			render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+			return
+		}
+
+		hnd := helper.NewTaskResetArchiveFileHandle(task.ID, NowUTC().Unix())
+		if err := hnd.Resolve(); err != nil {
+			render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+			return
+		}
+		if err := writeTaskArchiveToDisk(hnd.Path(), course.ID, submissions); err != nil {
+			render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+			return
+		}
+		resp.Archive = path.Base(hnd.Path())
+	}
+
+	// the files have to be located while the submissions still exist
+	submissionIDs, err := rs.Stores.Submission.GetIDsOfTask(task.ID)
+	if err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+	files := []*helper.FileHandle{}
+	for _, submissionID := range submissionIDs {
+		hnd := helper.NewSubmissionFileHandle(submissionID)
+		if err := hnd.Resolve(); err != nil {
+			render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+			return
+		}
+		files = append(files, hnd)
+	}
+
+	// grades and test results are removed by the database
+	submissionIDs, err = rs.Stores.Submission.DeleteAllOfTask(task.ID)
+	if err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
+	for _, hnd := range files {
+		if err := helper.DeleteSubmissionHistory(hnd); err != nil {
+			render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+			return
+		}
+		if hnd.Exists() {
+			if err := hnd.Delete(); err != nil {
+				render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+				return
+			}
+		}
+	}
+	resp.Deleted = len(submissionIDs)
+
+	logrus.WithFields(logrus.Fields{
+		"module":    "audit",
+		"action":    "task.reset_submissions",
+		"actor_id":  accessClaims.LoginID,
+		"course_id": course.ID,
+		"task_id":   task.ID,
+		"deleted":   resp.Deleted,
+		"archive":   resp.Archive,
+	}).Info("submissions of task deleted by admin")
+
+	if err := render.Render(w, r, resp); err != nil {
+		render.Render(w, r, ErrRender(err))
+		return
+	}
+}
+
+// writeTaskArchiveToDisk stores an archive of the submissions in dst.
+func writeTaskArchiveToDisk(dst string, courseID int64, submissions []model.UserSubmission) error {
+	// directories of courses might not be populated yet
+	if err := os.MkdirAll(path.Dir(dst), 0755); err != nil {
+		return err
+	}
+
+	file, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	zipWriter := zip.NewWriter(file)
+	if err := writeTaskArchive(zipWriter, courseID, submissions, 0); err != nil {
+		zipWriter.Close()
+		return err
+	}
+	return zipWriter.Close()
+}
+
+// RegradeHandler is public endpoint for
+// URL: /courses/{course_id}/tasks/{task_id}/regrade
+// URLPARAM: course_id,integer
+// URLPARAM: task_id,integer
+// METHOD: post
+// TAG: submissions
+// RESPONSE: 202,RegradeResponse
+// RESPONSE: 400,BadRequest
+// RESPONSE: 401,Unauthenticated
+// RESPONSE: 403,Unauthorized
+// SUMMARY:  test all submissions of a task again using the current test files
+// DESCRIPTION:
+// The submissions are handed over to the background workers asynchronously.
+// The progress can be queried using GET on the same URL. Tutors can only
+// regrade the submissions of the members of their own groups. Points and
+// feedback given by tutors are kept, points of earlier automated tests no
+// longer count.
+func (rs *SubmissionResource) RegradeHandler(w http.ResponseWriter, r *http.Request) {
+	course := r.Context().Value(symbol.CtxKeyCourse).(*model.Course)
+	task := r.Context().Value(symbol.CtxKeyTask).(*model.Task)
+
+	// there is only a single submission per user and task, which is the latest one
+	submissions, err := rs.visibleSubmissions(r, course.ID, 0, 0, 0, task.ID)
+	if err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
+	progress, ok := StartRegrade(task.ID, len(submissions))
+	if !ok {
+		render.Render(w, r, ErrBadRequestWithDetails(errors.New("a regrade of this task is still running")))
+		return
+	}
+
+	go rs.regrade(progress, course, task, submissions)
+
+	render.Status(r, http.StatusAccepted)
+	if err := render.Render(w, r, newRegradeResponse(progress, 0)); err != nil {
+		render.Render(w, r, ErrRender(err))
+		return
+	}
+}
+
+// RegradeProgressHandler is public endpoint for
+// URL: /courses/{course_id}/tasks/{task_id}/regrade
+// URLPARAM: course_id,integer
+// URLPARAM: task_id,integer
+// METHOD: get
+// TAG: submissions
+// RESPONSE: 200,RegradeResponse
+// RESPONSE: 400,BadRequest
+// RESPONSE: 401,Unauthenticated
+// RESPONSE: 403,Unauthorized
+// SUMMARY:  get the progress of the latest regrade of a task
+func (rs *SubmissionResource) RegradeProgressHandler(w http.ResponseWriter, r *http.Request) {
+	task := r.Context().Value(symbol.CtxKeyTask).(*model.Task)
+
+	progress, ok := RegradeOfTask(task.ID)
+	if !ok {
+		render.Render(w, r, ErrNotFound)
+		return
+	}
+
+	tested, err := rs.Stores.Grade.CountTestedOfTaskSince(task.ID, progress.StartedAt)
+	if err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
+	if err := render.Render(w, r, newRegradeResponse(progress, tested)); err != nil {
+		render.Render(w, r, ErrRender(err))
+		return
+	}
+}
+
+// QueuePositionHandler is public endpoint for
+// URL: /courses/{course_id}/submissions/{submission_id}/queue_position
+// URLPARAM: course_id,integer
+// URLPARAM: submission_id,integer
+// METHOD: get
+// TAG: submissions
+// RESPONSE: 200,QueuePositionResponse
+// RESPONSE: 400,BadRequest
+// RESPONSE: 401,Unauthenticated
+// RESPONSE: 403,Unauthorized
+// SUMMARY:  get the position of a submission in the grading queue
+// DESCRIPTION:
+// The status is either "queued", "running" or "done". The estimated time is
+// based on the number of tests finished within the last hour and is null if
+// there were none. Submissions whose result did not arrive within the job
+// lease have no position.
+func (rs *SubmissionResource) QueuePositionHandler(w http.ResponseWriter, r *http.Request) {
+	submission := r.Context().Value(symbol.CtxKeySubmission).(*model.Submission)
+	accessClaims := r.Context().Value(symbol.CtxKeyAccessClaims).(*authenticate.AccessClaims)
+	givenRole := r.Context().Value(symbol.CtxKeyCourseRole).(authorize.CourseRole)
+
+	// students can only see their own submissions
+	if submission.UserID != accessClaims.LoginID && givenRole == authorize.STUDENT {
+		render.Render(w, r, ErrUnauthorized)
+		return
+	}
+
+	grade, err := rs.Stores.Grade.GetForSubmission(submission.ID)
+	if err != nil {
+		render.Render(w, r, ErrNotFound)
+		return
+	}
+
+	resp := &QueuePositionResponse{Status: "queued"}
+
+	switch {
+	case grade.PublicExecutionState == int(symbol.TestingStateFinished) &&
+		grade.PrivateExecutionState == int(symbol.TestingStateFinished):
+		resp.Status = "done"
+	case grade.PublicExecutionState == int(symbol.TestingStateRunning) ||
+		grade.PrivateExecutionState == int(symbol.TestingStateRunning):
+		resp.Status = "running"
+	}
+
+	if resp.Status != "done" {
+		// results which did not arrive within the lease will never arrive
+		enqueuedSince := time.Time{}
+		if lease := configuration.Configuration.Server.JobLeaseTimeout; lease > 0 {
+			enqueuedSince = NowUTC().Add(-lease)
+		}
+
+		position, err := rs.Stores.Grade.GetQueuePosition(grade.ID, enqueuedSince)
+		if err != nil {
+			render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+			return
+		}
+
+		if position > 0 {
+			resp.Position = null.IntFrom(int64(position))
+
+			tested, err := rs.Stores.Grade.CountTestedSince(NowUTC().Add(-time.Hour))
+			if err != nil {
+				render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+				return
+			}
+
+			if tested > 0 {
+				resp.ETASeconds = null.IntFrom(int64(position) * int64(time.Hour/time.Second) / int64(tested))
+			}
+		}
+	}
+
+	if err := render.Render(w, r, resp); err != nil {
+		render.Render(w, r, ErrRender(err))
+		return
+	}
+}
+
+// DiffHandler is public endpoint for
+// URL: /courses/{course_id}/submissions/{submission_id}/diff
+// URLPARAM: course_id,integer
+// URLPARAM: submission_id,integer
+// METHOD: get
+// TAG: submissions
+// RESPONSE: 200,SubmissionDiffResponse
+// RESPONSE: 400,BadRequest
+// RESPONSE: 401,Unauthenticated
+// RESPONSE: 403,Unauthorized
+// RESPONSE: 404,NotFound
+// SUMMARY:  get the diff between the output of a submission and the reference output
+// DESCRIPTION:
+// The diff is produced by the public tests. Students only see it when the
+// task has "show_diff" enabled.
+func (rs *SubmissionResource) DiffHandler(w http.ResponseWriter, r *http.Request) {
+	submission := r.Context().Value(symbol.CtxKeySubmission).(*model.Submission)
+	task := r.Context().Value(symbol.CtxKeyTask).(*model.Task)
+	accessClaims := r.Context().Value(symbol.CtxKeyAccessClaims).(*authenticate.AccessClaims)
+	givenRole := r.Context().Value(symbol.CtxKeyCourseRole).(authorize.CourseRole)
+
+	if givenRole == authorize.STUDENT {
+		// students can only see their own submissions
+		if submission.UserID != accessClaims.LoginID {
+			render.Render(w, r, ErrUnauthorized)
+			return
+		}
+
+		if !task.ShowDiff {
+			render.Render(w, r, ErrNotFound)
+			return
+		}
+	}
+
+	grade, err := rs.Stores.Grade.GetForSubmission(submission.ID)
+	if err != nil {
+		render.Render(w, r, ErrNotFound)
+		return
+	}
+
+	if err := render.Render(w, r, &SubmissionDiffResponse{
+		SubmissionID: submission.ID,
+		Diff:         grade.PublicTestDiff,
+	}); err != nil {
+		render.Render(w, r, ErrRender(err))
+		return
+	}
+}
+
+// CompareHandler is public endpoint for
+// URL: /courses/{course_id}/submissions/compare
+// URLPARAM: course_id,integer
+// QUERYPARAM: a,integer
+// QUERYPARAM: b,integer
+// METHOD: get
+// TAG: submissions
+// RESPONSE: 200,SubmissionCompareResponse
+// RESPONSE: 400,BadRequest
+// RESPONSE: 401,Unauthenticated
+// RESPONSE: 403,Unauthorized
+// RESPONSE: 404,NotFound
+// SUMMARY:  compare the files of two submissions
+// DESCRIPTION:
+// Both submissions have to belong to tasks of the course. Files are matched
+// by their path within the archive and text files are compared line by line.
+func (rs *SubmissionResource) CompareHandler(w http.ResponseWriter, r *http.Request) {
+	course := r.Context().Value(symbol.CtxKeyCourse).(*model.Course)
+
+	submissionIDs := []int64{
+		helper.Int64FromURL(r, "a", 0),
+		helper.Int64FromURL(r, "b", 0),
+	}
+
+	hnds := []*helper.FileHandle{}
+	for _, submissionID := range submissionIDs {
+		if submissionID == 0 {
+			render.Render(w, r, ErrBadRequestWithDetails(errors.New("the submissions \"a\" and \"b\" are required")))
+			return
+		}
+
+		submission, err := rs.Stores.Submission.Get(submissionID)
+		if err != nil {
+			render.Render(w, r, ErrNotFound)
+			return
+		}
+
+		// tutors can grade all tasks of their course only
+		submissionCourse, err := rs.Stores.Task.IdentifyCourseOfTask(submission.TaskID)
+		if err != nil {
+			render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+			return
+		}
+		if submissionCourse.ID != course.ID {
+			render.Render(w, r, ErrUnauthorized)
+			return
+		}
+
+		hnd := helper.NewSubmissionFileHandle(submission.ID)
+		if !hnd.Exists() {
+			render.Render(w, r, ErrNotFound)
+			return
+		}
+		hnds = append(hnds, hnd)
+	}
+
+	diffs, err := helper.DiffArchives(hnds[0], hnds[1])
+	if err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
+	if err := render.Render(w, r, newSubmissionCompareResponse(submissionIDs[0], submissionIDs[1], diffs)); err != nil {
+		render.Render(w, r, ErrRender(err))
+		return
+	}
+}
+
+// GetHistoryFileHandler is public endpoint for
+// URL: /courses/{course_id}/tasks/{task_id}/users/{user_id}/submissions.zip
+// URLPARAM: course_id,integer
+// URLPARAM: task_id,integer
+// URLPARAM: user_id,integer
+// METHOD: get
+// TAG: submissions
+// RESPONSE: 200,ZipFile
+// RESPONSE: 400,BadRequest
+// RESPONSE: 401,Unauthenticated
+// RESPONSE: 403,Unauthorized
+// RESPONSE: 404,NotFound
+// SUMMARY:  get a zip file containing every version a user submitted for a task
+// DESCRIPTION:
+// Each version is named after the time it was uploaded.
+func (rs *SubmissionResource) GetHistoryFileHandler(w http.ResponseWriter, r *http.Request) {
+	task := r.Context().Value(symbol.CtxKeyTask).(*model.Task)
+	user := r.Context().Value(symbol.CtxKeyUser).(*model.User)
+
+	submission, err := rs.Stores.Submission.GetByUserAndTask(user.ID, task.ID)
+	if err != nil {
+		render.Render(w, r, ErrNotFound)
+		return
+	}
+
+	versions, err := helper.SubmissionHistory(submission.ID)
+	if err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
+	names := []string{}
+	for _, version := range versions {
+		uploadedAt := time.Unix(0, version.Infos[0]).UTC()
+		names = append(names, fmt.Sprintf("%s.zip", uploadedAt.Format("2006-01-02T15-04-05.000Z")))
+	}
+
+	// submissions uploaded before versions were kept
+	if len(versions) == 0 {
+		hnd := helper.NewSubmissionFileHandle(submission.ID)
+		if !hnd.Exists() {
+			render.Render(w, r, ErrNotFound)
+			return
+		}
+		versions = append(versions, hnd)
+		names = append(names, fmt.Sprintf("%s.zip", submission.UpdatedAt.UTC().Format("2006-01-02T15-04-05.000Z")))
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition",
+		fmt.Sprintf("attachment; filename=\"task%d-user%d-submissions.zip\"", task.ID, user.ID))
+
+	// the archive is streamed, hence errors cannot be reported anymore
+	zipWriter := zip.NewWriter(w)
+	defer zipWriter.Close()
+
+	for k, version := range versions {
+		if err := addFileToZip(zipWriter, version.Path(), names[k]); err != nil {
+			return
+		}
+	}
+}
+
+// GetTaskArchiveHandler is public endpoint for
+// URL: /courses/{course_id}/tasks/{task_id}/submissions.zip
+// URLPARAM: course_id,integer
+// URLPARAM: task_id,integer
+// METHOD: get
+// TAG: submissions
+// RESPONSE: 200,ZipFile
+// RESPONSE: 400,BadRequest
+// RESPONSE: 401,Unauthenticated
+// RESPONSE: 403,Unauthorized
+// SUMMARY:  get a zip file containing the latest submission of every student for a task
+// DESCRIPTION:
+// There is one folder per student. The file "manifest.csv" maps the folders
+// to the students. Under anonymous grading, tutors only get the pseudonyms of
+// the students.
+func (rs *SubmissionResource) GetTaskArchiveHandler(w http.ResponseWriter, r *http.Request) {
+	course := r.Context().Value(symbol.CtxKeyCourse).(*model.Course)
+	task := r.Context().Value(symbol.CtxKeyTask).(*model.Task)
+	sheet := r.Context().Value(symbol.CtxKeySheet).(*model.Sheet)
+
+	// the students are only hidden within the sheet of the task
+	var hiddenSheetID int64
+	if hidesIdentities(r, course, sheet) {
+		hiddenSheetID = sheet.ID
+	}
+
+	submissions, err := rs.Stores.Submission.GetAllOfTask(course.ID, task.ID)
+	if err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition",
+		fmt.Sprintf("attachment; filename=\"task%d-submissions.zip\"", task.ID))
+
+	// the archive is streamed, hence errors cannot be reported anymore
+	zipWriter := zip.NewWriter(w)
+	defer zipWriter.Close()
+
+	writeTaskArchive(zipWriter, course.ID, submissions, hiddenSheetID)
+}
+
+// writeTaskArchive adds the latest file of every submission and a manifest
+// mapping the folders to the students into the archive. The students are
+// replaced by their pseudonyms within hiddenSheetID if it is not 0.
+func writeTaskArchive(zipWriter *zip.Writer, courseID int64, submissions []model.UserSubmission, hiddenSheetID int64) error {
+	rows := [][]string{{"folder", "name", "email", "student_number", "submitted_at"}}
+	for _, submission := range submissions {
+		hnd := helper.NewSubmissionFileHandle(submission.ID)
+		// files might have been purged already
+		if !hnd.Exists() {
+			continue
+		}
+
+		folder := archiveFolderName(submission)
+		row := []string{
+			folder,
+			fmt.Sprintf("%s %s", submission.FirstName, submission.LastName),
+			submission.Email,
+			submission.StudentNumber,
+			submission.UpdatedAt.UTC().Format(time.RFC3339),
+		}
+		if hiddenSheetID != 0 {
+			folder = anonymousID(courseID, hiddenSheetID, submission.UserID)
+			row = []string{folder, "", "", "", row[4]}
+		}
+
+		if err := addFileToZip(zipWriter, hnd.Path(), folder+"/submission.zip"); err != nil {
+			return err
+		}
+		rows = append(rows, row)
+	}
+
+	manifest, err := zipWriter.Create("manifest.csv")
+	if err != nil {
+		return err
+	}
+	return csv.NewWriter(manifest).WriteAll(rows)
+}
+
+// archiveFolderName names the folder of a student in an archive of
+// submissions. The user id keeps it unique for students with equal names.
+func archiveFolderName(submission model.UserSubmission) string {
+	name := strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return r
+		}
+		return '_'
+	}, fmt.Sprintf("%s_%s", submission.LastName, submission.FirstName))
+
+	return fmt.Sprintf("%s-%d", name, submission.UserID)
+}
+
+// addFileToZip copies the file at path into the archive.
+func addFileToZip(zipWriter *zip.Writer, path string, name string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer, err := zipWriter.Create(name)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(writer, file)
+	return err
+}
+
+// enqueueGrading hands the public and private tests of a submission over to
+// the background workers. Tests without a docker image or test file are not
+// run, which is noted in the grade instead.
+func (rs *SubmissionResource) enqueueGrading(course *model.Course, task *model.Task,
+	submission *model.Submission, grade *model.Grade) error {
+	sha256, err := helper.NewSubmissionFileHandle(submission.ID).Sha256()
+	if err != nil {
+		return err
+	}
+
+	// By definition user with id 1 is the system itself with root access
+	accessToken, err := rs.TokenAuth.CreateAccessJWT(
+		authenticate.NewAccessClaims(1, true))
+	if err != nil {
+		return err
+	}
+
+	if task.PublicDockerImage.Valid && helper.NewPublicTestFileHandle(task.ID).Exists() {
+		// enqueue public test
+		request := shared.NewSubmissionAMQPWorkerRequest(
+			course.ID, task.ID, submission.ID, grade.ID,
+			accessToken, configuration.Configuration.Server.ExternalURL(), task.PublicDockerImage.String, sha256, "public", task.TimeoutSeconds, task.AllowNetwork)
+
+		body, err := json.Marshal(request)
+		if err != nil {
+			return err
+		}
+
+		if err := DefaultSubmissionProducer.Publish(body); err != nil {
+			return err
+		}
+	} else {
+		grade.PublicTestLog = "No public dockerimage was specified --> will not run any public test"
+		if err := rs.Stores.Grade.Update(grade); err != nil {
+			return err
+		}
+	}
+
+	if task.PrivateDockerImage.Valid && helper.NewPrivateTestFileHandle(task.ID).Exists() {
+		// enqueue private test
+		request := shared.NewSubmissionAMQPWorkerRequest(
+			course.ID, task.ID, submission.ID, grade.ID,
+			accessToken, configuration.Configuration.Server.ExternalURL(), task.PrivateDockerImage.String, sha256, "private", task.TimeoutSeconds, task.AllowNetwork)
+
+		body, err := json.Marshal(request)
+		if err != nil {
+			return err
+		}
+
+		if err := DefaultSubmissionProducer.Publish(body); err != nil {
+			return err
+		}
+	} else {
+		grade.PrivateTestLog = "No private dockerimage was specified --> will not run any private test"
+		if err := rs.Stores.Grade.Update(grade); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 // UploadFileHandler is public endpoint for
 // URL: /courses/{course_id}/tasks/{task_id}/submission
 // URLPARAM: course_id,integer
@@ -273,6 +1044,11 @@ func (rs *SubmissionResource) GetFileByIDHandler(w http.ResponseWriter, r *http.
 // RESPONSE: 401,Unauthenticated
 // RESPONSE: 403,Unauthorized
 // SUMMARY:  changes the zip file of a submission belonging to the request identity
+// DESCRIPTION:
+// The file can be sent in several chunks using the "Content-Range" header.
+// Incomplete uploads are answered with 202 and a "Range" header.
+// Junk entries like "__MACOSX" are removed from the archive. Archives containing
+// absolute paths or paths leaving the archive are rejected.
 func (rs *SubmissionResource) UploadFileHandler(w http.ResponseWriter, r *http.Request) {
 	course := r.Context().Value(symbol.CtxKeyCourse).(*model.Course)
 	task := r.Context().Value(symbol.CtxKeyTask).(*model.Task)
@@ -282,13 +1058,34 @@ func (rs *SubmissionResource) UploadFileHandler(w http.ResponseWriter, r *http.R
 	course_role := r.Context().Value(symbol.CtxKeyCourseRole).(authorize.CourseRole)
 
 	if course_role == authorize.STUDENT && !PublicYet(sheet.PublishAt) {
-		render.Render(w, r, ErrBadRequestWithDetails(fmt.Errorf("sheet not published yet")))
+		render.Render(w, r, ErrBadRequestWithDetails(fmt.Errorf("sheet not published yet, submissions are accepted from %v", sheet.PublishAt)))
 		return
 	}
 
 	if course_role == authorize.STUDENT && OverTime(sheet.DueAt) {
-		render.Render(w, r, ErrBadRequestWithDetails(fmt.Errorf("too late deadline was %v but now it is %v", sheet.DueAt, NowUTC())))
-		return
+		// an extension of the student replaces the due date
+		dueAt := sheet.DueAt
+		if extension, err := rs.Stores.Sheet.GetExtension(sheet.ID, accessClaims.LoginID); err == nil {
+			dueAt = extension.DueAt
+		}
+
+		if OverTime(dueAt) {
+			render.Render(w, r, ErrBadRequestWithDetails(fmt.Errorf("too late deadline was %v but now it is %v", dueAt, NowUTC())))
+			return
+		}
+	}
+
+	if course_role == authorize.STUDENT && course.HonorCode != "" {
+		enrollment, err := rs.Stores.Course.GetUserEnrollment(course.ID, accessClaims.LoginID)
+		if err != nil {
+			render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+			return
+		}
+
+		if !enrollment.HonorCodeAcknowledgedAt.Valid {
+			render.Render(w, r, ErrUnauthorizedWithDetails(errors.New("the honor code of this course has to be acknowledged first")))
+			return
+		}
 	}
 
 	usedUserID := accessClaims.LoginID
@@ -298,6 +1095,45 @@ func (rs *SubmissionResource) UploadFileHandler(w http.ResponseWriter, r *http.R
 		usedUserID = int64(requested_user_id)
 	}
 
+	// large files can be sent in several chunks, the submission is only
+	// touched once the file is complete
+	staged := helper.NewChunkedUpload(fmt.Sprintf("submission-task%d-user%d", task.ID, usedUserID))
+	if helper.IsChunkedUpload(r) {
+		if !AppendChunk(w, r, staged, helper.NewSubmissionFileHandle(0).MaxBytes) {
+			return
+		}
+	}
+
+	// a concurrent upload of the same student has to finish first
+	unlock := lockSubmission(usedUserID, task.ID)
+	defer unlock()
+
+	filename := ""
+	if helper.IsChunkedUpload(r) {
+		if r.MultipartForm != nil && len(r.MultipartForm.File["file_data"]) > 0 {
+			filename = path.Base(r.MultipartForm.File["file_data"][0].Filename)
+		}
+	} else {
+		// a complete upload supersedes an unfinished chunked one
+		var err error
+		filename, err = staged.Stage(r, "file_data", helper.NewSubmissionFileHandle(0).MaxBytes)
+		if err != nil {
+			staged.Delete()
+			render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+			return
+		}
+	}
+
+	// junk entries would confuse the graders, unsafe paths must never reach
+	// them. Rejected uploads leave the current submission untouched.
+	if cleanup := configuration.Configuration.Server.SubmissionCleanup; cleanup.Enabled {
+		if _, err := staged.CleanArchive(cleanup.JunkPatterns); err != nil {
+			staged.Delete()
+			render.Render(w, r, ErrBadRequestWithDetails(err))
+			return
+		}
+	}
+
 	var grade *model.Grade
 
 	defaultPublicTestLog := "submission received and will be tested"
@@ -334,6 +1170,7 @@ func (rs *SubmissionResource) UploadFileHandler(w http.ResponseWriter, r *http.R
 			Feedback:              "",
 			TutorID:               1,
 			SubmissionID:          submission.ID,
+			EnqueuedAt:            null.TimeFrom(NowUTC()),
 		}
 
 		// fetch id from grade as we need it
@@ -356,6 +1193,7 @@ func (rs *SubmissionResource) UploadFileHandler(w http.ResponseWriter, r *http.R
 		grade.PrivateExecutionState = 0
 		grade.PublicTestLog = defaultPublicTestLog
 		grade.PrivateTestLog = defaultPrivateTestLog
+		grade.EnqueuedAt = null.TimeFrom(NowUTC())
 
 		err = rs.Stores.Grade.Update(grade)
 		if err != nil {
@@ -366,86 +1204,27 @@ func (rs *SubmissionResource) UploadFileHandler(w http.ResponseWriter, r *http.R
 	}
 
 	// the file will be located
-	if _, err := helper.NewSubmissionFileHandle(submission.ID).WriteToDisk(r, "file_data"); err != nil {
+	if err := helper.NewSubmissionFileHandle(submission.ID).WriteFromChunks(staged); err != nil {
 		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
 		return
 	}
 
-	sha256, err := helper.NewSubmissionFileHandle(submission.ID).Sha256()
-	if err != nil {
+	if err := rs.Stores.Submission.UpdateFilename(submission.ID, sanitizeFilename(filename)); err != nil {
 		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
 		return
 	}
 
-	// enqueue file into testing queue
-	// By definition user with id 1 is the system itself with root access
-	tokenManager := rs.TokenAuth
-	if err != nil {
+	if err := helper.ArchiveSubmissionFile(submission.ID, NowUTC()); err != nil {
 		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
 		return
 	}
-	accessToken, err := tokenManager.CreateAccessJWT(
-		authenticate.NewAccessClaims(1, true))
-	if err != nil {
+
+	if err := rs.enqueueGrading(course, task, submission, grade); err != nil {
 		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
 		return
 	}
 
-	if task.PublicDockerImage.Valid && helper.NewPublicTestFileHandle(task.ID).Exists() {
-		// enqueue public test
-
-		request := shared.NewSubmissionAMQPWorkerRequest(
-			course.ID, task.ID, submission.ID, grade.ID,
-			accessToken, configuration.Configuration.Server.ExternalURL(), task.PublicDockerImage.String, sha256, "public")
-
-		body, err := json.Marshal(request)
-		if err != nil {
-			render.Render(w, r, ErrInternalServerErrorWithDetails(err))
-			return
-		}
-
-		err = DefaultSubmissionProducer.Publish(body)
-		if err != nil {
-			render.Render(w, r, ErrInternalServerErrorWithDetails(err))
-			return
-		}
-	} else {
-		grade.PublicTestLog = "No public dockerimage was specified --> will not run any public test"
-		err = rs.Stores.Grade.Update(grade)
-		if err != nil {
-			render.Render(w, r, ErrInternalServerErrorWithDetails(err))
-			return
-		}
-	}
-
-	if task.PrivateDockerImage.Valid && helper.NewPrivateTestFileHandle(task.ID).Exists() {
-		// enqueue private test
-
-		request := shared.NewSubmissionAMQPWorkerRequest(
-			course.ID, task.ID, submission.ID, grade.ID,
-			accessToken, configuration.Configuration.Server.ExternalURL(), task.PrivateDockerImage.String, sha256, "private")
-
-		body, err := json.Marshal(request)
-		if err != nil {
-			render.Render(w, r, ErrInternalServerErrorWithDetails(err))
-			return
-		}
-
-		err = DefaultSubmissionProducer.Publish(body)
-		if err != nil {
-			render.Render(w, r, ErrInternalServerErrorWithDetails(err))
-			return
-		}
-	} else {
-		grade.PrivateTestLog = "No private dockerimage was specified --> will not run any private test"
-		err = rs.Stores.Grade.Update(grade)
-		if err != nil {
-			render.Render(w, r, ErrInternalServerErrorWithDetails(err))
-			return
-		}
-	}
-
-	totalSubmissionCounterVec.WithLabelValues(fmt.Sprintf("%d", task.ID)).Inc()
+	rs.Events.Publish(event.SubmissionCreated{TaskID: task.ID, Submission: submission})
 
 	render.Status(r, http.StatusOK)
 }
@@ -464,6 +1243,10 @@ func (rs *SubmissionResource) UploadFileHandler(w http.ResponseWriter, r *http.R
 // RESPONSE: 401,Unauthenticated
 // RESPONSE: 403,Unauthorized
 // SUMMARY:  Query submissions in a course
+// DESCRIPTION:
+// Tutors only get the submissions of the members of their own groups. Under
+// anonymous grading, they get pseudonyms instead of the students of sheets
+// whose grades are not published and cannot filter by "user_id".
 func (rs *SubmissionResource) IndexHandler(w http.ResponseWriter, r *http.Request) {
 	course := r.Context().Value(symbol.CtxKeyCourse).(*model.Course)
 
@@ -472,14 +1255,28 @@ func (rs *SubmissionResource) IndexHandler(w http.ResponseWriter, r *http.Reques
 	filterSheetID := helper.Int64FromURL(r, "sheet_id", 0)
 	filterTaskID := helper.Int64FromURL(r, "task_id", 0)
 
-	submissions, err := rs.Stores.Submission.GetFiltered(course.ID, filterGroupID, filterUserID, filterSheetID, filterTaskID)
+	hidden, err := anonymousTasks(rs.Stores, r, course)
+	if err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+	if filterUserID != 0 && len(hidden) > 0 {
+		render.Render(w, r, ErrBadRequestWithDetails(errAnonymousUserFilter))
+		return
+	}
+
+	submissions, err := rs.visibleSubmissions(r, course.ID, filterGroupID, filterUserID, filterSheetID, filterTaskID)
+	if err == errGroupNotVisible {
+		render.Render(w, r, ErrUnauthorizedWithDetails(err))
+		return
+	}
 	if err != nil {
 		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
 		return
 	}
 
 	// render JSON response
-	if err = render.RenderList(w, r, newSubmissionListResponse(submissions, course.ID)); err != nil {
+	if err = render.RenderList(w, r, newSubmissionListResponse(submissions, course.ID, hidden)); err != nil {
 		render.Render(w, r, ErrRender(err))
 		return
 	}
@@ -488,6 +1285,127 @@ func (rs *SubmissionResource) IndexHandler(w http.ResponseWriter, r *http.Reques
 
 }
 
+// submissionStates are the states of grading a submission can be filtered by.
+var submissionStates = map[string]bool{"pending": true, "graded": true, "error": true}
+
+// IndexOfTaskHandler is public endpoint for
+// URL: /courses/{course_id}/tasks/{task_id}/submissions
+// URLPARAM: course_id,integer
+// URLPARAM: task_id,integer
+// QUERYPARAM: status,string
+// QUERYPARAM: group_id,integer
+// QUERYPARAM: page,integer
+// QUERYPARAM: per_page,integer
+// METHOD: get
+// TAG: submissions
+// RESPONSE: 200,SubmissionStatusResponseList
+// RESPONSE: 400,BadRequest
+// RESPONSE: 401,Unauthenticated
+// RESPONSE: 403,Unauthorized
+// SUMMARY:  Query the submissions for a task by the state of their grading
+// DESCRIPTION:
+// The status is "graded" for submissions with feedback or points, "error" if
+// an automated test failed and "pending" otherwise. Tutors only get the
+// submissions of the members of their own groups. If "per_page" is given,
+// only this page is returned and the "Link" header points to the other pages.
+func (rs *SubmissionResource) IndexOfTaskHandler(w http.ResponseWriter, r *http.Request) {
+	course := r.Context().Value(symbol.CtxKeyCourse).(*model.Course)
+	task := r.Context().Value(symbol.CtxKeyTask).(*model.Task)
+	sheet := r.Context().Value(symbol.CtxKeySheet).(*model.Sheet)
+
+	pagination, err := PaginationFromURL(r)
+	if err != nil {
+		render.Render(w, r, ErrBadRequestWithDetails(err))
+		return
+	}
+
+	filterStatus := helper.StringFromURL(r, "status", "")
+	if filterStatus != "" && !submissionStates[filterStatus] {
+		render.Render(w, r, ErrBadRequestWithDetails(
+			fmt.Errorf("status '%s' must be one of 'pending', 'graded', 'error'", filterStatus)))
+		return
+	}
+
+	groupIDs, err := visibleGroupIDs(rs.Stores, r, helper.Int64FromURL(r, "group_id", 0))
+	if err == errGroupNotVisible {
+		render.Render(w, r, ErrUnauthorizedWithDetails(err))
+		return
+	}
+	if err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+	if groupIDs == nil {
+		groupIDs = []int64{0}
+	}
+
+	// students in several groups of the tutor must not show up twice
+	seen := map[int64]bool{}
+	submissions := []model.SubmissionWithStatus{}
+	for _, groupID := range groupIDs {
+		groupSubmissions, err := rs.Stores.Submission.GetOfTaskWithStatus(task.ID, groupID, filterStatus)
+		if err != nil {
+			render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+			return
+		}
+		for _, submission := range groupSubmissions {
+			if !seen[submission.ID] {
+				seen[submission.ID] = true
+				submissions = append(submissions, submission)
+			}
+		}
+	}
+	sort.Slice(submissions, func(i, j int) bool { return submissions[i].ID < submissions[j].ID })
+
+	if pagination != nil {
+		pagination.WriteLinkHeader(w, r, len(submissions))
+		from, to := pagination.Bounds(len(submissions))
+		submissions = submissions[from:to]
+	}
+
+	hidden := map[int64]int64{}
+	if hidesIdentities(r, course, sheet) {
+		hidden[task.ID] = sheet.ID
+	}
+
+	if err := render.RenderList(w, r, newSubmissionStatusListResponse(submissions, course.ID, hidden)); err != nil {
+		render.Render(w, r, ErrRender(err))
+		return
+	}
+}
+
+// visibleSubmissions queries the submissions matching the filters which the
+// request identity is allowed to see. The grading workload of tutors is
+// limited to the members of their own groups, admins see all submissions.
+func (rs *SubmissionResource) visibleSubmissions(r *http.Request,
+	courseID, groupID, userID, sheetID, taskID int64) ([]model.Submission, error) {
+	groupIDs, err := visibleGroupIDs(rs.Stores, r, groupID)
+	if err != nil {
+		return nil, err
+	}
+
+	if groupIDs == nil {
+		return rs.Stores.Submission.GetFiltered(courseID, 0, userID, sheetID, taskID)
+	}
+
+	// students in several groups of the tutor must not show up twice
+	seen := map[int64]bool{}
+	submissions := []model.Submission{}
+	for _, groupID := range groupIDs {
+		groupSubmissions, err := rs.Stores.Submission.GetFiltered(courseID, groupID, userID, sheetID, taskID)
+		if err != nil {
+			return nil, err
+		}
+		for _, submission := range groupSubmissions {
+			if !seen[submission.ID] {
+				seen[submission.ID] = true
+				submissions = append(submissions, submission)
+			}
+		}
+	}
+	return submissions, nil
+}
+
 // .............................................................................
 
 // Context middleware is used to load an Submission object from
@@ -559,3 +1477,18 @@ func (rs *SubmissionResource) Context(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
+
+// sanitizeFilename drops characters which would break the Content-Disposition
+// header when the file is served again.
+func sanitizeFilename(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if r == '"' || r == '\\' || unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, name)
+	if name == "." || name == "/" {
+		return ""
+	}
+	return name
+}
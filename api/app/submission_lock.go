@@ -0,0 +1,95 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package app
+
+import (
+	"sync"
+	"time"
+
+	"github.com/infomark-org/infomark/configuration"
+	"github.com/infomark-org/infomark/model"
+)
+
+// A student has at most one active submission per task. Uploads of the same
+// student for the same task are serialized, such that they never create two
+// submissions or write the same file at the same time. A new upload
+// supersedes the grading of the previous one still in flight: the results of
+// the previous grading are rejected once they arrive.
+
+type submissionLockKey struct {
+	userID int64
+	taskID int64
+}
+
+type submissionLock struct {
+	sync.Mutex
+	waiting int
+}
+
+// submissionLocks contains the locks of all uploads in progress (in memory).
+var submissionLocks = struct {
+	sync.Mutex
+	byKey map[submissionLockKey]*submissionLock
+}{byKey: map[submissionLockKey]*submissionLock{}}
+
+// lockSubmission blocks until no other upload of the student for the task is
+// in progress. The returned function releases the lock. Nothing is locked if
+// unique active submissions are not enforced.
+func lockSubmission(userID int64, taskID int64) func() {
+	if !configuration.Configuration.Server.UniqueActiveSubmissions {
+		return func() {}
+	}
+
+	key := submissionLockKey{userID: userID, taskID: taskID}
+
+	submissionLocks.Lock()
+	lock, ok := submissionLocks.byKey[key]
+	if !ok {
+		lock = &submissionLock{}
+		submissionLocks.byKey[key] = lock
+	}
+	lock.waiting++
+	submissionLocks.Unlock()
+
+	lock.Lock()
+	return func() {
+		lock.Unlock()
+
+		submissionLocks.Lock()
+		defer submissionLocks.Unlock()
+		lock.waiting--
+		if lock.waiting == 0 {
+			delete(submissionLocks.byKey, key)
+		}
+	}
+}
+
+// isSupersededResult reports whether a result of a background worker belongs
+// to a grading which has been superseded by a newer upload or regrade of the
+// submission. Results of workers not reporting when they were enqueued are
+// always accepted.
+func isSupersededResult(data *GradeFromWorkerRequest, grade *model.Grade) bool {
+	if !configuration.Configuration.Server.UniqueActiveSubmissions {
+		return false
+	}
+	if data.EnqueuedAt.IsZero() || !grade.EnqueuedAt.Valid {
+		return false
+	}
+	// the database keeps less precision than the workers report
+	return data.EnqueuedAt.Truncate(time.Millisecond).Before(grade.EnqueuedAt.Time.Truncate(time.Millisecond))
+}
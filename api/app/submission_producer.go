@@ -20,8 +20,13 @@
 package app
 
 import (
+	"sync"
+	"time"
+
+	redis "github.com/go-redis/redis"
 	"github.com/infomark-org/infomark/configuration"
 	"github.com/infomark-org/infomark/service"
+	"github.com/sirupsen/logrus"
 )
 
 // Producer is interface to pipe the workload over AMPQ to the backend workers
@@ -40,6 +45,208 @@ type VoidProducer struct{}
 // Publish of VoidProducer does nothing on purpose (used in unit tests).
 func (t *VoidProducer) Publish(body []byte) error { return nil }
 
+// JobBacklog stores the grading jobs waiting for a free slot in the order
+// they have been published.
+type JobBacklog interface {
+	Push(body []byte) error
+	// PushFront puts a job back such that it is the next one to pop.
+	PushFront(body []byte) error
+	// Pop returns the oldest job, nil if there is none.
+	Pop() ([]byte, error)
+	Len() (int, error)
+}
+
+// memoryBacklog keeps waiting jobs in memory only. They are lost on restart.
+type memoryBacklog struct {
+	jobs [][]byte
+}
+
+func (b *memoryBacklog) Push(body []byte) error {
+	b.jobs = append(b.jobs, body)
+	return nil
+}
+
+func (b *memoryBacklog) PushFront(body []byte) error {
+	b.jobs = append([][]byte{body}, b.jobs...)
+	return nil
+}
+
+func (b *memoryBacklog) Pop() ([]byte, error) {
+	if len(b.jobs) == 0 {
+		return nil, nil
+	}
+	body := b.jobs[0]
+	b.jobs = b.jobs[1:]
+	return body, nil
+}
+
+func (b *memoryBacklog) Len() (int, error) {
+	return len(b.jobs), nil
+}
+
+// RedisBacklog keeps waiting jobs in a redis list, such that they survive a
+// restart of the server.
+type RedisBacklog struct {
+	Redis *redis.Client
+	Key   string
+}
+
+// Push appends a job to the list.
+func (b *RedisBacklog) Push(body []byte) error {
+	return b.Redis.RPush(b.Key, body).Err()
+}
+
+// PushFront prepends a job to the list.
+func (b *RedisBacklog) PushFront(body []byte) error {
+	return b.Redis.LPush(b.Key, body).Err()
+}
+
+// Pop removes the oldest job from the list.
+func (b *RedisBacklog) Pop() ([]byte, error) {
+	body, err := b.Redis.LPop(b.Key).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	return body, err
+}
+
+// Len returns the number of waiting jobs.
+func (b *RedisBacklog) Len() (int, error) {
+	n, err := b.Redis.LLen(b.Key).Result()
+	return int(n), err
+}
+
+// LimitedProducer hands at most Limit grading jobs to the workers at once.
+// Further jobs wait in the backlog until a running job ends. Each dispatched
+// job holds a slot for at most LeaseTimeout, such that jobs whose result never
+// arrives (crashed worker, lost message) do not block the slot forever.
+type LimitedProducer struct {
+	Producer     Producer
+	Limit        int
+	LeaseTimeout time.Duration
+	Backlog      JobBacklog
+
+	mu sync.Mutex
+	// leases are the expiry times of the running jobs, the oldest first
+	leases []time.Time
+}
+
+// NewLimitedProducer wraps a producer such that at most limit jobs run at once.
+// Waiting jobs are kept in memory and slots are never reclaimed unless
+// LeaseTimeout and Backlog are changed.
+func NewLimitedProducer(producer Producer, limit int) *LimitedProducer {
+	return &LimitedProducer{
+		Producer: producer,
+		Limit:    limit,
+		Backlog:  &memoryBacklog{},
+		leases:   []time.Time{},
+	}
+}
+
+// Publish dispatches a job if there is a free slot and queues it otherwise.
+func (p *LimitedProducer) Publish(body []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.reclaimExpired()
+
+	queued, err := p.Backlog.Len()
+	if err != nil {
+		return err
+	}
+
+	// jobs from the backlog go first
+	if len(p.leases) >= p.Limit || queued > 0 {
+		if err := p.Backlog.Push(body); err != nil {
+			return err
+		}
+		return p.dispatch()
+	}
+
+	if err := p.Producer.Publish(body); err != nil {
+		return err
+	}
+	p.lease()
+	return nil
+}
+
+// Done frees the slot of a finished job and dispatches queued jobs.
+func (p *LimitedProducer) Done() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// results of jobs dispatched before a restart or after their lease expired
+	// do not hold a slot
+	if len(p.leases) > 0 {
+		p.leases = p.leases[1:]
+	}
+
+	p.reclaimExpired()
+	return p.dispatch()
+}
+
+// Reclaim frees the slots of jobs whose lease expired and dispatches queued
+// jobs. It should be called periodically.
+func (p *LimitedProducer) Reclaim() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.reclaimExpired()
+	return p.dispatch()
+}
+
+// Queued returns the number of jobs waiting for a free slot.
+func (p *LimitedProducer) Queued() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	queued, _ := p.Backlog.Len()
+	return queued
+}
+
+func (p *LimitedProducer) lease() {
+	p.leases = append(p.leases, time.Now().Add(p.LeaseTimeout))
+}
+
+func (p *LimitedProducer) reclaimExpired() {
+	if p.LeaseTimeout <= 0 {
+		return
+	}
+
+	now := time.Now()
+	for len(p.leases) > 0 && p.leases[0].Before(now) {
+		logrus.WithField("module", "producer").Warn("lease of a grading job expired without a result")
+		p.leases = p.leases[1:]
+	}
+}
+
+// dispatch hands queued jobs to the workers while there are free slots.
+func (p *LimitedProducer) dispatch() error {
+	defer func() {
+		if queued, err := p.Backlog.Len(); err == nil {
+			totalQueuedJobsGauge.WithLabelValues().Set(float64(queued))
+		}
+	}()
+
+	for len(p.leases) < p.Limit {
+		body, err := p.Backlog.Pop()
+		if err != nil {
+			return err
+		}
+		if body == nil {
+			return nil
+		}
+		if err := p.Producer.Publish(body); err != nil {
+			// keep the job for the next attempt without losing its place
+			if err := p.Backlog.PushFront(body); err != nil {
+				logrus.WithField("module", "producer").Error(err)
+			}
+			return err
+		}
+		p.lease()
+	}
+	return nil
+}
+
 func InitSubmissionProducer() {
 	var err error
 
@@ -55,4 +262,32 @@ func InitSubmissionProducer() {
 
 	}
 
+	if limit := configuration.Configuration.Server.MaxConcurrentJobs; limit > 0 {
+		producer := NewLimitedProducer(DefaultSubmissionProducer, limit)
+		producer.LeaseTimeout = configuration.Configuration.Server.JobLeaseTimeout
+
+		option, err := redis.ParseURL(configuration.Configuration.Server.RedisURL())
+		if err != nil {
+			panic(err)
+		}
+		producer.Backlog = &RedisBacklog{Redis: redis.NewClient(option), Key: "infomark-grading-backlog"}
+
+		// jobs left over from a previous run are dispatched right away
+		if err := producer.Reclaim(); err != nil {
+			logrus.WithField("module", "producer").Error(err)
+		}
+
+		if producer.LeaseTimeout > 0 {
+			go func() {
+				for range time.Tick(producer.LeaseTimeout / 4) {
+					if err := producer.Reclaim(); err != nil {
+						logrus.WithField("module", "producer").Error(err)
+					}
+				}
+			}()
+		}
+
+		DefaultSubmissionProducer = producer
+	}
+
 }
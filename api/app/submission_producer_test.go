@@ -0,0 +1,177 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package app
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/franela/goblin"
+	"github.com/infomark-org/infomark/event"
+)
+
+// countingProducer tracks how many published jobs are still running.
+type countingProducer struct {
+	mu         sync.Mutex
+	published  int
+	running    int
+	maxRunning int
+	// fail makes publishing fail with this error
+	fail error
+	// bodies are the published jobs in order
+	bodies []string
+}
+
+func (p *countingProducer) Publish(body []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.fail != nil {
+		return p.fail
+	}
+	p.published++
+	p.bodies = append(p.bodies, string(body))
+	p.running++
+	if p.running > p.maxRunning {
+		p.maxRunning = p.running
+	}
+	return nil
+}
+
+// finish simulates a worker reporting the result of a job.
+func (p *countingProducer) finish() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.running == 0 {
+		return false
+	}
+	p.running--
+	return true
+}
+
+func TestLimitedProducer(t *testing.T) {
+	g := goblin.Goblin(t)
+
+	g.Describe("LimitedProducer", func() {
+
+		g.It("Should queue jobs exceeding the limit", func() {
+			inner := &countingProducer{}
+			producer := NewLimitedProducer(inner, 2)
+
+			for k := 0; k < 5; k++ {
+				g.Assert(producer.Publish([]byte("job"))).Equal(nil)
+			}
+			g.Assert(inner.published).Equal(2)
+			g.Assert(producer.Queued()).Equal(3)
+
+			inner.finish()
+			g.Assert(producer.Done()).Equal(nil)
+			g.Assert(inner.published).Equal(3)
+			g.Assert(producer.Queued()).Equal(2)
+		})
+
+		g.It("Should not run more than the limit concurrently", func() {
+			inner := &countingProducer{}
+			producer := NewLimitedProducer(inner, 3)
+
+			var wg sync.WaitGroup
+			for k := 0; k < 20; k++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					producer.Publish([]byte("job"))
+				}()
+			}
+
+			// workers finish their jobs concurrently to new uploads
+			for k := 0; k < 20; k++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for !inner.finish() {
+					}
+					producer.Done()
+				}()
+			}
+			wg.Wait()
+
+			g.Assert(inner.published).Equal(20)
+			g.Assert(inner.maxRunning <= 3).IsTrue()
+			g.Assert(producer.Queued()).Equal(0)
+		})
+
+		g.It("Should reclaim slots whose lease expired", func() {
+			inner := &countingProducer{}
+			producer := NewLimitedProducer(inner, 1)
+			producer.LeaseTimeout = 50 * time.Millisecond
+
+			g.Assert(producer.Publish([]byte("lost"))).Equal(nil)
+			g.Assert(producer.Publish([]byte("waiting"))).Equal(nil)
+			g.Assert(inner.published).Equal(1)
+
+			g.Assert(producer.Reclaim()).Equal(nil)
+			g.Assert(inner.published).Equal(1)
+
+			time.Sleep(100 * time.Millisecond)
+			g.Assert(producer.Reclaim()).Equal(nil)
+			g.Assert(inner.published).Equal(2)
+			g.Assert(producer.Queued()).Equal(0)
+		})
+
+		g.It("Should keep the order of jobs which failed to publish", func() {
+			inner := &countingProducer{}
+			producer := NewLimitedProducer(inner, 1)
+
+			for _, job := range []string{"first", "second", "third"} {
+				g.Assert(producer.Publish([]byte(job))).Equal(nil)
+			}
+
+			inner.fail = errors.New("broker unavailable")
+			inner.finish()
+			g.Assert(producer.Done() != nil).IsTrue()
+			g.Assert(producer.Queued()).Equal(2)
+
+			inner.fail = nil
+			g.Assert(producer.Reclaim()).Equal(nil)
+			inner.finish()
+			g.Assert(producer.Done()).Equal(nil)
+			g.Assert(inner.bodies).Equal([]string{"first", "second", "third"})
+		})
+
+		g.It("Should free the slot of discarded results", func() {
+			defer func(p Producer) { DefaultSubmissionProducer = p }(DefaultSubmissionProducer)
+
+			inner := &countingProducer{}
+			producer := NewLimitedProducer(inner, 1)
+			DefaultSubmissionProducer = producer
+
+			bus := event.NewBus()
+			registerJobSubscribers(bus)
+
+			g.Assert(producer.Publish([]byte("superseded"))).Equal(nil)
+			g.Assert(producer.Publish([]byte("latest"))).Equal(nil)
+			g.Assert(producer.Queued()).Equal(1)
+
+			g.Assert(bus.Publish(event.TestResultDiscarded{TaskID: 1, Kind: "public"})).Equal(nil)
+			g.Assert(inner.published).Equal(2)
+			g.Assert(producer.Queued()).Equal(0)
+		})
+
+	})
+}
@@ -0,0 +1,145 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package app
+
+import (
+	"sync"
+	"time"
+
+	"github.com/infomark-org/infomark/model"
+	"github.com/sirupsen/logrus"
+	null "gopkg.in/guregu/null.v3"
+)
+
+// RegradeProgress tracks a regrade of all submissions of a task. The
+// submissions are handed over to the background workers asynchronously.
+type RegradeProgress struct {
+	StartedAt time.Time
+	Total     int
+
+	mu       sync.Mutex
+	enqueued int
+	failed   int
+	running  bool
+}
+
+// Advance records that a submission has been handled.
+func (p *RegradeProgress) Advance(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err != nil {
+		p.failed++
+		return
+	}
+	p.enqueued++
+}
+
+// Finish marks that all submissions have been handled.
+func (p *RegradeProgress) Finish() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.running = false
+}
+
+// State returns the number of enqueued and failed submissions and whether
+// submissions are still being enqueued.
+func (p *RegradeProgress) State() (enqueued int, failed int, running bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.enqueued, p.failed, p.running
+}
+
+// regrades contains the latest regrade of each task (in memory).
+var regrades = struct {
+	sync.Mutex
+	byTask map[int64]*RegradeProgress
+}{byTask: map[int64]*RegradeProgress{}}
+
+// StartRegrade registers a new regrade for a task. It returns false if there
+// is already a regrade of this task which is still enqueueing submissions.
+func StartRegrade(taskID int64, total int) (*RegradeProgress, bool) {
+	regrades.Lock()
+	defer regrades.Unlock()
+
+	if progress, ok := regrades.byTask[taskID]; ok {
+		if _, _, running := progress.State(); running {
+			return progress, false
+		}
+	}
+
+	progress := &RegradeProgress{
+		StartedAt: NowUTC(),
+		Total:     total,
+		running:   true,
+	}
+	regrades.byTask[taskID] = progress
+	return progress, true
+}
+
+// RegradeOfTask returns the latest regrade of a task if any.
+func RegradeOfTask(taskID int64) (*RegradeProgress, bool) {
+	regrades.Lock()
+	defer regrades.Unlock()
+	progress, ok := regrades.byTask[taskID]
+	return progress, ok
+}
+
+// regrade resets the grades of the given submissions and hands them over to
+// the background workers again. Points and feedback from tutors are kept.
+func (rs *SubmissionResource) regrade(progress *RegradeProgress, course *model.Course,
+	task *model.Task, submissions []model.Submission) {
+	defer progress.Finish()
+
+	for k := range submissions {
+		err := rs.regradeSubmission(course, task, &submissions[k])
+		if err != nil {
+			logrus.WithFields(logrus.Fields{
+				"module":        "regrade",
+				"task_id":       task.ID,
+				"submission_id": submissions[k].ID,
+			}).Warn(err)
+		}
+		progress.Advance(err)
+	}
+}
+
+func (rs *SubmissionResource) regradeSubmission(course *model.Course, task *model.Task,
+	submission *model.Submission) error {
+	grade, err := rs.Stores.Grade.GetForSubmission(submission.ID)
+	if err != nil {
+		return err
+	}
+
+	// the points of the previous tests must not count anymore
+	if err := rs.Stores.Grade.DiscardAutograderPoints(grade.ID); err != nil {
+		return err
+	}
+
+	grade.BestPoints = grade.AcquiredPoints
+	grade.PublicExecutionState = 0
+	grade.PrivateExecutionState = 0
+	grade.PublicTestLog = "submission will be tested again"
+	grade.PrivateTestLog = "submission will be tested again"
+	grade.EnqueuedAt = null.TimeFrom(NowUTC())
+
+	if err := rs.Stores.Grade.Update(grade); err != nil {
+		return err
+	}
+
+	return rs.enqueueGrading(course, task, submission, grade)
+}
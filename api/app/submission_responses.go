@@ -22,20 +22,24 @@ package app
 import (
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/go-chi/render"
+	"github.com/infomark-org/infomark/api/helper"
 	"github.com/infomark-org/infomark/configuration"
 	"github.com/infomark-org/infomark/model"
+	null "gopkg.in/guregu/null.v3"
 )
 
 // .............................................................................
 
 // SubmissionResponse is the response payload for Submission management.
 type SubmissionResponse struct {
-	ID      int64  `json:"id" example:"61"`
-	UserID  int64  `json:"user_id" example:"357"`
-	TaskID  int64  `json:"task_id" example:"12"`
-	FileURL string `json:"file_url" example:"/api/v1/submissions/61/file"`
+	ID          int64  `json:"id" example:"61"`
+	UserID      int64  `json:"user_id" example:"357"`
+	AnonymousID string `json:"anonymous_id,omitempty" example:"student-3fa9c2d1e04b"`
+	TaskID      int64  `json:"task_id" example:"12"`
+	FileURL     string `json:"file_url" example:"/api/v1/submissions/61/file"`
 }
 
 // newSubmissionResponse creates a response from a Submission model.
@@ -57,11 +61,17 @@ func newSubmissionResponse(p *model.Submission, courseID int64) *SubmissionRespo
 	return sr
 }
 
-// newSubmissionListResponse creates a response from a list of Submission models.
-func newSubmissionListResponse(Submissions []model.Submission, courseID int64) []render.Renderer {
+// newSubmissionListResponse creates a response from a list of Submission
+// models. The students of the tasks in hidden are replaced by pseudonyms.
+func newSubmissionListResponse(Submissions []model.Submission, courseID int64, hidden map[int64]int64) []render.Renderer {
 	list := []render.Renderer{}
 	for k := range Submissions {
-		list = append(list, newSubmissionResponse(&Submissions[k], courseID))
+		sr := newSubmissionResponse(&Submissions[k], courseID)
+		if sheetID, ok := hidden[Submissions[k].TaskID]; ok {
+			sr.UserID = 0
+			sr.AnonymousID = anonymousID(courseID, sheetID, Submissions[k].UserID)
+		}
+		list = append(list, sr)
 	}
 	return list
 }
@@ -70,3 +80,198 @@ func newSubmissionListResponse(Submissions []model.Submission, courseID int64) [
 func (body *SubmissionResponse) Render(w http.ResponseWriter, r *http.Request) error {
 	return nil
 }
+
+// SubmissionStatusResponse is the response payload for a submission together
+// with the state of its grading.
+type SubmissionStatusResponse struct {
+	ID          int64  `json:"id" example:"61"`
+	UserID      int64  `json:"user_id" example:"357"`
+	AnonymousID string `json:"anonymous_id,omitempty" example:"student-3fa9c2d1e04b"`
+	TaskID      int64  `json:"task_id" example:"12"`
+	FileURL     string `json:"file_url" example:"/api/v1/submissions/61/file"`
+	Status      string `json:"status" example:"pending"`
+}
+
+// newSubmissionStatusListResponse creates a response from a list of
+// submissions with their grading state. The students of the tasks in hidden
+// are replaced by pseudonyms.
+func newSubmissionStatusListResponse(submissions []model.SubmissionWithStatus, courseID int64, hidden map[int64]int64) []render.Renderer {
+	list := []render.Renderer{}
+	for k := range submissions {
+		sr := newSubmissionResponse(&submissions[k].Submission, courseID)
+		resp := &SubmissionStatusResponse{
+			ID:      sr.ID,
+			UserID:  sr.UserID,
+			TaskID:  sr.TaskID,
+			FileURL: sr.FileURL,
+			Status:  submissions[k].Status,
+		}
+		if sheetID, ok := hidden[submissions[k].TaskID]; ok {
+			resp.UserID = 0
+			resp.AnonymousID = anonymousID(courseID, sheetID, submissions[k].UserID)
+		}
+		list = append(list, resp)
+	}
+	return list
+}
+
+// Render post-processes a SubmissionStatusResponse.
+func (body *SubmissionStatusResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+// QueuePositionResponse is the response payload for the position of a
+// submission in the grading queue.
+type QueuePositionResponse struct {
+	Status     string   `json:"status" example:"queued"`
+	Position   null.Int `json:"position" example:"3"`
+	ETASeconds null.Int `json:"eta_seconds" example:"90"`
+}
+
+// Render post-processes a QueuePositionResponse.
+func (body *QueuePositionResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+// SubmissionDiffResponse is the response payload containing the diff between
+// the output of a submission and the reference output of its task.
+type SubmissionDiffResponse struct {
+	SubmissionID int64  `json:"submission_id" example:"31"`
+	Diff         string `json:"diff" example:"-expected\n+actual"`
+}
+
+// Render post-processes a SubmissionDiffResponse.
+func (body *SubmissionDiffResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+// SubmissionCompareResponse is the response payload containing the
+// differences between the files of two submissions.
+type SubmissionCompareResponse struct {
+	A     int64                           `json:"a" example:"31"`
+	B     int64                           `json:"b" example:"32"`
+	Files []SubmissionFileCompareResponse `json:"files"`
+}
+
+// SubmissionFileCompareResponse describes how a single file differs between
+// two submissions. "op" of a line is "=", "-" (only in a) or "+" (only in b).
+type SubmissionFileCompareResponse struct {
+	Name   string `json:"name" example:"src/Main.java"`
+	Status string `json:"status" example:"modified"`
+	Binary bool   `json:"binary" example:"false"`
+	Lines  []struct {
+		Op    string   `json:"op" example:"+"`
+		LineA null.Int `json:"line_a" example:"12"`
+		LineB null.Int `json:"line_b" example:"14"`
+		Text  string   `json:"text" example:"return fib(n - 1) + fib(n - 2);"`
+	} `json:"lines"`
+}
+
+// newSubmissionCompareResponse creates a response from the diff of two
+// submission files.
+func newSubmissionCompareResponse(a int64, b int64, diffs []helper.ArchiveFileDiff) *SubmissionCompareResponse {
+	response := &SubmissionCompareResponse{
+		A:     a,
+		B:     b,
+		Files: []SubmissionFileCompareResponse{},
+	}
+
+	for _, diff := range diffs {
+		file := SubmissionFileCompareResponse{
+			Name:   diff.Name,
+			Status: diff.Status,
+			Binary: diff.Binary,
+			Lines: []struct {
+				Op    string   `json:"op" example:"+"`
+				LineA null.Int `json:"line_a" example:"12"`
+				LineB null.Int `json:"line_b" example:"14"`
+				Text  string   `json:"text" example:"return fib(n - 1) + fib(n - 2);"`
+			}{},
+		}
+		for _, line := range diff.Lines {
+			file.Lines = append(file.Lines, struct {
+				Op    string   `json:"op" example:"+"`
+				LineA null.Int `json:"line_a" example:"12"`
+				LineB null.Int `json:"line_b" example:"14"`
+				Text  string   `json:"text" example:"return fib(n - 1) + fib(n - 2);"`
+			}{
+				line.Op,
+				null.NewInt(int64(line.OldLine), line.OldLine > 0),
+				null.NewInt(int64(line.NewLine), line.NewLine > 0),
+				line.Text,
+			})
+		}
+		response.Files = append(response.Files, file)
+	}
+
+	return response
+}
+
+// Render post-processes a SubmissionCompareResponse.
+func (body *SubmissionCompareResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+// SignedURLResponse is the response payload containing a shared link to a
+// file, which can be used without being logged in.
+type SignedURLResponse struct {
+	URL       string    `json:"url" example:"https://infomark.org/api/v1/courses/1/submissions/3/file?expires=...&signature=..."`
+	ExpiresAt time.Time `json:"expires_at" example:"auto"`
+}
+
+// Render post-processes a SignedURLResponse.
+func (body *SignedURLResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+// SubmissionPurgeResponse is the response payload after purging expired
+// submission files.
+type SubmissionPurgeResponse struct {
+	Deleted int `json:"deleted" example:"42"`
+}
+
+// Render post-processes a SubmissionPurgeResponse.
+func (body *SubmissionPurgeResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+// TaskResetResponse is the response payload after deleting all submissions of
+// a task.
+type TaskResetResponse struct {
+	Deleted int    `json:"deleted" example:"42"`
+	Archive string `json:"archive,omitempty" example:"reset-task3-1570000000.zip"`
+}
+
+// Render post-processes a TaskResetResponse.
+func (body *TaskResetResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+// RegradeResponse is the response payload showing the progress of a regrade
+// of all submissions of a task.
+type RegradeResponse struct {
+	StartedAt time.Time `json:"started_at" example:"auto"`
+	Total     int       `json:"total" example:"120"`
+	Enqueued  int       `json:"enqueued" example:"80"`
+	Failed    int       `json:"failed" example:"1"`
+	Tested    int       `json:"tested" example:"42"`
+	Running   bool      `json:"running" example:"true"`
+}
+
+// Render post-processes a RegradeResponse.
+func (body *RegradeResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+// newRegradeResponse creates a response from the progress of a regrade.
+func newRegradeResponse(p *RegradeProgress, tested int) *RegradeResponse {
+	enqueued, failed, running := p.State()
+	return &RegradeResponse{
+		StartedAt: p.StartedAt,
+		Total:     p.Total,
+		Enqueued:  enqueued,
+		Failed:    failed,
+		Tested:    tested,
+		Running:   running,
+	}
+}
@@ -0,0 +1,55 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package app
+
+import (
+	"github.com/infomark-org/infomark/api/helper"
+	"github.com/infomark-org/infomark/configuration"
+)
+
+// PurgeExpiredSubmissionFiles deletes the files of all submissions which are
+// older than the retention period of their course including all previous
+// versions. The submissions and their
+// grades are kept. A courseID of 0 purges all courses. It returns the number of
+// deleted files.
+func PurgeExpiredSubmissionFiles(stores *Stores, courseID int64) (int, error) {
+	retention := configuration.Configuration.Server.SubmissionRetention
+
+	submissions, err := stores.Submission.GetExpired(courseID, retention.Days, retention.KeepGraded)
+	if err != nil {
+		return 0, err
+	}
+
+	deleted := 0
+	for _, submission := range submissions {
+		hnd := helper.NewSubmissionFileHandle(submission.ID)
+		if err := helper.DeleteSubmissionHistory(hnd); err != nil {
+			return deleted, err
+		}
+
+		if !hnd.Exists() {
+			continue
+		}
+		if err := hnd.Delete(); err != nil {
+			return deleted, err
+		}
+		deleted++
+	}
+
+	return deleted, nil
+}
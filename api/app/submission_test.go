@@ -20,18 +20,64 @@
 package app
 
 import (
+	"archive/zip"
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/franela/goblin"
 	"github.com/infomark-org/infomark/api/helper"
+	"github.com/infomark-org/infomark/api/shared"
+	"github.com/infomark-org/infomark/auth/authenticate"
 	"github.com/infomark-org/infomark/configuration"
 	"github.com/infomark-org/infomark/email"
+	"github.com/infomark-org/infomark/model"
+	"github.com/sirupsen/logrus/hooks/test"
+	null "gopkg.in/guregu/null.v3"
 )
 
+// contentRange marks a request as a chunk of an upload.
+type contentRange string
+
+func (c contentRange) Modify(r *http.Request) {
+	r.Header.Set("Content-Range", string(c))
+}
+
+// fakeGrader acts like a background worker, which immediately reports a
+// successful test for every job.
+type fakeGrader struct {
+	tape *Tape
+}
+
+func (f *fakeGrader) Publish(body []byte) error {
+	msg := &shared.SubmissionAMQPWorkerRequest{}
+	if err := json.Unmarshal(body, msg); err != nil {
+		return err
+	}
+
+	endpoint, err := url.Parse(msg.ResultEndpointURL)
+	if err != nil {
+		return err
+	}
+
+	w := f.tape.Post(endpoint.Path, H{
+		"log":    "graded by fake grader",
+		"status": 0,
+	}, f.tape.NewJWTRequest(1, true))
+	if w.Code != http.StatusOK {
+		return fmt.Errorf("fake grader got status %d", w.Code)
+	}
+	return nil
+}
+
 func TestSubmission(t *testing.T) {
 
 	g := goblin.Goblin(t)
@@ -145,6 +191,125 @@ func TestSubmission(t *testing.T) {
 
 		})
 
+		g.It("Should keep a single active submission for rapid double uploads", func() {
+			task, err := stores.Task.Get(1)
+			g.Assert(err).Equal(nil)
+			sheet, err := stores.Task.IdentifySheetOfTask(task.ID)
+			g.Assert(err).Equal(nil)
+
+			sheet.PublishAt = NowUTC().Add(-time.Hour)
+			sheet.DueAt = NowUTC().Add(time.Hour)
+			err = stores.Sheet.Update(sheet)
+			g.Assert(err).Equal(nil)
+
+			_, err = tape.DB.Exec("DELETE FROM submissions WHERE user_id = 112;")
+			g.Assert(err).Equal(nil)
+
+			filename := fmt.Sprintf("%s/empty.zip", configuration.Configuration.Server.Debugging.Fixtures)
+			codes := make(chan int, 2)
+			var wg sync.WaitGroup
+			for k := 0; k < 2; k++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					w, err := tape.Upload("/api/v1/courses/1/tasks/1/submission", filename, "application/zip", studentJWT)
+					if err != nil {
+						codes <- 0
+						return
+					}
+					codes <- w.Code
+				}()
+			}
+			wg.Wait()
+			close(codes)
+			for code := range codes {
+				g.Assert(code).Equal(http.StatusOK)
+			}
+
+			numberSubmissions, err := DBGetInt(tape, "SELECT count(*) FROM submissions WHERE user_id = 112 AND task_id = $1", 1)
+			g.Assert(err).Equal(nil)
+			g.Assert(numberSubmissions).Equal(1)
+
+			submission, err := stores.Submission.GetByUserAndTask(112, 1)
+			g.Assert(err).Equal(nil)
+			defer helper.NewSubmissionFileHandle(submission.ID).Delete()
+
+			numberGrades, err := DBGetInt(tape, "SELECT count(*) FROM grades WHERE submission_id = $1", submission.ID)
+			g.Assert(err).Equal(nil)
+			g.Assert(numberGrades).Equal(1)
+
+			grade, err := stores.Grade.GetForSubmission(submission.ID)
+			g.Assert(err).Equal(nil)
+			g.Assert(grade.EnqueuedAt.Valid).IsTrue()
+
+			// the result of the superseded grading is discarded
+			url := fmt.Sprintf("/api/v1/courses/1/grades/%d/public_result", grade.ID)
+			w := tape.Post(url, H{
+				"log":         "outdated logs",
+				"status":      0,
+				"enqueued_at": grade.EnqueuedAt.Time.Add(-time.Minute),
+			}, adminJWT)
+			g.Assert(w.Code).Equal(http.StatusConflict)
+
+			w = tape.Post(url, H{
+				"log":         "current logs",
+				"status":      0,
+				"enqueued_at": grade.EnqueuedAt.Time.Add(time.Second),
+			}, adminJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			grade, err = stores.Grade.GetForSubmission(submission.ID)
+			g.Assert(err).Equal(nil)
+			g.Assert(grade.PublicTestLog).Equal("current logs")
+		})
+
+		g.It("Students have to acknowledge the honor code before uploading", func() {
+			task, err := stores.Task.Get(1)
+			g.Assert(err).Equal(nil)
+			sheet, err := stores.Task.IdentifySheetOfTask(task.ID)
+			g.Assert(err).Equal(nil)
+
+			sheet.PublishAt = NowUTC().Add(-time.Hour)
+			sheet.DueAt = NowUTC().Add(time.Hour)
+			err = stores.Sheet.Update(sheet)
+			g.Assert(err).Equal(nil)
+
+			course, err := stores.Course.Get(1)
+			g.Assert(err).Equal(nil)
+			course.HonorCode = "I will not share my solutions."
+			err = stores.Course.Update(course)
+			g.Assert(err).Equal(nil)
+
+			filename := fmt.Sprintf("%s/empty.zip", configuration.Configuration.Server.Debugging.Fixtures)
+			w, err := tape.Upload("/api/v1/courses/1/tasks/1/submission", filename, "application/zip", studentJWT)
+			g.Assert(err).Equal(nil)
+			g.Assert(w.Code).Equal(http.StatusForbidden)
+
+			enrollment, err := stores.Course.GetUserEnrollment(1, 112)
+			g.Assert(err).Equal(nil)
+			g.Assert(enrollment.HonorCodeAcknowledgedAt.Valid).Equal(false)
+
+			w = tape.Post("/api/v1/courses/1/acknowledge_honor_code", H{}, studentJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			enrollment, err = stores.Course.GetUserEnrollment(1, 112)
+			g.Assert(err).Equal(nil)
+			g.Assert(enrollment.HonorCodeAcknowledgedAt.Valid).Equal(true)
+
+			w, err = tape.Upload("/api/v1/courses/1/tasks/1/submission", filename, "application/zip", studentJWT)
+			g.Assert(err).Equal(nil)
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			submission, err := stores.Submission.GetByUserAndTask(112, 1)
+			g.Assert(err).Equal(nil)
+			defer helper.NewSubmissionFileHandle(submission.ID).Delete()
+
+			// other students are still blocked
+			w, err = tape.Upload("/api/v1/courses/1/tasks/1/submission", filename, "application/zip", otherStudentJWT)
+			g.Assert(err).Equal(nil)
+			g.Assert(w.Code).Equal(http.StatusForbidden)
+		})
+
 		g.It("Students cannot upload solution (create) since too late", func() {
 
 			deadlineAt := NowUTC().Add(-2 * time.Hour)
@@ -186,6 +351,82 @@ func TestSubmission(t *testing.T) {
 
 		})
 
+		g.It("Should only accept submissions between publication and due date unless extended", func() {
+			task, err := stores.Task.Get(1)
+			g.Assert(err).Equal(nil)
+			sheet, err := stores.Task.IdentifySheetOfTask(task.ID)
+			g.Assert(err).Equal(nil)
+
+			_, err = tape.DB.Exec("DELETE FROM submissions WHERE task_id = 1;")
+			g.Assert(err).Equal(nil)
+
+			filename := fmt.Sprintf("%s/empty.zip", configuration.Configuration.Server.Debugging.Fixtures)
+
+			// not published yet
+			sheet.PublishAt = NowUTC().Add(time.Hour)
+			sheet.DueAt = NowUTC().Add(2 * time.Hour)
+			g.Assert(stores.Sheet.Update(sheet)).Equal(nil)
+
+			w, err := tape.Upload("/api/v1/courses/1/tasks/1/submission", filename, "application/zip", studentJWT)
+			g.Assert(err).Equal(nil)
+			g.Assert(w.Code).Equal(http.StatusBadRequest)
+			g.Assert(strings.Contains(w.Body.String(), "not published yet")).IsTrue()
+
+			// over due
+			sheet.PublishAt = NowUTC().Add(-10 * time.Hour)
+			sheet.DueAt = NowUTC().Add(-2 * time.Hour)
+			g.Assert(stores.Sheet.Update(sheet)).Equal(nil)
+
+			w, err = tape.Upload("/api/v1/courses/1/tasks/1/submission", filename, "application/zip", studentJWT)
+			g.Assert(err).Equal(nil)
+			g.Assert(w.Code).Equal(http.StatusBadRequest)
+			g.Assert(strings.Contains(w.Body.String(), "too late")).IsTrue()
+
+			// students cannot extend their own deadline
+			extensionsURL := fmt.Sprintf("/api/v1/courses/1/sheets/%d/extensions", sheet.ID)
+			data := H{"user_id": 112, "due_at": NowUTC().Add(time.Hour)}
+			w = tape.Put(extensionsURL, data, studentJWT)
+			g.Assert(w.Code).Equal(http.StatusForbidden)
+
+			w = tape.Put(extensionsURL, data, adminJWT)
+			g.Assert(w.Code).Equal(http.StatusNoContent)
+
+			w = tape.Get(extensionsURL, adminJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+			extensions := []SheetExtensionResponse{}
+			g.Assert(json.NewDecoder(w.Body).Decode(&extensions)).Equal(nil)
+			g.Assert(len(extensions)).Equal(1)
+			g.Assert(extensions[0].UserID).Equal(int64(112))
+
+			// only the student with the extension can still submit
+			w, err = tape.Upload("/api/v1/courses/1/tasks/1/submission", filename, "application/zip", studentJWT)
+			g.Assert(err).Equal(nil)
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			submission, err := stores.Submission.GetByUserAndTask(112, 1)
+			g.Assert(err).Equal(nil)
+			defer helper.NewSubmissionFileHandle(submission.ID).Delete()
+
+			w, err = tape.Upload("/api/v1/courses/1/tasks/1/submission", filename, "application/zip", otherStudentJWT)
+			g.Assert(err).Equal(nil)
+			g.Assert(w.Code).Equal(http.StatusBadRequest)
+
+			// an extension which is over as well does not help
+			w = tape.Put(extensionsURL, H{"user_id": 112, "due_at": NowUTC().Add(-time.Hour)}, adminJWT)
+			g.Assert(w.Code).Equal(http.StatusNoContent)
+
+			w, err = tape.Upload("/api/v1/courses/1/tasks/1/submission", filename, "application/zip", studentJWT)
+			g.Assert(err).Equal(nil)
+			g.Assert(w.Code).Equal(http.StatusBadRequest)
+
+			w = tape.Delete(fmt.Sprintf("%s/112", extensionsURL), adminJWT)
+			g.Assert(w.Code).Equal(http.StatusNoContent)
+
+			extension, err := stores.Sheet.ExtensionsOfSheet(sheet.ID)
+			g.Assert(err).Equal(nil)
+			g.Assert(len(extension)).Equal(0)
+		})
+
 		g.It("Students can upload solution (update)", func() {
 
 			defer helper.NewSubmissionFileHandle(3001).Delete()
@@ -220,6 +461,322 @@ func TestSubmission(t *testing.T) {
 
 		})
 
+		g.It("Should strip junk entries and reject unsafe paths in uploaded archives", func() {
+			defer helper.NewSubmissionFileHandle(3001).Delete()
+
+			sheet, err := stores.Task.IdentifySheetOfTask(1)
+			g.Assert(err).Equal(nil)
+			sheet.PublishAt = NowUTC().Add(-time.Hour)
+			sheet.DueAt = NowUTC().Add(time.Hour)
+			err = stores.Sheet.Update(sheet)
+			g.Assert(err).Equal(nil)
+
+			writeArchive := func(filename string, names ...string) {
+				buf := new(bytes.Buffer)
+				zipWriter := zip.NewWriter(buf)
+				for _, name := range names {
+					writer, err := zipWriter.Create(name)
+					g.Assert(err).Equal(nil)
+					_, err = writer.Write([]byte("content of " + name))
+					g.Assert(err).Equal(nil)
+				}
+				g.Assert(zipWriter.Close()).Equal(nil)
+				g.Assert(ioutil.WriteFile(filename, buf.Bytes(), 0644)).Equal(nil)
+			}
+
+			writeArchive("/tmp/junk.zip",
+				"main/Main.java", "__MACOSX/main/._Main.java", "main/.DS_Store")
+			defer os.Remove("/tmp/junk.zip")
+
+			w, err := tape.Upload("/api/v1/courses/1/tasks/1/submission", "/tmp/junk.zip", "application/zip", studentJWT)
+			g.Assert(err).Equal(nil)
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			reader, err := zip.OpenReader(helper.NewSubmissionFileHandle(3001).Path())
+			g.Assert(err).Equal(nil)
+			names := []string{}
+			for _, entry := range reader.File {
+				names = append(names, entry.Name)
+			}
+			reader.Close()
+			g.Assert(names).Equal([]string{"main/Main.java"})
+
+			// the graders have already finished
+			_, err = tape.DB.Exec("UPDATE grades SET public_execution_state = 2, private_execution_state = 2 WHERE submission_id = 3001")
+			g.Assert(err).Equal(nil)
+			gradeBefore, err := stores.Grade.GetForSubmission(3001)
+			g.Assert(err).Equal(nil)
+			checksumBefore, err := helper.NewSubmissionFileHandle(3001).Sha256()
+			g.Assert(err).Equal(nil)
+
+			writeArchive("/tmp/traversal.zip", "main/Main.java", "../../etc/cron.d/evil")
+			defer os.Remove("/tmp/traversal.zip")
+
+			w, err = tape.Upload("/api/v1/courses/1/tasks/1/submission", "/tmp/traversal.zip", "application/zip", studentJWT)
+			g.Assert(err).Equal(nil)
+			g.Assert(w.Code).Equal(http.StatusBadRequest)
+
+			// the previous upload is kept and not tested again
+			checksumAfter, err := helper.NewSubmissionFileHandle(3001).Sha256()
+			g.Assert(err).Equal(nil)
+			g.Assert(checksumAfter).Equal(checksumBefore)
+
+			gradeAfter, err := stores.Grade.GetForSubmission(3001)
+			g.Assert(err).Equal(nil)
+			g.Assert(gradeAfter.PublicExecutionState).Equal(gradeBefore.PublicExecutionState)
+			g.Assert(gradeAfter.PrivateExecutionState).Equal(gradeBefore.PrivateExecutionState)
+			g.Assert(gradeAfter.EnqueuedAt).Equal(gradeBefore.EnqueuedAt)
+		})
+
+		g.It("Students can upload solution in chunks", func() {
+			defer helper.NewSubmissionFileHandle(3001).Delete()
+
+			deadlineAt := NowUTC().Add(time.Hour)
+			publishedAt := NowUTC().Add(-time.Hour)
+
+			// make sure the upload date is good
+			sheet, err := stores.Task.IdentifySheetOfTask(1)
+			g.Assert(err).Equal(nil)
+			sheet.PublishAt = publishedAt
+			sheet.DueAt = deadlineAt
+			err = stores.Sheet.Update(sheet)
+			g.Assert(err).Equal(nil)
+
+			filename := fmt.Sprintf("%s/empty.zip", configuration.Configuration.Server.Debugging.Fixtures)
+			content, err := ioutil.ReadFile(filename)
+			g.Assert(err).Equal(nil)
+
+			// split the file into two chunks
+			half := len(content) / 2
+			total := len(content)
+			err = ioutil.WriteFile("/tmp/chunk1.zip", content[:half], 0644)
+			g.Assert(err).Equal(nil)
+			err = ioutil.WriteFile("/tmp/chunk2.zip", content[half:], 0644)
+			g.Assert(err).Equal(nil)
+			defer os.Remove("/tmp/chunk1.zip")
+			defer os.Remove("/tmp/chunk2.zip")
+
+			// the second chunk cannot come first
+			w, err := tape.Upload("/api/v1/courses/1/tasks/1/submission", "/tmp/chunk2.zip", "application/zip",
+				contentRange(fmt.Sprintf("bytes %d-%d/%d", half, total-1, total)), studentJWT)
+			g.Assert(err).Equal(nil)
+			g.Assert(w.Code).Equal(http.StatusBadRequest)
+
+			w, err = tape.Upload("/api/v1/courses/1/tasks/1/submission", "/tmp/chunk1.zip", "application/zip",
+				contentRange(fmt.Sprintf("bytes %d-%d/%d", 0, half-1, total)), studentJWT)
+			g.Assert(err).Equal(nil)
+			g.Assert(w.Code).Equal(http.StatusAccepted)
+			g.Assert(w.Header().Get("Range")).Equal(fmt.Sprintf("bytes=0-%d", half-1))
+
+			// nothing is stored until the upload is complete
+			g.Assert(helper.NewSubmissionFileHandle(3001).Exists()).Equal(false)
+
+			w, err = tape.Upload("/api/v1/courses/1/tasks/1/submission", "/tmp/chunk2.zip", "application/zip",
+				contentRange(fmt.Sprintf("bytes %d-%d/%d", half, total-1, total)), studentJWT)
+			g.Assert(err).Equal(nil)
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			g.Assert(helper.NewSubmissionFileHandle(3001).Exists()).Equal(true)
+			reassembled, err := ioutil.ReadFile(helper.NewSubmissionFileHandle(3001).Path())
+			g.Assert(err).Equal(nil)
+			g.Assert(bytes.Equal(reassembled, content)).IsTrue()
+		})
+
+		g.It("Tutors can download all versions of a submission", func() {
+			// previous tests might have uploaded versions as well
+			helper.DeleteSubmissionHistory(helper.NewSubmissionFileHandle(3001))
+			defer helper.DeleteSubmissionHistory(helper.NewSubmissionFileHandle(3001))
+			defer helper.NewSubmissionFileHandle(3001).Delete()
+
+			sheet, err := stores.Task.IdentifySheetOfTask(1)
+			g.Assert(err).Equal(nil)
+			sheet.PublishAt = NowUTC().Add(-time.Hour)
+			sheet.DueAt = NowUTC().Add(time.Hour)
+			err = stores.Sheet.Update(sheet)
+			g.Assert(err).Equal(nil)
+
+			filename := fmt.Sprintf("%s/empty.zip", configuration.Configuration.Server.Debugging.Fixtures)
+			for k := 0; k < 3; k++ {
+				w, err := tape.Upload("/api/v1/courses/1/tasks/1/submission", filename, "application/zip", studentJWT)
+				g.Assert(err).Equal(nil)
+				g.Assert(w.Code).Equal(http.StatusOK)
+			}
+
+			w := tape.Get("/api/v1/courses/1/tasks/1/users/112/submissions.zip", studentJWT)
+			g.Assert(w.Code).Equal(http.StatusForbidden)
+
+			w = tape.Get("/api/v1/courses/1/tasks/1/users/112/submissions.zip", tutorJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+			g.Assert(w.Header().Get("Content-Type")).Equal("application/zip")
+
+			archive, err := zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+			g.Assert(err).Equal(nil)
+			g.Assert(len(archive.File)).Equal(3)
+
+			// user without submission
+			w = tape.Get("/api/v1/courses/1/tasks/1/users/2/submissions.zip", tutorJWT)
+			g.Assert(w.Code).Equal(http.StatusNotFound)
+		})
+
+		g.It("Should provide a zip file with the latest submission of every student", func() {
+			task, err := stores.Task.Get(1)
+			g.Assert(err).Equal(nil)
+			sheet, err := stores.Task.IdentifySheetOfTask(task.ID)
+			g.Assert(err).Equal(nil)
+
+			sheet.PublishAt = NowUTC().Add(-time.Hour)
+			sheet.DueAt = NowUTC().Add(time.Hour)
+			err = stores.Sheet.Update(sheet)
+			g.Assert(err).Equal(nil)
+
+			_, err = tape.DB.Exec("DELETE FROM submissions WHERE task_id = 1;")
+			g.Assert(err).Equal(nil)
+
+			filename := fmt.Sprintf("%s/empty.zip", configuration.Configuration.Server.Debugging.Fixtures)
+			for _, jwt := range []JWTRequest{studentJWT, studentJWT, otherStudentJWT} {
+				w, err := tape.Upload("/api/v1/courses/1/tasks/1/submission", filename, "application/zip", jwt)
+				g.Assert(err).Equal(nil)
+				g.Assert(w.Code).Equal(http.StatusOK)
+			}
+
+			for _, userID := range []int64{112, 113} {
+				submission, err := stores.Submission.GetByUserAndTask(userID, 1)
+				g.Assert(err).Equal(nil)
+				defer helper.NewSubmissionFileHandle(submission.ID).Delete()
+			}
+
+			w := tape.Get("/api/v1/courses/1/tasks/1/submissions.zip", studentJWT)
+			g.Assert(w.Code).Equal(http.StatusForbidden)
+
+			w = tape.Get("/api/v1/courses/1/tasks/1/submissions.zip", tutorJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+			g.Assert(w.Header().Get("Content-Type")).Equal("application/zip")
+
+			archive, err := zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+			g.Assert(err).Equal(nil)
+
+			folders := map[string]bool{}
+			hasManifest := false
+			for _, file := range archive.File {
+				if file.Name == "manifest.csv" {
+					hasManifest = true
+					continue
+				}
+				folders[strings.Split(file.Name, "/")[0]] = true
+			}
+			g.Assert(hasManifest).Equal(true)
+			g.Assert(len(folders)).Equal(2)
+		})
+
+		g.It("Admins can delete all submissions of a task", func() {
+			hook := test.NewGlobal()
+			defer hook.Reset()
+
+			task, err := stores.Task.Get(1)
+			g.Assert(err).Equal(nil)
+			sheet, err := stores.Task.IdentifySheetOfTask(task.ID)
+			g.Assert(err).Equal(nil)
+
+			sheet.PublishAt = NowUTC().Add(-time.Hour)
+			sheet.DueAt = NowUTC().Add(time.Hour)
+			err = stores.Sheet.Update(sheet)
+			g.Assert(err).Equal(nil)
+
+			filename := fmt.Sprintf("%s/empty.zip", configuration.Configuration.Server.Debugging.Fixtures)
+			w, err := tape.Upload("/api/v1/courses/1/tasks/1/submission", filename, "application/zip", studentJWT)
+			g.Assert(err).Equal(nil)
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			submission, err := stores.Submission.GetByUserAndTask(112, 1)
+			g.Assert(err).Equal(nil)
+			defer helper.NewSubmissionFileHandle(submission.ID).Delete()
+			g.Assert(helper.NewSubmissionFileHandle(submission.ID).Exists()).Equal(true)
+
+			submissionsBefore, err := DBGetInt(tape, "SELECT count(*) FROM submissions WHERE task_id = $1", 1)
+			g.Assert(err).Equal(nil)
+			g.Assert(submissionsBefore > 0).IsTrue()
+
+			w = tape.Delete("/api/v1/courses/1/tasks/1/submissions?confirm=true", tutorJWT)
+			g.Assert(w.Code).Equal(http.StatusForbidden)
+
+			// the reset has to be confirmed
+			w = tape.Delete("/api/v1/courses/1/tasks/1/submissions", adminJWT)
+			g.Assert(w.Code).Equal(http.StatusBadRequest)
+
+			w = tape.Delete("/api/v1/courses/1/tasks/1/submissions?confirm=true&archive=true", adminJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			resp := TaskResetResponse{}
+			err = json.NewDecoder(w.Body).Decode(&resp)
+			g.Assert(err).Equal(nil)
+			g.Assert(resp.Deleted).Equal(submissionsBefore)
+			g.Assert(resp.Archive != "").IsTrue()
+
+			archivePath := fmt.Sprintf("%s/%s", configuration.Configuration.Server.Paths.GeneratedFiles, resp.Archive)
+			defer os.Remove(archivePath)
+			g.Assert(helper.FileExists(archivePath)).IsTrue()
+
+			submissionsAfter, err := DBGetInt(tape, "SELECT count(*) FROM submissions WHERE task_id = $1", 1)
+			g.Assert(err).Equal(nil)
+			g.Assert(submissionsAfter).Equal(0)
+
+			gradesAfter, err := DBGetInt(tape, "SELECT count(*) FROM grades WHERE submission_id = $1", submission.ID)
+			g.Assert(err).Equal(nil)
+			g.Assert(gradesAfter).Equal(0)
+			g.Assert(helper.NewSubmissionFileHandle(submission.ID).Exists()).Equal(false)
+
+			audited := false
+			for _, entry := range hook.AllEntries() {
+				if entry.Data["action"] == "task.reset_submissions" {
+					audited = true
+					g.Assert(entry.Data["module"]).Equal("audit")
+					g.Assert(entry.Data["actor_id"]).Equal(int64(1))
+					g.Assert(entry.Data["task_id"]).Equal(int64(1))
+				}
+			}
+			g.Assert(audited).IsTrue()
+		})
+
+		g.It("Admins can delete all submissions of a task stored in the directory of the course", func() {
+			courseUploads, err := ioutil.TempDir("", "course-uploads")
+			g.Assert(err).Equal(nil)
+			defer os.RemoveAll(courseUploads)
+
+			defer func() {
+				configuration.Configuration.Server.Paths.CourseUploads = nil
+			}()
+			configuration.Configuration.Server.Paths.CourseUploads = map[int64]string{1: courseUploads}
+
+			sheet, err := stores.Task.IdentifySheetOfTask(1)
+			g.Assert(err).Equal(nil)
+			sheet.PublishAt = NowUTC().Add(-time.Hour)
+			sheet.DueAt = NowUTC().Add(time.Hour)
+			err = stores.Sheet.Update(sheet)
+			g.Assert(err).Equal(nil)
+
+			filename := fmt.Sprintf("%s/empty.zip", configuration.Configuration.Server.Debugging.Fixtures)
+			w, err := tape.Upload("/api/v1/courses/1/tasks/1/submission", filename, "application/zip", studentJWT)
+			g.Assert(err).Equal(nil)
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			submission, err := stores.Submission.GetByUserAndTask(112, 1)
+			g.Assert(err).Equal(nil)
+			submissionPath := fmt.Sprintf("%s/submissions/%d.zip", courseUploads, submission.ID)
+			g.Assert(helper.FileExists(submissionPath)).IsTrue()
+
+			w = tape.Delete("/api/v1/courses/1/tasks/1/submissions?confirm=true&archive=true", adminJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			resp := TaskResetResponse{}
+			err = json.NewDecoder(w.Body).Decode(&resp)
+			g.Assert(err).Equal(nil)
+
+			g.Assert(helper.FileExists(fmt.Sprintf("%s/generated/%s", courseUploads, resp.Archive))).IsTrue()
+			g.Assert(helper.FileExists(fmt.Sprintf("%s/%s", configuration.Configuration.Server.Paths.GeneratedFiles, resp.Archive))).IsFalse()
+			g.Assert(helper.FileExists(submissionPath)).IsFalse()
+			g.Assert(helper.FileExists(fmt.Sprintf("%s/submissions/history/%d", courseUploads, submission.ID))).IsFalse()
+		})
+
 		g.It("Students cannot upload solution (update) too late", func() {
 
 			defer helper.NewSubmissionFileHandle(3001).Delete()
@@ -346,6 +903,411 @@ func TestSubmission(t *testing.T) {
 
 		})
 
+		g.It("Owners can download their submission file with the original name", func() {
+			defer helper.NewSubmissionFileHandle(3001).Delete()
+
+			deadlineAt := NowUTC().Add(time.Hour)
+			publishedAt := NowUTC().Add(-time.Hour)
+
+			task, err := stores.Task.Get(1)
+			g.Assert(err).Equal(nil)
+			sheet, err := stores.Task.IdentifySheetOfTask(task.ID)
+			g.Assert(err).Equal(nil)
+
+			sheet.PublishAt = publishedAt
+			sheet.DueAt = deadlineAt
+			err = stores.Sheet.Update(sheet)
+			g.Assert(err).Equal(nil)
+
+			filename := fmt.Sprintf("%s/empty.zip", configuration.Configuration.Server.Debugging.Fixtures)
+			w, err := tape.Upload("/api/v1/courses/1/tasks/1/submission", filename, "application/zip", studentJWT)
+			g.Assert(err).Equal(nil)
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			w = tape.Get("/api/v1/submissions/3001/file")
+			g.Assert(w.Code).Equal(http.StatusUnauthorized)
+
+			w = tape.Get("/api/v1/submissions/3001/file", studentJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+			g.Assert(strings.Contains(w.Header().Get("Content-Disposition"), "empty.zip")).Equal(true)
+
+			w = tape.Get("/api/v1/submissions/3001/file", otherStudentJWT)
+			g.Assert(w.Code).Equal(http.StatusForbidden)
+
+			w = tape.Get("/api/v1/submissions/3001/file", tape.NewJWTRequest(1, true))
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			w = tape.Get("/api/v1/submissions/424242/file", studentJWT)
+			g.Assert(w.Code).Equal(http.StatusNotFound)
+		})
+
+		g.It("Should share submissions by signed urls", func() {
+			defer helper.NewSubmissionFileHandle(3001).Delete()
+
+			deadlineAt := NowUTC().Add(time.Hour)
+			publishedAt := NowUTC().Add(-time.Hour)
+
+			task, err := stores.Task.Get(1)
+			g.Assert(err).Equal(nil)
+			sheet, err := stores.Task.IdentifySheetOfTask(task.ID)
+			g.Assert(err).Equal(nil)
+
+			sheet.PublishAt = publishedAt
+			sheet.DueAt = deadlineAt
+			err = stores.Sheet.Update(sheet)
+			g.Assert(err).Equal(nil)
+
+			filename := fmt.Sprintf("%s/empty.zip", configuration.Configuration.Server.Debugging.Fixtures)
+			w, err := tape.Upload("/api/v1/courses/1/tasks/1/submission", filename, "application/zip", studentJWT)
+			g.Assert(err).Equal(nil)
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			w = tape.Post("/api/v1/courses/1/submissions/3001/share", H{})
+			g.Assert(w.Code).Equal(http.StatusUnauthorized)
+
+			w = tape.Post("/api/v1/courses/1/submissions/3001/share", H{}, otherStudentJWT)
+			g.Assert(w.Code).Equal(http.StatusForbidden)
+
+			w = tape.Post("/api/v1/courses/1/submissions/3001/share", H{}, studentJWT)
+			g.Assert(w.Code).Equal(http.StatusCreated)
+
+			link := SignedURLResponse{}
+			err = json.NewDecoder(w.Body).Decode(&link)
+			g.Assert(err).Equal(nil)
+			g.Assert(link.ExpiresAt.After(NowUTC())).IsTrue()
+
+			signedURL, err := url.Parse(link.URL)
+			g.Assert(err).Equal(nil)
+			g.Assert(signedURL.Path).Equal("/api/v1/courses/1/submissions/3001/file")
+
+			// a valid signature grants access without any token
+			w = tape.Get(signedURL.RequestURI())
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			// but only for reading
+			w = tape.Post(signedURL.RequestURI(), H{})
+			g.Assert(w.Code).Equal(http.StatusForbidden)
+
+			// the signature covers the path
+			tampered := strings.Replace(signedURL.RequestURI(), "/submissions/3001/", "/submissions/3002/", 1)
+			w = tape.Get(tampered)
+			g.Assert(w.Code).Equal(http.StatusUnauthorized)
+
+			// and the signer
+			query := signedURL.Query()
+			query.Set("signer", "1")
+			w = tape.Get(signedURL.Path + "?" + query.Encode())
+			g.Assert(w.Code).Equal(http.StatusUnauthorized)
+
+			// expired links are rejected
+			secret := configuration.Configuration.Server.Authentication.JWT.Secret
+			expired := authenticate.SignURL(secret, signedURL.Path, 112, NowUTC().Add(-2*time.Hour), NowUTC().Add(-time.Hour))
+			w = tape.Get(expired)
+			g.Assert(w.Code).Equal(http.StatusUnauthorized)
+
+			// signed urls act with the permissions of the signer
+			foreign := authenticate.SignURL(secret, signedURL.Path, 113, NowUTC(), NowUTC().Add(time.Hour))
+			w = tape.Get(foreign)
+			g.Assert(w.Code).Equal(http.StatusForbidden)
+		})
+
+		g.It("Should report the position in the grading queue", func() {
+			task, err := stores.Task.Get(1)
+			g.Assert(err).Equal(nil)
+			task.PublicDockerImage = null.StringFrom("ff")
+			task.PrivateDockerImage = null.String{}
+			err = stores.Task.Update(task)
+			g.Assert(err).Equal(nil)
+
+			// a submission whose result got lost does not block the queue
+			lost, err := stores.Submission.Create(&model.Submission{UserID: 115, TaskID: task.ID})
+			g.Assert(err).Equal(nil)
+			_, err = stores.Grade.Create(&model.Grade{
+				TutorID:      1,
+				SubmissionID: lost.ID,
+				EnqueuedAt:   null.TimeFrom(NowUTC().Add(-configuration.Configuration.Server.JobLeaseTimeout - time.Minute)),
+			})
+			g.Assert(err).Equal(nil)
+
+			// three queued submissions of different students
+			submissionIDs := []int64{}
+			gradeIDs := []int64{}
+			for k, userID := range []int64{112, 113, 114} {
+				submission, err := stores.Submission.Create(&model.Submission{UserID: userID, TaskID: task.ID})
+				g.Assert(err).Equal(nil)
+
+				grade, err := stores.Grade.Create(&model.Grade{
+					PublicTestLog:  "submission received and will be tested",
+					PrivateTestLog: "no unit tests for this task are available",
+					TutorID:        1,
+					SubmissionID:   submission.ID,
+					EnqueuedAt:     null.TimeFrom(NowUTC().Add(time.Duration(k) * time.Second)),
+				})
+				g.Assert(err).Equal(nil)
+
+				submissionIDs = append(submissionIDs, submission.ID)
+				gradeIDs = append(gradeIDs, grade.ID)
+			}
+
+			for k := range submissionIDs {
+				w := tape.Get(fmt.Sprintf("/api/v1/courses/1/submissions/%d/queue_position", submissionIDs[k]), adminJWT)
+				g.Assert(w.Code).Equal(http.StatusOK)
+
+				response := QueuePositionResponse{}
+				err = json.NewDecoder(w.Body).Decode(&response)
+				g.Assert(err).Equal(nil)
+				g.Assert(response.Status).Equal("queued")
+				g.Assert(response.Position.Int64).Equal(int64(k + 1))
+				// nothing was tested within the last hour
+				g.Assert(response.ETASeconds.Valid).Equal(false)
+			}
+
+			// the first one finishes, the others move up
+			_, err = tape.DB.Exec("UPDATE grades SET public_execution_state = 2, private_execution_state = 2, tested_at = $2 WHERE id = $1", gradeIDs[0], NowUTC())
+			g.Assert(err).Equal(nil)
+			_, err = tape.DB.Exec("UPDATE grades SET public_execution_state = 1 WHERE id = $1", gradeIDs[1])
+			g.Assert(err).Equal(nil)
+
+			response := QueuePositionResponse{}
+			w := tape.Get(fmt.Sprintf("/api/v1/courses/1/submissions/%d/queue_position", submissionIDs[0]), studentJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+			err = json.NewDecoder(w.Body).Decode(&response)
+			g.Assert(err).Equal(nil)
+			g.Assert(response.Status).Equal("done")
+			g.Assert(response.Position.Valid).Equal(false)
+
+			response = QueuePositionResponse{}
+			w = tape.Get(fmt.Sprintf("/api/v1/courses/1/submissions/%d/queue_position", submissionIDs[1]), adminJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+			err = json.NewDecoder(w.Body).Decode(&response)
+			g.Assert(err).Equal(nil)
+			g.Assert(response.Status).Equal("running")
+			g.Assert(response.Position.Int64).Equal(int64(1))
+
+			response = QueuePositionResponse{}
+			w = tape.Get(fmt.Sprintf("/api/v1/courses/1/submissions/%d/queue_position", submissionIDs[2]), adminJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+			err = json.NewDecoder(w.Body).Decode(&response)
+			g.Assert(err).Equal(nil)
+			g.Assert(response.Status).Equal("queued")
+			g.Assert(response.Position.Int64).Equal(int64(2))
+			// one test per hour
+			g.Assert(response.ETASeconds.Int64).Equal(int64(2 * 3600))
+
+			// students cannot see the queue position of others
+			w = tape.Get(fmt.Sprintf("/api/v1/courses/1/submissions/%d/queue_position", submissionIDs[0]), otherStudentJWT)
+			g.Assert(w.Code).Equal(http.StatusForbidden)
+		})
+
+		g.It("Should return the diff against the reference output only if enabled", func() {
+			task, err := stores.Task.Get(1)
+			g.Assert(err).Equal(nil)
+			task.ShowDiff = true
+			err = stores.Task.Update(task)
+			g.Assert(err).Equal(nil)
+
+			submission, err := stores.Submission.Create(&model.Submission{UserID: 112, TaskID: task.ID})
+			g.Assert(err).Equal(nil)
+
+			grade, err := stores.Grade.Create(&model.Grade{
+				TutorID:      1,
+				SubmissionID: submission.ID,
+			})
+			g.Assert(err).Equal(nil)
+
+			w := tape.Post(fmt.Sprintf("/api/v1/courses/1/grades/%d/public_result", grade.ID), H{
+				"log":    "some new logs",
+				"diff":   "-42\n+41",
+				"status": 0,
+			}, adminJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			url := fmt.Sprintf("/api/v1/courses/1/submissions/%d/diff", submission.ID)
+
+			response := SubmissionDiffResponse{}
+			w = tape.Get(url, studentJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+			err = json.NewDecoder(w.Body).Decode(&response)
+			g.Assert(err).Equal(nil)
+			g.Assert(response.SubmissionID).Equal(submission.ID)
+			g.Assert(response.Diff).Equal("-42\n+41")
+
+			// students cannot see the diff of others
+			w = tape.Get(url, otherStudentJWT)
+			g.Assert(w.Code).Equal(http.StatusForbidden)
+
+			// hidden from students once disabled
+			task.ShowDiff = false
+			err = stores.Task.Update(task)
+			g.Assert(err).Equal(nil)
+
+			w = tape.Get(url, studentJWT)
+			g.Assert(w.Code).Equal(http.StatusNotFound)
+
+			// tutors still see it
+			response = SubmissionDiffResponse{}
+			w = tape.Get(url, tutorJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+			err = json.NewDecoder(w.Body).Decode(&response)
+			g.Assert(err).Equal(nil)
+			g.Assert(response.Diff).Equal("-42\n+41")
+		})
+
+		g.It("Should compare the files of two submissions", func() {
+			a, err := stores.Submission.Create(&model.Submission{UserID: 112, TaskID: 1})
+			g.Assert(err).Equal(nil)
+			b, err := stores.Submission.Create(&model.Submission{UserID: 113, TaskID: 1})
+			g.Assert(err).Equal(nil)
+			defer helper.NewSubmissionFileHandle(a.ID).Delete()
+			defer helper.NewSubmissionFileHandle(b.ID).Delete()
+
+			writeArchive := func(filename string, files map[string]string) {
+				buf := new(bytes.Buffer)
+				zipWriter := zip.NewWriter(buf)
+				for name, content := range files {
+					writer, err := zipWriter.Create(name)
+					g.Assert(err).Equal(nil)
+					_, err = writer.Write([]byte(content))
+					g.Assert(err).Equal(nil)
+				}
+				g.Assert(zipWriter.Close()).Equal(nil)
+				g.Assert(ioutil.WriteFile(filename, buf.Bytes(), 0644)).Equal(nil)
+			}
+
+			writeArchive(helper.NewSubmissionFileHandle(a.ID).Path(), map[string]string{
+				"Main.java": "class Main {\n  int fib(int n) {\n    return n;\n  }\n}\n",
+				"README.md": "solution\n",
+				"notes.txt": "only in a\n",
+			})
+			writeArchive(helper.NewSubmissionFileHandle(b.ID).Path(), map[string]string{
+				"Main.java": "class Main {\n  int fib(int n) {\n    return fib(n - 1) + fib(n - 2);\n  }\n}\n",
+				"README.md": "solution\n",
+				"Util.java": "class Util {}\n",
+			})
+
+			url := fmt.Sprintf("/api/v1/courses/1/submissions/compare?a=%d&b=%d", a.ID, b.ID)
+
+			w := tape.Get(url, studentJWT)
+			g.Assert(w.Code).Equal(http.StatusForbidden)
+
+			w = tape.Get(url, tutorJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			response := SubmissionCompareResponse{}
+			err = json.NewDecoder(w.Body).Decode(&response)
+			g.Assert(err).Equal(nil)
+			g.Assert(response.A).Equal(a.ID)
+			g.Assert(response.B).Equal(b.ID)
+			g.Assert(len(response.Files)).Equal(4)
+
+			g.Assert(response.Files[0].Name).Equal("Main.java")
+			g.Assert(response.Files[0].Status).Equal("modified")
+			ops := []string{}
+			for _, line := range response.Files[0].Lines {
+				ops = append(ops, line.Op)
+			}
+			g.Assert(ops).Equal([]string{"=", "=", "-", "+", "=", "="})
+			g.Assert(response.Files[0].Lines[2].Text).Equal("    return n;")
+			g.Assert(response.Files[0].Lines[2].LineA.Int64).Equal(int64(3))
+			g.Assert(response.Files[0].Lines[2].LineB.Valid).Equal(false)
+			g.Assert(response.Files[0].Lines[3].Text).Equal("    return fib(n - 1) + fib(n - 2);")
+			g.Assert(response.Files[0].Lines[3].LineB.Int64).Equal(int64(3))
+
+			g.Assert(response.Files[1].Name).Equal("README.md")
+			g.Assert(response.Files[1].Status).Equal("unchanged")
+			g.Assert(len(response.Files[1].Lines)).Equal(0)
+			g.Assert(response.Files[2].Name).Equal("Util.java")
+			g.Assert(response.Files[2].Status).Equal("added")
+			g.Assert(response.Files[3].Name).Equal("notes.txt")
+			g.Assert(response.Files[3].Status).Equal("removed")
+
+			// both submissions are required
+			w = tape.Get(fmt.Sprintf("/api/v1/courses/1/submissions/compare?a=%d", a.ID), tutorJWT)
+			g.Assert(w.Code).Equal(http.StatusBadRequest)
+
+			// submissions of other courses cannot be compared
+			otherTaskID, err := DBGetInt(tape, `
+SELECT ts.task_id FROM task_sheet ts
+INNER JOIN sheet_course sc ON sc.sheet_id = ts.sheet_id
+WHERE sc.course_id = $1 LIMIT 1`, 2)
+			g.Assert(err).Equal(nil)
+			other, err := stores.Submission.Create(&model.Submission{UserID: 112, TaskID: int64(otherTaskID)})
+			g.Assert(err).Equal(nil)
+			defer helper.NewSubmissionFileHandle(other.ID).Delete()
+			writeArchive(helper.NewSubmissionFileHandle(other.ID).Path(), map[string]string{"Main.java": ""})
+
+			w = tape.Get(fmt.Sprintf("/api/v1/courses/1/submissions/compare?a=%d&b=%d", a.ID, other.ID), tutorJWT)
+			g.Assert(w.Code).Equal(http.StatusForbidden)
+		})
+
+		g.It("Should purge expired submission files but keep grades", func() {
+			retention := configuration.Configuration.Server.SubmissionRetention
+			defer func() { configuration.Configuration.Server.SubmissionRetention = retention }()
+			configuration.Configuration.Server.SubmissionRetention.Days = 30
+			configuration.Configuration.Server.SubmissionRetention.KeepGraded = true
+
+			filename := fmt.Sprintf("%s/empty.zip", configuration.Configuration.Server.Debugging.Fixtures)
+
+			// expired, expired but graded, recent
+			enqueuedAt := []time.Time{
+				NowUTC().Add(-40 * 24 * time.Hour),
+				NowUTC().Add(-40 * 24 * time.Hour),
+				NowUTC().Add(-10 * 24 * time.Hour),
+			}
+			feedback := []string{"", "well done", ""}
+
+			submissionIDs := []int64{}
+			gradeIDs := []int64{}
+			for k, userID := range []int64{112, 113, 114} {
+				submission, err := stores.Submission.Create(&model.Submission{UserID: userID, TaskID: 1})
+				g.Assert(err).Equal(nil)
+
+				grade, err := stores.Grade.Create(&model.Grade{
+					Feedback:     feedback[k],
+					TutorID:      1,
+					SubmissionID: submission.ID,
+					EnqueuedAt:   null.TimeFrom(enqueuedAt[k]),
+				})
+				g.Assert(err).Equal(nil)
+
+				_, err = copyFile(filename, helper.NewSubmissionFileHandle(submission.ID).Path())
+				g.Assert(err).Equal(nil)
+				defer helper.NewSubmissionFileHandle(submission.ID).Delete()
+
+				submissionIDs = append(submissionIDs, submission.ID)
+				gradeIDs = append(gradeIDs, grade.ID)
+			}
+
+			w := tape.Post("/api/v1/courses/1/submissions/purge", H{}, tutorJWT)
+			g.Assert(w.Code).Equal(http.StatusForbidden)
+
+			w = tape.Post("/api/v1/courses/1/submissions/purge", H{}, adminJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			response := SubmissionPurgeResponse{}
+			err := json.NewDecoder(w.Body).Decode(&response)
+			g.Assert(err).Equal(nil)
+			g.Assert(response.Deleted).Equal(1)
+
+			g.Assert(helper.NewSubmissionFileHandle(submissionIDs[0]).Exists()).Equal(false)
+			g.Assert(helper.NewSubmissionFileHandle(submissionIDs[1]).Exists()).Equal(true)
+			g.Assert(helper.NewSubmissionFileHandle(submissionIDs[2]).Exists()).Equal(true)
+
+			// grades remain
+			for _, gradeID := range gradeIDs {
+				_, err := stores.Grade.Get(gradeID)
+				g.Assert(err).Equal(nil)
+			}
+
+			// without keeping graded submissions
+			configuration.Configuration.Server.SubmissionRetention.KeepGraded = false
+			deleted, err := PurgeExpiredSubmissionFiles(stores, 1)
+			g.Assert(err).Equal(nil)
+			g.Assert(deleted).Equal(1)
+			g.Assert(helper.NewSubmissionFileHandle(submissionIDs[1]).Exists()).Equal(false)
+			g.Assert(helper.NewSubmissionFileHandle(submissionIDs[2]).Exists()).Equal(true)
+		})
+
 		g.It("Admins can upload solution for a student (even if it is too late)", func() {
 
 			studentJWT := tape.NewJWTRequest(112, false)
@@ -416,7 +1378,7 @@ func TestSubmission(t *testing.T) {
 			err := json.NewDecoder(w.Body).Decode(&submissionsAllActual)
 			g.Assert(err).Equal(nil)
 
-			w = tape.Get("/api/v1/courses/1/submissions?group_id=4", tutorJWT)
+			w = tape.Get("/api/v1/courses/1/submissions?group_id=4", adminJWT)
 			g.Assert(w.Code).Equal(http.StatusOK)
 
 			submissionsG4Actual := []SubmissionResponse{}
@@ -447,6 +1409,209 @@ func TestSubmission(t *testing.T) {
 
 		})
 
+		g.It("Should filter the submissions of a task by their status", func() {
+			_, err := tape.DB.Exec(`UPDATE grades SET feedback = '', acquired_points = 0,
+public_execution_state = 0, private_execution_state = 0, public_test_status = 0, private_test_status = 0
+WHERE submission_id IN (SELECT id FROM submissions WHERE task_id = 1)`)
+			g.Assert(err).Equal(nil)
+
+			submissionIDs := []int64{}
+			err = tape.DB.Select(&submissionIDs, "SELECT id FROM submissions WHERE task_id = 1 ORDER BY id")
+			g.Assert(err).Equal(nil)
+			g.Assert(len(submissionIDs) > 3).IsTrue()
+
+			gradedID, failedID := submissionIDs[0], submissionIDs[1]
+			_, err = tape.DB.Exec("UPDATE grades SET feedback = 'well done' WHERE submission_id = $1", gradedID)
+			g.Assert(err).Equal(nil)
+			_, err = tape.DB.Exec("UPDATE grades SET public_execution_state = 2, public_test_status = 1 WHERE submission_id = $1", failedID)
+			g.Assert(err).Equal(nil)
+
+			query := func(url string) []SubmissionStatusResponse {
+				w := tape.Get(url, adminJWT)
+				g.Assert(w.Code).Equal(http.StatusOK)
+				submissions := []SubmissionStatusResponse{}
+				err := json.NewDecoder(w.Body).Decode(&submissions)
+				g.Assert(err).Equal(nil)
+				return submissions
+			}
+
+			all := query("/api/v1/courses/1/tasks/1/submissions")
+			g.Assert(len(all)).Equal(len(submissionIDs))
+
+			graded := query("/api/v1/courses/1/tasks/1/submissions?status=graded")
+			g.Assert(len(graded)).Equal(1)
+			g.Assert(graded[0].ID).Equal(gradedID)
+			g.Assert(graded[0].Status).Equal("graded")
+
+			failed := query("/api/v1/courses/1/tasks/1/submissions?status=error")
+			g.Assert(len(failed)).Equal(1)
+			g.Assert(failed[0].ID).Equal(failedID)
+			g.Assert(failed[0].Status).Equal("error")
+
+			pending := query("/api/v1/courses/1/tasks/1/submissions?status=pending")
+			g.Assert(len(pending)).Equal(len(submissionIDs) - 2)
+			for _, submission := range pending {
+				g.Assert(submission.Status).Equal("pending")
+				g.Assert(submission.ID != gradedID && submission.ID != failedID).IsTrue()
+			}
+
+			page := query("/api/v1/courses/1/tasks/1/submissions?status=pending&per_page=2")
+			g.Assert(len(page)).Equal(2)
+			g.Assert(page[0].ID).Equal(pending[0].ID)
+
+			w := tape.Get("/api/v1/courses/1/tasks/1/submissions?status=unknown", adminJWT)
+			g.Assert(w.Code).Equal(http.StatusBadRequest)
+
+			w = tape.Get("/api/v1/courses/1/tasks/1/submissions", studentJWT)
+			g.Assert(w.Code).Equal(http.StatusForbidden)
+
+			// tutors only get the submissions of their own groups
+			numberExpected, err := DBGetInt(
+				tape,
+				`SELECT count(DISTINCT s.id) FROM submissions s
+INNER JOIN user_group ug ON ug.user_id = s.user_id
+INNER JOIN groups g ON g.id = ug.group_id
+WHERE g.tutor_id = 2 AND s.task_id = $1`,
+				1,
+			)
+			g.Assert(err).Equal(nil)
+
+			w = tape.Get("/api/v1/courses/1/tasks/1/submissions", tutorJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+			submissionsOfTutor := []SubmissionStatusResponse{}
+			err = json.NewDecoder(w.Body).Decode(&submissionsOfTutor)
+			g.Assert(err).Equal(nil)
+			g.Assert(len(submissionsOfTutor)).Equal(numberExpected)
+		})
+
+		g.It("Tutors only see the submissions of their own groups", func() {
+			numberExpected, err := DBGetInt(
+				tape,
+				`SELECT count(DISTINCT s.id) FROM submissions s
+INNER JOIN user_group ug ON ug.user_id = s.user_id
+INNER JOIN groups g ON g.id = ug.group_id
+WHERE g.tutor_id = 2 AND g.course_id = $1`,
+				1,
+			)
+			g.Assert(err).Equal(nil)
+			g.Assert(numberExpected > 0).IsTrue()
+
+			w := tape.Get("/api/v1/courses/1/submissions", tutorJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+			submissionsActual := []SubmissionResponse{}
+			err = json.NewDecoder(w.Body).Decode(&submissionsActual)
+			g.Assert(err).Equal(nil)
+			g.Assert(len(submissionsActual)).Equal(numberExpected)
+
+			for _, submission := range submissionsActual {
+				groupsOfTutor, err := DBGetInt(
+					tape,
+					`SELECT count(*) FROM user_group ug
+INNER JOIN groups g ON g.id = ug.group_id
+WHERE g.tutor_id = 2 AND ug.user_id = $1`,
+					submission.UserID,
+				)
+				g.Assert(err).Equal(nil)
+				g.Assert(groupsOfTutor > 0).IsTrue()
+			}
+
+			// admins see all submissions
+			w = tape.Get("/api/v1/courses/1/submissions", adminJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+			submissionsAll := []SubmissionResponse{}
+			err = json.NewDecoder(w.Body).Decode(&submissionsAll)
+			g.Assert(err).Equal(nil)
+			g.Assert(len(submissionsAll) > len(submissionsActual)).IsTrue()
+
+			otherGroupID, err := DBGetInt(
+				tape,
+				"SELECT id FROM groups WHERE course_id = $1 AND tutor_id <> 2 ORDER BY id LIMIT 1",
+				1,
+			)
+			g.Assert(err).Equal(nil)
+			w = tape.Get(fmt.Sprintf("/api/v1/courses/1/submissions?group_id=%d", otherGroupID), tutorJWT)
+			g.Assert(w.Code).Equal(http.StatusForbidden)
+		})
+
+		g.It("Should regrade all submissions of a task", func() {
+			task, err := stores.Task.Get(1)
+			g.Assert(err).Equal(nil)
+			task.PublicDockerImage = null.StringFrom("ff")
+			task.PrivateDockerImage = null.StringFrom("ff")
+			err = stores.Task.Update(task)
+			g.Assert(err).Equal(nil)
+
+			src := fmt.Sprintf("%s/empty.zip", configuration.Configuration.Server.Debugging.Fixtures)
+			copyFile(src, helper.NewPublicTestFileHandle(task.ID).Path())
+			defer helper.NewPublicTestFileHandle(task.ID).Delete()
+			copyFile(src, helper.NewPrivateTestFileHandle(task.ID).Path())
+			defer helper.NewPrivateTestFileHandle(task.ID).Delete()
+
+			submissions, err := stores.Submission.GetFiltered(1, 0, 0, 0, task.ID)
+			g.Assert(err).Equal(nil)
+			g.Assert(len(submissions) > 0).IsTrue()
+			for _, submission := range submissions {
+				copyFile(src, helper.NewSubmissionFileHandle(submission.ID).Path())
+				defer helper.NewSubmissionFileHandle(submission.ID).Delete()
+			}
+
+			// a submission graded by a tutor
+			gradedBefore, err := stores.Grade.GetForSubmission(submissions[0].ID)
+			g.Assert(err).Equal(nil)
+			gradedBefore.AcquiredPoints = 1
+			gradedBefore.Feedback = "graded by tutor"
+			gradedBefore.GradedAt = null.TimeFrom(NowUTC())
+			g.Assert(stores.Grade.Update(gradedBefore)).Equal(nil)
+
+			producer := DefaultSubmissionProducer
+			DefaultSubmissionProducer = &fakeGrader{tape: tape}
+			defer func() { DefaultSubmissionProducer = producer }()
+
+			url := fmt.Sprintf("/api/v1/courses/1/tasks/%d/regrade", task.ID)
+
+			w := tape.Post(url, H{}, studentJWT)
+			g.Assert(w.Code).Equal(http.StatusForbidden)
+
+			w = tape.Post(url, H{}, adminJWT)
+			g.Assert(w.Code).Equal(http.StatusAccepted)
+
+			progress := &RegradeResponse{}
+			err = json.NewDecoder(w.Body).Decode(progress)
+			g.Assert(err).Equal(nil)
+			g.Assert(progress.Total).Equal(len(submissions))
+
+			// wait for the background regrade
+			for deadline := time.Now().Add(30 * time.Second); time.Now().Before(deadline); {
+				w = tape.Get(url, adminJWT)
+				g.Assert(w.Code).Equal(http.StatusOK)
+
+				progress = &RegradeResponse{}
+				err = json.NewDecoder(w.Body).Decode(progress)
+				g.Assert(err).Equal(nil)
+				if !progress.Running {
+					break
+				}
+				time.Sleep(50 * time.Millisecond)
+			}
+
+			g.Assert(progress.Running).IsFalse()
+			g.Assert(progress.Failed).Equal(0)
+			g.Assert(progress.Enqueued).Equal(len(submissions))
+			g.Assert(progress.Tested).Equal(len(submissions))
+
+			for _, submission := range submissions {
+				grade, err := stores.Grade.GetForSubmission(submission.ID)
+				g.Assert(err).Equal(nil)
+				g.Assert(grade.PublicTestLog).Equal("graded by fake grader")
+				g.Assert(grade.PrivateTestLog).Equal("graded by fake grader")
+			}
+
+			gradedAfter, err := stores.Grade.GetForSubmission(submissions[0].ID)
+			g.Assert(err).Equal(nil)
+			g.Assert(gradedAfter.AcquiredPoints).Equal(1)
+			g.Assert(gradedAfter.Feedback).Equal("graded by tutor")
+		})
+
 		g.AfterEach(func() {
 			tape.AfterEach()
 		})
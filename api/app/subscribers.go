@@ -0,0 +1,143 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package app
+
+import (
+	"fmt"
+
+	"github.com/infomark-org/infomark/configuration"
+	"github.com/infomark-org/infomark/event"
+	"github.com/infomark-org/infomark/webhook"
+)
+
+// RegisterSubscribers connects the side effects (metrics, emails, webhooks)
+// to the events published by the handlers.
+func RegisterSubscribers(bus *event.Bus, stores *Stores) {
+	registerMetricSubscribers(bus)
+	registerJobSubscribers(bus)
+	registerEmailSubscribers(bus, stores)
+	registerWebhookSubscribers(bus, stores)
+	registerEnrollmentSubscribers(bus, stores)
+	registerActivitySubscribers(bus, stores)
+}
+
+func registerMetricSubscribers(bus *event.Bus) {
+	bus.Subscribe(event.LoginFailed{}.Name(), func(e event.Event) error {
+		totalFailedLoginsVec.WithLabelValues().Inc()
+		return nil
+	})
+
+	bus.Subscribe(event.SubmissionCreated{}.Name(), func(e event.Event) error {
+		ev := e.(event.SubmissionCreated)
+		totalSubmissionCounterVec.WithLabelValues(fmt.Sprintf("%d", ev.TaskID)).Inc()
+		return nil
+	})
+
+	bus.Subscribe(event.TestResultReceived{}.Name(), func(e event.Event) error {
+		ev := e.(event.TestResultReceived)
+		taskID := fmt.Sprintf("%d", ev.TaskID)
+
+		if ev.Success {
+			totalDockerSuccessExitCounterVec.WithLabelValues(taskID, ev.Kind).Inc()
+		} else if ev.TimedOut {
+			totalDockerFailExitCounterVec.WithLabelValues(taskID, "timeout").Inc()
+		} else {
+			totalDockerFailExitCounterVec.WithLabelValues(taskID, ev.Kind).Inc()
+		}
+
+		totalDockerTimeHist.WithLabelValues(taskID, ev.Kind).Observe(ev.FinishedAt.Sub(ev.EnqueuedAt).Seconds())
+		totalDockerRunTimeHist.WithLabelValues(taskID, ev.Kind).Observe(ev.FinishedAt.Sub(ev.StartedAt).Seconds())
+		totalDockerWaitTimeHist.WithLabelValues(taskID, ev.Kind).Observe(ev.StartedAt.Sub(ev.EnqueuedAt).Seconds())
+		return nil
+	})
+}
+
+func registerJobSubscribers(bus *event.Bus) {
+	// each result of a worker frees a slot for the next grading job, even if
+	// the result itself is discarded
+	jobDone := func(e event.Event) error {
+		if producer, ok := DefaultSubmissionProducer.(*LimitedProducer); ok {
+			return producer.Done()
+		}
+		return nil
+	}
+	bus.Subscribe(event.TestResultReceived{}.Name(), jobDone)
+	bus.Subscribe(event.TestResultDiscarded{}.Name(), jobDone)
+}
+
+func registerEmailSubscribers(bus *event.Bus, stores *Stores) {
+	bus.Subscribe(event.UserRegistered{}.Name(), func(e event.Event) error {
+		if configuration.Configuration.Server.Debugging.Enabled {
+			return nil
+		}
+		return sendConfirmEmailForUser(stores, configuration.Configuration.Server.Email.From, e.(event.UserRegistered).User)
+	})
+
+	bus.Subscribe(event.EmailChanged{}.Name(), func(e event.Event) error {
+		return sendConfirmEmailForUser(stores, configuration.Configuration.Server.Email.From, e.(event.EmailChanged).User)
+	})
+
+	bus.Subscribe(event.SubmissionGraded{}.Name(), func(e event.Event) error {
+		// corrections of a grade do not notify the student again
+		ev := e.(event.SubmissionGraded)
+		if !ev.First {
+			return nil
+		}
+		return notifySubmissionGraded(stores, ev.Grade)
+	})
+
+	bus.Subscribe(event.GradesPublished{}.Name(), func(e event.Event) error {
+		return notifyGradesPublished(stores, e.(event.GradesPublished).Sheet)
+	})
+
+	bus.Subscribe(event.EnrollmentRoleChanged{}.Name(), func(e event.Event) error {
+		ev := e.(event.EnrollmentRoleChanged)
+		return notifyEnrollmentRoleChanged(stores, ev.Course, ev.User, ev.Role)
+	})
+}
+
+func registerWebhookSubscribers(bus *event.Bus, stores *Stores) {
+	bus.Subscribe(event.SubmissionGraded{}.Name(), func(e event.Event) error {
+		ev := e.(event.SubmissionGraded)
+		dispatchWebhooks(stores, ev.CourseID, webhook.EventSubmissionGraded, newGradeResponse(ev.Grade, ev.CourseID))
+		return nil
+	})
+
+	bus.Subscribe(event.EnrollmentCreated{}.Name(), func(e event.Event) error {
+		ev := e.(event.EnrollmentCreated)
+		dispatchWebhooks(stores, ev.CourseID, webhook.EventEnrollmentCreated, newEnrollmentResponse(ev.Enrollment))
+		return nil
+	})
+}
+
+func registerEnrollmentSubscribers(bus *event.Bus, stores *Stores) {
+	bus.Subscribe(event.UserConfirmed{}.Name(), func(e event.Event) error {
+		return autoEnrollUser(bus, stores, e.(event.UserConfirmed).User)
+	})
+}
+
+func registerActivitySubscribers(bus *event.Bus, stores *Stores) {
+	// logins are only part of the activity if the history is enabled
+	bus.Subscribe(event.LoginSucceeded{}.Name(), func(e event.Event) error {
+		days := configuration.Configuration.Server.LoginHistory.Days
+		if days <= 0 {
+			return nil
+		}
+		return stores.User.AddLogin(e.(event.LoginSucceeded).UserID, days)
+	})
+}
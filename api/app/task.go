@@ -76,6 +76,54 @@ func (rs *TaskResource) IndexHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// StatusIndexHandler is public endpoint for
+// URL: /courses/{course_id}/sheets/{sheet_id}/tasks/status
+// URLPARAM: course_id,integer
+// URLPARAM: sheet_id,integer
+// METHOD: get
+// TAG: tasks
+// RESPONSE: 200,TaskStatusResponseList
+// RESPONSE: 400,BadRequest
+// RESPONSE: 401,Unauthenticated
+// RESPONSE: 403,Unauthorized
+// SUMMARY:  Get all tasks of a given sheet with the state of the submissions
+// DESCRIPTION:
+// Students get their latest submission and points per task, unless the grades
+// of the sheet are not published yet. Tutors and admins get the number of
+// students who submitted and their average points instead.
+func (rs *TaskResource) StatusIndexHandler(w http.ResponseWriter, r *http.Request) {
+	accessClaims := r.Context().Value(symbol.CtxKeyAccessClaims).(*authenticate.AccessClaims)
+	givenRole := r.Context().Value(symbol.CtxKeyCourseRole).(authorize.CourseRole)
+	sheet := r.Context().Value(symbol.CtxKeySheet).(*model.Sheet)
+
+	if givenRole == authorize.STUDENT {
+		statuses, err := rs.Stores.Task.TaskStatusesOfSheet(sheet.ID, accessClaims.LoginID)
+		if err != nil {
+			render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+			return
+		}
+
+		// render JSON response
+		if err = render.RenderList(w, r, newTaskStatusListResponse(statuses, sheet.GradesPublished)); err != nil {
+			render.Render(w, r, ErrRender(err))
+			return
+		}
+		return
+	}
+
+	summaries, err := rs.Stores.Task.TaskSummariesOfSheet(sheet.ID)
+	if err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
+	// render JSON response
+	if err = render.RenderList(w, r, newTaskSummaryListResponse(summaries)); err != nil {
+		render.Render(w, r, ErrRender(err))
+		return
+	}
+}
+
 // MissingIndexHandler is public endpoint for
 // URL: /courses/{course_id}/tasks/missing
 // URLPARAM: course_id,integer
@@ -136,6 +184,11 @@ func (rs *TaskResource) CreateHandler(w http.ResponseWriter, r *http.Request) {
 		MaxPoints:          data.MaxPoints,
 		PublicDockerImage:  null.StringFrom(data.PublicDockerImage),
 		PrivateDockerImage: null.StringFrom(data.PrivateDockerImage),
+		TimeoutSeconds:     data.TimeoutSeconds,
+		AllowNetwork:       data.AllowNetwork,
+		ShowDiff:           data.ShowDiff,
+		ScoringPolicy:      null.NewString(data.ScoringPolicy, data.ScoringPolicy != ""),
+		Description:        data.Description,
 	}
 
 	// create Task entry in database
@@ -166,12 +219,18 @@ func (rs *TaskResource) CreateHandler(w http.ResponseWriter, r *http.Request) {
 // RESPONSE: 401,Unauthenticated
 // RESPONSE: 403,Unauthorized
 // SUMMARY:  get a specific task
+// DESCRIPTION:
+// Besides the Markdown source, the description is returned as HTML in
+// "description_html". Raw HTML (e.g. scripts) and unsafe links are removed.
 func (rs *TaskResource) GetHandler(w http.ResponseWriter, r *http.Request) {
 	// `Task` is retrieved via middle-ware
 	task := r.Context().Value(symbol.CtxKeyTask).(*model.Task)
 
+	resp := newTaskResponse(task)
+	resp.DescriptionHTML = helper.RenderMarkdown(task.Description)
+
 	// render JSON response
-	if err := render.Render(w, r, newTaskResponse(task)); err != nil {
+	if err := render.Render(w, r, resp); err != nil {
 		render.Render(w, r, ErrRender(err))
 		return
 	}
@@ -206,6 +265,12 @@ func (rs *TaskResource) EditHandler(w http.ResponseWriter, r *http.Request) {
 	task.MaxPoints = data.MaxPoints
 	task.PublicDockerImage = null.StringFrom(data.PublicDockerImage)
 	task.PrivateDockerImage = null.StringFrom(data.PrivateDockerImage)
+	task.TimeoutSeconds = data.TimeoutSeconds
+	task.AllowNetwork = data.AllowNetwork
+	task.ShowDiff = data.ShowDiff
+	// an empty policy falls back to the policy of the sheet
+	task.ScoringPolicy = null.NewString(data.ScoringPolicy, data.ScoringPolicy != "")
+	task.Description = data.Description
 
 	// update database entry
 	if err := rs.Stores.Task.Update(task); err != nil {
@@ -246,10 +311,14 @@ func (rs *TaskResource) DeleteHandler(w http.ResponseWriter, r *http.Request) {
 // METHOD: get
 // TAG: tasks
 // RESPONSE: 200,ZipFile
+// RESPONSE: 304,NotModified
 // RESPONSE: 400,BadRequest
 // RESPONSE: 401,Unauthenticated
 // RESPONSE: 403,Unauthorized
 // SUMMARY:  get the zip with the testing framework for the public tests
+// DESCRIPTION:
+// The response carries an ETag derived from the content of the file. Requests
+// with a matching "If-None-Match" header are answered with 304.
 func (rs *TaskResource) GetPublicTestFileHandler(w http.ResponseWriter, r *http.Request) {
 
 	task := r.Context().Value(symbol.CtxKeyTask).(*model.Task)
@@ -260,6 +329,10 @@ func (rs *TaskResource) GetPublicTestFileHandler(w http.ResponseWriter, r *http.
 		return
 	}
 
+	if fileNotModified(w, r, hnd) {
+		return
+	}
+
 	if err := hnd.WriteToBody(w); err != nil {
 		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
 	}
@@ -273,10 +346,14 @@ func (rs *TaskResource) GetPublicTestFileHandler(w http.ResponseWriter, r *http.
 // METHOD: get
 // TAG: tasks
 // RESPONSE: 200,ZipFile
+// RESPONSE: 304,NotModified
 // RESPONSE: 400,BadRequest
 // RESPONSE: 401,Unauthenticated
 // RESPONSE: 403,Unauthorized
 // SUMMARY:  get the zip with the testing framework for the private tests
+// DESCRIPTION:
+// The response carries an ETag derived from the content of the file. Requests
+// with a matching "If-None-Match" header are answered with 304.
 func (rs *TaskResource) GetPrivateTestFileHandler(w http.ResponseWriter, r *http.Request) {
 
 	task := r.Context().Value(symbol.CtxKeyTask).(*model.Task)
@@ -287,6 +364,10 @@ func (rs *TaskResource) GetPrivateTestFileHandler(w http.ResponseWriter, r *http
 		return
 	}
 
+	if fileNotModified(w, r, hnd) {
+		return
+	}
+
 	if err := hnd.WriteToBody(w); err != nil {
 		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
 	}
@@ -341,6 +422,66 @@ func (rs *TaskResource) ChangePrivateTestFileHandler(w http.ResponseWriter, r *h
 	render.Status(r, http.StatusOK)
 }
 
+// GetStarterFileHandler is public endpoint for
+// URL: /courses/{course_id}/tasks/{task_id}/starter_file
+// URLPARAM: course_id,integer
+// URLPARAM: task_id,integer
+// METHOD: get
+// TAG: tasks
+// RESPONSE: 200,ZipFile
+// RESPONSE: 304,NotModified
+// RESPONSE: 400,BadRequest
+// RESPONSE: 401,Unauthenticated
+// RESPONSE: 403,Unauthorized
+// RESPONSE: 404,NotFound
+// SUMMARY:  get the zip with the starter code of a task
+// DESCRIPTION:
+// The starter file is optional and independent of the public tests. Every
+// enrolled user can download it once the sheet is published. The response
+// carries an ETag derived from the content of the file.
+func (rs *TaskResource) GetStarterFileHandler(w http.ResponseWriter, r *http.Request) {
+
+	task := r.Context().Value(symbol.CtxKeyTask).(*model.Task)
+	hnd := helper.NewStarterFileHandle(task.ID)
+
+	if !hnd.Exists() {
+		render.Render(w, r, ErrNotFound)
+		return
+	}
+
+	if fileNotModified(w, r, hnd) {
+		return
+	}
+
+	if err := hnd.WriteToBody(w); err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+	}
+
+}
+
+// ChangeStarterFileHandler is public endpoint for
+// URL: /courses/{course_id}/tasks/{task_id}/starter_file
+// URLPARAM: course_id,integer
+// URLPARAM: task_id,integer
+// METHOD: post
+// TAG: tasks
+// REQUEST: Zipfile
+// RESPONSE: 204,NoContent
+// RESPONSE: 400,BadRequest
+// RESPONSE: 401,Unauthenticated
+// RESPONSE: 403,Unauthorized
+// SUMMARY:  change the zip with the starter code of a task
+func (rs *TaskResource) ChangeStarterFileHandler(w http.ResponseWriter, r *http.Request) {
+	// will always be a POST
+	task := r.Context().Value(symbol.CtxKeyTask).(*model.Task)
+
+	if _, err := helper.NewStarterFileHandle(task.ID).WriteToDisk(r, "file_data"); err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+	render.Status(r, http.StatusOK)
+}
+
 // GetSubmissionResultHandler is public endpoint for
 // URL: /courses/{course_id}/tasks/{task_id}/result
 // URLPARAM: course_id,integer
@@ -352,6 +493,9 @@ func (rs *TaskResource) ChangePrivateTestFileHandler(w http.ResponseWriter, r *h
 // RESPONSE: 401,Unauthenticated
 // RESPONSE: 403,Unauthorized
 // SUMMARY:  the the public results (grades) for a test and the request identity
+// DESCRIPTION:
+// While the grades of the sheet are not published, the points and feedback are
+// withheld and "grading_in_progress" is true.
 func (rs *TaskResource) GetSubmissionResultHandler(w http.ResponseWriter, r *http.Request) {
 	givenRole := r.Context().Value(symbol.CtxKeyCourseRole).(authorize.CourseRole)
 	course := r.Context().Value(symbol.CtxKeyCourse).(*model.Course)
@@ -380,8 +524,66 @@ func (rs *TaskResource) GetSubmissionResultHandler(w http.ResponseWriter, r *htt
 	grade.PrivateTestStatus = -1
 	grade.PrivateTestLog = ""
 
+	resp := newGradeResponse(grade, course.ID)
+
+	// points and feedback are withheld until the grades of the sheet are published
+	sheet := r.Context().Value(symbol.CtxKeySheet).(*model.Sheet)
+	if !sheet.GradesPublished {
+		resp.AcquiredPoints = 0
+		resp.Feedback = ""
+		resp.GradingInProgress = true
+	}
+
+	publicTestCases, err := rs.Stores.Grade.TestCasesOfGrade(grade.ID, "public")
+	if err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+	// details of hidden test cases would allow to game the tests
+	resp.PublicTestCases = newTestCaseListResponse(publicTestCases, givenRole)
+	resp.HiddenTestCases = newHiddenTestCaseResponse(publicTestCases)
+
+	// render JSON response
+	if err := render.Render(w, r, resp); err != nil {
+		render.Render(w, r, ErrRender(err))
+		return
+	}
+
+	render.Status(r, http.StatusOK)
+}
+
+// StatisticsHandler is public endpoint for
+// URL: /courses/{course_id}/tasks/{task_id}/stats
+// URLPARAM: course_id,integer
+// URLPARAM: task_id,integer
+// METHOD: get
+// TAG: tasks
+// RESPONSE: 200,TaskStatisticsResponse
+// RESPONSE: 400,BadRequest
+// RESPONSE: 401,Unauthenticated
+// RESPONSE: 403,Unauthorized
+// SUMMARY:  statistics about the submissions of all students for a task
+// DESCRIPTION:
+// Only the latest submission of each student is considered. A submission
+// passes if it acquired at least half of the points.
+func (rs *TaskResource) StatisticsHandler(w http.ResponseWriter, r *http.Request) {
+	// `Task` is retrieved via middle-ware
+	task := r.Context().Value(symbol.CtxKeyTask).(*model.Task)
+
+	statistics, err := rs.Stores.Task.GetStatistics(task.ID)
+	if err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
+	histogram, err := rs.Stores.Task.GetPointsHistogram(task.ID)
+	if err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
 	// render JSON response
-	if err := render.Render(w, r, newGradeResponse(grade, course.ID)); err != nil {
+	if err := render.Render(w, r, newTaskStatisticsResponse(statistics, histogram)); err != nil {
 		render.Render(w, r, ErrRender(err))
 		return
 	}
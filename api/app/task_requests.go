@@ -24,6 +24,7 @@ import (
 	"net/http"
 
 	validation "github.com/go-ozzo/ozzo-validation"
+	"github.com/infomark-org/infomark/symbol"
 )
 
 // TaskRequest is the request payload for Task management.
@@ -32,6 +33,11 @@ type TaskRequest struct {
 	Name               string `json:"name" example:"Task 1"`
 	PublicDockerImage  string `json:"public_docker_image" example:"DefaultJavaTestingImage"`
 	PrivateDockerImage string `json:"private_docker_image" example:"DefaultJavaTestingImage"`
+	TimeoutSeconds     int    `json:"timeout_seconds" example:"60" required:"false"`
+	AllowNetwork       bool   `json:"allow_network" example:"false" required:"false"`
+	ShowDiff           bool   `json:"show_diff" example:"false" required:"false"`
+	ScoringPolicy      string `json:"scoring_policy" example:"best" required:"false"`
+	Description        string `json:"description" example:"Implement *fib* in **Java**." required:"false"`
 }
 
 // Bind preprocesses a TaskRequest.
@@ -53,5 +59,13 @@ func (body *TaskRequest) Validate() error {
 			&body.Name,
 			validation.Required,
 		),
+		validation.Field(
+			&body.TimeoutSeconds,
+			validation.Min(0),
+		),
+		validation.Field(
+			&body.ScoringPolicy,
+			validation.In(symbol.ScoringPolicyLatest, symbol.ScoringPolicyBest),
+		),
 	)
 }
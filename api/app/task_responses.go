@@ -30,13 +30,20 @@ import (
 
 // .............................................................................
 
-// TaskResponse is the response payload for Task management.
+// TaskResponse is the response payload for Task management. The description
+// is Markdown, a single task additionally contains it as sanitized HTML.
 type TaskResponse struct {
 	ID                 int64       `json:"id" example:"684"`
 	Name               string      `json:"name" example:"Task 1"`
 	MaxPoints          int         `json:"max_points" example:"23"`
 	PublicDockerImage  null.String `json:"public_docker_image" example:"DefaultJavaTestingImage"`
 	PrivateDockerImage null.String `json:"private_docker_image" example:"DefaultJavaTestingImage"`
+	TimeoutSeconds     int         `json:"timeout_seconds" example:"60"`
+	AllowNetwork       bool        `json:"allow_network" example:"false"`
+	ShowDiff           bool        `json:"show_diff" example:"false"`
+	ScoringPolicy      null.String `json:"scoring_policy" example:"best"`
+	Description        string      `json:"description" example:"Implement *fib* in **Java**."`
+	DescriptionHTML    string      `json:"description_html,omitempty" example:"<p>Implement <em>fib</em> in <strong>Java</strong>.</p>" required:"false"`
 }
 
 // newTaskResponse creates a response from a Task model.
@@ -47,6 +54,11 @@ func newTaskResponse(p *model.Task) *TaskResponse {
 		MaxPoints:          p.MaxPoints,
 		PublicDockerImage:  p.PublicDockerImage,
 		PrivateDockerImage: p.PrivateDockerImage,
+		TimeoutSeconds:     p.TimeoutSeconds,
+		AllowNetwork:       p.AllowNetwork,
+		ShowDiff:           p.ShowDiff,
+		ScoringPolicy:      p.ScoringPolicy,
+		Description:        p.Description,
 	}
 }
 
@@ -64,6 +76,119 @@ func newTaskListResponse(Tasks []model.Task) []render.Renderer {
 	return list
 }
 
+// TaskStatusResponse is the response payload for listing the tasks of a sheet
+// together with the state of the submissions. Students get "status", tutors
+// and admins get "summary".
+type TaskStatusResponse struct {
+	Task   *TaskResponse `json:"task"`
+	Status *struct {
+		Submitted         bool     `json:"submitted" example:"true"`
+		SubmissionID      null.Int `json:"submission_id" example:"31"`
+		AcquiredPoints    null.Int `json:"acquired_points" example:"12"`
+		GradingInProgress bool     `json:"grading_in_progress" example:"false"`
+	} `json:"status,omitempty" required:"false"`
+	Summary *struct {
+		Submissions   int     `json:"submissions" example:"42"`
+		AveragePoints float32 `json:"average_points" example:"13.5"`
+	} `json:"summary,omitempty" required:"false"`
+}
+
+// Render post-processes a TaskStatusResponse.
+func (body *TaskStatusResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+// newTaskStatusListResponse creates a response from the submission states of a
+// student. The points are withheld while the grades are not published.
+func newTaskStatusListResponse(statuses []model.TaskStatus, gradesPublished bool) []render.Renderer {
+	list := []render.Renderer{}
+	for k := range statuses {
+		acquiredPoints := statuses[k].AcquiredPoints
+		if !gradesPublished {
+			acquiredPoints = null.Int{}
+		}
+
+		response := &TaskStatusResponse{Task: newTaskResponse(statuses[k].Task)}
+		response.Status = &struct {
+			Submitted         bool     `json:"submitted" example:"true"`
+			SubmissionID      null.Int `json:"submission_id" example:"31"`
+			AcquiredPoints    null.Int `json:"acquired_points" example:"12"`
+			GradingInProgress bool     `json:"grading_in_progress" example:"false"`
+		}{
+			statuses[k].SubmissionID.Valid,
+			statuses[k].SubmissionID,
+			acquiredPoints,
+			!gradesPublished,
+		}
+		list = append(list, response)
+	}
+	return list
+}
+
+// newTaskSummaryListResponse creates a response from the aggregated submissions of all students.
+func newTaskSummaryListResponse(summaries []model.TaskSummary) []render.Renderer {
+	list := []render.Renderer{}
+	for k := range summaries {
+		response := &TaskStatusResponse{Task: newTaskResponse(summaries[k].Task)}
+		response.Summary = &struct {
+			Submissions   int     `json:"submissions" example:"42"`
+			AveragePoints float32 `json:"average_points" example:"13.5"`
+		}{
+			summaries[k].Submissions,
+			summaries[k].AveragePoints,
+		}
+		list = append(list, response)
+	}
+	return list
+}
+
+// TaskStatisticsResponse is the response payload for the statistics of a task.
+type TaskStatisticsResponse struct {
+	MaxPoints    int     `json:"max_points" example:"10"`
+	Submissions  int     `json:"submissions" example:"42"`
+	Passed       int     `json:"passed" example:"30"`
+	PassRate     float32 `json:"pass_rate" example:"0.71"`
+	MeanPoints   float32 `json:"mean_points" example:"6.3"`
+	MedianPoints float32 `json:"median_points" example:"7"`
+	Histogram    []struct {
+		Points int `json:"points" example:"7"`
+		Count  int `json:"count" example:"12"`
+	} `json:"histogram"`
+}
+
+// newTaskStatisticsResponse creates a response from the statistics of a task.
+func newTaskStatisticsResponse(p *model.TaskStatistics, histogram []model.TaskPointsBin) *TaskStatisticsResponse {
+	response := &TaskStatisticsResponse{
+		MaxPoints:    p.MaxPoints,
+		Submissions:  p.Submissions,
+		Passed:       p.Passed,
+		MeanPoints:   p.MeanPoints,
+		MedianPoints: p.MedianPoints,
+		Histogram: []struct {
+			Points int `json:"points" example:"7"`
+			Count  int `json:"count" example:"12"`
+		}{},
+	}
+
+	if p.Submissions > 0 {
+		response.PassRate = float32(p.Passed) / float32(p.Submissions)
+	}
+
+	for _, bin := range histogram {
+		response.Histogram = append(response.Histogram, struct {
+			Points int `json:"points" example:"7"`
+			Count  int `json:"count" example:"12"`
+		}{bin.Points, bin.Count})
+	}
+
+	return response
+}
+
+// Render post-processes a TaskStatisticsResponse.
+func (body *TaskStatisticsResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
 // MissingTaskResponse is the response payload for displaying
 type MissingTaskResponse struct {
 	Task *struct {
@@ -22,13 +22,17 @@ package app
 import (
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"net/http"
+	"strings"
 	"testing"
 
 	"github.com/franela/goblin"
 	"github.com/infomark-org/infomark/api/helper"
 	"github.com/infomark-org/infomark/configuration"
 	"github.com/infomark-org/infomark/email"
+	"github.com/infomark-org/infomark/model"
+	null "gopkg.in/guregu/null.v3"
 )
 
 func TestTask(t *testing.T) {
@@ -85,6 +89,172 @@ func TestTask(t *testing.T) {
 			}
 		})
 
+		g.It("Should list the scoring policy of tasks from a sheet", func() {
+			tasks, err := stores.Task.TasksOfSheet(1)
+			g.Assert(err).Equal(nil)
+
+			task, err := stores.Task.Get(tasks[0].ID)
+			g.Assert(err).Equal(nil)
+			task.ScoringPolicy = null.StringFrom("best")
+			g.Assert(stores.Task.Update(task)).Equal(nil)
+
+			w := tape.Get("/api/v1/courses/1/sheets/1/tasks", adminJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			tasksActual := []TaskResponse{}
+			err = json.NewDecoder(w.Body).Decode(&tasksActual)
+			g.Assert(err).Equal(nil)
+			g.Assert(tasksActual[0].ID).Equal(task.ID)
+			g.Assert(tasksActual[0].ScoringPolicy.String).Equal("best")
+		})
+
+		g.It("Should list the own submission state of a student", func() {
+			task, err := stores.Task.Create(&model.Task{Name: "new Task", MaxPoints: 10}, 1)
+			g.Assert(err).Equal(nil)
+
+			// submissions of other students must not show up
+			_, err = stores.Submission.Create(&model.Submission{UserID: 113, TaskID: task.ID})
+			g.Assert(err).Equal(nil)
+
+			statusOf := func() map[int64]TaskStatusResponse {
+				w := tape.Get("/api/v1/courses/1/sheets/1/tasks/status", studentJWT)
+				g.Assert(w.Code).Equal(http.StatusOK)
+
+				list := []TaskStatusResponse{}
+				err := json.NewDecoder(w.Body).Decode(&list)
+				g.Assert(err).Equal(nil)
+				g.Assert(len(list)).Equal(4)
+
+				result := make(map[int64]TaskStatusResponse)
+				for _, el := range list {
+					g.Assert(el.Status != nil).IsTrue()
+					g.Assert(el.Summary == nil).IsTrue()
+					result[el.Task.ID] = el
+				}
+				return result
+			}
+
+			statuses := statusOf()
+			g.Assert(statuses[task.ID].Status.Submitted).Equal(false)
+			g.Assert(statuses[task.ID].Status.SubmissionID.Valid).Equal(false)
+
+			for taskID, el := range statuses {
+				if el.Status.Submitted {
+					submission, err := stores.Submission.Get(el.Status.SubmissionID.Int64)
+					g.Assert(err).Equal(nil)
+					g.Assert(submission.UserID).Equal(int64(112))
+					g.Assert(submission.TaskID).Equal(taskID)
+				}
+			}
+
+			submission, err := stores.Submission.Create(&model.Submission{UserID: 112, TaskID: task.ID})
+			g.Assert(err).Equal(nil)
+
+			statuses = statusOf()
+			g.Assert(statuses[task.ID].Status.Submitted).Equal(true)
+			g.Assert(statuses[task.ID].Status.SubmissionID.Int64).Equal(submission.ID)
+		})
+
+		g.It("Should list aggregated submission states to staff", func() {
+			task, err := stores.Task.Create(&model.Task{Name: "new Task", MaxPoints: 10}, 1)
+			g.Assert(err).Equal(nil)
+
+			// only the latest graded submission of user 112 counts
+			for _, el := range []struct {
+				userID int64
+				points int
+			}{{113, 4}, {112, 2}, {112, 8}} {
+				submission, err := stores.Submission.Create(&model.Submission{UserID: el.userID, TaskID: task.ID})
+				g.Assert(err).Equal(nil)
+				_, err = stores.Grade.Create(&model.Grade{
+					SubmissionID:   submission.ID,
+					TutorID:        2,
+					AcquiredPoints: el.points,
+					GradedAt:       null.TimeFrom(NowUTC()),
+				})
+				g.Assert(err).Equal(nil)
+			}
+
+			// points of background workers alone do not make a submission graded
+			submission, err := stores.Submission.Create(&model.Submission{UserID: 112, TaskID: task.ID})
+			g.Assert(err).Equal(nil)
+			_, err = stores.Grade.Create(&model.Grade{
+				SubmissionID:   submission.ID,
+				TutorID:        1,
+				AcquiredPoints: 10,
+			})
+			g.Assert(err).Equal(nil)
+
+			for _, jwt := range []JWTRequest{tutorJWT, noAdminJWT} {
+				w := tape.Get("/api/v1/courses/1/sheets/1/tasks/status", jwt)
+				g.Assert(w.Code).Equal(http.StatusOK)
+
+				list := []TaskStatusResponse{}
+				err = json.NewDecoder(w.Body).Decode(&list)
+				g.Assert(err).Equal(nil)
+				g.Assert(len(list)).Equal(4)
+
+				for _, el := range list {
+					g.Assert(el.Status == nil).IsTrue()
+					g.Assert(el.Summary != nil).IsTrue()
+					if el.Task.ID == task.ID {
+						g.Assert(el.Summary.Submissions).Equal(2)
+						g.Assert(el.Summary.AveragePoints).Equal(float32(6))
+					}
+				}
+			}
+		})
+
+		g.It("Should compute statistics of a task", func() {
+			task, err := stores.Task.Create(&model.Task{Name: "new Task", MaxPoints: 10}, 1)
+			g.Assert(err).Equal(nil)
+
+			w := tape.Get(fmt.Sprintf("/api/v1/courses/1/tasks/%d/stats", task.ID), studentJWT)
+			g.Assert(w.Code).Equal(http.StatusForbidden)
+
+			w = tape.Get(fmt.Sprintf("/api/v1/courses/1/tasks/%d/stats", task.ID), tutorJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			empty := TaskStatisticsResponse{}
+			err = json.NewDecoder(w.Body).Decode(&empty)
+			g.Assert(err).Equal(nil)
+			g.Assert(empty.Submissions).Equal(0)
+			g.Assert(len(empty.Histogram)).Equal(0)
+
+			// the older submission of user 112 is ignored
+			for _, el := range []struct {
+				userID int64
+				points int
+			}{{112, 0}, {112, 10}, {113, 4}, {114, 4}} {
+				submission, err := stores.Submission.Create(&model.Submission{UserID: el.userID, TaskID: task.ID})
+				g.Assert(err).Equal(nil)
+				_, err = stores.Grade.Create(&model.Grade{
+					SubmissionID:   submission.ID,
+					TutorID:        2,
+					AcquiredPoints: el.points,
+				})
+				g.Assert(err).Equal(nil)
+			}
+
+			w = tape.Get(fmt.Sprintf("/api/v1/courses/1/tasks/%d/stats", task.ID), noAdminJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			stats := TaskStatisticsResponse{}
+			err = json.NewDecoder(w.Body).Decode(&stats)
+			g.Assert(err).Equal(nil)
+			g.Assert(stats.MaxPoints).Equal(10)
+			g.Assert(stats.Submissions).Equal(3)
+			g.Assert(stats.Passed).Equal(1)
+			g.Assert(stats.MeanPoints).Equal(float32(6))
+			g.Assert(stats.MedianPoints).Equal(float32(4))
+
+			g.Assert(len(stats.Histogram)).Equal(2)
+			g.Assert(stats.Histogram[0].Points).Equal(4)
+			g.Assert(stats.Histogram[0].Count).Equal(2)
+			g.Assert(stats.Histogram[1].Points).Equal(10)
+			g.Assert(stats.Histogram[1].Count).Equal(1)
+		})
+
 		g.It("Should get a specific task", func() {
 
 			taskExpected, err := stores.Task.Get(1)
@@ -108,6 +278,32 @@ func TestTask(t *testing.T) {
 
 		})
 
+		g.It("Should render Markdown descriptions to sanitized HTML", func() {
+			description := "Implement `fib(n)`.\n\n<script>alert('xss')</script>\n\n" +
+				"```java\nint fib(int n);\n```\n\n[click](javascript:alert(1))"
+
+			w := tape.Put("/api/v1/courses/1/tasks/1", H{
+				"name":        "Fibonacci",
+				"max_points":  10,
+				"description": description,
+			}, adminJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			w = tape.Get("/api/v1/courses/1/tasks/1", adminJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			taskActual := &TaskResponse{}
+			err := json.NewDecoder(w.Body).Decode(taskActual)
+			g.Assert(err).Equal(nil)
+
+			g.Assert(taskActual.Description).Equal(description)
+			g.Assert(strings.Contains(taskActual.DescriptionHTML, "<code>fib(n)</code>")).IsTrue()
+			g.Assert(strings.Contains(taskActual.DescriptionHTML, "int fib(int n);")).IsTrue()
+			g.Assert(strings.Contains(taskActual.DescriptionHTML, "<script")).IsFalse()
+			g.Assert(strings.Contains(taskActual.DescriptionHTML, "alert('xss')")).IsFalse()
+			g.Assert(strings.Contains(taskActual.DescriptionHTML, "javascript:")).IsFalse()
+		})
+
 		g.It("Creating should require claims", func() {
 			w := tape.Post("/api/v1/courses/1/sheets/1/tasks", H{})
 			g.Assert(w.Code).Equal(http.StatusUnauthorized)
@@ -188,6 +384,53 @@ func TestTask(t *testing.T) {
 			g.Assert(w.Code).Equal(http.StatusForbidden)
 		})
 
+		g.It("Should upload and serve a starter file", func() {
+			defer helper.NewStarterFileHandle(1).Delete()
+			defer helper.NewPublicTestFileHandle(1).Delete()
+
+			w := tape.Get("/api/v1/courses/1/tasks/1/starter_file", studentJWT)
+			g.Assert(w.Code).Equal(http.StatusNotFound)
+
+			filename := fmt.Sprintf("%s/empty.zip", configuration.Configuration.Server.Debugging.Fixtures)
+
+			// only staff can upload
+			w, err := tape.Upload("/api/v1/courses/1/tasks/1/starter_file", filename, "application/zip", studentJWT)
+			g.Assert(err).Equal(nil)
+			g.Assert(w.Code).Equal(http.StatusForbidden)
+			w, err = tape.Upload("/api/v1/courses/1/tasks/1/starter_file", filename, "application/zip", tutorJWT)
+			g.Assert(err).Equal(nil)
+			g.Assert(w.Code).Equal(http.StatusForbidden)
+			g.Assert(helper.NewStarterFileHandle(1).Exists()).Equal(false)
+
+			w, err = tape.Upload("/api/v1/courses/1/tasks/1/starter_file", filename, "application/zip", adminJWT)
+			g.Assert(err).Equal(nil)
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			// the starter file is not the public test file
+			g.Assert(helper.NewStarterFileHandle(1).Exists()).Equal(true)
+			g.Assert(helper.NewPublicTestFileHandle(1).Exists()).Equal(false)
+
+			expected, err := ioutil.ReadFile(filename)
+			g.Assert(err).Equal(nil)
+
+			w = tape.Get("/api/v1/courses/1/tasks/1/starter_file", studentJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+			g.Assert(w.Body.Bytes()).Equal(expected)
+
+			w = tape.Get("/api/v1/courses/1/tasks/1/starter_file", tutorJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			w = tape.Get("/api/v1/courses/1/tasks/1/starter_file", adminJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			// users not enrolled in the course cannot download it
+			_, err = tape.DB.Exec("DELETE FROM user_course WHERE user_id = 112 AND course_id = 1;")
+			g.Assert(err).Equal(nil)
+
+			w = tape.Get("/api/v1/courses/1/tasks/1/starter_file", studentJWT)
+			g.Assert(w.Code).Equal(http.StatusForbidden)
+		})
+
 		g.It("Should upload private test file", func() {
 			defer helper.NewPublicTestFileHandle(1).Delete()
 			defer helper.NewPrivateTestFileHandle(1).Delete()
@@ -301,6 +544,23 @@ func TestTask(t *testing.T) {
 
 		})
 
+		g.It("students should not see points of unpublished grades", func() {
+			sheet, err := stores.Task.IdentifySheetOfTask(1)
+			g.Assert(err).Equal(nil)
+			sheet.GradesPublished = false
+			g.Assert(stores.Sheet.Update(sheet)).Equal(nil)
+
+			w := tape.Get("/api/v1/courses/1/tasks/1/result", studentJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			actual := &GradeResponse{}
+			err = json.NewDecoder(w.Body).Decode(actual)
+			g.Assert(err).Equal(nil)
+			g.Assert(actual.AcquiredPoints).Equal(0)
+			g.Assert(actual.Feedback).Equal("")
+			g.Assert(actual.GradingInProgress).IsTrue()
+		})
+
 		g.It("Permission test", func() {
 			// sheet (id=1) belongs to group(id=1)
 			url := "/api/v1/courses/1/sheets/1/tasks"
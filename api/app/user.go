@@ -21,8 +21,11 @@ package app
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"os"
 	"strconv"
 	"strings"
 
@@ -33,19 +36,26 @@ import (
 	"github.com/infomark-org/infomark/auth/authenticate"
 	"github.com/infomark-org/infomark/configuration"
 	"github.com/infomark-org/infomark/email"
+	"github.com/infomark-org/infomark/event"
 	"github.com/infomark-org/infomark/model"
 	"github.com/infomark-org/infomark/symbol"
+	"github.com/sirupsen/logrus"
+	null "gopkg.in/guregu/null.v3"
 )
 
 // UserResource specifies user management handler.
 type UserResource struct {
-	Stores *Stores
+	Stores    *Stores
+	TokenAuth *authenticate.TokenAuth
+	Events    *event.Bus
 }
 
 // NewUserResource create and returns a UserResource.
-func NewUserResource(stores *Stores) *UserResource {
+func NewUserResource(stores *Stores, tokenAuth *authenticate.TokenAuth, events *event.Bus) *UserResource {
 	return &UserResource{
-		Stores: stores,
+		Stores:    stores,
+		TokenAuth: tokenAuth,
+		Events:    events,
 	}
 }
 
@@ -53,12 +63,22 @@ func NewUserResource(stores *Stores) *UserResource {
 
 // IndexHandler is public endpoint for
 // URL: /users
+// QUERYPARAM: page,integer
+// QUERYPARAM: per_page,integer
+// QUERYPARAM: fields,string
 // METHOD: get
 // TAG: users
 // RESPONSE: 200,UserResponseList
+// RESPONSE: 304,NotModified
 // RESPONSE: 400,BadRequest
 // RESPONSE: 401,Unauthenticated
 // SUMMARY:  Get own user details (requires root)
+// DESCRIPTION:
+// The response carries a weak ETag. Requests with a matching "If-None-Match"
+// header are answered with 304 and an empty body. If "per_page" is given, only
+// this page is returned and the "Link" header points to the other pages.
+// A comma-separated list "fields" (e.g. "id,first_name") restricts the users
+// to these fields.
 func (rs *UserResource) IndexHandler(w http.ResponseWriter, r *http.Request) {
 
 	accessClaims := r.Context().Value(symbol.CtxKeyAccessClaims).(*authenticate.AccessClaims)
@@ -68,6 +88,26 @@ func (rs *UserResource) IndexHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	pagination, err := PaginationFromURL(r)
+	if err != nil {
+		render.Render(w, r, ErrBadRequestWithDetails(err))
+		return
+	}
+
+	fingerprint, err := rs.Stores.User.Fingerprint()
+	if err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
+	// each page (with or without envelope) is a different representation
+	etag := WeakETag(fmt.Sprintf("%s?%s&envelope=%t", fingerprint, r.URL.RawQuery, wantsEnvelope(r)))
+	w.Header().Set("ETag", etag)
+	if ETagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
 	// fetch collection of users from database
 	users, err := rs.Stores.User.GetAll()
 	if err != nil {
@@ -75,6 +115,12 @@ func (rs *UserResource) IndexHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if pagination != nil {
+		pagination.WriteLinkHeader(w, r, len(users))
+		from, to := pagination.Bounds(len(users))
+		users = users[from:to]
+	}
+
 	// render JSON response
 	if err = render.RenderList(w, r, newUserListResponse(users)); err != nil {
 		render.Render(w, r, ErrRender(err))
@@ -137,12 +183,16 @@ func (rs *UserResource) Find(w http.ResponseWriter, r *http.Request) {
 // GetHandler is public endpoint for
 // URL: /users/{user_id}
 // URLPARAM: user_id,integer
+// QUERYPARAM: fields,string
 // METHOD: get
 // TAG: users
 // RESPONSE: 200,UserResponse
 // RESPONSE: 400,BadRequest
 // RESPONSE: 401,Unauthenticated
 // SUMMARY:  Get user details
+// DESCRIPTION:
+// A comma-separated list "fields" (e.g. "id,first_name") restricts the
+// response to these fields.
 func (rs *UserResource) GetHandler(w http.ResponseWriter, r *http.Request) {
 	// `user` is retrieved via middle-ware
 	user := r.Context().Value(symbol.CtxKeyUser).(*model.User)
@@ -166,23 +216,101 @@ func (rs *UserResource) GetHandler(w http.ResponseWriter, r *http.Request) {
 // GetAvatarHandler is public endpoint for
 // URL: /users/{user_id}/avatar
 // URLPARAM: user_id,integer
+// QUERYPARAM: size,integer
 // METHOD: get
 // TAG: users
-// RESPONSE: 200,UserResponse
+// RESPONSE: 200,ImageFile
+// RESPONSE: 304,NotModified
 // RESPONSE: 400,BadRequest
 // RESPONSE: 401,Unauthenticated
-// SUMMARY:  Get user details
+// RESPONSE: 404,NotFound
+// SUMMARY:  Get the avatar of a user
+// DESCRIPTION:
+// Any authenticated user can fetch avatars, e.g. to display the members of a
+// course. The response carries a weak ETag. Requests with a matching
+// "If-None-Match" header are answered with 304 and an empty body.
+// The optional "size" (32, 64, 128 or 256) returns a copy scaled down to fit
+// into size x size pixels.
 func (rs *UserResource) GetAvatarHandler(w http.ResponseWriter, r *http.Request) {
 	// `user` is retrieved via middle-ware
 	user := r.Context().Value(symbol.CtxKeyUser).(*model.User)
 
-	file := helper.NewAvatarFileHandle(user.ID)
+	writeAvatar(w, r, user.ID)
+}
+
+// ensureUniqueStudentNumber renders 409 if an account other than the given
+// one already uses the student number. Empty student numbers never conflict.
+func ensureUniqueStudentNumber(stores *Stores, w http.ResponseWriter, r *http.Request,
+	studentNumber string, userID int64) bool {
+	if studentNumber == "" {
+		return true
+	}
+
+	taken, err := stores.User.StudentNumberTaken(studentNumber, userID)
+	if err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return false
+	}
+
+	if taken {
+		render.Render(w, r, ErrConflictWithDetails(errors.New("the student number is already used by another account")))
+		return false
+	}
+	return true
+}
+
+// writeAvatar serves the avatar of a user. As avatars are overwritten in-place,
+// the ETag is derived from the size and modification time of the file.
+// The query parameter "size" selects a scaled down copy.
+func writeAvatar(w http.ResponseWriter, r *http.Request, userID int64) {
+	file := helper.NewAvatarFileHandle(userID)
 
 	if !file.Exists() {
 		render.Render(w, r, ErrNotFound)
 		return
 	}
 
+	path := file.Path()
+	if value := r.URL.Query().Get("size"); value != "" {
+		size, err := strconv.Atoi(value)
+		if err != nil || !helper.IsAvatarSize(size) {
+			render.Render(w, r, ErrBadRequestWithDetails(fmt.Errorf("size has to be one of %v", helper.AvatarSizes)))
+			return
+		}
+
+		if path, err = helper.ResizedAvatarPath(userID, size); err != nil {
+			render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+			return
+		}
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
+	etag := WeakETag(fmt.Sprintf("%d-%d-%d", userID, info.Size(), info.ModTime().UnixNano()))
+	w.Header().Set("ETag", etag)
+	if ETagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	if path != file.Path() {
+		// scaled copies are always stored as png
+		resized, err := os.Open(path)
+		if err != nil {
+			render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+			return
+		}
+		defer resized.Close()
+
+		w.Header().Set("Content-Type", "image/png")
+		io.Copy(w, resized)
+		return
+	}
+
 	if err := file.WriteToBody(w); err != nil {
 		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
 	}
@@ -196,6 +324,7 @@ func (rs *UserResource) GetAvatarHandler(w http.ResponseWriter, r *http.Request)
 // RESPONSE: 204,NoContent
 // RESPONSE: 400,BadRequest
 // RESPONSE: 401,Unauthenticated
+// RESPONSE: 409,Conflict
 // SUMMARY:  updating a the user record of the request identity
 func (rs *UserResource) EditMeHandler(w http.ResponseWriter, r *http.Request) {
 
@@ -216,6 +345,12 @@ func (rs *UserResource) EditMeHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// accounts might share a student number from before it had to be unique
+	if data.StudentNumber != user.StudentNumber &&
+		!ensureUniqueStudentNumber(rs.Stores, w, r, data.StudentNumber, user.ID) {
+		return
+	}
+
 	user.FirstName = data.FirstName
 	user.LastName = data.LastName
 	// no email update here
@@ -223,6 +358,7 @@ func (rs *UserResource) EditMeHandler(w http.ResponseWriter, r *http.Request) {
 	user.Semester = data.Semester
 	user.Subject = data.Subject
 	user.Language = data.Language
+	user.EmailDigest = data.EmailDigest
 
 	// update database entry
 	if err := rs.Stores.User.Update(user); err != nil {
@@ -242,6 +378,7 @@ func (rs *UserResource) EditMeHandler(w http.ResponseWriter, r *http.Request) {
 // RESPONSE: 204,NoContent
 // RESPONSE: 400,BadRequest
 // RESPONSE: 401,Unauthenticated
+// RESPONSE: 409,Conflict
 // SUMMARY:  updating a specific user with given id.
 func (rs *UserResource) EditHandler(w http.ResponseWriter, r *http.Request) {
 
@@ -262,6 +399,12 @@ func (rs *UserResource) EditHandler(w http.ResponseWriter, r *http.Request) {
 
 	user := r.Context().Value(symbol.CtxKeyUser).(*model.User)
 
+	// accounts might share a student number from before it had to be unique
+	if data.StudentNumber != user.StudentNumber &&
+		!ensureUniqueStudentNumber(rs.Stores, w, r, data.StudentNumber, user.ID) {
+		return
+	}
+
 	user.FirstName = data.FirstName
 	user.LastName = data.LastName
 	user.Email = data.Email
@@ -289,6 +432,169 @@ func (rs *UserResource) EditHandler(w http.ResponseWriter, r *http.Request) {
 	render.Status(r, http.StatusNoContent)
 }
 
+// ConfirmHandler is public endpoint for
+// URL: /users/{user_id}/confirm
+// URLPARAM: user_id,integer
+// METHOD: post
+// TAG: users
+// RESPONSE: 204,NoContent
+// RESPONSE: 400,BadRequest
+// RESPONSE: 401,Unauthenticated
+// RESPONSE: 403,Unauthorized
+// SUMMARY:  confirm the email address of a specific user without sending an email.
+// DESCRIPTION:
+// This is meant for support staff when the email address of an account is
+// unreachable. Each force-confirmation is written to the audit log.
+func (rs *UserResource) ConfirmHandler(w http.ResponseWriter, r *http.Request) {
+	accessClaims := r.Context().Value(symbol.CtxKeyAccessClaims).(*authenticate.AccessClaims)
+
+	if !accessClaims.Root {
+		render.Render(w, r, ErrUnauthorized)
+		return
+	}
+
+	user := r.Context().Value(symbol.CtxKeyUser).(*model.User)
+	wasConfirmed := !user.ConfirmEmailToken.Valid
+
+	user.ConfirmEmailToken = null.String{}
+	if err := rs.Stores.User.Update(user); err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"module":         "audit",
+		"action":         "user.force_confirm",
+		"actor_id":       accessClaims.LoginID,
+		"user_id":        user.ID,
+		"already_active": wasConfirmed,
+	}).Info("email address confirmed by admin")
+
+	if !wasConfirmed {
+		rs.Events.Publish(event.UserConfirmed{User: user})
+	}
+
+	render.Status(r, http.StatusNoContent)
+}
+
+// ReconfirmEmailHandler is public endpoint for
+// URL: /users/{user_id}/reconfirm_email
+// URLPARAM: user_id,integer
+// METHOD: post
+// TAG: users
+// TAG: email
+// RESPONSE: 204,NoContent
+// RESPONSE: 401,Unauthenticated
+// RESPONSE: 403,Unauthorized
+// SUMMARY:  ask a specific user to confirm the email address again (requires root)
+// DESCRIPTION:
+// This is meant for users who moved to another institution and whose email
+// address was changed by support staff. A new confirmation token is sent to
+// the current address and the user cannot log in until it is confirmed.
+// A pending email change of the user is not reverted anymore.
+func (rs *UserResource) ReconfirmEmailHandler(w http.ResponseWriter, r *http.Request) {
+	accessClaims := r.Context().Value(symbol.CtxKeyAccessClaims).(*authenticate.AccessClaims)
+
+	if !accessClaims.Root {
+		render.Render(w, r, ErrUnauthorized)
+		return
+	}
+
+	user := r.Context().Value(symbol.CtxKeyUser).(*model.User)
+
+	user.ConfirmEmailToken = null.StringFrom(auth.GenerateToken(32))
+	user.ClearPendingEmailChange()
+
+	msg, err := newConfirmEmailForUser(configuration.Configuration.Server.Email.From, user)
+	if err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
+	if err := rs.Stores.User.Update(user); err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
+	if err := queueUserEmail(rs.Stores, user.ID, model.EmailKindConfirmEmail, msg); err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"module":   "audit",
+		"action":   "user.reconfirm_email",
+		"actor_id": accessClaims.LoginID,
+		"user_id":  user.ID,
+	}).Info("email confirmation reissued by admin")
+
+	render.Status(r, http.StatusNoContent)
+}
+
+// ImpersonateHandler is public endpoint for
+// URL: /users/{user_id}/impersonate
+// URLPARAM: user_id,integer
+// METHOD: post
+// TAG: users
+// TAG: auth
+// RESPONSE: 200,ImpersonationResponse
+// RESPONSE: 400,BadRequest
+// RESPONSE: 401,Unauthenticated
+// RESPONSE: 403,Unauthorized
+// SUMMARY:  issue a short-lived access token acting as a specific user
+// DESCRIPTION:
+// This is meant for support staff to reproduce what a user sees. The token
+// never carries root permissions, cannot be refreshed and names the
+// impersonating user in its claims, so requests made with it are flagged in
+// the access log. Root users cannot be impersonated. Each impersonation is
+// written to the audit log.
+func (rs *UserResource) ImpersonateHandler(w http.ResponseWriter, r *http.Request) {
+	accessClaims := r.Context().Value(symbol.CtxKeyAccessClaims).(*authenticate.AccessClaims)
+
+	// an impersonation token is never root, but be explicit about chains
+	if !accessClaims.Root || accessClaims.ImpersonatorID != 0 {
+		render.Render(w, r, ErrUnauthorized)
+		return
+	}
+
+	user := r.Context().Value(symbol.CtxKeyUser).(*model.User)
+
+	if user.ID == accessClaims.LoginID {
+		render.Render(w, r, ErrBadRequestWithDetails(errors.New("cannot impersonate yourself")))
+		return
+	}
+
+	if user.Root {
+		render.Render(w, r, ErrUnauthorized)
+		return
+	}
+
+	accessToken, expiresAt, err := rs.TokenAuth.CreateImpersonationJWT(user.ID, accessClaims.LoginID)
+	if err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"module":     "audit",
+		"action":     "user.impersonate",
+		"actor_id":   accessClaims.LoginID,
+		"user_id":    user.ID,
+		"expires_at": expiresAt,
+	}).Info("user impersonated by admin")
+
+	resp := &ImpersonationResponse{
+		UserID:    user.ID,
+		ExpiresAt: expiresAt,
+	}
+	resp.Access.Token = accessToken
+
+	if err := render.Render(w, r, resp); err != nil {
+		render.Render(w, r, ErrRender(err))
+		return
+	}
+}
+
 // SendEmailHandler is public endpoint for
 // URL: /users/{user_id}/emails
 // URLPARAM: user_id,integer
@@ -323,7 +629,10 @@ func (rs *UserResource) SendEmailHandler(w http.ResponseWriter, r *http.Request)
 		accessUser,
 	)
 
-	email.OutgoingEmailsChannel <- msg
+	if err := queueUserEmail(rs.Stores, user.ID, model.EmailKindMessage, msg); err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
 
 }
 
@@ -349,6 +658,163 @@ func (rs *UserResource) DeleteHandler(w http.ResponseWriter, r *http.Request) {
 	render.Status(r, http.StatusNoContent)
 }
 
+// MergeHandler is public endpoint for
+// URL: /users/{user_id}/merge/{duplicate_id}
+// URLPARAM: user_id,integer
+// URLPARAM: duplicate_id,integer
+// METHOD: post
+// TAG: users
+// REQUEST: Empty
+// RESPONSE: 200,UserResponse
+// RESPONSE: 400,BadRequest
+// RESPONSE: 401,Unauthenticated
+// RESPONSE: 403,Unauthorized
+// RESPONSE: 404,NotFound
+// SUMMARY:  merge a duplicate account into the given user (requires root)
+// DESCRIPTION:
+// Submissions (including their grades), enrollments, group memberships, exam
+// registrations, extensions and the login and email history of the duplicate
+// are moved to the user. If both accounts are enrolled in the same course, the
+// higher role is kept. If both accounts submitted a solution for the same task,
+// only the latest upload and its grade are kept. The duplicate cannot be used anymore afterwards and no
+// longer shows up in any enrollment list.
+func (rs *UserResource) MergeHandler(w http.ResponseWriter, r *http.Request) {
+	accessClaims := r.Context().Value(symbol.CtxKeyAccessClaims).(*authenticate.AccessClaims)
+	if !accessClaims.Root {
+		render.Render(w, r, ErrUnauthorized)
+		return
+	}
+
+	user := r.Context().Value(symbol.CtxKeyUser).(*model.User)
+
+	duplicateID, err := strconv.ParseInt(chi.URLParam(r, "duplicate_id"), 10, 64)
+	if err != nil {
+		render.Render(w, r, ErrNotFound)
+		return
+	}
+
+	duplicate, err := rs.Stores.User.Get(duplicateID)
+	if err != nil {
+		render.Render(w, r, ErrNotFound)
+		return
+	}
+
+	if user.ID == duplicate.ID {
+		render.Render(w, r, ErrBadRequestWithDetails(errors.New("cannot merge an account into itself")))
+		return
+	}
+
+	if user.DeletedAt.Valid || duplicate.DeletedAt.Valid {
+		render.Render(w, r, ErrBadRequestWithDetails(errors.New("account has already been merged")))
+		return
+	}
+
+	// the files have to be located while the submissions still exist
+	superseded, err := rs.Stores.User.SubmissionsSupersededByMerge(user.ID, duplicate.ID)
+	if err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+	files := []*helper.FileHandle{}
+	for _, submissionID := range superseded {
+		hnd := helper.NewSubmissionFileHandle(submissionID)
+		if err := hnd.Resolve(); err != nil {
+			render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+			return
+		}
+		files = append(files, hnd)
+	}
+
+	if err := rs.Stores.User.Merge(user.ID, duplicate.ID); err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
+	for _, hnd := range files {
+		helper.DeleteSubmissionHistory(hnd)
+		if hnd.Exists() {
+			hnd.Delete()
+		}
+	}
+
+	if err := render.Render(w, r, newUserResponse(user)); err != nil {
+		render.Render(w, r, ErrRender(err))
+		return
+	}
+}
+
+// BulkDeleteHandler is public endpoint for
+// URL: /users/bulk_delete
+// METHOD: post
+// TAG: users
+// REQUEST: BulkDeleteUsersRequest
+// RESPONSE: 200,BulkDeleteUsersResponse
+// RESPONSE: 400,BadRequest
+// RESPONSE: 401,Unauthenticated
+// RESPONSE: 403,Unauthorized
+// SUMMARY:  delete several users at once (requires root)
+// DESCRIPTION:
+// Users are soft-deleted in a single transaction: they cannot log in anymore
+// but their submissions and grades are kept. Root users and the caller are
+// never deleted. The result lists for each requested id whether it was
+// "deleted", "not_found", "skipped_root" or "skipped_self".
+func (rs *UserResource) BulkDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	accessClaims := r.Context().Value(symbol.CtxKeyAccessClaims).(*authenticate.AccessClaims)
+	if !accessClaims.Root {
+		render.Render(w, r, ErrUnauthorized)
+		return
+	}
+
+	data := &BulkDeleteUsersRequest{}
+	if err := render.Bind(r, data); err != nil {
+		render.Render(w, r, ErrBadRequestWithDetails(err))
+		return
+	}
+
+	resp := &BulkDeleteUsersResponse{Results: []BulkDeleteUserResult{}}
+	deletable := []int64{}
+	seen := map[int64]bool{}
+
+	for _, userID := range data.IDs {
+		if seen[userID] {
+			continue
+		}
+		seen[userID] = true
+
+		status := "deleted"
+		if userID == accessClaims.LoginID {
+			status = "skipped_self"
+		} else if user, err := rs.Stores.User.Get(userID); err != nil || user.DeletedAt.Valid {
+			status = "not_found"
+		} else if user.Root {
+			status = "skipped_root"
+		} else {
+			deletable = append(deletable, userID)
+		}
+
+		resp.Results = append(resp.Results, BulkDeleteUserResult{ID: userID, Status: status})
+	}
+
+	if len(deletable) > 0 {
+		if err := rs.Stores.User.SoftDelete(deletable); err != nil {
+			render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+			return
+		}
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"module":   "audit",
+		"action":   "user.bulk_delete",
+		"actor_id": accessClaims.LoginID,
+		"user_ids": deletable,
+	}).Info("users deleted by admin")
+
+	if err := render.Render(w, r, resp); err != nil {
+		render.Render(w, r, ErrRender(err))
+		return
+	}
+}
+
 // .............................................................................
 
 // Context middleware is used to load an User object from
@@ -21,11 +21,13 @@ package app
 
 import (
 	"errors"
+	"fmt"
 	"net/http"
 	"strings"
 
 	validation "github.com/go-ozzo/ozzo-validation"
 	"github.com/go-ozzo/ozzo-validation/is"
+	"github.com/infomark-org/infomark/configuration"
 )
 
 // UserRequest is the request payload for user management.
@@ -54,6 +56,7 @@ func (body *UserRequest) Bind(r *http.Request) error {
 func (body *UserRequest) Validate() error {
 
 	body.FirstName = strings.TrimSpace(body.FirstName)
+	body.Subject = strings.TrimSpace(body.Subject)
 	body.LastName = strings.TrimSpace(body.LastName)
 
 	body.Email = strings.TrimSpace(body.Email)
@@ -79,12 +82,11 @@ func (body *UserRequest) Validate() error {
 		),
 		validation.Field(
 			&body.Semester,
-			validation.Required,
-			validation.Min(1),
+			semesterRules()...,
 		),
 		validation.Field(
 			&body.Subject,
-			validation.Required,
+			subjectRules()...,
 		),
 
 		validation.Field(
@@ -96,6 +98,52 @@ func (body *UserRequest) Validate() error {
 
 }
 
+// maxSubjectLength limits the subject of users if there is no list of subjects.
+const maxSubjectLength = 100
+
+// semesterRules restricts the semester of users to a sane range.
+func semesterRules() []validation.Rule {
+	rules := []validation.Rule{validation.Required, validation.Min(1)}
+	if maxSemester := configuration.Configuration.Server.Registration.MaxSemester; maxSemester > 0 {
+		rules = append(rules, validation.Max(maxSemester))
+	}
+	return rules
+}
+
+// subjectRules restricts the subject of users to the configured subjects.
+func subjectRules() []validation.Rule {
+	rules := []validation.Rule{validation.Required, validation.Length(1, maxSubjectLength)}
+	if subjects := configuration.Configuration.Server.Registration.Subjects; len(subjects) > 0 {
+		allowed := make([]interface{}, len(subjects))
+		for k, subject := range subjects {
+			allowed[k] = subject
+		}
+		rules = append(rules, validation.In(allowed...).Error(
+			fmt.Sprintf("must be one of: %s", strings.Join(subjects, ", "))))
+	}
+	return rules
+}
+
+// BulkDeleteUsersRequest is the request payload for deleting several users
+// at once.
+type BulkDeleteUsersRequest struct {
+	IDs []int64 `json:"ids" example:"[12,13]"`
+}
+
+// Bind preprocesses a BulkDeleteUsersRequest.
+func (body *BulkDeleteUsersRequest) Bind(r *http.Request) error {
+	if body == nil {
+		return errors.New("missing \"ids\" data")
+	}
+
+	return validation.ValidateStruct(body,
+		validation.Field(
+			&body.IDs,
+			validation.Required,
+		),
+	)
+}
+
 // UserMeRequest is the request payload for user management.
 type UserMeRequest struct {
 	FirstName string `json:"first_name" example:"Max"`
@@ -106,6 +154,7 @@ type UserMeRequest struct {
 	Subject       string `json:"subject" example:"bio informatics"`
 	Language      string `json:"language" example:"en" len:"2"`
 	// PlainPassword string `json:"plain_password" example:"new_password"`
+	EmailDigest bool `json:"email_digest" example:"false" required:"false"`
 }
 
 // Bind preprocesses a UserMeRequest.
@@ -122,6 +171,7 @@ func (body *UserMeRequest) Bind(r *http.Request) error {
 func (body *UserMeRequest) Validate() error {
 
 	body.FirstName = strings.TrimSpace(body.FirstName)
+	body.Subject = strings.TrimSpace(body.Subject)
 	body.LastName = strings.TrimSpace(body.LastName)
 
 	return validation.ValidateStruct(body,
@@ -140,12 +190,11 @@ func (body *UserMeRequest) Validate() error {
 		),
 		validation.Field(
 			&body.Semester,
-			validation.Required,
-			validation.Min(1),
+			semesterRules()...,
 		),
 		validation.Field(
 			&body.Subject,
-			validation.Required,
+			subjectRules()...,
 		),
 
 		validation.Field(
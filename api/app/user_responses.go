@@ -21,6 +21,7 @@ package app
 
 import (
 	"net/http"
+	"time"
 
 	"github.com/go-chi/render"
 	"github.com/infomark-org/infomark/model"
@@ -41,6 +42,7 @@ type UserResponse struct {
 	Subject       string      `json:"subject" example:"bio informatics"`
 	Language      string      `json:"language" example:"en" len:"2"`
 	Root          bool        `json:"root" example:"false"`
+	EmailDigest   bool        `json:"email_digest" example:"false"`
 }
 
 // newUserResponse creates a response from a user model.
@@ -55,6 +57,7 @@ func newUserResponse(p *model.User) *UserResponse {
 		Semester:      p.Semester,
 		Subject:       p.Subject,
 		Language:      p.Language,
+		EmailDigest:   p.EmailDigest,
 	}
 }
 
@@ -73,3 +76,36 @@ func (u *UserResponse) Render(w http.ResponseWriter, r *http.Request) error {
 	// nothing to hide
 	return nil
 }
+
+// BulkDeleteUserResult is the outcome of deleting a single user within a
+// bulk deletion. Status is one of "deleted", "not_found", "skipped_root" or
+// "skipped_self".
+type BulkDeleteUserResult struct {
+	ID     int64  `json:"id" example:"12"`
+	Status string `json:"status" example:"deleted"`
+}
+
+// BulkDeleteUsersResponse is the response payload of a bulk deletion.
+type BulkDeleteUsersResponse struct {
+	Results []BulkDeleteUserResult `json:"results"`
+}
+
+// Render post-processes a BulkDeleteUsersResponse.
+func (body *BulkDeleteUsersResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+// ImpersonationResponse is the response payload when a root user acts as
+// another user.
+type ImpersonationResponse struct {
+	Access struct {
+		Token string `json:"token" example:"eyJhbGciOiJIUzI1...rZikwLEI7XhY"`
+	} `json:"access"`
+	UserID    int64     `json:"user_id" example:"42"`
+	ExpiresAt time.Time `json:"expires_at" example:"auto"`
+}
+
+// Render post-processes an ImpersonationResponse.
+func (body *ImpersonationResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
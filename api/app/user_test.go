@@ -21,25 +21,51 @@ package app
 
 import (
 	"encoding/json"
+	"fmt"
+	"io/ioutil"
 	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/franela/goblin"
 	"github.com/infomark-org/infomark/api/helper"
+	"github.com/infomark-org/infomark/auth/authenticate"
+	"github.com/infomark-org/infomark/configuration"
 	"github.com/infomark-org/infomark/email"
 	"github.com/infomark-org/infomark/model"
+	"github.com/sirupsen/logrus/hooks/test"
+	null "gopkg.in/guregu/null.v3"
 )
 
+// ifNoneMatch adds a conditional header to a request.
+type ifNoneMatch string
+
+func (etag ifNoneMatch) Modify(r *http.Request) {
+	r.Header.Set("If-None-Match", string(etag))
+}
+
+// withEnvelope asks for a response wrapped in an envelope.
+type withEnvelope bool
+
+func (enabled withEnvelope) Modify(r *http.Request) {
+	r.Header.Set(EnvelopeHeader, fmt.Sprintf("%t", enabled))
+}
+
 func TestUser(t *testing.T) {
 
 	g := goblin.Goblin(t)
 	email.DefaultMail = email.VoidMail
+	go email.BackgroundSend(email.OutgoingEmailsChannel)
 
 	tape := NewTape()
 
 	var stores *Stores
 
 	adminJWT := tape.NewJWTRequest(1, true)
+	noAdminJWT := tape.NewJWTRequest(1, false)
 
 	g.Describe("User", func() {
 
@@ -70,6 +96,154 @@ func TestUser(t *testing.T) {
 			g.Assert(len(usersActual)).Equal(len(usersExpected))
 		})
 
+		g.It("Query should return only the selected fields", func() {
+			w := tape.Get("/api/v1/users?fields=id,first_name", adminJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			users := []map[string]interface{}{}
+			err := json.NewDecoder(w.Body).Decode(&users)
+			g.Assert(err).Equal(nil)
+			g.Assert(len(users) > 0).IsTrue()
+			for _, user := range users {
+				g.Assert(len(user)).Equal(2)
+				_, hasID := user["id"]
+				_, hasFirstName := user["first_name"]
+				g.Assert(hasID && hasFirstName).IsTrue()
+			}
+
+			w = tape.Get("/api/v1/users/1?fields=id,first_name", adminJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+			user := map[string]interface{}{}
+			err = json.NewDecoder(w.Body).Decode(&user)
+			g.Assert(err).Equal(nil)
+			g.Assert(len(user)).Equal(2)
+			g.Assert(user["id"]).Equal(float64(1))
+
+			w = tape.Get("/api/v1/users?fields=id,password", adminJWT)
+			g.Assert(w.Code).Equal(http.StatusBadRequest)
+		})
+
+		g.It("Query should ignore trailing slashes", func() {
+			usersExpected, err := stores.User.GetAll()
+			g.Assert(err).Equal(nil)
+
+			for _, url := range []string{"/api/v1/users", "/api/v1/users/"} {
+				w := tape.Get(url, adminJWT)
+				g.Assert(w.Code).Equal(http.StatusOK)
+
+				usersActual := []model.User{}
+				err = json.NewDecoder(w.Body).Decode(&usersActual)
+				g.Assert(err).Equal(nil)
+				g.Assert(len(usersActual)).Equal(len(usersExpected))
+			}
+
+			w := tape.Get("/api/v1/users/1/", adminJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+		})
+
+		g.It("Query should honor If-None-Match", func() {
+			w := tape.Get("/api/v1/users", adminJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+			etag := w.Header().Get("ETag")
+			g.Assert(strings.HasPrefix(etag, "W/")).IsTrue()
+
+			w = tape.Get("/api/v1/users", adminJWT, ifNoneMatch(etag))
+			g.Assert(w.Code).Equal(http.StatusNotModified)
+			g.Assert(w.Body.Len()).Equal(0)
+
+			// the list changes
+			err := stores.User.Delete(113)
+			g.Assert(err).Equal(nil)
+
+			w = tape.Get("/api/v1/users", adminJWT, ifNoneMatch(etag))
+			g.Assert(w.Code).Equal(http.StatusOK)
+			g.Assert(w.Header().Get("ETag") != etag).IsTrue()
+		})
+
+		g.It("Query should paginate and link the neighbouring pages", func() {
+			w := tape.Get("/api/v1/users", adminJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+			g.Assert(w.Header().Get("Link")).Equal("")
+
+			usersAll := []UserResponse{}
+			err := json.NewDecoder(w.Body).Decode(&usersAll)
+			g.Assert(err).Equal(nil)
+			g.Assert(len(usersAll) > 15).IsTrue()
+
+			w = tape.Get("/api/v1/users?page=2&per_page=5", adminJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			usersPage := []UserResponse{}
+			err = json.NewDecoder(w.Body).Decode(&usersPage)
+			g.Assert(err).Equal(nil)
+			g.Assert(len(usersPage)).Equal(5)
+			g.Assert(usersPage[0].ID).Equal(usersAll[5].ID)
+
+			last := (len(usersAll) + 4) / 5
+			link := w.Header().Get("Link")
+			g.Assert(strings.Contains(link, `</api/v1/users?page=3&per_page=5>; rel="next"`)).IsTrue()
+			g.Assert(strings.Contains(link, `</api/v1/users?page=1&per_page=5>; rel="prev"`)).IsTrue()
+			g.Assert(strings.Contains(link, fmt.Sprintf(`</api/v1/users?page=%d&per_page=5>; rel="last"`, last))).IsTrue()
+
+			// the last page has no next page
+			w = tape.Get(fmt.Sprintf("/api/v1/users?page=%d&per_page=5", last), adminJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+			g.Assert(strings.Contains(w.Header().Get("Link"), `rel="next"`)).IsFalse()
+
+			w = tape.Get("/api/v1/users?per_page=0", adminJWT)
+			g.Assert(w.Code).Equal(http.StatusBadRequest)
+		})
+
+		g.It("Should wrap the list of users in an envelope on request", func() {
+			w := tape.Get("/api/v1/users", adminJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+			etag := w.Header().Get("ETag")
+
+			usersAll := []UserResponse{}
+			err := json.NewDecoder(w.Body).Decode(&usersAll)
+			g.Assert(err).Equal(nil)
+
+			w = tape.Get("/api/v1/users?page=2&per_page=5", adminJWT, withEnvelope(true))
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			envelope := struct {
+				Data []UserResponse `json:"data"`
+				Meta EnvelopeMeta   `json:"meta"`
+			}{}
+			err = json.NewDecoder(w.Body).Decode(&envelope)
+			g.Assert(err).Equal(nil)
+			g.Assert(len(envelope.Data)).Equal(5)
+			g.Assert(envelope.Data[0].ID).Equal(usersAll[5].ID)
+			g.Assert(envelope.Meta.RequestID != "").IsTrue()
+			g.Assert(envelope.Meta.Pagination != nil).IsTrue()
+			g.Assert(envelope.Meta.Pagination.Page).Equal(2)
+			g.Assert(envelope.Meta.Pagination.PerPage).Equal(5)
+			g.Assert(envelope.Meta.Pagination.Total).Equal(len(usersAll))
+			g.Assert(envelope.Meta.Pagination.LastPage).Equal((len(usersAll) + 4) / 5)
+			g.Assert(strings.Contains(w.Header().Get("Vary"), EnvelopeHeader)).IsTrue()
+
+			// the plain list is a different representation
+			w = tape.Get("/api/v1/users", adminJWT, withEnvelope(true), ifNoneMatch(etag))
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			// the global setting applies without header and can be overridden
+			configuration.Configuration.Server.HTTP.Envelope = true
+			defer func() { configuration.Configuration.Server.HTTP.Envelope = false }()
+
+			w = tape.Get("/api/v1/users", adminJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+			g.Assert(strings.HasPrefix(w.Body.String(), `{"data":`)).IsTrue()
+
+			w = tape.Get("/api/v1/users", adminJWT, withEnvelope(false))
+			g.Assert(w.Code).Equal(http.StatusOK)
+			g.Assert(strings.HasPrefix(w.Body.String(), `[`)).IsTrue()
+
+			// errors are never wrapped
+			w = tape.Get("/api/v1/users?per_page=0", adminJWT, withEnvelope(true))
+			g.Assert(w.Code).Equal(http.StatusBadRequest)
+			g.Assert(strings.Contains(w.Body.String(), `"data"`)).IsFalse()
+		})
+
 		g.It("Query should find a user", func() {
 			usersExpected, err := stores.User.Find("%%meinhard%%")
 			g.Assert(err).Equal(nil)
@@ -146,6 +320,116 @@ func TestUser(t *testing.T) {
 
 		})
 
+		g.It("Should merge duplicate accounts", func() {
+			submissionsDuplicate, err := DBGetInt(tape, "SELECT count(*) FROM submissions WHERE user_id = $1", 113)
+			g.Assert(err).Equal(nil)
+			g.Assert(submissionsDuplicate > 0).IsTrue()
+			tasksSubmitted, err := DBGetInt2(tape, "SELECT count(DISTINCT task_id) FROM submissions WHERE user_id IN ($1, $2)", 112, 113)
+			g.Assert(err).Equal(nil)
+
+			// both accounts got an extension for sheet 1, only the duplicate one for sheet 2
+			dueAt := NowUTC().Truncate(time.Second)
+			g.Assert(stores.Sheet.SetExtension(1, 112, dueAt)).Equal(nil)
+			g.Assert(stores.Sheet.SetExtension(1, 113, dueAt.Add(time.Hour))).Equal(nil)
+			g.Assert(stores.Sheet.SetExtension(2, 113, dueAt)).Equal(nil)
+			g.Assert(stores.User.AddLogin(113, 7)).Equal(nil)
+
+			usersBefore, err := stores.User.GetAll()
+			g.Assert(err).Equal(nil)
+
+			w := tape.Post("/api/v1/users/112/merge/113", H{}, noAdminJWT)
+			g.Assert(w.Code).Equal(http.StatusForbidden)
+
+			w = tape.Post("/api/v1/users/112/merge/112", H{}, adminJWT)
+			g.Assert(w.Code).Equal(http.StatusBadRequest)
+
+			w = tape.Post("/api/v1/users/112/merge/113", H{}, adminJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			// one submission per task
+			submissionsAfter, err := DBGetInt(tape, "SELECT count(*) FROM submissions WHERE user_id = $1", 112)
+			g.Assert(err).Equal(nil)
+			g.Assert(submissionsAfter).Equal(tasksSubmitted)
+
+			enrollmentsDuplicate, err := DBGetInt(tape, "SELECT count(*) FROM user_course WHERE user_id = $1", 113)
+			g.Assert(err).Equal(nil)
+			g.Assert(enrollmentsDuplicate).Equal(0)
+
+			extension, err := stores.Sheet.GetExtension(1, 112)
+			g.Assert(err).Equal(nil)
+			g.Assert(extension.DueAt.Equal(dueAt.Add(time.Hour))).IsTrue()
+			_, err = stores.Sheet.GetExtension(2, 112)
+			g.Assert(err).Equal(nil)
+			extensionsDuplicate, err := DBGetInt(tape, "SELECT count(*) FROM sheet_extensions WHERE user_id = $1", 113)
+			g.Assert(err).Equal(nil)
+			g.Assert(extensionsDuplicate).Equal(0)
+
+			loginsDuplicate, err := DBGetInt(tape, "SELECT count(*) FROM login_history WHERE user_id = $1", 113)
+			g.Assert(err).Equal(nil)
+			g.Assert(loginsDuplicate).Equal(0)
+
+			duplicate, err := stores.User.Get(113)
+			g.Assert(err).Equal(nil)
+			g.Assert(duplicate.DeletedAt.Valid).IsTrue()
+
+			usersAfter, err := stores.User.GetAll()
+			g.Assert(err).Equal(nil)
+			g.Assert(len(usersAfter)).Equal(len(usersBefore) - 1)
+
+			_, err = stores.User.FindByEmail(duplicate.Email)
+			g.Assert(err != nil).IsTrue()
+
+			w = tape.Post("/api/v1/users/112/merge/113", H{}, adminJWT)
+			g.Assert(w.Code).Equal(http.StatusBadRequest)
+		})
+
+		g.It("Should keep the latest submission if both accounts submitted a task", func() {
+			task, err := stores.Task.Create(&model.Task{Name: "new Task", MaxPoints: 10}, 1)
+			g.Assert(err).Equal(nil)
+
+			// the duplicate uploaded last
+			uploadedAt := NowUTC()
+			submissionIDs := []int64{}
+			for k, userID := range []int64{112, 113} {
+				submission, err := stores.Submission.Create(&model.Submission{UserID: userID, TaskID: task.ID})
+				g.Assert(err).Equal(nil)
+				_, err = stores.Grade.Create(&model.Grade{
+					SubmissionID:   submission.ID,
+					TutorID:        2,
+					AcquiredPoints: 3 + k,
+					EnqueuedAt:     null.TimeFrom(uploadedAt.Add(time.Duration(k) * time.Minute)),
+				})
+				g.Assert(err).Equal(nil)
+				submissionIDs = append(submissionIDs, submission.ID)
+			}
+
+			superseded := helper.NewSubmissionFileHandle(submissionIDs[0])
+			g.Assert(os.MkdirAll(filepath.Dir(superseded.Path()), 0755)).Equal(nil)
+			g.Assert(ioutil.WriteFile(superseded.Path(), []byte("PK"), 0644)).Equal(nil)
+			defer superseded.Delete()
+
+			w := tape.Post("/api/v1/users/112/merge/113", H{}, adminJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			submissions, err := DBGetInt2(tape, "SELECT count(*) FROM submissions WHERE user_id = $1 AND task_id = $2", 112, task.ID)
+			g.Assert(err).Equal(nil)
+			g.Assert(submissions).Equal(1)
+
+			submission, err := stores.Submission.GetByUserAndTask(112, task.ID)
+			g.Assert(err).Equal(nil)
+			g.Assert(submission.ID).Equal(submissionIDs[1])
+
+			grade, err := stores.Grade.GetForSubmission(submission.ID)
+			g.Assert(err).Equal(nil)
+			g.Assert(grade.AcquiredPoints).Equal(4)
+
+			grades, err := DBGetInt(tape, "SELECT count(*) FROM grades WHERE submission_id = $1", submissionIDs[0])
+			g.Assert(err).Equal(nil)
+			g.Assert(grades).Equal(0)
+
+			g.Assert(superseded.Exists()).IsFalse()
+		})
+
 		g.It("Should delete with claims", func() {
 			usersBefore, err := stores.User.GetAll()
 			g.Assert(err).Equal(nil)
@@ -161,6 +445,252 @@ func TestUser(t *testing.T) {
 			g.Assert(len(usersAfter)).Equal(len(usersBefore) - 1)
 		})
 
+		g.It("Should bulk delete users and skip root users", func() {
+			_, err := tape.DB.Exec("UPDATE users SET root = true WHERE id = 3")
+			g.Assert(err).Equal(nil)
+
+			usersBefore, err := stores.User.GetAll()
+			g.Assert(err).Equal(nil)
+
+			data := H{"ids": []int64{112, 3, 1, 113, 999999}}
+
+			w := tape.Post("/api/v1/users/bulk_delete", data, noAdminJWT)
+			g.Assert(w.Code).Equal(http.StatusForbidden)
+
+			w = tape.Post("/api/v1/users/bulk_delete", H{"ids": []int64{}}, adminJWT)
+			g.Assert(w.Code).Equal(http.StatusBadRequest)
+
+			w = tape.Post("/api/v1/users/bulk_delete", data, adminJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			result := BulkDeleteUsersResponse{}
+			err = json.NewDecoder(w.Body).Decode(&result)
+			g.Assert(err).Equal(nil)
+
+			status := map[int64]string{}
+			for _, entry := range result.Results {
+				status[entry.ID] = entry.Status
+			}
+			g.Assert(len(status)).Equal(5)
+			g.Assert(status[112]).Equal("deleted")
+			g.Assert(status[113]).Equal("deleted")
+			g.Assert(status[3]).Equal("skipped_root")
+			g.Assert(status[1]).Equal("skipped_self")
+			g.Assert(status[999999]).Equal("not_found")
+
+			for _, userID := range []int64{112, 113} {
+				user, err := stores.User.Get(userID)
+				g.Assert(err).Equal(nil)
+				g.Assert(user.DeletedAt.Valid).IsTrue()
+			}
+
+			root, err := stores.User.Get(3)
+			g.Assert(err).Equal(nil)
+			g.Assert(root.DeletedAt.Valid).IsFalse()
+
+			usersAfter, err := stores.User.GetAll()
+			g.Assert(err).Equal(nil)
+			g.Assert(len(usersAfter)).Equal(len(usersBefore) - 2)
+
+			// already deleted users are reported as missing
+			w = tape.Post("/api/v1/users/bulk_delete", H{"ids": []int64{112}}, adminJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+			result = BulkDeleteUsersResponse{}
+			err = json.NewDecoder(w.Body).Decode(&result)
+			g.Assert(err).Equal(nil)
+			g.Assert(result.Results[0].Status).Equal("not_found")
+		})
+
+		g.It("Should force-confirm users (admin only)", func() {
+			userBefore, err := stores.User.Get(1)
+			g.Assert(err).Equal(nil)
+			userBefore.ConfirmEmailToken = null.StringFrom("testtoken")
+			err = stores.User.Update(userBefore)
+			g.Assert(err).Equal(nil)
+
+			w := tape.Post("/api/v1/users/1/confirm", H{})
+			g.Assert(w.Code).Equal(http.StatusUnauthorized)
+
+			w = tape.Post("/api/v1/users/1/confirm", H{}, noAdminJWT)
+			g.Assert(w.Code).Equal(http.StatusForbidden)
+
+			userAfter, err := stores.User.Get(1)
+			g.Assert(err).Equal(nil)
+			g.Assert(userAfter.ConfirmEmailToken.Valid).Equal(true)
+
+			w = tape.Post("/api/v1/auth/sessions",
+				H{
+					"email":          "test@uni-tuebingen.de",
+					"plain_password": "test",
+				},
+			)
+			g.Assert(w.Code).Equal(http.StatusBadRequest)
+
+			w = tape.Post("/api/v1/users/1/confirm", H{}, adminJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			userAfter, err = stores.User.Get(1)
+			g.Assert(err).Equal(nil)
+			g.Assert(userAfter.ConfirmEmailToken.Valid).Equal(false)
+
+			w = tape.Post("/api/v1/auth/sessions",
+				H{
+					"email":          "test@uni-tuebingen.de",
+					"plain_password": "test",
+				},
+			)
+			g.Assert(w.Code).Equal(http.StatusOK)
+		})
+
+		g.It("Should reissue the email confirmation (admin only)", func() {
+			userBefore, err := stores.User.Get(112)
+			g.Assert(err).Equal(nil)
+			g.Assert(userBefore.ConfirmEmailToken.Valid).IsFalse()
+
+			mailer := &recordingMailer{}
+			email.DefaultMail = mailer
+			defer func() { email.DefaultMail = email.VoidMail }()
+
+			w := tape.Post("/api/v1/users/112/reconfirm_email", H{})
+			g.Assert(w.Code).Equal(http.StatusUnauthorized)
+
+			w = tape.Post("/api/v1/users/112/reconfirm_email", H{}, noAdminJWT)
+			g.Assert(w.Code).Equal(http.StatusForbidden)
+
+			w = tape.Post("/api/v1/users/112/reconfirm_email", H{}, adminJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			userAfter, err := stores.User.Get(112)
+			g.Assert(err).Equal(nil)
+			g.Assert(userAfter.ConfirmEmailToken.Valid).IsTrue()
+
+			// emails are sent in the background
+			for k := 0; k < 50 && mailer.Count() == 0; k++ {
+				time.Sleep(10 * time.Millisecond)
+			}
+			g.Assert(mailer.Count()).Equal(1)
+			g.Assert(mailer.Sent[0].To).Equal(userAfter.Email)
+			g.Assert(strings.Contains(mailer.Sent[0].Body, userAfter.ConfirmEmailToken.String)).IsTrue()
+
+			// each request issues a new token
+			w = tape.Post("/api/v1/users/112/reconfirm_email", H{}, adminJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			userAgain, err := stores.User.Get(112)
+			g.Assert(err).Equal(nil)
+			g.Assert(userAgain.ConfirmEmailToken.String != userAfter.ConfirmEmailToken.String).IsTrue()
+		})
+
+		g.It("Should impersonate users (admin only)", func() {
+			hook := test.NewGlobal()
+			defer hook.Reset()
+
+			w := tape.Post("/api/v1/users/2/impersonate", H{})
+			g.Assert(w.Code).Equal(http.StatusUnauthorized)
+
+			w = tape.Post("/api/v1/users/2/impersonate", H{}, noAdminJWT)
+			g.Assert(w.Code).Equal(http.StatusForbidden)
+
+			// admins cannot impersonate themselves
+			w = tape.Post("/api/v1/users/1/impersonate", H{}, adminJWT)
+			g.Assert(w.Code).Equal(http.StatusBadRequest)
+
+			for _, entry := range hook.AllEntries() {
+				g.Assert(entry.Data["action"] == "user.impersonate").IsFalse()
+			}
+
+			w = tape.Post("/api/v1/users/2/impersonate", H{}, adminJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			resp := ImpersonationResponse{}
+			err := json.NewDecoder(w.Body).Decode(&resp)
+			g.Assert(err).Equal(nil)
+			g.Assert(resp.UserID).Equal(int64(2))
+
+			claims := &authenticate.AccessClaims{}
+			err = claims.ParseAccessClaimsFromToken(configuration.Configuration.Server.Authentication.JWT.Secret, resp.Access.Token)
+			g.Assert(err).Equal(nil)
+			g.Assert(claims.LoginID).Equal(int64(2))
+			g.Assert(claims.ImpersonatorID).Equal(int64(1))
+			g.Assert(claims.Root).Equal(false)
+			g.Assert(claims.ExpiresAt).Equal(resp.ExpiresAt.Unix())
+
+			audited := false
+			for _, entry := range hook.AllEntries() {
+				if entry.Data["action"] == "user.impersonate" {
+					audited = true
+					g.Assert(entry.Data["module"]).Equal("audit")
+					g.Assert(entry.Data["actor_id"]).Equal(int64(1))
+					g.Assert(entry.Data["user_id"]).Equal(int64(2))
+				}
+			}
+			g.Assert(audited).IsTrue()
+
+			// the token acts as the impersonated user
+			w = tape.Get("/api/v1/me", bearerRequest{Token: resp.Access.Token})
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			me := UserResponse{}
+			err = json.NewDecoder(w.Body).Decode(&me)
+			g.Assert(err).Equal(nil)
+			g.Assert(me.ID).Equal(int64(2))
+
+			// impersonations cannot be chained
+			w = tape.Post("/api/v1/users/3/impersonate", H{}, bearerRequest{Token: resp.Access.Token})
+			g.Assert(w.Code).Equal(http.StatusForbidden)
+
+			// nor be used to change the credentials of the user
+			impersonation := bearerRequest{Token: resp.Access.Token}
+			w = tape.Post("/api/v1/account/api_keys", H{"name": "backdoor", "scope": "write"}, impersonation)
+			g.Assert(w.Code).Equal(http.StatusForbidden)
+			w = tape.Post("/api/v1/account/2fa/enroll", H{}, impersonation)
+			g.Assert(w.Code).Equal(http.StatusForbidden)
+			w = tape.Post("/api/v1/account/calendar_token", H{}, impersonation)
+			g.Assert(w.Code).Equal(http.StatusForbidden)
+			w = tape.Patch("/api/v1/account", H{"account": H{"plain_password": "new_password"}}, impersonation)
+			g.Assert(w.Code).Equal(http.StatusForbidden)
+			w = tape.Delete("/api/v1/auth/sessions/all", impersonation)
+			g.Assert(w.Code).Equal(http.StatusForbidden)
+
+			apiKeys, err := stores.APIKey.APIKeysOfUser(2)
+			g.Assert(err).Equal(nil)
+			g.Assert(len(apiKeys)).Equal(0)
+		})
+
+		g.It("Should get the avatar of another user", func() {
+			defer helper.NewAvatarFileHandle(1).Delete()
+
+			studentJWT := tape.NewJWTRequest(112, false)
+
+			w := tape.Get("/api/v1/users/1/avatar")
+			g.Assert(w.Code).Equal(http.StatusUnauthorized)
+
+			// no avatar so far
+			w = tape.Get("/api/v1/users/1/avatar", studentJWT)
+			g.Assert(w.Code).Equal(http.StatusNotFound)
+
+			avatarFilename := fmt.Sprintf("%s/default-avatar.png", configuration.Configuration.Server.Debugging.Fixtures)
+			w, err := tape.Upload("/api/v1/account/avatar", avatarFilename, "image/png", adminJWT)
+			g.Assert(err).Equal(nil)
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			w = tape.Get("/api/v1/users/1/avatar", studentJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+			g.Assert(strings.HasSuffix(w.Header().Get("Content-Type"), "png")).IsTrue()
+			g.Assert(w.Body.Len() > 0).IsTrue()
+			etag := w.Header().Get("ETag")
+			g.Assert(strings.HasPrefix(etag, "W/")).IsTrue()
+
+			// same caching as for the own avatar
+			w = tape.Get("/api/v1/account/avatar", adminJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+			g.Assert(w.Header().Get("ETag")).Equal(etag)
+
+			w = tape.Get("/api/v1/users/1/avatar", studentJWT, ifNoneMatch(etag))
+			g.Assert(w.Code).Equal(http.StatusNotModified)
+			g.Assert(w.Body.Len()).Equal(0)
+		})
+
 		g.It("Self-query require claims", func() {
 			w := tape.Get("/api/v1/me")
 			g.Assert(w.Code).Equal(http.StatusUnauthorized)
@@ -0,0 +1,177 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package app
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+	"github.com/infomark-org/infomark/auth"
+	"github.com/infomark-org/infomark/model"
+	"github.com/infomark-org/infomark/symbol"
+	"github.com/infomark-org/infomark/webhook"
+	"github.com/sirupsen/logrus"
+)
+
+// WebhookResource specifies webhook management handler.
+type WebhookResource struct {
+	Stores *Stores
+}
+
+// NewWebhookResource create and returns a WebhookResource.
+func NewWebhookResource(stores *Stores) *WebhookResource {
+	return &WebhookResource{
+		Stores: stores,
+	}
+}
+
+// IndexHandler is public endpoint for
+// URL: /courses/{course_id}/webhooks
+// URLPARAM: course_id,integer
+// METHOD: get
+// TAG: webhooks
+// RESPONSE: 200,WebhookResponseList
+// RESPONSE: 400,BadRequest
+// RESPONSE: 401,Unauthenticated
+// RESPONSE: 403,Unauthorized
+// SUMMARY:  get all webhooks of a course
+func (rs *WebhookResource) IndexHandler(w http.ResponseWriter, r *http.Request) {
+	course := r.Context().Value(symbol.CtxKeyCourse).(*model.Course)
+
+	webhooks, err := rs.Stores.Webhook.WebhooksOfCourse(course.ID)
+	if err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
+	if err := render.RenderList(w, r, rs.newWebhookListResponse(webhooks)); err != nil {
+		render.Render(w, r, ErrRender(err))
+		return
+	}
+}
+
+// CreateHandler is public endpoint for
+// URL: /courses/{course_id}/webhooks
+// URLPARAM: course_id,integer
+// METHOD: post
+// TAG: webhooks
+// REQUEST: WebhookRequest
+// RESPONSE: 201,WebhookResponse
+// RESPONSE: 400,BadRequest
+// RESPONSE: 401,Unauthenticated
+// RESPONSE: 403,Unauthorized
+// SUMMARY:  subscribe an URL to events of a course
+// DESCRIPTION:
+// Events are "submission.graded" and "enrollment.created". Each event is sent
+// as a JSON POST request. The header "X-InfoMark-Signature" contains the
+// HMAC-SHA256 of the body using the secret, which is only part of this response.
+func (rs *WebhookResource) CreateHandler(w http.ResponseWriter, r *http.Request) {
+	course := r.Context().Value(symbol.CtxKeyCourse).(*model.Course)
+
+	data := &WebhookRequest{}
+	if err := render.Bind(r, data); err != nil {
+		render.Render(w, r, ErrBadRequestWithDetails(err))
+		return
+	}
+
+	newWebhook, err := rs.Stores.Webhook.Create(&model.Webhook{
+		CourseID: course.ID,
+		URL:      data.URL,
+		Events:   data.EventsString(),
+		Secret:   auth.GenerateToken(32),
+	})
+	if err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
+	resp := rs.newWebhookResponse(newWebhook)
+	resp.Secret = newWebhook.Secret
+
+	render.Status(r, http.StatusCreated)
+	if err := render.Render(w, r, resp); err != nil {
+		render.Render(w, r, ErrRender(err))
+		return
+	}
+}
+
+// DeleteHandler is public endpoint for
+// URL: /courses/{course_id}/webhooks/{webhook_id}
+// URLPARAM: course_id,integer
+// URLPARAM: webhook_id,integer
+// METHOD: delete
+// TAG: webhooks
+// RESPONSE: 204,NoContent
+// RESPONSE: 400,BadRequest
+// RESPONSE: 401,Unauthenticated
+// RESPONSE: 403,Unauthorized
+// SUMMARY:  delete a webhook
+func (rs *WebhookResource) DeleteHandler(w http.ResponseWriter, r *http.Request) {
+	course := r.Context().Value(symbol.CtxKeyCourse).(*model.Course)
+
+	webhookID, err := strconv.ParseInt(chi.URLParam(r, "webhook_id"), 10, 64)
+	if err != nil {
+		render.Render(w, r, ErrBadRequest)
+		return
+	}
+
+	hook, err := rs.Stores.Webhook.Get(webhookID)
+	if err != nil || hook.CourseID != course.ID {
+		render.Render(w, r, ErrNotFound)
+		return
+	}
+
+	if err := rs.Stores.Webhook.Delete(hook.ID); err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
+	render.Status(r, http.StatusNoContent)
+}
+
+// dispatchWebhooks queues deliveries for all webhooks of a course which
+// subscribed to the event. Errors are only logged as they should not affect
+// the request.
+func dispatchWebhooks(stores *Stores, courseID int64, event string, data interface{}) {
+	hooks, err := stores.Webhook.WebhooksOfCourse(courseID)
+	if err != nil {
+		logrus.WithField("module", "webhook").Error(err)
+		return
+	}
+
+	for k := range hooks {
+		if !hooks[k].Subscribes(event) {
+			continue
+		}
+
+		delivery, err := webhook.NewDelivery(hooks[k].URL, hooks[k].Secret, event, courseID, data)
+		if err != nil {
+			logrus.WithField("module", "webhook").Error(err)
+			continue
+		}
+		if !webhook.Enqueue(delivery) {
+			logrus.WithFields(logrus.Fields{
+				"module":     "webhook",
+				"webhook_id": hooks[k].ID,
+				"event":      event,
+			}).Warn("delivery queue is full, dropped delivery")
+		}
+	}
+}
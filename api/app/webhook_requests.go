@@ -0,0 +1,72 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package app
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	validation "github.com/go-ozzo/ozzo-validation"
+	"github.com/go-ozzo/ozzo-validation/is"
+	"github.com/infomark-org/infomark/webhook"
+)
+
+// WebhookRequest is the request payload for webhook management.
+type WebhookRequest struct {
+	URL    string   `json:"url" example:"https://dashboard.uni-tuebingen.de/infomark"`
+	Events []string `json:"events" example:"submission.graded"`
+}
+
+// Bind preprocesses a WebhookRequest.
+func (body *WebhookRequest) Bind(r *http.Request) error {
+	if body == nil {
+		return errors.New("missing \"webhook\" data")
+	}
+
+	body.URL = strings.TrimSpace(body.URL)
+
+	if err := validation.ValidateStruct(body,
+		validation.Field(&body.URL, validation.Required, is.URL),
+		validation.Field(&body.Events, validation.Required),
+	); err != nil {
+		return err
+	}
+
+	if !strings.HasPrefix(body.URL, "http://") && !strings.HasPrefix(body.URL, "https://") {
+		return errors.New("url: must use http or https")
+	}
+
+	if err := webhook.ValidateTarget(body.URL); err != nil {
+		return err
+	}
+
+	for _, event := range body.Events {
+		if err := validation.Validate(event, validation.In(webhook.Events...)); err != nil {
+			return fmt.Errorf("events: unknown event %q", event)
+		}
+	}
+
+	return nil
+}
+
+// EventsString joins the events for storing them.
+func (body *WebhookRequest) EventsString() string {
+	return strings.Join(body.Events, ",")
+}
@@ -0,0 +1,56 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package app
+
+import (
+	"net/http"
+
+	"github.com/go-chi/render"
+	"github.com/infomark-org/infomark/model"
+)
+
+// WebhookResponse is the response payload for webhook management. The secret
+// is only part of the response when the webhook has been created.
+type WebhookResponse struct {
+	ID     int64    `json:"id" example:"1"`
+	URL    string   `json:"url" example:"https://dashboard.uni-tuebingen.de/infomark"`
+	Events []string `json:"events" example:"submission.graded"`
+	Secret string   `json:"secret,omitempty" example:"3f5b1e2a9c7d4e6f8a0b2c4d6e8f0a1b" required:"false"`
+}
+
+// Render post-processes a WebhookResponse.
+func (body *WebhookResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+// newWebhookResponse creates a response from a webhook model.
+func (rs *WebhookResource) newWebhookResponse(p *model.Webhook) *WebhookResponse {
+	return &WebhookResponse{
+		ID:     p.ID,
+		URL:    p.URL,
+		Events: p.EventList(),
+	}
+}
+
+func (rs *WebhookResource) newWebhookListResponse(webhooks []model.Webhook) []render.Renderer {
+	list := []render.Renderer{}
+	for k := range webhooks {
+		list = append(list, rs.newWebhookResponse(&webhooks[k]))
+	}
+	return list
+}
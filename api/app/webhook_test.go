@@ -0,0 +1,180 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2019 ComputerGraphics Tuebingen
+//               2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/franela/goblin"
+	"github.com/infomark-org/infomark/email"
+	"github.com/infomark-org/infomark/webhook"
+)
+
+func TestWebhook(t *testing.T) {
+
+	g := goblin.Goblin(t)
+	email.DefaultMail = email.VoidMail
+	webhook.DefaultDeliverer = webhook.HTTPDelivery
+	go webhook.BackgroundDeliver(webhook.OutgoingDeliveriesChannel)
+
+	tape := NewTape()
+
+	var stores *Stores
+
+	studentJWT := tape.NewJWTRequest(112, false)
+	tutorJWT := tape.NewJWTRequest(2, false)
+	noAdminJWT := tape.NewJWTRequest(1, false)
+
+	g.Describe("Webhook", func() {
+
+		g.BeforeEach(func() {
+			tape.BeforeEach()
+			stores = NewStores(tape.DB)
+		})
+
+		g.It("Only admins can manage webhooks", func() {
+			data := H{
+				"url":    "https://example.com/hook",
+				"events": []string{webhook.EventSubmissionGraded},
+			}
+
+			w := tape.Post("/api/v1/courses/1/webhooks", data, studentJWT)
+			g.Assert(w.Code).Equal(http.StatusForbidden)
+
+			w = tape.Post("/api/v1/courses/1/webhooks", data, tutorJWT)
+			g.Assert(w.Code).Equal(http.StatusForbidden)
+
+			w = tape.Post("/api/v1/courses/1/webhooks", data, noAdminJWT)
+			g.Assert(w.Code).Equal(http.StatusCreated)
+
+			created := &WebhookResponse{}
+			err := json.NewDecoder(w.Body).Decode(created)
+			g.Assert(err).Equal(nil)
+			g.Assert(created.Secret != "").IsTrue()
+			g.Assert(created.Events).Equal([]string{webhook.EventSubmissionGraded})
+
+			w = tape.Get("/api/v1/courses/1/webhooks", noAdminJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+			list := []WebhookResponse{}
+			err = json.NewDecoder(w.Body).Decode(&list)
+			g.Assert(err).Equal(nil)
+			g.Assert(len(list)).Equal(1)
+			g.Assert(list[0].Secret).Equal("")
+
+			w = tape.Delete(fmt.Sprintf("/api/v1/courses/1/webhooks/%d", created.ID), noAdminJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			hooks, err := stores.Webhook.WebhooksOfCourse(1)
+			g.Assert(err).Equal(nil)
+			g.Assert(len(hooks)).Equal(0)
+		})
+
+		g.It("Should reject unknown events", func() {
+			w := tape.Post("/api/v1/courses/1/webhooks", H{
+				"url":    "https://example.com/hook",
+				"events": []string{"course.deleted"},
+			}, noAdminJWT)
+			g.Assert(w.Code).Equal(http.StatusBadRequest)
+		})
+
+		g.It("Should reject webhooks to the internal network", func() {
+			for _, target := range []string{
+				"http://127.0.0.1:8080/hook",
+				"http://localhost/hook",
+				"http://10.0.0.5/hook",
+				"http://169.254.169.254/latest/meta-data",
+				"http://[::1]/hook",
+			} {
+				w := tape.Post("/api/v1/courses/1/webhooks", H{
+					"url":    target,
+					"events": []string{webhook.EventSubmissionGraded},
+				}, noAdminJWT)
+				g.Assert(w.Code).Equal(http.StatusBadRequest)
+			}
+
+			// deliveries are checked when dialling as well
+			deliverer := &webhook.HTTPDeliverer{Client: webhook.NewHTTPDeliverer().Client}
+			err := deliverer.Deliver(&webhook.Delivery{URL: "http://127.0.0.1:1/hook"})
+			g.Assert(err != nil).IsTrue()
+			g.Assert(strings.Contains(err.Error(), webhook.ErrPrivateTarget.Error())).IsTrue()
+		})
+
+		g.It("Should deliver an event when a submission is graded", func() {
+			// the receiver of this test listens on the loopback interface
+			webhook.AllowPrivateTargets = true
+			defer func() { webhook.AllowPrivateTargets = false }()
+
+			type received struct {
+				Header http.Header
+				Body   []byte
+			}
+			deliveries := make(chan received, 1)
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := ioutil.ReadAll(r.Body)
+				deliveries <- received{Header: r.Header, Body: body}
+			}))
+			defer server.Close()
+
+			w := tape.Post("/api/v1/courses/1/webhooks", H{
+				"url":    server.URL,
+				"events": []string{webhook.EventSubmissionGraded},
+			}, noAdminJWT)
+			g.Assert(w.Code).Equal(http.StatusCreated)
+			created := &WebhookResponse{}
+			g.Assert(json.NewDecoder(w.Body).Decode(created)).Equal(nil)
+
+			w = tape.Put("/api/v1/courses/1/grades/1", H{
+				"acquired_points": 3,
+				"feedback":        "Well done",
+			}, tutorJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			select {
+			case delivery := <-deliveries:
+				g.Assert(delivery.Header.Get(webhook.EventHeader)).Equal(webhook.EventSubmissionGraded)
+				g.Assert(delivery.Header.Get(webhook.SignatureHeader)).Equal(webhook.Sign(created.Secret, delivery.Body))
+
+				payload := struct {
+					Event    string        `json:"event"`
+					CourseID int64         `json:"course_id"`
+					Data     GradeResponse `json:"data"`
+				}{}
+				g.Assert(json.Unmarshal(delivery.Body, &payload)).Equal(nil)
+				g.Assert(payload.Event).Equal(webhook.EventSubmissionGraded)
+				g.Assert(payload.CourseID).Equal(int64(1))
+				g.Assert(payload.Data.ID).Equal(int64(1))
+				g.Assert(payload.Data.Feedback).Equal("Well done")
+			case <-time.After(5 * time.Second):
+				g.Fail("webhook was not delivered")
+			}
+		})
+
+		g.AfterEach(func() {
+			tape.AfterEach()
+		})
+	})
+}
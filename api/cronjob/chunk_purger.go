@@ -0,0 +1,40 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package cronjob
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/infomark-org/infomark/api/helper"
+)
+
+// ChunkPurger deletes the staged chunks of uploads which have been abandoned.
+type ChunkPurger struct {
+	MaxAge time.Duration
+}
+
+// Run executes a job to delete chunks which have not been continued in time.
+func (job *ChunkPurger) Run() {
+	deleted, err := helper.PurgeStaleChunks(job.MaxAge)
+	if err != nil {
+		fmt.Println(" Purging chunked uploads failed:", err)
+		return
+	}
+	fmt.Printf("Purged %d unfinished chunked uploads\n", deleted)
+}
@@ -0,0 +1,145 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package helper
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	pathpkg "path"
+	"strings"
+)
+
+// Archives created by some operating systems contain entries which are of no
+// use for grading (e.g. "__MACOSX" or ".DS_Store"). Others contain entries
+// which would be extracted outside of the working directory of the grader.
+
+// ErrUnsafeArchiveEntry is returned if an archive contains an absolute path or
+// a path leaving the extraction directory.
+var ErrUnsafeArchiveEntry = errors.New("the archive contains an entry with an unsafe path")
+
+// isUnsafeArchiveEntry tests whether an entry could escape the directory the
+// archive is extracted to.
+func isUnsafeArchiveEntry(name string) bool {
+	name = strings.Replace(name, "\\", "/", -1)
+	if strings.HasPrefix(name, "/") {
+		return true
+	}
+	// drive letters like "C:" are absolute on windows
+	if len(name) >= 2 && name[1] == ':' {
+		return true
+	}
+	for _, element := range strings.Split(name, "/") {
+		if element == ".." {
+			return true
+		}
+	}
+	return false
+}
+
+// isJunkArchiveEntry tests whether one of the path elements of an entry
+// matches one of the patterns.
+func isJunkArchiveEntry(name string, junkPatterns []string) bool {
+	for _, element := range strings.Split(strings.Replace(name, "\\", "/", -1), "/") {
+		if element == "" {
+			continue
+		}
+		for _, pattern := range junkPatterns {
+			if matched, _ := pathpkg.Match(pattern, element); matched {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// CleanArchive removes all entries matching one of the junk patterns from the
+// staged zip file and returns the number of removed entries. The file is
+// rejected with ErrUnsafeArchiveEntry if any entry has an unsafe path.
+func (c *ChunkedUpload) CleanArchive(junkPatterns []string) (int, error) {
+	path := c.Path()
+
+	reader, err := zip.OpenReader(path)
+	if err != nil {
+		return 0, err
+	}
+
+	keep := []*zip.File{}
+	for _, entry := range reader.File {
+		if isUnsafeArchiveEntry(entry.Name) {
+			reader.Close()
+			return 0, fmt.Errorf("%v: %s", ErrUnsafeArchiveEntry, entry.Name)
+		}
+		if !isJunkArchiveEntry(entry.Name, junkPatterns) {
+			keep = append(keep, entry)
+		}
+	}
+
+	removed := len(reader.File) - len(keep)
+	if removed == 0 {
+		reader.Close()
+		return 0, nil
+	}
+
+	err = writeZipEntries(path+".tmp", keep)
+	reader.Close()
+	if err != nil {
+		FileDelete(path + ".tmp")
+		return 0, err
+	}
+
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return 0, err
+	}
+	return removed, nil
+}
+
+// writeZipEntries creates a new zip file containing the given entries.
+func writeZipEntries(path string, entries []*zip.File) error {
+	hnd, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer hnd.Close()
+
+	zipWriter := zip.NewWriter(hnd)
+	for _, entry := range entries {
+		header := entry.FileHeader
+		writer, err := zipWriter.CreateHeader(&header)
+		if err != nil {
+			return err
+		}
+
+		src, err := entry.Open()
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(writer, src)
+		src.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := zipWriter.Close(); err != nil {
+		return err
+	}
+	return hnd.Sync()
+}
@@ -0,0 +1,197 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package helper
+
+import (
+	"archive/zip"
+	"bytes"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Two archives are compared file by file. Text files are compared line by
+// line using the longest common subsequence of both versions.
+
+// maxDiffCells bounds the size of the table used to compare two versions of
+// a file. Larger files are reported as entirely replaced.
+const maxDiffCells = 4 << 20
+
+// DiffLine is a single line of a file diff. Op is "=" for lines contained in
+// both versions, "-" for removed and "+" for added lines. The line numbers
+// are 1-based and zero if the line does not exist in the respective version.
+type DiffLine struct {
+	Op      string
+	OldLine int
+	NewLine int
+	Text    string
+}
+
+// ArchiveFileDiff describes the changes of a single file between two
+// archives. Status is one of "added", "removed", "modified" or "unchanged".
+// Binary files are not compared line by line.
+type ArchiveFileDiff struct {
+	Name   string
+	Status string
+	Binary bool
+	Lines  []DiffLine
+}
+
+// DiffArchives compares the zip files of two handles. The result is sorted by
+// the names of the files.
+func DiffArchives(before *FileHandle, after *FileHandle) ([]ArchiveFileDiff, error) {
+	oldFiles, err := readArchiveFiles(before.Path())
+	if err != nil {
+		return nil, err
+	}
+	newFiles, err := readArchiveFiles(after.Path())
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	for name := range oldFiles {
+		names = append(names, name)
+	}
+	for name := range newFiles {
+		if _, ok := oldFiles[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	diffs := []ArchiveFileDiff{}
+	for _, name := range names {
+		oldContent, inOld := oldFiles[name]
+		newContent, inNew := newFiles[name]
+
+		diff := ArchiveFileDiff{Name: name}
+		switch {
+		case !inOld:
+			diff.Status = "added"
+		case !inNew:
+			diff.Status = "removed"
+		case bytes.Equal(oldContent, newContent):
+			diff.Status = "unchanged"
+		default:
+			diff.Status = "modified"
+		}
+
+		diff.Binary = isBinaryContent(oldContent) || isBinaryContent(newContent)
+		if !diff.Binary && diff.Status != "unchanged" {
+			diff.Lines = DiffLines(splitLines(oldContent), splitLines(newContent))
+		}
+		diffs = append(diffs, diff)
+	}
+
+	return diffs, nil
+}
+
+// DiffLines computes a line based diff between two versions of a text.
+func DiffLines(before []string, after []string) []DiffLine {
+	lines := []DiffLine{}
+
+	if len(before)*len(after) > maxDiffCells {
+		for k, text := range before {
+			lines = append(lines, DiffLine{Op: "-", OldLine: k + 1, Text: text})
+		}
+		for k, text := range after {
+			lines = append(lines, DiffLine{Op: "+", NewLine: k + 1, Text: text})
+		}
+		return lines
+	}
+
+	// common[i][j] is the length of the longest common subsequence of
+	// before[i:] and after[j:]
+	common := make([][]int, len(before)+1)
+	for i := range common {
+		common[i] = make([]int, len(after)+1)
+	}
+	for i := len(before) - 1; i >= 0; i-- {
+		for j := len(after) - 1; j >= 0; j-- {
+			if before[i] == after[j] {
+				common[i][j] = common[i+1][j+1] + 1
+			} else if common[i+1][j] >= common[i][j+1] {
+				common[i][j] = common[i+1][j]
+			} else {
+				common[i][j] = common[i][j+1]
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(before) || j < len(after) {
+		switch {
+		case i < len(before) && j < len(after) && before[i] == after[j]:
+			lines = append(lines, DiffLine{Op: "=", OldLine: i + 1, NewLine: j + 1, Text: before[i]})
+			i++
+			j++
+		case j == len(after) || (i < len(before) && common[i+1][j] >= common[i][j+1]):
+			lines = append(lines, DiffLine{Op: "-", OldLine: i + 1, Text: before[i]})
+			i++
+		default:
+			lines = append(lines, DiffLine{Op: "+", NewLine: j + 1, Text: after[j]})
+			j++
+		}
+	}
+
+	return lines
+}
+
+// readArchiveFiles returns the content of all files within a zip file.
+func readArchiveFiles(path string) (map[string][]byte, error) {
+	reader, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	files := make(map[string][]byte)
+	for _, entry := range reader.File {
+		if entry.FileInfo().IsDir() {
+			continue
+		}
+
+		src, err := entry.Open()
+		if err != nil {
+			return nil, err
+		}
+		content, err := ioutil.ReadAll(src)
+		src.Close()
+		if err != nil {
+			return nil, err
+		}
+		files[entry.Name] = content
+	}
+	return files, nil
+}
+
+// isBinaryContent guesses whether a file is not meant to be read as text.
+func isBinaryContent(content []byte) bool {
+	return bytes.IndexByte(content, 0) >= 0 || !utf8.Valid(content)
+}
+
+// splitLines splits a text into lines without the line endings.
+func splitLines(content []byte) []string {
+	if len(content) == 0 {
+		return []string{}
+	}
+	text := strings.Replace(string(content), "\r\n", "\n", -1)
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
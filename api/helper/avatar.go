@@ -0,0 +1,174 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package helper
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	// jpeg avatars have to be decoded as well
+	_ "image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+
+	"github.com/infomark-org/infomark/configuration"
+)
+
+// Clients can request avatars scaled down to one of these edge lengths in
+// pixels. Copies are generated on demand and kept next to the avatar, hence
+// the list is fixed to keep the number of copies per user bounded.
+var AvatarSizes = []int{32, 64, 128, 256}
+
+// IsAvatarSize checks whether avatars can be requested in the given size.
+func IsAvatarSize(size int) bool {
+	for _, allowed := range AvatarSizes {
+		if size == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+func resizedAvatarPath(userID int64, size int) string {
+	return fmt.Sprintf("%s/avatars/%d-%d.png", configuration.Configuration.Server.Paths.Uploads, userID, size)
+}
+
+// deleteResizedAvatars removes all scaled copies of the avatar of a user.
+func deleteResizedAvatars(userID int64) {
+	paths, _ := filepath.Glob(fmt.Sprintf("%s/avatars/%d-*.png", configuration.Configuration.Server.Paths.Uploads, userID))
+	for _, path := range paths {
+		os.Remove(path)
+	}
+}
+
+// ResizedAvatarPath returns the path to the avatar of a user scaled down to
+// fit into size x size pixels. The copy is (re-)generated if it is missing or
+// older than the avatar.
+func ResizedAvatarPath(userID int64, size int) (string, error) {
+	if !IsAvatarSize(size) {
+		return "", errors.New("unsupported avatar size")
+	}
+
+	original := NewAvatarFileHandle(userID)
+	if !original.Exists() {
+		return "", os.ErrNotExist
+	}
+
+	originalInfo, err := os.Stat(original.Path())
+	if err != nil {
+		return "", err
+	}
+
+	path := resizedAvatarPath(userID, size)
+	if info, err := os.Stat(path); err == nil && !info.ModTime().Before(originalInfo.ModTime()) {
+		return path, nil
+	}
+
+	if err := writeResizedImage(original.Path(), path, size); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// writeResizedImage scales the image at src down to fit into size x size
+// pixels and stores it as png at dst. Smaller images are kept as they are.
+func writeResizedImage(src string, dst string, size int) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	img, _, err := image.Decode(in)
+	if err != nil {
+		return err
+	}
+
+	// write into a temporary file first, concurrent requests must never see
+	// a partial image
+	tmp := dst + ".tmp"
+	out, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+
+	if err := png.Encode(out, resizeImage(img, size)); err != nil {
+		out.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	return os.Rename(tmp, dst)
+}
+
+// resizeImage scales an image down to fit into size x size pixels keeping the
+// aspect ratio. Each pixel is the average of the pixels it covers.
+func resizeImage(img image.Image, size int) image.Image {
+	bounds := img.Bounds()
+	srcWidth, srcHeight := bounds.Dx(), bounds.Dy()
+
+	dstWidth, dstHeight := srcWidth, srcHeight
+	if srcWidth > size || srcHeight > size {
+		if srcWidth >= srcHeight {
+			dstWidth, dstHeight = size, max(1, srcHeight*size/srcWidth)
+		} else {
+			dstWidth, dstHeight = max(1, srcWidth*size/srcHeight), size
+		}
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dstWidth, dstHeight))
+	for y := 0; y < dstHeight; y++ {
+		y0 := bounds.Min.Y + y*srcHeight/dstHeight
+		y1 := bounds.Min.Y + max((y+1)*srcHeight/dstHeight, y*srcHeight/dstHeight+1)
+
+		for x := 0; x < dstWidth; x++ {
+			x0 := bounds.Min.X + x*srcWidth/dstWidth
+			x1 := bounds.Min.X + max((x+1)*srcWidth/dstWidth, x*srcWidth/dstWidth+1)
+
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, ca := img.At(sx, sy).RGBA()
+					r, g, b, a = r+uint64(cr), g+uint64(cg), b+uint64(cb), a+uint64(ca)
+					n++
+				}
+			}
+
+			dst.Set(x, y, color.RGBA64{
+				R: uint16(r / n),
+				G: uint16(g / n),
+				B: uint16(b / n),
+				A: uint16(a / n),
+			})
+		}
+	}
+	return dst
+}
+
+func max(a int, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,311 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package helper
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	pathpkg "path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/infomark-org/infomark/configuration"
+	"github.com/infomark-org/infomark/configuration/bytefmt"
+)
+
+// Large files can be uploaded in several requests. Each request contains the
+// usual multipart field and the header
+//
+//   Content-Range: bytes <first>-<last>/<total>
+//
+// describing the position of the chunk within the final file. Chunks have to
+// be sent in order. A chunk starting at 0 restarts the upload. The server
+// answers incomplete uploads with the header "Range: bytes=0-<last>" which
+// tells the client where to resume. Uploads which are not continued within
+// the configured expiry are discarded.
+
+// Complete uploads are staged as well, such that they can be validated before
+// they replace the current file.
+
+// ErrChunkOffset is returned if a chunk does not continue the received data.
+var ErrChunkOffset = errors.New("chunk does not continue the upload, see the Range header")
+
+var contentRangeRegex = regexp.MustCompile(`^bytes (\d+)-(\d+)/(\d+)$`)
+
+// ChunkedUpload stages the chunks of an upload until the file is complete.
+type ChunkedUpload struct {
+	Key string
+}
+
+// NewChunkedUpload creates a staging area identified by key, which should
+// include the uploading identity.
+func NewChunkedUpload(key string) *ChunkedUpload {
+	return &ChunkedUpload{Key: key}
+}
+
+// IsChunkedUpload returns true if the request carries a single chunk.
+func IsChunkedUpload(r *http.Request) bool {
+	return r.Header.Get("Content-Range") != ""
+}
+
+// chunksDirectory returns the directory all uploads are staged in.
+func chunksDirectory() string {
+	return fmt.Sprintf("%s/chunks", configuration.Configuration.Server.Paths.Uploads)
+}
+
+// Path returns the location of the staged data.
+func (c *ChunkedUpload) Path() string {
+	return fmt.Sprintf("%s/%s.part", chunksDirectory(), c.Key)
+}
+
+// Received returns the number of bytes staged so far.
+func (c *ChunkedUpload) Received() int64 {
+	info, err := os.Stat(c.Path())
+	if err != nil {
+		return 0
+	}
+	return info.Size()
+}
+
+// RangeHeader returns the value of the "Range" header for the staged data.
+func (c *ChunkedUpload) RangeHeader() string {
+	received := c.Received()
+	if received == 0 {
+		return ""
+	}
+	return fmt.Sprintf("bytes=0-%d", received-1)
+}
+
+// Delete removes the staged data.
+func (c *ChunkedUpload) Delete() error {
+	return os.Remove(c.Path())
+}
+
+// PurgeStaleChunks removes the staged data of all uploads which have not been
+// continued for longer than maxAge and returns the number of removed uploads.
+func PurgeStaleChunks(maxAge time.Duration) (int, error) {
+	entries, err := ioutil.ReadDir(chunksDirectory())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	deadline := time.Now().Add(-maxAge)
+	removed := 0
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".part") {
+			continue
+		}
+		if entry.ModTime().After(deadline) {
+			continue
+		}
+		path := fmt.Sprintf("%s/%s", chunksDirectory(), entry.Name())
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return removed, err
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// parseContentRange parses "bytes <first>-<last>/<total>".
+func parseContentRange(value string) (first int64, last int64, total int64, err error) {
+	match := contentRangeRegex.FindStringSubmatch(value)
+	if match == nil {
+		return 0, 0, 0, errors.New("malformed Content-Range header")
+	}
+
+	first, _ = strconv.ParseInt(match[1], 10, 64)
+	last, _ = strconv.ParseInt(match[2], 10, 64)
+	total, _ = strconv.ParseInt(match[3], 10, 64)
+
+	if last < first || last >= total {
+		return 0, 0, 0, errors.New("invalid Content-Range header")
+	}
+	return first, last, total, nil
+}
+
+// Append stages the chunk from the request. It returns true if the upload is
+// complete.
+func (c *ChunkedUpload) Append(r *http.Request, fieldName string, maxBytes bytefmt.ByteSize) (bool, error) {
+	first, last, total, err := parseContentRange(r.Header.Get("Content-Range"))
+	if err != nil {
+		return false, err
+	}
+
+	if maxBytes != 0 && total > int64(maxBytes) {
+		return false, fmt.Errorf("file is larger than %v", maxBytes)
+	}
+
+	if first != 0 && first != c.Received() {
+		return false, ErrChunkOffset
+	}
+
+	// the multipart envelope adds a few bytes to the chunk
+	r.Body = http.MaxBytesReader(DummyWriter{}, r.Body, last-first+1+(1<<20))
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		return false, err
+	}
+
+	file, _, err := r.FormFile(fieldName)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	if err := os.MkdirAll(chunksDirectory(), 0755); err != nil {
+		return false, err
+	}
+
+	flags := os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	if first == 0 {
+		flags |= os.O_TRUNC
+	}
+
+	hnd, err := os.OpenFile(c.Path(), flags, 0666)
+	if err != nil {
+		return false, err
+	}
+	defer hnd.Close()
+
+	written, err := io.Copy(hnd, io.LimitReader(file, last-first+2))
+	if err != nil {
+		return false, err
+	}
+	if written != last-first+1 {
+		// drop the broken chunk such that the client can resend it
+		hnd.Truncate(first)
+		return false, errors.New("chunk size does not match the Content-Range header")
+	}
+
+	return last+1 == total, nil
+}
+
+// Stage writes an upload sent in a single request to the staging area and
+// returns the name of the uploaded file. It replaces any unfinished chunked
+// upload.
+func (c *ChunkedUpload) Stage(r *http.Request, fieldName string, maxBytes bytefmt.ByteSize) (string, error) {
+	if maxBytes != 0 {
+		r.Body = http.MaxBytesReader(DummyWriter{}, r.Body, int64(maxBytes))
+	}
+
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		if maxBytes != 0 && strings.Contains(err.Error(), "request body too large") {
+			return "", fmt.Errorf("the file is larger than the maximum of %s", bytefmt.ToString(maxBytes))
+		}
+		return "", err
+	}
+
+	file, handler, err := r.FormFile(fieldName)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	if maxBytes != 0 && handler.Size > int64(maxBytes) {
+		return "", fmt.Errorf("the file is larger than the maximum of %s", bytefmt.ToString(maxBytes))
+	}
+
+	if err := os.MkdirAll(chunksDirectory(), 0755); err != nil {
+		return "", err
+	}
+
+	hnd, err := os.Create(c.Path())
+	if err != nil {
+		return "", err
+	}
+	defer hnd.Close()
+
+	if _, err := io.Copy(hnd, file); err != nil {
+		return "", err
+	}
+	if err := hnd.Sync(); err != nil {
+		return "", err
+	}
+	return pathpkg.Base(handler.Filename), nil
+}
+
+// WriteFromChunks validates the completely staged upload and moves it to the
+// location of the file handle.
+func (f *FileHandle) WriteFromChunks(c *ChunkedUpload) error {
+	hnd, err := os.Open(c.Path())
+	if err != nil {
+		return err
+	}
+
+	// Extract magic number from file
+	fileMagic := make([]byte, 4)
+	n, err := hnd.Read(fileMagic)
+	hnd.Close()
+	if err != nil || n != 4 {
+		c.Delete()
+		return errors.New("Unable to extract 4 Bytes for magic number determination")
+	}
+
+	path, err := f.targetPath(fileMagic)
+	if err != nil {
+		c.Delete()
+		return err
+	}
+
+	FileDelete(path)
+	if err := moveFile(c.Path(), path); err != nil {
+		return err
+	}
+
+	_, err = f.StoreChecksum()
+	return err
+}
+
+// moveFile renames a file. Files are copied if the destination is on another
+// device, e.g. the directory of a course.
+func moveFile(src string, dst string) error {
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(dst)
+		return err
+	}
+
+	return os.Remove(src)
+}
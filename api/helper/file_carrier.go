@@ -24,6 +24,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"mime/multipart"
 	"net/http"
 	"os"
@@ -50,6 +51,9 @@ const (
 	MaterialCategory              FileCategory = 4
 	SubmissionCategory            FileCategory = 5
 	SubmissionsCollectionCategory FileCategory = 6
+	SubmissionHistoryCategory     FileCategory = 7
+	StarterCategory               FileCategory = 8
+	TaskResetArchiveCategory      FileCategory = 9
 )
 
 // FileManager contains all operations we need to handle files
@@ -68,8 +72,14 @@ type FileHandle struct {
 	Category   FileCategory
 	ID         int64            // an unique identifier (e.g. from database)
 	Extensions []string         //
+	MinBytes   bytefmt.ByteSize // 0 means no limit
 	MaxBytes   bytefmt.ByteSize // 0 means no limit
 	Infos      []int64
+
+	// the directory is looked up once, see uploadsDirectory
+	resolved     bool
+	directory    string
+	directoryErr error
 }
 
 // NewAvatarFileHandle will handle user avatars. We support jpg only.
@@ -78,6 +88,7 @@ func NewAvatarFileHandle(userID int64) *FileHandle {
 		Category:   AvatarCategory,
 		ID:         userID,
 		Extensions: []string{"jpg", "jpeg", "png"},
+		MinBytes:   configuration.Configuration.Server.HTTP.Limits.MinAvatar,
 		MaxBytes:   configuration.Configuration.Server.HTTP.Limits.MaxAvatar,
 	}
 }
@@ -114,6 +125,17 @@ func NewPrivateTestFileHandle(ID int64) *FileHandle {
 	}
 }
 
+// NewStarterFileHandle will handle the starter code students download
+// for a task (zip files).
+func NewStarterFileHandle(ID int64) *FileHandle {
+	return &FileHandle{
+		Category:   StarterCategory,
+		ID:         ID,
+		Extensions: []string{"zip"},
+		MaxBytes:   0,
+	}
+}
+
 // NewMaterialFileHandle will handle course slides or extra material (zip files).
 func NewMaterialFileHandle(ID int64) *FileHandle {
 	return &FileHandle{
@@ -146,6 +168,30 @@ func NewSubmissionsCollectionFileHandle(courseID int64, sheetID int64,
 	}
 }
 
+// NewSubmissionHistoryFileHandle will handle a previous version of a
+// submission uploaded at the given time (in nanoseconds since epoch).
+func NewSubmissionHistoryFileHandle(submissionID int64, uploadedAt int64) *FileHandle {
+	return &FileHandle{
+		Category:   SubmissionHistoryCategory,
+		ID:         submissionID,
+		Extensions: []string{"zip"},
+		MaxBytes:   0,
+		Infos:      []int64{uploadedAt},
+	}
+}
+
+// NewTaskResetArchiveFileHandle will handle the archive of all submissions of
+// a task created before they were reset at the given time (unix seconds).
+func NewTaskResetArchiveFileHandle(taskID int64, resetAt int64) *FileHandle {
+	return &FileHandle{
+		Category:   TaskResetArchiveCategory,
+		ID:         taskID,
+		Extensions: []string{"zip"},
+		MaxBytes:   0,
+		Infos:      []int64{resetAt},
+	}
+}
+
 // Sha256 computes the checksum and return it as a string
 func (f *FileHandle) Sha256() (string, error) {
 
@@ -164,8 +210,109 @@ func (f *FileHandle) Sha256() (string, error) {
 
 }
 
-// Path return the path to a file using the config
+// checksumPath is the location where the checksum of the file is cached.
+func (f *FileHandle) checksumPath() string {
+	return f.Path() + ".sha256"
+}
+
+// StoreChecksum computes the checksum of the file and caches it next to it.
+func (f *FileHandle) StoreChecksum() (string, error) {
+	checksum, err := f.Sha256()
+	if err != nil {
+		return "", err
+	}
+	return checksum, ioutil.WriteFile(f.checksumPath(), []byte(checksum), 0666)
+}
+
+// Checksum returns the cached checksum of the file. It is computed again if
+// the file has been written after the checksum.
+func (f *FileHandle) Checksum() (string, error) {
+	info, err := os.Stat(f.Path())
+	if err != nil {
+		return "", err
+	}
+
+	if cached, err := os.Stat(f.checksumPath()); err == nil && !cached.ModTime().Before(info.ModTime()) {
+		if checksum, err := ioutil.ReadFile(f.checksumPath()); err == nil {
+			return string(checksum), nil
+		}
+	}
+
+	return f.StoreChecksum()
+}
+
+// CourseOfFile identifies the course a file belongs to. It is only consulted
+// if some courses store their files in a directory of their own.
+var CourseOfFile func(category FileCategory, ID int64) (int64, error)
+
+// uploadsDirectory returns the directory the file is stored in. This is the
+// directory of the course of the file if there is one configured for it.
+func (f *FileHandle) uploadsDirectory() (string, error) {
+	directory, err := f.courseDirectory()
+	if err != nil {
+		return "", err
+	}
+	if directory == "" {
+		return configuration.Configuration.Server.Paths.Uploads, nil
+	}
+	return directory, nil
+}
+
+// courseDirectory returns the directory configured for the course of the file
+// or an empty string if the global directories are used. The course is only
+// looked up once per handle.
+func (f *FileHandle) courseDirectory() (string, error) {
+	if !f.resolved {
+		f.directory, f.directoryErr = f.lookupCourseDirectory()
+		f.resolved = true
+	}
+	return f.directory, f.directoryErr
+}
+
+func (f *FileHandle) lookupCourseDirectory() (string, error) {
+	courseUploads := configuration.Configuration.Server.Paths.CourseUploads
+
+	switch f.Category {
+	case SheetCategory,
+		PublicTestCategory,
+		PrivateTestCategory,
+		StarterCategory,
+		MaterialCategory,
+		SubmissionCategory,
+		SubmissionHistoryCategory,
+		TaskResetArchiveCategory:
+		if len(courseUploads) > 0 {
+			// files of a course must never end up in the global directory by
+			// mistake
+			if CourseOfFile == nil {
+				return "", errors.New("the course of the file cannot be identified")
+			}
+			courseID, err := CourseOfFile(f.Category, f.ID)
+			if err != nil {
+				return "", fmt.Errorf("the course of the file cannot be identified: %v", err)
+			}
+			return courseUploads[courseID], nil
+		}
+	}
+
+	return "", nil
+}
+
+// Resolve looks up the directory of the file. Files which are deleted after
+// their database entry have to be resolved before.
+func (f *FileHandle) Resolve() error {
+	_, err := f.uploadsDirectory()
+	return err
+}
+
+// Path return the path to a file using the config. It is empty if the
+// directory of the file cannot be determined (see Resolve).
 func (f *FileHandle) Path() string {
+	directory, err := f.uploadsDirectory()
+	if err != nil {
+		return ""
+	}
+
 	switch f.Category {
 	case AvatarCategory:
 
@@ -178,18 +325,21 @@ func (f *FileHandle) Path() string {
 		return ""
 
 	case SheetCategory:
-		return fmt.Sprintf("%s/sheets/%d.zip", configuration.Configuration.Server.Paths.Uploads, f.ID)
+		return fmt.Sprintf("%s/sheets/%d.zip", directory, f.ID)
 
 	case PublicTestCategory:
-		return fmt.Sprintf("%s/tasks/%d-public.zip", configuration.Configuration.Server.Paths.Uploads, f.ID)
+		return fmt.Sprintf("%s/tasks/%d-public.zip", directory, f.ID)
 
 	case PrivateTestCategory:
-		return fmt.Sprintf("%s/tasks/%d-private.zip", configuration.Configuration.Server.Paths.Uploads, f.ID)
+		return fmt.Sprintf("%s/tasks/%d-private.zip", directory, f.ID)
+
+	case StarterCategory:
+		return fmt.Sprintf("%s/tasks/%d-starter.zip", directory, f.ID)
 
 	case MaterialCategory:
 
 		for _, ext := range f.Extensions {
-			path := fmt.Sprintf("%s/materials/%d.%s", configuration.Configuration.Server.Paths.Uploads, f.ID, ext)
+			path := fmt.Sprintf("%s/materials/%d.%s", directory, f.ID, ext)
 			if FileExists(path) {
 				return path
 			}
@@ -197,10 +347,19 @@ func (f *FileHandle) Path() string {
 		return ""
 
 	case SubmissionCategory:
-		return fmt.Sprintf("%s/submissions/%d.zip", configuration.Configuration.Server.Paths.Uploads, f.ID)
+		return fmt.Sprintf("%s/submissions/%d.zip", directory, f.ID)
 	case SubmissionsCollectionCategory:
 		return fmt.Sprintf("%s/collection-course%d-sheet%d-task%d-group%d.zip",
 			configuration.Configuration.Server.Paths.GeneratedFiles, f.Infos[0], f.Infos[1], f.Infos[2], f.Infos[3])
+	case SubmissionHistoryCategory:
+		return fmt.Sprintf("%s/%d.zip", submissionHistoryDirectory(directory, f.ID), f.Infos[0])
+	case TaskResetArchiveCategory:
+		// the archive contains the files of the course
+		generated := configuration.Configuration.Server.Paths.GeneratedFiles
+		if f.directory != "" {
+			generated = fmt.Sprintf("%s/generated", f.directory)
+		}
+		return fmt.Sprintf("%s/reset-task%d-%d.zip", generated, f.ID, f.Infos[0])
 	}
 	return ""
 }
@@ -238,6 +397,14 @@ func (f *FileHandle) Exists() bool {
 
 // Delete deletes a file from disk.
 func (f *FileHandle) Delete() error {
+	if err := f.Resolve(); err != nil {
+		return err
+	}
+	// there might be no cached checksum
+	os.Remove(f.checksumPath())
+	if f.Category == AvatarCategory {
+		deleteResizedAvatars(f.ID)
+	}
 	return os.Remove(f.Path())
 }
 
@@ -384,6 +551,9 @@ func (f *FileHandle) WriteToDisk(r *http.Request, fieldName string) (string, err
 
 	// receive data from post request
 	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		if f.MaxBytes != 0 && strings.Contains(err.Error(), "request body too large") {
+			return "", fmt.Errorf("the file is larger than the maximum of %s", bytefmt.ToString(f.MaxBytes))
+		}
 		return "", err
 	}
 
@@ -394,7 +564,9 @@ func (f *FileHandle) WriteToDisk(r *http.Request, fieldName string) (string, err
 	}
 	defer file.Close()
 
-	path := f.Path()
+	if err := f.checkSize(handler.Size); err != nil {
+		return "", err
+	}
 
 	// Extract magic number from file
 	fileMagic := make([]byte, 4)
@@ -405,8 +577,57 @@ func (f *FileHandle) WriteToDisk(r *http.Request, fieldName string) (string, err
 		return "", errors.New("Fail to seek to beginning of file")
 	}
 
+	path, err := f.targetPath(fileMagic)
+	if err != nil {
+		return "", err
+	}
+
+	// delete path
+	FileDelete(path)
+	// try to open new file
+	hnd, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE, 0666)
+	if err != nil {
+		return "", err
+	}
+	defer hnd.Close()
+
+	// copy file from request
+	if _, err = io.Copy(hnd, file); err != nil {
+		return "", err
+	}
+	if err := hnd.Sync(); err != nil {
+		return "", err
+	}
+
+	_, err = f.StoreChecksum()
+	return pathpkg.Base(handler.Filename), err
+
+}
+
+// checkSize tests whether the size of an upload is within the limits.
+func (f *FileHandle) checkSize(size int64) error {
+	if f.MinBytes != 0 && size < int64(f.MinBytes) {
+		return fmt.Errorf("the file is smaller than the minimum of %s", bytefmt.ToString(f.MinBytes))
+	}
+	if f.MaxBytes != 0 && size > int64(f.MaxBytes) {
+		return fmt.Errorf("the file is larger than the maximum of %s", bytefmt.ToString(f.MaxBytes))
+	}
+	return nil
+}
+
+// targetPath validates the file type by its magic number and returns the path
+// the file should be written to. Previous files with a different extension are
+// removed.
+func (f *FileHandle) targetPath(fileMagic []byte) (string, error) {
+	directory, err := f.uploadsDirectory()
+	if err != nil {
+		return "", err
+	}
+	path := f.Path()
+
 	switch f.Category {
 	case AvatarCategory:
+		deleteResizedAvatars(f.ID)
 		pathToDelete := fmt.Sprintf("%s/avatars/%s.png", configuration.Configuration.Server.Paths.Uploads, strconv.FormatInt(f.ID, 10))
 		FileDelete(pathToDelete)
 		pathToDelete = fmt.Sprintf("%s/avatars/%s.jpg", configuration.Configuration.Server.Paths.Uploads, strconv.FormatInt(f.ID, 10))
@@ -422,6 +643,7 @@ func (f *FileHandle) WriteToDisk(r *http.Request, fieldName string) (string, err
 	case SheetCategory,
 		PublicTestCategory,
 		PrivateTestCategory,
+		StarterCategory,
 		SubmissionCategory:
 		if !IsZipFile(fileMagic) {
 			return "", errors.New("We support ZIP files only. But the given file is no Zip file")
@@ -429,31 +651,24 @@ func (f *FileHandle) WriteToDisk(r *http.Request, fieldName string) (string, err
 	case MaterialCategory:
 		// delete both possible files
 		// ids are unique. Hence we only delete the file associated with the id
-		pathToDelete := fmt.Sprintf("%s/materials/%s.zip", configuration.Configuration.Server.Paths.Uploads, strconv.FormatInt(f.ID, 10))
+		pathToDelete := fmt.Sprintf("%s/materials/%s.zip", directory, strconv.FormatInt(f.ID, 10))
 		FileDelete(pathToDelete)
-		pathToDelete = fmt.Sprintf("%s/materials/%s.pdf", configuration.Configuration.Server.Paths.Uploads, strconv.FormatInt(f.ID, 10))
+		pathToDelete = fmt.Sprintf("%s/materials/%s.pdf", directory, strconv.FormatInt(f.ID, 10))
 		FileDelete(pathToDelete)
 
 		if IsPdfFile(fileMagic) {
-			path = fmt.Sprintf("%s/materials/%s.pdf", configuration.Configuration.Server.Paths.Uploads, strconv.FormatInt(f.ID, 10))
+			path = fmt.Sprintf("%s/materials/%s.pdf", directory, strconv.FormatInt(f.ID, 10))
 		} else if IsZipFile(fileMagic) {
-			path = fmt.Sprintf("%s/materials/%s.zip", configuration.Configuration.Server.Paths.Uploads, strconv.FormatInt(f.ID, 10))
+			path = fmt.Sprintf("%s/materials/%s.zip", directory, strconv.FormatInt(f.ID, 10))
 		} else {
 			return "", errors.New("Only PDF and ZIP files are allowed")
 		}
 	}
 
-	// delete path
-	FileDelete(path)
-	// try to open new file
-	hnd, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE, 0666)
-	if err != nil {
+	// directories of courses might not be populated yet
+	if err := os.MkdirAll(pathpkg.Dir(path), 0755); err != nil {
 		return "", err
 	}
-	defer hnd.Close()
-
-	// copy file from request
-	_, err = io.Copy(hnd, file)
-	return pathpkg.Base(handler.Filename), err
 
+	return path, nil
 }
@@ -20,9 +20,14 @@
 package helper
 
 import (
+	"io/ioutil"
+	"os"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/franela/goblin"
+	"github.com/infomark-org/infomark/configuration"
 )
 
 func TestCourseCreation(t *testing.T) {
@@ -39,6 +44,71 @@ func TestCourseCreation(t *testing.T) {
 			g.Assert(len(result)).Equal(2)
 		})
 
+		g.It("Should parse Content-Range headers", func() {
+			first, last, total, err := parseContentRange("bytes 0-99/200")
+			g.Assert(err).Equal(nil)
+			g.Assert(first).Equal(int64(0))
+			g.Assert(last).Equal(int64(99))
+			g.Assert(total).Equal(int64(200))
+
+			_, _, _, err = parseContentRange("bytes 100-200/200")
+			g.Assert(err != nil).IsTrue()
+
+			_, _, _, err = parseContentRange("bytes 10-5/200")
+			g.Assert(err != nil).IsTrue()
+
+			_, _, _, err = parseContentRange("bytes */200")
+			g.Assert(err != nil).IsTrue()
+		})
+
+		g.It("Should render Markdown without unsafe HTML", func() {
+			g.Assert(RenderMarkdown("")).Equal("")
+
+			html := RenderMarkdown("**bold** and `code`\n\n<script>alert(1)</script>\n\n[x](javascript:alert(1))")
+			g.Assert(strings.Contains(html, "<strong>bold</strong>")).IsTrue()
+			g.Assert(strings.Contains(html, "<code>code</code>")).IsTrue()
+			g.Assert(strings.Contains(html, "<script")).IsFalse()
+			g.Assert(strings.Contains(html, "javascript:")).IsFalse()
+		})
+
+		g.It("Should drop attributes and elements Markdown does not produce", func() {
+			html := RenderMarkdown("[x](http://infomark.org \"t\" onclick=alert(1))\n\n<img src=x onerror=alert(1)>\n\n| a |\n|:--|\n| b |\n\n![img](https://infomark.org/a.png)")
+			g.Assert(strings.Contains(html, "onclick")).IsFalse()
+			g.Assert(strings.Contains(html, "onerror")).IsFalse()
+			g.Assert(strings.Contains(html, `<td align="left">b</td>`)).IsTrue()
+			g.Assert(strings.Contains(html, `<img src="https://infomark.org/a.png" alt="img">`)).IsTrue()
+
+			g.Assert(sanitizeHTML([]byte(`<p onmouseover="x">a<script>alert(1)</script><a href="vbscript:x">b</a></p>`))).
+				Equal(`<p>a<a>b</a></p>`)
+		})
+
+		g.It("Should purge stale chunks only", func() {
+			uploads, err := ioutil.TempDir("", "chunks")
+			g.Assert(err).Equal(nil)
+			defer os.RemoveAll(uploads)
+
+			configuration.Configuration = &configuration.ConfigurationSchema{}
+			configuration.Configuration.Server.Paths.Uploads = uploads
+
+			removed, err := PurgeStaleChunks(time.Hour)
+			g.Assert(err).Equal(nil)
+			g.Assert(removed).Equal(0)
+
+			g.Assert(os.MkdirAll(uploads+"/chunks", 0755)).Equal(nil)
+			stale := NewChunkedUpload("stale")
+			fresh := NewChunkedUpload("fresh")
+			g.Assert(ioutil.WriteFile(stale.Path(), []byte("data"), 0644)).Equal(nil)
+			g.Assert(ioutil.WriteFile(fresh.Path(), []byte("data"), 0644)).Equal(nil)
+			old := time.Now().Add(-2 * time.Hour)
+			g.Assert(os.Chtimes(stale.Path(), old, old)).Equal(nil)
+
+			removed, err = PurgeStaleChunks(time.Hour)
+			g.Assert(err).Equal(nil)
+			g.Assert(removed).Equal(1)
+			g.Assert(stale.Received()).Equal(int64(0))
+			g.Assert(fresh.Received()).Equal(int64(4))
+		})
+
 	})
 
 }
@@ -0,0 +1,145 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package helper
+
+import (
+	"bytes"
+	"net/url"
+	"strings"
+
+	"github.com/russross/blackfriday"
+	"golang.org/x/net/html"
+)
+
+// markdownHTMLFlags make the renderer drop raw HTML including <script> and
+// <style> elements and only link to trusted protocols.
+const markdownHTMLFlags = blackfriday.HTML_SKIP_HTML |
+	blackfriday.HTML_SKIP_STYLE |
+	blackfriday.HTML_SAFELINK |
+	blackfriday.HTML_NOFOLLOW_LINKS |
+	blackfriday.HTML_NOREFERRER_LINKS
+
+const markdownExtensions = blackfriday.EXTENSION_NO_INTRA_EMPHASIS |
+	blackfriday.EXTENSION_TABLES |
+	blackfriday.EXTENSION_FENCED_CODE |
+	blackfriday.EXTENSION_AUTOLINK |
+	blackfriday.EXTENSION_STRIKETHROUGH |
+	blackfriday.EXTENSION_SPACE_HEADERS
+
+// markdownElements are the elements (and their attributes) the renderer may
+// produce. Everything else is removed from the rendered HTML.
+var markdownElements = map[string][]string{
+	"a": {"href", "title", "rel"}, "img": {"src", "alt", "title"},
+	"p": nil, "br": nil, "hr": nil, "blockquote": nil, "pre": nil, "code": {"class"},
+	"h1": nil, "h2": nil, "h3": nil, "h4": nil, "h5": nil, "h6": nil,
+	"strong": nil, "em": nil, "del": nil, "ul": nil, "ol": nil, "li": nil,
+	"table": nil, "thead": nil, "tbody": nil, "tr": nil, "th": {"align"}, "td": {"align"},
+}
+
+// markdownSchemes are the protocols links and images may use. Relative URLs
+// have no scheme.
+var markdownSchemes = map[string]bool{"": true, "http": true, "https": true, "mailto": true}
+
+// RenderMarkdown converts Markdown into HTML which is safe to embed into a
+// page, i.e. it contains no scripts, styles or "javascript:" links.
+func RenderMarkdown(source string) string {
+	if source == "" {
+		return ""
+	}
+
+	renderer := blackfriday.HtmlRenderer(markdownHTMLFlags, "", "")
+	return sanitizeHTML(blackfriday.Markdown([]byte(source), renderer, markdownExtensions))
+}
+
+// sanitizeHTML keeps only the elements and attributes in markdownElements. The
+// flags of the renderer are not sufficient on their own, e.g. they let
+// attributes of inline HTML slip through.
+func sanitizeHTML(source []byte) string {
+	var out bytes.Buffer
+	// content of removed elements like <script> must not become text
+	skip := 0
+
+	tokenizer := html.NewTokenizer(bytes.NewReader(source))
+	for {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			return out.String()
+
+		case html.TextToken:
+			if skip == 0 {
+				out.WriteString(html.EscapeString(string(tokenizer.Text())))
+			}
+
+		case html.StartTagToken, html.SelfClosingTagToken:
+			token := tokenizer.Token()
+			allowed, ok := markdownElements[token.Data]
+			if !ok {
+				if isRawTextElement(token.Data) && token.Type == html.StartTagToken {
+					skip++
+				}
+				continue
+			}
+			if skip > 0 {
+				continue
+			}
+
+			out.WriteString("<" + token.Data)
+			for _, attr := range token.Attr {
+				if !containsString(allowed, attr.Key) {
+					continue
+				}
+				if (attr.Key == "href" || attr.Key == "src") && !isSafeURL(attr.Val) {
+					continue
+				}
+				out.WriteString(" " + attr.Key + `="` + html.EscapeString(attr.Val) + `"`)
+			}
+			out.WriteString(">")
+
+		case html.EndTagToken:
+			token := tokenizer.Token()
+			if _, ok := markdownElements[token.Data]; ok && skip == 0 {
+				out.WriteString("</" + token.Data + ">")
+			} else if isRawTextElement(token.Data) && skip > 0 {
+				skip--
+			}
+		}
+	}
+}
+
+func isRawTextElement(name string) bool {
+	switch name {
+	case "script", "style", "iframe", "noscript", "textarea", "title", "xmp", "noembed", "noframes":
+		return true
+	}
+	return false
+}
+
+func isSafeURL(raw string) bool {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	return err == nil && markdownSchemes[strings.ToLower(u.Scheme)]
+}
+
+func containsString(list []string, value string) bool {
+	for _, el := range list {
+		if el == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,119 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package helper
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Each upload of a submission replaces its file. To let tutors comprehend how a
+// solution evolved, a copy of every uploaded version is kept as well.
+
+func submissionHistoryDirectory(uploads string, submissionID int64) string {
+	return fmt.Sprintf("%s/submissions/history/%d", uploads, submissionID)
+}
+
+// historyVersion returns a handle of a previous version of the submission
+// sharing the already looked up directory.
+func (f *FileHandle) historyVersion(uploadedAt int64) *FileHandle {
+	version := *f
+	version.Category = SubmissionHistoryCategory
+	version.MaxBytes = 0
+	version.Infos = []int64{uploadedAt}
+	return &version
+}
+
+// ArchiveSubmissionFile copies the current file of a submission into its
+// history.
+func ArchiveSubmissionFile(submissionID int64, uploadedAt time.Time) error {
+	submission := NewSubmissionFileHandle(submissionID)
+	directory, err := submission.uploadsDirectory()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(submissionHistoryDirectory(directory, submissionID), 0755); err != nil {
+		return err
+	}
+
+	src, err := os.Open(submission.Path())
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.Create(submission.historyVersion(uploadedAt.UnixNano()).Path())
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+
+	_, err = io.Copy(dst, src)
+	return err
+}
+
+// SubmissionHistory returns all archived versions of a submission, the oldest
+// first.
+func SubmissionHistory(submissionID int64) ([]*FileHandle, error) {
+	submission := NewSubmissionFileHandle(submissionID)
+	directory, err := submission.uploadsDirectory()
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := ioutil.ReadDir(submissionHistoryDirectory(directory, submissionID))
+	if os.IsNotExist(err) {
+		return []*FileHandle{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	uploads := []int64{}
+	for _, entry := range entries {
+		uploadedAt, err := strconv.ParseInt(strings.TrimSuffix(entry.Name(), ".zip"), 10, 64)
+		if err != nil {
+			continue
+		}
+		uploads = append(uploads, uploadedAt)
+	}
+	sort.Slice(uploads, func(i, j int) bool { return uploads[i] < uploads[j] })
+
+	versions := []*FileHandle{}
+	for _, uploadedAt := range uploads {
+		versions = append(versions, submission.historyVersion(uploadedAt))
+	}
+	return versions, nil
+}
+
+// DeleteSubmissionHistory removes all archived versions of the submission
+// given by its file handle.
+func DeleteSubmissionHistory(submission *FileHandle) error {
+	directory, err := submission.uploadsDirectory()
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(submissionHistoryDirectory(directory, submission.ID))
+}
@@ -0,0 +1,213 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package helper
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// An XLSX workbook is a zip archive of XML files. XLSXWriter writes the
+// worksheets one after another directly into the archive, such that large
+// workbooks never have to be kept in memory. Cells are written as inline
+// strings, which avoids the shared string table.
+
+// maxSheetNameLength is the limit Excel imposes on the names of worksheets.
+const maxSheetNameLength = 31
+
+// XLSXWriter streams a workbook with one or more worksheets.
+type XLSXWriter struct {
+	archive *zip.Writer
+	sheets  []string
+	current io.Writer
+	row     int
+}
+
+// NewXLSXWriter creates a workbook written to w. The workbook is complete
+// after calling Close.
+func NewXLSXWriter(w io.Writer) *XLSXWriter {
+	return &XLSXWriter{archive: zip.NewWriter(w)}
+}
+
+// AddSheet finishes the current worksheet and starts a new one. Characters
+// not allowed in the names of worksheets are replaced and duplicate names are
+// made unique.
+func (x *XLSXWriter) AddSheet(name string) error {
+	if err := x.finishSheet(); err != nil {
+		return err
+	}
+
+	x.sheets = append(x.sheets, x.uniqueSheetName(name))
+	sheet, err := x.archive.Create(fmt.Sprintf("xl/worksheets/sheet%d.xml", len(x.sheets)))
+	if err != nil {
+		return err
+	}
+	x.current = sheet
+	x.row = 0
+
+	_, err = io.WriteString(x.current, xml.Header+
+		`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+	return err
+}
+
+// WriteRow appends a row to the current worksheet. Integers and floats are
+// written as numbers, anything else as text.
+func (x *XLSXWriter) WriteRow(cells ...interface{}) error {
+	if x.current == nil {
+		return fmt.Errorf("xlsx: no worksheet to write to")
+	}
+	x.row++
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<row r="%d">`, x.row)
+	for k, cell := range cells {
+		ref := fmt.Sprintf("%s%d", xlsxColumnName(k), x.row)
+		switch v := cell.(type) {
+		case int, int32, int64, float32, float64:
+			fmt.Fprintf(&b, `<c r="%s"><v>%v</v></c>`, ref, v)
+		default:
+			fmt.Fprintf(&b, `<c r="%s" t="inlineStr"><is><t xml:space="preserve">`, ref)
+			xml.EscapeText(&b, []byte(fmt.Sprint(v)))
+			b.WriteString(`</t></is></c>`)
+		}
+	}
+	b.WriteString(`</row>`)
+
+	_, err := io.WriteString(x.current, b.String())
+	return err
+}
+
+// Close finishes the last worksheet and writes the workbook itself.
+func (x *XLSXWriter) Close() error {
+	if err := x.finishSheet(); err != nil {
+		return err
+	}
+	if len(x.sheets) == 0 {
+		return fmt.Errorf("xlsx: a workbook needs at least one worksheet")
+	}
+
+	var contentTypes, workbook, relations strings.Builder
+
+	contentTypes.WriteString(xml.Header +
+		`<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+		`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+		`<Default Extension="xml" ContentType="application/xml"/>` +
+		`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>`)
+	workbook.WriteString(xml.Header +
+		`<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" ` +
+		`xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets>`)
+	relations.WriteString(xml.Header +
+		`<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">`)
+
+	for k, name := range x.sheets {
+		id := k + 1
+		fmt.Fprintf(&contentTypes,
+			`<Override PartName="/xl/worksheets/sheet%d.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`, id)
+		workbook.WriteString(`<sheet name="`)
+		xml.EscapeText(&workbook, []byte(name))
+		fmt.Fprintf(&workbook, `" sheetId="%d" r:id="rId%d"/>`, id, id)
+		fmt.Fprintf(&relations,
+			`<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet%d.xml"/>`, id, id)
+	}
+
+	contentTypes.WriteString(`</Types>`)
+	workbook.WriteString(`</sheets></workbook>`)
+	relations.WriteString(`</Relationships>`)
+
+	files := []struct {
+		name    string
+		content string
+	}{
+		{"[Content_Types].xml", contentTypes.String()},
+		{"_rels/.rels", xml.Header +
+			`<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+			`</Relationships>`},
+		{"xl/workbook.xml", workbook.String()},
+		{"xl/_rels/workbook.xml.rels", relations.String()},
+	}
+	for _, file := range files {
+		writer, err := x.archive.Create(file.name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(writer, file.content); err != nil {
+			return err
+		}
+	}
+
+	return x.archive.Close()
+}
+
+func (x *XLSXWriter) finishSheet() error {
+	if x.current == nil {
+		return nil
+	}
+	_, err := io.WriteString(x.current, `</sheetData></worksheet>`)
+	x.current = nil
+	return err
+}
+
+func (x *XLSXWriter) uniqueSheetName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`[]:*?/\`, r) {
+			return '_'
+		}
+		return r
+	}, strings.TrimSpace(name))
+	if name == "" {
+		name = "Sheet"
+	}
+
+	candidate := truncateRunes(name, maxSheetNameLength)
+	for k := 2; x.hasSheet(candidate); k++ {
+		suffix := fmt.Sprintf(" (%d)", k)
+		candidate = truncateRunes(name, maxSheetNameLength-len(suffix)) + suffix
+	}
+	return candidate
+}
+
+func (x *XLSXWriter) hasSheet(name string) bool {
+	for _, sheet := range x.sheets {
+		if strings.EqualFold(sheet, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func truncateRunes(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) > n {
+		return string(runes[:n])
+	}
+	return s
+}
+
+// xlsxColumnName converts a 0-based column index into its letters, e.g. 27
+// becomes "AB".
+func xlsxColumnName(index int) string {
+	name := ""
+	for index++; index > 0; index = (index - 1) / 26 {
+		name = string(rune('A'+(index-1)%26)) + name
+	}
+	return name
+}
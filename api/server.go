@@ -31,6 +31,7 @@ import (
 	"github.com/infomark-org/infomark/configuration"
 	"github.com/infomark-org/infomark/email"
 	"github.com/infomark-org/infomark/migration"
+	"github.com/infomark-org/infomark/webhook"
 	"github.com/jmoiron/sqlx"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/robfig/cron"
@@ -72,6 +73,7 @@ func NewServer(config *configuration.ServerConfigurationSchema) (*Server, error)
 	} else {
 		email.DefaultMail = email.TerminalMail
 	}
+	email.SubjectPrefix = config.Email.SubjectPrefix
 
 	db, err := sqlx.Connect("postgres", config.PostgresURL())
 	if err != nil {
@@ -100,6 +102,26 @@ func NewServer(config *configuration.ServerConfigurationSchema) (*Server, error)
 		DB:        db,
 		Directory: config.Paths.GeneratedFiles,
 	})
+	if config.Cronjobs.PurgeSubmissionsIntervall > 0 {
+		c.AddJob(config.CronjobsPurgeSubmissionsIntervall(), &cronjob.SubmissionFilePurger{
+			Stores: app.NewStores(db),
+		})
+	}
+	if config.Cronjobs.SendDigestsIntervall > 0 {
+		c.AddJob(config.CronjobsSendDigestsIntervall(), &cronjob.NotificationDigestSender{
+			Stores: app.NewStores(db),
+		})
+	}
+	if config.Cronjobs.ExpireEmailChangesIntervall > 0 {
+		c.AddJob(config.CronjobsExpireEmailChangesIntervall(), &cronjob.EmailChangeExpirer{
+			Stores: app.NewStores(db),
+		})
+	}
+	if config.Cronjobs.PurgeChunksIntervall > 0 {
+		c.AddJob(config.CronjobsPurgeChunksIntervall(), &cronjob.ChunkPurger{
+			MaxAge: config.ChunkedUploads.Expiry,
+		})
+	}
 
 	return &Server{
 		HTTP:           &srv,
@@ -124,7 +146,10 @@ func (srv *Server) Start() {
 	log.Info("starting background email sender...")
 	go email.BackgroundSend(email.OutgoingEmailsChannel)
 
-	log.Info("starting cronjob for zipping submissions...")
+	log.Info("starting background webhook dispatcher...")
+	go webhook.BackgroundDeliver(webhook.OutgoingDeliveriesChannel)
+
+	log.Info("starting cronjobs for zipping and purging submissions...")
 	srv.Cron.Start()
 
 	quit := make(chan os.Signal, 1)
@@ -139,6 +164,9 @@ func (srv *Server) Start() {
 	close(email.OutgoingEmailsChannel)
 	log.Info("Background email sender gracefully stopped")
 
+	close(webhook.OutgoingDeliveriesChannel)
+	log.Info("Background webhook dispatcher gracefully stopped")
+
 	if err := srv.HTTP.Shutdown(context.Background()); err != nil {
 		panic(err)
 	}
@@ -34,6 +34,8 @@ type SubmissionAMQPWorkerRequest struct {
 	DockerImage       string    `json:"docker_image"`
 	Sha256            string    `json:"sha_256"`
 	EnqueuedAt        time.Time `json:"enqueued_at"`
+	TimeoutSeconds    int       `json:"timeout_seconds"`
+	AllowNetwork      bool      `json:"allow_network"`
 }
 
 // // SubmissionWorkerResponse is the message handed from the workers to the server
@@ -48,7 +50,8 @@ type SubmissionAMQPWorkerRequest struct {
 // NewSubmissionAMQPWorkerRequest creates a new message for the workers
 func NewSubmissionAMQPWorkerRequest(
 	courseID int64, taskID int64, submissionID int64, gradeID int64,
-	accessToken string, url string, dockerimage string, sha256 string, visibility string) *SubmissionAMQPWorkerRequest {
+	accessToken string, url string, dockerimage string, sha256 string, visibility string,
+	timeoutSeconds int, allowNetwork bool) *SubmissionAMQPWorkerRequest {
 
 	return &SubmissionAMQPWorkerRequest{
 		SubmissionID: submissionID,
@@ -68,7 +71,9 @@ func NewSubmissionAMQPWorkerRequest(
 			courseID,
 			gradeID,
 			visibility),
-		DockerImage: dockerimage,
-		Sha256:      sha256,
+		DockerImage:    dockerimage,
+		Sha256:         sha256,
+		TimeoutSeconds: timeoutSeconds,
+		AllowNetwork:   allowNetwork,
 	}
 }
@@ -171,6 +171,21 @@ func cleanDockerOutput(stdout string) string {
 	return stdout
 }
 
+// extractDockerDiff returns the diff between the produced and the expected
+// output, which the testing framework prints outside of the log section.
+func extractDockerDiff(stdout string) string {
+	diffStart := "--- BEGIN --- INFOMARK -- DIFF"
+	diffEnd := "--- END --- INFOMARK -- DIFF"
+
+	rsl := strings.Split(stdout, diffStart)
+
+	if len(rsl) > 1 {
+		rsl = strings.Split(rsl[1], diffEnd)
+		return strings.Trim(rsl[0], "\n")
+	}
+	return ""
+}
+
 // Handle reads message and test submission using docker
 func (h *RealSubmissionHandler) Handle(body []byte) error {
 	// HandleSubmission is responsible to
@@ -260,12 +275,18 @@ func (h *RealSubmissionHandler) Handle(body []byte) error {
 	}
 
 	// 5. run docker test
-	ds, err := service.NewDockerServiceWithTimeout(configuration.Configuration.Worker.Docker.Timeout)
+	timeout := configuration.Configuration.Worker.Docker.Timeout
+	if msg.TimeoutSeconds > 0 {
+		timeout = time.Duration(msg.TimeoutSeconds) * time.Second
+	}
+
+	ds, err := service.NewDockerServiceWithTimeout(timeout)
 	if err != nil {
 		DefaultLogger.Printf("error: %v\n", err)
 		return err
 	}
 	defer ds.Client.Close()
+	ds.AllowNetwork = msg.AllowNetwork
 
 	var exit int64
 	var stdout string
@@ -280,7 +301,7 @@ func (h *RealSubmissionHandler) Handle(body []byte) error {
 		frameworkPath,
 		int64(configuration.Configuration.Worker.Docker.MaxMemory),
 	)
-	if err != nil {
+	if err != nil && err != service.ErrTimeout {
 		DefaultLogger.WithFields(logrus.Fields{
 			"submissionID": msg.SubmissionID,
 			"stdout":       stdout,
@@ -290,7 +311,21 @@ func (h *RealSubmissionHandler) Handle(body []byte) error {
 		return err
 	}
 
-	if exit == symbol.TestingResultSuccess.AsInt64() {
+	if err == service.ErrTimeout {
+		// the container has been killed already
+		DefaultLogger.WithFields(logrus.Fields{
+			"submissionID": msg.SubmissionID,
+			"timeout":      timeout,
+			"image":        msg.DockerImage,
+		}).Warn(err)
+
+		workerResp.Log = fmt.Sprintf("The execution of your upload (The ID is %v) took longer than %v and has been stopped.\n",
+			msg.SubmissionID, timeout)
+		workerResp.Status = symbol.TestingResultTimeout
+		workerResp.FinishedAt = time.Now()
+
+	} else if exit == symbol.TestingResultSuccess.AsInt64() {
+		workerResp.Diff = extractDockerDiff(stdout)
 		stdout = cleanDockerOutput(stdout)
 		// 3. push result back to server
 		workerResp.Log = stdout
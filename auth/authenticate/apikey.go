@@ -0,0 +1,59 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package authenticate
+
+import (
+	"net/http"
+	"strings"
+)
+
+const (
+	// APIKeyScopeRead allows safe requests (GET, HEAD, OPTIONS) only.
+	APIKeyScopeRead = "read"
+	// APIKeyScopeWrite allows all requests.
+	APIKeyScopeWrite = "write"
+)
+
+// APIKeyResolver identifies the owner of a personal api key.
+type APIKeyResolver interface {
+	// ResolveAPIKey returns the login id, the root flag of the owner and the
+	// scope of the key.
+	ResolveAPIKey(key string) (loginID int64, root bool, scope string, err error)
+}
+
+// APIKeyFromHeader extracts the key from an "Authorization: ApiKey <key>"
+// header.
+func APIKeyFromHeader(r *http.Request) string {
+	header := r.Header.Get("Authorization")
+	if len(header) > 7 && strings.EqualFold(header[0:7], "APIKEY ") {
+		return strings.TrimSpace(header[7:])
+	}
+	return ""
+}
+
+// HasAPIKey tests if the request header has an api key without verifying the
+// correctness.
+func HasAPIKey(r *http.Request) bool {
+	return APIKeyFromHeader(r) != ""
+}
+
+// isSafeMethod tests if a request does not modify any data.
+func isSafeMethod(r *http.Request) bool {
+	return r.Method == http.MethodGet || r.Method == http.MethodHead || r.Method == http.MethodOptions
+}
@@ -44,6 +44,16 @@ func NewSessionAuth(config *configuration.AuthenticationConfiguration) *scs.Mana
 	return sessionManager
 }
 
+// SessionRevocationResolver knows whether a user logged out from all devices.
+type SessionRevocationResolver interface {
+	// SessionRevoked tests whether a session of the user which started at the
+	// given unix time has been revoked.
+	SessionRevoked(loginID int64, issuedAt int64) bool
+	// SessionIdle tests whether the session has been inactive for too long.
+	// Otherwise the request is recorded as the latest activity.
+	SessionIdle(sessionID string) bool
+}
+
 // HasHeaderToken tests if the request header has a token without verifying the
 // correctness.
 func HasHeaderToken(r *http.Request) bool {
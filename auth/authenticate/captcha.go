@@ -0,0 +1,150 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package authenticate
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	redis "github.com/go-redis/redis"
+	"github.com/infomark-org/infomark/configuration"
+)
+
+// ErrCaptchaInvalid is returned when the provider rejects a captcha token.
+var ErrCaptchaInvalid = errors.New("captcha is invalid")
+
+// CaptchaVerifyURLs are the verification endpoints of the supported providers.
+var CaptchaVerifyURLs = map[string]string{
+	"hcaptcha":  "https://hcaptcha.com/siteverify",
+	"recaptcha": "https://www.google.com/recaptcha/api/siteverify",
+}
+
+// CaptchaVerifier checks a captcha token which was solved by a client.
+type CaptchaVerifier interface {
+	Verify(token string, remoteIP string) error
+}
+
+// SiteverifyCaptcha verifies tokens against a "siteverify" endpoint, which is
+// the common API of hCaptcha and reCAPTCHA.
+type SiteverifyCaptcha struct {
+	URL    string
+	Secret string
+	Client *http.Client
+}
+
+// NewCaptchaVerifier creates the verifier of the configured provider.
+func NewCaptchaVerifier(config *configuration.AuthenticationConfiguration) (CaptchaVerifier, error) {
+	verifyURL := config.Captcha.VerifyURL
+	if verifyURL == "" {
+		known, ok := CaptchaVerifyURLs[config.Captcha.Provider]
+		if !ok {
+			return nil, fmt.Errorf("unknown captcha provider \"%s\"", config.Captcha.Provider)
+		}
+		verifyURL = known
+	}
+
+	return &SiteverifyCaptcha{
+		URL:    verifyURL,
+		Secret: config.Captcha.Secret,
+		Client: &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+// Verify asks the provider whether the token is valid. It returns
+// ErrCaptchaInvalid if the provider rejects the token.
+func (c *SiteverifyCaptcha) Verify(token string, remoteIP string) error {
+	if token == "" {
+		return ErrCaptchaInvalid
+	}
+
+	resp, err := c.Client.PostForm(c.URL, url.Values{
+		"secret":   {c.Secret},
+		"response": {token},
+		"remoteip": {remoteIP},
+	})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("captcha provider returned status %d", resp.StatusCode)
+	}
+
+	result := struct {
+		Success bool `json:"success"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return err
+	}
+
+	if !result.Success {
+		return ErrCaptchaInvalid
+	}
+	return nil
+}
+
+// LoginFailureCounter counts failed logins per IP address in redis. Entries
+// expire after the configured window. The address is the one of ClientIP,
+// such that it matches the address the captcha is verified for.
+type LoginFailureCounter struct {
+	Redis  *redis.Client
+	Prefix string
+}
+
+// NewLoginFailureCounter creates a counter storing its keys below prefix.
+func NewLoginFailureCounter(client *redis.Client, prefix string) *LoginFailureCounter {
+	return &LoginFailureCounter{Redis: client, Prefix: prefix}
+}
+
+func (c *LoginFailureCounter) key(r *http.Request) string {
+	return fmt.Sprintf("%s:%s", c.Prefix, ClientIP(r).String())
+}
+
+// Count returns the number of recent failed logins from the IP of r.
+func (c *LoginFailureCounter) Count(r *http.Request) (int64, error) {
+	count, err := c.Redis.Get(c.key(r)).Int64()
+	if err == redis.Nil {
+		return 0, nil
+	}
+	return count, err
+}
+
+// Add records a failed login from the IP of r. The window starts with the
+// first failure, failures never expire without a window.
+func (c *LoginFailureCounter) Add(r *http.Request, window time.Duration) error {
+	key := c.key(r)
+	count, err := c.Redis.Incr(key).Result()
+	if err != nil {
+		return err
+	}
+	if count == 1 && window > 0 {
+		return c.Redis.Expire(key, window).Err()
+	}
+	return nil
+}
+
+// Reset forgets all failed logins from the IP of r.
+func (c *LoginFailureCounter) Reset(r *http.Request) error {
+	return c.Redis.Del(c.key(r)).Err()
+}
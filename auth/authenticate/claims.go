@@ -22,6 +22,7 @@ package authenticate
 import (
 	"errors"
 	"net/http"
+	"time"
 
 	"github.com/alexedwards/scs"
 	jwt "github.com/dgrijalva/jwt-go"
@@ -30,9 +31,11 @@ import (
 // AccessClaims represent the claims parsed from JWT access token.
 type AccessClaims struct {
 	jwt.StandardClaims
-	AccessNotRefresh bool  `json:"anr"`      // to distinguish between access and refresh code
-	LoginID          int64 `json:"login_id"` // the id to get user information
-	Root             bool  `json:"root"`     // a global flag to bypass all permission checks
+	AccessNotRefresh bool   `json:"anr"`                       // to distinguish between access and refresh code
+	LoginID          int64  `json:"login_id"`                  // the id to get user information
+	Root             bool   `json:"root"`                      // a global flag to bypass all permission checks
+	ImpersonatorID   int64  `json:"impersonator_id,omitempty"` // the root user acting as LoginID (impersonation only)
+	SessionID        string `json:"sid,omitempty"`             // the session tracked for inactivity (if enabled)
 }
 
 func NewAccessClaims(loginId int64, root bool) AccessClaims {
@@ -46,8 +49,9 @@ func NewAccessClaims(loginId int64, root bool) AccessClaims {
 // RefreshClaims represent the claims parsed from JWT refresh token.
 type RefreshClaims struct {
 	jwt.StandardClaims
-	AccessNotRefresh bool  `json:"anr"`
-	LoginID          int64 `json:"login_id"`
+	AccessNotRefresh bool   `json:"anr"`
+	LoginID          int64  `json:"login_id"`
+	SessionID        string `json:"sid,omitempty"`
 }
 
 func NewRefreshClaims(loginId int64) RefreshClaims {
@@ -72,8 +76,10 @@ func (ret *RefreshClaims) ParseRefreshClaimsFromToken(secret string, tokenStr st
 	if claims, ok := token.Claims.(*RefreshClaims); ok && token.Valid {
 
 		if !claims.AccessNotRefresh {
+			ret.StandardClaims = claims.StandardClaims
 			ret.LoginID = claims.LoginID
 			ret.AccessNotRefresh = claims.AccessNotRefresh
+			ret.SessionID = claims.SessionID
 			return nil
 		} else {
 			return errors.New("token is an access token, but refresh token was required")
@@ -100,9 +106,12 @@ func (ret *AccessClaims) ParseAccessClaimsFromToken(secret string, tokenStr stri
 	if claims, ok := token.Claims.(*AccessClaims); ok && token.Valid {
 
 		if claims.AccessNotRefresh {
+			ret.StandardClaims = claims.StandardClaims
 			ret.LoginID = claims.LoginID
 			ret.AccessNotRefresh = claims.AccessNotRefresh
 			ret.Root = claims.Root
+			ret.ImpersonatorID = claims.ImpersonatorID
+			ret.SessionID = claims.SessionID
 			return nil
 		} else {
 			return errors.New("token is an refresh token, but access token was required")
@@ -127,10 +136,23 @@ func (ret *AccessClaims) ParseRefreshClaimsFromSession(manager *scs.Manager, r *
 		return err
 	}
 
+	issuedAt, err := session.GetInt64("issued_at")
+	if err != nil {
+		return err
+	}
+
+	// sessions created before inactivity tracking have no id
+	sessionID, err := session.GetString("session_id")
+	if err != nil {
+		return err
+	}
+
 	ret.LoginID = loginId
 	// cookie based authentification is access-token only
 	ret.AccessNotRefresh = true
 	ret.Root = root
+	ret.IssuedAt = issuedAt
+	ret.SessionID = sessionID
 	return nil
 }
 
@@ -147,6 +169,14 @@ func (ret *AccessClaims) WriteToSession(manager *scs.Manager, w http.ResponseWri
 		panic("hh")
 	}
 	// fmt.Println("Wrote ret.Root", ret.Root)
+	err = session.PutInt64(w, "issued_at", time.Now().Unix())
+	if err != nil {
+		panic("hh")
+	}
+	err = session.PutString(w, "session_id", ret.SessionID)
+	if err != nil {
+		panic("hh")
+	}
 
 	return w
 }
@@ -0,0 +1,61 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package authenticate
+
+import (
+	"fmt"
+	"time"
+
+	redis "github.com/go-redis/redis"
+	"github.com/infomark-org/infomark/auth"
+)
+
+// IdleSessionTracker remembers the last activity of sessions in redis. The
+// entry of a session expires once it was idle for the inactivity timeout.
+type IdleSessionTracker struct {
+	Redis  *redis.Client
+	Prefix string
+}
+
+// NewIdleSessionTracker creates a tracker storing its keys below prefix.
+func NewIdleSessionTracker(client *redis.Client, prefix string) *IdleSessionTracker {
+	return &IdleSessionTracker{Redis: client, Prefix: prefix}
+}
+
+func (t *IdleSessionTracker) key(sessionID string) string {
+	return fmt.Sprintf("%s:%s", t.Prefix, sessionID)
+}
+
+// Start creates a new session which expires after being idle for timeout.
+func (t *IdleSessionTracker) Start(timeout time.Duration) (string, error) {
+	sessionID := auth.GenerateToken(16)
+	err := t.Redis.Set(t.key(sessionID), time.Now().Unix(), timeout).Err()
+	return sessionID, err
+}
+
+// Touch records an activity within the session. It reports false if the
+// session has been idle for too long (or never existed).
+func (t *IdleSessionTracker) Touch(sessionID string, timeout time.Duration) (bool, error) {
+	return t.Redis.SetXX(t.key(sessionID), time.Now().Unix(), timeout).Result()
+}
+
+// Stop ends a session immediately.
+func (t *IdleSessionTracker) Stop(sessionID string) error {
+	return t.Redis.Del(t.key(sessionID)).Err()
+}
@@ -0,0 +1,107 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package authenticate
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/infomark-org/infomark/configuration"
+)
+
+// LDAPUserInfo contains the attributes of a directory entry we care about.
+type LDAPUserInfo struct {
+	DN            string
+	Email         string
+	FirstName     string
+	LastName      string
+	StudentNumber string
+}
+
+// LDAPAuthenticate binds against the directory with the given credentials and
+// reads the attributes of the bound entry. The DN is built from the configured
+// pattern, where "%s" is replaced by the (escaped) login name.
+func LDAPAuthenticate(config *configuration.ServerConfigurationSchema, login string, password string) (*LDAPUserInfo, error) {
+	ldapConfig := config.Authentication.LDAP
+
+	// an empty password would result in an unauthenticated bind, which
+	// always succeeds
+	if login == "" || password == "" {
+		return nil, errors.New("credentials are wrong")
+	}
+
+	conn, err := ldap.DialURL(ldapConfig.URL)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	dn := fmt.Sprintf(ldapConfig.BindDN, escapeDN(login))
+	if err := conn.Bind(dn, password); err != nil {
+		return nil, err
+	}
+
+	attributes := ldapConfig.Attributes
+	request := ldap.NewSearchRequest(
+		dn, ldap.ScopeBaseObject, ldap.NeverDerefAliases, 1, 0, false,
+		"(objectClass=*)",
+		[]string{attributes.Email, attributes.FirstName, attributes.LastName, attributes.StudentNumber},
+		nil,
+	)
+
+	result, err := conn.Search(request)
+	if err != nil {
+		return nil, err
+	}
+	if len(result.Entries) != 1 {
+		return nil, errors.New("ldap entry not found")
+	}
+
+	entry := result.Entries[0]
+	info := &LDAPUserInfo{
+		DN:            entry.DN,
+		Email:         strings.ToLower(strings.TrimSpace(entry.GetAttributeValue(attributes.Email))),
+		FirstName:     entry.GetAttributeValue(attributes.FirstName),
+		LastName:      entry.GetAttributeValue(attributes.LastName),
+		StudentNumber: entry.GetAttributeValue(attributes.StudentNumber),
+	}
+
+	if info.Email == "" {
+		return nil, errors.New("ldap entry has no email address")
+	}
+
+	return info, nil
+}
+
+// escapeDN escapes special characters of an attribute value in a DN (RFC 4514).
+func escapeDN(value string) string {
+	var builder strings.Builder
+	for i, c := range value {
+		switch {
+		case strings.ContainsRune(",+\"\\<>;=", c),
+			i == 0 && (c == ' ' || c == '#'),
+			i == len(value)-1 && c == ' ':
+			builder.WriteRune('\\')
+		}
+		builder.WriteRune(c)
+	}
+	return builder.String()
+}
@@ -22,8 +22,11 @@ package authenticate
 import (
 	"context"
 	"fmt"
+	"net"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/alexedwards/scs"
 	"github.com/go-chi/jwtauth"
@@ -39,15 +42,31 @@ import (
 )
 
 // RequiredValidAccessClaimsMiddleware tries to get information about the identity which
-// issues a request by looking into the authorization header and then into
-// the cookie.
-func RequiredValidAccessClaims(manager *scs.Manager, config *configuration.ServerConfigurationSchema) func(http.Handler) http.Handler {
+// issues a request by looking into the authorization header (api key or JWT),
+// the signature of the url and then into the cookie.
+func RequiredValidAccessClaims(manager *scs.Manager, config *configuration.ServerConfigurationSchema, apiKeys APIKeyResolver, sessions SessionRevocationResolver) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			accessClaims := &AccessClaims{}
 
-			// first we test the JWT autorization
-			if HasHeaderToken(r) {
+			// scripts use personal api keys
+			if HasAPIKey(r) {
+				loginID, root, scope, err := apiKeys.ResolveAPIKey(APIKeyFromHeader(r))
+				if err != nil {
+					render.Render(w, r, auth.ErrUnauthenticated)
+					return
+				}
+
+				// read-only keys cannot modify anything
+				if scope != APIKeyScopeWrite && !isSafeMethod(r) {
+					render.Render(w, r, auth.ErrUnauthorized)
+					return
+				}
+
+				*accessClaims = NewAccessClaims(loginID, root)
+
+			} else if HasHeaderToken(r) {
+				// first we test the JWT autorization
 				// parse token from from header
 				tokenStr := jwtauth.TokenFromHeader(r)
 
@@ -59,6 +78,34 @@ func RequiredValidAccessClaims(manager *scs.Manager, config *configuration.Serve
 					return
 				}
 
+				// shared computers log out users who walked away
+				if accessClaims.SessionID != "" && sessions.SessionIdle(accessClaims.SessionID) {
+					render.Render(w, r, auth.ErrUnauthenticated)
+					return
+				}
+
+			} else if HasSignedURL(r) {
+				// shared links to files act on behalf of the signer, but never
+				// with root privileges and for reading only
+				if !isSafeMethod(r) {
+					render.Render(w, r, auth.ErrUnauthorized)
+					return
+				}
+
+				loginID, issuedAt, err := VerifySignedURL(config.Authentication.JWT.Secret, r, time.Now())
+				if err != nil {
+					render.Render(w, r, auth.ErrUnauthenticated)
+					return
+				}
+
+				// the signer might have logged out from all devices
+				if sessions.SessionRevoked(loginID, issuedAt) {
+					render.Render(w, r, auth.ErrUnauthenticated)
+					return
+				}
+
+				*accessClaims = NewAccessClaims(loginID, false)
+
 			} else {
 				// fmt.Println("no token, try session")
 				if HasSessionToken(manager, r) {
@@ -70,6 +117,18 @@ func RequiredValidAccessClaims(manager *scs.Manager, config *configuration.Serve
 						return
 					}
 
+					// the user might have logged out from all devices
+					if sessions.SessionRevoked(accessClaims.LoginID, accessClaims.IssuedAt) {
+						render.Render(w, r, auth.ErrUnauthenticated)
+						return
+					}
+
+					if accessClaims.SessionID != "" && sessions.SessionIdle(accessClaims.SessionID) {
+						accessClaims.DestroyInSession(manager, w, r)
+						render.Render(w, r, auth.ErrUnauthenticated)
+						return
+					}
+
 					// session is valid --> we will extend the session
 					w = accessClaims.UpdateSession(manager, w, r)
 				} else {
@@ -80,6 +139,12 @@ func RequiredValidAccessClaims(manager *scs.Manager, config *configuration.Serve
 				}
 			}
 
+			// tell the access log who issued this request
+			if identity, ok := r.Context().Value(symbol.CtxKeyAccessLog).(*AccessLogIdentity); ok {
+				identity.LoginID = accessClaims.LoginID
+				identity.ImpersonatorID = accessClaims.ImpersonatorID
+			}
+
 			// nothing given
 			// serve next
 			ctx := context.WithValue(r.Context(), symbol.CtxKeyAccessClaims, accessClaims)
@@ -88,6 +153,13 @@ func RequiredValidAccessClaims(manager *scs.Manager, config *configuration.Serve
 	}
 }
 
+// AccessLogIdentity is placed into the request context by the access log and
+// filled in by the authentication middleware.
+type AccessLogIdentity struct {
+	LoginID        int64
+	ImpersonatorID int64
+}
+
 type LoginLimiterKey interface {
 	Key() string
 }
@@ -108,14 +180,57 @@ func NewLoginLimiterKeyFromIP(r *http.Request) *LoginLimiterKeyFromIP {
 }
 
 func (obj *LoginLimiterKeyFromIP) Key() string {
+	return ClientIP(obj.R).String()
+}
+
+// ClientIP returns the address of the client issuing r. The "X-Forwarded-For"
+// and "X-Real-IP" headers are only used if the request arrives from one of
+// the configured trusted proxies, as any client can set them.
+func ClientIP(r *http.Request) net.IP {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	remote := net.ParseIP(host)
+
+	trusted := []string{}
+	if configuration.Configuration != nil {
+		trusted = configuration.Configuration.Server.HTTP.TrustedProxies
+	}
+	if remote == nil || !isTrustedProxy(remote, trusted) {
+		return remote
+	}
 
-	options := limiter.Options{
-		IPv4Mask:           limiter.DefaultIPv4Mask,
-		IPv6Mask:           limiter.DefaultIPv6Mask,
-		TrustForwardHeader: true,
+	// proxies append the address they received the request from, the first
+	// untrusted address from the right is the client
+	forwarded := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
+	for k := len(forwarded) - 1; k >= 0; k-- {
+		ip := net.ParseIP(strings.TrimSpace(forwarded[k]))
+		if ip == nil {
+			break
+		}
+		if !isTrustedProxy(ip, trusted) {
+			return ip
+		}
 	}
 
-	return limiter.GetIP(obj.R, options).String()
+	if ip := net.ParseIP(strings.TrimSpace(r.Header.Get("X-Real-IP"))); ip != nil {
+		return ip
+	}
+	return remote
+}
+
+func isTrustedProxy(ip net.IP, trusted []string) bool {
+	for _, proxy := range trusted {
+		if _, network, err := net.ParseCIDR(proxy); err == nil {
+			if network.Contains(ip) {
+				return true
+			}
+		} else if ip.Equal(net.ParseIP(proxy)) {
+			return true
+		}
+	}
+	return false
 }
 
 func NewLoginLimiter(prefix string, limit string, redisURL string) (*LoginLimiter, error) {
@@ -156,6 +271,18 @@ func (ll *LoginLimiter) Get(r *http.Request, KeyFunc LoginLimiterKey) (limiter.C
 
 }
 
+// Peek returns the current state of the limit without counting a request.
+func (ll *LoginLimiter) Peek(r *http.Request, KeyFunc LoginLimiterKey) (limiter.Context, error) {
+
+	return limiter.Store.Peek(
+		*ll.Store,
+		r.Context(),
+		fmt.Sprintf("%s-%s", KeyFunc.Key(), ll.Prefix),
+		*ll.Rate,
+	)
+
+}
+
 func (ll *LoginLimiter) WriteHeaders(w http.ResponseWriter, context limiter.Context) {
 	w.Header().Add("X-RateLimit-Limit", strconv.FormatInt(context.Limit, 10))
 	w.Header().Add("X-RateLimit-Remaining", strconv.FormatInt(context.Remaining, 10))
@@ -0,0 +1,178 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package authenticate
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/infomark-org/infomark/configuration"
+)
+
+// OIDCProvider implements the authorization code flow of OpenID Connect.
+// Instead of verifying the signature of the ID token, we ask the userinfo
+// endpoint of the identity provider directly (server-to-server).
+type OIDCProvider struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Client       *http.Client
+}
+
+// OIDCDiscovery contains the relevant parts of the provider metadata
+// from "/.well-known/openid-configuration".
+type OIDCDiscovery struct {
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserinfoEndpoint      string `json:"userinfo_endpoint"`
+}
+
+// OIDCUserInfo represents the standard claims returned by the userinfo endpoint.
+type OIDCUserInfo struct {
+	Subject       string `json:"sub"`
+	Email         string `json:"email"`
+	EmailVerified *bool  `json:"email_verified"`
+	GivenName     string `json:"given_name"`
+	FamilyName    string `json:"family_name"`
+}
+
+// NewOIDCProvider creates an OIDCProvider from the configuration.
+func NewOIDCProvider(config *configuration.ServerConfigurationSchema) *OIDCProvider {
+	return &OIDCProvider{
+		Issuer:       strings.TrimSuffix(config.Authentication.OIDC.Issuer, "/"),
+		ClientID:     config.Authentication.OIDC.ClientID,
+		ClientSecret: config.Authentication.OIDC.ClientSecret,
+		RedirectURL:  fmt.Sprintf("%s/api/v1/auth/oidc/callback", config.ExternalURL()),
+		Client:       &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Discover fetches the endpoints of the identity provider.
+func (p *OIDCProvider) Discover() (*OIDCDiscovery, error) {
+	resp, err := p.Client.Get(p.Issuer + "/.well-known/openid-configuration")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("oidc discovery failed with status %d", resp.StatusCode)
+	}
+
+	discovery := &OIDCDiscovery{}
+	if err := json.NewDecoder(resp.Body).Decode(discovery); err != nil {
+		return nil, err
+	}
+	return discovery, nil
+}
+
+// AuthCodeURL returns the URL of the identity provider the user has to visit.
+func (p *OIDCProvider) AuthCodeURL(state string) (string, error) {
+	discovery, err := p.Discover()
+	if err != nil {
+		return "", err
+	}
+
+	v := url.Values{}
+	v.Set("response_type", "code")
+	v.Set("client_id", p.ClientID)
+	v.Set("redirect_uri", p.RedirectURL)
+	v.Set("scope", "openid email profile")
+	v.Set("state", state)
+
+	if strings.Contains(discovery.AuthorizationEndpoint, "?") {
+		return discovery.AuthorizationEndpoint + "&" + v.Encode(), nil
+	}
+	return discovery.AuthorizationEndpoint + "?" + v.Encode(), nil
+}
+
+// Exchange trades the authorization code for an access token and returns the
+// identity behind it.
+func (p *OIDCProvider) Exchange(code string) (*OIDCUserInfo, error) {
+	discovery, err := p.Discover()
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.RedirectURL)
+	form.Set("client_id", p.ClientID)
+	form.Set("client_secret", p.ClientSecret)
+
+	resp, err := p.Client.PostForm(discovery.TokenEndpoint, form)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("oidc token exchange failed with status %d", resp.StatusCode)
+	}
+
+	token := struct {
+		AccessToken string `json:"access_token"`
+		TokenType   string `json:"token_type"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return nil, err
+	}
+	if token.AccessToken == "" {
+		return nil, errors.New("oidc token response has no access token")
+	}
+
+	req, err := http.NewRequest("GET", discovery.UserinfoEndpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token.AccessToken)
+
+	userResp, err := p.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer userResp.Body.Close()
+
+	if userResp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("oidc userinfo failed with status %d", userResp.StatusCode)
+	}
+
+	info := &OIDCUserInfo{}
+	if err := json.NewDecoder(userResp.Body).Decode(info); err != nil {
+		return nil, err
+	}
+
+	if info.Subject == "" || info.Email == "" {
+		return nil, errors.New("oidc userinfo is missing subject or email")
+	}
+
+	if info.EmailVerified != nil && !*info.EmailVerified {
+		return nil, errors.New("email address is not verified by the identity provider")
+	}
+
+	info.Email = strings.ToLower(strings.TrimSpace(info.Email))
+	return info, nil
+}
@@ -0,0 +1,94 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package authenticate
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+var (
+	// ErrSignedURLInvalid is returned for a signature not matching the URL.
+	ErrSignedURLInvalid = errors.New("signature of url is invalid")
+	// ErrSignedURLExpired is returned for a signed URL which is not valid anymore.
+	ErrSignedURLExpired = errors.New("signed url has expired")
+)
+
+// signURL computes the signature covering the path, the signer and the
+// validity of a signed URL.
+func signURL(secret string, path string, loginID int64, issuedAt int64, expiresAt int64) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "signed-url\n%s\n%d\n%d\n%d", path, loginID, issuedAt, expiresAt)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// SignURL appends an expiring signature to the path. Everyone knowing the
+// resulting URL can read the resource with the permissions of the signer
+// without being logged in.
+func SignURL(secret string, path string, loginID int64, issuedAt time.Time, expiresAt time.Time) string {
+	query := url.Values{}
+	query.Set("signer", strconv.FormatInt(loginID, 10))
+	query.Set("issued", strconv.FormatInt(issuedAt.Unix(), 10))
+	query.Set("expires", strconv.FormatInt(expiresAt.Unix(), 10))
+	query.Set("signature", signURL(secret, path, loginID, issuedAt.Unix(), expiresAt.Unix()))
+	return path + "?" + query.Encode()
+}
+
+// HasSignedURL tests if the request url carries a signature without verifying
+// the correctness.
+func HasSignedURL(r *http.Request) bool {
+	return r.URL.Query().Get("signature") != ""
+}
+
+// VerifySignedURL returns the signer of the request url and the unix time the
+// url was signed at.
+func VerifySignedURL(secret string, r *http.Request, now time.Time) (int64, int64, error) {
+	query := r.URL.Query()
+
+	loginID, err := strconv.ParseInt(query.Get("signer"), 10, 64)
+	if err != nil {
+		return 0, 0, ErrSignedURLInvalid
+	}
+	issuedAt, err := strconv.ParseInt(query.Get("issued"), 10, 64)
+	if err != nil {
+		return 0, 0, ErrSignedURLInvalid
+	}
+	expiresAt, err := strconv.ParseInt(query.Get("expires"), 10, 64)
+	if err != nil {
+		return 0, 0, ErrSignedURLInvalid
+	}
+
+	expected := signURL(secret, r.URL.Path, loginID, issuedAt, expiresAt)
+	if !hmac.Equal([]byte(expected), []byte(query.Get("signature"))) {
+		return 0, 0, ErrSignedURLInvalid
+	}
+
+	if now.Unix() >= expiresAt {
+		return 0, 0, ErrSignedURLExpired
+	}
+
+	return loginID, issuedAt, nil
+}
@@ -29,17 +29,19 @@ import (
 
 // TokenAuth implements JWT authentication flow.
 type TokenAuth struct {
-	JwtAuth          *jwtauth.JWTAuth
-	JwtAccessExpiry  time.Duration
-	JwtRefreshExpiry time.Duration
+	JwtAuth                *jwtauth.JWTAuth
+	JwtAccessExpiry        time.Duration
+	JwtRefreshExpiry       time.Duration
+	JwtImpersonationExpiry time.Duration
 }
 
 // NewTokenAuth configures and returns a JWT authentication instance.
 func NewTokenAuth(config *configuration.AuthenticationConfiguration) *TokenAuth {
 	return &TokenAuth{
-		JwtAuth:          jwtauth.New("HS256", []byte(config.JWT.Secret), nil),
-		JwtAccessExpiry:  config.JWT.AccessExpiry,
-		JwtRefreshExpiry: config.JWT.RefreshExpiry,
+		JwtAuth:                jwtauth.New("HS256", []byte(config.JWT.Secret), nil),
+		JwtAccessExpiry:        config.JWT.AccessExpiry,
+		JwtRefreshExpiry:       config.JWT.RefreshExpiry,
+		JwtImpersonationExpiry: config.JWT.ImpersonationExpiry,
 	}
 
 }
@@ -52,17 +54,39 @@ func (a *TokenAuth) Verifier() func(http.Handler) http.Handler {
 // CreateAccessJWT returns an access token for provided account claims.
 func (a *TokenAuth) CreateAccessJWT(claims AccessClaims) (string, error) {
 	claims.StandardClaims.IssuedAt = time.Now().UTC().Unix()
-	claims.StandardClaims.ExpiresAt = time.Now().UTC().Unix() + int64(a.JwtAccessExpiry)
+	claims.StandardClaims.ExpiresAt = time.Now().UTC().Add(a.JwtAccessExpiry).Unix()
 
 	_, tokenString, err := a.JwtAuth.Encode(claims)
 	return tokenString, err
 }
 
+// CreateImpersonationJWT returns a short-lived access token which lets the
+// root user impersonatorID act as the user loginID. There is no refresh token
+// for impersonations. Falls back to the regular access expiry if no dedicated
+// lifetime is configured.
+func (a *TokenAuth) CreateImpersonationJWT(loginID int64, impersonatorID int64) (string, time.Time, error) {
+	expiry := a.JwtImpersonationExpiry
+	if expiry <= 0 {
+		expiry = a.JwtAccessExpiry
+	}
+
+	claims := NewAccessClaims(loginID, false)
+	claims.ImpersonatorID = impersonatorID
+
+	now := time.Now().UTC()
+	expiresAt := now.Add(expiry)
+	claims.StandardClaims.IssuedAt = now.Unix()
+	claims.StandardClaims.ExpiresAt = expiresAt.Unix()
+
+	_, tokenString, err := a.JwtAuth.Encode(claims)
+	return tokenString, expiresAt, err
+}
+
 // CreateRefreshJWT returns a refresh token for provided token Claims.
 func (a *TokenAuth) CreateRefreshJWT(claims RefreshClaims) (string, error) {
 
 	claims.StandardClaims.IssuedAt = time.Now().UTC().Unix()
-	claims.StandardClaims.ExpiresAt = time.Now().UTC().Unix() + int64(a.JwtRefreshExpiry)
+	claims.StandardClaims.ExpiresAt = time.Now().UTC().Add(a.JwtRefreshExpiry).Unix()
 
 	_, tokenString, err := a.JwtAuth.Encode(claims)
 	return tokenString, err
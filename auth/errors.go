@@ -39,9 +39,10 @@ type ErrResponse struct {
 	Err            error `json:"-"` // low-level runtime error
 	HTTPStatusCode int   `json:"-"` // http response status code
 
-	StatusText string `json:"status"`          // user-level status message
-	AppCode    int64  `json:"code,omitempty"`  // application-specific error code
-	ErrorText  string `json:"error,omitempty"` // application-level error message, for debugging
+	StatusText string `json:"status"`               // user-level status message
+	AppCode    int64  `json:"code,omitempty"`       // application-specific error code
+	ErrorText  string `json:"error,omitempty"`      // application-level error message, for debugging
+	RequestID  string `json:"request_id,omitempty"` // id to find the request in the logs
 }
 
 // Render sets the application-specific error code in AppCode.
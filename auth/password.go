@@ -21,17 +21,42 @@ package auth
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
 	"fmt"
 
 	"golang.org/x/crypto/bcrypt"
 )
 
+// PasswordCost is the bcrypt cost of new password hashes. Values below
+// bcrypt.MinCost fall back to bcrypt.DefaultCost, values above bcrypt.MaxCost
+// are capped.
+var PasswordCost = bcrypt.DefaultCost
+
+// passwordCost returns the cost bcrypt actually uses for new hashes. Otherwise
+// bcrypt would fail to hash any password with a cost above its maximum.
+func passwordCost() int {
+	if PasswordCost < bcrypt.MinCost {
+		return bcrypt.DefaultCost
+	}
+	if PasswordCost > bcrypt.MaxCost {
+		return bcrypt.MaxCost
+	}
+	return PasswordCost
+}
+
 // HashPassword uses bcrypt to securely hash a plain password
 func HashPassword(plainPassword string) (string, error) {
-	bytes, err := bcrypt.GenerateFromPassword([]byte(plainPassword), bcrypt.DefaultCost)
+	bytes, err := bcrypt.GenerateFromPassword([]byte(plainPassword), passwordCost())
 	return string(bytes), err
 }
 
+// PasswordNeedsRehash tests whether a hash has been computed with a lower
+// cost than new hashes, e.g. because the cost was increased since.
+func PasswordNeedsRehash(hash string) bool {
+	cost, err := bcrypt.Cost([]byte(hash))
+	return err == nil && cost < passwordCost()
+}
+
 // CheckPasswordHash tests whether a given plainPassword matches the securely
 // hashed one.
 func CheckPasswordHash(plainPassword, hash string) bool {
@@ -45,3 +70,9 @@ func GenerateToken(length int) string {
 	rand.Read(b)
 	return fmt.Sprintf("%x", b)
 }
+
+// HashToken computes a checksum of a random token to store it at rest. As
+// such tokens have a high entropy (unlike passwords), we do not need bcrypt.
+func HashToken(token string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(token)))
+}
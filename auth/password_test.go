@@ -0,0 +1,49 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package auth
+
+import (
+	"testing"
+
+	"github.com/franela/goblin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestPasswordCost(t *testing.T) {
+	g := goblin.Goblin(t)
+
+	g.Describe("PasswordCost", func() {
+
+		g.AfterEach(func() {
+			PasswordCost = bcrypt.DefaultCost
+		})
+
+		g.It("Should keep the cost within the bounds of bcrypt", func() {
+			PasswordCost = bcrypt.MinCost - 1
+			g.Assert(passwordCost()).Equal(bcrypt.DefaultCost)
+
+			PasswordCost = bcrypt.MinCost + 1
+			g.Assert(passwordCost()).Equal(bcrypt.MinCost + 1)
+
+			PasswordCost = bcrypt.MaxCost + 1
+			g.Assert(passwordCost()).Equal(bcrypt.MaxCost)
+		})
+
+	})
+}
@@ -0,0 +1,81 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package auth
+
+import (
+	"encoding/base32"
+	"testing"
+	"time"
+
+	"github.com/franela/goblin"
+)
+
+func TestTOTP(t *testing.T) {
+	g := goblin.Goblin(t)
+
+	g.Describe("TOTP", func() {
+
+		g.It("Should match RFC 6238 test vectors", func() {
+			// the RFC uses the ASCII secret "12345678901234567890" and 8 digits,
+			// we only use the last 6 digits
+			secret := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+			code, err := TOTPCode(secret, time.Unix(59, 0))
+			g.Assert(err).Equal(nil)
+			g.Assert(code).Equal("287082")
+
+			code, err = TOTPCode(secret, time.Unix(1111111109, 0))
+			g.Assert(err).Equal(nil)
+			g.Assert(code).Equal("081804")
+
+			code, err = TOTPCode(secret, time.Unix(2000000000, 0))
+			g.Assert(err).Equal(nil)
+			g.Assert(code).Equal("279037")
+		})
+
+		g.It("Should validate current code only", func() {
+			secret := GenerateTOTPSecret()
+
+			code, err := TOTPCode(secret, time.Now())
+			g.Assert(err).Equal(nil)
+			g.Assert(ValidateTOTPCode(secret, code)).Equal(true)
+
+			code, err = TOTPCode(secret, time.Now().Add(-10*time.Minute))
+			g.Assert(err).Equal(nil)
+			g.Assert(ValidateTOTPCode(secret, code)).Equal(false)
+
+			g.Assert(ValidateTOTPCode(secret, "")).Equal(false)
+			g.Assert(ValidateTOTPCode("not-base32!", "123456")).Equal(false)
+		})
+
+		g.It("Should encrypt and decrypt secrets", func() {
+			encrypted, err := EncryptString("passphrase", "JBSWY3DPEHPK3PXP")
+			g.Assert(err).Equal(nil)
+			g.Assert(encrypted != "JBSWY3DPEHPK3PXP").IsTrue()
+
+			plain, err := DecryptString("passphrase", encrypted)
+			g.Assert(err).Equal(nil)
+			g.Assert(plain).Equal("JBSWY3DPEHPK3PXP")
+
+			_, err = DecryptString("other-passphrase", encrypted)
+			g.Assert(err != nil).IsTrue()
+		})
+
+	})
+}
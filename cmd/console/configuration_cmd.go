@@ -91,32 +91,91 @@ func GenerateExampleConfiguration(domain string, root_path string) *configuratio
 	config.Server.HTTP.Timeouts.Write = DurationFromString("30s")
 	config.Server.HTTP.Limits.MaxHeader = 1 * bytefmt.Megabyte
 	config.Server.HTTP.Limits.MaxRequestJSON = 2 * bytefmt.Megabyte
+	config.Server.HTTP.Limits.MinAvatar = 200 * bytefmt.Byte
 	config.Server.HTTP.Limits.MaxAvatar = 1 * bytefmt.Megabyte
 	config.Server.HTTP.Limits.MaxSubmission = 4 * bytefmt.Megabyte
+	config.Server.HTTP.Limits.MaxInFlight = 0
+	config.Server.HTTP.StrictJSON = false
+	config.Server.HTTP.FileETags = true
+	config.Server.HTTP.Envelope = false
+	config.Server.HTTP.TrustedProxies = []string{}
+	config.Server.HTTP.CORS.AllowedOrigins = []string{"*"}
+	config.Server.HTTP.CORS.Routes = []configuration.CORSRouteConfiguration{
+		{Prefix: "/api/v1/auth/", AllowedOrigins: []string{config.Server.ExternalURL()}},
+	}
 
 	config.Server.Debugging.Enabled = false
 	config.Server.Debugging.LoginID = int64(1)
 	config.Server.Debugging.LoginIsRoot = false
 	config.Server.Debugging.LogLevel = "debug"
 	config.Server.Debugging.Fixtures = root_path + "/fixtures"
+	config.Server.Debugging.BodyLog.Enabled = false
+	config.Server.Debugging.BodyLog.RedactFields = []string{"password", "token", "secret", "key", "code"}
+	config.Server.Debugging.BodyLog.MaxBodySize = 16 * bytefmt.Kilobyte
+
+	config.Server.Logging.Format = "text"
 
 	config.Server.DistributeJobs = true
+	config.Server.MaxConcurrentJobs = 0
+	config.Server.JobLeaseTimeout = 15 * time.Minute
+	config.Server.UniqueActiveSubmissions = true
+	config.Server.DefaultLanguage = "en"
 
 	config.Server.Authentication.JWT.Secret = auth.GenerateToken(32)
 	config.Server.Authentication.JWT.AccessExpiry = 15 * time.Minute
 	config.Server.Authentication.JWT.RefreshExpiry = DurationFromString("10h")
+	config.Server.Authentication.JWT.ImpersonationExpiry = 5 * time.Minute
 	config.Server.Authentication.Session.Secret = auth.GenerateToken(32)
 	config.Server.Authentication.Session.Cookies.Secure = config.Server.HTTP.UseHTTPS
 	config.Server.Authentication.Session.Cookies.Lifetime = DurationFromString("24h")
 	config.Server.Authentication.Session.Cookies.IdleTimeout = DurationFromString("60m")
+	config.Server.Authentication.Session.InactivityTimeout = 0
 	config.Server.Authentication.Password.MinLength = 7
+	config.Server.Authentication.Password.BcryptCost = 10
+	config.Server.Authentication.Password.History = 0
+	config.Server.Authentication.Email.Verify = true
+	config.Server.Authentication.Email.ChangeWindow = DurationFromString("72h")
+	config.Server.Authentication.Email.ChangeReminder = DurationFromString("24h")
+	config.Server.Authentication.Login.AllowStudentNumber = false
+	config.Server.Authentication.TwoFactor.Issuer = "InfoMark"
+	config.Server.Authentication.TwoFactor.Secret = auth.GenerateToken(32)
+	config.Server.Authentication.OIDC.Enabled = false
+	config.Server.Authentication.OIDC.LinkExistingAccounts = false
+	config.Server.Authentication.LDAP.Enabled = false
+	config.Server.Authentication.LDAP.Attributes.Email = "mail"
+	config.Server.Authentication.LDAP.Attributes.FirstName = "givenName"
+	config.Server.Authentication.LDAP.Attributes.LastName = "sn"
+	config.Server.Authentication.LDAP.Attributes.StudentNumber = "employeeNumber"
+	config.Server.Authentication.LDAP.FallbackToLocal = true
+	config.Server.Authentication.LDAP.LinkExistingAccounts = false
+	config.Server.Authentication.Captcha.Enabled = false
+	config.Server.Authentication.Captcha.Provider = "hcaptcha"
+	config.Server.Authentication.Captcha.FailureThreshold = 3
+	config.Server.Authentication.Captcha.FailureWindow = DurationFromString("15m")
+	config.Server.Authentication.SignedURL.Lifetime = DurationFromString("24h")
 
 	config.Server.Authentication.TotalRequestsPerMinute = 100
 	config.Server.Cronjobs.ZipSubmissionsIntervall = DurationFromString("5m")
+	config.Server.Cronjobs.PurgeSubmissionsIntervall = DurationFromString("24h")
+	config.Server.Cronjobs.SendDigestsIntervall = DurationFromString("24h")
+	config.Server.Cronjobs.ExpireEmailChangesIntervall = DurationFromString("1h")
+	config.Server.Cronjobs.PurgeChunksIntervall = DurationFromString("1h")
+	config.Server.SubmissionRetention.Days = 0
+	config.Server.SubmissionRetention.KeepGraded = true
+	config.Server.LoginHistory.Days = 0
+	config.Server.SubmissionCleanup.Enabled = true
+	config.Server.SubmissionCleanup.JunkPatterns = []string{"__MACOSX", ".DS_Store", "Thumbs.db", "._*"}
+	config.Server.ChunkedUploads.Expiry = DurationFromString("24h")
+
+	config.Server.Registration.Open = true
+	config.Server.Registration.MaxSemester = 30
+	config.Server.Registration.Subjects = []string{}
+	config.Server.Registration.AutoEnrollCourses = []int64{}
 
 	config.Server.Email.Send = false
 	config.Server.Email.SendmailBinary = "/usr/sbin/sendmail"
 	config.Server.Email.From = fmt.Sprintf("no-reply@%s", config.Server.HTTP.Domain)
+	config.Server.Email.SubjectPrefix = ""
 	config.Server.Email.ChannelSize = 300
 
 	config.Server.Services.Redis.Host = "localhost"
@@ -141,6 +200,7 @@ func GenerateExampleConfiguration(domain string, root_path string) *configuratio
 	config.Server.Paths.Uploads = root_path + "/uploads"
 	config.Server.Paths.Common = root_path + "/common"
 	config.Server.Paths.GeneratedFiles = root_path + "/generated_files"
+	config.Server.Paths.CourseUploads = map[int64]string{}
 
 	config.Worker.Version = config.Server.Version
 	config.Worker.Services.RabbitMQ = config.Server.Services.RabbitMQ
@@ -245,6 +305,14 @@ var TestConfiguration = &cobra.Command{
 				status_code = -1
 			}
 
+			for courseID, path := range config.Server.Paths.CourseUploads {
+				err = fs.IsDirWriteable(path)
+				showResult(report, err, fmt.Sprintf("upload path of course %d writeable", courseID))
+				if err != nil {
+					status_code = -1
+				}
+			}
+
 			err = fs.IsDirWriteable(config.Server.Paths.GeneratedFiles)
 			showResult(report, err, "generated_files path writeable")
 			if err != nil {
@@ -27,6 +27,7 @@ import (
 	"os"
 	"os/exec"
 
+	"github.com/infomark-org/infomark/api/app"
 	"github.com/infomark-org/infomark/api/helper"
 	"github.com/infomark-org/infomark/configuration"
 	"github.com/infomark-org/infomark/migration"
@@ -41,6 +42,7 @@ func init() {
 	DatabaseCmd.AddCommand(DatabaseRestoreCmd)
 	DatabaseCmd.AddCommand(DatabaseBackupCmd)
 	DatabaseCmd.AddCommand(DatabaseMigrateCmd)
+	DatabaseCmd.AddCommand(DatabaseSeedCmd)
 }
 
 var DatabaseCmd = &cobra.Command{
@@ -240,3 +242,25 @@ var DatabaseMigrateCmd = &cobra.Command{
 
 	},
 }
+
+var DatabaseSeedCmd = &cobra.Command{
+	Use:   "seed",
+	Short: "create demo data for development",
+	Long:  `creates a demo course with sheets, tasks and users. Running it again does not duplicate any data.`,
+	Args:  cobra.ExactArgs(0),
+	Run: func(cmd *cobra.Command, args []string) {
+		configuration.MustFindAndReadConfiguration()
+
+		_, stores := MustConnectAndStores()
+
+		course, err := app.SeedDemoData(stores)
+		if err != nil {
+			log.Fatalf("seeding demo data was not successful\n %s", err)
+		}
+
+		fmt.Printf("demo course '%s' has id %v\n", course.Name, course.ID)
+		for _, user := range app.DemoUsers {
+			fmt.Printf("  %-28s password: %s\n", user.Email, app.DemoPassword)
+		}
+	},
+}
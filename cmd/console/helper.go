@@ -24,6 +24,7 @@ import (
 	"strconv"
 
 	"github.com/infomark-org/infomark/api/app"
+	"github.com/infomark-org/infomark/api/helper"
 	"github.com/infomark-org/infomark/configuration"
 	"github.com/jmoiron/sqlx"
 )
@@ -46,6 +47,7 @@ func ConnectAndStores() (*sqlx.DB, *app.Stores, error) {
 	}
 
 	stores := app.NewStores(db)
+	helper.CourseOfFile = app.CourseOfFile(stores)
 	return db, stores, nil
 }
 
@@ -24,6 +24,7 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"time"
 
 	"github.com/infomark-org/infomark/api/helper"
 	"github.com/infomark-org/infomark/api/shared"
@@ -92,14 +93,14 @@ var SubmissionTriggerCmd = &cobra.Command{
 
 		bodyPublic, err := json.Marshal(shared.NewSubmissionAMQPWorkerRequest(
 			course.ID, task.ID, submission.ID, grade.ID,
-			accessToken, configuration.Configuration.Server.ExternalURL(), task.PublicDockerImage.String, sha256, "public"))
+			accessToken, configuration.Configuration.Server.ExternalURL(), task.PublicDockerImage.String, sha256, "public", task.TimeoutSeconds, task.AllowNetwork))
 		if err != nil {
 			log.Fatalf("json.Marshal: %s", err)
 		}
 
 		bodyPrivate, err := json.Marshal(shared.NewSubmissionAMQPWorkerRequest(
 			course.ID, task.ID, submission.ID, grade.ID,
-			accessToken, configuration.Configuration.Server.ExternalURL(), task.PrivateDockerImage.String, sha256, "private"))
+			accessToken, configuration.Configuration.Server.ExternalURL(), task.PrivateDockerImage.String, sha256, "private", task.TimeoutSeconds, task.AllowNetwork))
 		if err != nil {
 			log.Fatalf("json.Marshal: %s", err)
 		}
@@ -132,11 +133,17 @@ var SubmissionRunCmd = &cobra.Command{
 
 		log.Println("try starting docker...")
 
-		ds, err := service.NewDockerServiceWithTimeout(configuration.Configuration.Worker.Docker.Timeout)
+		timeout := configuration.Configuration.Worker.Docker.Timeout
+		if task.TimeoutSeconds > 0 {
+			timeout = time.Duration(task.TimeoutSeconds) * time.Second
+		}
+
+		ds, err := service.NewDockerServiceWithTimeout(timeout)
 		if err != nil {
 			log.Fatal(err)
 		}
 		defer ds.Client.Close()
+		ds.AllowNetwork = task.AllowNetwork
 
 		var exit int64
 		var stdout string
@@ -300,12 +307,12 @@ WHERE task_id = $1
 			if args[1] == "public" {
 				body, merr = json.Marshal(shared.NewSubmissionAMQPWorkerRequest(
 					course.ID, taskID, submissionWithGrade.ID, submissionWithGrade.GradeID,
-					accessToken, configuration.Configuration.Server.ExternalURL(), task.PublicDockerImage.String, sha256, "public"))
+					accessToken, configuration.Configuration.Server.ExternalURL(), task.PublicDockerImage.String, sha256, "public", task.TimeoutSeconds, task.AllowNetwork))
 
 			} else {
 				body, merr = json.Marshal(shared.NewSubmissionAMQPWorkerRequest(
 					course.ID, taskID, submissionWithGrade.ID, submissionWithGrade.GradeID,
-					accessToken, configuration.Configuration.Server.ExternalURL(), task.PrivateDockerImage.String, sha256, "private"))
+					accessToken, configuration.Configuration.Server.ExternalURL(), task.PrivateDockerImage.String, sha256, "private", task.TimeoutSeconds, task.AllowNetwork))
 			}
 			if merr != nil {
 				log.Fatalf("json.Marshal: %s", merr)
@@ -45,12 +45,23 @@ func (config *RabbitMQConfiguration) URL() string {
 type AuthenticationConfiguration struct {
 	Email struct {
 		Verify bool `yaml:"verify" default:"true"`
+		// ChangeWindow is the time to confirm a new email address before the
+		// previous one is restored. Changes never expire if it is zero.
+		ChangeWindow time.Duration `yaml:"change_window"`
+		// ChangeReminder is the time before the end of the window a reminder is
+		// sent to the new address. No reminder is sent if it is zero.
+		ChangeReminder time.Duration `yaml:"change_reminder"`
 	} `yaml:"email"`
 
+	Login struct {
+		AllowStudentNumber bool `yaml:"allow_student_number" default:"false"`
+	} `yaml:"login"`
+
 	JWT struct {
-		Secret        string        `yaml:"secret"`
-		AccessExpiry  time.Duration `yaml:"access_expiry"`
-		RefreshExpiry time.Duration `yaml:"refresh_expiry"`
+		Secret              string        `yaml:"secret"`
+		AccessExpiry        time.Duration `yaml:"access_expiry"`
+		RefreshExpiry       time.Duration `yaml:"refresh_expiry"`
+		ImpersonationExpiry time.Duration `yaml:"impersonation_expiry"`
 	} `yaml:"jwt"`
 	Session struct {
 		Secret  string `yaml:"secret"`
@@ -59,10 +70,66 @@ type AuthenticationConfiguration struct {
 			Lifetime    time.Duration `yaml:"lifetime"`
 			IdleTimeout time.Duration `yaml:"idle_timeout"`
 		} `yaml:"cookies"`
+		// InactivityTimeout ends sessions and tokens without any request within
+		// this window. Zero disables it.
+		InactivityTimeout time.Duration `yaml:"inactivity_timeout"`
 	} `yaml:"session"`
 	Password struct {
 		MinLength int `yaml:"min_length"`
+		// BcryptCost of new password hashes. Weaker hashes are replaced on the
+		// next login.
+		BcryptCost int `yaml:"bcrypt_cost" default:"10"`
+		// History is the number of latest passwords of a user which cannot be
+		// used again, 0 allows any password.
+		History int `yaml:"history"`
 	} `yaml:"password"`
+	TwoFactor struct {
+		Issuer string `yaml:"issuer" default:"InfoMark"`
+		Secret string `yaml:"secret"`
+	} `yaml:"two_factor"`
+	OIDC struct {
+		Enabled      bool   `yaml:"enabled" default:"false"`
+		Issuer       string `yaml:"issuer"`
+		ClientID     string `yaml:"client_id"`
+		ClientSecret string `yaml:"client_secret"`
+		// LinkExistingAccounts decides whether an existing password account with the
+		// same email is linked to the identity provider or the login is rejected.
+		LinkExistingAccounts bool `yaml:"link_existing_accounts" default:"false"`
+	} `yaml:"oidc"`
+	LDAP struct {
+		Enabled bool   `yaml:"enabled" default:"false"`
+		URL     string `yaml:"url"`
+		// BindDN is the DN of an user, "%s" is replaced by the login name
+		// (e.g. "uid=%s,ou=people,dc=uni-tuebingen,dc=de").
+		BindDN     string `yaml:"bind_dn"`
+		Attributes struct {
+			Email         string `yaml:"email" default:"mail"`
+			FirstName     string `yaml:"first_name" default:"givenName"`
+			LastName      string `yaml:"last_name" default:"sn"`
+			StudentNumber string `yaml:"student_number" default:"employeeNumber"`
+		} `yaml:"attributes"`
+		// FallbackToLocal allows local accounts to log in when the bind fails.
+		FallbackToLocal bool `yaml:"fallback_to_local" default:"true"`
+		// LinkExistingAccounts decides whether an existing password account with the
+		// same email is linked to the directory entry or the login is rejected.
+		LinkExistingAccounts bool `yaml:"link_existing_accounts" default:"false"`
+	} `yaml:"ldap"`
+	Captcha struct {
+		Enabled bool `yaml:"enabled" default:"false"`
+		// Provider is either "hcaptcha" or "recaptcha".
+		Provider string `yaml:"provider" default:"hcaptcha"`
+		Secret   string `yaml:"secret"`
+		// VerifyURL overrides the verification endpoint of the provider.
+		VerifyURL string `yaml:"verify_url"`
+		// FailureThreshold is the number of failed logins from an IP address
+		// within FailureWindow after which a captcha is required.
+		FailureThreshold int64         `yaml:"failure_threshold" default:"3"`
+		FailureWindow    time.Duration `yaml:"failure_window" default:"15m"`
+	} `yaml:"captcha"`
+	SignedURL struct {
+		// Lifetime is the time a shared link to a file stays valid.
+		Lifetime time.Duration `yaml:"lifetime" default:"24h"`
+	} `yaml:"signed_url"`
 	TotalRequestsPerMinute int64 `yaml:"total_requests_per_minute"`
 }
 
@@ -93,6 +160,22 @@ type PathsConfiguration struct {
 	Uploads        string `yaml:"uploads"`
 	Common         string `yaml:"common"`
 	GeneratedFiles string `yaml:"generated_files"`
+	// CourseUploads maps the id of a course to a directory used instead of
+	// Uploads for the sheets, tasks, materials and submissions of this course.
+	CourseUploads map[int64]string `yaml:"course_uploads"`
+}
+
+// CORSConfiguration lists the origins allowed for cross-origin requests.
+// Routes whose path starts with one of the given prefixes use their own
+// origins instead, the longest matching prefix wins.
+type CORSConfiguration struct {
+	AllowedOrigins []string                 `yaml:"allowed_origins"`
+	Routes         []CORSRouteConfiguration `yaml:"routes"`
+}
+
+type CORSRouteConfiguration struct {
+	Prefix         string   `yaml:"prefix"`
+	AllowedOrigins []string `yaml:"allowed_origins"`
 }
 
 type ServerConfigurationSchema struct {
@@ -103,7 +186,16 @@ type ServerConfigurationSchema struct {
 		LoginIsRoot bool   `yaml:"login_is_root"`
 		LogLevel    string `yaml:"log_level"`
 		Fixtures    string `yaml:"fixtures"`
+		BodyLog     struct {
+			Enabled      bool             `yaml:"enabled"`
+			RedactFields []string         `yaml:"redact_fields"`
+			MaxBodySize  bytefmt.ByteSize `yaml:"max_body_size"`
+		} `yaml:"body_log"`
 	} `yaml:"debugging"`
+	Logging struct {
+		Format string   `yaml:"format" default:"text"`
+		Fields []string `yaml:"fields"`
+	} `yaml:"logging"`
 	HTTP struct {
 		UseHTTPS bool   `yaml:"use_https"  default:"false"`
 		Port     int    `yaml:"port"  default:"2020"`
@@ -115,20 +207,77 @@ type ServerConfigurationSchema struct {
 		Limits struct {
 			MaxHeader      bytefmt.ByteSize `yaml:"max_header"`
 			MaxRequestJSON bytefmt.ByteSize `yaml:"max_request_json"`
+			MinAvatar      bytefmt.ByteSize `yaml:"min_avatar"`
 			MaxAvatar      bytefmt.ByteSize `yaml:"max_avatar"`
 			MaxSubmission  bytefmt.ByteSize `yaml:"max_submission"`
+			// MaxInFlight limits the number of concurrently served requests, 0 disables the limit
+			MaxInFlight int `yaml:"max_in_flight"`
 		} `yaml:"limits"`
+		CORS CORSConfiguration `yaml:"cors"`
+		// StrictJSON rejects requests containing fields unknown to the endpoint
+		StrictJSON bool `yaml:"strict_json"`
+		// FileETags enables conditional downloads of sheet and test files
+		FileETags bool `yaml:"file_etags" default:"true"`
+		// Envelope wraps successful responses in {"data": ..., "meta": ...},
+		// clients can override this per request with the "X-Envelope" header
+		Envelope bool `yaml:"envelope"`
+		// TrustedProxies lists the addresses (IPs or CIDRs) of reverse proxies
+		// whose "X-Forwarded-For" header determines the address of the client
+		TrustedProxies []string `yaml:"trusted_proxies"`
 	} `yaml:"http"`
-	DistributeJobs bool                        `yaml:"distribute_jobs"`
-	Authentication AuthenticationConfiguration `yaml:"authentication"`
-	Cronjobs       struct {
-		ZipSubmissionsIntervall time.Duration `yaml:"zip_submissions_intervall"`
+	DistributeJobs    bool `yaml:"distribute_jobs"`
+	MaxConcurrentJobs int  `yaml:"max_concurrent_jobs"`
+	// JobLeaseTimeout frees the slot of a grading job if its result did not
+	// arrive in time. Zero keeps the slot until the result arrives.
+	JobLeaseTimeout time.Duration `yaml:"job_lease_timeout" default:"15m"`
+	// UniqueActiveSubmissions serializes the uploads of a student for a task and
+	// discards results of gradings superseded by a newer upload
+	UniqueActiveSubmissions bool                        `yaml:"unique_active_submissions" default:"true"`
+	DefaultLanguage         string                      `yaml:"default_language" default:"en"`
+	Authentication          AuthenticationConfiguration `yaml:"authentication"`
+	Cronjobs                struct {
+		ZipSubmissionsIntervall     time.Duration `yaml:"zip_submissions_intervall"`
+		PurgeSubmissionsIntervall   time.Duration `yaml:"purge_submissions_intervall"`
+		SendDigestsIntervall        time.Duration `yaml:"send_digests_intervall"`
+		ExpireEmailChangesIntervall time.Duration `yaml:"expire_email_changes_intervall"`
+		PurgeChunksIntervall        time.Duration `yaml:"purge_chunks_intervall"`
 	} `yaml:"cronjobs"`
+	SubmissionRetention struct {
+		Days       int  `yaml:"days"`
+		KeepGraded bool `yaml:"keep_graded"`
+	} `yaml:"submission_retention"`
+	// LoginHistory keeps the logins of each user for the given number of days
+	// to show them in the activity of the account. Zero disables it.
+	LoginHistory struct {
+		Days int `yaml:"days"`
+	} `yaml:"login_history"`
+	SubmissionCleanup struct {
+		Enabled bool `yaml:"enabled" default:"true"`
+		// Entries having a path element matching one of these patterns are removed
+		JunkPatterns []string `yaml:"junk_patterns" default:"[\"__MACOSX\", \".DS_Store\", \"Thumbs.db\", \"._*\"]"`
+	} `yaml:"submission_cleanup"`
+	// ChunkedUploads discards the staged chunks of uploads which have not been
+	// continued within the expiry.
+	ChunkedUploads struct {
+		Expiry time.Duration `yaml:"expiry" default:"24h"`
+	} `yaml:"chunked_uploads"`
+	Registration struct {
+		// Open allows everyone to create an account
+		Open        bool `yaml:"open" default:"true"`
+		MaxSemester int  `yaml:"max_semester" default:"30"`
+		// Subjects users can choose from, any subject is accepted if empty
+		Subjects []string `yaml:"subjects"`
+		// AutoEnrollCourses are the ids of the courses new users are enrolled
+		// into as students once their account is confirmed.
+		AutoEnrollCourses []int64 `yaml:"auto_enroll_courses"`
+	} `yaml:"registration"`
 	Email struct {
 		Send           bool   `yaml:"send"`
 		SendmailBinary string `yaml:"sendmail_binary"`
 		From           string `yaml:"from"`
-		ChannelSize    int    `yaml:"channel_size"`
+		// SubjectPrefix is prepended to the subject of all outgoing emails (optional)
+		SubjectPrefix string `yaml:"subject_prefix"`
+		ChannelSize   int    `yaml:"channel_size"`
 	} `yaml:"email"`
 	Services struct {
 		Redis struct {
@@ -184,6 +333,22 @@ func (config *ServerConfigurationSchema) CronjobsZipSubmissionsIntervall() strin
 	return fmt.Sprintf("@every %s", secs)
 }
 
+func (config *ServerConfigurationSchema) CronjobsPurgeSubmissionsIntervall() string {
+	return fmt.Sprintf("@every %s", config.Cronjobs.PurgeSubmissionsIntervall)
+}
+
+func (config *ServerConfigurationSchema) CronjobsSendDigestsIntervall() string {
+	return fmt.Sprintf("@every %s", config.Cronjobs.SendDigestsIntervall)
+}
+
+func (config *ServerConfigurationSchema) CronjobsExpireEmailChangesIntervall() string {
+	return fmt.Sprintf("@every %s", config.Cronjobs.ExpireEmailChangesIntervall)
+}
+
+func (config *ServerConfigurationSchema) CronjobsPurgeChunksIntervall() string {
+	return fmt.Sprintf("@every %s", config.Cronjobs.PurgeChunksIntervall)
+}
+
 type WorkerConfigurationSchema struct {
 	Version  int `json:"version"`
 	Services struct {
@@ -0,0 +1,87 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package database
+
+import (
+	"github.com/infomark-org/infomark/model"
+	"github.com/jmoiron/sqlx"
+)
+
+// APIKeyStore is the store for personal api keys.
+type APIKeyStore struct {
+	db *sqlx.DB
+}
+
+// NewAPIKeyStore creates a new api key store.
+func NewAPIKeyStore(db *sqlx.DB) *APIKeyStore {
+	return &APIKeyStore{
+		db: db,
+	}
+}
+
+// Get returns an api key for a given id.
+func (s *APIKeyStore) Get(apiKeyID int64) (*model.APIKey, error) {
+	p := model.APIKey{ID: apiKeyID}
+	err := s.db.Get(&p, "SELECT * FROM api_keys WHERE id = $1 LIMIT 1;", p.ID)
+	return &p, err
+}
+
+// FindByHash returns the api key matching the hash of a key unless it has been
+// revoked.
+func (s *APIKeyStore) FindByHash(keyHash string) (*model.APIKey, error) {
+	p := model.APIKey{}
+	err := s.db.Get(&p, "SELECT * FROM api_keys WHERE key_hash = $1 AND revoked_at IS NULL LIMIT 1;", keyHash)
+	return &p, err
+}
+
+// APIKeysOfUser returns all api keys of a user.
+func (s *APIKeyStore) APIKeysOfUser(userID int64) ([]model.APIKey, error) {
+	p := []model.APIKey{}
+	err := s.db.Select(&p, "SELECT * FROM api_keys WHERE user_id = $1 ORDER BY id ASC;", userID)
+	return p, err
+}
+
+// Create stores a new api key.
+func (s *APIKeyStore) Create(p *model.APIKey) (*model.APIKey, error) {
+	newID, err := Insert(s.db, "api_keys", p)
+	if err != nil {
+		return nil, err
+	}
+	return s.Get(newID)
+}
+
+// Revoke marks an api key as revoked such that it cannot be used anymore.
+func (s *APIKeyStore) Revoke(apiKeyID int64) error {
+	_, err := s.db.Exec(`
+UPDATE
+  api_keys
+SET
+  revoked_at = NOW(),
+  updated_at = NOW()
+WHERE
+  id = $1
+AND
+  revoked_at IS NULL`, apiKeyID)
+	return err
+}
+
+// Delete removes an api key.
+func (s *APIKeyStore) Delete(apiKeyID int64) error {
+	return Delete(s.db, "api_keys", apiKeyID)
+}
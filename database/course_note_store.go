@@ -0,0 +1,68 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package database
+
+import (
+	"github.com/infomark-org/infomark/model"
+	"github.com/jmoiron/sqlx"
+)
+
+// CourseNoteStore is the store for pinned notes of courses.
+type CourseNoteStore struct {
+	db *sqlx.DB
+}
+
+// NewCourseNoteStore creates a new course note store.
+func NewCourseNoteStore(db *sqlx.DB) *CourseNoteStore {
+	return &CourseNoteStore{
+		db: db,
+	}
+}
+
+// Get returns a course note for a given id.
+func (s *CourseNoteStore) Get(noteID int64) (*model.CourseNote, error) {
+	p := model.CourseNote{ID: noteID}
+	err := s.db.Get(&p, "SELECT * FROM course_notes WHERE id = $1 LIMIT 1;", p.ID)
+	return &p, err
+}
+
+// NotesOfCourse returns all notes of a course in their display order.
+func (s *CourseNoteStore) NotesOfCourse(courseID int64) ([]model.CourseNote, error) {
+	p := []model.CourseNote{}
+	err := s.db.Select(&p, "SELECT * FROM course_notes WHERE course_id = $1 ORDER BY ordering ASC, id ASC;", courseID)
+	return p, err
+}
+
+// Create stores a new course note.
+func (s *CourseNoteStore) Create(p *model.CourseNote) (*model.CourseNote, error) {
+	newID, err := Insert(s.db, "course_notes", p)
+	if err != nil {
+		return nil, err
+	}
+	return s.Get(newID)
+}
+
+// Update updates a course note.
+func (s *CourseNoteStore) Update(p *model.CourseNote) error {
+	return Update(s.db, "course_notes", p.ID, p)
+}
+
+// Delete removes a course note.
+func (s *CourseNoteStore) Delete(noteID int64) error {
+	return Delete(s.db, "course_notes", noteID)
+}
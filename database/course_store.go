@@ -20,8 +20,11 @@
 package database
 
 import (
+	"time"
+
 	"github.com/infomark-org/infomark/auth/authorize"
 	"github.com/infomark-org/infomark/model"
+	"github.com/infomark-org/infomark/symbol"
 	"github.com/jmoiron/sqlx"
 	"github.com/lib/pq"
 )
@@ -30,6 +33,15 @@ type CourseStore struct {
 	db *sqlx.DB
 }
 
+// courseSemesterFilter restricts a query to the courses "c" beginning in the
+// semester $2 ("summer", "winter" or "" for any) of the year $3 (0 for any).
+// Summer semesters begin between April and September. Winter semesters belong
+// to the year in which they begin.
+const courseSemesterFilter = `
+  ($2 = '' OR $2 = CASE WHEN EXTRACT(MONTH FROM c.begins_at) BETWEEN 4 AND 9 THEN 'summer' ELSE 'winter' END)
+AND
+  ($3 = 0 OR $3 = CAST(EXTRACT(YEAR FROM c.begins_at - INTERVAL '3 months') AS INTEGER))`
+
 func NewCourseStore(db *sqlx.DB) *CourseStore {
 	return &CourseStore{
 		db: db,
@@ -44,7 +56,56 @@ func (s *CourseStore) Get(courseID int64) (*model.Course, error) {
 
 func (s *CourseStore) GetAll() ([]model.Course, error) {
 	p := []model.Course{}
-	err := s.db.Select(&p, "SELECT * FROM courses;")
+	err := s.db.Select(&p, "SELECT * FROM courses ORDER BY id ASC;")
+	return p, err
+}
+
+// CoursesOfUserWithRole returns all courses in which a user is enrolled with
+// the given role.
+func (s *CourseStore) CoursesOfUserWithRole(userID int64, role int) ([]model.Course, error) {
+	p := []model.Course{}
+	err := s.db.Select(&p, `
+SELECT
+  c.*
+FROM
+  courses c
+INNER JOIN user_course uc ON uc.course_id = c.id
+WHERE
+  uc.user_id = $1
+AND
+  uc.role = $2
+ORDER BY
+  c.id ASC
+`, userID, role)
+	return p, err
+}
+
+// AvailableForUser returns all courses a user is not enrolled in and can enroll
+// in at the given time, i.e. the enrollment is open and the course is not full.
+func (s *CourseStore) AvailableForUser(userID int64, now time.Time) ([]model.Course, error) {
+	p := []model.Course{}
+	err := s.db.Select(&p, `
+SELECT
+  c.*
+FROM
+  courses c
+WHERE
+  (c.enrollment_begins_at IS NULL OR c.enrollment_begins_at <= $2)
+AND
+  (c.enrollment_ends_at IS NULL OR c.enrollment_ends_at > $2)
+AND
+  NOT EXISTS (
+    SELECT 1 FROM user_course uc WHERE uc.course_id = c.id AND uc.user_id = $1
+  )
+AND
+  (
+    c.max_students = 0
+  OR
+    (SELECT count(*) FROM user_course uc WHERE uc.course_id = c.id AND uc.role = 0) < c.max_students
+  )
+ORDER BY
+  c.begins_at ASC, c.id ASC
+`, userID, now)
 	return p, err
 }
 
@@ -116,6 +177,50 @@ VALUES (DEFAULT, $1, $2, $3);
 	return err
 }
 
+// EnrollStudent enrolls a user as a student if the course has not reached
+// maxStudents (0 means no limit). The course is locked while counting, such
+// that concurrent enrollments cannot exceed the limit. It returns false if the
+// course is full.
+func (s *CourseStore) EnrollStudent(courseID int64, userID int64, maxStudents int) (bool, error) {
+	tx, err := s.db.Beginx()
+	if err != nil {
+		return false, err
+	}
+
+	if _, err := tx.Exec(`SELECT id FROM courses WHERE id = $1 FOR UPDATE`, courseID); err != nil {
+		tx.Rollback()
+		return false, err
+	}
+
+	if _, err := tx.Exec(`DELETE FROM user_course WHERE user_id = $1 AND course_id = $2`, userID, courseID); err != nil {
+		tx.Rollback()
+		return false, err
+	}
+
+	if maxStudents > 0 {
+		students := 0
+		if err := tx.Get(&students, `SELECT count(*) FROM user_course WHERE course_id = $1 AND role = 0`, courseID); err != nil {
+			tx.Rollback()
+			return false, err
+		}
+		if students >= maxStudents {
+			tx.Rollback()
+			return false, nil
+		}
+	}
+
+	if _, err := tx.Exec(`
+INSERT INTO
+  user_course (id, user_id, course_id, role)
+VALUES (DEFAULT, $1, $2, 0);
+`, userID, courseID); err != nil {
+		tx.Rollback()
+		return false, err
+	}
+
+	return true, tx.Commit()
+}
+
 func (s *CourseStore) Disenroll(courseID int64, userID int64) error {
 	_, err := s.db.Exec(`
 DELETE FROM
@@ -127,6 +232,21 @@ AND
 	return err
 }
 
+// AcknowledgeHonorCode records when a user accepted the honor code of a
+// course. Repeated acknowledgements keep the first timestamp.
+func (s *CourseStore) AcknowledgeHonorCode(courseID int64, userID int64) error {
+	_, err := s.db.Exec(`
+UPDATE
+  user_course
+SET
+  honor_code_acknowledged_at = COALESCE(honor_code_acknowledged_at, now())
+WHERE
+  user_id = $1
+AND
+  course_id = $2`, userID, courseID)
+	return err
+}
+
 func (s *CourseStore) GetUserEnrollment(courseID int64, userID int64) (*model.UserCourse, error) {
 	p := model.UserCourse{}
 
@@ -134,6 +254,7 @@ func (s *CourseStore) GetUserEnrollment(courseID int64, userID int64) (*model.Us
 	err := s.db.Get(&p, `
 SELECT
   uc.role,
+  uc.honor_code_acknowledged_at,
   u.id,
   u.first_name,
   u.last_name,
@@ -180,6 +301,8 @@ WHERE
   uc.course_id = $1
 AND
   uc.role = ANY($2)
+AND
+  u.deleted_at IS NULL
 AND
 (
   LOWER(u.first_name) LIKE $3
@@ -187,7 +310,9 @@ OR
   LOWER(u.last_name) LIKE $3
 OR
   LOWER(u.email) LIKE $3
-)`, courseID, pq.Array(roleFilter),
+)
+ORDER BY
+  u.last_name ASC, u.first_name ASC, u.id ASC`, courseID, pq.Array(roleFilter),
 		filterQuery,
 	)
 	return p, err
@@ -215,7 +340,8 @@ SELECT
   u.semester,
   u.subject,
   u.language,
-  u.avatar_url
+  u.avatar_url,
+  uc.created_at AS enrolled_at
 FROM
   user_course uc
 INNER JOIN users u ON uc.user_id = u.id
@@ -223,6 +349,8 @@ WHERE
   uc.course_id = $1
 AND
   uc.role = ANY($2)
+AND
+  u.deleted_at IS NULL
 AND
   LOWER(u.first_name) LIKE $3
 AND
@@ -232,7 +360,9 @@ AND
 AND
   LOWER(u.subject) LIKE $6
 AND
-  LOWER(u.language) LIKE $7`, courseID, pq.Array(roleFilter),
+  LOWER(u.language) LIKE $7
+ORDER BY
+  u.last_name ASC, u.first_name ASC, u.id ASC`, courseID, pq.Array(roleFilter),
 		filterFirstName, filterLastName, filterEmail,
 		filterSubject, filterLanguage,
 	)
@@ -245,14 +375,19 @@ func (s *CourseStore) PointsForUser(userID int64, courseID int64) ([]model.Sheet
 
 	err := s.db.Select(&p, `
 SELECT
-  SUM(g.acquired_points) acquired_points,
+  SUM(CASE
+    WHEN COALESCE(t.scoring_policy, sh.scoring_policy) = $3 THEN g.best_points
+    ELSE g.acquired_points
+  END) acquired_points,
   SUM(t.max_points) max_points,
-  ts.sheet_id sheet_id
+  ts.sheet_id sheet_id,
+  BOOL_AND(sh.grades_published) grades_published
 FROM
   grades g
 INNER JOIN submissions sub ON g.submission_id = sub.id
 INNER JOIN tasks t ON sub.task_id = t.id
 INNER JOIN task_sheet ts ON ts.task_id = t.id
+INNER JOIN sheets sh ON sh.id = ts.sheet_id
 INNER JOIN sheet_course sc ON sc.sheet_id = ts.sheet_id
 INNER JOIN courses c ON c.id = sc.course_id
 WHERE
@@ -262,7 +397,7 @@ AND
 GROUP BY
   ts.sheet_id
 ORDER BY
-  ts.sheet_id`, userID, courseID,
+  ts.sheet_id`, userID, courseID, symbol.ScoringPolicyBest,
 	)
 	return p, err
 
@@ -299,3 +434,55 @@ AND
 	}
 
 }
+
+// submissionsOfCourse lists all submissions for tasks of the course $1
+// together with their grades.
+const submissionsOfCourse = `
+WITH course_submissions AS (
+  SELECT
+    s.created_at,
+    g.acquired_points,
+    g.feedback
+  FROM
+    submissions s
+  INNER JOIN task_sheet ts ON ts.task_id = s.task_id
+  INNER JOIN sheet_course sc ON sc.sheet_id = ts.sheet_id
+  LEFT JOIN grades g ON g.submission_id = s.id
+  WHERE
+    sc.course_id = $1
+)`
+
+// GetDashboard counts the enrollments by role and the submissions of a course.
+// Submissions without feedback and points are ungraded, the average is taken
+// over all graded submissions.
+func (s *CourseStore) GetDashboard(courseID int64) (*model.CourseDashboard, error) {
+	p := model.CourseDashboard{}
+	err := s.db.Get(&p, submissionsOfCourse+`
+SELECT
+  (SELECT COUNT(*) FROM user_course WHERE course_id = $1 AND role = 0) students,
+  (SELECT COUNT(*) FROM user_course WHERE course_id = $1 AND role = 1) tutors,
+  (SELECT COUNT(*) FROM user_course WHERE course_id = $1 AND role = 2) admins,
+  COUNT(*) submissions,
+  COUNT(*) FILTER (WHERE COALESCE(feedback, '') = '' AND COALESCE(acquired_points, 0) = 0) ungraded,
+  COALESCE(AVG(acquired_points) FILTER (WHERE feedback <> '' OR acquired_points > 0), 0)::float average_points
+FROM
+  course_submissions;`, courseID)
+	return &p, err
+}
+
+// GetSubmissionVolume counts the submissions of a course per day, the
+// earliest day first. Days without submissions are omitted.
+func (s *CourseStore) GetSubmissionVolume(courseID int64) ([]model.SubmissionVolume, error) {
+	p := []model.SubmissionVolume{}
+	err := s.db.Select(&p, submissionsOfCourse+`
+SELECT
+  date_trunc('day', created_at) AS day,
+  COUNT(*) count
+FROM
+  course_submissions
+GROUP BY
+  day
+ORDER BY
+  day ASC;`, courseID)
+	return p, err
+}
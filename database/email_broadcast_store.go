@@ -0,0 +1,143 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package database
+
+import (
+	"github.com/infomark-org/infomark/model"
+	"github.com/infomark-org/infomark/symbol"
+	"github.com/jmoiron/sqlx"
+)
+
+// EmailBroadcastStore is the store for emails sent to courses.
+type EmailBroadcastStore struct {
+	db *sqlx.DB
+}
+
+// NewEmailBroadcastStore creates a new email broadcast store.
+func NewEmailBroadcastStore(db *sqlx.DB) *EmailBroadcastStore {
+	return &EmailBroadcastStore{
+		db: db,
+	}
+}
+
+// Get returns a broadcast for a given id.
+func (s *EmailBroadcastStore) Get(broadcastID int64) (*model.EmailBroadcast, error) {
+	p := model.EmailBroadcast{ID: broadcastID}
+	err := s.db.Get(&p, "SELECT * FROM email_broadcasts WHERE id = $1 LIMIT 1;", p.ID)
+	return &p, err
+}
+
+// Create stores a new broadcast.
+func (s *EmailBroadcastStore) Create(p *model.EmailBroadcast) (*model.EmailBroadcast, error) {
+	newID, err := Insert(s.db, "email_broadcasts", p)
+	if err != nil {
+		return nil, err
+	}
+	return s.Get(newID)
+}
+
+// CreateDelivery stores a new queued delivery of a broadcast.
+func (s *EmailBroadcastStore) CreateDelivery(p *model.EmailDelivery) (*model.EmailDelivery, error) {
+	newID, err := Insert(s.db, "email_deliveries", p)
+	if err != nil {
+		return nil, err
+	}
+	p.ID = newID
+	return p, nil
+}
+
+// UpdateDeliveryState records the outcome of a delivery.
+func (s *EmailBroadcastStore) UpdateDeliveryState(deliveryID int64, state symbol.EmailDeliveryState, message string) error {
+	_, err := s.db.Exec(`
+UPDATE
+  email_deliveries
+SET
+  state = $2,
+  error = $3,
+  updated_at = now()
+WHERE
+  id = $1
+`, deliveryID, state, message)
+	return err
+}
+
+// GetStatus counts the deliveries of a broadcast by their state.
+func (s *EmailBroadcastStore) GetStatus(broadcastID int64) (*model.EmailBroadcastStatus, error) {
+	p := model.EmailBroadcastStatus{}
+	err := s.db.Get(&p, `
+SELECT
+  COUNT(*) FILTER (WHERE state = $2) queued,
+  COUNT(*) FILTER (WHERE state = $3) sent,
+  COUNT(*) FILTER (WHERE state = $4) failed
+FROM
+  email_deliveries
+WHERE
+  broadcast_id = $1
+`, broadcastID, symbol.EmailDeliveryQueued, symbol.EmailDeliverySent, symbol.EmailDeliveryFailed)
+	return &p, err
+}
+
+// FailedDeliveries returns all deliveries of a broadcast which could not be
+// sent.
+func (s *EmailBroadcastStore) FailedDeliveries(broadcastID int64) ([]model.EmailDelivery, error) {
+	p := []model.EmailDelivery{}
+	err := s.db.Select(&p, "SELECT * FROM email_deliveries WHERE broadcast_id = $1 AND state = $2 ORDER BY id ASC;",
+		broadcastID, symbol.EmailDeliveryFailed)
+	return p, err
+}
+
+// CreateLogEntry stores a new queued email in the email log of a user.
+func (s *EmailBroadcastStore) CreateLogEntry(p *model.EmailLogEntry) (*model.EmailLogEntry, error) {
+	newID, err := Insert(s.db, "email_logs", p)
+	if err != nil {
+		return nil, err
+	}
+	p.ID = newID
+	return p, nil
+}
+
+// UpdateLogEntryState records the outcome of sending a logged email.
+func (s *EmailBroadcastStore) UpdateLogEntryState(entryID int64, state symbol.EmailDeliveryState) error {
+	_, err := s.db.Exec(`
+UPDATE
+  email_logs
+SET
+  state = $2,
+  updated_at = now()
+WHERE
+  id = $1
+`, entryID, state)
+	return err
+}
+
+// GetLogOfUser returns the latest emails sent to a user, newest first.
+func (s *EmailBroadcastStore) GetLogOfUser(userID int64, limit int) ([]model.EmailLogEntry, error) {
+	p := []model.EmailLogEntry{}
+	err := s.db.Select(&p, `
+SELECT
+  *
+FROM
+  email_logs
+WHERE
+  user_id = $1
+ORDER BY
+  created_at DESC, id DESC
+LIMIT $2
+`, userID, limit)
+	return p, err
+}
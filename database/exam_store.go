@@ -106,11 +106,59 @@ FROM
   user_exam ue
 INNER JOIN exams e ON ue.exam_id = e.id
 WHERE
-  ue.user_id = $1`, userID,
+  ue.user_id = $1
+ORDER BY
+  ue.id ASC`, userID,
+	)
+	return p, err
+}
+
+// GetEnrollmentsOfUserPage returns at most "limit" (0 for all) exam
+// enrollments of a user starting at "offset", restricted to exams of courses
+// of the given semester and year.
+func (s *ExamStore) GetEnrollmentsOfUserPage(userID int64, semester string, year int, limit int, offset int) ([]model.UserExam, error) {
+	p := []model.UserExam{}
+
+	err := s.db.Select(&p, `
+SELECT
+  ue.status,
+  ue.mark,
+  ue.user_id,
+  ue.exam_id,
+  e.course_id,
+  ue.id
+FROM
+  user_exam ue
+INNER JOIN exams e ON ue.exam_id = e.id
+INNER JOIN courses c ON c.id = e.course_id
+WHERE
+  ue.user_id = $1
+AND`+courseSemesterFilter+`
+ORDER BY
+  ue.id ASC
+LIMIT NULLIF($4, 0)
+OFFSET $5`, userID, semester, year, limit, offset,
 	)
 	return p, err
 }
 
+// CountEnrollmentsOfUser returns the number of exam enrollments of a user in
+// exams of courses of the given semester and year.
+func (s *ExamStore) CountEnrollmentsOfUser(userID int64, semester string, year int) (int, error) {
+	var total int
+	err := s.db.Get(&total, `
+SELECT
+  COUNT(*)
+FROM
+  user_exam ue
+INNER JOIN exams e ON ue.exam_id = e.id
+INNER JOIN courses c ON c.id = e.course_id
+WHERE
+  ue.user_id = $1
+AND`+courseSemesterFilter, userID, semester, year)
+	return total, err
+}
+
 func (s *ExamStore) GetEnrollmentOfUser(examID int64, userID int64) (*model.UserExam, error) {
 	p := model.UserExam{}
 
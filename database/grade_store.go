@@ -20,9 +20,12 @@
 package database
 
 import (
+	"time"
+
 	"github.com/infomark-org/infomark/model"
 	"github.com/infomark-org/infomark/symbol"
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 )
 
 type GradeStore struct {
@@ -47,6 +50,7 @@ func (s *GradeStore) Get(id int64) (*model.Grade, error) {
 SELECT
   g.*,
   s.user_id,
+  s.task_id,
   u.last_name user_last_name,
   u.first_name user_first_name,
   u.email user_email
@@ -60,6 +64,33 @@ WHERE
 	return &p, err
 }
 
+// GradedOfSheet returns all grades of submissions to tasks of a sheet which
+// have been graded by a tutor.
+func (s *GradeStore) GradedOfSheet(sheetID int64) ([]model.Grade, error) {
+	p := []model.Grade{}
+	err := s.db.Select(&p, `
+SELECT
+  g.*,
+  s.user_id,
+  s.task_id,
+  u.last_name user_last_name,
+  u.first_name user_first_name,
+  u.email user_email
+FROM
+  grades g
+INNER JOIN submissions s ON g.submission_id = s.id
+INNER JOIN users u ON s.user_id = u.id
+INNER JOIN task_sheet ts ON ts.task_id = s.task_id
+WHERE
+  ts.sheet_id = $1
+AND
+  g.graded_at IS NOT NULL
+ORDER BY
+  g.id ASC
+`, sheetID)
+	return p, err
+}
+
 func (s *GradeStore) Create(p *model.Grade) (*model.Grade, error) {
 	newID, err := Insert(s.db, "grades", p)
 	if err != nil {
@@ -68,39 +99,175 @@ func (s *GradeStore) Create(p *model.Grade) (*model.Grade, error) {
 	return s.Get(newID)
 }
 
-func (s *GradeStore) UpdatePrivateTestInfo(gradeID int64, log string, status symbol.TestingResult) error {
+func (s *GradeStore) UpdatePrivateTestInfo(gradeID int64, log string, status symbol.TestingResult, testedAt time.Time) error {
 	_, err := s.db.Exec(`
 UPDATE grades
 SET
   private_execution_state=$4,
   private_test_log=$2,
-  private_test_status=$3
+  private_test_status=$3,
+  tested_at=$5
 WHERE
   id = $1
-    `, gradeID, log, status, symbol.TestingStateFinished)
+    `, gradeID, log, status, symbol.TestingStateFinished, testedAt)
 	return err
 }
 
-func (s *GradeStore) UpdatePublicTestInfo(gradeID int64, log string, status symbol.TestingResult) error {
+func (s *GradeStore) UpdatePublicTestInfo(gradeID int64, log string, diff string, status symbol.TestingResult, testedAt time.Time) error {
 	_, err := s.db.Exec(`
 UPDATE grades
 SET
   public_execution_state=$4,
   public_test_log=$2,
-  public_test_status=$3
+  public_test_diff=$5,
+  public_test_status=$3,
+  tested_at=$6
 WHERE
   id = $1
-    `, gradeID, log, status, symbol.TestingStateFinished)
+    `, gradeID, log, status, symbol.TestingStateFinished, diff, testedAt)
 	return err
 }
 
+// UpdateAutograderPoints sets the points a background worker has awarded and
+// records them. The best points are the highest recorded ones. Grades of a
+// tutor are left untouched.
+func (s *GradeStore) UpdateAutograderPoints(gradeID int64, points int) error {
+	tx, err := s.db.Beginx()
+	if err != nil {
+		return err
+	}
+
+	statements := []string{
+		`INSERT INTO grade_results (grade_id, points)
+SELECT id, $2 FROM grades WHERE id = $1 AND graded_at IS NULL`,
+		`UPDATE grades
+SET
+  acquired_points=$2,
+  best_points=(SELECT MAX(points) FROM grade_results WHERE grade_id = $1)
+WHERE
+  id = $1
+AND
+  graded_at IS NULL`,
+	}
+
+	for _, statement := range statements {
+		if _, err := tx.Exec(statement, gradeID, points); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// DiscardAutograderPoints forgets the recorded points of a grade, e.g. because
+// the tests were broken.
+func (s *GradeStore) DiscardAutograderPoints(gradeID int64) error {
+	_, err := s.db.Exec(`DELETE FROM grade_results WHERE grade_id = $1`, gradeID)
+	return err
+}
+
+// ReplaceTestCases stores the test cases of an automated test of a grade and
+// drops those of a previous run.
+func (s *GradeStore) ReplaceTestCases(gradeID int64, kind string, testCases []model.GradeTestCase) error {
+	if _, err := s.db.Exec(`DELETE FROM grade_test_cases WHERE grade_id = $1 AND kind = $2;`, gradeID, kind); err != nil {
+		return err
+	}
+
+	for k := range testCases {
+		testCases[k].GradeID = gradeID
+		testCases[k].Kind = kind
+		if _, err := Insert(s.db, "grade_test_cases", &testCases[k]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// TestCasesOfGrade returns the test cases of an automated test of a grade.
+func (s *GradeStore) TestCasesOfGrade(gradeID int64, kind string) ([]model.GradeTestCase, error) {
+	p := []model.GradeTestCase{}
+	err := s.db.Select(&p, "SELECT * FROM grade_test_cases WHERE grade_id = $1 AND kind = $2 ORDER BY id ASC;",
+		gradeID, kind)
+	return p, err
+}
+
+// GetQueuePosition returns the position of a grade amongst all grades with
+// pending tests ordered by the time they were enqueued (starting at 1).
+// Tests of tasks without a docker image are never executed and are not queued.
+// Grades enqueued before the given time are considered lost and are skipped,
+// their position is 0.
+func (s *GradeStore) GetQueuePosition(gradeID int64, enqueuedSince time.Time) (int, error) {
+	var position int
+	err := s.db.Get(&position, `
+SELECT
+  COUNT(*)
+FROM
+  grades g
+INNER JOIN submissions s ON s.id = g.submission_id
+INNER JOIN tasks t ON t.id = s.task_id,
+  grades me
+WHERE
+  me.id = $1
+AND
+  g.enqueued_at IS NOT NULL
+AND
+  g.enqueued_at >= $3
+AND
+  (
+    (g.public_execution_state < $2 AND t.public_docker_image IS NOT NULL)
+    OR
+    (g.private_execution_state < $2 AND t.private_docker_image IS NOT NULL)
+  )
+AND
+  (g.enqueued_at, g.id) <= (COALESCE(me.enqueued_at, me.created_at), me.id)
+    `, gradeID, symbol.TestingStateFinished, enqueuedSince)
+	return position, err
+}
+
+// CountTestedSince returns the number of grades a worker reported tests for
+// since the given time.
+func (s *GradeStore) CountTestedSince(since time.Time) (int, error) {
+	var count int
+	err := s.db.Get(&count, `
+SELECT
+  COUNT(*)
+FROM
+  grades
+WHERE
+  tested_at >= $1
+    `, since)
+	return count, err
+}
+
+// CountTestedOfTaskSince counts the grades of a task which have been tested
+// since a given time.
+func (s *GradeStore) CountTestedOfTaskSince(taskID int64, since time.Time) (int, error) {
+	var count int
+	err := s.db.Get(&count, `
+SELECT
+  COUNT(*)
+FROM
+  grades g
+INNER JOIN submissions s ON g.submission_id = s.id
+WHERE
+  s.task_id = $1
+AND
+  g.tested_at >= $2
+    `, taskID, since)
+	return count, err
+}
+
 func (s *GradeStore) GetForSubmission(id int64) (*model.Grade, error) {
 	p := model.Grade{}
 	err := s.db.Get(&p, "SELECT * FROM grades WHERE submission_id = $1 LIMIT 1;", id)
 	return &p, err
 }
 
-func (s *GradeStore) GetOverviewGrades(courseID int64, groupID int64) ([]model.OverviewGrade, error) {
+// GetOverviewGrades sums up the points of the students per sheet. Unless
+// groupIDs is nil, only the members of these groups are listed, each of them
+// once.
+func (s *GradeStore) GetOverviewGrades(courseID int64, groupIDs []int64) ([]model.OverviewGrade, error) {
 	p := []model.OverviewGrade{}
 	err := s.db.Select(&p, `
 SELECT
@@ -121,24 +288,52 @@ INNER JOIn sheets sh ON ts.sheet_id = sh.id
 INNER JOIN sheet_course sc ON ts.sheet_id = sc.sheet_id
 INNEr JOIN courses c ON sc.course_id = c.id
 INNER JOIN user_course uc ON s.user_id = uc.user_id
-INNER JOIN user_group ug ON  s.user_id = ug.user_id
-INNER JOIN groups gs ON  ug.group_id = gs.id
 INNER JOIN users u ON  s.user_id = u.id
 WHERE
   c.ID = $1
 AND
   uc.role = 0
-AND
-  gs.course_id = $1
 AND
   uc.course_id = $1
 AND
-  ($2 = 0 OR gs.id = $2)
+  EXISTS (
+    SELECT 1 FROM user_group ug
+    INNER JOIN groups gs ON ug.group_id = gs.id
+    WHERE ug.user_id = s.user_id AND gs.course_id = $1
+    AND ($2::bigint[] IS NULL OR gs.id = ANY($2))
+  )
 GROUP BY
   s.user_id, ts.sheet_id, sh.name, u.first_name, u.last_name, u.student_number, u.email
 ORDER BY
   s.user_id
-`, courseID, groupID)
+`, courseID, pq.Array(groupIDs))
+	return p, err
+}
+
+// GetGradeBook returns the points of all students in all tasks of a course.
+func (s *GradeStore) GetGradeBook(courseID int64) ([]model.GradeBookEntry, error) {
+	p := []model.GradeBookEntry{}
+	err := s.db.Select(&p, `
+SELECT
+  sub.user_id,
+  ts.sheet_id,
+  t.id task_id,
+  SUM(CASE
+    WHEN COALESCE(t.scoring_policy, sh.scoring_policy) = $2 THEN g.best_points
+    ELSE g.acquired_points
+  END) points
+FROM
+  grades g
+INNER JOIN submissions sub ON g.submission_id = sub.id
+INNER JOIN tasks t ON sub.task_id = t.id
+INNER JOIN task_sheet ts ON ts.task_id = t.id
+INNER JOIN sheets sh ON sh.id = ts.sheet_id
+INNER JOIN sheet_course sc ON sc.sheet_id = ts.sheet_id
+WHERE
+  sc.course_id = $1
+GROUP BY
+  sub.user_id, ts.sheet_id, t.id
+`, courseID, symbol.ScoringPolicyBest)
 	return p, err
 }
 
@@ -196,7 +391,7 @@ func (s *GradeStore) GetFiltered(
 	err := s.db.Select(&p,
 		`
 SELECT
-  g.*, s.user_id,
+  g.*, s.user_id, s.task_id,
   u.last_name user_last_name,
   u.first_name user_first_name,
   u.email user_email
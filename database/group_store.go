@@ -151,7 +151,8 @@ SELECT
   u.semester,
   u.subject,
   u.language,
-  u.avatar_url
+  u.avatar_url,
+  uc.created_at AS enrolled_at
 FROM
   user_course uc
 INNER JOIN users u ON uc.user_id = u.id
@@ -162,6 +163,8 @@ AND
   ug.group_id = $2
 AND
   uc.role = ANY($3)
+AND
+  u.deleted_at IS NULL
 AND
   LOWER(u.first_name) LIKE $4
 AND
@@ -179,6 +182,45 @@ AND
 	return p, err
 }
 
+// EnrolledUsersOfGroups lists the members of all given groups. Members of
+// several of the groups are listed once.
+func (s *GroupStore) EnrolledUsersOfGroups(
+	courseID int64,
+	groupIDs []int64,
+	roleFilter []string) ([]model.UserCourse, error) {
+	p := []model.UserCourse{}
+
+	err := s.db.Select(&p, `
+SELECT DISTINCT
+  uc.role,
+  u.id,
+  u.first_name,
+  u.last_name,
+  u.email,
+  u.student_number,
+  u.semester,
+  u.subject,
+  u.language,
+  u.avatar_url,
+  uc.created_at AS enrolled_at
+FROM
+  user_course uc
+INNER JOIN users u ON uc.user_id = u.id
+INNER JOIN user_group ug ON ug.user_id = u.id
+WHERE
+  uc.course_id = $1
+AND
+  ug.group_id = ANY($2)
+AND
+  uc.role = ANY($3)
+AND
+  u.deleted_at IS NULL
+ORDER BY
+  u.last_name ASC, u.first_name ASC, u.id ASC`, courseID, pq.Array(groupIDs), pq.Array(roleFilter),
+	)
+	return p, err
+}
+
 func (s *GroupStore) GetGroupEnrollmentOfUserInCourse(userID int64, courseID int64) (*model.GroupEnrollment, error) {
 	p := &model.GroupEnrollment{}
 	err := s.db.Get(p, `
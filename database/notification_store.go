@@ -0,0 +1,72 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package database
+
+import (
+	"github.com/infomark-org/infomark/model"
+	"github.com/jmoiron/sqlx"
+)
+
+// NotificationStore is the store for notifications waiting for the next digest.
+type NotificationStore struct {
+	db *sqlx.DB
+}
+
+// NewNotificationStore creates a new notification store.
+func NewNotificationStore(db *sqlx.DB) *NotificationStore {
+	return &NotificationStore{
+		db: db,
+	}
+}
+
+// Get returns a pending notification for a given id.
+func (s *NotificationStore) Get(notificationID int64) (*model.PendingNotification, error) {
+	p := model.PendingNotification{ID: notificationID}
+	err := s.db.Get(&p, "SELECT * FROM pending_notifications WHERE id = $1 LIMIT 1;", p.ID)
+	return &p, err
+}
+
+// Create stores a notification for the next digest.
+func (s *NotificationStore) Create(p *model.PendingNotification) (*model.PendingNotification, error) {
+	newID, err := Insert(s.db, "pending_notifications", p)
+	if err != nil {
+		return nil, err
+	}
+	return s.Get(newID)
+}
+
+// UsersWithPending returns the ids of all users with pending notifications.
+func (s *NotificationStore) UsersWithPending() ([]int64, error) {
+	p := []int64{}
+	err := s.db.Select(&p, "SELECT DISTINCT user_id FROM pending_notifications ORDER BY user_id ASC;")
+	return p, err
+}
+
+// PendingOfUser returns all pending notifications of a user in the order
+// they were created.
+func (s *NotificationStore) PendingOfUser(userID int64) ([]model.PendingNotification, error) {
+	p := []model.PendingNotification{}
+	err := s.db.Select(&p, "SELECT * FROM pending_notifications WHERE user_id = $1 ORDER BY id ASC;", userID)
+	return p, err
+}
+
+// Delete removes a pending notification.
+func (s *NotificationStore) Delete(notificationID int64) error {
+	return Delete(s.db, "pending_notifications", notificationID)
+}
@@ -20,8 +20,12 @@
 package database
 
 import (
+	"time"
+
 	"github.com/infomark-org/infomark/model"
+	"github.com/infomark-org/infomark/symbol"
 	"github.com/jmoiron/sqlx"
+	null "gopkg.in/guregu/null.v3"
 )
 
 type SheetStore struct {
@@ -81,7 +85,7 @@ func (s *SheetStore) SheetsOfCourse(courseID int64) ([]model.Sheet, error) {
 
 	err := s.db.Select(&p, `
 SELECT
-  s.id, s.created_at, s.updated_at, s.name, s.publish_at, s.due_at
+  s.id, s.created_at, s.updated_at, s.name, s.publish_at, s.due_at, s.grades_published
 FROM
   sheet_course sc
 INNER JOIN
@@ -122,20 +126,84 @@ func (s *SheetStore) PointsForUser(userID int64, sheetID int64) ([]model.TaskPoi
 	err := s.db.Select(&p, `
 SELECT
   t.id task_id,
-  g.acquired_points,
+  CASE
+    WHEN COALESCE(t.scoring_policy, sh.scoring_policy) = $3 THEN g.best_points
+    ELSE g.acquired_points
+  END acquired_points,
   t.max_points
 FROM
   grades g
 INNER JOIN submissions sub ON g.submission_id = sub.id
 INNER JOIN tasks t ON sub.task_id = t.id
 INNER JOIN task_sheet ts ON ts.task_id = t.id
+INNER JOIN sheets sh ON sh.id = ts.sheet_id
 WHERE
   sub.user_id = $1
 AND
   ts.sheet_id = $2
 ORDER BY
-  ts.sheet_id`, userID, sheetID,
+  ts.sheet_id`, userID, sheetID, symbol.ScoringPolicyBest,
 	)
 	return p, err
 
 }
+
+// DeadlinesOfUser returns the due dates of all published sheets after from
+// (and before to, if given) in the courses the user is enrolled in, the
+// earliest first.
+func (s *SheetStore) DeadlinesOfUser(userID int64, from time.Time, to null.Time) ([]model.Deadline, error) {
+	p := []model.Deadline{}
+
+	err := s.db.Select(&p, `
+SELECT
+  c.id course_id,
+  c.name course_name,
+  s.id sheet_id,
+  s.name sheet_name,
+  s.due_at
+FROM
+  user_course uc
+INNER JOIN courses c ON c.id = uc.course_id
+INNER JOIN sheet_course sc ON sc.course_id = c.id
+INNER JOIN sheets s ON s.id = sc.sheet_id
+WHERE
+  uc.user_id = $1
+AND
+  s.publish_at <= NOW()
+AND
+  s.due_at >= $2
+AND
+  ($3::TIMESTAMP IS NULL OR s.due_at <= $3)
+ORDER BY
+  s.due_at ASC, s.id ASC`, userID, from, to)
+	return p, err
+}
+
+// GetExtension returns the extension of the due date of a sheet for a user.
+func (s *SheetStore) GetExtension(sheetID int64, userID int64) (*model.SheetExtension, error) {
+	p := model.SheetExtension{}
+	err := s.db.Get(&p, "SELECT * FROM sheet_extensions WHERE sheet_id = $1 AND user_id = $2 LIMIT 1;", sheetID, userID)
+	return &p, err
+}
+
+// ExtensionsOfSheet returns all extensions granted for a sheet.
+func (s *SheetStore) ExtensionsOfSheet(sheetID int64) ([]model.SheetExtension, error) {
+	p := []model.SheetExtension{}
+	err := s.db.Select(&p, "SELECT * FROM sheet_extensions WHERE sheet_id = $1 ORDER BY user_id ASC;", sheetID)
+	return p, err
+}
+
+// SetExtension grants an extension or replaces the due date of an existing one.
+func (s *SheetStore) SetExtension(sheetID int64, userID int64, dueAt time.Time) error {
+	_, err := s.db.Exec(`
+INSERT INTO sheet_extensions (sheet_id, user_id, due_at) VALUES ($1, $2, $3)
+ON CONFLICT (sheet_id, user_id) DO UPDATE SET due_at = EXCLUDED.due_at, updated_at = now();`,
+		sheetID, userID, dueAt)
+	return err
+}
+
+// DeleteExtension revokes the extension of a user.
+func (s *SheetStore) DeleteExtension(sheetID int64, userID int64) error {
+	_, err := s.db.Exec("DELETE FROM sheet_extensions WHERE sheet_id = $1 AND user_id = $2;", sheetID, userID)
+	return err
+}
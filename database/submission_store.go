@@ -56,6 +56,68 @@ LIMIT 1;`,
 	return &p, err
 }
 
+// GetAllOfTask returns the submissions of all students of a course for a
+// task ordered by their names.
+func (s *SubmissionStore) GetAllOfTask(courseID int64, taskID int64) ([]model.UserSubmission, error) {
+	p := []model.UserSubmission{}
+	err := s.db.Select(&p, `
+SELECT
+  s.*,
+  u.first_name,
+  u.last_name,
+  u.email,
+  u.student_number
+FROM
+  submissions s
+INNER JOIN users u ON u.id = s.user_id
+INNER JOIN user_course uc ON uc.user_id = s.user_id
+WHERE
+  s.task_id = $2
+AND
+  uc.course_id = $1
+AND
+  uc.role = 0
+ORDER BY
+  u.last_name, u.first_name, u.id;`,
+		courseID, taskID)
+	return p, err
+}
+
+// GetOfTaskWithStatus returns the submissions for a task of all members of a
+// group (of all students if groupID is 0) together with the state of their
+// grading. Submissions with feedback or points are "graded", those with a
+// failed automated test "error" and all others "pending". An empty status
+// returns all submissions.
+func (s *SubmissionStore) GetOfTaskWithStatus(taskID int64, groupID int64, status string) ([]model.SubmissionWithStatus, error) {
+	p := []model.SubmissionWithStatus{}
+	err := s.db.Select(&p, `
+SELECT
+  *
+FROM (
+  SELECT
+    s.*,
+    CASE
+      WHEN g.feedback <> '' OR g.acquired_points > 0 THEN 'graded'
+      WHEN (g.public_execution_state = 2 AND g.public_test_status <> 0)
+        OR (g.private_execution_state = 2 AND g.private_test_status <> 0) THEN 'error'
+      ELSE 'pending'
+    END AS status
+  FROM
+    submissions s
+  LEFT JOIN grades g ON g.submission_id = s.id
+  WHERE
+    s.task_id = $1
+  AND
+    ($2 = 0 OR s.user_id IN (SELECT user_id FROM user_group WHERE group_id = $2))
+) t
+WHERE
+  ($3 = '' OR t.status = $3)
+ORDER BY
+  t.id ASC
+`, taskID, groupID, status)
+	return p, err
+}
+
 func (s *SubmissionStore) Create(p *model.Submission) (*model.Submission, error) {
 	newID, err := Insert(s.db, "submissions", p)
 	if err != nil {
@@ -64,6 +126,76 @@ func (s *SubmissionStore) Create(p *model.Submission) (*model.Submission, error)
 	return s.Get(newID)
 }
 
+// UpdateFilename records the name of the latest uploaded file of a submission.
+func (s *SubmissionStore) UpdateFilename(submissionID int64, filename string) error {
+	_, err := s.db.Exec("UPDATE submissions SET filename = $2 WHERE id = $1;", submissionID, filename)
+	return err
+}
+
+// IdentifyCourseOfSubmission returns the course of the task a submission
+// belongs to.
+func (s *SubmissionStore) IdentifyCourseOfSubmission(submissionID int64) (*model.Course, error) {
+	course := &model.Course{}
+	err := s.db.Get(course, `
+SELECT
+  c.*
+FROM
+  submissions s
+INNER JOIN task_sheet ts ON ts.task_id = s.task_id
+INNER JOIN sheet_course sc ON sc.sheet_id = ts.sheet_id
+INNER JOIN courses c ON c.id = sc.course_id
+WHERE
+  s.id = $1`, submissionID)
+	if err != nil {
+		return nil, err
+	}
+	return course, nil
+}
+
+// GetIDsOfTask returns the ids of all submissions of a task.
+func (s *SubmissionStore) GetIDsOfTask(taskID int64) ([]int64, error) {
+	ids := []int64{}
+	err := s.db.Select(&ids, "SELECT id FROM submissions WHERE task_id = $1;", taskID)
+	return ids, err
+}
+
+// DeleteAllOfTask removes all submissions of a task including their grades and
+// returns the ids of the removed submissions.
+func (s *SubmissionStore) DeleteAllOfTask(taskID int64) ([]int64, error) {
+	ids := []int64{}
+	err := s.db.Select(&ids, "DELETE FROM submissions WHERE task_id = $1 RETURNING id;", taskID)
+	return ids, err
+}
+
+// GetExpired returns all submissions whose files are older than the retention
+// period of their course (or defaultDays if the course has none). A courseID of
+// 0 considers all courses. If keepGraded is set, submissions which received
+// points or feedback are kept.
+func (s *SubmissionStore) GetExpired(courseID int64, defaultDays int, keepGraded bool) ([]model.Submission, error) {
+	p := []model.Submission{}
+	err := s.db.Select(&p, `
+SELECT
+  s.*
+FROM
+  submissions s
+INNER JOIN task_sheet ts ON ts.task_id = s.task_id
+INNER JOIN sheet_course sc ON sc.sheet_id = ts.sheet_id
+INNER JOIN courses c ON c.id = sc.course_id
+LEFT JOIN grades g ON g.submission_id = s.id
+WHERE
+  ($1 = 0 OR c.id = $1)
+AND
+  COALESCE(NULLIF(c.submission_retention_days, 0), $2) > 0
+AND
+  COALESCE(g.enqueued_at, s.updated_at) < now() - make_interval(days => COALESCE(NULLIF(c.submission_retention_days, 0), $2))
+AND
+  NOT ($3 AND g.id IS NOT NULL AND (g.acquired_points > 0 OR g.feedback <> ''))
+ORDER BY
+  s.id ASC
+`, courseID, defaultDays, keepGraded)
+	return p, err
+}
+
 func (s *SubmissionStore) GetFiltered(filterCourseID, filterGroupID, filterUserID, filterSheetID, filterTaskID int64) ([]model.Submission, error) {
 
 	p := []model.Submission{}
@@ -103,7 +103,12 @@ SELECT
   t.max_points,
   t.name,
   t.public_docker_image,
-  t.private_docker_image
+  t.private_docker_image,
+  t.timeout_seconds,
+  t.allow_network,
+  t.show_diff,
+  t.description,
+  t.scoring_policy
 FROM
   task_sheet ts
 INNER JOIN tasks t ON ts.task_id = t.id
@@ -115,6 +120,99 @@ ORDER BY
 	return p, err
 }
 
+// TaskStatusesOfSheet returns all tasks of a sheet together with the latest
+// submission of the given user and its points.
+func (s *TaskStore) TaskStatusesOfSheet(sheetID int64, userID int64) ([]model.TaskStatus, error) {
+	p := []model.TaskStatus{}
+
+	err := s.db.Select(&p, `
+SELECT
+  t.id,
+  t.created_at,
+  t.updated_at,
+  t.max_points,
+  t.name,
+  t.public_docker_image,
+  t.private_docker_image,
+  t.timeout_seconds,
+  t.allow_network,
+  t.show_diff,
+  t.description,
+  t.scoring_policy,
+  sub.id submission_id,
+  g.acquired_points
+FROM
+  task_sheet ts
+INNER JOIN tasks t ON ts.task_id = t.id
+LEFT JOIN LATERAL (
+  SELECT
+    id
+  FROM
+    submissions
+  WHERE
+    task_id = t.id
+  AND
+    user_id = $2
+  ORDER BY
+    created_at DESC, id DESC
+  LIMIT 1
+) sub ON TRUE
+LEFT JOIN grades g ON g.submission_id = sub.id
+WHERE
+  ts.sheet_id = $1
+ORDER BY
+  t.name ASC;`, sheetID, userID)
+	return p, err
+}
+
+// TaskSummariesOfSheet returns all tasks of a sheet together with the number
+// of students who submitted a solution and their average points. Only the
+// latest graded submission of each student counts towards the average.
+func (s *TaskStore) TaskSummariesOfSheet(sheetID int64) ([]model.TaskSummary, error) {
+	p := []model.TaskSummary{}
+
+	err := s.db.Select(&p, `
+SELECT
+  t.id,
+  t.created_at,
+  t.updated_at,
+  t.max_points,
+  t.name,
+  t.public_docker_image,
+  t.private_docker_image,
+  t.timeout_seconds,
+  t.allow_network,
+  t.show_diff,
+  t.description,
+  t.scoring_policy,
+  (SELECT COUNT(DISTINCT user_id) FROM submissions WHERE task_id = t.id) submissions,
+  COALESCE((
+    SELECT
+      AVG(latest.acquired_points)
+    FROM (
+      SELECT DISTINCT ON (sub.user_id)
+        g.acquired_points
+      FROM
+        submissions sub
+      INNER JOIN grades g ON g.submission_id = sub.id
+      WHERE
+        sub.task_id = t.id
+      AND
+        g.graded_at IS NOT NULL
+      ORDER BY
+        sub.user_id, sub.created_at DESC, sub.id DESC
+    ) latest
+  ), 0)::float average_points
+FROM
+  task_sheet ts
+INNER JOIN tasks t ON ts.task_id = t.id
+WHERE
+  ts.sheet_id = $1
+ORDER BY
+  t.name ASC;`, sheetID)
+	return p, err
+}
+
 func (s *TaskStore) IdentifyCourseOfTask(taskID int64) (*model.Course, error) {
 
 	course := &model.Course{}
@@ -167,6 +265,56 @@ WHERE
 	return averageRating, err
 }
 
+// latestGradesOfTask selects the points of the latest submission of each
+// student for the task given by $1.
+const latestGradesOfTask = `
+WITH latest AS (
+  SELECT DISTINCT ON (sub.user_id)
+    COALESCE(g.acquired_points, 0) acquired_points,
+    t.max_points
+  FROM
+    submissions sub
+  INNER JOIN tasks t ON t.id = sub.task_id
+  LEFT JOIN grades g ON g.submission_id = sub.id
+  WHERE
+    sub.task_id = $1
+  ORDER BY
+    sub.user_id, sub.created_at DESC, sub.id DESC
+)`
+
+// GetStatistics aggregates the latest submissions of all students for a task.
+// A submission passes if it acquired at least half of the points.
+func (s *TaskStore) GetStatistics(taskID int64) (*model.TaskStatistics, error) {
+	p := model.TaskStatistics{}
+	err := s.db.Get(&p, latestGradesOfTask+`
+SELECT
+  (SELECT max_points FROM tasks WHERE id = $1) max_points,
+  COUNT(*) submissions,
+  COUNT(*) FILTER (WHERE 2 * acquired_points >= max_points) passed,
+  COALESCE(AVG(acquired_points), 0)::float mean_points,
+  COALESCE(percentile_cont(0.5) WITHIN GROUP (ORDER BY acquired_points), 0)::float median_points
+FROM
+  latest;`, taskID)
+	return &p, err
+}
+
+// GetPointsHistogram counts how often each score was acquired by the latest
+// submissions of all students for a task.
+func (s *TaskStore) GetPointsHistogram(taskID int64) ([]model.TaskPointsBin, error) {
+	p := []model.TaskPointsBin{}
+	err := s.db.Select(&p, latestGradesOfTask+`
+SELECT
+  acquired_points points,
+  COUNT(*) count
+FROM
+  latest
+GROUP BY
+  acquired_points
+ORDER BY
+  acquired_points ASC;`, taskID)
+	return p, err
+}
+
 func (s *TaskStore) GetRatingOfTaskByUser(taskID int64, userID int64) (*model.TaskRating, error) {
 
 	p := model.TaskRating{}
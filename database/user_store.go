@@ -20,8 +20,12 @@
 package database
 
 import (
+	"database/sql"
+	"time"
+
 	"github.com/infomark-org/infomark/model"
 	"github.com/jmoiron/sqlx"
+	null "gopkg.in/guregu/null.v3"
 )
 
 type UserStore struct {
@@ -42,10 +46,212 @@ func (s *UserStore) Get(userID int64) (*model.User, error) {
 
 func (s *UserStore) FindByEmail(email string) (*model.User, error) {
 	p := model.User{Email: email}
-	err := s.db.Get(&p, "SELECT * FROM users WHERE email = $1 LIMIT 1;", p.Email)
+	err := s.db.Get(&p, "SELECT * FROM users WHERE email = $1 AND deleted_at IS NULL LIMIT 1;", p.Email)
+	return &p, err
+}
+
+// FindByCalendarTokenHash returns the user owning the calendar feed token.
+func (s *UserStore) FindByCalendarTokenHash(tokenHash string) (*model.User, error) {
+	p := model.User{}
+	err := s.db.Get(&p, "SELECT * FROM users WHERE calendar_token_hash = $1 AND deleted_at IS NULL LIMIT 1;", tokenHash)
 	return &p, err
 }
 
+// FindByStudentNumber returns the user with the given student number. As student
+// numbers are not guaranteed to be unique, an ambiguous match is an error.
+func (s *UserStore) FindByStudentNumber(studentNumber string) (*model.User, error) {
+	p := []model.User{}
+	err := s.db.Select(&p, "SELECT * FROM users WHERE student_number = $1 AND deleted_at IS NULL LIMIT 2;", studentNumber)
+	if err != nil {
+		return nil, err
+	}
+	if len(p) != 1 {
+		return nil, sql.ErrNoRows
+	}
+	return &p[0], nil
+}
+
+// GetPendingEmailChanges returns all users who changed their email address
+// but did not confirm the new one yet.
+func (s *UserStore) GetPendingEmailChanges() ([]model.User, error) {
+	p := []model.User{}
+	err := s.db.Select(&p, `
+SELECT
+  *
+FROM
+  users
+WHERE
+  email_changed_at IS NOT NULL
+AND
+  deleted_at IS NULL
+ORDER BY
+  email_changed_at ASC`)
+	return p, err
+}
+
+// PreviousPasswords returns the hashes of the latest passwords a user has used
+// before the current one, newest first.
+func (s *UserStore) PreviousPasswords(userID int64, limit int) ([]string, error) {
+	p := []string{}
+	err := s.db.Select(&p, `
+SELECT
+  encrypted_password
+FROM
+  password_history
+WHERE
+  user_id = $1
+ORDER BY
+  created_at DESC, id DESC
+LIMIT $2`, userID, limit)
+	return p, err
+}
+
+// UpdateWithPreviousPassword updates a user whose password has been replaced
+// and records the hash of the replaced password within the same transaction.
+// Only the latest "keep" replaced passwords are remembered.
+func (s *UserStore) UpdateWithPreviousPassword(p *model.User, previousPassword string, keep int) error {
+	tx, err := s.db.Beginx()
+	if err != nil {
+		return err
+	}
+
+	if err := Update(tx, "users", p.ID, p); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if _, err := tx.Exec(
+		"INSERT INTO password_history (user_id, encrypted_password) VALUES ($1, $2)",
+		p.ID, previousPassword); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if _, err := tx.Exec(`
+DELETE FROM password_history
+WHERE
+  user_id = $1
+AND
+  id NOT IN (
+    SELECT id FROM password_history WHERE user_id = $1 ORDER BY created_at DESC, id DESC LIMIT $2
+  )`, p.ID, keep); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// AddLogin records a successful login of a user. Logins older than "keepDays"
+// are forgotten.
+func (s *UserStore) AddLogin(userID int64, keepDays int) error {
+	tx, err := s.db.Beginx()
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec("INSERT INTO login_history (user_id) VALUES ($1)", userID); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if _, err := tx.Exec(`
+DELETE FROM login_history
+WHERE
+  user_id = $1
+AND
+  created_at < NOW() - make_interval(days => $2)`, userID, keepDays); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Activity returns at most "limit" submissions, enrollments and logins of a
+// user which happened after from (if given) and before to, newest first.
+func (s *UserStore) Activity(userID int64, from null.Time, to time.Time, limit int) ([]model.Activity, error) {
+	p := []model.Activity{}
+	err := s.db.Select(&p, `
+SELECT * FROM (
+  SELECT
+    'submission' kind,
+    COALESCE(g.enqueued_at, s.updated_at) occurred_at,
+    c.id course_id,
+    c.name course_name,
+    t.id task_id,
+    t.name task_name
+  FROM
+    submissions s
+  INNER JOIN tasks t ON t.id = s.task_id
+  INNER JOIN task_sheet ts ON ts.task_id = t.id
+  INNER JOIN sheet_course sc ON sc.sheet_id = ts.sheet_id
+  INNER JOIN courses c ON c.id = sc.course_id
+  LEFT JOIN grades g ON g.submission_id = s.id
+  WHERE
+    s.user_id = $1
+
+  UNION ALL
+
+  SELECT
+    'enrollment' kind,
+    uc.created_at occurred_at,
+    c.id course_id,
+    c.name course_name,
+    NULL task_id,
+    NULL task_name
+  FROM
+    user_course uc
+  INNER JOIN courses c ON c.id = uc.course_id
+  WHERE
+    uc.user_id = $1
+  AND
+    uc.created_at IS NOT NULL
+
+  UNION ALL
+
+  SELECT
+    'login' kind,
+    l.created_at occurred_at,
+    NULL course_id,
+    NULL course_name,
+    NULL task_id,
+    NULL task_name
+  FROM
+    login_history l
+  WHERE
+    l.user_id = $1
+) activity
+WHERE
+  ($2::TIMESTAMP IS NULL OR occurred_at >= $2)
+AND
+  occurred_at < $3
+ORDER BY
+  occurred_at DESC
+LIMIT $4`, userID, from, to, limit)
+	return p, err
+}
+
+// StudentNumberTaken tests whether an account other than the given one uses
+// the student number.
+func (s *UserStore) StudentNumberTaken(studentNumber string, exceptUserID int64) (bool, error) {
+	taken := false
+	err := s.db.Get(&taken, `
+SELECT EXISTS (
+  SELECT
+    1
+  FROM
+    users
+  WHERE
+    student_number = $1
+  AND
+    id <> $2
+  AND
+    deleted_at IS NULL
+)`, studentNumber, exceptUserID)
+	return taken, err
+}
+
 func (s *UserStore) Find(query string) ([]model.User, error) {
 	p := []model.User{}
 	err := s.db.Select(&p, `
@@ -54,20 +260,37 @@ SELECT
 FROM
   users
 WHERE
+ deleted_at IS NULL
+AND
+(
  last_name LIKE $1
 OR
  first_name LIKE $1
 OR
- email LIKE $1`, query)
+ email LIKE $1
+)`, query)
 	return p, err
 }
 
 func (s *UserStore) GetAll() ([]model.User, error) {
 	p := []model.User{}
-	err := s.db.Select(&p, "SELECT * FROM users;")
+	err := s.db.Select(&p, "SELECT * FROM users WHERE deleted_at IS NULL ORDER BY id ASC;")
 	return p, err
 }
 
+// Fingerprint returns a value which changes whenever a user is created,
+// updated or deleted.
+func (s *UserStore) Fingerprint() (string, error) {
+	var fingerprint string
+	err := s.db.Get(&fingerprint, `
+SELECT
+  COUNT(*) || '-' || COALESCE(MAX(id), 0) || '-' || COALESCE(EXTRACT(EPOCH FROM MAX(updated_at)), 0)
+FROM
+  users
+`)
+	return fingerprint, err
+}
+
 func (s *UserStore) Create(p *model.User) (*model.User, error) {
 	newID, err := Insert(s.db, "users", p)
 	if err != nil {
@@ -84,6 +307,134 @@ func (s *UserStore) Delete(userID int64) error {
 	return Delete(s.db, "users", userID)
 }
 
+// supersededByMerge selects the submissions of the accounts $1 and $2 for
+// tasks both accounts have submitted to, except for the latest upload.
+const supersededByMerge = `
+WITH uploads AS (
+  SELECT
+    s.id,
+    s.task_id,
+    COALESCE(g.enqueued_at, s.updated_at) uploaded_at
+  FROM
+    submissions s
+  LEFT JOIN grades g ON g.submission_id = s.id
+  WHERE
+    s.user_id IN ($1, $2)
+)
+SELECT
+  u.id
+FROM
+  uploads u
+INNER JOIN uploads o ON o.task_id = u.task_id AND o.id <> u.id
+WHERE
+  (o.uploaded_at, o.id) > (u.uploaded_at, u.id)`
+
+// SubmissionsSupersededByMerge returns the ids of the submissions Merge will
+// delete because the other account uploaded a later one for the same task.
+func (s *UserStore) SubmissionsSupersededByMerge(primaryID int64, duplicateID int64) ([]int64, error) {
+	ids := []int64{}
+	err := s.db.Select(&ids, supersededByMerge, primaryID, duplicateID)
+	return ids, err
+}
+
+// Merge moves submissions, enrollments, group memberships and everything else
+// belonging to the duplicate account over to the primary one. Where both
+// accounts have an entry (e.g. an enrollment in the same course), the one of
+// the primary account is kept, except for the higher role, the later
+// extension and the latest submission for a task. The duplicate is
+// soft-deleted afterwards, all of its sessions are revoked and its calendar
+// token is removed.
+func (s *UserStore) Merge(primaryID int64, duplicateID int64) error {
+	tx, err := s.db.Beginx()
+	if err != nil {
+		return err
+	}
+
+	statements := []string{
+		// the higher role wins
+		`UPDATE user_course p SET role = d.role FROM user_course d
+WHERE p.user_id = $1 AND d.user_id = $2 AND p.course_id = d.course_id AND d.role > p.role`,
+		`UPDATE user_course SET user_id = $1 WHERE user_id = $2
+AND course_id NOT IN (SELECT course_id FROM user_course WHERE user_id = $1)`,
+		`DELETE FROM user_course WHERE user_id = $2`,
+
+		`UPDATE user_group SET user_id = $1 WHERE user_id = $2
+AND group_id NOT IN (SELECT group_id FROM user_group WHERE user_id = $1)`,
+		`DELETE FROM user_group WHERE user_id = $2`,
+
+		`UPDATE group_bids SET user_id = $1 WHERE user_id = $2
+AND group_id NOT IN (SELECT group_id FROM group_bids WHERE user_id = $1)`,
+		`DELETE FROM group_bids WHERE user_id = $2`,
+
+		`UPDATE user_exam SET user_id = $1 WHERE user_id = $2
+AND exam_id NOT IN (SELECT exam_id FROM user_exam WHERE user_id = $1)`,
+		`DELETE FROM user_exam WHERE user_id = $2`,
+
+		`UPDATE task_ratings SET user_id = $1 WHERE user_id = $2
+AND task_id NOT IN (SELECT task_id FROM task_ratings WHERE user_id = $1)`,
+		`DELETE FROM task_ratings WHERE user_id = $2`,
+
+		// the later due date wins
+		`INSERT INTO sheet_extensions (sheet_id, user_id, due_at)
+SELECT sheet_id, $1, due_at FROM sheet_extensions WHERE user_id = $2
+ON CONFLICT (sheet_id, user_id) DO UPDATE SET
+due_at = GREATEST(sheet_extensions.due_at, EXCLUDED.due_at), updated_at = NOW()`,
+		`DELETE FROM sheet_extensions WHERE user_id = $2`,
+
+		// points are attached to the submissions, the grades of superseded
+		// submissions are removed by the database
+		`DELETE FROM submissions WHERE id IN (` + supersededByMerge + `)`,
+		`UPDATE submissions SET user_id = $1 WHERE user_id = $2`,
+		`UPDATE grades SET tutor_id = $1 WHERE tutor_id = $2`,
+		`UPDATE groups SET tutor_id = $1 WHERE tutor_id = $2`,
+		`UPDATE pending_notifications SET user_id = $1 WHERE user_id = $2`,
+		`UPDATE email_broadcasts SET sender_id = $1 WHERE sender_id = $2`,
+		`UPDATE email_logs SET user_id = $1 WHERE user_id = $2`,
+		`UPDATE login_history SET user_id = $1 WHERE user_id = $2`,
+		`UPDATE password_history SET user_id = $1 WHERE user_id = $2`,
+		`DELETE FROM api_keys WHERE user_id = $2`,
+
+		`UPDATE users SET deleted_at = NOW(), sessions_revoked_at = NOW(), updated_at = NOW(),
+calendar_token_hash = NULL WHERE id = $2`,
+	}
+
+	for _, statement := range statements {
+		if _, err := tx.Exec(statement, primaryID, duplicateID); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// SoftDelete marks all given users as deleted within a single transaction.
+// Their sessions are revoked and their API keys and calendar tokens removed,
+// but submissions and grades are kept.
+func (s *UserStore) SoftDelete(userIDs []int64) error {
+	tx, err := s.db.Beginx()
+	if err != nil {
+		return err
+	}
+
+	statements := []string{
+		`DELETE FROM api_keys WHERE user_id = $1`,
+		`UPDATE users SET deleted_at = NOW(), sessions_revoked_at = NOW(), updated_at = NOW(),
+calendar_token_hash = NULL WHERE id = $1 AND deleted_at IS NULL`,
+	}
+
+	for _, userID := range userIDs {
+		for _, statement := range statements {
+			if _, err := tx.Exec(statement, userID); err != nil {
+				tx.Rollback()
+				return err
+			}
+		}
+	}
+
+	return tx.Commit()
+}
+
 func (s *UserStore) GetEnrollments(userID int64) ([]model.Enrollment, error) {
 	p := []model.Enrollment{}
 	err := s.db.Select(&p, `
@@ -94,7 +445,48 @@ FROM
   user_course
 WHERE
   user_id = $1
+ORDER BY
+  course_id ASC
 `, userID)
 	return p, err
 
 }
+
+// GetEnrollmentsPage returns at most "limit" (0 for all) course enrollments of
+// a user starting at "offset", restricted to courses of the given semester
+// and year.
+func (s *UserStore) GetEnrollmentsPage(userID int64, semester string, year int, limit int, offset int) ([]model.Enrollment, error) {
+	p := []model.Enrollment{}
+	err := s.db.Select(&p, `
+SELECT
+  uc.course_id,
+  uc.role
+FROM
+  user_course uc
+INNER JOIN courses c ON c.id = uc.course_id
+WHERE
+  uc.user_id = $1
+AND`+courseSemesterFilter+`
+ORDER BY
+  uc.course_id ASC
+LIMIT NULLIF($4, 0)
+OFFSET $5
+`, userID, semester, year, limit, offset)
+	return p, err
+}
+
+// CountEnrollments returns the number of course enrollments of a user in
+// courses of the given semester and year.
+func (s *UserStore) CountEnrollments(userID int64, semester string, year int) (int, error) {
+	var total int
+	err := s.db.Get(&total, `
+SELECT
+  COUNT(*)
+FROM
+  user_course uc
+INNER JOIN courses c ON c.id = uc.course_id
+WHERE
+  uc.user_id = $1
+AND`+courseSemesterFilter, userID, semester, year)
+	return total, err
+}
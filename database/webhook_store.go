@@ -0,0 +1,64 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package database
+
+import (
+	"github.com/infomark-org/infomark/model"
+	"github.com/jmoiron/sqlx"
+)
+
+// WebhookStore is the store for webhook subscriptions of courses.
+type WebhookStore struct {
+	db *sqlx.DB
+}
+
+// NewWebhookStore creates a new webhook store.
+func NewWebhookStore(db *sqlx.DB) *WebhookStore {
+	return &WebhookStore{
+		db: db,
+	}
+}
+
+// Get returns a webhook for a given id.
+func (s *WebhookStore) Get(webhookID int64) (*model.Webhook, error) {
+	p := model.Webhook{ID: webhookID}
+	err := s.db.Get(&p, "SELECT * FROM webhooks WHERE id = $1 LIMIT 1;", p.ID)
+	return &p, err
+}
+
+// WebhooksOfCourse returns all webhooks of a course.
+func (s *WebhookStore) WebhooksOfCourse(courseID int64) ([]model.Webhook, error) {
+	p := []model.Webhook{}
+	err := s.db.Select(&p, "SELECT * FROM webhooks WHERE course_id = $1 ORDER BY id ASC;", courseID)
+	return p, err
+}
+
+// Create stores a new webhook.
+func (s *WebhookStore) Create(p *model.Webhook) (*model.Webhook, error) {
+	newID, err := Insert(s.db, "webhooks", p)
+	if err != nil {
+		return nil, err
+	}
+	return s.Get(newID)
+}
+
+// Delete removes a webhook.
+func (s *WebhookStore) Delete(webhookID int64) error {
+	return Delete(s.db, "webhooks", webhookID)
+}
@@ -164,6 +164,10 @@ func main() {
 	f.WriteString("    description: Enrollments related requests\n")
 	f.WriteString("  - name: materials\n")
 	f.WriteString("    description: Exercise material related requests\n")
+	f.WriteString("  - name: webhooks\n")
+	f.WriteString("    description: Webhook subscriptions of courses\n")
+	f.WriteString("  - name: notes\n")
+	f.WriteString("    description: Pinned notes of courses\n")
 	f.WriteString("  - name: internal\n")
 	f.WriteString("    description: Endpoints for internal usage only\n")
 
@@ -214,10 +218,33 @@ func main() {
 	f.WriteString("          schema:\n")
 	f.WriteString("            type: string\n")
 	f.WriteString("            format: binary\n")
+	f.WriteString("    CSVFile:\n")
+	f.WriteString("      description: A table as a download.\n")
+	f.WriteString("      content:\n")
+	f.WriteString("        text/csv:\n")
+	f.WriteString("          schema:\n")
+	f.WriteString("            type: string\n")
+	f.WriteString("    XLSXFile:\n")
+	f.WriteString("      description: A workbook as a download.\n")
+	f.WriteString("      content:\n")
+	f.WriteString("        application/vnd.openxmlformats-officedocument.spreadsheetml.sheet:\n")
+	f.WriteString("          schema:\n")
+	f.WriteString("            type: string\n")
+	f.WriteString("            format: binary\n")
+	f.WriteString("    CalendarFile:\n")
+	f.WriteString("      description: A calendar to subscribe to.\n")
+	f.WriteString("      content:\n")
+	f.WriteString("        text/calendar:\n")
+	f.WriteString("          schema:\n")
+	f.WriteString("            type: string\n")
 	f.WriteString("    OK:\n")
 	f.WriteString("      description: Post successfully delivered.\n")
+	f.WriteString("    NotModified:\n")
+	f.WriteString("      description: The cached version of the client is up to date.\n")
 	f.WriteString("    NoContent:\n")
 	f.WriteString("      description: Update was successful.\n")
+	f.WriteString("    Redirect:\n")
+	f.WriteString("      description: Redirect to the location given in the header.\n")
 	f.WriteString("    BadRequest:\n")
 	f.WriteString("      description: The request is in a wrong format or contains missing fields.\n")
 	f.WriteString("      content:\n")
@@ -236,6 +263,12 @@ func main() {
 	f.WriteString("        application/json:\n")
 	f.WriteString("          schema:\n")
 	f.WriteString("            $ref: \"#/components/schemas/Error\"\n")
+	f.WriteString("    Conflict:\n")
+	f.WriteString("      description: The request conflicts with an existing entry.\n")
+	f.WriteString("      content:\n")
+	f.WriteString("        application/json:\n")
+	f.WriteString("          schema:\n")
+	f.WriteString("            $ref: \"#/components/schemas/Error\"\n")
 
 	// create all responses
 	f.WriteString(swagger.SwaggerResponsesWithSuffix(fset, pkgs, "Response", 4))
@@ -284,16 +317,16 @@ func main() {
 			}
 
 			if action.Details.Method == "get" {
-				// test wether we have a 200 response
+				// test wether we have a 200 response (or a redirect)
 				found := false
 				for _, r := range action.Details.Responses {
-					if r.Code == 200 {
+					if r.Code == 200 || r.Code == 302 {
 						found = true
 						break
 					}
 				}
 				if !found {
-					panic(fmt.Sprintf("endpoint '%s' is '%s' but has no 200 response in %v",
+					panic(fmt.Sprintf("endpoint '%s' is '%s' but has no 200 or 302 response in %v",
 						url, action.Details.Method, action.Position))
 				}
 			}
@@ -359,6 +392,18 @@ func main() {
 					f.WriteString("            encoding:\n")
 					f.WriteString("              file_data:\n")
 					f.WriteString("                contentType: image/jpeg\n")
+				case "csvfile":
+					f.WriteString("        content:\n")
+					f.WriteString("          multipart/form-data:\n")
+					f.WriteString("            schema:\n")
+					f.WriteString("              type: object\n")
+					f.WriteString("              properties:\n")
+					f.WriteString("                file_data:\n")
+					f.WriteString("                  type: string\n")
+					f.WriteString("                  format: binary\n")
+					f.WriteString("            encoding:\n")
+					f.WriteString("              file_data:\n")
+					f.WriteString("                contentType: text/csv\n")
 				case "empty":
 
 				default:
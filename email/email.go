@@ -35,17 +35,36 @@ type Email struct {
 	To      string
 	Subject string
 	Body    string
+	// ReplyTo is the address answers should be sent to (optional)
+	ReplyTo string
+	// Done is called with the result after sending (optional)
+	Done func(err error)
 }
 
 // OutgoingEmailsChannel is a light-weight go-routine to send emails
 var OutgoingEmailsChannel chan *Email
 
+// SubjectPrefix is prepended to the subjects of all emails, e.g. "[InfoMark]".
+var SubjectPrefix string
+
+// subjectWithPrefix prepends the given prefix or SubjectPrefix if the former
+// is empty.
+func subjectWithPrefix(prefix string, subject string) string {
+	if prefix == "" {
+		prefix = SubjectPrefix
+	}
+	if prefix == "" {
+		return subject
+	}
+	return fmt.Sprintf("%s %s", prefix, subject)
+}
+
 // NewEmail creates a new email structure
 func NewEmail(from string, toEmail string, subject string, body string) *Email {
 	email := &Email{
 		From:    from,
 		To:      toEmail,
-		Subject: subject,
+		Subject: subjectWithPrefix("", subject),
 		Body:    body,
 	}
 	return email
@@ -53,10 +72,16 @@ func NewEmail(from string, toEmail string, subject string, body string) *Email {
 
 // NewEmailFromUser creates a new email structure and appends the sender information
 func NewEmailFromUser(from string, toEmail string, subject string, body string, user *model.User) *Email {
+	return NewCourseEmailFromUser(from, toEmail, subject, body, user, "")
+}
+
+// NewCourseEmailFromUser is like NewEmailFromUser but uses the subject prefix
+// of a course instead of SubjectPrefix if it is not empty.
+func NewCourseEmailFromUser(from string, toEmail string, subject string, body string, user *model.User, subjectPrefix string) *Email {
 	email := &Email{
 		From:    from,
 		To:      toEmail,
-		Subject: subject,
+		Subject: subjectWithPrefix(subjectPrefix, subject),
 		Body:    fmt.Sprintf("%s\n\n----------\nSender is %s\nSent via InfoMark\n", body, user.FullName()),
 	}
 	return email
@@ -128,13 +153,25 @@ func (sm *VoidMailer) Send(e *Email) error {
 // BackgroundSend will send emails enqueued in a channel
 func BackgroundSend(emails <-chan *Email) {
 	for email := range emails {
-		DefaultMail.Send(email)
+		Deliver(email)
+	}
+}
+
+// Deliver sends an email using the default mailer and reports the result.
+func Deliver(e *Email) error {
+	err := DefaultMail.Send(e)
+	if e.Done != nil {
+		e.Done(err)
 	}
+	return err
 }
 
 // Send prints everything to stdout.
 func (sm *TerminalMailer) Send(e *Email) error {
 	fmt.Printf("From: %s\n", e.From)
+	if e.ReplyTo != "" {
+		fmt.Printf("Reply-To: %s\n", e.ReplyTo)
+	}
 	fmt.Printf("To: %s\n", e.To)
 	fmt.Printf("Subject: %s\n", e.Subject)
 	fmt.Printf("Content-Type: text/plain; charset=\"utf-8\"\n")
@@ -161,6 +198,9 @@ func (sm *SendMailer) Send(e *Email) error {
 	}
 
 	pw.Write([]byte(fmt.Sprintf("From: %s\n", e.From)))
+	if e.ReplyTo != "" {
+		pw.Write([]byte(fmt.Sprintf("Reply-To: %s\n", e.ReplyTo)))
+	}
 	pw.Write([]byte(fmt.Sprintf("To: %s\n", e.To)))
 	pw.Write([]byte(fmt.Sprintf("Subject: %s\n", e.Subject)))
 	pw.Write([]byte("Content-Type: text/plain; charset=\"utf-8\"\n"))
@@ -211,8 +251,20 @@ If you have not requested the change, you can ignore this mail.
 
 Your password can only be changed manually by you.
 
+`
+
+	emailChangeReminderTemplateSrcEN = `Hi {{.first_name}} {{.last_name}}!
+
+You changed the email address of your account to this one, but did not confirm it yet.
+Please use the following link to confirm your email address:
+
+{{.confirm_email_url}}/{{.confirm_email_address}}/{{.confirm_email_token}}
+
+Otherwise, the change will be discarded on {{.expires_at}} and your previous email address is used again.
+
 `
 )
 
 var ConfirmEmailTemplateEN *template.Template = template.Must(template.New("confirmEmailTemplateSrcEN").Parse(confirmEmailTemplateSrcEN))
 var RequestPasswordTokenTemailTemplateEN *template.Template = template.Must(template.New("requestPasswordTokenTemailTemplateSrcEN").Parse(requestPasswordTokenTemailTemplateSrcEN))
+var EmailChangeReminderTemplateEN *template.Template = template.Must(template.New("emailChangeReminderTemplateSrcEN").Parse(emailChangeReminderTemplateSrcEN))
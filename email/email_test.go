@@ -0,0 +1,63 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package email
+
+import (
+	"testing"
+
+	"github.com/franela/goblin"
+	"github.com/infomark-org/infomark/model"
+)
+
+func TestSubjectPrefix(t *testing.T) {
+	g := goblin.Goblin(t)
+
+	g.Describe("Subject prefix", func() {
+
+		g.AfterEach(func() {
+			SubjectPrefix = ""
+		})
+
+		g.It("Should leave subjects untouched without a prefix", func() {
+			msg := NewEmail("from@example.com", "to@example.com", "Hello", "body")
+			g.Assert(msg.Subject).Equal("Hello")
+		})
+
+		g.It("Should prepend the global prefix", func() {
+			SubjectPrefix = "[InfoMark]"
+			msg := NewEmail("from@example.com", "to@example.com", "Hello", "body")
+			g.Assert(msg.Subject).Equal("[InfoMark] Hello")
+
+			user := &model.User{FirstName: "Ada", LastName: "Lovelace"}
+			msg = NewEmailFromUser("from@example.com", "to@example.com", "Hello", "body", user)
+			g.Assert(msg.Subject).Equal("[InfoMark] Hello")
+		})
+
+		g.It("Should prefer the prefix of a course", func() {
+			SubjectPrefix = "[InfoMark]"
+			user := &model.User{FirstName: "Ada", LastName: "Lovelace"}
+
+			msg := NewCourseEmailFromUser("from@example.com", "to@example.com", "Hello", "body", user, "[InfoMark CS101]")
+			g.Assert(msg.Subject).Equal("[InfoMark CS101] Hello")
+
+			msg = NewCourseEmailFromUser("from@example.com", "to@example.com", "Hello", "body", user, "")
+			g.Assert(msg.Subject).Equal("[InfoMark] Hello")
+		})
+
+	})
+}
@@ -0,0 +1,105 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package email
+
+import (
+	"html/template"
+)
+
+// FallbackLanguage is used for languages without translated templates.
+const FallbackLanguage = "en"
+
+// SupportedLanguages lists all languages emails are available in.
+var SupportedLanguages = []string{"en", "de"}
+
+// LocalizedTemplate is the subject and the body of an email in one language.
+type LocalizedTemplate struct {
+	Subject string
+	Body    *template.Template
+}
+
+const (
+	confirmEmailTemplateSrcDE = `Hallo {{.first_name}} {{.last_name}}!
+
+Bitte bestätigen Sie Ihre E-Mail-Adresse, um:
+   - sich anzumelden und Ihre Lösungen hochzuladen
+   - Ihr Passwort zurückzusetzen
+   - Benachrichtigungen zu Ihrem Konto zu erhalten
+
+Über den folgenden Link können Sie Ihre E-Mail-Adresse bestätigen:
+
+{{.confirm_email_url}}/{{.confirm_email_address}}/{{.confirm_email_token}}
+
+`
+
+	requestPasswordTokenTemailTemplateSrcDE = `Hallo {{.first_name}} {{.last_name}}!
+
+Wir haben eine Anfrage erhalten, Ihr Passwort zu ändern. Über den folgenden Link können Sie ein neues Passwort setzen.
+
+{{.reset_password_url}}/{{.email_address}}/{{.reset_password_token}}
+
+Falls Sie die Änderung nicht angefordert haben, können Sie diese E-Mail ignorieren.
+
+Ihr Passwort kann nur von Ihnen selbst geändert werden.
+
+`
+
+	emailChangeReminderTemplateSrcDE = `Hallo {{.first_name}} {{.last_name}}!
+
+Sie haben die E-Mail-Adresse Ihres Kontos auf diese Adresse geändert, die Änderung aber noch nicht bestätigt.
+Über den folgenden Link können Sie Ihre E-Mail-Adresse bestätigen:
+
+{{.confirm_email_url}}/{{.confirm_email_address}}/{{.confirm_email_token}}
+
+Andernfalls wird die Änderung am {{.expires_at}} verworfen und Ihre vorherige E-Mail-Adresse wieder verwendet.
+
+`
+)
+
+var confirmEmailTemplateDE = template.Must(template.New("confirmEmailTemplateSrcDE").Parse(confirmEmailTemplateSrcDE))
+var requestPasswordTokenTemailTemplateDE = template.Must(template.New("requestPasswordTokenTemailTemplateSrcDE").Parse(requestPasswordTokenTemailTemplateSrcDE))
+var emailChangeReminderTemplateDE = template.Must(template.New("emailChangeReminderTemplateSrcDE").Parse(emailChangeReminderTemplateSrcDE))
+
+// ConfirmEmailTemplates contains the email to confirm an email address.
+var ConfirmEmailTemplates = map[string]LocalizedTemplate{
+	"en": {Subject: "Confirm Account Instructions", Body: ConfirmEmailTemplateEN},
+	"de": {Subject: "Bestätigung Ihres Kontos", Body: confirmEmailTemplateDE},
+}
+
+// RequestPasswordTokenTemplates contains the email to reset a password.
+var RequestPasswordTokenTemplates = map[string]LocalizedTemplate{
+	"en": {Subject: "Password Reset Instructions", Body: RequestPasswordTokenTemailTemplateEN},
+	"de": {Subject: "Zurücksetzen Ihres Passworts", Body: requestPasswordTokenTemailTemplateDE},
+}
+
+// EmailChangeReminderTemplates contains the reminder to confirm a changed
+// email address.
+var EmailChangeReminderTemplates = map[string]LocalizedTemplate{
+	"en": {Subject: "Confirm Your New Email Address", Body: EmailChangeReminderTemplateEN},
+	"de": {Subject: "Bestätigung Ihrer neuen E-Mail-Adresse", Body: emailChangeReminderTemplateDE},
+}
+
+// Localize picks the template in the given language. Missing translations
+// fall back to english.
+func Localize(templates map[string]LocalizedTemplate, language string) LocalizedTemplate {
+	if tpl, ok := templates[language]; ok {
+		return tpl
+	}
+	return templates[FallbackLanguage]
+}
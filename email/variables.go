@@ -0,0 +1,124 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package email
+
+import (
+	"bytes"
+	"sort"
+	"text/template"
+	"text/template/parse"
+)
+
+// Emails written by staff can reference variables like {{.first_name}} which
+// are filled for each recipient.
+
+// TemplateVariables returns the names of all variables referenced in a text.
+func TemplateVariables(text string) ([]string, error) {
+	tpl, err := template.New("").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+
+	found := map[string]bool{}
+	if tpl.Tree != nil {
+		collectVariables(tpl.Tree.Root, found)
+	}
+
+	names := []string{}
+	for name := range found {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// MissingTemplateVariables returns all variables referenced in the texts which
+// are not in the list of provided ones.
+func MissingTemplateVariables(provided []string, texts ...string) ([]string, error) {
+	available := map[string]bool{}
+	for _, name := range provided {
+		available[name] = true
+	}
+
+	missing := []string{}
+	reported := map[string]bool{}
+	for _, text := range texts {
+		names, err := TemplateVariables(text)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range names {
+			if !available[name] && !reported[name] {
+				reported[name] = true
+				missing = append(missing, name)
+			}
+		}
+	}
+	sort.Strings(missing)
+	return missing, nil
+}
+
+// FillTextTemplate replaces all variables in a text by the given values.
+func FillTextTemplate(text string, data map[string]string) (string, error) {
+	tpl, err := template.New("").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	err = tpl.Execute(&buf, data)
+	return buf.String(), err
+}
+
+// collectVariables walks the parse tree and records all referenced fields.
+func collectVariables(node parse.Node, found map[string]bool) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			collectVariables(child, found)
+		}
+	case *parse.ActionNode:
+		collectVariables(n.Pipe, found)
+	case *parse.PipeNode:
+		if n == nil {
+			return
+		}
+		for _, cmd := range n.Cmds {
+			for _, arg := range cmd.Args {
+				collectVariables(arg, found)
+			}
+		}
+	case *parse.FieldNode:
+		found[n.Ident[0]] = true
+	case *parse.IfNode:
+		collectVariables(&n.BranchNode, found)
+	case *parse.RangeNode:
+		collectVariables(&n.BranchNode, found)
+	case *parse.WithNode:
+		collectVariables(&n.BranchNode, found)
+	case *parse.BranchNode:
+		collectVariables(n.Pipe, found)
+		collectVariables(n.List, found)
+		collectVariables(n.ElseList, found)
+	case *parse.TemplateNode:
+		collectVariables(n.Pipe, found)
+	}
+}
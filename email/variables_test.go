@@ -0,0 +1,57 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package email
+
+import (
+	"testing"
+
+	"github.com/franela/goblin"
+)
+
+func TestTemplateVariables(t *testing.T) {
+	g := goblin.Goblin(t)
+
+	g.Describe("Template variables", func() {
+
+		g.It("Should find referenced variables", func() {
+			names, err := TemplateVariables("Hi {{.first_name}} {{if .last_name}}{{.last_name}}{{end}}, {{.first_name}}")
+			g.Assert(err).Equal(nil)
+			g.Assert(names).Equal([]string{"first_name", "last_name"})
+
+			names, err = TemplateVariables("no variables {here}")
+			g.Assert(err).Equal(nil)
+			g.Assert(names).Equal([]string{})
+		})
+
+		g.It("Should report missing variables", func() {
+			missing, err := MissingTemplateVariables([]string{"first_name"}, "Dear {{.first_name}}", "{{.nickname}} {{.age}}")
+			g.Assert(err).Equal(nil)
+			g.Assert(missing).Equal([]string{"age", "nickname"})
+
+			_, err = MissingTemplateVariables([]string{"first_name"}, "Dear {{.first_name")
+			g.Assert(err != nil).IsTrue()
+		})
+
+		g.It("Should fill variables", func() {
+			text, err := FillTextTemplate("Dear {{.first_name}} <3", map[string]string{"first_name": "Ada"})
+			g.Assert(err).Equal(nil)
+			g.Assert(text).Equal("Dear Ada <3")
+		})
+
+	})
+}
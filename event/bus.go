@@ -0,0 +1,70 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package event
+
+import (
+	"sync"
+)
+
+// Event is anything which happened and might be interesting for others.
+type Event interface {
+	// Name identifies the kind of event, e.g. "submission.graded".
+	Name() string
+}
+
+// Handler reacts to a published event.
+type Handler func(e Event) error
+
+// Bus dispatches published events to all subscribers of this kind of event.
+// Subscribers are called synchronously in the order of subscription. Slow
+// subscribers (emails, webhooks) should hand over their work to a background
+// channel.
+type Bus struct {
+	mu       sync.RWMutex
+	handlers map[string][]Handler
+}
+
+// NewBus creates an event bus without any subscribers.
+func NewBus() *Bus {
+	return &Bus{
+		handlers: make(map[string][]Handler),
+	}
+}
+
+// Subscribe registers a handler for all events with the given name.
+func (b *Bus) Subscribe(name string, handler Handler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.handlers[name] = append(b.handlers[name], handler)
+}
+
+// Publish calls all subscribers of the event. All subscribers are called,
+// even if some of them fail. The first error is returned.
+func (b *Bus) Publish(e Event) error {
+	b.mu.RLock()
+	handlers := b.handlers[e.Name()]
+	b.mu.RUnlock()
+
+	var firstErr error
+	for _, handler := range handlers {
+		if err := handler(e); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
@@ -0,0 +1,78 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package event
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/franela/goblin"
+	"github.com/infomark-org/infomark/model"
+)
+
+func TestBus(t *testing.T) {
+	g := goblin.Goblin(t)
+
+	g.Describe("Bus", func() {
+
+		g.It("Should invoke registered subscribers in order", func() {
+			bus := NewBus()
+			calls := []string{}
+
+			bus.Subscribe(UserRegistered{}.Name(), func(e Event) error {
+				calls = append(calls, "first:"+e.(UserRegistered).User.Email)
+				return nil
+			})
+			bus.Subscribe(UserRegistered{}.Name(), func(e Event) error {
+				calls = append(calls, "second:"+e.(UserRegistered).User.Email)
+				return nil
+			})
+			bus.Subscribe(LoginFailed{}.Name(), func(e Event) error {
+				calls = append(calls, "login")
+				return nil
+			})
+
+			err := bus.Publish(UserRegistered{User: &model.User{Email: "test@uni-tuebingen.de"}})
+			g.Assert(err).Equal(nil)
+			g.Assert(calls).Equal([]string{"first:test@uni-tuebingen.de", "second:test@uni-tuebingen.de"})
+		})
+
+		g.It("Should ignore events without subscribers", func() {
+			bus := NewBus()
+			g.Assert(bus.Publish(LoginFailed{})).Equal(nil)
+		})
+
+		g.It("Should call all subscribers and report the first error", func() {
+			bus := NewBus()
+			called := 0
+
+			bus.Subscribe(LoginFailed{}.Name(), func(e Event) error {
+				called++
+				return errors.New("first")
+			})
+			bus.Subscribe(LoginFailed{}.Name(), func(e Event) error {
+				called++
+				return errors.New("second")
+			})
+
+			err := bus.Publish(LoginFailed{})
+			g.Assert(err.Error()).Equal("first")
+			g.Assert(called).Equal(2)
+		})
+	})
+}
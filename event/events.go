@@ -0,0 +1,140 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package event
+
+import (
+	"time"
+
+	"github.com/infomark-org/infomark/model"
+)
+
+// UserRegistered is published when a new account has been created.
+type UserRegistered struct {
+	User *model.User
+}
+
+// Name implements Event.
+func (e UserRegistered) Name() string { return "user.registered" }
+
+// UserConfirmed is published when a new account has been confirmed, either by
+// its email address or right away if email verification is disabled.
+type UserConfirmed struct {
+	User *model.User
+}
+
+// Name implements Event.
+func (e UserConfirmed) Name() string { return "user.confirmed" }
+
+// EmailChanged is published when a user changed the email address, which
+// needs to be confirmed again.
+type EmailChanged struct {
+	User *model.User
+}
+
+// Name implements Event.
+func (e EmailChanged) Name() string { return "user.email_changed" }
+
+// LoginFailed is published for each rejected login attempt.
+type LoginFailed struct{}
+
+// Name implements Event.
+func (e LoginFailed) Name() string { return "auth.login_failed" }
+
+// LoginSucceeded is published when a user started a session, regardless of
+// the method of authentication.
+type LoginSucceeded struct {
+	UserID int64
+}
+
+// Name implements Event.
+func (e LoginSucceeded) Name() string { return "auth.login_succeeded" }
+
+// EnrollmentCreated is published when a user enrolled into a course.
+type EnrollmentCreated struct {
+	CourseID   int64
+	Enrollment *model.UserCourse
+}
+
+// Name implements Event.
+func (e EnrollmentCreated) Name() string { return "enrollment.created" }
+
+// EnrollmentRoleChanged is published when a course admin changed the role of
+// an enrolled user.
+type EnrollmentRoleChanged struct {
+	Course *model.Course
+	User   *model.User
+	Role   int
+}
+
+// Name implements Event.
+func (e EnrollmentRoleChanged) Name() string { return "enrollment.role_changed" }
+
+// SubmissionCreated is published when a solution has been uploaded.
+type SubmissionCreated struct {
+	TaskID     int64
+	Submission *model.Submission
+}
+
+// Name implements Event.
+func (e SubmissionCreated) Name() string { return "submission.created" }
+
+// SubmissionGraded is published when a tutor graded a submission.
+type SubmissionGraded struct {
+	CourseID int64
+	Grade    *model.Grade
+	First    bool // the submission has not been graded by a tutor before
+}
+
+// Name implements Event.
+func (e SubmissionGraded) Name() string { return "submission.graded" }
+
+// GradesPublished is published when the grades of a sheet become visible to
+// students.
+type GradesPublished struct {
+	CourseID int64
+	Sheet    *model.Sheet
+}
+
+// Name implements Event.
+func (e GradesPublished) Name() string { return "sheet.grades_published" }
+
+// TestResultReceived is published when a worker reports the result of the
+// public or private tests.
+type TestResultReceived struct {
+	TaskID     int64
+	Kind       string // "public" or "private"
+	Success    bool
+	TimedOut   bool
+	EnqueuedAt time.Time
+	StartedAt  time.Time
+	FinishedAt time.Time
+}
+
+// Name implements Event.
+func (e TestResultReceived) Name() string { return "submission.tested" }
+
+// TestResultDiscarded is published when a worker reported a result which is
+// not stored, e.g. because the submission has been replaced in the meantime or
+// the result is invalid. The job has ended nevertheless.
+type TestResultDiscarded struct {
+	TaskID int64
+	Kind   string // "public" or "private"
+}
+
+// Name implements Event.
+func (e TestResultDiscarded) Name() string { return "submission.test_discarded" }
@@ -11,10 +11,12 @@ require (
 	github.com/dgrijalva/jwt-go v3.2.0+incompatible
 	github.com/docker/docker v0.7.3-0.20190817195342-4760db040282
 	github.com/franela/goblin v0.0.0-20181003173013-ead4ad1d2727
+	github.com/go-asn1-ber/asn1-ber v1.3.1
 	github.com/go-chi/chi v4.0.0+incompatible
 	github.com/go-chi/cors v1.0.0
 	github.com/go-chi/jwtauth v0.0.0-20190109153619-47840abb19b3
 	github.com/go-chi/render v1.0.1
+	github.com/go-ldap/ldap/v3 v3.1.10
 	github.com/go-ozzo/ozzo-validation v3.5.0+incompatible
 	github.com/go-redis/redis v6.15.2+incompatible
 	github.com/golang-migrate/migrate/v4 v4.7.2-0.20191224233836-6b1121a6582e
@@ -25,12 +27,13 @@ require (
 	github.com/mattn/go-sqlite3 v1.10.0
 	github.com/prometheus/client_golang v0.9.3-0.20190127221311-3c4408c8b829
 	github.com/robfig/cron v0.0.0-20180505203441-b41be1df6967
+	github.com/russross/blackfriday v1.5.2
 	github.com/sirupsen/logrus v1.4.3-0.20191026113918-67a7fdcf741f
 	github.com/spf13/cobra v0.0.5
 	github.com/streadway/amqp v0.0.0-20190225234609-30f8ed68076e
 	github.com/ulule/limiter/v3 v3.1.0
 	golang.org/x/crypto v0.0.0-20190621222207-cc06ce4a13d4
-	golang.org/x/net v0.0.0-20190620200207-3b0461eec859 // indirect
+	golang.org/x/net v0.0.0-20190620200207-3b0461eec859
 	golang.org/x/sys v0.0.0-20190515120540-06a5c4944438 // indirect
 	gopkg.in/guregu/null.v3 v3.4.0
 	gopkg.in/yaml.v2 v2.2.7
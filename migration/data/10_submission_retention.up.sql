@@ -0,0 +1,4 @@
+BEGIN;
+-- number of days submission files are kept (0 uses the server default)
+ALTER TABLE courses ADD COLUMN submission_retention_days INT NOT NULL DEFAULT 0;
+COMMIT;
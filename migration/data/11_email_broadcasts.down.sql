@@ -0,0 +1,4 @@
+BEGIN;
+DROP TABLE IF EXISTS email_deliveries;
+DROP TABLE IF EXISTS email_broadcasts;
+COMMIT;
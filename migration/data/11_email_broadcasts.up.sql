@@ -0,0 +1,28 @@
+BEGIN;
+CREATE TABLE email_broadcasts (
+  id SERIAL not null primary key,
+  created_at TIMESTAMP not null DEFAULT current_timestamp,
+  updated_at TIMESTAMP not null DEFAULT current_timestamp,
+
+  course_id INT not null,
+  sender_id INT not null,
+  subject TEXT not null,
+
+  FOREIGN KEY (course_id) REFERENCES courses (id) ON DELETE CASCADE,
+  FOREIGN KEY (sender_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE TABLE email_deliveries (
+  id SERIAL not null primary key,
+  created_at TIMESTAMP not null DEFAULT current_timestamp,
+  updated_at TIMESTAMP not null DEFAULT current_timestamp,
+
+  broadcast_id INT not null,
+  email TEXT not null,
+  -- 0: queued, 1: sent, 2: failed
+  state INT not null DEFAULT 0,
+  error TEXT not null DEFAULT '',
+
+  FOREIGN KEY (broadcast_id) REFERENCES email_broadcasts (id) ON DELETE CASCADE
+);
+COMMIT;
@@ -0,0 +1,15 @@
+BEGIN;
+CREATE TABLE grade_test_cases (
+  id SERIAL not null primary key,
+  created_at TIMESTAMP not null DEFAULT current_timestamp,
+  updated_at TIMESTAMP not null DEFAULT current_timestamp,
+
+  grade_id INT not null,
+  -- public or private
+  kind TEXT not null,
+  name TEXT not null,
+  passed BOOLEAN not null DEFAULT false,
+
+  FOREIGN KEY (grade_id) REFERENCES grades (id) ON DELETE CASCADE
+);
+COMMIT;
@@ -0,0 +1,3 @@
+BEGIN;
+ALTER TABLE grade_test_cases DROP COLUMN IF EXISTS hidden;
+COMMIT;
@@ -0,0 +1,4 @@
+BEGIN;
+-- hidden test cases are only shown to students as an aggregate
+ALTER TABLE grade_test_cases ADD COLUMN hidden BOOLEAN NOT NULL DEFAULT false;
+COMMIT;
@@ -0,0 +1,5 @@
+BEGIN;
+ALTER TABLE grades DROP COLUMN IF EXISTS best_points;
+ALTER TABLE tasks DROP COLUMN IF EXISTS scoring_policy;
+ALTER TABLE sheets DROP COLUMN IF EXISTS scoring_policy;
+COMMIT;
@@ -0,0 +1,9 @@
+BEGIN;
+-- either 'latest' or 'best'
+ALTER TABLE sheets ADD COLUMN scoring_policy TEXT NOT NULL DEFAULT 'latest';
+-- NULL uses the policy of the sheet
+ALTER TABLE tasks ADD COLUMN scoring_policy TEXT NULL;
+-- highest points of all submissions of a grade
+ALTER TABLE grades ADD COLUMN best_points INT NOT NULL DEFAULT 0;
+UPDATE grades SET best_points = acquired_points;
+COMMIT;
@@ -0,0 +1,4 @@
+BEGIN;
+ALTER TABLE courses DROP COLUMN IF EXISTS reply_to;
+ALTER TABLE courses DROP COLUMN IF EXISTS email_from;
+COMMIT;
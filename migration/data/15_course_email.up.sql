@@ -0,0 +1,5 @@
+BEGIN;
+-- sender and reply-to of emails sent to a course (empty uses the server default)
+ALTER TABLE courses ADD COLUMN email_from TEXT NOT NULL DEFAULT '';
+ALTER TABLE courses ADD COLUMN reply_to TEXT NOT NULL DEFAULT '';
+COMMIT;
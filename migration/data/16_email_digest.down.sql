@@ -0,0 +1,4 @@
+BEGIN;
+DROP TABLE IF EXISTS pending_notifications;
+ALTER TABLE users DROP COLUMN IF EXISTS email_digest;
+COMMIT;
@@ -0,0 +1,16 @@
+BEGIN;
+-- users can opt in to receive notifications as a daily summary
+ALTER TABLE users ADD COLUMN email_digest BOOLEAN NOT NULL DEFAULT false;
+
+CREATE TABLE pending_notifications (
+  id SERIAL not null primary key,
+  created_at TIMESTAMP not null DEFAULT current_timestamp,
+  updated_at TIMESTAMP not null DEFAULT current_timestamp,
+
+  user_id INT not null,
+  subject TEXT not null,
+  body TEXT not null,
+
+  FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+COMMIT;
@@ -0,0 +1,3 @@
+BEGIN;
+ALTER TABLE users DROP COLUMN IF EXISTS sessions_revoked_at;
+COMMIT;
@@ -0,0 +1,4 @@
+BEGIN;
+-- refresh tokens and sessions issued before this point in time are invalid
+ALTER TABLE users ADD COLUMN sessions_revoked_at TIMESTAMP;
+COMMIT;
@@ -0,0 +1,3 @@
+BEGIN;
+ALTER TABLE user_course DROP COLUMN IF EXISTS created_at;
+COMMIT;
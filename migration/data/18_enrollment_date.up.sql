@@ -0,0 +1,5 @@
+BEGIN;
+-- the date is unknown for existing enrollments
+ALTER TABLE user_course ADD COLUMN created_at TIMESTAMP;
+ALTER TABLE user_course ALTER COLUMN created_at SET DEFAULT NOW();
+COMMIT;
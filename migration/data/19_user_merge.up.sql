@@ -0,0 +1,4 @@
+BEGIN;
+-- merged duplicates are kept for reference but cannot be used anymore
+ALTER TABLE users ADD COLUMN deleted_at TIMESTAMP;
+COMMIT;
@@ -0,0 +1,4 @@
+BEGIN;
+-- students cannot leave a course on their own after this point in time
+ALTER TABLE courses ADD COLUMN disenroll_until TIMESTAMP;
+COMMIT;
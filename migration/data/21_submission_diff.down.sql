@@ -0,0 +1,4 @@
+BEGIN;
+ALTER TABLE tasks DROP COLUMN IF EXISTS show_diff;
+ALTER TABLE grades DROP COLUMN IF EXISTS public_test_diff;
+COMMIT;
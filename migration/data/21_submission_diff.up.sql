@@ -0,0 +1,5 @@
+BEGIN;
+-- diff between the output of a submission and the reference output of a task
+ALTER TABLE grades ADD COLUMN public_test_diff TEXT NOT NULL DEFAULT '';
+ALTER TABLE tasks ADD COLUMN show_diff BOOLEAN NOT NULL DEFAULT FALSE;
+COMMIT;
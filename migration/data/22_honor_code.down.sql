@@ -0,0 +1,4 @@
+BEGIN;
+ALTER TABLE user_course DROP COLUMN IF EXISTS honor_code_acknowledged_at;
+ALTER TABLE courses DROP COLUMN IF EXISTS honor_code;
+COMMIT;
@@ -0,0 +1,5 @@
+BEGIN;
+-- students have to acknowledge the honor code of a course before submitting
+ALTER TABLE courses ADD COLUMN honor_code TEXT NOT NULL DEFAULT '';
+ALTER TABLE user_course ADD COLUMN honor_code_acknowledged_at TIMESTAMP;
+COMMIT;
@@ -0,0 +1,3 @@
+BEGIN;
+DROP INDEX IF EXISTS users_student_number_key;
+COMMIT;
@@ -0,0 +1,26 @@
+BEGIN;
+-- student numbers identify students in the grade export, hence non-empty ones
+-- have to be unique. Existing duplicates have to be resolved manually (e.g. by
+-- merging the accounts) first. They are reported after each migration and the
+-- index is created once there are none.
+DO $$
+BEGIN
+  IF NOT EXISTS (
+    SELECT
+      student_number
+    FROM
+      users
+    WHERE
+      student_number <> ''
+    AND
+      deleted_at IS NULL
+    GROUP BY
+      student_number
+    HAVING
+      COUNT(*) > 1
+  ) THEN
+    CREATE UNIQUE INDEX users_student_number_key ON users (student_number)
+      WHERE student_number <> '' AND deleted_at IS NULL;
+  END IF;
+END $$;
+COMMIT;
@@ -0,0 +1,5 @@
+BEGIN;
+ALTER TABLE users DROP COLUMN IF EXISTS email_change_reminded_at;
+ALTER TABLE users DROP COLUMN IF EXISTS email_changed_at;
+ALTER TABLE users DROP COLUMN IF EXISTS previous_email;
+COMMIT;
@@ -0,0 +1,6 @@
+BEGIN;
+-- unconfirmed changes of the email address are reverted after a while
+ALTER TABLE users ADD COLUMN previous_email TEXT;
+ALTER TABLE users ADD COLUMN email_changed_at TIMESTAMP;
+ALTER TABLE users ADD COLUMN email_change_reminded_at TIMESTAMP;
+COMMIT;
@@ -0,0 +1,3 @@
+BEGIN;
+ALTER TABLE sheets DROP COLUMN IF EXISTS grades_published;
+COMMIT;
@@ -0,0 +1,4 @@
+BEGIN;
+-- grades of a sheet can be withheld from students until all are graded
+ALTER TABLE sheets ADD COLUMN grades_published BOOLEAN NOT NULL DEFAULT TRUE;
+COMMIT;
@@ -0,0 +1,4 @@
+BEGIN;
+-- descriptions are written in Markdown
+ALTER TABLE tasks ADD COLUMN description TEXT NOT NULL DEFAULT '';
+COMMIT;
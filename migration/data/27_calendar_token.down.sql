@@ -0,0 +1,4 @@
+BEGIN;
+DROP INDEX IF EXISTS users_calendar_token_hash_key;
+ALTER TABLE users DROP COLUMN IF EXISTS calendar_token_hash;
+COMMIT;
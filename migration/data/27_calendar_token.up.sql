@@ -0,0 +1,5 @@
+BEGIN;
+-- calendar apps cannot send bearer tokens, they authenticate by a secret in the feed url
+ALTER TABLE users ADD COLUMN calendar_token_hash TEXT NULL;
+CREATE UNIQUE INDEX users_calendar_token_hash_key ON users (calendar_token_hash);
+COMMIT;
@@ -0,0 +1,5 @@
+BEGIN;
+-- tutors grade without seeing who submitted a solution until the grades of
+-- the sheet are published
+ALTER TABLE courses ADD COLUMN anonymous_grading BOOLEAN NOT NULL DEFAULT FALSE;
+COMMIT;
@@ -0,0 +1,4 @@
+BEGIN;
+-- revoked keys are kept to record when they have been revoked
+ALTER TABLE api_keys ADD COLUMN revoked_at TIMESTAMP;
+COMMIT;
@@ -0,0 +1,3 @@
+BEGIN;
+ALTER TABLE courses DROP COLUMN IF EXISTS email_subject_prefix;
+COMMIT;
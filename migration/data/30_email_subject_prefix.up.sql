@@ -0,0 +1,4 @@
+BEGIN;
+-- prefix of the subjects of emails sent to a course (empty uses the server default)
+ALTER TABLE courses ADD COLUMN email_subject_prefix TEXT NOT NULL DEFAULT '';
+COMMIT;
@@ -0,0 +1,13 @@
+BEGIN;
+-- hashes of previous passwords, such that they cannot be used again
+CREATE TABLE password_history (
+  id SERIAL not null primary key,
+  created_at TIMESTAMP not null DEFAULT current_timestamp,
+
+  user_id INT not null,
+  encrypted_password TEXT not null,
+
+  FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+CREATE INDEX password_history_user_id_idx ON password_history (user_id);
+COMMIT;
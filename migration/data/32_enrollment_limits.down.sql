@@ -0,0 +1,5 @@
+BEGIN;
+ALTER TABLE courses DROP COLUMN IF EXISTS max_students;
+ALTER TABLE courses DROP COLUMN IF EXISTS enrollment_ends_at;
+ALTER TABLE courses DROP COLUMN IF EXISTS enrollment_begins_at;
+COMMIT;
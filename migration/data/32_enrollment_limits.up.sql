@@ -0,0 +1,7 @@
+BEGIN;
+-- students can only enroll themselves within the window (open ends are unlimited)
+ALTER TABLE courses ADD COLUMN enrollment_begins_at TIMESTAMP NULL;
+ALTER TABLE courses ADD COLUMN enrollment_ends_at TIMESTAMP NULL;
+-- 0 allows any number of students
+ALTER TABLE courses ADD COLUMN max_students INT NOT NULL DEFAULT 0;
+COMMIT;
@@ -0,0 +1,4 @@
+BEGIN;
+-- students have to know the code to enroll themselves (NULL allows everyone)
+ALTER TABLE courses ADD COLUMN enrollment_code TEXT NULL;
+COMMIT;
@@ -0,0 +1,3 @@
+BEGIN;
+ALTER TABLE submissions DROP COLUMN IF EXISTS filename;
+COMMIT;
@@ -0,0 +1,4 @@
+BEGIN;
+-- name of the uploaded file (empty for submissions uploaded before)
+ALTER TABLE submissions ADD COLUMN filename TEXT NOT NULL DEFAULT '';
+COMMIT;
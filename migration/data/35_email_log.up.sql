@@ -0,0 +1,17 @@
+BEGIN;
+-- metadata of emails sent to single users (without bodies)
+CREATE TABLE email_logs (
+  id SERIAL not null primary key,
+  created_at TIMESTAMP not null DEFAULT current_timestamp,
+  updated_at TIMESTAMP not null DEFAULT current_timestamp,
+
+  user_id INT not null,
+  kind TEXT not null,
+  email TEXT not null,
+  -- 0: queued, 1: sent, 2: failed
+  state INT not null DEFAULT 0,
+
+  FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+CREATE INDEX email_logs_user_id_idx ON email_logs (user_id);
+COMMIT;
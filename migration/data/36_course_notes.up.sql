@@ -0,0 +1,15 @@
+BEGIN;
+CREATE TABLE course_notes (
+  id SERIAL not null primary key,
+  created_at TIMESTAMP not null DEFAULT current_timestamp,
+  updated_at TIMESTAMP not null DEFAULT current_timestamp,
+
+  course_id INT not null,
+  title TEXT not null,
+  body TEXT not null DEFAULT '',
+  -- notes are listed by ascending ordering
+  ordering INT not null DEFAULT 0,
+
+  FOREIGN KEY (course_id) REFERENCES courses (id) ON DELETE CASCADE
+);
+COMMIT;
@@ -0,0 +1,16 @@
+BEGIN;
+CREATE TABLE sheet_extensions (
+  id SERIAL not null primary key,
+  created_at TIMESTAMP not null DEFAULT current_timestamp,
+  updated_at TIMESTAMP not null DEFAULT current_timestamp,
+
+  sheet_id INT not null,
+  user_id INT not null,
+  -- replaces the due date of the sheet for this user
+  due_at TIMESTAMP not null,
+
+  FOREIGN KEY (sheet_id) REFERENCES sheets (id) ON DELETE CASCADE,
+  FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE,
+  UNIQUE (sheet_id, user_id)
+);
+COMMIT;
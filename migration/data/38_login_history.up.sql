@@ -0,0 +1,12 @@
+BEGIN;
+-- successful logins of users, only recorded if enabled
+CREATE TABLE login_history (
+  id SERIAL not null primary key,
+  created_at TIMESTAMP not null DEFAULT current_timestamp,
+
+  user_id INT not null,
+
+  FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+CREATE INDEX login_history_user_id_idx ON login_history (user_id);
+COMMIT;
@@ -0,0 +1,4 @@
+BEGIN;
+-- directory entry of LDAP accounts, NULL for accounts not linked to the directory
+ALTER TABLE users ADD COLUMN ldap_dn TEXT NULL;
+COMMIT;
@@ -0,0 +1,6 @@
+BEGIN;
+-- the secret is stored encrypted, recovery codes are stored hashed
+ALTER TABLE users ADD COLUMN totp_secret TEXT NULL;
+ALTER TABLE users ADD COLUMN totp_enabled BOOLEAN not null DEFAULT FALSE;
+ALTER TABLE users ADD COLUMN totp_recovery_codes TEXT not null DEFAULT '';
+COMMIT;
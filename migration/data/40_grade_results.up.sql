@@ -0,0 +1,15 @@
+BEGIN;
+-- points of every automated test of a grade, the best points are derived from
+-- them
+CREATE TABLE grade_results (
+  id SERIAL not null primary key,
+  created_at TIMESTAMP not null DEFAULT current_timestamp,
+
+  grade_id INT not null,
+  points INT not null,
+
+  FOREIGN KEY (grade_id) REFERENCES grades (id) ON DELETE CASCADE
+);
+CREATE INDEX grade_results_grade_id_idx ON grade_results (grade_id);
+INSERT INTO grade_results (grade_id, points) SELECT id, best_points FROM grades WHERE best_points > 0;
+COMMIT;
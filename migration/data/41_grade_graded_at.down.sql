@@ -0,0 +1,3 @@
+BEGIN;
+ALTER TABLE grades DROP COLUMN IF EXISTS graded_at;
+COMMIT;
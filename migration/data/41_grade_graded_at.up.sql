@@ -0,0 +1,5 @@
+BEGIN;
+-- time a tutor graded the submission, NULL while only background workers did
+ALTER TABLE grades ADD COLUMN graded_at TIMESTAMP NULL;
+UPDATE grades SET graded_at = updated_at WHERE feedback <> '';
+COMMIT;
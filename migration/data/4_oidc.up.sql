@@ -0,0 +1,4 @@
+BEGIN;
+-- subject of the identity provider, NULL for password-only accounts
+ALTER TABLE users ADD COLUMN oidc_subject TEXT NULL;
+COMMIT;
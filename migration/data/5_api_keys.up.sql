@@ -0,0 +1,16 @@
+BEGIN;
+CREATE TABLE api_keys (
+  id SERIAL not null primary key,
+  created_at TIMESTAMP not null DEFAULT current_timestamp,
+  updated_at TIMESTAMP not null DEFAULT current_timestamp,
+
+  user_id INT not null,
+  name TEXT not null,
+  -- only the hash of the key is stored
+  key_hash TEXT not null UNIQUE,
+  -- "read" or "write"
+  scope TEXT not null DEFAULT 'read',
+
+  FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+COMMIT;
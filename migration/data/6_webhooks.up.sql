@@ -0,0 +1,16 @@
+BEGIN;
+CREATE TABLE webhooks (
+  id SERIAL not null primary key,
+  created_at TIMESTAMP not null DEFAULT current_timestamp,
+  updated_at TIMESTAMP not null DEFAULT current_timestamp,
+
+  course_id INT not null,
+  url TEXT not null,
+  -- comma separated list of event types
+  events TEXT not null,
+  -- used to sign the payloads (HMAC-SHA256)
+  secret TEXT not null,
+
+  FOREIGN KEY (course_id) REFERENCES courses (id) ON DELETE CASCADE
+);
+COMMIT;
@@ -0,0 +1,4 @@
+BEGIN;
+-- wall-clock limit for grading containers, 0 uses the default of the worker
+ALTER TABLE tasks ADD COLUMN timeout_seconds INT NOT NULL DEFAULT 0;
+COMMIT;
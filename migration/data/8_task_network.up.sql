@@ -0,0 +1,4 @@
+BEGIN;
+-- grading containers are isolated from the network unless allowed explicitly
+ALTER TABLE tasks ADD COLUMN allow_network BOOLEAN NOT NULL DEFAULT FALSE;
+COMMIT;
@@ -0,0 +1,4 @@
+BEGIN;
+ALTER TABLE grades DROP COLUMN IF EXISTS enqueued_at;
+ALTER TABLE grades DROP COLUMN IF EXISTS tested_at;
+COMMIT;
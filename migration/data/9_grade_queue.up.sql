@@ -0,0 +1,5 @@
+BEGIN;
+-- when the tests of a grade were (re-)enqueued and last reported by a worker
+ALTER TABLE grades ADD COLUMN enqueued_at TIMESTAMP NULL;
+ALTER TABLE grades ADD COLUMN tested_at TIMESTAMP NULL;
+COMMIT;
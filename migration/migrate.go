@@ -77,4 +77,48 @@ func UpdateDatabase(db *sqlx.DB, log *logrus.Logger) {
 		"dirty":                   dirty,
 	}).Info("after migration")
 
+	enforceUniqueStudentNumbers(db, log)
+}
+
+// enforceUniqueStudentNumbers reports accounts sharing a student number. The
+// unique index on student numbers can only be created once there are none,
+// which might happen long after the migration introducing it.
+func enforceUniqueStudentNumbers(db *sqlx.DB, log *logrus.Logger) {
+	duplicates := []struct {
+		StudentNumber string `db:"student_number"`
+		UserIDs       string `db:"user_ids"`
+	}{}
+
+	err := db.Select(&duplicates, `
+SELECT
+  student_number,
+  string_agg(id::text, ', ' ORDER BY id) user_ids
+FROM
+  users
+WHERE
+  student_number <> ''
+AND
+  deleted_at IS NULL
+GROUP BY
+  student_number
+HAVING
+  COUNT(*) > 1`)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	for _, duplicate := range duplicates {
+		log.WithFields(logrus.Fields{
+			"student_number": duplicate.StudentNumber,
+			"user_ids":       duplicate.UserIDs,
+		}).Warn("student number is not unique, please merge or edit these accounts")
+	}
+
+	if len(duplicates) == 0 {
+		if _, err := db.Exec(`
+CREATE UNIQUE INDEX IF NOT EXISTS users_student_number_key ON users (student_number)
+  WHERE student_number <> '' AND deleted_at IS NULL`); err != nil {
+			log.Fatal(err)
+		}
+	}
 }
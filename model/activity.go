@@ -0,0 +1,35 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package model
+
+import (
+	"time"
+
+	null "gopkg.in/guregu/null.v3"
+)
+
+// Activity is a single entry of the timeline of a user. Depending on the kind
+// ("submission", "enrollment" or "login") the course and task are unset.
+type Activity struct {
+	Kind       string      `db:"kind"`
+	OccurredAt time.Time   `db:"occurred_at"`
+	CourseID   null.Int    `db:"course_id"`
+	CourseName null.String `db:"course_name"`
+	TaskID     null.Int    `db:"task_id"`
+	TaskName   null.String `db:"task_name"`
+}
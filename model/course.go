@@ -21,6 +21,8 @@ package model
 
 import (
 	"time"
+
+	null "gopkg.in/guregu/null.v3"
 )
 
 // Course holds specific application settings linked to an entity, which
@@ -30,9 +32,58 @@ type Course struct {
 	CreatedAt time.Time `db:"created_at,omitempty"`
 	UpdatedAt time.Time `db:"updated_at,omitempty"`
 
-	Name               string    `db:"name"`
-	Description        string    `db:"description"`
-	BeginsAt           time.Time `db:"begins_at"`
-	EndsAt             time.Time `db:"ends_at"`
-	RequiredPercentage int       `db:"required_percentage"`
+	Name                    string    `db:"name"`
+	Description             string    `db:"description"`
+	BeginsAt                time.Time `db:"begins_at"`
+	EndsAt                  time.Time `db:"ends_at"`
+	RequiredPercentage      int       `db:"required_percentage"`
+	SubmissionRetentionDays int       `db:"submission_retention_days"`
+	EmailFrom               string    `db:"email_from"`
+	ReplyTo                 string    `db:"reply_to"`
+	// EmailSubjectPrefix replaces the server-wide subject prefix of emails
+	// sent to the course if it is not empty.
+	EmailSubjectPrefix string `db:"email_subject_prefix"`
+	// DisenrollUntil ends the period in which students can leave the course
+	// on their own. There is no such limit if it is not set.
+	DisenrollUntil null.Time `db:"disenroll_until"`
+	// HonorCode has to be acknowledged by students before they can submit
+	// solutions. There is no such requirement if it is empty.
+	HonorCode string `db:"honor_code"`
+	// AnonymousGrading hides the identities of students from tutors until
+	// the grades of the sheet are published.
+	AnonymousGrading bool `db:"anonymous_grading"`
+	// Students can enroll themselves between EnrollmentBeginsAt and
+	// EnrollmentEndsAt, a missing bound does not limit the period.
+	EnrollmentBeginsAt null.Time `db:"enrollment_begins_at"`
+	EnrollmentEndsAt   null.Time `db:"enrollment_ends_at"`
+	// MaxStudents limits the number of enrolled students if it is not 0.
+	MaxStudents int `db:"max_students"`
+	// EnrollmentCode has to be given by students to enroll themselves if it
+	// is set.
+	EnrollmentCode null.String `db:"enrollment_code"`
+}
+
+// EnrollmentIsOpen tests whether students can enroll themselves at the given
+// time.
+func (m *Course) EnrollmentIsOpen(now time.Time) bool {
+	if m.EnrollmentBeginsAt.Valid && now.Before(m.EnrollmentBeginsAt.Time) {
+		return false
+	}
+	return !m.EnrollmentEndsAt.Valid || now.Before(m.EnrollmentEndsAt.Time)
+}
+
+// CourseDashboard summarizes the enrollments and submissions of a course.
+type CourseDashboard struct {
+	Students      int     `db:"students"`
+	Tutors        int     `db:"tutors"`
+	Admins        int     `db:"admins"`
+	Submissions   int     `db:"submissions"`
+	Ungraded      int     `db:"ungraded"`
+	AveragePoints float32 `db:"average_points"`
+}
+
+// SubmissionVolume is the number of submissions created on a day.
+type SubmissionVolume struct {
+	Day   time.Time `db:"day"`
+	Count int       `db:"count"`
 }
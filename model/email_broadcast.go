@@ -0,0 +1,73 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package model
+
+import (
+	"time"
+)
+
+// EmailBroadcast is an email sent to several members of a course at once.
+type EmailBroadcast struct {
+	ID        int64     `db:"id"`
+	CreatedAt time.Time `db:"created_at,omitempty"`
+	UpdatedAt time.Time `db:"updated_at,omitempty"`
+
+	CourseID int64  `db:"course_id"`
+	SenderID int64  `db:"sender_id"`
+	Subject  string `db:"subject"`
+}
+
+// EmailDelivery tracks the state of a broadcast for a single recipient.
+type EmailDelivery struct {
+	ID        int64     `db:"id"`
+	CreatedAt time.Time `db:"created_at,omitempty"`
+	UpdatedAt time.Time `db:"updated_at,omitempty"`
+
+	BroadcastID int64  `db:"broadcast_id"`
+	Email       string `db:"email"`
+	State       int    `db:"state"`
+	Error       string `db:"error"`
+}
+
+// Kinds of emails recorded in the email log of a user.
+const (
+	EmailKindConfirmEmail        = "confirm_email"
+	EmailKindPasswordReset       = "password_reset"
+	EmailKindEmailChangeReminder = "email_change_reminder"
+	EmailKindMessage             = "message"
+)
+
+// EmailLogEntry records an email sent to a single user. Only the metadata is
+// kept, not the body.
+type EmailLogEntry struct {
+	ID        int64     `db:"id"`
+	CreatedAt time.Time `db:"created_at,omitempty"`
+	UpdatedAt time.Time `db:"updated_at,omitempty"`
+
+	UserID int64  `db:"user_id"`
+	Kind   string `db:"kind"`
+	Email  string `db:"email"`
+	State  int    `db:"state"`
+}
+
+// EmailBroadcastStatus summarizes the deliveries of a broadcast.
+type EmailBroadcastStatus struct {
+	Queued int `db:"queued"`
+	Sent   int `db:"sent"`
+	Failed int `db:"failed"`
+}
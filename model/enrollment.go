@@ -43,4 +43,7 @@ type UserCourse struct {
 	Semester      int         `db:"semester"`
 	Subject       string      `db:"subject"`
 	Language      string      `db:"language"`
+	// EnrolledAt is unknown for enrollments created before it was recorded
+	EnrolledAt              null.Time `db:"enrolled_at"`
+	HonorCodeAcknowledgedAt null.Time `db:"honor_code_acknowledged_at"`
 }
@@ -21,6 +21,8 @@ package model
 
 import (
 	"time"
+
+	null "gopkg.in/guregu/null.v3"
 )
 
 // -- 0: pending, 1: running, 2: finished
@@ -33,20 +35,40 @@ type Grade struct {
 	CreatedAt time.Time `db:"created_at,omitempty"`
 	UpdatedAt time.Time `db:"updated_at,omitempty"`
 
-	PublicExecutionState  int    `db:"public_execution_state"`
-	PrivateExecutionState int    `db:"private_execution_state"`
-	PublicTestLog         string `db:"public_test_log"`
-	PrivateTestLog        string `db:"private_test_log"`
-	PublicTestStatus      int    `db:"public_test_status"`
-	PrivateTestStatus     int    `db:"private_test_status"`
-	AcquiredPoints        int    `db:"acquired_points"`
-	Feedback              string `db:"feedback"`
-	TutorID               int64  `db:"tutor_id"`
-	SubmissionID          int64  `db:"submission_id"`
-	UserID                int64  `db:"user_id,readonly"`
-	UserFirstName         string `db:"user_first_name,readonly"`
-	UserLastName          string `db:"user_last_name,readonly"`
-	UserEmail             string `db:"user_email,readonly"`
+	PublicExecutionState  int       `db:"public_execution_state"`
+	PrivateExecutionState int       `db:"private_execution_state"`
+	PublicTestLog         string    `db:"public_test_log"`
+	PrivateTestLog        string    `db:"private_test_log"`
+	PublicTestDiff        string    `db:"public_test_diff"`
+	PublicTestStatus      int       `db:"public_test_status"`
+	PrivateTestStatus     int       `db:"private_test_status"`
+	AcquiredPoints        int       `db:"acquired_points"`
+	BestPoints            int       `db:"best_points"`
+	Feedback              string    `db:"feedback"`
+	TutorID               int64     `db:"tutor_id"`
+	SubmissionID          int64     `db:"submission_id"`
+	EnqueuedAt            null.Time `db:"enqueued_at"`
+	TestedAt              null.Time `db:"tested_at"`
+	GradedAt              null.Time `db:"graded_at"`
+	UserID                int64     `db:"user_id,readonly"`
+	TaskID                int64     `db:"task_id,readonly"`
+	UserFirstName         string    `db:"user_first_name,readonly"`
+	UserLastName          string    `db:"user_last_name,readonly"`
+	UserEmail             string    `db:"user_email,readonly"`
+}
+
+// GradeTestCase is the outcome of a single test case of an automated test
+// ("public" or "private") reported by a background worker.
+type GradeTestCase struct {
+	ID        int64     `db:"id"`
+	CreatedAt time.Time `db:"created_at,omitempty"`
+	UpdatedAt time.Time `db:"updated_at,omitempty"`
+
+	GradeID int64  `db:"grade_id"`
+	Kind    string `db:"kind"`
+	Name    string `db:"name"`
+	Passed  bool   `db:"passed"`
+	Hidden  bool   `db:"hidden"`
 }
 
 // MissingGrade is a database view containing all grades which are finished
@@ -71,3 +93,12 @@ type OverviewGrade struct {
 	Name    string `db:"name"`
 	Points  int    `db:"points"`
 }
+
+// GradeBookEntry are the points a student acquired in a task of a course
+// according to the scoring policy of the task.
+type GradeBookEntry struct {
+	UserID  int64 `db:"user_id"`
+	SheetID int64 `db:"sheet_id"`
+	TaskID  int64 `db:"task_id"`
+	Points  int   `db:"points"`
+}
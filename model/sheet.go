@@ -30,9 +30,12 @@ type Sheet struct {
 	CreatedAt time.Time `db:"created_at,omitempty"`
 	UpdatedAt time.Time `db:"updated_at,omitempty"`
 
-	Name      string    `db:"name"`
-	PublishAt time.Time `db:"publish_at"`
-	DueAt     time.Time `db:"due_at"`
+	Name          string    `db:"name"`
+	PublishAt     time.Time `db:"publish_at"`
+	DueAt         time.Time `db:"due_at"`
+	ScoringPolicy string    `db:"scoring_policy"`
+	// GradesPublished is false while students should not see their points yet.
+	GradesPublished bool `db:"grades_published"`
 }
 
 // SheetPoints contains the performance of a specific student
@@ -40,4 +43,26 @@ type SheetPoints struct {
 	AquiredPoints int `db:"acquired_points"`
 	MaxPoints     int `db:"max_points"`
 	SheetID       int `db:"sheet_id"`
+
+	GradesPublished bool `db:"grades_published"`
+}
+
+// Deadline is the due date of a sheet in one of the courses of a user.
+type Deadline struct {
+	CourseID   int64     `db:"course_id"`
+	CourseName string    `db:"course_name"`
+	SheetID    int64     `db:"sheet_id"`
+	SheetName  string    `db:"sheet_name"`
+	DueAt      time.Time `db:"due_at"`
+}
+
+// SheetExtension postpones the due date of a sheet for a single user.
+type SheetExtension struct {
+	ID        int64     `db:"id"`
+	CreatedAt time.Time `db:"created_at,omitempty"`
+	UpdatedAt time.Time `db:"updated_at,omitempty"`
+
+	SheetID int64     `db:"sheet_id"`
+	UserID  int64     `db:"user_id"`
+	DueAt   time.Time `db:"due_at"`
 }
@@ -32,4 +32,24 @@ type Submission struct {
 
 	UserID int64 `db:"user_id"`
 	TaskID int64 `db:"task_id"`
+	// Filename is the name of the latest uploaded file.
+	Filename string `db:"filename"`
+}
+
+// SubmissionWithStatus is a submission together with the state of its
+// grading ("pending", "graded" or "error").
+type SubmissionWithStatus struct {
+	Submission
+
+	Status string `db:"status"`
+}
+
+// UserSubmission is a submission together with the student who uploaded it.
+type UserSubmission struct {
+	Submission
+
+	FirstName     string `db:"first_name"`
+	LastName      string `db:"last_name"`
+	Email         string `db:"email"`
+	StudentNumber string `db:"student_number"`
 }
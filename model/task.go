@@ -36,6 +36,11 @@ type Task struct {
 	MaxPoints          int         `db:"max_points"`
 	PublicDockerImage  null.String `db:"public_docker_image"`
 	PrivateDockerImage null.String `db:"private_docker_image"`
+	TimeoutSeconds     int         `db:"timeout_seconds"`
+	AllowNetwork       bool        `db:"allow_network"`
+	ShowDiff           bool        `db:"show_diff"`
+	ScoringPolicy      null.String `db:"scoring_policy"`
+	Description        string      `db:"description"`
 }
 
 // TaskRating contains the feedback of students to a task.
@@ -89,3 +94,35 @@ type MissingTask struct {
 	SheetID  int64 `db:"sheet_id"`
 	CourseID int64 `db:"course_id"`
 }
+
+// TaskStatus is the state of the latest submission of a student for a task
+// (this is used when listing the tasks of a sheet)
+type TaskStatus struct {
+	*Task
+
+	SubmissionID   null.Int `db:"submission_id"`
+	AcquiredPoints null.Int `db:"acquired_points"`
+}
+
+// TaskSummary aggregates the submissions of all students for a task
+type TaskSummary struct {
+	*Task
+
+	Submissions   int     `db:"submissions"`
+	AveragePoints float32 `db:"average_points"`
+}
+
+// TaskStatistics summarizes the latest submissions of all students for a task
+type TaskStatistics struct {
+	MaxPoints    int     `db:"max_points"`
+	Submissions  int     `db:"submissions"`
+	Passed       int     `db:"passed"`
+	MeanPoints   float32 `db:"mean_points"`
+	MedianPoints float32 `db:"median_points"`
+}
+
+// TaskPointsBin is a bin in the histogram of acquired points for a task
+type TaskPointsBin struct {
+	Points int `db:"points"`
+	Count  int `db:"count"`
+}
@@ -45,6 +45,43 @@ type User struct {
 	ResetPasswordToken null.String `db:"reset_password_token"`
 	ConfirmEmailToken  null.String `db:"confirm_email_token"`
 	Root               bool        `db:"root"`
+
+	// PreviousEmail is restored if a change of the email address is not
+	// confirmed in time.
+	PreviousEmail         null.String `db:"previous_email"`
+	EmailChangedAt        null.Time   `db:"email_changed_at"`
+	EmailChangeRemindedAt null.Time   `db:"email_change_reminded_at"`
+
+	TOTPSecret        null.String `db:"totp_secret"`
+	TOTPEnabled       bool        `db:"totp_enabled"`
+	TOTPRecoveryCodes string      `db:"totp_recovery_codes"`
+
+	OIDCSubject null.String `db:"oidc_subject"`
+	LDAPDN      null.String `db:"ldap_dn"`
+
+	EmailDigest bool `db:"email_digest"`
+
+	SessionsRevokedAt null.Time `db:"sessions_revoked_at"`
+
+	// CalendarTokenHash authenticates the calendar feed of the deadlines
+	CalendarTokenHash null.String `db:"calendar_token_hash"`
+
+	// DeletedAt is set for accounts which have been merged into another one
+	DeletedAt null.Time `db:"deleted_at"`
+}
+
+// SessionRevoked tests whether a token or session issued at the given unix
+// time has been revoked by logging out from all devices.
+func (m *User) SessionRevoked(issuedAt int64) bool {
+	return m.SessionsRevokedAt.Valid && issuedAt <= m.SessionsRevokedAt.Time.Unix()
+}
+
+// ClearPendingEmailChange forgets about an unconfirmed change of the email
+// address, e.g. because it has been confirmed.
+func (m *User) ClearPendingEmailChange() {
+	m.PreviousEmail = null.String{}
+	m.EmailChangedAt = null.Time{}
+	m.EmailChangeRemindedAt = null.Time{}
 }
 
 // FullName is a wrapper for returning the fullname of a user
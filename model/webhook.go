@@ -0,0 +1,54 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package model
+
+import (
+	"strings"
+	"time"
+)
+
+// Webhook is a subscription of an external URL to events of a course.
+type Webhook struct {
+	ID        int64     `db:"id"`
+	CreatedAt time.Time `db:"created_at,omitempty"`
+	UpdatedAt time.Time `db:"updated_at,omitempty"`
+
+	CourseID int64  `db:"course_id"`
+	URL      string `db:"url"`
+	Events   string `db:"events"`
+	Secret   string `db:"secret"`
+}
+
+// EventList returns the subscribed events.
+func (p *Webhook) EventList() []string {
+	if p.Events == "" {
+		return []string{}
+	}
+	return strings.Split(p.Events, ",")
+}
+
+// Subscribes tests whether the webhook listens to an event.
+func (p *Webhook) Subscribes(event string) bool {
+	for _, candidate := range p.EventList() {
+		if candidate == event {
+			return true
+		}
+	}
+	return false
+}
@@ -36,6 +36,8 @@ import (
 type DockerService struct {
 	Client  *client.Client
 	Timeout time.Duration
+	// AllowNetwork gives containers network access (disabled by default)
+	AllowNetwork bool
 }
 
 func NewDockerServiceWithTimeout(timeout time.Duration) (*DockerService, error) {
@@ -100,6 +102,62 @@ func (ds *DockerService) Pull(image string) (string, error) {
 
 }
 
+// ErrTimeout is returned when a container exceeds its wall-clock timeout.
+var ErrTimeout = errors.New("execution took too long")
+
+// ContainerRunner abstracts the lifecycle of a single grading container.
+type ContainerRunner interface {
+	Create(ctx context.Context, imageName string, submissionZipFile string, frameworkZipFile string, memoryBytes int64) (string, error)
+	Start(ctx context.Context, id string) error
+	Wait(ctx context.Context, id string) error
+	Logs(ctx context.Context, id string) (string, error)
+	Kill(id string) error
+	Remove(id string) error
+}
+
+// RunContainer creates and starts a container and waits for its output.
+// Containers exceeding the timeout are killed and ErrTimeout is returned.
+// The container is removed in any case.
+func RunContainer(
+	runner ContainerRunner,
+	imageName string,
+	submissionZipFile string,
+	frameworkZipFile string,
+	memoryBytes int64,
+	timeout time.Duration,
+) (string, int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	id, err := runner.Create(ctx, imageName, submissionZipFile, frameworkZipFile, memoryBytes)
+	if err != nil {
+		return "", 0, err
+	}
+
+	// the context might be expired already, hence removing uses its own
+	defer runner.Remove(id)
+
+	if err := runner.Start(ctx, id); err != nil {
+		return "", 0, err
+	}
+
+	if err := runner.Wait(ctx, id); err != nil {
+		if errors.Is(err, context.DeadlineExceeded) || ctx.Err() == context.DeadlineExceeded {
+			// the container survives the cancelled context, we kill it
+			runner.Kill(id)
+			return ErrTimeout.Error(), 0, ErrTimeout
+		}
+		return err.Error(), 0, err
+	}
+
+	stdout, err := runner.Logs(ctx, id)
+	if err != nil {
+		return "", 0, err
+	}
+
+	return stdout, 0, nil
+}
+
 // Run executes a docker container and waits for the output
 func (ds *DockerService) Run(
 	imageName string,
@@ -107,10 +165,41 @@ func (ds *DockerService) Run(
 	frameworkZipFile string,
 	DockerMemoryBytes int64,
 ) (string, int64, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), ds.Timeout)
-	defer cancel()
+	return RunContainer(ds, imageName, submissionZipFile, frameworkZipFile, DockerMemoryBytes, ds.Timeout)
+}
+
+// Create creates a container testing the submission with the framework.
+func (ds *DockerService) Create(
+	ctx context.Context,
+	imageName string,
+	submissionZipFile string,
+	frameworkZipFile string,
+	DockerMemoryBytes int64,
+) (string, error) {
+	cfg, hostCfg := ds.containerConfig(imageName, submissionZipFile, frameworkZipFile, DockerMemoryBytes)
+
+	resp, err := ds.Client.ContainerCreate(ctx, cfg, hostCfg, nil, "")
+	if err != nil {
+		return "", err
+	}
+	return resp.ID, nil
+}
+
+// containerConfig describes the container testing the submission with the framework.
+func (ds *DockerService) containerConfig(
+	imageName string,
+	submissionZipFile string,
+	frameworkZipFile string,
+	DockerMemoryBytes int64,
+) (*container.Config, *container.HostConfig) {
 	cmds := []string{}
 
+	// student code should neither phone home nor download packages
+	networkMode := "none"
+	if ds.AllowNetwork {
+		networkMode = "default"
+	}
+
 	cfg := &container.Config{
 		Image:           imageName,
 		Cmd:             cmds,
@@ -118,7 +207,7 @@ func (ds *DockerService) Run(
 		AttachStdin:     false,
 		AttachStdout:    true,
 		AttachStderr:    true,
-		NetworkDisabled: true, // no network activity required
+		NetworkDisabled: !ds.AllowNetwork,
 	}
 
 	// See https://docs.docker.com/config/containers/resource_constraints/#cpu
@@ -127,6 +216,7 @@ func (ds *DockerService) Run(
 	cpu_maximum := int64(100000)
 
 	hostCfg := &container.HostConfig{
+		NetworkMode: container.NetworkMode(networkMode),
 		Resources: container.Resources{
 			CPUPeriod:  cpu_maximum,
 			CPUQuota:   cpu_maximum,
@@ -149,38 +239,44 @@ func (ds *DockerService) Run(
 		},
 	}
 
-	resp, err := ds.Client.ContainerCreate(ctx, cfg, hostCfg, nil, "")
-	if err != nil {
-		return "", 0, err
-	}
-
-	defer ds.Client.ContainerRemove(ctx, resp.ID, types.ContainerRemoveOptions{})
+	return cfg, hostCfg
+}
 
-	if err := ds.Client.ContainerStart(ctx, resp.ID, types.ContainerStartOptions{}); err != nil {
-		return "", 0, err
-	}
+// Start starts a created container.
+func (ds *DockerService) Start(ctx context.Context, id string) error {
+	return ds.Client.ContainerStart(ctx, id, types.ContainerStartOptions{})
+}
 
-	statusCh, errCh := ds.Client.ContainerWait(ctx, resp.ID, "")
+// Wait blocks until the container stops or the context expires.
+func (ds *DockerService) Wait(ctx context.Context, id string) error {
+	statusCh, errCh := ds.Client.ContainerWait(ctx, id, "")
 	select {
 	case err := <-errCh:
-		if errors.Is(err, context.DeadlineExceeded) {
-			// Sometimes the container survive and are still runnning.
-			// We kill these containers.
-			ds.Client.ContainerKill(context.Background(), resp.ID, "9")
-			return "Execution took to long", 0, nil
-
-		}
-		return err.Error(), 0, err
+		return err
 	case <-statusCh:
 	}
+	return nil
+}
 
-	outputReader, err := ds.Client.ContainerLogs(ctx, resp.ID, types.ContainerLogsOptions{ShowStdout: true})
+// Logs returns the stdout of a container.
+func (ds *DockerService) Logs(ctx context.Context, id string) (string, error) {
+	outputReader, err := ds.Client.ContainerLogs(ctx, id, types.ContainerLogsOptions{ShowStdout: true})
 	if err != nil {
-		return "", 0, err
+		return "", err
 	}
 
 	buf := new(bytes.Buffer)
 	buf.ReadFrom(outputReader)
 
-	return buf.String(), 0, nil
+	return buf.String(), nil
+}
+
+// Kill stops a running container immediately.
+func (ds *DockerService) Kill(id string) error {
+	return ds.Client.ContainerKill(context.Background(), id, "9")
+}
+
+// Remove deletes a container even if it is still running.
+func (ds *DockerService) Remove(id string) error {
+	return ds.Client.ContainerRemove(context.Background(), id, types.ContainerRemoveOptions{Force: true})
 }
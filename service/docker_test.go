@@ -0,0 +1,114 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/franela/goblin"
+)
+
+// fakeRunner simulates a container which runs for the given duration.
+type fakeRunner struct {
+	duration time.Duration
+	killed   bool
+	removed  bool
+}
+
+func (r *fakeRunner) Create(ctx context.Context, imageName string, submissionZipFile string, frameworkZipFile string, memoryBytes int64) (string, error) {
+	return "container", nil
+}
+
+func (r *fakeRunner) Start(ctx context.Context, id string) error { return nil }
+
+func (r *fakeRunner) Wait(ctx context.Context, id string) error {
+	select {
+	case <-time.After(r.duration):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (r *fakeRunner) Logs(ctx context.Context, id string) (string, error) {
+	return "all tests passed", nil
+}
+
+func (r *fakeRunner) Kill(id string) error {
+	r.killed = true
+	return nil
+}
+
+func (r *fakeRunner) Remove(id string) error {
+	r.removed = true
+	return nil
+}
+
+func TestRunContainer(t *testing.T) {
+	g := goblin.Goblin(t)
+
+	g.Describe("RunContainer", func() {
+
+		g.It("Should return the output of finished containers", func() {
+			runner := &fakeRunner{duration: time.Millisecond}
+
+			stdout, exit, err := RunContainer(runner, "image", "submission.zip", "framework.zip", 0, time.Second)
+			g.Assert(err).Equal(nil)
+			g.Assert(stdout).Equal("all tests passed")
+			g.Assert(exit).Equal(int64(0))
+			g.Assert(runner.killed).IsFalse()
+			g.Assert(runner.removed).IsTrue()
+		})
+
+		g.It("Should kill and remove containers exceeding the timeout", func() {
+			runner := &fakeRunner{duration: time.Minute}
+
+			start := time.Now()
+			_, _, err := RunContainer(runner, "image", "submission.zip", "framework.zip", 0, 50*time.Millisecond)
+			g.Assert(err).Equal(ErrTimeout)
+			g.Assert(time.Since(start) < time.Second).IsTrue()
+			g.Assert(runner.killed).IsTrue()
+			g.Assert(runner.removed).IsTrue()
+		})
+
+	})
+
+	g.Describe("DockerService", func() {
+
+		g.It("Should isolate containers from the network by default", func() {
+			ds := &DockerService{}
+
+			cfg, hostCfg := ds.containerConfig("image", "submission.zip", "framework.zip", 1024)
+			g.Assert(cfg.NetworkDisabled).IsTrue()
+			g.Assert(hostCfg.NetworkMode.IsNone()).IsTrue()
+			g.Assert(hostCfg.Resources.Memory).Equal(int64(1024))
+		})
+
+		g.It("Should give network access if allowed", func() {
+			ds := &DockerService{AllowNetwork: true}
+
+			cfg, hostCfg := ds.containerConfig("image", "submission.zip", "framework.zip", 1024)
+			g.Assert(cfg.NetworkDisabled).IsFalse()
+			g.Assert(hostCfg.NetworkMode.IsNone()).IsFalse()
+			g.Assert(hostCfg.NetworkMode.IsDefault()).IsTrue()
+		})
+
+	})
+}
@@ -38,6 +38,9 @@ const (
 	CtxKeySheet        key = iota
 	CtxKeyGrade        key = iota
 	CtxKeyExam         key = iota
+	CtxKeyAccessLog    key = iota
+	CtxKeyEnvelopeMeta key = iota
+	CtxKeyFields       key = iota
 	// ...
 )
 
@@ -50,11 +53,21 @@ const (
 	TestingStateFinished testingState = 2 // submission test has finished
 )
 
+// EmailDeliveryState is the state of an email sent to a single recipient.
+type EmailDeliveryState int
+
+const (
+	EmailDeliveryQueued EmailDeliveryState = 0 // email waits in the outgoing queue
+	EmailDeliverySent   EmailDeliveryState = 1 // email was handed to the mailer
+	EmailDeliveryFailed EmailDeliveryState = 2 // mailer returned an error
+)
+
 type TestingResult int64
 
 const (
 	TestingResultSuccess TestingResult = 0 // docker was able to test (but test could have failed)
 	TestingResultFailed  TestingResult = 1 // something went wrong with docker
+	TestingResultTimeout TestingResult = 2 // docker exceeded the timeout and was killed
 
 )
 
@@ -64,3 +77,9 @@ func (t TestingResult) AsInt64() int64 {
 	}
 	return 1
 }
+
+// Scoring policies determine which submission of a student counts for a task.
+const (
+	ScoringPolicyLatest = "latest" // points of the latest submission
+	ScoringPolicyBest   = "best"   // highest points of all submissions
+)
@@ -0,0 +1,118 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package webhook
+
+import (
+	"errors"
+	"net"
+	"net/url"
+	"strings"
+	"syscall"
+)
+
+// AllowPrivateTargets disables the checks against requests to the internal
+// network of the server. It is meant for tests only.
+var AllowPrivateTargets = false
+
+// ErrPrivateTarget is returned for webhook URLs pointing to loopback, private
+// or link-local addresses.
+var ErrPrivateTarget = errors.New("url: must not point to a private or loopback address")
+
+// privateNetworks are the private address spaces (RFC 1918, RFC 4193) and
+// the shared address space (RFC 6598).
+var privateNetworks = []*net.IPNet{
+	{IP: net.IPv4(10, 0, 0, 0), Mask: net.CIDRMask(8, 32)},
+	{IP: net.IPv4(172, 16, 0, 0), Mask: net.CIDRMask(12, 32)},
+	{IP: net.IPv4(192, 168, 0, 0), Mask: net.CIDRMask(16, 32)},
+	{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)},
+	{IP: net.IP{0xfc, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}, Mask: net.CIDRMask(7, 128)},
+}
+
+func isPrivateIP(ip net.IP) bool {
+	for _, network := range privateNetworks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsPublicIP tests whether an address is reachable from the internet, i.e.
+// neither loopback, private, link-local nor unspecified.
+func IsPublicIP(ip net.IP) bool {
+	return !(ip.IsLoopback() ||
+		isPrivateIP(ip) ||
+		ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() ||
+		ip.IsMulticast() ||
+		ip.IsUnspecified())
+}
+
+// ValidateTarget rejects URLs whose host is or resolves to a non-public
+// address. Hosts which cannot be resolved right now are accepted, deliveries
+// to them are checked again when dialling.
+func ValidateTarget(rawURL string) error {
+	if AllowPrivateTargets {
+		return nil
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+
+	host := u.Hostname()
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return ErrPrivateTarget
+	}
+
+	ips := []net.IP{net.ParseIP(host)}
+	if ips[0] == nil {
+		if ips, err = net.LookupIP(host); err != nil {
+			return nil
+		}
+	}
+
+	for _, ip := range ips {
+		if !IsPublicIP(ip) {
+			return ErrPrivateTarget
+		}
+	}
+	return nil
+}
+
+// guardDial is used as net.Dialer.Control and refuses connections to
+// non-public addresses. As it runs after the name resolution, it also covers
+// redirects and DNS entries which changed since the webhook was saved.
+func guardDial(network string, address string, c syscall.RawConn) error {
+	if AllowPrivateTargets {
+		return nil
+	}
+
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil || !IsPublicIP(ip) {
+		return ErrPrivateTarget
+	}
+	return nil
+}
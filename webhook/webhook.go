@@ -0,0 +1,224 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// EventSubmissionGraded is sent when a tutor grades a submission.
+	EventSubmissionGraded = "submission.graded"
+	// EventEnrollmentCreated is sent when a user enrolls into a course.
+	EventEnrollmentCreated = "enrollment.created"
+)
+
+// Events lists all events a webhook can subscribe to.
+var Events = []interface{}{
+	EventSubmissionGraded,
+	EventEnrollmentCreated,
+}
+
+const (
+	// SignatureHeader contains the HMAC-SHA256 of the body.
+	SignatureHeader = "X-InfoMark-Signature"
+	// EventHeader contains the name of the event.
+	EventHeader = "X-InfoMark-Event"
+)
+
+// Delivery is a single POST request to an external URL.
+type Delivery struct {
+	URL     string
+	Secret  string
+	Event   string
+	Payload []byte
+}
+
+// Payload is the JSON body of each delivery.
+type Payload struct {
+	Event     string      `json:"event"`
+	CourseID  int64       `json:"course_id"`
+	CreatedAt time.Time   `json:"created_at"`
+	Data      interface{} `json:"data"`
+}
+
+var OutgoingDeliveriesChannel chan *Delivery
+
+// Workers is the number of deliveries sent concurrently, such that a slow
+// endpoint does not delay the deliveries to all others.
+var Workers = 8
+
+// NewDelivery creates a delivery with the JSON payload for an event.
+func NewDelivery(url string, secret string, event string, courseID int64, data interface{}) (*Delivery, error) {
+	payload, err := json.Marshal(&Payload{
+		Event:     event,
+		CourseID:  courseID,
+		CreatedAt: time.Now(),
+		Data:      data,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &Delivery{
+		URL:     url,
+		Secret:  secret,
+		Event:   event,
+		Payload: payload,
+	}, nil
+}
+
+// Sign computes the signature of a payload, which receivers can verify
+// using the shared secret.
+func Sign(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+type Deliverer interface {
+	Deliver(d *Delivery) error
+}
+
+// HTTPDeliverer POSTs deliveries and retries failed attempts with an
+// exponential backoff.
+type HTTPDeliverer struct {
+	Client  *http.Client
+	Retries int
+	Backoff time.Duration
+}
+
+type VoidDeliverer struct{}
+
+func NewHTTPDeliverer() *HTTPDeliverer {
+	dialer := &net.Dialer{
+		Timeout: 5 * time.Second,
+		Control: guardDial,
+	}
+
+	return &HTTPDeliverer{
+		Client: &http.Client{
+			Timeout:   10 * time.Second,
+			Transport: &http.Transport{DialContext: dialer.DialContext},
+		},
+		Retries: 3,
+		Backoff: time.Second,
+	}
+}
+
+func NewVoidDeliverer() *VoidDeliverer {
+	return &VoidDeliverer{}
+}
+
+var HTTPDelivery = NewHTTPDeliverer()
+
+var VoidDelivery = NewVoidDeliverer()
+
+var DefaultDeliverer Deliverer
+
+func init() {
+	DefaultDeliverer = HTTPDelivery
+	OutgoingDeliveriesChannel = make(chan *Delivery, 300)
+}
+
+func (d *VoidDeliverer) Deliver(delivery *Delivery) error {
+	return nil
+}
+
+func (d *HTTPDeliverer) Deliver(delivery *Delivery) error {
+	var err error
+	backoff := d.Backoff
+
+	for attempt := 0; attempt <= d.Retries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(backoff)
+			backoff = 2 * backoff
+		}
+
+		if err = d.deliverOnce(delivery); err == nil {
+			return nil
+		}
+	}
+
+	return err
+}
+
+func (d *HTTPDeliverer) deliverOnce(delivery *Delivery) error {
+	req, err := http.NewRequest("POST", delivery.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, delivery.Event)
+	req.Header.Set(SignatureHeader, Sign(delivery.Secret, delivery.Payload))
+
+	resp, err := d.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook %s responded with status %d", delivery.URL, resp.StatusCode)
+	}
+	return nil
+}
+
+// Enqueue hands a delivery to the background workers without blocking. If the
+// queue is full, the delivery is dropped and false is returned.
+func Enqueue(delivery *Delivery) bool {
+	select {
+	case OutgoingDeliveriesChannel <- delivery:
+		return true
+	default:
+		return false
+	}
+}
+
+// BackgroundDeliver sends all deliveries from the channel using a fixed
+// number of workers. It returns once the channel is closed and drained.
+func BackgroundDeliver(deliveries <-chan *Delivery) {
+	var wg sync.WaitGroup
+	for k := 0; k < Workers; k++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for delivery := range deliveries {
+				if err := DefaultDeliverer.Deliver(delivery); err != nil {
+					logrus.WithFields(logrus.Fields{
+						"module": "webhook",
+						"event":  delivery.Event,
+					}).Warn(err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,92 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package webhook
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/franela/goblin"
+)
+
+func TestWebhook(t *testing.T) {
+	g := goblin.Goblin(t)
+
+	g.Describe("Webhook", func() {
+
+		g.It("Should sign payloads", func() {
+			// echo -n '{"a":1}' | openssl dgst -sha256 -hmac secret
+			g.Assert(Sign("secret", []byte(`{"a":1}`))).Equal("sha256=aa9e2e3575f5d7098b6caccd790888c36d5fdb63342a73bada2d6a51747a8494")
+		})
+
+		g.It("Should only consider public addresses as targets", func() {
+			for _, ip := range []string{"10.1.2.3", "172.16.0.1", "172.31.255.255", "192.168.1.1",
+				"100.64.0.1", "127.0.0.1", "169.254.1.1", "0.0.0.0", "::1", "fc00::1", "fd12:3456::1", "fe80::1"} {
+				g.Assert(IsPublicIP(net.ParseIP(ip))).IsFalse()
+			}
+			for _, ip := range []string{"8.8.8.8", "172.32.0.1", "100.128.0.1", "2001:4860:4860::8888"} {
+				g.Assert(IsPublicIP(net.ParseIP(ip))).IsTrue()
+			}
+		})
+
+		g.It("Should deliver signed payloads and retry failures", func() {
+			attempts := 0
+			received := make(chan *http.Request, 1)
+			var body []byte
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				attempts++
+				if attempts < 3 {
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+				body, _ = ioutil.ReadAll(r.Body)
+				received <- r
+			}))
+			defer server.Close()
+
+			delivery, err := NewDelivery(server.URL, "secret", EventSubmissionGraded, 1, map[string]int{"id": 7})
+			g.Assert(err).Equal(nil)
+
+			deliverer := &HTTPDeliverer{Client: server.Client(), Retries: 3, Backoff: time.Millisecond}
+			g.Assert(deliverer.Deliver(delivery)).Equal(nil)
+
+			r := <-received
+			g.Assert(attempts).Equal(3)
+			g.Assert(r.Header.Get(EventHeader)).Equal(EventSubmissionGraded)
+			g.Assert(r.Header.Get(SignatureHeader)).Equal(Sign("secret", body))
+		})
+
+		g.It("Should give up after all retries", func() {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusInternalServerError)
+			}))
+			defer server.Close()
+
+			delivery, err := NewDelivery(server.URL, "secret", EventSubmissionGraded, 1, nil)
+			g.Assert(err).Equal(nil)
+
+			deliverer := &HTTPDeliverer{Client: server.Client(), Retries: 2, Backoff: time.Millisecond}
+			g.Assert(deliverer.Deliver(delivery) != nil).IsTrue()
+		})
+	})
+}